@@ -1,20 +1,26 @@
 package commands
 
 import (
-	"fmt"
-
 	"github.com/spf13/cobra"
 
 	"terraform-wrapper/internal/executor"
+	"terraform-wrapper/internal/output"
 )
 
 func newApplyCommand() *cobra.Command {
-	var stackArg string
+	var (
+		stackArg string
+		closure  closureFlags
+		fromPlan bool
+	)
 	cmd := &cobra.Command{
 		Use:   "apply",
 		Short: "Run terraform apply for a specific stack",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := contextWithCmd(cmd)
+			if err := enforceIdentity(ctx, "apply"); err != nil {
+				return err
+			}
 			g, index, err := loadGraphData()
 			if err != nil {
 				return err
@@ -23,6 +29,40 @@ func newApplyCommand() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			runID, gitSHA := runIdentity(ctx, "apply")
+
+			if closure.enabled() {
+				sub, err := closure.targetGraph(g, stack)
+				if err != nil {
+					return err
+				}
+				res, err := resolveTerraform(ctx, cmd, graphStackPaths(sub))
+				if err != nil {
+					return err
+				}
+				resolvedVersion := ""
+				if res.Version != nil {
+					resolvedVersion = res.Version.String()
+				}
+				opts := executorOptions(res.BinaryPath, resolvedVersion)
+				opts.FromPlan = fromPlan
+				if err := attachExporter(ctx, &opts, graphStacks(sub)...); err != nil {
+					return err
+				}
+				attachPropagator(&opts, g)
+				if err := attachStateTagger(ctx, &opts, runID, gitSHA); err != nil {
+					return err
+				}
+				if err := attachPolicyGate(cmd, &opts); err != nil {
+					return err
+				}
+				summary, err := executor.ApplyAll(ctx, sub, opts)
+				if err != nil {
+					return failRun("apply", summary, err)
+				}
+				printSummary("apply", summary)
+				return nil
+			}
 
 			res, err := resolveTerraform(ctx, cmd, []string{stack.Path})
 			if err != nil {
@@ -35,30 +75,63 @@ func newApplyCommand() *cobra.Command {
 			}
 
 			opts := executorOptions(res.BinaryPath, resolvedVersion)
+			opts.FromPlan = fromPlan
+			if err := attachExporter(ctx, &opts, stack); err != nil {
+				return err
+			}
+			attachPropagator(&opts, g)
+			if err := attachStateTagger(ctx, &opts, runID, gitSHA); err != nil {
+				return err
+			}
+			if err := attachPolicyGate(cmd, &opts); err != nil {
+				return err
+			}
 			summary, err := executor.ApplyStack(ctx, stack, opts)
 			if err != nil {
-				return err
+				return failRun("apply", summary, err)
 			}
 			printSummary("apply", summary)
-			fmt.Printf("stack applied: %s\n", rel)
+			output.Printf("stack applied: %s\n", rel)
 			return nil
 		},
 	}
 	cmd.Flags().StringVar(&stackArg, "stack", "", "stack name or path")
+	cmd.Flags().BoolVar(&fromPlan, "from-plan", false, "apply the plan cached by plan instead of replanning; fails if the stack changed since")
+	closure.register(cmd)
+	registerPolicyFlags(cmd)
 	_ = cmd.MarkFlagRequired("stack")
 	return cmd
 }
 
 func newApplyAllCommand() *cobra.Command {
+	var (
+		idempotencyKey  string
+		publishManifest bool
+		filter          stackFilter
+		releaseSet      releaseFlags
+	)
 	cmd := &cobra.Command{
 		Use:   "apply-all",
 		Short: "Apply all stacks in dependency order",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := contextWithCmd(cmd)
-			g, _, err := loadGraphData()
+			if err := enforceIdentity(ctx, "apply-all"); err != nil {
+				return err
+			}
+			if err := releaseSet.prepare(ctx); err != nil {
+				return err
+			}
+			full, _, err := loadGraphData()
 			if err != nil {
 				return err
 			}
+			g, err := filter.apply(full)
+			if err != nil {
+				return err
+			}
+			if g, err = releaseSet.apply(ctx, g, "apply-all"); err != nil {
+				return err
+			}
 
 			res, err := resolveTerraform(ctx, cmd, graphStackPaths(g))
 			if err != nil {
@@ -70,14 +143,54 @@ func newApplyAllCommand() *cobra.Command {
 				resolvedVersion = res.Version.String()
 			}
 
+			if err := enforceFreeze(ctx, "apply-all"); err != nil {
+				return err
+			}
+
+			run, previous, err := beginRun(ctx, "apply-all", idempotencyKey)
+			if err != nil {
+				return err
+			}
+
 			opts := executorOptions(res.BinaryPath, resolvedVersion)
+			if previous != nil {
+				opts.CompletedStacks = previous.CompletedSet()
+			}
+			if err := attachCheckpoint(ctx, &opts, run); err != nil {
+				return err
+			}
+			if err := attachExporter(ctx, &opts, graphStacks(g)...); err != nil {
+				return err
+			}
+			attachPropagator(&opts, full)
+			if err := attachStateTagger(ctx, &opts, run.ID, run.GitSHA); err != nil {
+				return err
+			}
+			if err := attachPolicyGate(cmd, &opts); err != nil {
+				return err
+			}
 			summary, err := executor.ApplyAll(ctx, g, opts)
+			if recErr := finishRun(run, summary, err); recErr != nil {
+				output.Printf("[run] warning: %v\n", recErr)
+			}
 			if err != nil {
-				return err
+				return failRun("apply-all", summary, err)
 			}
 			printSummary("apply-all", summary)
+			if err := writeManifest(ctx, summary.Completed, resolvedVersion, run.GitSHA, publishManifest); err != nil {
+				output.Printf("[manifest] warning: %v\n", err)
+			}
 			return nil
 		},
 	}
+	cmd.Flags().BoolVar(&publishManifest, "publish-manifest", false, "also upload the deployed-versions manifest to the state bucket")
+	cmd.Flags().StringVar(&breakFreeze, "break-freeze", "", "reason for overriding an active change freeze")
+	cmd.Flags().StringVar(&idempotencyKey, "idempotency-key", "", "skip stacks already applied by a previous run with the same key, environment and git SHA")
+	filter.register(cmd)
+	releaseSet.register(cmd)
+	cmd.MarkFlagsMutuallyExclusive("manifest", "only")
+	cmd.MarkFlagsMutuallyExclusive("manifest", "exclude")
+	registerPolicyFlags(cmd)
+	registerKeepGoingFlag(cmd)
 	return cmd
 }
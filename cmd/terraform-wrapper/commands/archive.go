@@ -0,0 +1,165 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"terraform-wrapper/internal/archive"
+	"terraform-wrapper/internal/audit"
+	"terraform-wrapper/internal/executor"
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/runs"
+	"terraform-wrapper/internal/stacks"
+)
+
+func newArchiveStackCommand() *cobra.Command {
+	var (
+		destroy     bool
+		autoApprove bool
+	)
+	cmd := &cobra.Command{
+		Use:   "archive-stack <path>",
+		Short: "Move a stack with an empty state to the archive and detach it from its dependents",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := contextWithCmd(cmd)
+			g, index, err := loadGraphData()
+			if err != nil {
+				return err
+			}
+			stack, rel, err := resolveStackArg(g, index, args[0])
+			if err != nil {
+				return err
+			}
+
+			res, err := resolveTerraform(ctx, cmd, []string{stack.Path})
+			if err != nil {
+				return err
+			}
+			resolvedVersion := ""
+			if res.Version != nil {
+				resolvedVersion = res.Version.String()
+			}
+
+			runner, err := stacks.NewRunner(ctx, stacks.RunnerOptions{
+				RootDir:       rootDir,
+				Environment:   environment,
+				AccountID:     accountID,
+				Region:        region,
+				TerraformPath: res.BinaryPath,
+				Profile:       profile,
+				Workspace:     workspace,
+				StateKMSKeyID: stateKMSKeyID,
+				StateBackend:  stateBackend,
+				AssumeRoleARN: assumeRoleARN,
+				Retry:         retryPolicy,
+				TFLog:         tfLog,
+				TFLogDir:      runLogDir,
+				ExtraVarFiles: extraVarFiles,
+			})
+			if err != nil {
+				return err
+			}
+
+			rec := &runs.Record{
+				Environment: environment,
+				Tenant:      tenantName,
+				Operation:   "archive-stack",
+				GitSHA:      runs.GitSHA(ctx, rootDir),
+				Actor:       audit.Actor(),
+				CallerARN:   operatorARN(ctx),
+				Status:      runs.StatusRunning,
+				StartedAt:   time.Now().UTC(),
+			}
+			rec.ID = runs.NewID(envScope(), rec.GitSHA, rec.Operation, rel)
+
+			resources, err := runner.StateResources(ctx, stack.Path)
+			if err != nil {
+				return fmt.Errorf("read state of %s: %w", rel, err)
+			}
+			if len(resources) > 0 {
+				if !destroy {
+					return fmt.Errorf("state of %s still holds %d resources (%s); destroy them first or pass --destroy", rel, len(resources), strings.Join(resources, ", "))
+				}
+				if !autoApprove {
+					ok, err := confirmArchiveDestroy(rel, resources)
+					if err != nil {
+						return err
+					}
+					if !ok {
+						return fmt.Errorf("archive of %s cancelled", rel)
+					}
+				}
+				if err := enforceFreeze(ctx, "archive-stack"); err != nil {
+					return err
+				}
+				opts := executorOptions(res.BinaryPath, resolvedVersion)
+				summary, err := executor.DestroyStack(ctx, stack, opts)
+				if err != nil {
+					return failRun("archive-stack", summary, err)
+				}
+				if resources, err = runner.StateResources(ctx, stack.Path); err != nil {
+					return fmt.Errorf("read state of %s: %w", rel, err)
+				}
+				if len(resources) > 0 {
+					return fmt.Errorf("state of %s still holds %d resources after destroy", rel, len(resources))
+				}
+			}
+			output.Printf("[archive] state of %s is empty\n", rel)
+
+			result, err := archive.Archive(rootDir, g, stack.Path)
+			if result != nil {
+				for _, dependent := range result.Dependents {
+					output.Printf("[archive] removed %s from the dependencies of %s\n", rel, relOrPath(dependent))
+				}
+				for _, dir := range result.Caches {
+					output.Printf("[archive] deleted plan cache %s\n", relOrPath(dir))
+				}
+			}
+			if err != nil {
+				return err
+			}
+			output.Printf("[archive] moved %s to %s\n", rel, relOrPath(result.Destination))
+
+			rec.Completed = []string{rel}
+			rec.Status = runs.StatusSucceeded
+			rec.FinishedAt = time.Now().UTC()
+			if err := runs.Save(rootDir, rec); err != nil {
+				return fmt.Errorf("save run record: %w", err)
+			}
+			output.Printf("[run] id=%s operation=%s recorded\n", rec.ID, rec.Operation)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&destroy, "destroy", false, "destroy the stack's remaining resources before archiving it")
+	cmd.Flags().BoolVar(&autoApprove, "auto-approve", false, "destroy without asking for confirmation")
+	cmd.Flags().StringVar(&breakFreeze, "break-freeze", "", "reason for overriding an active change freeze")
+	return cmd
+}
+
+// relOrPath renders path relative to the root directory when possible.
+func relOrPath(path string) string {
+	rel, err := filepathRelSafe(rootDir, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+func confirmArchiveDestroy(rel string, resources []string) (bool, error) {
+	for _, address := range resources {
+		output.Printf("  - %s\n", address)
+	}
+	output.Printf("Destroy %d resources of %s and archive it? Only 'yes' will be accepted: ", len(resources), rel)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false, fmt.Errorf("read confirmation: %w", err)
+	}
+	return strings.TrimSpace(answer) == "yes", nil
+}
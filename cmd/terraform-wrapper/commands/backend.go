@@ -0,0 +1,327 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"terraform-wrapper/internal/audit"
+	"terraform-wrapper/internal/awsaccount"
+	"terraform-wrapper/internal/graph"
+	"terraform-wrapper/internal/lock"
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/stacks"
+	"terraform-wrapper/internal/statekms"
+	"terraform-wrapper/internal/statelayout"
+	"terraform-wrapper/internal/wrapperconfig"
+)
+
+func newBackendCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "backend",
+		Short: "Manage where the environment's state is stored",
+	}
+	cmd.AddCommand(newBackendMigrateCommand())
+	cmd.AddCommand(newBackendCleanupCommand())
+	return cmd
+}
+
+func newBackendMigrateCommand() *cobra.Command {
+	var (
+		toPattern   string
+		deleteAfter string
+		dryRun      bool
+	)
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Move every stack's state object to keys named by a new key pattern",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := contextWithCmd(cmd)
+			if err := statelayout.Validate(toPattern); err != nil {
+				return err
+			}
+			var retention time.Duration
+			if deleteAfter != "" {
+				var err error
+				if retention, err = parseAge(deleteAfter); err != nil {
+					return fmt.Errorf("--delete-after: %w", err)
+				}
+			}
+			if stateBackend != nil && stateBackend.Type != "" && stateBackend.Type != stacks.BackendS3 {
+				return fmt.Errorf("backend migrate supports the s3 state backend only, not %s", stateBackend.Type)
+			}
+
+			rootAbs, err := filepath.Abs(rootDir)
+			if err != nil {
+				return err
+			}
+			cfg, err := statelayout.LoadConfig(rootAbs)
+			if err != nil {
+				return err
+			}
+			envCfg := cfg.Environments[environment]
+			fromPattern := envCfg.KeyPattern
+			if fromPattern == "" {
+				if stateBackend != nil && stateBackend.KeyTemplate != "" {
+					return fmt.Errorf("backend migrate moves state from the default key layout, but %s names keys with key_template", wrapperconfig.FileName)
+				}
+				fromPattern = statelayout.DefaultKeyPattern
+			}
+			if fromPattern == toPattern {
+				output.Printf("[backend] %s already uses %s\n", environment, toPattern)
+				return nil
+			}
+
+			// Gated stacks keep state too, so the whole graph is migrated.
+			g, err := graph.Build(rootAbs)
+			if err != nil {
+				return err
+			}
+			bucket := stateBucketFor(accountID)
+			stackVars, err := migrationStacks(g, rootAbs, bucket)
+			if err != nil {
+				return err
+			}
+
+			client, err := stateBucketClient(ctx)
+			if err != nil {
+				return err
+			}
+			keys, err := statekms.StateKeys(ctx, client, bucket, environment)
+			if err != nil {
+				return err
+			}
+			moves, unowned, err := statelayout.PlanMoves(fromPattern, toPattern, stackVars, keys)
+			if err != nil {
+				return err
+			}
+			for _, key := range unowned {
+				output.Printf("[backend] s3://%s/%s belongs to no stack and stays in place\n", bucket, key)
+			}
+			if len(moves) == 0 {
+				output.Printf("[backend] no state objects to move in s3://%s/%s/\n", bucket, environment)
+			}
+			for _, move := range moves {
+				output.Printf("[backend] %s -> %s\n", move.From, move.To)
+			}
+			if dryRun {
+				return nil
+			}
+
+			if err := enforceFreeze(ctx, "backend migrate"); err != nil {
+				return err
+			}
+			orchestration := &lock.OrchestrationLock{
+				Bucket:    bucket,
+				Env:       environment,
+				Command:   "backend migrate",
+				CallerARN: operatorARN(ctx),
+				Client:    client,
+			}
+			if err := orchestration.Acquire(ctx, false, false); err != nil {
+				return err
+			}
+			defer func() {
+				if err := orchestration.Release(ctx); err != nil {
+					output.Printf("[backend] warning: %v\n", err)
+				}
+			}()
+
+			now := time.Now().UTC()
+			for i, move := range moves {
+				result, err := statelayout.Copy(ctx, client, bucket, move.From, move.To, stateKMSKeyID)
+				if err != nil {
+					return fmt.Errorf("migration stopped after %d of %d objects, %s still uses its old keys; run it again to resume: %w", i, len(moves), environment, err)
+				}
+				status := "copied and verified"
+				if result.Skipped {
+					status = "already copied"
+				}
+				output.Printf("[backend] (%d/%d) %s: %s (serial %d, sha256 %s)\n", i+1, len(moves), move.To, status, result.Serial, result.Checksum[:12])
+
+				if deleteAfter != "" {
+					envCfg.Retired = append(envCfg.Retired, statelayout.RetiredObject{
+						Bucket:      bucket,
+						Key:         move.From,
+						MigratedTo:  move.To,
+						MigratedAt:  now,
+						DeleteAfter: now.Add(retention),
+					})
+				}
+			}
+
+			envCfg.KeyPattern = toPattern
+			cfg.Environments[environment] = envCfg
+			if err := statelayout.SaveConfig(rootAbs, cfg); err != nil {
+				return fmt.Errorf("record key pattern: %w", err)
+			}
+			output.Printf("[backend] %s now names %s state with %s; commit it so backend configuration picks up the new keys\n", statelayout.ConfigFile, environment, toPattern)
+
+			// Stacks initialised against the old keys would otherwise refuse
+			// the changed backend configuration on their next init.
+			for _, stack := range graphStackPaths(g) {
+				if err := os.Remove(filepath.Join(stack, ".terraform", "terraform.tfstate")); err != nil && !errors.Is(err, os.ErrNotExist) {
+					return fmt.Errorf("reset backend of %s: %w", relOrPath(stack), err)
+				}
+			}
+			switch {
+			case len(moves) == 0:
+			case deleteAfter == "":
+				output.Printf("[backend] the %d old state objects are kept in place; delete them by hand once no longer needed\n", len(moves))
+			default:
+				output.Printf("[backend] the %d old state objects can be deleted with backend cleanup after %s\n", len(moves), now.Add(retention).Format(time.RFC3339))
+			}
+
+			return auditTrail(client).Record(ctx, audit.Entry{
+				Action: "backend-migrate",
+				Details: map[string]string{
+					"from_pattern": fromPattern,
+					"to_pattern":   toPattern,
+					"objects":      fmt.Sprint(len(moves)),
+				},
+			})
+		},
+	}
+	cmd.Flags().StringVar(&toPattern, "to-pattern", "", "new state key pattern, e.g. '{env}/[{workspace}/]{stack_path}/terraform.tfstate'")
+	cmd.Flags().StringVar(&deleteAfter, "delete-after", "", "let backend cleanup delete the old state objects after this retention window (e.g. 7d); they are kept when unset")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "list the state objects that would be moved")
+	_ = cmd.MarkFlagRequired("to-pattern")
+	return cmd
+}
+
+// migrationStacks returns the key pattern values of the stacks of g, failing
+// when a stack keeps its state outside bucket, since a migration only moves
+// the objects of one bucket. Stacks using another backend type are left out.
+func migrationStacks(g graph.Graph, rootAbs, bucket string) ([]statelayout.Vars, error) {
+	var vars []statelayout.Vars
+	var elsewhere []string
+	for _, stackDir := range graphStackPaths(g) {
+		rel, err := filepathRelSafe(rootAbs, stackDir)
+		if err != nil {
+			return nil, err
+		}
+		rel = filepath.ToSlash(rel)
+		settings, err := stacks.LoadBackendSettings(stackDir)
+		if err != nil {
+			return nil, err
+		}
+		if settings != nil && settings.Type != "" && settings.Type != stacks.BackendS3 {
+			continue
+		}
+		role, err := stacks.StackRoleARN(stackDir)
+		if err != nil {
+			return nil, err
+		}
+		if role == "" {
+			role = assumeRoleARN
+		}
+		if role != "" {
+			account, err := awsaccount.AccountIDFromRoleARN(role)
+			if err != nil {
+				return nil, err
+			}
+			if stateBucketFor(account) != bucket {
+				elsewhere = append(elsewhere, rel)
+				continue
+			}
+		}
+		vars = append(vars, statelayout.Vars{
+			Environment: environment,
+			Stack:       filepath.Base(stackDir),
+			StackPath:   rel,
+		})
+	}
+	if len(elsewhere) > 0 {
+		sort.Strings(elsewhere)
+		return nil, fmt.Errorf("stacks %v keep their state in another account; backend migrate only moves s3://%s", elsewhere, bucket)
+	}
+	return vars, nil
+}
+
+func newBackendCleanupCommand() *cobra.Command {
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "cleanup",
+		Short: "Delete the old state objects of a migration once their retention window has passed",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := contextWithCmd(cmd)
+			rootAbs, err := filepath.Abs(rootDir)
+			if err != nil {
+				return err
+			}
+			cfg, err := statelayout.LoadConfig(rootAbs)
+			if err != nil {
+				return err
+			}
+			envCfg := cfg.Environments[environment]
+			if len(envCfg.Retired) == 0 {
+				output.Printf("[backend] no retired state objects for %s\n", environment)
+				return nil
+			}
+
+			client, err := stateBucketClient(ctx)
+			if err != nil {
+				return err
+			}
+			now := time.Now()
+			var kept []statelayout.RetiredObject
+			deleted := 0
+			for _, obj := range envCfg.Retired {
+				if now.Before(obj.DeleteAfter) {
+					kept = append(kept, obj)
+					continue
+				}
+				if dryRun {
+					output.Printf("[backend] would delete s3://%s/%s\n", obj.Bucket, obj.Key)
+					continue
+				}
+				if err := deleteRetired(ctx, client, obj); err != nil {
+					kept = append(kept, obj)
+					output.Printf("[backend] warning: %v\n", err)
+					continue
+				}
+				deleted++
+				output.Printf("[backend] deleted s3://%s/%s (migrated to %s)\n", obj.Bucket, obj.Key, obj.MigratedTo)
+			}
+			if len(kept) > 0 {
+				output.Printf("[backend] %d retired state objects are kept until their retention window passes\n", len(kept))
+			}
+			if dryRun || deleted == 0 {
+				return nil
+			}
+
+			envCfg.Retired = kept
+			cfg.Environments[environment] = envCfg
+			if err := statelayout.SaveConfig(rootAbs, cfg); err != nil {
+				return err
+			}
+			return auditTrail(client).Record(ctx, audit.Entry{
+				Action: "backend-cleanup",
+				Details: map[string]string{
+					"deleted": fmt.Sprint(deleted),
+				},
+			})
+		},
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "list the state objects that would be deleted")
+	return cmd
+}
+
+// deleteRetired deletes a retired state object after checking that the copy
+// it was migrated to still exists.
+func deleteRetired(ctx context.Context, client statelayout.S3API, obj statelayout.RetiredObject) error {
+	ok, err := statelayout.Exists(ctx, client, obj.Bucket, obj.MigratedTo)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("keeping s3://%s/%s: its copy %s is missing", obj.Bucket, obj.Key, obj.MigratedTo)
+	}
+	return statelayout.Delete(ctx, client, obj)
+}
@@ -1,19 +1,34 @@
 package commands
 
 import (
+	"fmt"
 	"path/filepath"
 
 	"github.com/spf13/cobra"
 
 	"terraform-wrapper/internal/bootstrap"
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/stacks"
+	"terraform-wrapper/internal/statelayout"
 )
 
 func newBootstrapCommand() *cobra.Command {
+	var check bool
 	cmd := &cobra.Command{
 		Use:   "bootstrap",
 		Short: "Bootstrap backend infrastructure",
+		Long: `Apply the core-services/bootstrap stack with local state, then migrate its
+state into the bucket it created. A backend that is already bootstrapped is left
+alone, so bootstrap can be rerun safely.
+
+With --check, validate the state bucket, its encryption, versioning and policy,
+the bootstrap stack's state and the DynamoDB lock table, without changing
+anything.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := contextWithCmd(cmd)
+			if check {
+				return checkBackend(cmd)
+			}
 			g, _, err := loadGraphData()
 			if err != nil {
 				return err
@@ -28,6 +43,10 @@ func newBootstrapCommand() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			key, err := bootstrapStateKey()
+			if err != nil {
+				return err
+			}
 
 			return bootstrap.Run(ctx, bootstrap.Options{
 				RootDir:       rootDir,
@@ -35,12 +54,90 @@ func newBootstrapCommand() *cobra.Command {
 				Environment:   environment,
 				AccountID:     accountID,
 				Region:        region,
+				LockTable:     stateLockTable(),
+				Bucket:        stateBucketFor(accountID),
+				StateKey:      key,
 			})
 		},
 	}
+	cmd.Flags().BoolVar(&check, "check", false, "validate the state backend without changing anything")
 	return cmd
 }
 
+// checkBackend prints the outcome of each backend check and fails when any
+// of them did.
+func checkBackend(cmd *cobra.Command) error {
+	key, err := bootstrapStateKey()
+	if err != nil {
+		return err
+	}
+	results, err := bootstrap.Check(contextWithCmd(cmd), bootstrap.Options{
+		RootDir:     rootDir,
+		Environment: environment,
+		AccountID:   accountID,
+		Region:      region,
+		LockTable:   stateLockTable(),
+		Bucket:      stateBucketFor(accountID),
+		StateKey:    key,
+	})
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, r := range results {
+		mark := "ok"
+		if !r.OK {
+			mark = "FAIL"
+			failed++
+		}
+		output.Printf("[bootstrap] %-4s %-10s %s\n", mark, r.Name, r.Detail)
+	}
+	if failed > 0 {
+		return fmt.Errorf("backend check failed: %d of %d checks", failed, len(results))
+	}
+	output.Printf("[bootstrap] backend of %s is bootstrapped\n", environment)
+	return nil
+}
+
+// bootstrapStateKey returns the key of the bootstrap stack's state, named
+// like any other stack's by the backend's key_template or the environment's
+// key pattern.
+func bootstrapStateKey() (string, error) {
+	rootAbs, err := filepath.Abs(rootDir)
+	if err != nil {
+		return "", err
+	}
+	keyPattern, err := statelayout.KeyPattern(rootAbs, environment)
+	if err != nil {
+		return "", err
+	}
+	naming, err := stateBackend.Naming()
+	if err != nil {
+		return "", err
+	}
+	return stacks.BackendTarget{
+		Environment: environment,
+		Stack:       "bootstrap",
+		AccountID:   accountID,
+		Region:      region,
+		StackPath:   "core-services/bootstrap",
+		KeyPattern:  keyPattern,
+		Naming:      naming,
+	}.S3Key(), nil
+}
+
+// stateLockTable returns the DynamoDB table state is locked with, "" when the
+// backend uses S3 lock files.
+func stateLockTable() string {
+	if stateBackend == nil || !stateBackend.UseDynamoDBLock {
+		return ""
+	}
+	if stateBackend.DynamoDBTable != "" {
+		return stateBackend.DynamoDBTable
+	}
+	return stacks.StateLockTable(stateBucketFor(accountID))
+}
+
 func defaultBootstrapStacks() []string {
 	var paths []string
 	bootstrapPath := filepath.Join(rootDir, "core-services", "bootstrap")
@@ -0,0 +1,273 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"terraform-wrapper/internal/cache"
+	"terraform-wrapper/internal/dockerexec"
+	"terraform-wrapper/internal/executor"
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/procmon"
+)
+
+// sharedPlanCache returns the plan cache selected with --cache-backend that
+// plans are shared through, or nil for the local cache alone.
+func sharedPlanCache(ctx context.Context) (cache.Remote, error) {
+	switch cacheBackend {
+	case "", cache.BackendLocal:
+		if cacheBucket != "" {
+			return nil, fmt.Errorf("--cache-bucket needs --cache-backend %s", cache.BackendS3)
+		}
+		return nil, nil
+	case cache.BackendS3:
+		if cacheBucket == "" {
+			return nil, fmt.Errorf("--cache-backend %s needs --cache-bucket", cache.BackendS3)
+		}
+		client, err := stateBucketClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &cache.S3{Client: client, Bucket: cacheBucket}, nil
+	default:
+		return nil, fmt.Errorf("unknown --cache-backend %q: use %s or %s", cacheBackend, cache.BackendLocal, cache.BackendS3)
+	}
+}
+
+func newCacheCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the local plan and provider caches",
+	}
+	cmd.AddCommand(newCacheWarmCommand())
+	cmd.AddCommand(newCacheListCommand())
+	cmd.AddCommand(newCachePruneCommand())
+	cmd.AddCommand(newCacheClearCommand())
+	return cmd
+}
+
+// cacheEntries lists the plan cache of the selected environment, limited to
+// --workspace when one is set.
+func cacheEntries() ([]cache.Entry, error) {
+	entries, err := cache.List(rootDir, tenantName, environment)
+	if err != nil || workspace == "" {
+		return entries, err
+	}
+	var scoped []cache.Entry
+	for _, entry := range entries {
+		if entry.Workspace == workspace {
+			scoped = append(scoped, entry)
+		}
+	}
+	return scoped, nil
+}
+
+func newCacheListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:     "ls",
+		Aliases: []string{"list"},
+		Short:   "List the cached plans of the environment",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, err := cacheEntries()
+			if err != nil {
+				return err
+			}
+			if len(entries) == 0 {
+				output.Printf("[cache] no cached plans for %s\n", environment)
+				return nil
+			}
+			now := time.Now()
+			var total int64
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "STACK\tWORKSPACE\tFILES\tSIZE\tAGE")
+			for _, entry := range entries {
+				fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", entry.Stack, entry.Workspace, entry.Files,
+					procmon.FormatBytes(uint64(entry.Size)), formatAge(now.Sub(entry.Modified)))
+				total += entry.Size
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+			output.Printf("[cache] %d stacks, %s in %s\n", len(entries), procmon.FormatBytes(uint64(total)), cache.Dir(rootDir))
+			return nil
+		},
+	}
+}
+
+func newCachePruneCommand() *cobra.Command {
+	var (
+		olderThan string
+		dryRun    bool
+	)
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove cached plans not written within --older-than",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			age, err := parseAge(olderThan)
+			if err != nil {
+				return fmt.Errorf("--older-than: %w", err)
+			}
+			entries, err := cacheEntries()
+			if err != nil {
+				return err
+			}
+			cutoff := time.Now().Add(-age)
+			var stale []cache.Entry
+			for _, entry := range entries {
+				if entry.Modified.Before(cutoff) {
+					stale = append(stale, entry)
+				}
+			}
+			return removeCacheEntries(stale, dryRun)
+		},
+	}
+	cmd.Flags().StringVar(&olderThan, "older-than", "7d", "remove plans last written longer ago than this, e.g. 12h or 7d")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "list the plans that would be removed without removing them")
+	return cmd
+}
+
+func newCacheClearCommand() *cobra.Command {
+	var (
+		stackArgs []string
+		dryRun    bool
+	)
+	cmd := &cobra.Command{
+		Use:   "clear",
+		Short: "Remove the cached plans of the environment, or of --stack",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, err := cacheEntries()
+			if err != nil {
+				return err
+			}
+			if len(stackArgs) == 0 {
+				return removeCacheEntries(entries, dryRun)
+			}
+			// Stacks are matched by the cached path rather than the graph, so
+			// the plans of deleted stacks can be cleared too.
+			var selected []cache.Entry
+			for _, arg := range stackArgs {
+				rel := normalizeStackName(arg)
+				matched := false
+				for _, entry := range entries {
+					if entry.Stack == rel || (!strings.Contains(arg, "/") && filepath.Base(entry.Stack) == arg) {
+						selected = append(selected, entry)
+						matched = true
+					}
+				}
+				if !matched {
+					return fmt.Errorf("no cached plans for stack %q in %s", arg, environment)
+				}
+			}
+			return removeCacheEntries(selected, dryRun)
+		},
+	}
+	cmd.Flags().StringSliceVar(&stackArgs, "stack", nil, "only clear these stacks (name or path)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "list the plans that would be removed without removing them")
+	return cmd
+}
+
+func removeCacheEntries(entries []cache.Entry, dryRun bool) error {
+	verb := "removed"
+	if dryRun {
+		verb = "would remove"
+	}
+	var total int64
+	for _, entry := range entries {
+		label := entry.Stack
+		if entry.Workspace != "" {
+			label += " (workspace " + entry.Workspace + ")"
+		}
+		output.Printf("[cache] %s %s (%s)\n", verb, label, procmon.FormatBytes(uint64(entry.Size)))
+		total += entry.Size
+	}
+	if !dryRun {
+		if err := cache.Remove(rootDir, entries); err != nil {
+			return err
+		}
+	}
+	output.Printf("[cache] %s %d stacks, %s\n", verb, len(entries), procmon.FormatBytes(uint64(total)))
+	return nil
+}
+
+// parseAge parses a duration that may also be given in days, such as 7d.
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	age, err := time.ParseDuration(s)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+	return age, nil
+}
+
+// formatAge renders d to the largest whole unit, e.g. 3d or 5h.
+func formatAge(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%dd", int(d/(24*time.Hour)))
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh", int(d/time.Hour))
+	default:
+		return fmt.Sprintf("%dm", int(d/time.Minute))
+	}
+}
+
+func newCacheWarmCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "warm",
+		Short: "Init and plan every stack concurrently to populate the plan and provider caches",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := contextWithCmd(cmd)
+			g, _, err := loadGraphData()
+			if err != nil {
+				return err
+			}
+
+			pluginCache, err := dockerexec.DefaultPluginCacheDir()
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(pluginCache, 0o755); err != nil {
+				return fmt.Errorf("create provider plugin cache: %w", err)
+			}
+			if err := os.Setenv("TF_PLUGIN_CACHE_DIR", pluginCache); err != nil {
+				return err
+			}
+
+			res, err := resolveTerraform(ctx, cmd, graphStackPaths(g))
+			if err != nil {
+				return err
+			}
+			resolvedVersion := ""
+			if res.Version != nil {
+				resolvedVersion = res.Version.String()
+			}
+
+			opts := executorOptions(res.BinaryPath, resolvedVersion)
+			if !cmd.Flags().Changed("parallelism") {
+				opts.Parallelism = 0
+			}
+			opts.Backend = nil
+			summary, err := executor.WarmCache(ctx, g, opts)
+			if err != nil {
+				return err
+			}
+			output.Printf("[cache] warmed %d stacks (%d planned, %d already current); providers cached in %s\n",
+				len(g), summary.Executed, summary.Cached, pluginCache)
+			return nil
+		},
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"terraform-wrapper/internal/graph"
+	"terraform-wrapper/internal/output"
 )
 
 func newCleanCommand() *cobra.Command {
@@ -31,7 +32,7 @@ func newCleanCommand() *cobra.Command {
 				return err
 			}
 
-			fmt.Printf("[clean] removed .terraform artifacts for %s\n", rel)
+			output.Printf("[clean] removed .terraform artifacts for %s\n", rel)
 			return nil
 		},
 	}
@@ -42,6 +43,7 @@ func newCleanCommand() *cobra.Command {
 }
 
 func newCleanAllCommand() *cobra.Command {
+	var filter stackFilter
 	cmd := &cobra.Command{
 		Use:   "clean-all",
 		Short: "Remove .terraform artifacts for every stack",
@@ -50,6 +52,9 @@ func newCleanAllCommand() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			if g, err = filter.apply(g); err != nil {
+				return err
+			}
 
 			stacks := make([]*graph.Stack, 0, len(g))
 			for _, stack := range g {
@@ -65,13 +70,14 @@ func newCleanAllCommand() *cobra.Command {
 				if err != nil {
 					rel = stack.Path
 				}
-				fmt.Printf("[clean] removed .terraform artifacts for %s\n", rel)
+				output.Printf("[clean] removed .terraform artifacts for %s\n", rel)
 			}
 
 			return nil
 		},
 	}
 
+	filter.register(cmd)
 	return cmd
 }
 
@@ -0,0 +1,130 @@
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"terraform-wrapper/internal/stacks"
+	"terraform-wrapper/internal/superplan"
+	"terraform-wrapper/internal/wrapperconfig"
+)
+
+// applyConfigFile fills in settings from terraform-wrapper.hcl in the stack
+// root. Flags given on the command line always take precedence.
+func applyConfigFile(cmd *cobra.Command) error {
+	file, err := wrapperconfig.Load(rootDir)
+	if err != nil || file == nil {
+		return err
+	}
+
+	flags := cmd.Flags()
+	if !flags.Changed("environment") && !flags.Changed("env") && file.DefaultEnvironment != nil {
+		environment = *file.DefaultEnvironment
+	}
+	env := environment
+	if envAlias != "" {
+		env = envAlias
+	}
+
+	settings := file.For(env)
+	if settings.AccountID != nil && !flags.Changed("account-id") {
+		accountID = *settings.AccountID
+	}
+	if settings.Region != nil && !flags.Changed("region") {
+		region = *settings.Region
+	}
+	if settings.Parallelism != nil && !flags.Changed("parallelism") {
+		parallelism = *settings.Parallelism
+	}
+	if settings.AdaptiveParallelism != nil && !flags.Changed("adaptive-parallelism") {
+		adaptive = *settings.AdaptiveParallelism
+	}
+	if settings.Cache != nil && !flags.Changed("cache") {
+		cacheEnabled = *settings.Cache
+	}
+	if settings.StateBackups != nil && !flags.Changed("state-backups") {
+		backupsEnabled = *settings.StateBackups
+	}
+	if settings.Refresh != nil && !flags.Changed("refresh") {
+		refreshState = *settings.Refresh
+	}
+	if settings.ForcePlan != nil && !flags.Changed("force-plan") {
+		forcePlanStacks = settings.ForcePlan
+	}
+	if settings.TerraformVersion != nil && !flags.Changed("terraform-version") {
+		terraformVersion = *settings.TerraformVersion
+	}
+	if settings.Engine != nil && !flags.Changed("engine") {
+		engineName = *settings.Engine
+	}
+	if settings.ReleasesMirror != nil && !flags.Changed("releases-mirror") {
+		releasesMirror = *settings.ReleasesMirror
+	}
+	if settings.CLIConfig != nil && !flags.Changed("cli-config") {
+		cliConfig = *settings.CLIConfig
+	}
+	if settings.PluginCache != nil && !flags.Changed("plugin-cache") {
+		pluginCacheEnabled = *settings.PluginCache
+	}
+	if settings.PluginCacheLock != nil && !flags.Changed("plugin-cache-lock") {
+		pluginCacheLock = *settings.PluginCacheLock
+	}
+	if settings.Profile != nil && !flags.Changed("profile") {
+		profile = *settings.Profile
+	}
+	if settings.Backend != nil {
+		if _, err := stacks.NewBackendProvider(settings.Backend); err != nil {
+			return fmt.Errorf("%s: %w", wrapperconfig.FileName, err)
+		}
+		stateBackend = settings.Backend
+	}
+	allowedRegions = settings.AllowedRegions
+	applyIdentities = settings.ApplyIdentities
+	if settings.AssumeRoleARN != nil && !flags.Changed("assume-role-arn") {
+		assumeRoleARN = *settings.AssumeRoleARN
+	}
+	if settings.RetryAttempts != nil && !flags.Changed("retry-attempts") {
+		retryAttempts = *settings.RetryAttempts
+	}
+	if settings.RetryDelay != nil && !flags.Changed("retry-delay") {
+		delay, err := time.ParseDuration(*settings.RetryDelay)
+		if err != nil {
+			return fmt.Errorf("%s: invalid retry_delay: %w", wrapperconfig.FileName, err)
+		}
+		retryDelay = delay
+	}
+	retryPatterns = settings.RetryPatterns
+	if settings.LockWait != nil && !flags.Changed("lock-wait") {
+		wait, err := time.ParseDuration(*settings.LockWait)
+		if err != nil {
+			return fmt.Errorf("%s: invalid lock_wait: %w", wrapperconfig.FileName, err)
+		}
+		lockWait = wait
+	}
+	if settings.Tenant != nil && !flags.Changed("tenant") {
+		tenantName = *settings.Tenant
+	}
+	if settings.KeepRuns != nil && !flags.Changed("keep-runs") {
+		keepRuns = *settings.KeepRuns
+	}
+	if settings.MaxArtifactAge != nil && !flags.Changed("max-artifact-age") {
+		maxArtifactAge = *settings.MaxArtifactAge
+	}
+	if len(settings.TagAttributes) > 0 {
+		tagAttributes = make(superplan.TagAttributes, len(settings.TagAttributes))
+		for _, block := range settings.TagAttributes {
+			tagAttributes[block.Provider] = block.Attributes
+		}
+	}
+	return nil
+}
+
+// stateBucketFor returns the state bucket of account in the selected region,
+// named by the backend's bucket_template when it has one.
+func stateBucketFor(account string) string {
+	// applyConfigFile has already rejected invalid templates.
+	naming, _ := stateBackend.Naming()
+	return naming.Bucket(stacks.NameVars{AccountID: account, Region: region, Env: environment})
+}
@@ -0,0 +1,85 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"terraform-wrapper/internal/contract"
+	"terraform-wrapper/internal/graph"
+	"terraform-wrapper/internal/output"
+)
+
+func newContractsCommand() *cobra.Command {
+	var (
+		format string
+		check  bool
+	)
+	cmd := &cobra.Command{
+		Use:   "contracts",
+		Short: "Document each stack's variables, outputs and consumed upstream outputs",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			g, _, err := loadGraphData()
+			if err != nil {
+				return err
+			}
+			if check {
+				return checkContracts(g)
+			}
+			contracts, err := contract.Build(rootDir, g)
+			if err != nil {
+				return err
+			}
+			switch format {
+			case "markdown":
+				fmt.Print(contract.Markdown(contracts))
+				return nil
+			case "json":
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(contracts)
+			default:
+				return fmt.Errorf("unknown --format %q: use markdown or json", format)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", "markdown", "output format: markdown or json")
+	cmd.Flags().BoolVar(&check, "check", false, "instead of printing the contracts, fail when a stack consumes an output its upstream does not produce")
+	return cmd
+}
+
+// checkContracts fails when a stack of g consumes an upstream output that is
+// not produced, naming every consumer. Outputs removed since the contracts
+// were last recorded are reported; the contracts are recorded once they pass.
+func checkContracts(g graph.Graph) error {
+	contracts, err := contract.Build(rootDir, g)
+	if err != nil {
+		return err
+	}
+	path := contract.SnapshotPath(rootDir)
+	previous, err := contract.Load(path)
+	if err != nil {
+		return err
+	}
+	if violations := contract.Check(contracts, previous); len(violations) > 0 {
+		return fmt.Errorf("contract check failed: %s", contract.Report(violations))
+	}
+
+	removed := contract.Removed(contracts, previous)
+	stacks := make([]string, 0, len(removed))
+	for stack := range removed {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+	for _, stack := range stacks {
+		output.Printf("[contracts] %s: outputs removed since the last check, consumed by no stack: %s\n", stack, strings.Join(removed[stack], ", "))
+	}
+	if err := contract.Save(path, contracts); err != nil {
+		return fmt.Errorf("record contracts: %w", err)
+	}
+	return nil
+}
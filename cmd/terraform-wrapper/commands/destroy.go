@@ -1,11 +1,10 @@
 package commands
 
 import (
-	"fmt"
-
 	"github.com/spf13/cobra"
 
 	"terraform-wrapper/internal/executor"
+	"terraform-wrapper/internal/output"
 )
 
 func newDestroyCommand() *cobra.Command {
@@ -15,6 +14,9 @@ func newDestroyCommand() *cobra.Command {
 		Short: "Run terraform destroy for a specific stack",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := contextWithCmd(cmd)
+			if err := enforceIdentity(ctx, "destroy"); err != nil {
+				return err
+			}
 			g, index, err := loadGraphData()
 			if err != nil {
 				return err
@@ -37,10 +39,10 @@ func newDestroyCommand() *cobra.Command {
 			opts := executorOptions(res.BinaryPath, resolvedVersion)
 			summary, err := executor.DestroyStack(ctx, stack, opts)
 			if err != nil {
-				return err
+				return failRun("destroy", summary, err)
 			}
 			printSummary("destroy", summary)
-			fmt.Printf("stack destroyed: %s\n", rel)
+			output.Printf("stack destroyed: %s\n", rel)
 			return nil
 		},
 	}
@@ -50,15 +52,22 @@ func newDestroyCommand() *cobra.Command {
 }
 
 func newDestroyAllCommand() *cobra.Command {
+	var filter stackFilter
 	cmd := &cobra.Command{
 		Use:   "destroy-all",
 		Short: "Destroy all stacks in reverse dependency order",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := contextWithCmd(cmd)
+			if err := enforceIdentity(ctx, "destroy-all"); err != nil {
+				return err
+			}
 			g, _, err := loadGraphData()
 			if err != nil {
 				return err
 			}
+			if g, err = filter.apply(g); err != nil {
+				return err
+			}
 
 			res, err := resolveTerraform(ctx, cmd, graphStackPaths(g))
 			if err != nil {
@@ -70,14 +79,22 @@ func newDestroyAllCommand() *cobra.Command {
 				resolvedVersion = res.Version.String()
 			}
 
+			if err := enforceFreeze(ctx, "destroy-all"); err != nil {
+				return err
+			}
+
 			opts := executorOptions(res.BinaryPath, resolvedVersion)
 			summary, err := executor.DestroyAll(ctx, g, opts)
 			if err != nil {
-				return err
+				return failRun("destroy-all", summary, err)
 			}
 			printSummary("destroy-all", summary)
 			return nil
 		},
 	}
+	cmd.Flags().StringVar(&breakFreeze, "break-freeze", "", "reason for overriding an active change freeze")
+	cmd.Flags().BoolVar(&forceDestroySkip, "force-destroy-skipped", false, "also destroy stacks marked skip_when_destroying")
+	filter.register(cmd)
+	registerKeepGoingFlag(cmd)
 	return cmd
 }
@@ -0,0 +1,40 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"terraform-wrapper/internal/dockerexec"
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/versioning"
+)
+
+// useDockerTerraform swaps the resolved binary for a shim that runs the
+// matching Terraform image, keeping version resolution as the source of truth.
+func useDockerTerraform(cmd *cobra.Command, res *versioning.ResolveResult) error {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return fmt.Errorf("--exec-docker requires docker on PATH: %w", err)
+	}
+	image := versioning.DockerImage(execDocker, res.Version)
+	mounts := []string{os.TempDir()}
+	if config := os.Getenv("TF_CLI_CONFIG_FILE"); config != "" {
+		// TF_CLI_CONFIG_FILE is forwarded, so the file must be reachable
+		// at the same path inside the container.
+		mounts = append(mounts, filepath.Dir(config))
+	}
+	shim, err := dockerexec.WriteShim(dockerexec.Options{
+		Image:   image,
+		RootDir: rootDir,
+		Mounts:  mounts,
+	})
+	if err != nil {
+		return err
+	}
+	output.Printf("[docker] running terraform in %s\n", image)
+	res.BinaryPath = shim
+	return nil
+}
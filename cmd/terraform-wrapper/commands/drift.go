@@ -0,0 +1,121 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"terraform-wrapper/internal/drift"
+	"terraform-wrapper/internal/graph"
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/stacks"
+)
+
+func newDriftCommand() *cobra.Command {
+	var stackArg string
+	cmd := &cobra.Command{
+		Use:   "drift",
+		Short: "Detect drift between a single stack's state and real infrastructure",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			g, index, err := loadGraphData()
+			if err != nil {
+				return err
+			}
+			stack, _, err := resolveStackArg(g, index, stackArg)
+			if err != nil {
+				return err
+			}
+			return runDrift(contextWithCmd(cmd), cmd, []*graph.Stack{stack})
+		},
+	}
+	cmd.Flags().StringVar(&stackArg, "stack", "", "stack name or path")
+	_ = cmd.MarkFlagRequired("stack")
+	return cmd
+}
+
+func newDriftAllCommand() *cobra.Command {
+	var filter stackFilter
+	cmd := &cobra.Command{
+		Use:   "drift-all",
+		Short: "Detect drift across all stacks and write a drift report",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			g, _, err := loadGraphData()
+			if err != nil {
+				return err
+			}
+			if g, err = filter.apply(g); err != nil {
+				return err
+			}
+			return runDrift(contextWithCmd(cmd), cmd, graphStacks(g))
+		},
+	}
+	filter.register(cmd)
+	return cmd
+}
+
+// runDrift runs refresh-only plans for targets, prints and stores the drift
+// report, and fails when any stack drifted or could not be checked.
+func runDrift(ctx context.Context, cmd *cobra.Command, targets []*graph.Stack) error {
+	paths := make([]string, 0, len(targets))
+	for _, stack := range targets {
+		paths = append(paths, stack.Path)
+	}
+	res, err := resolveTerraform(ctx, cmd, paths)
+	if err != nil {
+		return err
+	}
+
+	runner, err := stacks.NewRunner(ctx, stacks.RunnerOptions{
+		RootDir:       rootDir,
+		Environment:   environment,
+		AccountID:     accountID,
+		Region:        region,
+		TerraformPath: res.BinaryPath,
+		Profile:       profile,
+		Workspace:     workspace,
+		StateKMSKeyID: stateKMSKeyID,
+		StateBackend:  stateBackend,
+		AssumeRoleARN: assumeRoleARN,
+		Retry:         retryPolicy,
+		TFLog:         tfLog,
+		TFLogDir:      runLogDir,
+		ExtraVarFiles: extraVarFiles,
+	})
+	if err != nil {
+		return err
+	}
+
+	report, err := drift.Detect(ctx, targets, drift.Options{
+		RootDir:     rootDir,
+		Environment: environment,
+		Parallelism: parallelism,
+		Planner:     runner,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	if err := drift.PrintTable(os.Stdout, report); err != nil {
+		return err
+	}
+	path, err := drift.Write(superplanDir, report)
+	if err != nil {
+		return err
+	}
+	output.Printf("[drift] report written to %s\n", path)
+
+	drifted := report.Drifted()
+	failed := report.Failed()
+	if len(failed) > 0 {
+		return fmt.Errorf("drift check failed for %d stacks", len(failed))
+	}
+	if len(drifted) > 0 {
+		return fmt.Errorf("drift detected in %d stacks: %s", len(drifted), strings.Join(drifted, ", "))
+	}
+	output.Printf("[drift] %d stacks in sync\n", len(report.Stacks))
+	return nil
+}
@@ -0,0 +1,135 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"terraform-wrapper/internal/contract"
+	"terraform-wrapper/internal/envdiff"
+	"terraform-wrapper/internal/graph"
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/stacks"
+)
+
+func newEnvCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "env",
+		Short: "Compare the configuration of environments",
+		// Comparing environments reads only the repository, so none of them
+		// needs to be selected and no AWS access is needed.
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return stacks.ValidateProfile(profile)
+		},
+	}
+	cmd.AddCommand(newEnvDiffCommand())
+	return cmd
+}
+
+// stackVariableDiff is the difference in variable values of one stack.
+type stackVariableDiff struct {
+	Stack   string           `json:"stack"`
+	Changes []envdiff.Change `json:"changes"`
+}
+
+func newEnvDiffCommand() *cobra.Command {
+	var (
+		stackArg string
+		format   string
+		filter   stackFilter
+	)
+	cmd := &cobra.Command{
+		Use:   "diff <from-env> <to-env>",
+		Short: "Show how the tfvars of two environments differ for each stack",
+		Long: `Resolve every tfvars layer of both environments for each stack -- globals,
+the environment file, its profile variant, propagated outputs and the stack's
+own files -- and list the variables the stack declares that are added, removed
+or changed in the second environment, with the file that sets each value.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return fmt.Errorf("unknown --format %q: use table or json", format)
+			}
+			from, to := args[0], args[1]
+			rootAbs, err := filepath.Abs(rootDir)
+			if err != nil {
+				return err
+			}
+			g, err := graph.Build(rootAbs)
+			if err != nil {
+				return err
+			}
+			var paths []string
+			if stackArg != "" {
+				index := make(map[string]*graph.Stack, len(g))
+				for path, stack := range g {
+					rel, err := filepathRelSafe(rootDir, path)
+					if err != nil {
+						return err
+					}
+					index[rel] = stack
+				}
+				stack, _, err := resolveStackArg(g, index, stackArg)
+				if err != nil {
+					return err
+				}
+				paths = []string{stack.Path}
+			} else {
+				if paths, err = filter.paths(g); err != nil {
+					return err
+				}
+				if paths == nil {
+					paths = graphStackPaths(g)
+				}
+			}
+
+			contracts, err := contract.Build(rootAbs, g.Select(paths))
+			if err != nil {
+				return err
+			}
+			diffs := make([]stackVariableDiff, 0, len(contracts))
+			for _, c := range contracts {
+				stackDir := filepath.Join(rootAbs, filepath.FromSlash(c.Stack))
+				before, err := envdiff.Resolve(rootAbs, stacks.VarFiles(rootAbs, stackDir, from, profile))
+				if err != nil {
+					return fmt.Errorf("%s: %w", c.Stack, err)
+				}
+				after, err := envdiff.Resolve(rootAbs, stacks.VarFiles(rootAbs, stackDir, to, profile))
+				if err != nil {
+					return fmt.Errorf("%s: %w", c.Stack, err)
+				}
+				if changes := envdiff.Declared(envdiff.Diff(before, after), c.Variables); len(changes) > 0 {
+					diffs = append(diffs, stackVariableDiff{Stack: c.Stack, Changes: changes})
+				}
+			}
+
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(diffs)
+			}
+			for _, diff := range diffs {
+				fmt.Println(diff.Stack)
+				for _, change := range diff.Changes {
+					switch change.Kind {
+					case envdiff.Added:
+						fmt.Printf("  + %s = %s (%s)\n", change.Variable, change.To.Value, change.To.Source)
+					case envdiff.Removed:
+						fmt.Printf("  - %s = %s (%s)\n", change.Variable, change.From.Value, change.From.Source)
+					default:
+						fmt.Printf("  ~ %s = %s (%s) -> %s (%s)\n", change.Variable, change.From.Value, change.From.Source, change.To.Value, change.To.Source)
+					}
+				}
+			}
+			output.Printf("[env] %d of %d stacks have different variables in %s than in %s\n", len(diffs), len(contracts), to, from)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&stackArg, "stack", "", "compare only this stack (name or path)")
+	cmd.Flags().StringVar(&format, "format", "table", "output format: table or json")
+	filter.register(cmd)
+	return cmd
+}
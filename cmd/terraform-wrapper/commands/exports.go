@@ -0,0 +1,66 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+
+	"terraform-wrapper/internal/executor"
+	"terraform-wrapper/internal/exports"
+	"terraform-wrapper/internal/graph"
+)
+
+// outputExporter builds the SSM/Secrets Manager publisher only when at least one
+// of the selected stacks declares output exports, so plain applies need no extra IAM.
+func outputExporter(ctx context.Context, stacks ...*graph.Stack) (*exports.Publisher, error) {
+	needed := false
+	for _, stack := range stacks {
+		if stack != nil && len(stack.Exports) > 0 {
+			needed = true
+			break
+		}
+	}
+	if !needed {
+		return nil, nil
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("load AWS config: %w", err)
+	}
+	return &exports.Publisher{
+		Environment: environment,
+		SSM:         ssm.NewFromConfig(cfg),
+		Secrets:     secretsmanager.NewFromConfig(cfg),
+	}, nil
+}
+
+// attachExporter wires the publisher into the executor options. A typed nil
+// publisher must not be stored in the interface field.
+func attachExporter(ctx context.Context, opts *executor.Options, stacks ...*graph.Stack) error {
+	publisher, err := outputExporter(ctx, stacks...)
+	if err != nil {
+		return err
+	}
+	if publisher != nil {
+		opts.Exporter = publisher
+	}
+	return nil
+}
+
+// attachPropagator writes the outputs of applied stacks into the generated
+// tfvars of the stacks in g that declare propagate_outputs.
+func attachPropagator(opts *executor.Options, g graph.Graph) {
+	opts.Propagator = &exports.Propagator{RootDir: rootDir, Environment: environment, Graph: g}
+}
+
+func graphStacks(g graph.Graph) []*graph.Stack {
+	out := make([]*graph.Stack, 0, len(g))
+	for _, stack := range g {
+		out = append(out, stack)
+	}
+	return out
+}
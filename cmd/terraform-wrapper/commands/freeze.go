@@ -0,0 +1,126 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/spf13/cobra"
+
+	"terraform-wrapper/internal/audit"
+	"terraform-wrapper/internal/lock"
+	"terraform-wrapper/internal/output"
+)
+
+var breakFreeze string
+
+func newFreezeCommand() *cobra.Command {
+	var (
+		until  string
+		reason string
+		lift   bool
+	)
+	cmd := &cobra.Command{
+		Use:   "freeze",
+		Short: "Block apply-all and destroy-all for an environment until a given time",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := contextWithCmd(cmd)
+			client, err := stateBucketClient(ctx)
+			if err != nil {
+				return err
+			}
+			bucket := stateBucketFor(accountID)
+			trail := auditTrail(client)
+
+			if lift {
+				if err := lock.ClearFreeze(ctx, client, bucket, environment); err != nil {
+					return err
+				}
+				output.Printf("[freeze] lifted freeze for %s\n", environment)
+				return trail.Record(ctx, audit.Entry{Action: "unfreeze", Reason: reason})
+			}
+
+			if until == "" {
+				return fmt.Errorf("--until is required unless --lift is set")
+			}
+			untilTime, err := parseFreezeUntil(until)
+			if err != nil {
+				return err
+			}
+			if !untilTime.After(time.Now()) {
+				return fmt.Errorf("--until %s is in the past", until)
+			}
+
+			f := lock.Freeze{Env: environment, Until: untilTime, Reason: reason, Owner: audit.Actor()}
+			if err := lock.SetFreeze(ctx, client, bucket, f); err != nil {
+				return err
+			}
+			output.Printf("[freeze] %s frozen until %s\n", environment, untilTime.Format(time.RFC3339))
+			return trail.Record(ctx, audit.Entry{
+				Action:  "freeze",
+				Reason:  reason,
+				Details: map[string]string{"until": untilTime.Format(time.RFC3339)},
+			})
+		},
+	}
+	cmd.Flags().StringVar(&until, "until", "", "freeze end as YYYY-MM-DD (UTC midnight) or RFC3339 timestamp")
+	cmd.Flags().StringVar(&reason, "reason", "", "why the environment is frozen")
+	cmd.Flags().BoolVar(&lift, "lift", false, "remove an existing freeze")
+	return cmd
+}
+
+func parseFreezeUntil(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --until %q: expected YYYY-MM-DD or RFC3339", value)
+	}
+	return t.UTC(), nil
+}
+
+// enforceFreeze refuses mutating -all operations against a frozen environment
+// unless --break-freeze supplies a reason, which is recorded in the audit trail.
+func enforceFreeze(ctx context.Context, operation string) error {
+	client, err := stateBucketClient(ctx)
+	if err != nil {
+		return err
+	}
+	bucket := stateBucketFor(accountID)
+	f, err := lock.CheckFreeze(ctx, client, bucket, environment, time.Now())
+	if f == nil || breakFreeze == "" {
+		return err
+	}
+
+	output.Printf("[freeze] breaking freeze on %s (until %s): %s\n", environment, f.Until.Format(time.RFC3339), breakFreeze)
+	return auditTrail(client).Record(ctx, audit.Entry{
+		Action: "break-freeze",
+		Reason: breakFreeze,
+		Details: map[string]string{
+			"operation":    operation,
+			"frozen_until": f.Until.Format(time.RFC3339),
+			"frozen_by":    f.Owner,
+		},
+	})
+}
+
+func stateBucketClient(ctx context.Context) (*s3.Client, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("load AWS config: %w", err)
+	}
+	return s3.NewFromConfig(cfg), nil
+}
+
+func auditTrail(client audit.S3API) *audit.Trail {
+	return &audit.Trail{
+		Root:        rootDir,
+		Environment: environment,
+		Client:      client,
+		Bucket:      stateBucketFor(accountID),
+		CallerARN:   operatorARN(context.Background()),
+	}
+}
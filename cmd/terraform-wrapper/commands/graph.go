@@ -0,0 +1,26 @@
+package commands
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"terraform-wrapper/internal/graph"
+)
+
+func newGraphCommand() *cobra.Command {
+	var format string
+	cmd := &cobra.Command{
+		Use:   "graph",
+		Short: "Print the stack dependency graph as Graphviz DOT, Mermaid or JSON",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			g, _, err := loadGraphData()
+			if err != nil {
+				return err
+			}
+			return graph.Render(os.Stdout, g, rootDir, format)
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", graph.FormatDOT, "output format: dot, mermaid or json")
+	return cmd
+}
@@ -0,0 +1,74 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"terraform-wrapper/internal/audit"
+	"terraform-wrapper/internal/awsaccount"
+	"terraform-wrapper/internal/wrapperconfig"
+)
+
+var (
+	callerOnce sync.Once
+	caller     awsaccount.Caller
+	callerErr  error
+	callerWarn sync.Once
+)
+
+// rememberCaller keeps the caller identity looked up to discover the account,
+// so it is not asked for again.
+func rememberCaller(c awsaccount.Caller) {
+	callerOnce.Do(func() { caller = c })
+}
+
+// callerARN returns the ARN of the AWS credentials the wrapper runs with,
+// looked up once. Runs built from local state have none.
+func callerARN(ctx context.Context) (string, error) {
+	if offlineMode {
+		return "", nil
+	}
+	callerOnce.Do(func() { caller, callerErr = awsaccount.CallerIdentity(ctx, region) })
+	return caller.ARN, callerErr
+}
+
+// operatorARN is callerARN for recording who ran a command: when the lookup
+// fails the identity is left out, with one warning, rather than failing the
+// run.
+func operatorARN(ctx context.Context) string {
+	arn, err := callerARN(ctx)
+	if err != nil {
+		callerWarn.Do(func() { fmt.Fprintf(os.Stderr, "[identity] warning: %v\n", err) })
+	}
+	return arn
+}
+
+// enforceIdentity refuses operation when the environment restricts applies to
+// apply_identities and the caller is not one of them. It runs before any
+// terraform command, and the refusal is recorded in the audit trail.
+func enforceIdentity(ctx context.Context, operation string) error {
+	if len(applyIdentities) == 0 {
+		return nil
+	}
+	arn, err := callerARN(ctx)
+	if err != nil {
+		return fmt.Errorf("%s in %s is restricted to apply_identities in %s, but the caller identity is unknown: %w", operation, environment, wrapperconfig.FileName, err)
+	}
+	if awsaccount.MatchARN(arn, applyIdentities) {
+		return nil
+	}
+	if client, err := stateBucketClient(ctx); err == nil {
+		if err := auditTrail(client).Record(ctx, audit.Entry{
+			Action:  "identity-rejected",
+			Details: map[string]string{"operation": operation},
+		}); err != nil {
+			fmt.Fprintf(os.Stderr, "[identity] warning: %v\n", err)
+		}
+	}
+	if arn == "" {
+		arn = "a caller without an AWS identity"
+	}
+	return fmt.Errorf("%s may not run %s in %s: it is not in apply_identities in %s", arn, operation, environment, wrapperconfig.FileName)
+}
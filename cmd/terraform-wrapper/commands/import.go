@@ -0,0 +1,170 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"terraform-wrapper/internal/audit"
+	"terraform-wrapper/internal/imports"
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/stacks"
+	"terraform-wrapper/internal/statequery"
+)
+
+func newImportCommand() *cobra.Command {
+	var (
+		stackArg string
+		address  string
+		id       string
+		manifest string
+		dryRun   bool
+	)
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Adopt existing resources into a stack's state with terraform import",
+		Long: `Import an existing object into a stack's state, with the stack's backend,
+var files and Terraform version, either one resource at a time with
+--stack, --address and --id, or in bulk from a --manifest. A manifest is a CSV
+file with an address, id and optional stack column, or a JSON array of
+{"stack", "address", "id"} objects; --stack names the stack of rows without
+one. Addresses already in a stack's state are skipped, so a failed batch can be
+run again to import the rest.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := contextWithCmd(cmd)
+			var list []imports.Import
+			switch {
+			case manifest != "":
+				if address != "" || id != "" {
+					return fmt.Errorf("--address and --id cannot be used with --manifest")
+				}
+				var err error
+				if list, err = imports.Load(manifest); err != nil {
+					return err
+				}
+			case stackArg == "" || address == "" || id == "":
+				return fmt.Errorf("pass --stack, --address and --id, or --manifest")
+			default:
+				list = []imports.Import{{Address: address, ID: id}}
+			}
+			names, byStack, err := imports.Group(list, stackArg)
+			if err != nil {
+				return err
+			}
+
+			g, index, err := loadGraphData()
+			if err != nil {
+				return err
+			}
+			paths := make([]string, len(names))
+			rels := make([]string, len(names))
+			for i, name := range names {
+				stack, rel, err := resolveStackArg(g, index, name)
+				if err != nil {
+					return err
+				}
+				paths[i], rels[i] = stack.Path, rel
+			}
+
+			if !dryRun {
+				if err := enforceFreeze(ctx, "import"); err != nil {
+					return err
+				}
+			}
+			res, err := resolveTerraform(ctx, cmd, paths)
+			if err != nil {
+				return err
+			}
+			runner, err := stacks.NewRunner(ctx, stacks.RunnerOptions{
+				RootDir:       rootDir,
+				Environment:   environment,
+				AccountID:     accountID,
+				Region:        region,
+				TerraformPath: res.BinaryPath,
+				Profile:       profile,
+				Workspace:     workspace,
+				StateKMSKeyID: stateKMSKeyID,
+				StateBackend:  stateBackend,
+				AssumeRoleARN: assumeRoleARN,
+				Retry:         retryPolicy,
+				TFLog:         tfLog,
+				TFLogDir:      runLogDir,
+				ExtraVarFiles: extraVarFiles,
+			})
+			if err != nil {
+				return err
+			}
+
+			imported, skipped := 0, 0
+			for i, name := range names {
+				rel := rels[i]
+				state, err := runner.PullState(ctx, paths[i])
+				if err != nil {
+					return fmt.Errorf("read state of %s: %w", rel, err)
+				}
+				instances, err := statequery.Parse(rel, state)
+				if err != nil {
+					return fmt.Errorf("%s: %w", rel, err)
+				}
+				existing := make(map[string]bool, len(instances))
+				for _, inst := range instances {
+					existing[inst.Address] = true
+				}
+
+				var done []string
+				for _, imp := range byStack[name] {
+					if existing[imp.Address] {
+						skipped++
+						output.Printf("[import] %s: %s is already in state, skipping\n", rel, imp.Address)
+						continue
+					}
+					if dryRun {
+						output.Printf("[import] %s: would import %s\n", rel, imp)
+						continue
+					}
+					output.Printf("[import] %s: importing %s\n", rel, imp)
+					if err := runner.Import(ctx, paths[i], imp.Address, imp.ID); err != nil {
+						return fmt.Errorf("%s: import %s: %w (%d imported so far; run again to resume)", rel, imp.Address, err, imported)
+					}
+					imported++
+					done = append(done, imp.Address)
+				}
+				if len(done) == 0 {
+					continue
+				}
+				client, err := stateBucketClient(ctx)
+				if err != nil {
+					return err
+				}
+				if err := auditTrail(client).Record(ctx, audit.Entry{
+					Action: "import",
+					Details: map[string]string{
+						"stack":     rel,
+						"manifest":  manifest,
+						"addresses": strings.Join(done, ","),
+					},
+				}); err != nil {
+					return err
+				}
+			}
+
+			if dryRun {
+				output.Printf("[import] %d to import, %d already in state\n", len(list)-skipped, skipped)
+				return nil
+			}
+			output.Printf("[import] imported %d resources, %d already in state\n", imported, skipped)
+			if imported > 0 {
+				output.Printf("[import] run plan on the imported stacks to check their configuration matches the adopted resources\n")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&stackArg, "stack", "", "stack name or path; with --manifest, the stack of rows that name none")
+	cmd.Flags().StringVar(&address, "address", "", "resource address to import into, e.g. aws_s3_bucket.logs")
+	cmd.Flags().StringVar(&id, "id", "", "provider-specific id of the existing object")
+	cmd.Flags().StringVar(&manifest, "manifest", "", "CSV or JSON file listing the resources to import")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "list what would be imported without importing it")
+	cmd.Flags().StringVar(&breakFreeze, "break-freeze", "", "reason for overriding an active change freeze")
+	return cmd
+}
@@ -1,15 +1,66 @@
 package commands
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/spf13/cobra"
 
+	"terraform-wrapper/internal/audit"
 	"terraform-wrapper/internal/executor"
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/stacks"
 )
 
+// backendChangeFlags select how init treats a backend whose configuration
+// changed, such as after renaming the state bucket or changing the key
+// convention.
+type backendChangeFlags struct {
+	migrateState bool
+	reconfigure  bool
+}
+
+func (f *backendChangeFlags) register(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&f.migrateState, "migrate-state", false, "copy each stack's existing state to its changed backend (terraform init -force-copy)")
+	cmd.Flags().BoolVar(&f.reconfigure, "reconfigure", false, "use each stack's changed backend as it is, without migrating the state the previous backend held")
+	cmd.MarkFlagsMutuallyExclusive("migrate-state", "reconfigure")
+}
+
+func (f backendChangeFlags) change() stacks.BackendChange {
+	switch {
+	case f.migrateState:
+		return stacks.BackendMigrateState
+	case f.reconfigure:
+		return stacks.BackendReconfigure
+	}
+	return stacks.BackendUnchanged
+}
+
+// record adds the backend change of the stacks initialised to the audit
+// trail. Plain inits are not recorded.
+func (f backendChangeFlags) record(ctx context.Context, initialised []string) error {
+	change := f.change()
+	if change == stacks.BackendUnchanged || len(initialised) == 0 {
+		return nil
+	}
+	output.Printf("[init] %s: %d stacks\n", change, len(initialised))
+	client, err := stateBucketClient(ctx)
+	if err != nil {
+		return err
+	}
+	return auditTrail(client).Record(ctx, audit.Entry{
+		Action: "init-" + string(change),
+		Details: map[string]string{
+			"stacks": fmt.Sprint(len(initialised)),
+		},
+	})
+}
+
 func newInitCommand() *cobra.Command {
-	var stackArg string
+	var (
+		stackArg string
+		backend  backendChangeFlags
+	)
 	cmd := &cobra.Command{
 		Use:   "init",
 		Short: "Run terraform init for a specific stack",
@@ -35,21 +86,27 @@ func newInitCommand() *cobra.Command {
 			}
 
 			opts := executorOptions(res.BinaryPath, resolvedVersion)
+			opts.BackendChange = backend.change()
 			summary, err := executor.InitStack(ctx, stack, opts)
 			if err != nil {
-				return err
+				return failRun("init", summary, err)
 			}
 			printSummary("init", summary)
-			fmt.Printf("stack initialised: %s\n", rel)
-			return nil
+			output.Printf("stack initialised: %s\n", rel)
+			return backend.record(ctx, summary.Completed)
 		},
 	}
 	cmd.Flags().StringVar(&stackArg, "stack", "", "stack name or path")
+	backend.register(cmd)
 	_ = cmd.MarkFlagRequired("stack")
 	return cmd
 }
 
 func newInitAllCommand() *cobra.Command {
+	var (
+		filter  stackFilter
+		backend backendChangeFlags
+	)
 	cmd := &cobra.Command{
 		Use:   "init-all",
 		Short: "Initialise all stacks",
@@ -59,6 +116,9 @@ func newInitAllCommand() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			if g, err = filter.apply(g); err != nil {
+				return err
+			}
 
 			res, err := resolveTerraform(ctx, cmd, graphStackPaths(g))
 			if err != nil {
@@ -71,13 +131,17 @@ func newInitAllCommand() *cobra.Command {
 			}
 
 			opts := executorOptions(res.BinaryPath, resolvedVersion)
+			opts.BackendChange = backend.change()
 			summary, err := executor.InitAll(ctx, g, opts)
 			if err != nil {
-				return err
+				return failRun("init-all", summary, err)
 			}
 			printSummary("init-all", summary)
-			return nil
+			return backend.record(ctx, summary.Completed)
 		},
 	}
+	filter.register(cmd)
+	backend.register(cmd)
+	registerKeepGoingFlag(cmd)
 	return cmd
 }
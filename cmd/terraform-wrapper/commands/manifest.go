@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"terraform-wrapper/internal/manifest"
+	"terraform-wrapper/internal/output"
+)
+
+// writeManifest records the versions deployed by a successful apply under
+// <out>/manifests/<env>/ and, when publish is set, in the state bucket.
+func writeManifest(ctx context.Context, completed []string, terraformVersion, gitSHA string, publish bool) error {
+	rootAbs, err := filepath.Abs(rootDir)
+	if err != nil {
+		return err
+	}
+	m := &manifest.Manifest{
+		GeneratedAt:      time.Now().UTC(),
+		Environment:      environment,
+		AccountID:        accountID,
+		Region:           region,
+		TerraformVersion: terraformVersion,
+		GitSHA:           gitSHA,
+		Stacks:           make([]manifest.Stack, 0, len(completed)),
+	}
+	for _, rel := range completed {
+		stack, err := manifest.ForStack(filepath.Join(rootAbs, rel), filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		m.Stacks = append(m.Stacks, stack)
+	}
+
+	path, err := manifest.Write(superplanDir, m)
+	if err != nil {
+		return err
+	}
+	output.Printf("[manifest] deployed versions written to %s\n", path)
+
+	if !publish {
+		return nil
+	}
+	client, err := stateBucketClient(ctx)
+	if err != nil {
+		return err
+	}
+	bucket := stateBucketFor(accountID)
+	if err := manifest.Publish(ctx, client, bucket, m); err != nil {
+		return err
+	}
+	output.Printf("[manifest] published to s3://%s/manifests/%s/\n", bucket, environment)
+	return nil
+}
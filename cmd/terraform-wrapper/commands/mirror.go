@@ -0,0 +1,41 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"terraform-wrapper/internal/versioning"
+)
+
+// configureMirrors validates --releases-mirror and points terraform at the
+// CLI configuration given with --cli-config, whose provider_installation
+// block can direct providers to a network or filesystem mirror. Without
+// --cli-config, a TF_CLI_CONFIG_FILE already in the environment is passed
+// through unchanged.
+func configureMirrors() error {
+	mirror, err := versioning.NormalizeMirror(releasesMirror)
+	if err != nil {
+		return fmt.Errorf("--releases-mirror: %w", err)
+	}
+	releasesMirror = mirror
+	if cliConfig == "" {
+		return nil
+	}
+	path := cliConfig
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(rootDir, path)
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("--cli-config: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("--cli-config: %w", err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("--cli-config: %s is a directory", path)
+	}
+	return os.Setenv("TF_CLI_CONFIG_FILE", path)
+}
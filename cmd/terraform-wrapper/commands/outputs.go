@@ -0,0 +1,122 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"terraform-wrapper/internal/stacks"
+	"terraform-wrapper/internal/statequery"
+	"terraform-wrapper/internal/superplan"
+)
+
+func newOutputsCommand() *cobra.Command {
+	var (
+		stackArg      string
+		format        string
+		prefixed      bool
+		showSensitive bool
+		filter        stackFilter
+	)
+	cmd := &cobra.Command{
+		Use:   "outputs",
+		Short: "Print the outputs of every stack's remote state as one JSON or YAML document",
+		Long: `Pull the remote state of every stack and print their outputs as one
+document keyed by stack, so tooling can read an environment's outputs without
+knowing where its state is kept. With --prefixed the outputs are merged into
+one map under the names the superplan gives them, <stack>_<output>. Sensitive
+values are printed as "(sensitive)" unless --show-sensitive is passed.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "json" && format != "yaml" {
+				return fmt.Errorf("unknown --format %q: use json or yaml", format)
+			}
+			ctx := contextWithCmd(cmd)
+			g, index, err := loadGraphData()
+			if err != nil {
+				return err
+			}
+			var paths []string
+			if stackArg != "" {
+				stack, _, err := resolveStackArg(g, index, stackArg)
+				if err != nil {
+					return err
+				}
+				paths = []string{stack.Path}
+			} else {
+				if paths, err = filter.paths(g); err != nil {
+					return err
+				}
+				if paths == nil {
+					paths = graphStackPaths(g)
+				}
+			}
+			sort.Strings(paths)
+
+			states, err := pullRemoteStates(ctx, cmd, paths)
+			if err != nil {
+				return err
+			}
+			doc := make(map[string]any, len(paths))
+			owners := make(map[string]string)
+			for i, state := range states {
+				rel := relStack(paths[i])
+				outputs, err := stacks.StateOutputs([]byte(state))
+				if err != nil {
+					return fmt.Errorf("%s: %w", rel, err)
+				}
+				values := make(map[string]any, len(outputs))
+				for name, output := range outputs {
+					var value any = output.Value
+					if output.Sensitive && !showSensitive {
+						value = statequery.Redacted
+					}
+					if !prefixed {
+						values[name] = value
+						continue
+					}
+					key := superplan.OutputName(paths[i], name)
+					if owner, ok := owners[key]; ok {
+						return fmt.Errorf("outputs of %s and %s are both named %s with --prefixed; pass --stack or --only to select one", owner, rel, key)
+					}
+					owners[key] = rel
+					doc[key] = value
+				}
+				if !prefixed {
+					doc[rel] = values
+				}
+			}
+
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(doc)
+			}
+			// Round-trip through JSON so the raw output values become YAML
+			// maps, lists and scalars rather than byte strings.
+			data, err := json.Marshal(doc)
+			if err != nil {
+				return err
+			}
+			var generic any
+			if err := json.Unmarshal(data, &generic); err != nil {
+				return err
+			}
+			enc := yaml.NewEncoder(os.Stdout)
+			enc.SetIndent(2)
+			if err := enc.Encode(generic); err != nil {
+				return err
+			}
+			return enc.Close()
+		},
+	}
+	cmd.Flags().StringVar(&stackArg, "stack", "", "print only this stack's outputs (name or path)")
+	cmd.Flags().StringVar(&format, "format", "json", "document format: json or yaml")
+	cmd.Flags().BoolVar(&prefixed, "prefixed", false, "merge all outputs into one map, named <stack>_<output> as in the superplan")
+	cmd.Flags().BoolVar(&showSensitive, "show-sensitive", false, "print the values of sensitive outputs")
+	filter.register(cmd)
+	return cmd
+}
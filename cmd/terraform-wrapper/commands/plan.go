@@ -1,16 +1,51 @@
 package commands
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
 
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/spf13/cobra"
 
+	"terraform-wrapper/internal/cost"
 	"terraform-wrapper/internal/executor"
+	"terraform-wrapper/internal/graph"
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/preflight"
+	"terraform-wrapper/internal/remote"
+	"terraform-wrapper/internal/runs"
+	"terraform-wrapper/internal/stacks"
 	"terraform-wrapper/internal/superplan"
 )
 
+var (
+	requireReadOnly  bool
+	suggestIAMPolicy bool
+	verifyStable     bool
+	securityFocus    bool
+	syncDeps         bool
+	detailedExitCode bool
+	planDestroy      bool
+	onlyFailed       bool
+	stateConflicts   string
+	maxDestroys      int
+	forbidDestroys   []string
+	estimateCost     bool
+	infracostPath    string
+	skipContracts    bool
+	localStateDir    string
+)
+
 func newPlanCommand() *cobra.Command {
-	var stackArg string
+	var (
+		stackArg string
+		closure  closureFlags
+	)
 	cmd := &cobra.Command{
 		Use:   "plan",
 		Short: "Run terraform plan for a single stack",
@@ -24,6 +59,34 @@ func newPlanCommand() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			if err := verifyReadOnly(ctx); err != nil {
+				return err
+			}
+
+			if closure.enabled() {
+				sub, err := closure.targetGraph(g, stack)
+				if err != nil {
+					return err
+				}
+				res, err := resolveTerraform(ctx, cmd, graphStackPaths(sub))
+				if err != nil {
+					return err
+				}
+				resolvedVersion := ""
+				if res.Version != nil {
+					resolvedVersion = res.Version.String()
+				}
+				planAll := executor.PlanAll
+				if planDestroy {
+					planAll = executor.PlanDestroyAll
+				}
+				summary, err := planAll(ctx, sub, executorOptions(res.BinaryPath, resolvedVersion))
+				if err != nil {
+					return failRun("plan", summary, err)
+				}
+				printSummary("plan", summary)
+				return planExitStatus(cmd, summary)
+			}
 
 			res, err := resolveTerraform(ctx, cmd, []string{stack.Path})
 			if err != nil {
@@ -36,31 +99,68 @@ func newPlanCommand() *cobra.Command {
 			}
 
 			opts := executorOptions(res.BinaryPath, resolvedVersion)
-			summary, err := executor.PlanStack(ctx, stack, opts)
+			planStack := executor.PlanStack
+			if planDestroy {
+				planStack = executor.PlanDestroyStack
+			}
+			summary, err := planStack(ctx, stack, opts)
 			if err != nil {
-				return err
+				return failRun("plan", summary, err)
 			}
 
 			printSummary("plan", summary)
-			fmt.Printf("stack planned: %s\n", rel)
-			return nil
+			output.Printf("stack planned: %s\n", rel)
+			return planExitStatus(cmd, summary)
 		},
 	}
 	cmd.Flags().StringVar(&stackArg, "stack", "", "stack name or path")
+	closure.register(cmd)
+	cmd.Flags().BoolVar(&requireReadOnly, "require-read-only", false, "fail unless the current credentials are read-only")
+	cmd.Flags().BoolVar(&detailedExitCode, "detailed-exitcode", false, "exit 0 when there are no changes, 2 when changes are present and 1 on errors")
+	cmd.Flags().BoolVar(&planDestroy, "destroy", false, "plan the destruction of the stack's resources")
 	_ = cmd.MarkFlagRequired("stack")
 	return cmd
 }
 
 func newPlanAllCommand() *cobra.Command {
+	var (
+		filter     stackFilter
+		partial    partialFlags
+		releaseSet releaseFlags
+	)
 	cmd := &cobra.Command{
 		Use:   "plan-all",
 		Short: "Plan all stacks respecting dependencies",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := contextWithCmd(cmd)
-			g, _, err := loadGraphData()
+			if err := releaseSet.prepare(ctx); err != nil {
+				return err
+			}
+			full, index, err := loadGraphData()
 			if err != nil {
 				return err
 			}
+			g, err := filter.apply(full)
+			if err != nil {
+				return err
+			}
+			if g, err = partial.apply(ctx, g, index); err != nil {
+				return err
+			}
+			if g, err = releaseSet.apply(ctx, g, "plan-all"); err != nil {
+				return err
+			}
+			if partial.enabled() && len(g) == 0 {
+				return nil
+			}
+			if err := verifyReadOnly(ctx); err != nil {
+				return err
+			}
+			if !skipContracts && !planDestroy {
+				if err := checkContracts(full); err != nil {
+					return err
+				}
+			}
 
 			res, err := resolveTerraform(ctx, cmd, graphStackPaths(g))
 			if err != nil {
@@ -72,17 +172,279 @@ func newPlanAllCommand() *cobra.Command {
 				resolvedVersion = res.Version.String()
 			}
 
-			return superplan.Run(ctx, superplan.Options{
+			if planDestroy {
+				summary, err := executor.PlanDestroyAll(ctx, g, executorOptions(res.BinaryPath, resolvedVersion))
+				if err != nil {
+					return failRun("plan-all", summary, err)
+				}
+				printSummary("plan-all", summary)
+				return planExitStatus(cmd, summary)
+			}
+
+			if onlyFailed {
+				return planFailedStacks(ctx, cmd, g, executorOptions(res.BinaryPath, resolvedVersion))
+			}
+
+			selected := filter.selected(g)
+			if partial.enabled() || releaseSet.enabled() {
+				selected = graphStackPaths(g)
+			}
+			run, _, err := beginRun(ctx, "plan-all", "")
+			if err != nil {
+				return err
+			}
+			planErr := superplan.Run(ctx, superplan.Options{
 				RootDir:           rootDir,
 				OutputDir:         superplanDir,
 				TerraformPath:     res.BinaryPath,
 				TerraformVersion:  resolvedVersion,
 				Environment:       environment,
+				Profile:           profile,
+				Workspace:         workspace,
+				StateKMSKeyID:     stateKMSKeyID,
 				AccountID:         accountID,
 				Region:            region,
 				KeepPlanArtifacts: keepPlanArtifacts,
+				SuggestIAMPolicy:  suggestIAMPolicy,
+				VerifyStable:      verifyStable,
+				SecurityFocus:     securityFocus,
+				DetailedExitCode:  detailedExitCode,
+				Parallelism:       parallelism,
+				StateBackend:      stateBackend,
+				AssumeRoleARN:     assumeRoleARN,
+				TFLog:             tfLog,
+				TFLogDir:          runLogDir,
+				ExtraVarFiles:     extraVarFiles,
+				SyncDependencies:  syncDeps,
+				StateConflicts:    stateConflicts,
+				LocalStateDir:     localStateDir,
+				TagAttributes:     tagAttributes,
+				Actor:             run.Actor,
+				CallerARN:         run.CallerARN,
+				Stacks:            selected,
+				CostEstimator:     costEstimator(),
+				Guardrails:        guardrails(),
+				Workdir:           runWorkdir,
 			})
+			summary, recordErr := superplanOutcome(g, planErr)
+			if err := finishRun(run, summary, recordErr); err != nil {
+				output.Printf("[run] warning: %v\n", err)
+			}
+			return detailedExit(cmd, planErr)
 		},
 	}
+	cmd.Flags().BoolVar(&requireReadOnly, "require-read-only", false, "fail unless the current credentials are read-only")
+	cmd.Flags().BoolVar(&suggestIAMPolicy, "suggest-iam-policy", false, "write a least-privilege IAM policy covering the planned changes")
+	cmd.Flags().BoolVar(&securityFocus, "security-focus", false, "add a section listing changes to IAM, security group, KMS and resource policy resources")
+	cmd.Flags().StringVar(&stateConflicts, "state-conflicts", superplan.StateConflictWarn, "when stack states were written by different state format or Terraform versions: warn, fail or normalize")
+	registerGuardrailFlags(cmd)
+	cmd.Flags().BoolVar(&estimateCost, "estimate-cost", false, "price the planned changes with Infracost and report each stack's monthly cost delta")
+	cmd.Flags().StringVar(&infracostPath, "infracost-path", "infracost", "infracost executable used by --estimate-cost")
+	cmd.Flags().BoolVar(&syncDeps, "sync-deps", false, "update dependencies.json files to match the stacks' terraform_remote_state references")
+	cmd.Flags().BoolVar(&verifyStable, "verify-stable", false, "plan twice and fail if any stack produces a different plan")
+	cmd.Flags().BoolVar(&detailedExitCode, "detailed-exitcode", false, "exit 0 when there are no changes, 2 when changes are present and 1 on errors")
+	cmd.Flags().BoolVar(&planDestroy, "destroy", false, "plan the teardown of every stack in reverse dependency order, as destroy-all would run it, instead of the superplan")
+	cmd.Flags().BoolVar(&forceDestroySkip, "force-destroy-skipped", false, "with --destroy, also plan the teardown of stacks marked skip_when_destroying")
+	cmd.Flags().BoolVar(&skipContracts, "skip-contract-check", false, "plan even when a stack consumes an upstream output that is no longer produced")
+	cmd.Flags().BoolVar(&onlyFailed, "only-failed", false, "re-plan only the stacks that failed in the last plan-all run, and their dependents")
+	cmd.Flags().StringVar(&localStateDir, "from-local-state", "", "build the superplan from the state files state export wrote to this directory instead of pulling state, without AWS access")
+	cmd.MarkFlagsMutuallyExclusive("only-failed", "destroy")
+	cmd.MarkFlagsMutuallyExclusive("from-local-state", "destroy")
+	cmd.MarkFlagsMutuallyExclusive("from-local-state", "only-failed")
+	cmd.MarkFlagsMutuallyExclusive("from-local-state", "require-read-only")
+	filter.register(cmd)
+	partial.register(cmd)
+	releaseSet.register(cmd)
+	for _, name := range []string{"stacks", "since-stack", "changed-only", "manifest"} {
+		for _, other := range []string{"only", "exclude", "only-failed", "destroy"} {
+			cmd.MarkFlagsMutuallyExclusive(name, other)
+		}
+	}
+	for _, name := range []string{"stacks", "since-stack", "changed-only"} {
+		cmd.MarkFlagsMutuallyExclusive("manifest", name)
+	}
 	return cmd
 }
+
+// costEstimator returns the estimator --estimate-cost selects, or nil.
+func costEstimator() cost.Estimator {
+	if !estimateCost {
+		return nil
+	}
+	return &cost.Infracost{Binary: infracostPath}
+}
+
+func registerGuardrailFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&maxDestroys, "max-destroys", -1, "fail with exit code 3 when the plan destroys or replaces more resources than this; -1 for no limit")
+	cmd.Flags().StringSliceVar(&forbidDestroys, "forbid-destroy-types", nil, "comma separated resource types, such as aws_s3_bucket, whose destruction or replacement fails the plan with exit code 3")
+}
+
+// guardrails returns the guardrails set by --max-destroys and
+// --forbid-destroy-types.
+func guardrails() superplan.Guardrails {
+	g := superplan.Guardrails{ForbidDestroyTypes: forbidDestroys}
+	if maxDestroys >= 0 {
+		g.MaxDestroys = &maxDestroys
+	}
+	return g
+}
+
+// superplanOutcome translates a superplan result into a run summary and the
+// error the run record should carry. Failures the superplan attributes to a
+// stack are recorded against it; a plan with changes is not a failure.
+func superplanOutcome(g graph.Graph, err error) (*executor.Summary, error) {
+	summary := &executor.Summary{}
+	var changes *superplan.ChangesPresentError
+	var stackErr *superplan.StackError
+	switch {
+	case err == nil || errors.As(err, &changes):
+		for path := range g {
+			rel, relErr := filepathRelSafe(rootDir, path)
+			if relErr != nil {
+				rel = path
+			}
+			summary.Completed = append(summary.Completed, rel)
+		}
+		return summary, nil
+	case errors.As(err, &stackErr):
+		rel, relErr := filepathRelSafe(rootDir, stackErr.StackDir)
+		if relErr != nil {
+			rel = stackErr.StackDir
+		}
+		summary.Failed = map[string]error{rel: stackErr.Err}
+	}
+	return summary, err
+}
+
+// planFailedStacks re-plans, stack by stack, the stacks that failed in the
+// most recent plan-all run together with their dependents, and records the
+// outcome as a plan-all run so fixes can be iterated on.
+func planFailedStacks(ctx context.Context, cmd *cobra.Command, g graph.Graph, opts executor.Options) error {
+	previous, err := runs.Latest(rootDir, envScope(), "plan-all")
+	if err != nil {
+		return err
+	}
+	if previous == nil {
+		return fmt.Errorf("no plan-all run recorded for environment %s; run plan-all first", environment)
+	}
+	if previous.Status == runs.StatusSucceeded {
+		output.Printf("[run] last plan-all run %s succeeded; nothing to re-plan\n", previous.ID)
+		return nil
+	}
+	if len(previous.Failed) == 0 {
+		return fmt.Errorf("last plan-all run %s failed without attributing the failure to a stack; run plan-all without --only-failed", previous.ID)
+	}
+
+	rootAbs, err := filepath.Abs(rootDir)
+	if err != nil {
+		return err
+	}
+	var paths []string
+	for rel := range previous.Failed {
+		path := filepath.Join(rootAbs, rel)
+		if _, ok := g[path]; !ok {
+			fmt.Fprintf(os.Stderr, "[run] warning: %s failed in run %s but is no longer a stack\n", rel, previous.ID)
+			continue
+		}
+		paths = append(paths, path)
+		paths = append(paths, g.Downstream(path)...)
+	}
+	if len(paths) == 0 {
+		output.Println("[run] none of the failed stacks exist any more; nothing to re-plan")
+		return nil
+	}
+	sub := g.Subgraph(paths)
+	if err := printTargets(sub); err != nil {
+		return err
+	}
+
+	run, _, err := beginRun(ctx, "plan-all", "")
+	if err != nil {
+		return err
+	}
+	summary, err := executor.PlanAll(ctx, sub, opts)
+	if recErr := finishRun(run, summary, err); recErr != nil {
+		output.Printf("[run] warning: %v\n", recErr)
+	}
+	if err != nil {
+		return failRun("plan-all", summary, err)
+	}
+	printSummary("plan-all", summary)
+	return planExitStatus(cmd, summary)
+}
+
+// planExitStatus applies --detailed-exitcode to an executor plan summary.
+func planExitStatus(cmd *cobra.Command, summary *executor.Summary) error {
+	if !detailedExitCode || len(summary.Changed) == 0 {
+		return nil
+	}
+	changed := append([]string(nil), summary.Changed...)
+	sort.Strings(changed)
+	return detailedExit(cmd, &superplan.ChangesPresentError{Stacks: changed})
+}
+
+// detailedExit silences cobra's error and usage output when a plan succeeded
+// with changes; main still maps the error to its exit code.
+func detailedExit(cmd *cobra.Command, err error) error {
+	var changes *superplan.ChangesPresentError
+	var guardrail *superplan.GuardrailError
+	if errors.As(err, &changes) || errors.As(err, &guardrail) {
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+	}
+	return err
+}
+
+// stateBucketExempt names the top-level commands that resolve Terraform
+// without initialising a stack's backend: bootstrap creates the state bucket,
+// and providers only reads and locks provider requirements.
+var stateBucketExempt = map[string]bool{"bootstrap": true, "providers": true}
+
+// verifyStateBucket fails before any stack runs when the environment's state
+// bucket has not been bootstrapped, instead of every stack failing its init.
+// Only the conventional S3 bucket of local runs is checked, once per process.
+func verifyStateBucket(ctx context.Context, cmd *cobra.Command) error {
+	if stateBucketOK || offlineRun(cmd) {
+		return nil
+	}
+	if stateBackend != nil && stateBackend.Type != "" && stateBackend.Type != stacks.BackendS3 {
+		return nil
+	}
+	if execBackendName != "" && execBackendName != remote.BackendLocal {
+		return nil
+	}
+	top := cmd
+	for top.HasParent() && top.Parent().HasParent() {
+		top = top.Parent()
+	}
+	if stateBucketExempt[top.Name()] {
+		return nil
+	}
+	client, err := stateBucketClient(ctx)
+	if err != nil {
+		return err
+	}
+	if err := preflight.VerifyStateBucket(ctx, client, stateBucketFor(accountID), environment); err != nil {
+		return err
+	}
+	stateBucketOK = true
+	return nil
+}
+
+// verifyReadOnly guards plan-only pipelines against over-privileged credentials
+// when --require-read-only is set.
+func verifyReadOnly(ctx context.Context) error {
+	if !requireReadOnly {
+		return nil
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return fmt.Errorf("load AWS config: %w", err)
+	}
+	bucket := stateBucketFor(accountID)
+	if err := preflight.VerifyReadOnly(ctx, s3.NewFromConfig(cfg), bucket); err != nil {
+		return err
+	}
+	output.Printf("[preflight] verified read-only access to %s\n", bucket)
+	return nil
+}
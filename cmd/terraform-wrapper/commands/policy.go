@@ -0,0 +1,43 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"terraform-wrapper/internal/executor"
+	"terraform-wrapper/internal/policy"
+)
+
+var (
+	policyDir string
+	opaPath   string
+)
+
+func registerPolicyFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&policyDir, "policy-dir", "policies", "directory of Rego policies every plan must pass before it is applied, relative to --root; skipped when the default directory does not exist")
+	cmd.Flags().StringVar(&opaPath, "opa-path", "opa", "opa executable used to evaluate the policies")
+}
+
+// attachPolicyGate checks plans against the policies in --policy-dir before
+// they are applied. Without the directory nothing is checked, unless it was
+// named explicitly.
+func attachPolicyGate(cmd *cobra.Command, opts *executor.Options) error {
+	dir := policyDir
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(rootDir, dir)
+	}
+	info, err := os.Stat(dir)
+	switch {
+	case os.IsNotExist(err) && !cmd.Flags().Changed("policy-dir"):
+		return nil
+	case err != nil:
+		return fmt.Errorf("policy directory: %w", err)
+	case !info.IsDir():
+		return fmt.Errorf("policy directory %s is not a directory", dir)
+	}
+	opts.Policy = &policy.Gate{Evaluator: &policy.OPA{Binary: opaPath, Dir: dir}, Workdir: runWorkdir}
+	return nil
+}
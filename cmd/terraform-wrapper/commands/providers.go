@@ -0,0 +1,321 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"terraform-wrapper/internal/executor"
+	"terraform-wrapper/internal/graph"
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/providers"
+	"terraform-wrapper/internal/stacks"
+)
+
+func newProvidersCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "providers",
+		Short: "Manage Terraform provider versions across stacks",
+	}
+	cmd.AddCommand(newProvidersBumpCommand())
+	cmd.AddCommand(newProvidersBundleCommand())
+	return cmd
+}
+
+func newProvidersBundleCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bundle",
+		Short: "Carry the providers of every stack to runners without registry access",
+	}
+	cmd.AddCommand(newProvidersBundleExportCommand())
+	cmd.AddCommand(newProvidersBundleImportCommand())
+	return cmd
+}
+
+func newProvidersBundleExportCommand() *cobra.Command {
+	var (
+		out       string
+		platforms []string
+	)
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Download the providers required across stacks into a portable archive",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := contextWithCmd(cmd)
+			g, _, err := loadGraphData()
+			if err != nil {
+				return err
+			}
+			stackDirs := graphStackPaths(g)
+			res, err := resolveTerraform(ctx, cmd, stackDirs)
+			if err != nil {
+				return err
+			}
+			runner, err := stacks.NewRunner(ctx, stacks.RunnerOptions{
+				RootDir:       rootDir,
+				Environment:   environment,
+				AccountID:     accountID,
+				Region:        region,
+				TerraformPath: res.BinaryPath,
+				Retry:         retryPolicy,
+			})
+			if err != nil {
+				return err
+			}
+
+			staging, err := os.MkdirTemp("", "provider-bundle-*")
+			if err != nil {
+				return err
+			}
+			defer os.RemoveAll(staging)
+			for _, dir := range stackDirs {
+				output.Printf("[providers] mirroring providers of %s\n", dir)
+				if err := runner.MirrorProviders(ctx, dir, staging, platforms); err != nil {
+					return fmt.Errorf("mirror providers for %s: %w", dir, err)
+				}
+			}
+
+			f, err := os.Create(out)
+			if err != nil {
+				return err
+			}
+			packages, err := providers.Pack(staging, f)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(out)
+				return err
+			}
+			for _, pkg := range packages {
+				output.Printf("[providers] bundled %s %s (%s)\n", pkg.Source, pkg.Version, pkg.Platform)
+			}
+			output.Printf("[providers] wrote %d provider packages to %s\n", len(packages), out)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&out, "file", "providers-bundle.tar.gz", "archive to write")
+	cmd.Flags().StringSliceVar(&platforms, "platform", []string{"linux_amd64"}, "platforms to bundle providers for")
+	return cmd
+}
+
+func newProvidersBundleImportCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "import <bundle>",
+		Short: "Unpack a provider bundle into the mirror init installs providers from",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if cerr := f.Close(); cerr != nil && err == nil {
+					err = fmt.Errorf("close %s: %w", args[0], cerr)
+				}
+			}()
+			mirror := stacks.ProviderMirrorDir(rootDir)
+			packages, err := providers.Unpack(f, mirror)
+			if err != nil {
+				return err
+			}
+			for _, pkg := range packages {
+				output.Printf("[providers] imported %s %s (%s)\n", pkg.Source, pkg.Version, pkg.Platform)
+			}
+			output.Printf("[providers] %d provider packages in %s; init now installs providers from it\n", len(packages), mirror)
+			return nil
+		},
+	}
+}
+
+func newProvidersBumpCommand() *cobra.Command {
+	var (
+		allowMajor bool
+		skipPlan   bool
+		dryRun     bool
+		branch     string
+		platforms  []string
+	)
+	cmd := &cobra.Command{
+		Use:   "bump",
+		Short: "Raise provider version constraints to the latest compatible releases",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := contextWithCmd(cmd)
+			g, _, err := loadGraphData()
+			if err != nil {
+				return err
+			}
+			rootAbs, err := filepath.Abs(rootDir)
+			if err != nil {
+				return err
+			}
+
+			var reqs []providers.Requirement
+			for _, path := range graphStackPaths(g) {
+				found, err := providers.Scan(path)
+				if err != nil {
+					return fmt.Errorf("scan providers in %s: %w", path, err)
+				}
+				reqs = append(reqs, found...)
+			}
+
+			bumps, skipped, err := providers.Propose(ctx, reqs, &providers.RegistryClient{}, allowMajor)
+			if err != nil {
+				return err
+			}
+			for _, req := range skipped {
+				output.Printf("[providers] skipping %s in %s: constraint %q must be bumped by hand\n", req.Source, req.File, req.Constraint)
+			}
+			if len(bumps) == 0 {
+				output.Println("[providers] all provider constraints are up to date")
+				return nil
+			}
+			for _, b := range bumps {
+				rel, _ := filepath.Rel(rootAbs, b.File)
+				output.Printf("[providers] %s %s: %q -> %q\n", rel, b.Source, b.Constraint, b.To)
+			}
+			if dryRun {
+				return nil
+			}
+
+			if branch != "" {
+				if _, err := runGit(ctx, rootAbs, "checkout", "-b", branch); err != nil {
+					return err
+				}
+			}
+			if err := providers.Rewrite(bumps); err != nil {
+				return err
+			}
+
+			impacted := providers.ImpactedStacks(bumps)
+			res, err := resolveTerraform(ctx, cmd, impacted)
+			if err != nil {
+				return err
+			}
+			if err := lockProviders(ctx, res.BinaryPath, impacted, platforms); err != nil {
+				return err
+			}
+
+			var planResults map[string]error
+			if !skipPlan {
+				resolvedVersion := ""
+				if res.Version != nil {
+					resolvedVersion = res.Version.String()
+				}
+				planResults = planImpacted(ctx, g, impacted, executorOptions(res.BinaryPath, resolvedVersion))
+			}
+
+			files := changedFiles(bumps)
+			patch, err := runGit(ctx, rootAbs, append([]string{"diff", "--"}, files...)...)
+			if err != nil {
+				output.Printf("[providers] warning: unable to produce patch: %v\n", err)
+			}
+
+			dir := providers.ReportDir(rootAbs, time.Now())
+			if err := providers.WriteReport(dir, rootAbs, bumps, planResults, patch); err != nil {
+				return err
+			}
+			output.Printf("[providers] summary written to %s\n", dir)
+
+			if branch != "" {
+				if _, err := runGit(ctx, rootAbs, append([]string{"add", "--"}, files...)...); err != nil {
+					return err
+				}
+				summary, err := os.ReadFile(filepath.Join(dir, "summary.md"))
+				if err != nil {
+					return err
+				}
+				if _, err := runGit(ctx, rootAbs, "commit", "-m", "Bump Terraform provider constraints", "-m", string(summary)); err != nil {
+					return err
+				}
+				output.Printf("[providers] committed bumps to branch %s\n", branch)
+			}
+
+			for stack, planErr := range planResults {
+				if planErr != nil {
+					return fmt.Errorf("plan failed for bumped stack %s: %w", stack, planErr)
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&allowMajor, "allow-major", false, "allow bumps across major provider versions")
+	cmd.Flags().BoolVar(&skipPlan, "skip-plan", false, "do not plan stacks affected by the bump")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "only report the constraints that would change")
+	cmd.Flags().StringVar(&branch, "branch", "", "create this git branch and commit the bump to it")
+	cmd.Flags().StringSliceVar(&platforms, "platform", []string{"linux_amd64", "darwin_arm64"}, "platforms recorded in .terraform.lock.hcl")
+	return cmd
+}
+
+func lockProviders(ctx context.Context, binaryPath string, stackDirs, platforms []string) error {
+	runner, err := stacks.NewRunner(ctx, stacks.RunnerOptions{
+		RootDir:       rootDir,
+		Environment:   environment,
+		AccountID:     accountID,
+		Region:        region,
+		TerraformPath: binaryPath,
+	})
+	if err != nil {
+		return err
+	}
+	for _, dir := range stackDirs {
+		if err := runner.LockProviders(ctx, dir, platforms); err != nil {
+			return fmt.Errorf("lock providers for %s: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+func planImpacted(ctx context.Context, g graph.Graph, stackDirs []string, opts executor.Options) map[string]error {
+	opts.UseCache = false
+	results := make(map[string]error, len(stackDirs))
+	for _, dir := range stackDirs {
+		stack, ok := g[dir]
+		if !ok {
+			continue
+		}
+		_, err := executor.PlanStack(ctx, stack, opts)
+		results[dir] = err
+	}
+	return results
+}
+
+// changedFiles lists the files touched by the bumps together with the lock
+// files refreshed next to them.
+func changedFiles(bumps []providers.Bump) []string {
+	seen := make(map[string]struct{})
+	var files []string
+	add := func(path string) {
+		if _, ok := seen[path]; ok {
+			return
+		}
+		seen[path] = struct{}{}
+		files = append(files, path)
+	}
+	for _, b := range bumps {
+		add(b.File)
+	}
+	for _, stack := range providers.ImpactedStacks(bumps) {
+		add(filepath.Join(stack, ".terraform.lock.hcl"))
+	}
+	return files
+}
+
+func runGit(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
@@ -0,0 +1,122 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/procmon"
+	"terraform-wrapper/internal/retention"
+	"terraform-wrapper/internal/tenant"
+	"terraform-wrapper/internal/wrapperconfig"
+)
+
+// parseRetention reads the retention policy from --keep-runs and
+// --max-artifact-age.
+func parseRetention() (retention.Policy, error) {
+	if keepRuns < 0 {
+		return retention.Policy{}, fmt.Errorf("--keep-runs must not be negative")
+	}
+	policy := retention.Policy{KeepRuns: keepRuns}
+	if maxArtifactAge != "" {
+		age, err := parseAge(maxArtifactAge)
+		if err != nil {
+			return retention.Policy{}, fmt.Errorf("--max-artifact-age: %w", err)
+		}
+		policy.MaxAge = age
+	}
+	return policy, nil
+}
+
+// runFinished is set once the command has recorded a run or printed a run
+// summary, so Execute applies the retention policy after it.
+var runFinished bool
+
+// enforceRetention applies the retention policy once a run has finished. A
+// failure to prune never fails the run.
+func enforceRetention() {
+	if !retentionPolicy.Enabled() {
+		return
+	}
+	expired, err := retention.Expired(rootDir, tenantName, environment, retentionPolicy, time.Now())
+	if err == nil && len(expired) > 0 {
+		err = retention.Remove(rootDir, expired)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[prune] warning: %v\n", err)
+		return
+	}
+	if len(expired) > 0 {
+		fmt.Fprintf(os.Stderr, "[prune] removed %d expired artifacts\n", len(expired))
+	}
+}
+
+func newPruneCommand() *cobra.Command {
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove run history, failure bundles, logs and cached plans outside the retention policy",
+		Long: `Apply the retention policy to the environment's artifacts under
+.terraform-wrapper now, rather than after the next run. --keep-runs keeps the
+newest run records, failure bundles and run logs; --max-artifact-age removes run
+records, failure bundles, logs and cached plans last written longer ago. Both
+default to keep_runs and max_artifact_age in terraform-wrapper.hcl. Records of
+runs still in progress are never removed.`,
+		// Pruning reads only the local .terraform-wrapper directory, so no AWS
+		// access is needed.
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := applyConfigFile(cmd); err != nil {
+				return err
+			}
+			if envAlias != "" {
+				environment = envAlias
+			}
+			if environment == "" {
+				return fmt.Errorf("environment must be specified via --environment or --env")
+			}
+			if err := tenant.Validate(tenantName); err != nil {
+				return err
+			}
+			policy, err := parseRetention()
+			if err != nil {
+				return err
+			}
+			retentionPolicy = policy
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !retentionPolicy.Enabled() {
+				return fmt.Errorf("no retention policy: pass --keep-runs or --max-artifact-age, or set keep_runs or max_artifact_age in %s", wrapperconfig.FileName)
+			}
+			expired, err := retention.Expired(rootDir, tenantName, environment, retentionPolicy, time.Now())
+			if err != nil {
+				return err
+			}
+			verb := "removed"
+			if dryRun {
+				verb = "would remove"
+			}
+			var total int64
+			for _, artifact := range expired {
+				path, err := filepathRelSafe(rootDir, artifact.Path)
+				if err != nil {
+					path = artifact.Path
+				}
+				output.Printf("[prune] %s %s %s (%s)\n", verb, artifact.Kind, path, procmon.FormatBytes(uint64(artifact.Size)))
+				total += artifact.Size
+			}
+			if !dryRun {
+				if err := retention.Remove(rootDir, expired); err != nil {
+					return err
+				}
+			}
+			output.Printf("[prune] %s %d artifacts, %s\n", verb, len(expired), procmon.FormatBytes(uint64(total)))
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "list the artifacts that would be removed without removing them")
+	return cmd
+}
@@ -0,0 +1,54 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+
+	"terraform-wrapper/internal/remote"
+	"terraform-wrapper/internal/runs"
+)
+
+// executionBackend builds the remote backend selected by --exec-backend. It
+// returns nil for local execution.
+func executionBackend(ctx context.Context) (remote.Backend, string, error) {
+	if execBackendName == "" || execBackendName == remote.BackendLocal {
+		return nil, "", nil
+	}
+
+	configPath := execBackendConfig
+	if !filepath.IsAbs(configPath) {
+		configPath = filepath.Join(rootDir, configPath)
+	}
+	settings, err := remote.LoadConfig(configPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, "", fmt.Errorf("load AWS config: %w", err)
+	}
+	logs := cloudwatchlogs.NewFromConfig(cfg)
+	revision := runs.GitSHA(ctx, rootDir)
+
+	switch execBackendName {
+	case remote.BackendECS:
+		if settings.ECS == nil {
+			return nil, "", fmt.Errorf("%s has no ecs section", configPath)
+		}
+		return &remote.ECSBackend{Config: *settings.ECS, ECS: ecs.NewFromConfig(cfg), Logs: logs}, revision, nil
+	case remote.BackendCodeBuild:
+		if settings.CodeBuild == nil {
+			return nil, "", fmt.Errorf("%s has no codebuild section", configPath)
+		}
+		return &remote.CodeBuildBackend{Config: *settings.CodeBuild, CodeBuild: codebuild.NewFromConfig(cfg), Logs: logs}, revision, nil
+	default:
+		return nil, "", fmt.Errorf("unknown execution backend %q (expected local, ecs or codebuild)", execBackendName)
+	}
+}
@@ -0,0 +1,175 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-exec/tfexec"
+	"github.com/spf13/cobra"
+
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/rollback"
+	"terraform-wrapper/internal/stacks"
+)
+
+func newRollbackCommand() *cobra.Command {
+	var (
+		stackArg    string
+		autoApprove bool
+	)
+	cmd := &cobra.Command{
+		Use:   "rollback",
+		Short: "Restore a stack's resource arguments from the state saved before its last apply",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := contextWithCmd(cmd)
+			g, index, err := loadGraphData()
+			if err != nil {
+				return err
+			}
+			stack, rel, err := resolveStackArg(g, index, stackArg)
+			if err != nil {
+				return err
+			}
+
+			res, err := resolveTerraform(ctx, cmd, []string{stack.Path})
+			if err != nil {
+				return err
+			}
+
+			runner, err := stacks.NewRunner(ctx, stacks.RunnerOptions{
+				RootDir:       rootDir,
+				Environment:   environment,
+				AccountID:     accountID,
+				Region:        region,
+				TerraformPath: res.BinaryPath,
+				Profile:       profile,
+				Workspace:     workspace,
+				StateKMSKeyID: stateKMSKeyID,
+				StateBackend:  stateBackend,
+				AssumeRoleARN: assumeRoleARN,
+				Retry:         retryPolicy,
+				TFLog:         tfLog,
+				TFLogDir:      runLogDir,
+				ExtraVarFiles: extraVarFiles,
+			})
+			if err != nil {
+				return err
+			}
+			backupPath, err := runner.BackupPath(stack.Path)
+			if err != nil {
+				return err
+			}
+			if _, err := os.Stat(backupPath); errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("no pre-apply state backup for %s at %s", rel, backupPath)
+			}
+
+			if err := runner.InitOnly(ctx, stack.Path, false); err != nil {
+				return fmt.Errorf("init %s: %w", rel, err)
+			}
+			tf, err := newRollbackTerraform(stack.Path, res.BinaryPath)
+			if err != nil {
+				return err
+			}
+
+			opts := rollback.Options{
+				StackDir:   stack.Path,
+				BackupPath: backupPath,
+				PlanPath:   filepath.Join(filepath.Dir(backupPath), "rollback.tfplan"),
+				VarFiles:   runner.VarFilesFor(stack.Path),
+				Approve:    confirmRollback,
+			}
+			if autoApprove {
+				opts.Approve = func(plan string) (bool, error) {
+					output.Println(plan)
+					return true, nil
+				}
+			}
+
+			result, applied, err := rollback.Run(ctx, tf, opts)
+			if result != nil {
+				printRollbackReport(result)
+			}
+			if err != nil {
+				return err
+			}
+			switch {
+			case len(result.Restore) == 0:
+				output.Printf("[rollback] nothing to restore automatically for %s\n", rel)
+			case applied:
+				output.Printf("[rollback] restored %d resources in %s\n", len(result.Restore), rel)
+			default:
+				output.Printf("[rollback] rollback of %s not applied\n", rel)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&stackArg, "stack", "", "stack name or path")
+	cmd.Flags().BoolVar(&autoApprove, "auto-approve", false, "apply the rollback plan without asking for confirmation")
+	_ = cmd.MarkFlagRequired("stack")
+	return cmd
+}
+
+// rollbackTerraform reads states and schemas with a quiet executor, so their
+// JSON is not echoed, and streams the rollback apply to the terminal.
+type rollbackTerraform struct {
+	*tfexec.Terraform
+	loud *tfexec.Terraform
+}
+
+func newRollbackTerraform(stackDir, binaryPath string) (*rollbackTerraform, error) {
+	quiet, err := tfexec.NewTerraform(stackDir, binaryPath)
+	if err != nil {
+		return nil, err
+	}
+	quiet.SetStderr(os.Stderr)
+	loud, err := tfexec.NewTerraform(stackDir, binaryPath)
+	if err != nil {
+		return nil, err
+	}
+	loud.SetStdout(output.Progress())
+	loud.SetStderr(os.Stderr)
+	return &rollbackTerraform{Terraform: quiet, loud: loud}, nil
+}
+
+func (t *rollbackTerraform) Apply(ctx context.Context, opts ...tfexec.ApplyOption) error {
+	return t.loud.Apply(ctx, opts...)
+}
+
+func printRollbackReport(result *rollback.Result) {
+	for _, change := range result.Restore {
+		names := make([]string, 0, len(change.Attributes))
+		for name := range change.Attributes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		output.Printf("[rollback] %s: restore %s\n", change.Address, strings.Join(names, ", "))
+		if len(change.Skipped) > 0 {
+			output.Printf("[rollback] %s: cannot restore %s\n", change.Address, strings.Join(change.Skipped, ", "))
+		}
+	}
+	for _, addr := range result.Created {
+		output.Printf("[rollback] %s: created by the failed apply; destroy it manually if unwanted\n", addr)
+	}
+	for _, addr := range result.Destroyed {
+		output.Printf("[rollback] %s: destroyed by the failed apply; cannot be restored from the backup\n", addr)
+	}
+	for _, addr := range result.Manual {
+		output.Printf("[rollback] %s: changed but must be restored manually\n", addr)
+	}
+}
+
+func confirmRollback(plan string) (bool, error) {
+	output.Println(plan)
+	output.Printf("Apply this rollback plan? Only 'yes' will be accepted: ")
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false, fmt.Errorf("read confirmation: %w", err)
+	}
+	return strings.TrimSpace(answer) == "yes", nil
+}
@@ -3,33 +3,109 @@ package commands
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/go-version"
 	"github.com/spf13/cobra"
 
 	"terraform-wrapper/internal/awsaccount"
+	"terraform-wrapper/internal/cache"
 	"terraform-wrapper/internal/executor"
+	"terraform-wrapper/internal/featureflags"
 	"terraform-wrapper/internal/graph"
+	"terraform-wrapper/internal/logging"
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/plugincache"
+	"terraform-wrapper/internal/procmon"
+	"terraform-wrapper/internal/remote"
+	"terraform-wrapper/internal/retention"
+	"terraform-wrapper/internal/stacks"
+	"terraform-wrapper/internal/statekms"
+	"terraform-wrapper/internal/superplan"
+	"terraform-wrapper/internal/tenant"
+	"terraform-wrapper/internal/triage"
 	"terraform-wrapper/internal/versioning"
+	"terraform-wrapper/internal/workdir"
+	"terraform-wrapper/internal/wrapperconfig"
 )
 
 var (
-	rootDir           string
-	environment       string
-	envAlias          string
-	terraformVersion  string
-	accountID         string
-	region            string
-	superplanDir      string
-	parallelism       int
-	cacheEnabled      bool
-	forcePlanStacks   []string
-	keepPlanArtifacts bool
-	refreshState      bool
+	rootDir            string
+	environment        string
+	envAlias           string
+	profile            string
+	workspace          string
+	tenantName         string
+	terraformVersion   string
+	engineName         string
+	engine             versioning.Engine
+	releasesMirror     string
+	cliConfig          string
+	pluginCacheEnabled bool
+	pluginCacheLock    bool
+	accountID          string
+	region             string
+	superplanDir       string
+	parallelism        int
+	adaptive           bool
+	cacheEnabled       bool
+	cacheBackend       string
+	cacheBucket        string
+	planCache          cache.Remote
+	backupsEnabled     bool
+	stateBackups       stacks.StateBackups
+	forcePlanStacks    []string
+	keepPlanArtifacts  bool
+	refreshState       bool
+	execBackendName    string
+	execBackendConfig  string
+	execBackend        remote.Backend
+	execRevision       string
+	execDocker         string
+	outputFormat       string
+	verbose            bool
+	outputMode         string
+	outputGroup        *output.Group
+	stateKMSKeyID      string
+	stateBackend       *stacks.BackendSettings
+	stateBucketOK      bool
+	assumeRoleARN      string
+	allowedRegions     []string
+	forceDestroySkip   bool
+	maxRSS             string
+	maxRSSBytes        uint64
+	retryAttempts      int
+	retryDelay         time.Duration
+	retryPatterns      []string
+	lockWait           time.Duration
+	retryPolicy        stacks.RetryPolicy
+	tfLog              string
+	// runLogDir is this run's directory under .terraform-wrapper/logs, set
+	// when --tf-log or --stack-logs is passed.
+	runLogDir       string
+	extraVarFiles   []string
+	keepGoing       bool
+	stackTimeout    time.Duration
+	runTimeout      time.Duration
+	logLevel        string
+	quiet           bool
+	stackLogs       bool
+	keepWorkspace   bool
+	runWorkdir      *workdir.Workdir
+	eventWriter     io.Writer
+	keepRuns        int
+	maxArtifactAge  string
+	retentionPolicy retention.Policy
+	tagAttributes   superplan.TagAttributes
+	applyIdentities []string
+	offlineMode     bool
 )
 
 var wrapperVersion = "dev-1"
@@ -39,22 +115,122 @@ var rootCmd = &cobra.Command{
 	Short:   "Terraform orchestration toolkit",
 	Version: wrapperVersion,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := applyConfigFile(cmd); err != nil {
+			return err
+		}
 		if envAlias != "" {
 			environment = envAlias
 		}
 		if environment == "" {
 			return fmt.Errorf("environment must be specified via --environment or --env")
 		}
+		parsedEngine, err := versioning.ParseEngine(engineName)
+		if err != nil {
+			return fmt.Errorf("--engine: %w", err)
+		}
+		engine = parsedEngine
+		if err := configureMirrors(); err != nil {
+			return err
+		}
+		if pluginCacheEnabled {
+			if _, err := plugincache.Setup(plugincache.Options{Root: rootDir, Lock: pluginCacheLock}); err != nil {
+				return err
+			}
+		}
+		if err := stacks.ValidateProfile(profile); err != nil {
+			return err
+		}
+		if err := stacks.ValidateWorkspace(workspace); err != nil {
+			return err
+		}
+		naming, _ := stateBackend.Naming()
+		if err := naming.ValidateWorkspace(workspace); err != nil {
+			return err
+		}
+		if err := tenant.Validate(tenantName); err != nil {
+			return err
+		}
+		if tenantName != "" && !cmd.Flags().Changed("out") {
+			superplanDir = filepath.Join(superplanDir, tenant.Dir, tenantName)
+		}
+		limit, err := procmon.ParseBytes(maxRSS)
+		if err != nil {
+			return fmt.Errorf("--max-rss: %w", err)
+		}
+		maxRSSBytes = limit
+		matchers, err := stacks.RetryMatchers(retryPatterns)
+		if err != nil {
+			return err
+		}
+		retryPolicy = stacks.RetryPolicy{Attempts: retryAttempts, Delay: retryDelay, LockWait: lockWait, Matchers: matchers}
+		if err := resolveExtraVarFiles(); err != nil {
+			return err
+		}
+		if retentionPolicy, err = parseRetention(); err != nil {
+			return err
+		}
+		if err := stacks.ValidateTFLog(tfLog); err != nil {
+			return fmt.Errorf("--tf-log: %w", err)
+		}
+		if tfLog != "" || stackLogs {
+			runLogDir = triage.NewRunLogDir(rootDir, envScope(), time.Now())
+		}
+		if err := configureOutput(outputFormat); err != nil {
+			return err
+		}
+		if err := configureOutputMode(); err != nil {
+			return err
+		}
+		if err := configureLogging(); err != nil {
+			return err
+		}
+		runWorkdir = workdir.New(keepWorkspace)
+		keyID, err := statekms.KeyID(rootDir, environment)
+		if err != nil {
+			return err
+		}
+		stateKMSKeyID = keyID
 		if parallelism <= 0 {
 			parallelism = 4
 		}
+		if assumeRoleARN != "" {
+			roleAccount, err := awsaccount.AccountIDFromRoleARN(assumeRoleARN)
+			if err != nil {
+				return fmt.Errorf("--assume-role-arn: %w", err)
+			}
+			if accountID == "" {
+				accountID = roleAccount
+			}
+		}
+		offlineMode = offlineRun(cmd)
+		if accountID == "" && offlineMode {
+			return fmt.Errorf("the AWS account cannot be discovered without AWS access; pass --account-id or set account_id in %s", wrapperconfig.FileName)
+		}
 		if accountID == "" {
 			ctx := cmd.Context()
-			id, err := awsaccount.CallerAccountID(ctx, region)
+			caller, err := awsaccount.CallerIdentity(ctx, region)
 			if err != nil {
 				return err
 			}
-			accountID = id
+			accountID = caller.AccountID
+			rememberCaller(caller)
+		}
+		backend, revision, err := executionBackend(cmd.Context())
+		if err != nil {
+			return err
+		}
+		execBackend, execRevision = backend, revision
+		shared, err := sharedPlanCache(cmd.Context())
+		if err != nil {
+			return err
+		}
+		planCache = shared
+		if backupsEnabled {
+			store, _, err := stateBackupStore(cmd.Context())
+			if err != nil {
+				return fmt.Errorf("--state-backups: %w", err)
+			}
+			stateBackups = store
 		}
 		return nil
 	},
@@ -64,16 +240,49 @@ func init() {
 	rootCmd.SetVersionTemplate("terraform-wrapper version {{.Version}}\n")
 	rootCmd.PersistentFlags().StringVar(&rootDir, "root", ".", "root directory containing Terraform stacks")
 	rootCmd.PersistentFlags().StringVar(&terraformVersion, "terraform-version", "", "Optional exact Terraform version to enforce")
+	rootCmd.PersistentFlags().StringVar(&engineName, "engine", "terraform", "run stacks with terraform or tofu (OpenTofu); selects the binary that is resolved, installed and pinned")
+	rootCmd.PersistentFlags().StringVar(&releasesMirror, "releases-mirror", "", "base URL of a releases.hashicorp.com mirror, such as an Artifactory remote repository, to list and download Terraform versions from")
+	rootCmd.PersistentFlags().StringVar(&cliConfig, "cli-config", "", "terraform CLI configuration file, relative to --root, exported as TF_CLI_CONFIG_FILE, e.g. to install providers from a network mirror")
+	rootCmd.PersistentFlags().BoolVar(&pluginCacheEnabled, "plugin-cache", true, "share one provider plugin cache, .terraform-wrapper/plugin-cache unless TF_PLUGIN_CACHE_DIR is set, between all stacks")
+	rootCmd.PersistentFlags().BoolVar(&pluginCacheLock, "plugin-cache-lock", false, "let only one stack at a time run init against the shared plugin cache, across processes, so concurrent inits cannot corrupt it")
 	rootCmd.PersistentFlags().StringVar(&environment, "environment", "", "environment name (required)")
 	rootCmd.PersistentFlags().StringVar(&envAlias, "env", "", "environment name alias")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "tfvars profile layered over the environment, e.g. blue or green")
+	rootCmd.PersistentFlags().StringVar(&workspace, "workspace", "", "scope state, plan cache and locks to this workspace of each stack")
+	rootCmd.PersistentFlags().StringVar(&tenantName, "tenant", "", "keep plan cache, locks, run history, logs and artifacts under this team's own prefix")
 	rootCmd.PersistentFlags().StringVar(&accountID, "account-id", "", "AWS account ID (defaults to caller identity)")
 	rootCmd.PersistentFlags().StringVar(&region, "region", "eu-west-2", "AWS region")
+	rootCmd.PersistentFlags().StringVar(&assumeRoleARN, "assume-role-arn", "", "run terraform with credentials for this IAM role; stacks may override it with assume_role_arn in dependencies.json")
 	rootCmd.PersistentFlags().StringVar(&superplanDir, "out", ".superplan", "directory for generated superplan artifacts")
 	rootCmd.PersistentFlags().IntVar(&parallelism, "parallelism", 4, "number of stacks to run concurrently")
+	rootCmd.PersistentFlags().BoolVar(&adaptive, "adaptive-parallelism", false, "lower parallelism while terraform reports throttling or state lock contention, raising it back as stacks succeed")
 	rootCmd.PersistentFlags().BoolVar(&cacheEnabled, "cache", true, "enable plan cache reuse")
+	rootCmd.PersistentFlags().StringVar(&cacheBackend, "cache-backend", cache.BackendLocal, "where plans are cached: local, or s3 to share them between machines through --cache-bucket")
+	rootCmd.PersistentFlags().StringVar(&cacheBucket, "cache-bucket", "", "S3 bucket of the shared plan cache")
+	rootCmd.PersistentFlags().BoolVar(&backupsEnabled, "state-backups", false, "before each apply or destroy, also copy each stack's state to s3://<state-bucket>/backups/<env>/<stack>/")
 	rootCmd.PersistentFlags().StringSliceVar(&forcePlanStacks, "force-plan", nil, "comma separated list of stacks to force planning")
 	rootCmd.PersistentFlags().BoolVar(&keepPlanArtifacts, "keep-plan-artifacts", false, "preserve generated superplan artifacts")
 	rootCmd.PersistentFlags().BoolVar(&refreshState, "refresh", true, "refresh state before planning")
+	rootCmd.PersistentFlags().StringVar(&execBackendName, "exec-backend", remote.BackendLocal, "where stacks run: local, ecs or codebuild")
+	rootCmd.PersistentFlags().StringVar(&execDocker, "exec-docker", "", "run terraform inside this Docker image, tagged with the resolved Terraform version when untagged")
+	rootCmd.PersistentFlags().StringVar(&outputFormat, "output", string(output.FormatText), "progress output format: text or json (NDJSON on stdout)")
+	rootCmd.PersistentFlags().BoolVar(&verbose, "verbose", false, "prefix each line of terraform output with its stack")
+	rootCmd.PersistentFlags().StringVar(&outputMode, "output-mode", "", "how terraform output of parallel stacks is shown: stream (live, prefixed with the stack) or group (one block per stack when it finishes)")
+	rootCmd.PersistentFlags().StringVar(&maxRSS, "max-rss", "", "kill and fail a stack whose terraform processes exceed this memory, e.g. 4G")
+	rootCmd.PersistentFlags().IntVar(&retryAttempts, "retry-attempts", 3, "tries for terraform commands that fail transiently, such as on a held state lock or throttling; 1 disables retries")
+	rootCmd.PersistentFlags().DurationVar(&retryDelay, "retry-delay", 10*time.Second, "wait before the first retry of a transient failure, doubled for each further retry")
+	rootCmd.PersistentFlags().DurationVar(&lockWait, "lock-wait", 5*time.Minute, "keep retrying a stack whose state lock is held by another process for this long before failing it; 0 retries it like other transient failures")
+	rootCmd.PersistentFlags().DurationVar(&stackTimeout, "stack-timeout", 0, "kill a stack's terraform and fail the stack after it has run this long, e.g. 45m; 0 disables")
+	rootCmd.PersistentFlags().DurationVar(&runTimeout, "timeout", 0, "deadline for the whole run: running stacks are killed and the rest skipped once it passes; 0 disables")
+	rootCmd.PersistentFlags().StringVar(&tfLog, "tf-log", "", "capture terraform's log at this level, trace or debug, in a file per stack under .terraform-wrapper/logs")
+	rootCmd.PersistentFlags().StringArrayVar(&extraVarFiles, "extra-var-file", nil, "tfvars file appended to every stack's var files for an ad-hoc override; repeatable")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "lowest level of wrapper log lines shown: debug, info, warn or error")
+	rootCmd.PersistentFlags().BoolVar(&quiet, "quiet", false, "only show warnings and errors from the wrapper")
+	rootCmd.PersistentFlags().BoolVar(&keepWorkspace, "keep-workspace", false, "keep the run's directory of generated files, such as the superplan configuration, instead of removing it")
+	rootCmd.PersistentFlags().BoolVar(&stackLogs, "stack-logs", false, "also write each stack's log lines and terraform output to .terraform-wrapper/logs/<env>/<run>/<stack>.log")
+	rootCmd.PersistentFlags().StringVar(&execBackendConfig, "exec-backend-config", "remote-execution.json", "remote execution settings, relative to --root")
+	rootCmd.PersistentFlags().IntVar(&keepRuns, "keep-runs", 0, "after each run, keep only this many of the newest run records, failure bundles and run logs; 0 keeps them all")
+	rootCmd.PersistentFlags().StringVar(&maxArtifactAge, "max-artifact-age", "", "after each run, remove run records, failure bundles, logs and cached plans older than this, e.g. 30d")
 
 	rootCmd.AddCommand(newBootstrapCommand())
 	rootCmd.AddCommand(newPlanCommand())
@@ -81,15 +290,50 @@ func init() {
 	rootCmd.AddCommand(newDestroyCommand())
 	rootCmd.AddCommand(newInitCommand())
 	rootCmd.AddCommand(newPlanAllCommand())
+	rootCmd.AddCommand(newSuperplanCommand())
 	rootCmd.AddCommand(newApplyAllCommand())
 	rootCmd.AddCommand(newDestroyAllCommand())
 	rootCmd.AddCommand(newInitAllCommand())
+	rootCmd.AddCommand(newRunCommand())
 	rootCmd.AddCommand(newCleanCommand())
 	rootCmd.AddCommand(newCleanAllCommand())
+	rootCmd.AddCommand(newArchiveStackCommand())
+	rootCmd.AddCommand(newProvidersCommand())
+	rootCmd.AddCommand(newFreezeCommand())
+	rootCmd.AddCommand(newUnlockCommand())
+	rootCmd.AddCommand(newStateCommand())
+	rootCmd.AddCommand(newImportCommand())
+	rootCmd.AddCommand(newOutputsCommand())
+	rootCmd.AddCommand(newBackendCommand())
+	rootCmd.AddCommand(newDriftCommand())
+	rootCmd.AddCommand(newDriftAllCommand())
+	rootCmd.AddCommand(newSnapshotCommand())
+	rootCmd.AddCommand(newCacheCommand())
+	rootCmd.AddCommand(newGraphCommand())
+	rootCmd.AddCommand(newContractsCommand())
+	rootCmd.AddCommand(newEnvCommand())
+	rootCmd.AddCommand(newRollbackCommand())
+	rootCmd.AddCommand(newPruneCommand())
+	rootCmd.AddCommand(newVersionsCommand())
 }
 
 func Execute() error {
-	return rootCmd.Execute()
+	started := time.Now()
+	cmd, err := rootCmd.ExecuteC()
+	recordTelemetry(cmd, started, err)
+	if runFinished {
+		enforceRetention()
+	}
+	if outputGroup != nil {
+		if flushErr := outputGroup.FlushAll(); flushErr != nil {
+			fmt.Fprintf(os.Stderr, "[output] warning: %v\n", flushErr)
+		}
+	}
+	runWorkdir.Close()
+	if closeErr := logging.Close(); closeErr != nil {
+		fmt.Fprintf(os.Stderr, "[log] warning: close stack logs: %v\n", closeErr)
+	}
+	return err
 }
 
 func contextWithCmd(cmd *cobra.Command) context.Context {
@@ -112,15 +356,80 @@ func printSummary(label string, summary *executor.Summary) {
 	if summary == nil {
 		return
 	}
-	fmt.Printf("[%s] executed=%d cached=%d skipped=%d\n", label, summary.Executed, summary.Cached, summary.Skipped)
+	telemetrySummary = summary
+	runFinished = true
+	if eventWriter != nil {
+		event := output.Event{
+			Event:  "summary",
+			Reason: label,
+			Counts: map[string]int{
+				"executed": summary.Executed,
+				"cached":   summary.Cached,
+				"skipped":  summary.Skipped,
+				// dependency_failed counts skipped stacks whose
+				// dependency failed under --keep-going.
+				"dependency_failed": len(summary.DependencyFailed),
+				"timed_out":         len(summary.TimedOut),
+			},
+		}
+		if len(summary.Failed) > 0 {
+			event.Failed = make(map[string]string, len(summary.Failed))
+			for stack, err := range summary.Failed {
+				event.Failed[stack] = err.Error()
+			}
+		}
+		if err := output.WriteEvent(eventWriter, event); err != nil {
+			fmt.Fprintf(os.Stderr, "[output] warning: %v\n", err)
+		}
+	}
+	output.Printf("[%s] executed=%d cached=%d skipped=%d\n", label, summary.Executed, summary.Cached, summary.Skipped)
+	if len(summary.DependencyFailed) > 0 {
+		output.Printf("[%s] skipped because a dependency failed: %s\n", label, strings.Join(summary.DependencyFailed, ", "))
+	}
+	if len(summary.TimedOut) > 0 {
+		timedOut := append([]string(nil), summary.TimedOut...)
+		sort.Strings(timedOut)
+		output.Printf("[%s] timed out: %s\n", label, strings.Join(timedOut, ", "))
+	}
+	if len(extraVarFiles) > 0 {
+		output.Printf("[%s] extra var files: %s\n", label, strings.Join(extraVarFiles, ", "))
+	}
 	if len(summary.Failed) > 0 {
-		fmt.Println("Failures:")
+		output.Println("Failures:")
 		for stack, err := range summary.Failed {
-			fmt.Printf("  %s: %v\n", stack, err)
+			output.Printf("  %s [%s]: %v\n", stack, triage.Classify(err), err)
+		}
+	}
+	if len(summary.Usage) > 0 {
+		names := make([]string, 0, len(summary.Usage))
+		for stack := range summary.Usage {
+			names = append(names, stack)
+		}
+		sort.Strings(names)
+		output.Println("Peak resource usage:")
+		for _, stack := range names {
+			usage := summary.Usage[stack]
+			output.Printf("  %s: rss=%s cpu=%.1fs\n", stack, procmon.FormatBytes(usage.PeakRSSBytes), usage.CPUSeconds)
 		}
 	}
 }
 
+// failRun reports a failed run and collects a triage bundle for the failed stacks.
+func failRun(label string, summary *executor.Summary, runErr error) error {
+	printSummary(label, summary)
+	if summary == nil || len(summary.Failed) == 0 {
+		return runErr
+	}
+	dir, err := triage.WriteBundle(rootDir, envScope(), label, runLogDir, summary.Failed)
+	if err != nil {
+		output.Printf("[triage] warning: %v\n", err)
+	}
+	if dir != "" {
+		output.Printf("[triage] failure bundle written to %s\n", dir)
+	}
+	return runErr
+}
+
 func executorOptions(binaryPath, resolvedVersion string) executor.Options {
 	forceMap := make(map[string]struct{})
 	for _, name := range forcePlanStacks {
@@ -130,17 +439,102 @@ func executorOptions(binaryPath, resolvedVersion string) executor.Options {
 		}
 	}
 	return executor.Options{
-		RootDir:          rootDir,
-		Environment:      environment,
-		AccountID:        accountID,
-		Region:           region,
-		TerraformPath:    binaryPath,
-		TerraformVersion: resolvedVersion,
-		Parallelism:      parallelism,
-		UseCache:         cacheEnabled,
-		ForceStacks:      forceMap,
-		DisableRefresh:   !refreshState,
+		RootDir:             rootDir,
+		Environment:         environment,
+		Profile:             profile,
+		Workspace:           workspace,
+		Tenant:              tenantName,
+		StateKMSKeyID:       stateKMSKeyID,
+		AccountID:           accountID,
+		Region:              region,
+		TerraformPath:       binaryPath,
+		TerraformVersion:    resolvedVersion,
+		Engine:              string(engine),
+		Parallelism:         parallelism,
+		AdaptiveParallelism: adaptive,
+		UseCache:            cacheEnabled,
+		RemoteCache:         planCache,
+		StateBackups:        stateBackups,
+		ForceStacks:         forceMap,
+		DisableRefresh:      !refreshState,
+		Backend:             execBackend,
+		RemoteFlags:         remoteRunFlags(),
+		Revision:            execRevision,
+		EventWriter:         eventWriter,
+		MaxRSSBytes:         maxRSSBytes,
+		StateBackend:        stateBackend,
+		AssumeRoleARN:       assumeRoleARN,
+		ForceDestroySkipped: forceDestroySkip,
+		KeepGoing:           keepGoing,
+		StackTimeout:        stackTimeout,
+		Timeout:             runTimeout,
+		PrefixOutput:        verbose,
+		Color:               verbose && colorOutput(),
+		OutputGroup:         outputGroup,
+		Retry:               retryPolicy,
+		TFLog:               tfLog,
+		TFLogDir:            runLogDir,
+		ExtraVarFiles:       extraVarFiles,
+		Workdir:             runWorkdir,
+	}
+}
+
+// remoteRunFlags repeats the flags that change how a stack runs for the
+// invocations a remote backend starts, which would otherwise run with the
+// defaults. Everything else a remote run needs comes from the checked out
+// repository, such as terraform-wrapper.hcl.
+func remoteRunFlags() []string {
+	flags := []string{
+		"--retry-attempts", strconv.Itoa(retryAttempts),
+		"--retry-delay", retryDelay.String(),
+		"--lock-wait", lockWait.String(),
+	}
+	if !refreshState {
+		flags = append(flags, "--refresh=false")
+	}
+	if stackTimeout > 0 {
+		flags = append(flags, "--stack-timeout", stackTimeout.String())
 	}
+	if maxRSS != "" {
+		flags = append(flags, "--max-rss", maxRSS)
+	}
+	if releasesMirror != "" {
+		flags = append(flags, "--releases-mirror", releasesMirror)
+	}
+	if cliConfig != "" {
+		flags = append(flags, "--cli-config", cliConfig)
+	}
+	// Backups are taken where the state is replaced, on the remote runner.
+	if backupsEnabled {
+		flags = append(flags, "--state-backups")
+	}
+	return flags
+}
+
+// envScope is the environment segment of the wrapper's own paths and keys,
+// under the tenant's prefix when --tenant is set.
+func envScope() string {
+	return tenant.Scope(tenantName, environment)
+}
+
+// offlineRun reports whether cmd was asked to run without AWS access.
+func offlineRun(cmd *cobra.Command) bool {
+	flag := cmd.Flags().Lookup("from-local-state")
+	return flag != nil && flag.Value.String() != ""
+}
+
+// colorOutput reports whether progress goes to a terminal and NO_COLOR is
+// unset.
+func colorOutput() bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	out, ok := output.Progress().(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := out.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
 }
 
 func resolveTerraform(ctx context.Context, cmd *cobra.Command, stackPaths []string) (*versioning.ResolveResult, error) {
@@ -148,6 +542,9 @@ func resolveTerraform(ctx context.Context, cmd *cobra.Command, stackPaths []stri
 		return nil, fmt.Errorf("no stacks provided for Terraform resolution")
 	}
 
+	if err := verifyStateBucket(ctx, cmd); err != nil {
+		return nil, err
+	}
 	pinned, err := parsePinnedVersion()
 	if err != nil {
 		return nil, err
@@ -156,15 +553,26 @@ func resolveTerraform(ctx context.Context, cmd *cobra.Command, stackPaths []stri
 	opts := versioning.ResolveOptions{
 		RootDir:        rootDir,
 		StackPaths:     stackPaths,
-		Stdout:         cmd.OutOrStdout(),
+		Stdout:         output.Progress(),
 		Stderr:         cmd.ErrOrStderr(),
 		ForceInstall:   envBool("TFWRAPPER_FORCE_INSTALL"),
 		UseSystemOnly:  envBool("TFWRAPPER_USE_SYSTEM_TERRAFORM"),
 		DisableInstall: envBool("TFWRAPPER_DISABLE_INSTALL"),
 		PinnedVersion:  pinned,
+		Engine:         engine,
+		ReleasesMirror: releasesMirror,
 	}
 
-	return versioning.ResolveTerraformBinary(ctx, opts)
+	res, err := versioning.ResolveTerraformBinary(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if execDocker != "" {
+		if err := useDockerTerraform(cmd, res); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
 }
 
 func graphStackPaths(g graph.Graph) []string {
@@ -225,6 +633,9 @@ func loadGraphData() (graph.Graph, map[string]*graph.Stack, error) {
 	if err != nil {
 		return nil, nil, err
 	}
+	if g, err = gateByFeatureFlags(g, rootAbs); err != nil {
+		return nil, nil, err
+	}
 	idx := make(map[string]*graph.Stack)
 	for path, stack := range g {
 		rel, err := filepathRelSafe(rootDir, path)
@@ -233,9 +644,90 @@ func loadGraphData() (graph.Graph, map[string]*graph.Stack, error) {
 		}
 		idx[rel] = stack
 	}
+	warnUndeclaredDependencies(idx)
+	graph.ResolveRegionVariables(g, func(stackDir string) []string {
+		return append(stacks.VarFiles(rootAbs, stackDir, environment, profile), extraVarFiles...)
+	})
+	warnDisallowedRegions(idx)
 	return g, idx, nil
 }
 
+// gateByFeatureFlags drops the stacks whose feature flag is off in the
+// environment's flags file, and their dependents, reporting each on stderr.
+func gateByFeatureFlags(g graph.Graph, rootAbs string) (graph.Graph, error) {
+	flags, err := featureflags.Load(rootAbs, environment)
+	if err != nil {
+		return nil, err
+	}
+	gated, removed := g.Gate(flags.Enabled)
+	paths := make([]string, 0, len(removed))
+	for path := range removed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		gate := removed[path]
+		if gate.Via == "" {
+			fmt.Fprintf(os.Stderr, "[flags] skipping %s: feature flag %s is off\n", relOrPath(path), gate.Flag)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "[flags] skipping %s: depends on %s, whose feature flag %s is off\n", relOrPath(path), relOrPath(gate.Via), gate.Flag)
+	}
+	return gated, nil
+}
+
+// warnUndeclaredDependencies reports edges inferred from terraform_remote_state
+// data sources that are missing from dependencies.json. Warnings go to stderr
+// so commands such as graph keep stdout machine-readable.
+func warnUndeclaredDependencies(idx map[string]*graph.Stack) {
+	rels := make([]string, 0, len(idx))
+	for rel := range idx {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	for _, rel := range rels {
+		for _, dep := range idx[rel].Inferred {
+			depRel, err := filepathRelSafe(rootDir, dep)
+			if err != nil {
+				depRel = dep
+			}
+			fmt.Fprintf(os.Stderr, "[graph] warning: %s reads the remote state of %s but its dependencies.json does not declare it; treating it as a dependency\n", rel, depRel)
+		}
+	}
+}
+
+// warnDisallowedRegions reports aws providers that target a region outside
+// the environment's allowed_regions. Regions that cannot be determined
+// statically are not checked.
+func warnDisallowedRegions(idx map[string]*graph.Stack) {
+	if len(allowedRegions) == 0 {
+		return
+	}
+	rels := make([]string, 0, len(idx))
+	for rel := range idx {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	for _, rel := range rels {
+		for _, pr := range idx[rel].Regions {
+			if pr.Region == "" || slices.Contains(allowedRegions, pr.Region) {
+				continue
+			}
+			provider := "aws"
+			if pr.Alias != "" {
+				provider += "." + pr.Alias
+			}
+			fmt.Fprintf(os.Stderr, "[graph] warning: %s provider %s targets region %s, which is not allowed for environment %s (allowed: %s)\n",
+				rel, provider, pr.Region, environment, strings.Join(allowedRegions, ", "))
+		}
+	}
+}
+
+// registerKeepGoingFlag adds --keep-going to a command that runs many stacks.
+func registerKeepGoingFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&keepGoing, "keep-going", false, "after a stack fails, skip only the stacks that depend on it and keep running the rest")
+}
+
 func resolveStackArg(g graph.Graph, index map[string]*graph.Stack, input string) (*graph.Stack, string, error) {
 	if input == "" {
 		return nil, "", fmt.Errorf("--stack is required")
@@ -263,3 +755,75 @@ func resolveStackArg(g graph.Graph, index map[string]*graph.Stack, input string)
 	}
 	return nil, "", fmt.Errorf("stack %q not found", input)
 }
+
+// resolveExtraVarFiles makes the --extra-var-file paths absolute, so every
+// stack reads the same files, and checks that they exist.
+func resolveExtraVarFiles() error {
+	for i, path := range extraVarFiles {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(abs)
+		if err != nil {
+			return fmt.Errorf("--extra-var-file: %w", err)
+		}
+		if info.IsDir() {
+			return fmt.Errorf("--extra-var-file: %s is a directory", path)
+		}
+		extraVarFiles[i] = abs
+	}
+	return nil
+}
+
+// configureLogging sets up the wrapper's log lines from --log-level, --quiet
+// and --stack-logs.
+func configureLogging() error {
+	level, err := logging.ParseLevel(logLevel)
+	if err != nil {
+		return fmt.Errorf("--log-level: %w", err)
+	}
+	if quiet && level < logging.LevelWarn {
+		level = logging.LevelWarn
+	}
+	opts := logging.Options{Level: level, Stdout: output.Progress()}
+	if stackLogs {
+		opts.StackLogDir = runLogDir
+	}
+	logging.Configure(opts)
+	return nil
+}
+
+// configureOutputMode applies --output-mode. Stream mode is --verbose; group
+// mode buffers each stack's terraform output until the stack finishes.
+func configureOutputMode() error {
+	mode, err := output.ParseMode(outputMode)
+	if err != nil {
+		return err
+	}
+	switch mode {
+	case output.ModeStream:
+		verbose = true
+	case output.ModeGroup:
+		if verbose {
+			return fmt.Errorf("--verbose cannot be combined with --output-mode %s", output.ModeGroup)
+		}
+		outputGroup = output.NewGroup()
+	}
+	return nil
+}
+
+// configureOutput switches to NDJSON progress events. Stdout is reserved for
+// the event stream and the command's results, so progress goes to stderr.
+func configureOutput(format string) error {
+	parsed, err := output.ParseFormat(format)
+	if err != nil {
+		return err
+	}
+	if parsed != output.FormatJSON || eventWriter != nil {
+		return nil
+	}
+	eventWriter = os.Stdout
+	output.SetProgress(os.Stderr)
+	return nil
+}
@@ -0,0 +1,134 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"terraform-wrapper/internal/executor"
+	"terraform-wrapper/internal/lock"
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/runs"
+)
+
+func newRunCommand() *cobra.Command {
+	var (
+		pipeline   string
+		waitLock   bool
+		filter     stackFilter
+		releaseSet releaseFlags
+	)
+	cmd := &cobra.Command{
+		Use:   "run",
+		Short: "Run a pipeline of operations on every stack in dependency order",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := contextWithCmd(cmd)
+			steps, err := executor.ParsePipeline(pipeline)
+			if err != nil {
+				return fmt.Errorf("--pipeline: %w", err)
+			}
+			applies := executor.HasStep(steps, executor.StepApply)
+			if applies {
+				if err := enforceIdentity(ctx, "run"); err != nil {
+					return err
+				}
+			}
+
+			if err := releaseSet.prepare(ctx); err != nil {
+				return err
+			}
+			full, _, err := loadGraphData()
+			if err != nil {
+				return err
+			}
+			g, err := filter.apply(full)
+			if err != nil {
+				return err
+			}
+			if g, err = releaseSet.apply(ctx, g, "run --pipeline "+pipeline); err != nil {
+				return err
+			}
+
+			res, err := resolveTerraform(ctx, cmd, graphStackPaths(g))
+			if err != nil {
+				return err
+			}
+			resolvedVersion := ""
+			if res.Version != nil {
+				resolvedVersion = res.Version.String()
+			}
+
+			opts := executorOptions(res.BinaryPath, resolvedVersion)
+			if applies || executor.HasStep(steps, executor.StepPolicy) {
+				if err := attachPolicyGate(cmd, &opts); err != nil {
+					return err
+				}
+				if opts.Policy == nil && executor.HasStep(steps, executor.StepPolicy) {
+					return fmt.Errorf("the policy step needs policies in --policy-dir")
+				}
+			}
+
+			var run *runs.Record
+			if applies {
+				if err := enforceFreeze(ctx, "run"); err != nil {
+					return err
+				}
+				client, err := stateBucketClient(ctx)
+				if err != nil {
+					return err
+				}
+				orchestration := &lock.OrchestrationLock{
+					Bucket:    stateBucketFor(accountID),
+					Env:       environment,
+					Workspace: workspace,
+					Tenant:    tenantName,
+					Command:   "run --pipeline " + pipeline,
+					CallerARN: operatorARN(ctx),
+					Client:    client,
+				}
+				if err := orchestration.Acquire(ctx, waitLock, false); err != nil {
+					return err
+				}
+				defer func() {
+					if err := orchestration.Release(ctx); err != nil {
+						output.Printf("[run] warning: %v\n", err)
+					}
+				}()
+
+				run, _, err = beginRun(ctx, "run", "")
+				if err != nil {
+					return err
+				}
+				if err := attachExporter(ctx, &opts, graphStacks(g)...); err != nil {
+					return err
+				}
+				attachPropagator(&opts, full)
+				if err := attachStateTagger(ctx, &opts, run.ID, run.GitSHA); err != nil {
+					return err
+				}
+			} else {
+				runIdentity(ctx, "run")
+			}
+
+			summary, err := executor.RunPipeline(ctx, g, opts, steps)
+			if recErr := finishRun(run, summary, err); recErr != nil {
+				output.Printf("[run] warning: %v\n", recErr)
+			}
+			if err != nil {
+				return failRun("run", summary, err)
+			}
+			printSummary("run", summary)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&pipeline, "pipeline", "init,validate,plan,apply", "comma-separated steps to run on each stack, in order: init, validate, plan, policy, apply")
+	cmd.Flags().BoolVar(&waitLock, "wait-lock", false, "wait for the orchestration lock instead of failing when another run holds it")
+	cmd.Flags().StringVar(&breakFreeze, "break-freeze", "", "reason for overriding an active change freeze")
+	filter.register(cmd)
+	releaseSet.register(cmd)
+	cmd.MarkFlagsMutuallyExclusive("manifest", "only")
+	cmd.MarkFlagsMutuallyExclusive("manifest", "exclude")
+	registerPolicyFlags(cmd)
+	registerKeepGoingFlag(cmd)
+	return cmd
+}
@@ -0,0 +1,160 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"terraform-wrapper/internal/audit"
+	"terraform-wrapper/internal/executor"
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/runs"
+	"terraform-wrapper/internal/statelayout"
+)
+
+// beginRun assigns the run identity and, when an idempotency key is supplied,
+// loads the record of a previous identical run so completed stacks can be skipped.
+func beginRun(ctx context.Context, operation, idempotencyKey string) (*runs.Record, *runs.Record, error) {
+	sha := runs.GitSHA(ctx, rootDir)
+	rec := &runs.Record{
+		ID:             runs.NewID(envScope(), sha, operation, idempotencyKey),
+		Environment:    environment,
+		Tenant:         tenantName,
+		Operation:      operation,
+		GitSHA:         sha,
+		IdempotencyKey: idempotencyKey,
+		Actor:          audit.Actor(),
+		CallerARN:      operatorARN(ctx),
+		Status:         runs.StatusRunning,
+		StartedAt:      time.Now().UTC(),
+		ExtraVarFiles:  extraVarFiles,
+	}
+	output.Printf("[run] id=%s operation=%s actor=%s\n", rec.ID, operation, rec.Actor)
+	if rec.CallerARN != "" {
+		output.Printf("[run] caller=%s\n", rec.CallerARN)
+	}
+	runWorkdir.SetRunID(rec.ID)
+
+	if idempotencyKey == "" {
+		return rec, nil, nil
+	}
+
+	previous, err := runs.Load(rootDir, envScope(), rec.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if previous != nil {
+		rec.StartedAt = previous.StartedAt
+		rec.MarkCompleted(previous.Completed...)
+		output.Printf("[run] found previous run %s (%s); %d stacks already completed\n", previous.ID, previous.Status, len(previous.Completed))
+	}
+	return rec, previous, nil
+}
+
+// attachCheckpoint writes a completion marker to the state bucket for every
+// stack the run finishes. With an idempotency key, stacks marked done by an
+// earlier attempt on any machine are skipped as well.
+func attachCheckpoint(ctx context.Context, opts *executor.Options, rec *runs.Record) error {
+	client, err := stateBucketClient(ctx)
+	if err != nil {
+		return err
+	}
+	markers := &runs.Markers{
+		Client:      client,
+		Bucket:      stateBucketFor(accountID),
+		Environment: rec.Environment,
+		RunID:       rec.ID,
+	}
+	opts.Checkpoint = markers
+
+	if rec.IdempotencyKey == "" {
+		return nil
+	}
+	done, err := markers.Completed(ctx)
+	if err != nil {
+		return err
+	}
+	if len(done) == 0 {
+		return nil
+	}
+	if opts.CompletedStacks == nil {
+		opts.CompletedStacks = make(map[string]struct{}, len(done))
+	}
+	for _, stack := range done {
+		opts.CompletedStacks[stack] = struct{}{}
+	}
+	rec.MarkCompleted(done...)
+	output.Printf("[run] %d stacks marked completed in s3://%s/%s\n", len(done), markers.Bucket, runs.MarkerPrefix(rec.Environment, rec.ID))
+	return nil
+}
+
+// attachStateTagger tags the state object of every stack the run applies with
+// the run ID, git SHA, actor and time of the apply.
+func attachStateTagger(ctx context.Context, opts *executor.Options, runID, gitSHA string) error {
+	client, err := stateBucketClient(ctx)
+	if err != nil {
+		return err
+	}
+	rootAbs, err := filepath.Abs(rootDir)
+	if err != nil {
+		return err
+	}
+	keyPattern, err := statelayout.KeyPattern(rootAbs, environment)
+	if err != nil {
+		return err
+	}
+	naming, err := stateBackend.Naming()
+	if err != nil {
+		return err
+	}
+	opts.StateTagger = &runs.StateTagger{
+		Client:                client,
+		Bucket:                stateBucketFor(accountID),
+		Environment:           environment,
+		Workspace:             workspace,
+		RunID:                 runID,
+		GitSHA:                gitSHA,
+		Actor:                 audit.Actor(),
+		Root:                  rootAbs,
+		KeyPattern:            keyPattern,
+		Naming:                naming,
+		EnvironmentWorkspaces: stateBackend != nil && stateBackend.EnvironmentWorkspaces,
+	}
+	return nil
+}
+
+// runIdentity derives the run ID and git SHA for commands that do not keep a
+// run record.
+func runIdentity(ctx context.Context, operation string) (string, string) {
+	sha := runs.GitSHA(ctx, rootDir)
+	id := runs.NewID(envScope(), sha, operation, "")
+	runWorkdir.SetRunID(id)
+	return id, sha
+}
+
+// finishRun records the outcome of the run so a retry can pick up where it left off.
+func finishRun(rec *runs.Record, summary *executor.Summary, runErr error) error {
+	if rec == nil {
+		return nil
+	}
+	runFinished = true
+	if summary != nil {
+		rec.MarkCompleted(summary.Completed...)
+		if len(summary.Failed) > 0 {
+			rec.Failed = make(map[string]string, len(summary.Failed))
+			for stack, err := range summary.Failed {
+				rec.Failed[stack] = err.Error()
+			}
+		}
+	}
+	rec.Status = runs.StatusSucceeded
+	if runErr != nil {
+		rec.Status = runs.StatusFailed
+	}
+	rec.FinishedAt = time.Now().UTC()
+	if err := runs.Save(rootDir, rec); err != nil {
+		return fmt.Errorf("save run record: %w", err)
+	}
+	return nil
+}
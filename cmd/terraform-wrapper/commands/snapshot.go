@@ -0,0 +1,164 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"terraform-wrapper/internal/graph"
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/snapshot"
+	"terraform-wrapper/internal/stacks"
+)
+
+var (
+	snapshotDir   string
+	snapshotStack string
+)
+
+func newSnapshotCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Store each stack's normalized plan as a golden file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := contextWithCmd(cmd)
+			targets, err := snapshotTargets()
+			if err != nil {
+				return err
+			}
+			opts, err := snapshotOptions(ctx, cmd, targets)
+			if err != nil {
+				return err
+			}
+			results, err := snapshot.Take(ctx, targets, opts)
+			if err != nil {
+				return err
+			}
+			failed := 0
+			for _, result := range results {
+				if result.Err != nil {
+					failed++
+					fmt.Fprintf(os.Stderr, "[snapshot] %s: %v\n", result.Stack, result.Err)
+					continue
+				}
+				output.Printf("[snapshot] %s: written\n", result.Stack)
+			}
+			if failed > 0 {
+				return fmt.Errorf("snapshot failed for %d stacks", failed)
+			}
+			output.Printf("[snapshot] %d snapshots written to %s\n", len(results), snapshotDir)
+			return nil
+		},
+	}
+	cmd.PersistentFlags().StringVar(&snapshotDir, "dir", "snapshots", "directory holding the golden files, relative to --root")
+	cmd.PersistentFlags().StringVar(&snapshotStack, "stack", "", "only snapshot this stack (name or path)")
+	cmd.AddCommand(newSnapshotVerifyCommand())
+	return cmd
+}
+
+func newSnapshotVerifyCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify",
+		Short: "Fail when any stack's plan differs from its golden file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := contextWithCmd(cmd)
+			targets, err := snapshotTargets()
+			if err != nil {
+				return err
+			}
+			opts, err := snapshotOptions(ctx, cmd, targets)
+			if err != nil {
+				return err
+			}
+			results, err := snapshot.Verify(ctx, targets, opts)
+			if err != nil {
+				return err
+			}
+
+			var mismatched []string
+			failed := 0
+			for _, result := range results {
+				switch {
+				case result.Err != nil:
+					failed++
+					fmt.Fprintf(os.Stderr, "[snapshot] %s: %v\n", result.Stack, result.Err)
+				case result.Missing:
+					mismatched = append(mismatched, result.Stack)
+					output.Printf("[snapshot] %s: no snapshot; run snapshot to record one\n", result.Stack)
+				case len(result.Changes) > 0:
+					mismatched = append(mismatched, result.Stack)
+					output.Printf("[snapshot] %s: plan differs from snapshot\n", result.Stack)
+					for _, change := range result.Changes {
+						output.Printf("[snapshot]   %s\n", change)
+					}
+				default:
+					output.Printf("[snapshot] %s: matches\n", result.Stack)
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("snapshot verification failed for %d stacks", failed)
+			}
+			if len(mismatched) > 0 {
+				return fmt.Errorf("plans differ from snapshots in %d stacks: %s", len(mismatched), strings.Join(mismatched, ", "))
+			}
+			output.Printf("[snapshot] %d stacks match their snapshots\n", len(results))
+			return nil
+		},
+	}
+}
+
+func snapshotTargets() ([]*graph.Stack, error) {
+	g, index, err := loadGraphData()
+	if err != nil {
+		return nil, err
+	}
+	if snapshotStack == "" {
+		return graphStacks(g), nil
+	}
+	stack, _, err := resolveStackArg(g, index, snapshotStack)
+	if err != nil {
+		return nil, err
+	}
+	return []*graph.Stack{stack}, nil
+}
+
+func snapshotOptions(ctx context.Context, cmd *cobra.Command, targets []*graph.Stack) (snapshot.Options, error) {
+	paths := make([]string, 0, len(targets))
+	for _, stack := range targets {
+		paths = append(paths, stack.Path)
+	}
+	res, err := resolveTerraform(ctx, cmd, paths)
+	if err != nil {
+		return snapshot.Options{}, err
+	}
+
+	runner, err := stacks.NewRunner(ctx, stacks.RunnerOptions{
+		RootDir:       rootDir,
+		Environment:   environment,
+		AccountID:     accountID,
+		Region:        region,
+		TerraformPath: res.BinaryPath,
+		Profile:       profile,
+		Workspace:     workspace,
+		StateKMSKeyID: stateKMSKeyID,
+		StateBackend:  stateBackend,
+		AssumeRoleARN: assumeRoleARN,
+		Retry:         retryPolicy,
+		TFLog:         tfLog,
+		TFLogDir:      runLogDir,
+		ExtraVarFiles: extraVarFiles,
+	})
+	if err != nil {
+		return snapshot.Options{}, err
+	}
+	return snapshot.Options{
+		RootDir:     rootDir,
+		Environment: environment,
+		Dir:         snapshotDir,
+		Parallelism: parallelism,
+		Planner:     runner,
+	}, nil
+}
@@ -0,0 +1,485 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"terraform-wrapper/internal/audit"
+	"terraform-wrapper/internal/lock"
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/stacks"
+	"terraform-wrapper/internal/statekms"
+	"terraform-wrapper/internal/statepatch"
+	"terraform-wrapper/internal/wrapperconfig"
+)
+
+func newStateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "state",
+		Short: "Manage remote state objects for an environment",
+	}
+	cmd.AddCommand(newStateRotateKMSCommand())
+	cmd.AddCommand(newStatePatchCommand())
+	cmd.AddCommand(newStateMoveStackCommand())
+	cmd.AddCommand(newStateListCommand())
+	cmd.AddCommand(newStateShowCommand())
+	cmd.AddCommand(newStateBackupCommand())
+	cmd.AddCommand(newStateRestoreCommand())
+	cmd.AddCommand(newStateExportCommand())
+	return cmd
+}
+
+func newStateRotateKMSCommand() *cobra.Command {
+	var (
+		newKey string
+		dryRun bool
+	)
+	cmd := &cobra.Command{
+		Use:   "rotate-kms",
+		Short: "Re-encrypt every state object of the environment with a new SSE-KMS key",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := contextWithCmd(cmd)
+			if !strings.HasPrefix(newKey, "arn:") {
+				return fmt.Errorf("--new-key must be a KMS key ARN")
+			}
+			if err := checkRotateKMSLayout(); err != nil {
+				return err
+			}
+
+			client, err := stateBucketClient(ctx)
+			if err != nil {
+				return err
+			}
+			bucket := stateBucketFor(accountID)
+
+			keys, err := statekms.StateKeys(ctx, client, bucket, environment)
+			if err != nil {
+				return err
+			}
+			if len(keys) == 0 {
+				return fmt.Errorf("no state objects found under s3://%s/%s/", bucket, environment)
+			}
+			output.Printf("[state] %d state objects in s3://%s/%s/\n", len(keys), bucket, environment)
+			if dryRun {
+				for _, key := range keys {
+					output.Printf("[state] would re-encrypt %s\n", key)
+				}
+				return nil
+			}
+
+			orchestration := &lock.OrchestrationLock{
+				Bucket:    bucket,
+				Env:       environment,
+				Command:   "state rotate-kms",
+				CallerARN: operatorARN(ctx),
+				Client:    client,
+			}
+			if err := orchestration.Acquire(ctx, false, false); err != nil {
+				return err
+			}
+			defer func() {
+				if err := orchestration.Release(ctx); err != nil {
+					output.Printf("[state] warning: %v\n", err)
+				}
+			}()
+
+			rotated := 0
+			for i, key := range keys {
+				result, err := statekms.Rotate(ctx, client, bucket, key, newKey)
+				if err != nil {
+					return fmt.Errorf("rotation stopped after %d of %d objects: %w", i, len(keys), err)
+				}
+				status := "re-encrypted and verified"
+				if result.Skipped {
+					status = "already uses the new key"
+				} else {
+					rotated++
+				}
+				output.Printf("[state] (%d/%d) %s: %s\n", i+1, len(keys), key, status)
+			}
+
+			if err := statekms.SaveKeyID(rootDir, environment, newKey); err != nil {
+				return fmt.Errorf("record new key: %w", err)
+			}
+			output.Printf("[state] %s now encrypts %s state with %s; commit it so backend configuration picks up the key\n", statekms.ConfigFile, environment, newKey)
+
+			return auditTrail(client).Record(ctx, audit.Entry{
+				Action: "rotate-state-kms",
+				Details: map[string]string{
+					"kms_key_id": newKey,
+					"objects":    fmt.Sprint(len(keys)),
+					"rotated":    fmt.Sprint(rotated),
+				},
+			})
+		},
+	}
+	cmd.Flags().StringVar(&newKey, "new-key", "", "ARN of the KMS key to encrypt state with")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "list the state objects that would be re-encrypted")
+	_ = cmd.MarkFlagRequired("new-key")
+	return cmd
+}
+
+// checkRotateKMSLayout refuses to rotate when some state is not stored under
+// <env>/ in the state bucket, where rotate-kms finds the objects to rotate.
+func checkRotateKMSLayout() error {
+	if stateBackend != nil && stateBackend.KeyTemplate != "" {
+		return fmt.Errorf("state rotate-kms re-encrypts the objects under %s/, but %s names keys with key_template", environment, wrapperconfig.FileName)
+	}
+	if stateBackend != nil && stateBackend.EnvironmentWorkspaces {
+		return fmt.Errorf("state rotate-kms re-encrypts the objects under %s/, but %s keeps state in Terraform workspaces under %s/", environment, wrapperconfig.FileName, stacks.S3WorkspaceKeyPrefix)
+	}
+	g, _, err := loadGraphData()
+	if err != nil {
+		return err
+	}
+	for _, path := range graphStackPaths(g) {
+		settings, err := stacks.LoadBackendSettings(path)
+		if err != nil {
+			return err
+		}
+		if settings == nil || (settings.Type != "" && settings.Type != stacks.BackendS3) {
+			continue
+		}
+		if settings.BucketTemplate != "" || settings.KeyTemplate != "" || settings.EnvironmentWorkspaces {
+			return fmt.Errorf("state rotate-kms re-encrypts the objects under %s/ of the state bucket, but %s stores its state elsewhere", environment, filepath.Join(path, stacks.BackendFileName))
+		}
+	}
+	return nil
+}
+
+func newStatePatchCommand() *cobra.Command {
+	var (
+		stackArg    string
+		patchPath   string
+		dryRun      bool
+		autoApprove bool
+	)
+	cmd := &cobra.Command{
+		Use:   "patch",
+		Short: "Apply a JSON patch (RFC 6902) to a stack's remote state",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := contextWithCmd(cmd)
+			data, err := os.ReadFile(patchPath)
+			if err != nil {
+				return fmt.Errorf("read patch: %w", err)
+			}
+			ops, err := statepatch.Parse(data)
+			if err != nil {
+				return err
+			}
+
+			g, index, err := loadGraphData()
+			if err != nil {
+				return err
+			}
+			stack, rel, err := resolveStackArg(g, index, stackArg)
+			if err != nil {
+				return err
+			}
+			res, err := resolveTerraform(ctx, cmd, []string{stack.Path})
+			if err != nil {
+				return err
+			}
+			runner, err := stacks.NewRunner(ctx, stacks.RunnerOptions{
+				RootDir:       rootDir,
+				Environment:   environment,
+				AccountID:     accountID,
+				Region:        region,
+				TerraformPath: res.BinaryPath,
+				Profile:       profile,
+				Workspace:     workspace,
+				StateKMSKeyID: stateKMSKeyID,
+				StateBackend:  stateBackend,
+				AssumeRoleARN: assumeRoleARN,
+				Retry:         retryPolicy,
+				TFLog:         tfLog,
+				TFLogDir:      runLogDir,
+				ExtraVarFiles: extraVarFiles,
+			})
+			if err != nil {
+				return err
+			}
+
+			state, err := runner.PullState(ctx, stack.Path)
+			if err != nil {
+				return fmt.Errorf("read state of %s: %w", rel, err)
+			}
+			if strings.TrimSpace(string(state)) == "" {
+				return fmt.Errorf("%s has no state to patch", rel)
+			}
+			result, err := statepatch.Prepare(state, ops)
+			if err != nil {
+				return fmt.Errorf("patch state of %s: %w", rel, err)
+			}
+			if len(result.Changes) == 0 {
+				output.Printf("[state] the patch does not change the state of %s\n", rel)
+				return nil
+			}
+			output.Printf("[state] %s: %d changes, serial %d -> %d\n", rel, len(result.Changes), result.Serial-1, result.Serial)
+			for _, change := range result.Changes {
+				output.Printf("  %s\n", change)
+			}
+			if dryRun {
+				return nil
+			}
+
+			if err := enforceFreeze(ctx, "state patch"); err != nil {
+				return err
+			}
+			if !autoApprove {
+				ok, err := confirmStatePush(fmt.Sprintf("Push the patched state of %s?", rel))
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return fmt.Errorf("state patch of %s cancelled", rel)
+				}
+			}
+
+			stackRel, err := filepathRelSafe(rootDir, stack.Path)
+			if err != nil {
+				return err
+			}
+			backup := stacks.StatePatchBackupPath(rootDir, environment, workspace, stackRel, time.Now())
+			if err := os.MkdirAll(filepath.Dir(backup), 0o700); err != nil {
+				return fmt.Errorf("create state backup directory: %w", err)
+			}
+			if err := os.WriteFile(backup, state, 0o600); err != nil {
+				return fmt.Errorf("back up state: %w", err)
+			}
+			output.Printf("[state] saved the current state of %s to %s\n", rel, relOrPath(backup))
+
+			patched := filepath.Join(filepath.Dir(backup), "patched.tfstate")
+			if err := os.WriteFile(patched, result.State, 0o600); err != nil {
+				return fmt.Errorf("write patched state: %w", err)
+			}
+			defer os.Remove(patched)
+			if err := runner.PushState(ctx, stack.Path, patched); err != nil {
+				return fmt.Errorf("%s: %w", rel, err)
+			}
+			output.Printf("[state] pushed the patched state of %s (serial %d)\n", rel, result.Serial)
+
+			client, err := stateBucketClient(ctx)
+			if err != nil {
+				return err
+			}
+			return auditTrail(client).Record(ctx, audit.Entry{
+				Action: "state-patch",
+				Details: map[string]string{
+					"stack":   rel,
+					"patch":   patchPath,
+					"backup":  relOrPath(backup),
+					"serial":  fmt.Sprint(result.Serial),
+					"changes": fmt.Sprint(len(result.Changes)),
+				},
+			})
+		},
+	}
+	cmd.Flags().StringVar(&stackArg, "stack", "", "stack name or path")
+	cmd.Flags().StringVar(&patchPath, "patch", "", "JSON patch file to apply to the stack's state")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print the changes the patch makes without pushing the state")
+	cmd.Flags().BoolVar(&autoApprove, "auto-approve", false, "push the patched state without asking for confirmation")
+	cmd.Flags().StringVar(&breakFreeze, "break-freeze", "", "reason for overriding an active change freeze")
+	_ = cmd.MarkFlagRequired("stack")
+	_ = cmd.MarkFlagRequired("patch")
+	return cmd
+}
+
+func confirmStatePush(question string) (bool, error) {
+	output.Printf("%s Only 'yes' will be accepted: ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false, fmt.Errorf("read confirmation: %w", err)
+	}
+	return strings.TrimSpace(answer) == "yes", nil
+}
+
+func newStateMoveStackCommand() *cobra.Command {
+	var (
+		fromArg     string
+		toArg       string
+		address     string
+		toAddress   string
+		dryRun      bool
+		autoApprove bool
+	)
+	cmd := &cobra.Command{
+		Use:   "mv-stack",
+		Short: "Move a resource or module from one stack's remote state to another's",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := contextWithCmd(cmd)
+			if toAddress == "" {
+				toAddress = address
+			}
+			g, index, err := loadGraphData()
+			if err != nil {
+				return err
+			}
+			from, fromRel, err := resolveStackArg(g, index, fromArg)
+			if err != nil {
+				return err
+			}
+			to, toRel, err := resolveStackArg(g, index, toArg)
+			if err != nil {
+				return err
+			}
+			if from.Path == to.Path {
+				return fmt.Errorf("--from and --to are both %s; use terraform state mv within one stack", fromRel)
+			}
+			res, err := resolveTerraform(ctx, cmd, []string{from.Path, to.Path})
+			if err != nil {
+				return err
+			}
+			runner, err := stacks.NewRunner(ctx, stacks.RunnerOptions{
+				RootDir:       rootDir,
+				Environment:   environment,
+				AccountID:     accountID,
+				Region:        region,
+				TerraformPath: res.BinaryPath,
+				Profile:       profile,
+				Workspace:     workspace,
+				StateKMSKeyID: stateKMSKeyID,
+				StateBackend:  stateBackend,
+				AssumeRoleARN: assumeRoleARN,
+				Retry:         retryPolicy,
+				TFLog:         tfLog,
+				TFLogDir:      runLogDir,
+				ExtraVarFiles: extraVarFiles,
+			})
+			if err != nil {
+				return err
+			}
+
+			fromState, err := runner.PullState(ctx, from.Path)
+			if err != nil {
+				return fmt.Errorf("read state of %s: %w", fromRel, err)
+			}
+			toState, err := runner.PullState(ctx, to.Path)
+			if err != nil {
+				return fmt.Errorf("read state of %s: %w", toRel, err)
+			}
+			result, err := statepatch.Move(fromState, toState, address, toAddress)
+			if err != nil {
+				return fmt.Errorf("move from %s to %s: %w", fromRel, toRel, err)
+			}
+			output.Printf("[state] moving from %s (serial %d) to %s (serial %d):\n", fromRel, result.SourceSerial, toRel, result.DestinationSerial)
+			for _, moved := range result.Moved {
+				output.Printf("  %s\n", moved)
+			}
+			if dryRun {
+				return nil
+			}
+
+			if err := enforceFreeze(ctx, "state mv-stack"); err != nil {
+				return err
+			}
+			if !autoApprove {
+				ok, err := confirmStatePush(fmt.Sprintf("Push the states of %s and %s?", fromRel, toRel))
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return fmt.Errorf("state move from %s to %s cancelled", fromRel, toRel)
+				}
+			}
+
+			now := time.Now()
+			fromBackup, err := backUpStateForMove(from.Path, fromState, now)
+			if err != nil {
+				return err
+			}
+			toBackup, err := backUpStateForMove(to.Path, toState, now)
+			if err != nil {
+				return err
+			}
+
+			// The destination is pushed first: should the source push fail,
+			// the resources are briefly in both states rather than in neither.
+			if err := pushStateFile(ctx, runner, to.Path, result.Destination); err != nil {
+				return fmt.Errorf("%s: %w; neither state was changed", toRel, err)
+			}
+			output.Printf("[state] pushed the state of %s (serial %d)\n", toRel, result.DestinationSerial)
+			if err := pushStateFile(ctx, runner, from.Path, result.Source); err != nil {
+				if rbErr := pushStateFile(ctx, runner, to.Path, result.Rollback); rbErr != nil {
+					return fmt.Errorf("%s: %w; restoring %s also failed (%v), so the moved resources are in both states: push %s to %s to undo the move", fromRel, err, toRel, rbErr, relOrPath(toBackup), toRel)
+				}
+				return fmt.Errorf("%s: %w; the state of %s was restored", fromRel, err, toRel)
+			}
+			output.Printf("[state] pushed the state of %s (serial %d)\n", fromRel, result.SourceSerial)
+
+			client, err := stateBucketClient(ctx)
+			if err != nil {
+				return err
+			}
+			return auditTrail(client).Record(ctx, audit.Entry{
+				Action: "state-mv-stack",
+				Details: map[string]string{
+					"from":        fromRel,
+					"to":          toRel,
+					"address":     address,
+					"to_address":  toAddress,
+					"resources":   fmt.Sprint(len(result.Moved)),
+					"from_backup": relOrPath(fromBackup),
+					"to_backup":   relOrPath(toBackup),
+				},
+			})
+		},
+	}
+	cmd.Flags().StringVar(&fromArg, "from", "", "stack to move the resources out of (name or path)")
+	cmd.Flags().StringVar(&toArg, "to", "", "stack to move the resources into (name or path)")
+	cmd.Flags().StringVar(&address, "address", "", "resource or module address to move, e.g. aws_vpc.main or module.peering")
+	cmd.Flags().StringVar(&toAddress, "to-address", "", "address in the destination stack (default: --address)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print what would move without pushing either state")
+	cmd.Flags().BoolVar(&autoApprove, "auto-approve", false, "push the states without asking for confirmation")
+	cmd.Flags().StringVar(&breakFreeze, "break-freeze", "", "reason for overriding an active change freeze")
+	_ = cmd.MarkFlagRequired("from")
+	_ = cmd.MarkFlagRequired("to")
+	_ = cmd.MarkFlagRequired("address")
+	return cmd
+}
+
+// backUpStateForMove saves the pulled state of stackDir before state
+// mv-stack pushes it, and returns the backup's path. A stack without state
+// has nothing to save.
+func backUpStateForMove(stackDir string, state []byte, at time.Time) (string, error) {
+	stackRel, err := filepathRelSafe(rootDir, stackDir)
+	if err != nil {
+		return "", err
+	}
+	backup := stacks.StateMoveBackupPath(rootDir, environment, workspace, stackRel, at)
+	if strings.TrimSpace(string(state)) == "" {
+		return backup, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(backup), 0o700); err != nil {
+		return "", fmt.Errorf("create state backup directory: %w", err)
+	}
+	if err := os.WriteFile(backup, state, 0o600); err != nil {
+		return "", fmt.Errorf("back up state: %w", err)
+	}
+	output.Printf("[state] saved the current state of %s to %s\n", filepath.ToSlash(stackRel), relOrPath(backup))
+	return backup, nil
+}
+
+// pushStateFile pushes state as the remote state of the initialised stackDir.
+func pushStateFile(ctx context.Context, runner *stacks.Runner, stackDir string, state []byte) error {
+	f, err := os.CreateTemp("", "terraform-wrapper-*.tfstate")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(state); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("write state: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return runner.PushState(ctx, stackDir, f.Name())
+}
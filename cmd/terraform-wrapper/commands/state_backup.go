@@ -0,0 +1,335 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/spf13/cobra"
+
+	"terraform-wrapper/internal/audit"
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/stacks"
+	"terraform-wrapper/internal/statebackup"
+	"terraform-wrapper/internal/statepatch"
+	"terraform-wrapper/internal/superplan"
+)
+
+// stateBackupStore returns the store of the environment's state backups, kept
+// in its state bucket beside the state itself.
+func stateBackupStore(ctx context.Context) (*statebackup.Store, *s3.Client, error) {
+	if stateBackend != nil && stateBackend.Type != "" && stateBackend.Type != stacks.BackendS3 {
+		return nil, nil, fmt.Errorf("state backups need the s3 state backend, not %s", stateBackend.Type)
+	}
+	client, err := stateBucketClient(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &statebackup.Store{
+		Client:      client,
+		Bucket:      stateBucketFor(accountID),
+		Environment: environment,
+		Workspace:   workspace,
+		KMSKeyID:    stateKMSKeyID,
+	}, client, nil
+}
+
+func newStateBackupCommand() *cobra.Command {
+	var (
+		stackArg string
+		filter   stackFilter
+	)
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Copy the remote state of stacks to s3://<state-bucket>/backups/<env>/<stack>/",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := contextWithCmd(cmd)
+			store, _, err := stateBackupStore(ctx)
+			if err != nil {
+				return err
+			}
+			g, index, err := loadGraphData()
+			if err != nil {
+				return err
+			}
+			var paths []string
+			if stackArg != "" {
+				stack, _, err := resolveStackArg(g, index, stackArg)
+				if err != nil {
+					return err
+				}
+				paths = []string{stack.Path}
+			} else {
+				if paths, err = filter.paths(g); err != nil {
+					return err
+				}
+				if paths == nil {
+					paths = graphStackPaths(g)
+				}
+			}
+
+			states, err := pullRemoteStates(ctx, cmd, paths)
+			if err != nil {
+				return err
+			}
+			saved := 0
+			for i, state := range states {
+				rel := relStack(paths[i])
+				if strings.TrimSpace(state) == "" {
+					output.Printf("[state] %s has no state yet\n", rel)
+					continue
+				}
+				key, err := store.Save(ctx, rel, []byte(state))
+				if err != nil {
+					return fmt.Errorf("%s: %w", rel, err)
+				}
+				saved++
+				output.Printf("[state] backed up %s to s3://%s/%s\n", rel, store.Bucket, key)
+			}
+			output.Printf("[state] backed up %d of %d stacks\n", saved, len(paths))
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&stackArg, "stack", "", "back up only this stack (name or path)")
+	filter.register(cmd)
+	return cmd
+}
+
+func newStateExportCommand() *cobra.Command {
+	var (
+		dir    string
+		filter stackFilter
+	)
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Write the remote state of stacks, and the external states they read, to a directory for plan-all --from-local-state",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := contextWithCmd(cmd)
+			g, _, err := loadGraphData()
+			if err != nil {
+				return err
+			}
+			paths, err := filter.paths(g)
+			if err != nil {
+				return err
+			}
+			if paths == nil {
+				paths = graphStackPaths(g)
+			}
+			states, err := pullRemoteStates(ctx, cmd, paths)
+			if err != nil {
+				return err
+			}
+			for i, state := range states {
+				rel := relStack(paths[i])
+				path := superplan.LocalStatePath(dir, rel)
+				if err := writeExport(path, []byte(state)); err != nil {
+					return fmt.Errorf("export state of %s: %w", rel, err)
+				}
+			}
+			output.Printf("[state] exported the state of %d stacks to %s\n", len(paths), dir)
+
+			external := &stacks.ExternalStates{Region: region}
+			exported := make(map[string]bool)
+			for _, stackDir := range paths {
+				deps, err := stacks.StackExternalDependencies(stackDir)
+				if err != nil {
+					return err
+				}
+				for _, dep := range deps {
+					path := stacks.LocalExternalStatePath(superplan.LocalExternalDir(dir), dep)
+					if exported[path] {
+						continue
+					}
+					outputs, err := external.Outputs(ctx, dep)
+					if err != nil {
+						return fmt.Errorf("%s: external dependency %s: %w", relStack(stackDir), dep, err)
+					}
+					doc := map[string]map[string]map[string]json.RawMessage{"outputs": {}}
+					for name, value := range outputs {
+						doc["outputs"][name] = map[string]json.RawMessage{"value": value}
+					}
+					data, err := json.MarshalIndent(doc, "", "  ")
+					if err != nil {
+						return err
+					}
+					if err := writeExport(path, data); err != nil {
+						return fmt.Errorf("export external state %s: %w", dep, err)
+					}
+					exported[path] = true
+				}
+			}
+			if len(exported) > 0 {
+				output.Printf("[state] exported the outputs of %d external states\n", len(exported))
+			}
+			output.Printf("[state] the export holds unredacted state, sensitive values included; keep it private\n")
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&dir, "dir", "", "directory to write <stack>/terraform.tfstate files to")
+	filter.register(cmd)
+	_ = cmd.MarkFlagRequired("dir")
+	return cmd
+}
+
+// writeExport writes an exported state readable only by the current user,
+// since state holds secrets.
+func writeExport(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+func newStateRestoreCommand() *cobra.Command {
+	var (
+		stackArg    string
+		from        string
+		list        bool
+		dryRun      bool
+		autoApprove bool
+	)
+	cmd := &cobra.Command{
+		Use:   "restore",
+		Short: "Replace a stack's remote state with one of its backups",
+		Long: `Replace a stack's remote state with a backup taken by state backup or
+before an apply or destroy run with --state-backups. The backup must be of the
+same lineage as the current state; its serial is raised above the current one
+so the backend accepts it. The current state is backed up first, so a restore
+can itself be undone.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := contextWithCmd(cmd)
+			store, client, err := stateBackupStore(ctx)
+			if err != nil {
+				return err
+			}
+			g, index, err := loadGraphData()
+			if err != nil {
+				return err
+			}
+			stack, rel, err := resolveStackArg(g, index, stackArg)
+			if err != nil {
+				return err
+			}
+			stackRel := relStack(stack.Path)
+
+			if list {
+				backups, err := store.List(ctx, stackRel)
+				if err != nil {
+					return err
+				}
+				if len(backups) == 0 {
+					output.Printf("[state] no state backups of %s\n", rel)
+					return nil
+				}
+				tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(tw, "BACKUP\tSIZE\tKEY")
+				for _, backup := range backups {
+					fmt.Fprintf(tw, "%s\t%d\t%s\n", backup.Timestamp(), backup.Size, backup.Key)
+				}
+				return tw.Flush()
+			}
+
+			backup, err := store.Find(ctx, stackRel, from)
+			if err != nil {
+				return err
+			}
+			data, err := store.Get(ctx, backup.Key)
+			if err != nil {
+				return err
+			}
+
+			res, err := resolveTerraform(ctx, cmd, []string{stack.Path})
+			if err != nil {
+				return err
+			}
+			runner, err := stacks.NewRunner(ctx, stacks.RunnerOptions{
+				RootDir:       rootDir,
+				Environment:   environment,
+				AccountID:     accountID,
+				Region:        region,
+				TerraformPath: res.BinaryPath,
+				Profile:       profile,
+				Workspace:     workspace,
+				StateKMSKeyID: stateKMSKeyID,
+				StateBackend:  stateBackend,
+				AssumeRoleARN: assumeRoleARN,
+				Retry:         retryPolicy,
+				TFLog:         tfLog,
+				TFLogDir:      runLogDir,
+				ExtraVarFiles: extraVarFiles,
+			})
+			if err != nil {
+				return err
+			}
+			current, err := runner.PullState(ctx, stack.Path)
+			if err != nil {
+				return fmt.Errorf("read state of %s: %w", rel, err)
+			}
+			restored, serial, err := statepatch.Restore(current, data)
+			if err != nil {
+				return fmt.Errorf("restore %s from %s: %w", rel, backup.Timestamp(), err)
+			}
+			before, err := stacks.ManagedResources(current)
+			if err != nil {
+				return err
+			}
+			after, err := stacks.ManagedResources(data)
+			if err != nil {
+				return err
+			}
+			output.Printf("[state] %s: restore the backup of %s, %d managed resources now -> %d (serial %d)\n", rel, backup.Timestamp(), len(before), len(after), serial)
+			if dryRun {
+				return nil
+			}
+
+			if err := enforceFreeze(ctx, "state restore"); err != nil {
+				return err
+			}
+			if !autoApprove {
+				ok, err := confirmStatePush(fmt.Sprintf("Replace the state of %s with its backup of %s?", rel, backup.Timestamp()))
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return fmt.Errorf("state restore of %s cancelled", rel)
+				}
+			}
+
+			var saved string
+			if strings.TrimSpace(string(current)) != "" {
+				if saved, err = store.Save(ctx, stackRel, current); err != nil {
+					return fmt.Errorf("back up the current state of %s: %w", rel, err)
+				}
+				output.Printf("[state] saved the current state of %s to s3://%s/%s\n", rel, store.Bucket, saved)
+			}
+			if err := pushStateFile(ctx, runner, stack.Path, restored); err != nil {
+				return fmt.Errorf("%s: %w", rel, err)
+			}
+			output.Printf("[state] restored %s from %s (serial %d)\n", rel, backup.Key, serial)
+
+			return auditTrail(client).Record(ctx, audit.Entry{
+				Action: "state-restore",
+				Details: map[string]string{
+					"stack":  rel,
+					"backup": backup.Key,
+					"saved":  saved,
+					"serial": fmt.Sprint(serial),
+				},
+			})
+		},
+	}
+	cmd.Flags().StringVar(&stackArg, "stack", "", "stack name or path")
+	cmd.Flags().StringVar(&from, "from", statebackup.Latest, "backup to restore: latest, its timestamp as listed by --list, or its key")
+	cmd.Flags().BoolVar(&list, "list", false, "list the stack's backups instead of restoring one")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "show what would be restored without pushing the state")
+	cmd.Flags().BoolVar(&autoApprove, "auto-approve", false, "push the backup without asking for confirmation")
+	cmd.Flags().StringVar(&breakFreeze, "break-freeze", "", "reason for overriding an active change freeze")
+	_ = cmd.MarkFlagRequired("stack")
+	return cmd
+}
@@ -0,0 +1,257 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/stacks"
+	"terraform-wrapper/internal/statequery"
+	"terraform-wrapper/internal/superplan"
+)
+
+func newStateListCommand() *cobra.Command {
+	var (
+		filter   stackFilter
+		query    statequery.Query
+		attrArgs []string
+		format   string
+	)
+	cmd := &cobra.Command{
+		Use:   "list [address]",
+		Short: "List the resources in the remote state of every stack, optionally filtered",
+		Long: `List the resources in the remote state of every stack of the environment.
+The optional address is a glob or substring of the resource address. Use
+--type, --attr and --value to search by resource type and attribute values,
+e.g. to find the stack an ALB is defined in from its DNS name.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				query.Address = args[0]
+			}
+			attrs, err := parseAttrFilters(attrArgs)
+			if err != nil {
+				return err
+			}
+			query.Attributes = attrs
+			if format != "table" && format != "json" {
+				return fmt.Errorf("unknown --format %q: use table or json", format)
+			}
+
+			g, _, err := loadGraphData()
+			if err != nil {
+				return err
+			}
+			paths, err := filter.paths(g)
+			if err != nil {
+				return err
+			}
+			if paths == nil {
+				paths = graphStackPaths(g)
+			}
+			instances, err := pullStateInstances(contextWithCmd(cmd), cmd, paths)
+			if err != nil {
+				return err
+			}
+			matches := statequery.Find(instances, query)
+
+			if format == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if matches == nil {
+					matches = []statequery.Match{}
+				}
+				return enc.Encode(matches)
+			}
+			if len(matches) == 0 {
+				output.Printf("[state] no resources match in %d stacks\n", len(paths))
+				return nil
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			if query.Value != "" {
+				fmt.Fprintln(tw, "STACK\tADDRESS\tMATCHED")
+			} else {
+				fmt.Fprintln(tw, "STACK\tADDRESS")
+			}
+			stacksSeen := make(map[string]bool)
+			for _, m := range matches {
+				stacksSeen[m.Stack] = true
+				if query.Value != "" {
+					fmt.Fprintf(tw, "%s\t%s\t%s\n", m.Stack, m.Address, strings.Join(m.Paths, ","))
+				} else {
+					fmt.Fprintf(tw, "%s\t%s\n", m.Stack, m.Address)
+				}
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+			output.Printf("[state] %d resources in %d of %d stacks\n", len(matches), len(stacksSeen), len(paths))
+			return nil
+		},
+	}
+	filter.register(cmd)
+	cmd.Flags().StringVar(&query.Type, "type", "", "only list resources of this type (e.g. aws_lb)")
+	cmd.Flags().StringArrayVar(&attrArgs, "attr", nil, "only list resources whose attribute has this exact value, as path=value (e.g. tags.Name=edge); repeatable")
+	cmd.Flags().StringVar(&query.Value, "value", "", "only list resources with an attribute value containing this string, naming the attributes that matched")
+	cmd.Flags().BoolVar(&query.Data, "data", false, "include data sources")
+	cmd.Flags().StringVar(&format, "format", "table", "output format: table or json")
+	return cmd
+}
+
+func newStateShowCommand() *cobra.Command {
+	var stackArg string
+	cmd := &cobra.Command{
+		Use:   "show <address>",
+		Short: "Print the attributes of a resource from the remote state of the stacks defining it",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			g, index, err := loadGraphData()
+			if err != nil {
+				return err
+			}
+			paths := graphStackPaths(g)
+			if stackArg != "" {
+				stack, _, err := resolveStackArg(g, index, stackArg)
+				if err != nil {
+					return err
+				}
+				paths = []string{stack.Path}
+			}
+			instances, err := pullStateInstances(contextWithCmd(cmd), cmd, paths)
+			if err != nil {
+				return err
+			}
+
+			var matches []statequery.Instance
+			for _, inst := range instances {
+				if inst.Address == args[0] {
+					matches = append(matches, inst)
+				}
+			}
+			if len(matches) == 0 {
+				// Fall back to a glob, so count and for_each instances can be
+				// shown together.
+				for _, m := range statequery.Find(instances, statequery.Query{Address: args[0], Data: true}) {
+					matches = append(matches, m.Instance)
+				}
+			}
+			if len(matches) == 0 {
+				return fmt.Errorf("no resource %s in the state of %d stacks", args[0], len(paths))
+			}
+			for i, inst := range matches {
+				if i > 0 {
+					fmt.Println()
+				}
+				attrs, err := json.MarshalIndent(inst.Attributes, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Printf("# %s: %s\n%s\n", inst.Stack, inst.Address, attrs)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&stackArg, "stack", "", "only look in this stack (name or path)")
+	return cmd
+}
+
+// parseAttrFilters parses --attr path=value flags.
+func parseAttrFilters(args []string) (map[string]string, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	attrs := make(map[string]string, len(args))
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid --attr %q: use path=value", arg)
+		}
+		attrs[key] = value
+	}
+	return attrs, nil
+}
+
+// pullStateInstances pulls the remote state of the stacks at paths and
+// returns their resource instances.
+func pullStateInstances(ctx context.Context, cmd *cobra.Command, paths []string) ([]statequery.Instance, error) {
+	states, err := pullRemoteStates(ctx, cmd, paths)
+	if err != nil {
+		return nil, err
+	}
+	var instances []statequery.Instance
+	for i, state := range states {
+		rel := relStack(paths[i])
+		parsed, err := statequery.Parse(rel, []byte(state))
+		if err != nil {
+			return nil, fmt.Errorf("read state of %s: %w", rel, err)
+		}
+		instances = append(instances, parsed...)
+	}
+	return instances, nil
+}
+
+// pullRemoteStates pulls the remote state of the stacks at paths with
+// --parallelism pulls in flight, in the order of paths. The init output of
+// each stack is kept back unless its pull fails, so it does not drown the
+// results.
+func pullRemoteStates(ctx context.Context, cmd *cobra.Command, paths []string) ([]string, error) {
+	res, err := resolveTerraform(ctx, cmd, paths)
+	if err != nil {
+		return nil, err
+	}
+	group := output.NewGroupTo(os.Stderr)
+	runner, err := stacks.NewRunner(ctx, stacks.RunnerOptions{
+		RootDir:       rootDir,
+		Environment:   environment,
+		AccountID:     accountID,
+		Region:        region,
+		TerraformPath: res.BinaryPath,
+		Profile:       profile,
+		Workspace:     workspace,
+		StateKMSKeyID: stateKMSKeyID,
+		StateBackend:  stateBackend,
+		AssumeRoleARN: assumeRoleARN,
+		Retry:         retryPolicy,
+		TFLog:         tfLog,
+		TFLogDir:      runLogDir,
+		ExtraVarFiles: extraVarFiles,
+		Group:         group,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(os.Stderr, "[state] reading the state of %d stacks\n", len(paths))
+	states, err := superplan.PullStates(ctx, paths, parallelism, func(ctx context.Context, stackDir string) (string, error) {
+		state, err := runner.PullState(ctx, stackDir)
+		return string(state), err
+	})
+	if err != nil {
+		var stackErr *superplan.StackError
+		if errors.As(err, &stackErr) {
+			rel := relStack(stackErr.StackDir)
+			_ = group.Flush(rel)
+			return nil, fmt.Errorf("read state of %s: %w", rel, stackErr.Err)
+		}
+		return nil, err
+	}
+	return states, nil
+}
+
+// relStack returns the slash-separated path of a stack relative to the
+// repository root, as the runner labels its output.
+func relStack(stackDir string) string {
+	rel, err := filepathRelSafe(rootDir, stackDir)
+	if err != nil {
+		return stackDir
+	}
+	return filepath.ToSlash(rel)
+}
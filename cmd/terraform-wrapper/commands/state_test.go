@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"terraform-wrapper/internal/stacks"
+)
+
+// rotateKMSRoot sets up a root with network and app stacks for the dev
+// environment and the default backend settings.
+func rotateKMSRoot(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	previousRoot, previousEnv, previousBackend := rootDir, environment, stateBackend
+	rootDir, environment, stateBackend = root, "dev", nil
+	t.Cleanup(func() { rootDir, environment, stateBackend = previousRoot, previousEnv, previousBackend })
+
+	for _, name := range []string{"network", "app"} {
+		dir := filepath.Join(root, name)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "dependencies.json"), []byte(`{"dependencies": {"paths": []}}`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestCheckRotateKMSLayoutAcceptsDefaultLayout(t *testing.T) {
+	root := rotateKMSRoot(t)
+	stateBackend = &stacks.BackendSettings{Type: stacks.BackendS3, Bucket: "state"}
+	if err := os.WriteFile(filepath.Join(root, "app", stacks.BackendFileName), []byte(`{"type": "s3"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkRotateKMSLayout(); err != nil {
+		t.Fatalf("default layout rejected: %v", err)
+	}
+}
+
+func TestCheckRotateKMSLayoutRejectsRootTemplates(t *testing.T) {
+	cases := []struct {
+		name     string
+		settings *stacks.BackendSettings
+		want     string
+	}{
+		{
+			name:     "key_template",
+			settings: &stacks.BackendSettings{Type: stacks.BackendS3, KeyTemplate: "{{.Environment}}/{{.Stack}}.tfstate"},
+			want:     "names keys with key_template",
+		},
+		{
+			name:     "environment_workspaces",
+			settings: &stacks.BackendSettings{Type: stacks.BackendS3, EnvironmentWorkspaces: true},
+			want:     "keeps state in Terraform workspaces",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rotateKMSRoot(t)
+			stateBackend = tc.settings
+			if err := checkRotateKMSLayout(); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestCheckRotateKMSLayoutRejectsStackTemplates(t *testing.T) {
+	cases := map[string]string{
+		"bucket_template":        `{"type": "s3", "bucket_template": "state-{{.Environment}}"}`,
+		"key_template":           `{"key_template": "{{.Stack}}.tfstate"}`,
+		"environment_workspaces": `{"type": "s3", "environment_workspaces": true}`,
+	}
+	for name, contents := range cases {
+		t.Run(name, func(t *testing.T) {
+			root := rotateKMSRoot(t)
+			backendFile := filepath.Join(root, "app", stacks.BackendFileName)
+			if err := os.WriteFile(backendFile, []byte(contents), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := checkRotateKMSLayout(); err == nil || !strings.Contains(err.Error(), backendFile+" stores its state elsewhere") {
+				t.Fatalf("expected %s to be rejected, got %v", backendFile, err)
+			}
+		})
+	}
+
+	t.Run("other backend types are ignored", func(t *testing.T) {
+		root := rotateKMSRoot(t)
+		contents := `{"type": "azurerm", "key_template": "{{.Stack}}.tfstate"}`
+		if err := os.WriteFile(filepath.Join(root, "app", stacks.BackendFileName), []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := checkRotateKMSLayout(); err != nil {
+			t.Fatalf("azurerm stack rejected: %v", err)
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"terraform-wrapper/internal/graph"
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/superplan"
+)
+
+func newSuperplanCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "superplan",
+		Short: "Act on the unified superplan",
+	}
+	cmd.AddCommand(newSuperplanApplyCommand())
+	return cmd
+}
+
+// approvedStacks resolves the --stack arguments of superplan apply, which
+// must be among the stacks g was narrowed to.
+func approvedStacks(g graph.Graph, index map[string]*graph.Stack, args []string) ([]string, error) {
+	var approved []string
+	for _, arg := range args {
+		stack, rel, err := resolveStackArg(g, index, arg)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := g[stack.Path]; !ok {
+			return nil, fmt.Errorf("--stack %s is not among the stacks selected with --stacks, --since-stack or --changed-only", rel)
+		}
+		approved = append(approved, rel)
+	}
+	return approved, nil
+}
+
+func newSuperplanApplyCommand() *cobra.Command {
+	var (
+		stackArgs   []string
+		autoApprove bool
+		partial     partialFlags
+	)
+	cmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Generate the superplan and apply its changes stack by stack in dependency order",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := contextWithCmd(cmd)
+			if err := enforceIdentity(ctx, "superplan-apply"); err != nil {
+				return err
+			}
+			g, index, err := loadGraphData()
+			if err != nil {
+				return err
+			}
+			var selected []string
+			if partial.enabled() {
+				if g, err = partial.apply(ctx, g, index); err != nil {
+					return err
+				}
+				if len(g) == 0 {
+					return nil
+				}
+				selected = graphStackPaths(g)
+			}
+
+			approved, err := approvedStacks(g, index, stackArgs)
+			if err != nil {
+				return err
+			}
+
+			res, err := resolveTerraform(ctx, cmd, graphStackPaths(g))
+			if err != nil {
+				return err
+			}
+
+			resolvedVersion := ""
+			if res.Version != nil {
+				resolvedVersion = res.Version.String()
+			}
+
+			if err := enforceFreeze(ctx, "superplan-apply"); err != nil {
+				return err
+			}
+
+			opts := executorOptions(res.BinaryPath, resolvedVersion)
+			if err := attachExporter(ctx, &opts, graphStacks(g)...); err != nil {
+				return err
+			}
+			attachPropagator(&opts, g)
+			runID, gitSHA := runIdentity(ctx, "superplan-apply")
+			if err := attachStateTagger(ctx, &opts, runID, gitSHA); err != nil {
+				return err
+			}
+
+			applyOpts := superplan.ApplyOptions{
+				Options: superplan.Options{
+					RootDir:          rootDir,
+					OutputDir:        superplanDir,
+					TerraformPath:    res.BinaryPath,
+					TerraformVersion: resolvedVersion,
+					Environment:      environment,
+					Profile:          profile,
+					Workspace:        workspace,
+					StateKMSKeyID:    stateKMSKeyID,
+					AccountID:        accountID,
+					Region:           region,
+					Parallelism:      parallelism,
+					StateBackend:     stateBackend,
+					AssumeRoleARN:    assumeRoleARN,
+					TFLog:            tfLog,
+					TFLogDir:         runLogDir,
+					ExtraVarFiles:    extraVarFiles,
+					StateConflicts:   stateConflicts,
+					Guardrails:       guardrails(),
+					Stacks:           selected,
+					Workdir:          runWorkdir,
+					TagAttributes:    tagAttributes,
+				},
+				Stacks:   approved,
+				Executor: opts,
+			}
+			if !autoApprove {
+				applyOpts.Approve = confirmSuperplanApply
+			}
+
+			summary, err := superplan.Apply(ctx, applyOpts)
+			if err != nil {
+				return detailedExit(cmd, failRun("superplan-apply", summary, err))
+			}
+			printSummary("superplan-apply", summary)
+			return nil
+		},
+	}
+	cmd.Flags().StringSliceVar(&stackArgs, "stack", nil, "only apply these stacks (name or path); defaults to every stack with changes")
+	cmd.Flags().BoolVar(&autoApprove, "auto-approve", false, "apply without asking for confirmation")
+	partial.register(cmd)
+	cmd.Flags().StringVar(&stateConflicts, "state-conflicts", superplan.StateConflictWarn, "when stack states were written by different state format or Terraform versions: warn, fail or normalize")
+	cmd.Flags().StringVar(&breakFreeze, "break-freeze", "", "reason for overriding an active change freeze")
+	registerGuardrailFlags(cmd)
+	return cmd
+}
+
+func confirmSuperplanApply(changes []superplan.StackChanges) (bool, error) {
+	output.Printf("Apply changes to %d stacks? Only 'yes' will be accepted: ", len(changes))
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false, fmt.Errorf("read confirmation: %w", err)
+	}
+	return strings.TrimSpace(answer) == "yes", nil
+}
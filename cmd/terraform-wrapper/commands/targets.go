@@ -0,0 +1,325 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"terraform-wrapper/internal/audit"
+	"terraform-wrapper/internal/gitdiff"
+	"terraform-wrapper/internal/graph"
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/release"
+)
+
+// closureFlags widen a single-stack command to the stack's upstream
+// dependencies and/or downstream dependents.
+type closureFlags struct {
+	dependencies bool
+	dependents   bool
+}
+
+func (c *closureFlags) register(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&c.dependencies, "include-dependencies", false, "also run every stack the target depends on, upstream first")
+	cmd.Flags().BoolVar(&c.dependents, "include-dependents", false, "also run every stack that depends on the target, downstream last")
+}
+
+func (c *closureFlags) enabled() bool {
+	return c.dependencies || c.dependents
+}
+
+// targetGraph extracts the subgraph of stack and its requested closure and
+// reports the order the stacks will run in.
+func (c *closureFlags) targetGraph(g graph.Graph, stack *graph.Stack) (graph.Graph, error) {
+	paths := []string{stack.Path}
+	if c.dependencies {
+		paths = append(paths, g.Upstream(stack.Path)...)
+	}
+	if c.dependents {
+		paths = append(paths, g.Downstream(stack.Path)...)
+	}
+	sub := g.Subgraph(paths)
+	if err := printTargets(sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// stackFilter narrows an -all command to the stacks matching --only and not
+// matching --exclude.
+type stackFilter struct {
+	only    []string
+	exclude []string
+}
+
+func (f *stackFilter) register(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&f.only, "only", nil, "only run stacks matching these globs (e.g. 'core-services/*') or tag:<name> filters")
+	cmd.Flags().StringSliceVar(&f.exclude, "exclude", nil, "skip stacks matching these globs or tag:<name> filters")
+}
+
+// paths returns the stacks the filters select, or nil when no filter is set.
+func (f *stackFilter) paths(g graph.Graph) ([]string, error) {
+	if len(f.only) == 0 && len(f.exclude) == 0 {
+		return nil, nil
+	}
+	paths, err := graph.Filter(g, rootDir, f.only, f.exclude)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no stacks match --only %s --exclude %s", strings.Join(f.only, ","), strings.Join(f.exclude, ","))
+	}
+	return paths, nil
+}
+
+// selected returns the paths of the filtered graph g, or nil when no filter
+// is set so that every stack is used.
+func (f *stackFilter) selected(g graph.Graph) []string {
+	if len(f.only) == 0 && len(f.exclude) == 0 {
+		return nil
+	}
+	return graphStackPaths(g)
+}
+
+// apply returns the subgraph of the selected stacks and reports the order
+// they will run in. g is returned unchanged when no filter is set.
+func (f *stackFilter) apply(g graph.Graph) (graph.Graph, error) {
+	paths, err := f.paths(g)
+	if err != nil || paths == nil {
+		return g, err
+	}
+	sub := g.Select(paths)
+	if err := printTargets(sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// printTargets reports the stacks of sub in the order they will run in.
+func printTargets(sub graph.Graph) error {
+	order, err := graph.TopoSort(sub)
+	if err != nil {
+		return fmt.Errorf("dependency resolution failed: %w", err)
+	}
+	names := make([]string, 0, len(order))
+	for _, path := range order {
+		rel, err := filepathRelSafe(rootDir, path)
+		if err != nil {
+			rel = path
+		}
+		names = append(names, rel)
+	}
+	output.Printf("[target] %d stacks: %s\n", len(names), strings.Join(names, " -> "))
+	return nil
+}
+
+// partialFlags restrict a superplan to a subgraph: the stacks named with
+// --stacks, or --since-stack and every stack depending on it, or with
+// --changed-only the stacks changed since --base and every stack depending
+// on them, together with all of their dependencies so the merged
+// configuration stays complete.
+type partialFlags struct {
+	stacks      []string
+	since       string
+	changedOnly bool
+	base        string
+}
+
+func (p *partialFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&p.stacks, "stacks", nil, "only merge and plan these stacks (name or path) and their dependencies")
+	cmd.Flags().StringVar(&p.since, "since-stack", "", "only merge and plan this stack, every stack depending on it, and their dependencies")
+	cmd.Flags().BoolVar(&p.changedOnly, "changed-only", false, "only merge and plan the stacks whose files, modules or tfvars changed since --base, every stack depending on them, and their dependencies")
+	cmd.Flags().StringVar(&p.base, "base", "origin/main", "with --changed-only, the git revision the branch is compared with")
+}
+
+func (p *partialFlags) enabled() bool {
+	return len(p.stacks) > 0 || p.since != "" || p.changedOnly
+}
+
+// apply returns the subgraph of the selected stacks and their dependencies
+// and reports the order they will be planned in. g is returned unchanged
+// when no flag is set, and empty when --changed-only finds no changed stack.
+func (p *partialFlags) apply(ctx context.Context, g graph.Graph, index map[string]*graph.Stack) (graph.Graph, error) {
+	if !p.enabled() {
+		return g, nil
+	}
+	var roots []string
+	for _, arg := range p.stacks {
+		stack, _, err := resolveStackArg(g, index, arg)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, stack.Path)
+	}
+	if p.since != "" {
+		stack, _, err := resolveStackArg(g, index, p.since)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, stack.Path)
+		roots = append(roots, g.Downstream(stack.Path)...)
+	}
+	if p.changedOnly {
+		changed, err := changedStacks(ctx, g, p.base)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range changed {
+			roots = append(roots, path)
+			roots = append(roots, g.Downstream(path)...)
+		}
+		if len(roots) == 0 {
+			output.Printf("[target] no stacks changed since %s\n", p.base)
+			return graph.Graph{}, nil
+		}
+	}
+	paths := append([]string(nil), roots...)
+	for _, root := range roots {
+		paths = append(paths, g.Upstream(root)...)
+	}
+	sub := g.Select(paths)
+	output.Printf("[target] superplan limited to %d of %d stacks\n", len(sub), len(g))
+	if err := printTargets(sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// changedStacks returns the stacks of g that the files changed since base
+// affect, printing each with the file that affects it.
+func changedStacks(ctx context.Context, g graph.Graph, base string) ([]string, error) {
+	rootAbs, err := filepath.Abs(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	files, err := gitdiff.ChangedFiles(ctx, rootAbs, base)
+	if err != nil {
+		return nil, fmt.Errorf("--changed-only: %w", err)
+	}
+	affected, err := gitdiff.Affected(rootAbs, g, files, environment, profile)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(affected))
+	for path := range affected {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	output.Printf("[target] %d files changed since %s affect %d stacks\n", len(files), base, len(paths))
+	for _, path := range paths {
+		output.Printf("  %s (%s)\n", relStack(path), affected[path])
+	}
+	return paths, nil
+}
+
+// releaseFlags restrict a run to the stacks of a release manifest and their
+// dependencies, with each stack's configuration at the git ref the manifest
+// pins it to.
+type releaseFlags struct {
+	manifest string
+	checkout bool
+
+	loaded *release.Manifest
+	pins   []release.Pin
+}
+
+func (r *releaseFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&r.manifest, "manifest", "", "release manifest listing the stacks to run, with their dependencies, and the git ref each is pinned to")
+	cmd.Flags().BoolVar(&r.checkout, "checkout-refs", false, "with --manifest, check out each stack at its pinned ref instead of failing when the working tree differs")
+}
+
+func (r *releaseFlags) enabled() bool {
+	return r.manifest != ""
+}
+
+// prepare loads the manifest and brings the working tree to its refs: it
+// checks out each pinned stack with --checkout-refs and otherwise fails when
+// one differs. It runs before the graph is loaded, since checking out a stack
+// can change its dependencies.json.
+func (r *releaseFlags) prepare(ctx context.Context) error {
+	if !r.enabled() {
+		return nil
+	}
+	m, err := release.Load(r.manifest)
+	if err != nil {
+		return err
+	}
+	rootAbs, err := filepath.Abs(rootDir)
+	if err != nil {
+		return err
+	}
+	pins, err := release.Resolve(ctx, rootAbs, m)
+	if err != nil {
+		return fmt.Errorf("--manifest: %w", err)
+	}
+	if r.checkout {
+		if err := release.Checkout(ctx, rootAbs, pins); err != nil {
+			return err
+		}
+	}
+	if err := release.Verify(ctx, rootAbs, pins); err != nil {
+		return fmt.Errorf("%w; pass --checkout-refs to check the stacks out", err)
+	}
+	r.loaded, r.pins = m, pins
+	return nil
+}
+
+// apply returns the subgraph of the manifest's stacks and their dependencies,
+// reports the order they will run in and records the release in the audit
+// trail. g is returned unchanged without --manifest.
+func (r *releaseFlags) apply(ctx context.Context, g graph.Graph, operation string) (graph.Graph, error) {
+	if r.loaded == nil {
+		return g, nil
+	}
+	rootAbs, err := filepath.Abs(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	var paths, pinned []string
+	for _, pin := range r.pins {
+		path := filepath.Join(rootAbs, filepath.FromSlash(pin.Path))
+		if _, ok := g[path]; !ok {
+			return nil, fmt.Errorf("release manifest %s: %s is not a stack", r.manifest, pin.Path)
+		}
+		paths = append(paths, path)
+		paths = append(paths, g.Upstream(path)...)
+		entry := pin.Path
+		if pin.Commit != "" {
+			entry = fmt.Sprintf("%s@%s (%.12s)", pin.Path, pin.Ref, pin.Commit)
+		}
+		pinned = append(pinned, entry)
+	}
+	sub := g.Select(paths)
+	name := r.loaded.Name
+	if name == "" {
+		name = r.manifest
+	}
+	output.Printf("[release] %s: %d stacks, %d with their dependencies\n", name, len(r.pins), len(sub))
+	if err := printTargets(sub); err != nil {
+		return nil, err
+	}
+
+	var client audit.S3API
+	if !offlineMode {
+		if client, err = stateBucketClient(ctx); err != nil {
+			return nil, err
+		}
+	}
+	err = auditTrail(client).Record(ctx, audit.Entry{
+		Action: "release",
+		Details: map[string]string{
+			"operation": operation,
+			"manifest":  r.manifest,
+			"name":      r.loaded.Name,
+			"stacks":    strings.Join(pinned, ", "),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
@@ -0,0 +1,160 @@
+package commands
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"terraform-wrapper/internal/graph"
+)
+
+// partialGraph returns a graph where app depends on database, which depends
+// on network, monitoring depends on app and dns stands alone, with the index
+// loadGraphData would build for it.
+func partialGraph(t *testing.T) (graph.Graph, map[string]*graph.Stack) {
+	t.Helper()
+	root := t.TempDir()
+	previous := rootDir
+	rootDir = root
+	t.Cleanup(func() { rootDir = previous })
+
+	deps := map[string][]string{
+		"network":    nil,
+		"database":   {"network"},
+		"app":        {"database"},
+		"monitoring": {"app"},
+		"dns":        nil,
+	}
+	g := make(graph.Graph)
+	index := make(map[string]*graph.Stack)
+	for name, names := range deps {
+		stack := &graph.Stack{Path: filepath.Join(root, name)}
+		for _, dep := range names {
+			stack.Dependencies = append(stack.Dependencies, filepath.Join(root, dep))
+		}
+		g[stack.Path] = stack
+		index[name] = stack
+	}
+	return g, index
+}
+
+func stackNames(g graph.Graph) []string {
+	names := make([]string, 0, len(g))
+	for path := range g {
+		names = append(names, filepath.Base(path))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestPartialFlagsSelectStacksWithTheirDependencies(t *testing.T) {
+	g, index := partialGraph(t)
+
+	cases := []struct {
+		name  string
+		flags partialFlags
+		want  []string
+	}{
+		{
+			name:  "stacks pull in their upstream closure",
+			flags: partialFlags{stacks: []string{"app"}},
+			want:  []string{"app", "database", "network"},
+		},
+		{
+			name:  "since-stack selects dependents and their dependencies",
+			flags: partialFlags{since: "database"},
+			want:  []string{"app", "database", "monitoring", "network"},
+		},
+		{
+			name:  "stacks and since-stack combine",
+			flags: partialFlags{stacks: []string{"dns"}, since: "app"},
+			want:  []string{"app", "database", "dns", "monitoring", "network"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sub, err := tc.flags.apply(context.Background(), g, index)
+			if err != nil {
+				t.Fatalf("apply: %v", err)
+			}
+			if got := stackNames(sub); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("selected %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPartialFlagsLeaveGraphUnchangedWhenUnset(t *testing.T) {
+	g, index := partialGraph(t)
+
+	var flags partialFlags
+	sub, err := flags.apply(context.Background(), g, index)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if len(sub) != len(g) {
+		t.Fatalf("selected %d stacks, want all %d", len(sub), len(g))
+	}
+}
+
+func TestPartialFlagsRejectUnknownStack(t *testing.T) {
+	g, index := partialGraph(t)
+
+	flags := partialFlags{since: "queue"}
+	if _, err := flags.apply(context.Background(), g, index); err == nil || !strings.Contains(err.Error(), `stack "queue" not found`) {
+		t.Fatalf("expected unknown stack error, got %v", err)
+	}
+}
+
+func TestPlanAllPartialFlagsAreMutuallyExclusive(t *testing.T) {
+	cases := [][]string{
+		{"--stacks", "app", "--only", "core/*"},
+		{"--since-stack", "app", "--exclude", "dns"},
+		{"--changed-only", "--destroy"},
+		{"--stacks", "app", "--only-failed"},
+		{"--manifest", "release.json", "--since-stack", "app"},
+	}
+	for _, args := range cases {
+		cmd := newPlanAllCommand()
+		if err := cmd.ParseFlags(args); err != nil {
+			t.Fatalf("parse %v: %v", args, err)
+		}
+		if err := cmd.ValidateFlagGroups(); err == nil || !strings.Contains(err.Error(), "none of the others can be") {
+			t.Fatalf("%v: expected mutually exclusive flags error, got %v", args, err)
+		}
+	}
+
+	cmd := newPlanAllCommand()
+	if err := cmd.ParseFlags([]string{"--stacks", "app", "--since-stack", "database"}); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if err := cmd.ValidateFlagGroups(); err != nil {
+		t.Fatalf("--stacks and --since-stack should combine: %v", err)
+	}
+}
+
+func TestSuperplanApplyRejectsStackOutsideSelection(t *testing.T) {
+	g, index := partialGraph(t)
+
+	flags := partialFlags{stacks: []string{"app"}}
+	sub, err := flags.apply(context.Background(), g, index)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+
+	approved, err := approvedStacks(sub, index, []string{"database"})
+	if err != nil {
+		t.Fatalf("approve selected stack: %v", err)
+	}
+	if !reflect.DeepEqual(approved, []string{"database"}) {
+		t.Fatalf("approved %v, want [database]", approved)
+	}
+
+	_, err = approvedStacks(sub, index, []string{"dns"})
+	if err == nil || !strings.Contains(err.Error(), "--stack dns is not among the stacks selected") {
+		t.Fatalf("expected stack outside the selection to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"terraform-wrapper/internal/executor"
+	"terraform-wrapper/internal/telemetry"
+)
+
+// telemetrySummary holds the last summary printed by the command so stack
+// counts can be reported without threading them through every RunE.
+var telemetrySummary *executor.Summary
+
+// recordTelemetry sends an anonymous usage event when telemetry is enabled.
+// Failures never affect the command's outcome.
+func recordTelemetry(cmd *cobra.Command, started time.Time, runErr error) {
+	client := telemetry.FromEnv()
+	if client == nil || cmd == nil {
+		return
+	}
+
+	var flags []string
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		flags = append(flags, f.Name)
+	})
+	sort.Strings(flags)
+
+	event := telemetry.Event{
+		InstallationID:  telemetry.InstallationID(),
+		Version:         wrapperVersion,
+		Command:         strings.TrimPrefix(cmd.CommandPath(), rootCmd.Name()+" "),
+		Flags:           flags,
+		DurationSeconds: time.Since(started).Seconds(),
+		ErrorClass:      telemetry.ErrorClass(runErr),
+	}
+	if s := telemetrySummary; s != nil {
+		event.Stacks = s.Executed + s.Cached + s.Skipped + len(s.Failed)
+		event.FailedStacks = len(s.Failed)
+	}
+	if err := client.Send(context.Background(), event); err != nil {
+		fmt.Fprintf(os.Stderr, "[telemetry] warning: %v\n", err)
+	}
+}
@@ -0,0 +1,111 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"terraform-wrapper/internal/audit"
+	"terraform-wrapper/internal/lock"
+	"terraform-wrapper/internal/output"
+)
+
+func newUnlockCommand() *cobra.Command {
+	var (
+		force       bool
+		autoApprove bool
+		reason      string
+	)
+	cmd := &cobra.Command{
+		Use:   "unlock",
+		Short: "Show the holder of an environment's orchestration lock and optionally release it",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := contextWithCmd(cmd)
+			client, err := stateBucketClient(ctx)
+			if err != nil {
+				return err
+			}
+			orchestration := &lock.OrchestrationLock{
+				Bucket:    stateBucketFor(accountID),
+				Env:       environment,
+				Workspace: workspace,
+				Tenant:    tenantName,
+				Client:    client,
+			}
+
+			info, err := orchestration.Describe(ctx)
+			if err != nil {
+				return err
+			}
+			if info == nil {
+				output.Printf("[unlock] %s is not locked\n", environment)
+				return nil
+			}
+			printLockInfo(info)
+			if !force {
+				return nil
+			}
+
+			if !info.Stale {
+				fmt.Fprintf(os.Stderr, "[unlock] warning: the lock is younger than its TTL; make sure %s is no longer running\n", info.Owner)
+			}
+			if !autoApprove {
+				ok, err := confirmUnlock(info)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					output.Println("[unlock] lock not released")
+					return nil
+				}
+			}
+			if err := orchestration.ForceRelease(ctx); err != nil {
+				return err
+			}
+			output.Printf("[unlock] released orchestration lock for %s\n", environment)
+			return auditTrail(client).Record(ctx, audit.Entry{
+				Action: "force-unlock",
+				Reason: reason,
+				Details: map[string]string{
+					"lock_owner":      info.Owner,
+					"lock_command":    info.Command,
+					"lock_caller_arn": info.CallerARN,
+					"locked_at":       info.Timestamp.Format(time.RFC3339),
+				},
+			})
+		},
+	}
+	cmd.Flags().BoolVar(&force, "force", false, "release the lock whoever holds it")
+	cmd.Flags().BoolVar(&autoApprove, "auto-approve", false, "release the lock without asking for confirmation")
+	cmd.Flags().StringVar(&reason, "reason", "", "why the lock is being released, recorded in the audit trail")
+	return cmd
+}
+
+func printLockInfo(info *lock.LockInfo) {
+	output.Printf("[unlock] %s is locked by %s\n", info.Env, info.Owner)
+	if info.CallerARN != "" {
+		output.Printf("[unlock] caller: %s\n", info.CallerARN)
+	}
+	if info.Command != "" {
+		output.Printf("[unlock] command: %s\n", info.Command)
+	}
+	age := time.Since(info.Timestamp).Round(time.Second)
+	status := ""
+	if info.Stale {
+		status = ", stale"
+	}
+	output.Printf("[unlock] since: %s (%s ago%s)\n", info.Timestamp.Format(time.RFC3339), age, status)
+}
+
+func confirmUnlock(info *lock.LockInfo) (bool, error) {
+	output.Printf("Release the lock held by %s? Only 'yes' will be accepted: ", info.Owner)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false, fmt.Errorf("read confirmation: %w", err)
+	}
+	return strings.TrimSpace(answer) == "yes", nil
+}
@@ -0,0 +1,166 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hashicorp/go-version"
+	"github.com/spf13/cobra"
+
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/procmon"
+	"terraform-wrapper/internal/versioning"
+)
+
+func newVersionsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "versions",
+		Short: "Manage the Terraform and OpenTofu versions cached under ~/.terraform-wrapper/versions",
+		// The version cache belongs to the machine rather than an
+		// environment, so none needs to be selected and no AWS access is
+		// needed.
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := applyConfigFile(cmd); err != nil {
+				return err
+			}
+			parsed, err := versioning.ParseEngine(engineName)
+			if err != nil {
+				return fmt.Errorf("--engine: %w", err)
+			}
+			engine = parsed
+			return configureMirrors()
+		},
+	}
+	cmd.AddCommand(newVersionsListCommand())
+	cmd.AddCommand(newVersionsInstallCommand())
+	cmd.AddCommand(newVersionsPruneCommand())
+	return cmd
+}
+
+func newVersionsListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List the cached versions and when each was last used",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cached, err := versioning.ListCached()
+			if err != nil {
+				return err
+			}
+			if len(cached) == 0 {
+				output.Println("[versions] no cached versions")
+				return nil
+			}
+			lock := rootVersionLock()
+			now := time.Now()
+			var total int64
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "ENGINE\tVERSION\tSIZE\tLAST USED\tLOCKED")
+			for _, c := range cached {
+				locked := ""
+				if lock.Pins(c) {
+					locked = "yes"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", c.Engine, c.Version,
+					procmon.FormatBytes(uint64(c.Size)), formatAge(now.Sub(c.LastUsed)), locked)
+				total += c.Size
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+			output.Printf("[versions] %d versions, %s\n", len(cached), procmon.FormatBytes(uint64(total)))
+			return nil
+		},
+	}
+}
+
+func newVersionsInstallCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "install <version>",
+		Short: "Install a version into the cache ahead of time, e.g. before going air-gapped",
+		Long: `Download and cache an exact version of the engine selected with --engine,
+so later runs with --terraform-version or a matching required_version resolve
+it without network access.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v, err := version.NewVersion(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid version %q: %w", args[0], err)
+			}
+			path, err := versioning.Install(contextWithCmd(cmd), engine, releasesMirror, v)
+			if err != nil {
+				return err
+			}
+			output.Printf("[versions] %s %s cached at %s\n", engine.Name(), v, path)
+			return nil
+		},
+	}
+}
+
+func newVersionsPruneCommand() *cobra.Command {
+	var (
+		unusedFor string
+		dryRun    bool
+	)
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove cached versions not used within --unused-for",
+		Long: `Remove cached versions of every engine that no run has resolved within
+--unused-for. The version pinned by the root's .terraform-version.lock.json is
+always kept.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			age, err := parseAge(unusedFor)
+			if err != nil {
+				return fmt.Errorf("--unused-for: %w", err)
+			}
+			cached, err := versioning.ListCached()
+			if err != nil {
+				return err
+			}
+			lock := rootVersionLock()
+			cutoff := time.Now().Add(-age)
+			verb := "removed"
+			if dryRun {
+				verb = "would remove"
+			}
+			var removed int
+			var total int64
+			for _, c := range cached {
+				if !c.LastUsed.Before(cutoff) {
+					continue
+				}
+				if lock.Pins(c) {
+					output.Printf("[versions] keeping %s %s: pinned by the lock file\n", c.Engine.Name(), c.Version)
+					continue
+				}
+				if !dryRun {
+					if err := versioning.RemoveCached(c); err != nil {
+						return err
+					}
+				}
+				output.Printf("[versions] %s %s %s (%s, last used %s ago)\n", verb, c.Engine.Name(), c.Version,
+					procmon.FormatBytes(uint64(c.Size)), formatAge(time.Since(c.LastUsed)))
+				removed++
+				total += c.Size
+			}
+			output.Printf("[versions] %s %d versions, %s\n", verb, removed, procmon.FormatBytes(uint64(total)))
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&unusedFor, "unused-for", "30d", "remove versions last used longer ago than this, e.g. 30d or 720h")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "list the versions that would be removed without removing them")
+	return cmd
+}
+
+// rootVersionLock reads the root's .terraform-version.lock.json. A missing or
+// unreadable lock file pins nothing.
+func rootVersionLock() *versioning.LockFile {
+	lock, err := versioning.ReadLockFile(filepath.Join(rootDir, ".terraform-version.lock.json"))
+	if err != nil {
+		return nil
+	}
+	return lock
+}
@@ -1,13 +1,26 @@
 package main
 
 import (
+	"errors"
 	"log"
+	"os"
 
 	"terraform-wrapper/cmd/terraform-wrapper/commands"
+	"terraform-wrapper/internal/superplan"
 )
 
 func main() {
 	if err := commands.Execute(); err != nil {
-		log.Fatalf("error: %v", err)
+		var coded interface{ ExitCode() int }
+		if !errors.As(err, &coded) {
+			log.Fatalf("error: %v", err)
+		}
+		var changes *superplan.ChangesPresentError
+		if errors.As(err, &changes) {
+			log.Print(err)
+		} else {
+			log.Printf("error: %v", err)
+		}
+		os.Exit(coded.ExitCode())
 	}
 }
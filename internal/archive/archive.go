@@ -0,0 +1,108 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"terraform-wrapper/internal/graph"
+)
+
+// Result describes what archiving a stack changed.
+type Result struct {
+	// Destination is the directory the stack was moved to.
+	Destination string
+	// Dependents lists the stacks whose dependencies.json no longer refers to
+	// the archived stack.
+	Dependents []string
+	// Caches lists the plan cache directories that were deleted.
+	Caches []string
+}
+
+// Archive moves the stack at stackPath to the archive directory under root,
+// keeping its path relative to the root, removes it from the dependencies.json
+// of every stack in g, and deletes its .terraform directory and its plan
+// caches for every environment and workspace. The stack's state must already
+// be empty; Archive does not look at it.
+func Archive(root string, g graph.Graph, stackPath string) (*Result, error) {
+	rootAbs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(rootAbs, stackPath)
+	if err != nil {
+		return nil, err
+	}
+	dest := filepath.Join(rootAbs, graph.ArchiveDir, rel)
+	if _, err := os.Stat(dest); err == nil {
+		return nil, fmt.Errorf("%s is already archived at %s", filepath.ToSlash(rel), dest)
+	}
+
+	result := &Result{Destination: dest}
+	paths := make([]string, 0, len(g))
+	for path := range g {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if path == stackPath {
+			continue
+		}
+		changed, err := graph.RemoveDependency(rootAbs, path, stackPath)
+		if err != nil {
+			return result, err
+		}
+		if changed {
+			result.Dependents = append(result.Dependents, path)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return result, fmt.Errorf("create %s: %w", filepath.Dir(dest), err)
+	}
+	if err := os.Rename(stackPath, dest); err != nil {
+		return result, fmt.Errorf("move %s to the archive: %w", filepath.ToSlash(rel), err)
+	}
+	if err := os.RemoveAll(filepath.Join(dest, ".terraform")); err != nil {
+		return result, fmt.Errorf("remove .terraform of %s: %w", filepath.ToSlash(rel), err)
+	}
+
+	caches, err := planCaches(rootAbs, rel)
+	if err != nil {
+		return result, err
+	}
+	for _, dir := range caches {
+		if err := os.RemoveAll(dir); err != nil {
+			return result, fmt.Errorf("remove plan cache %s: %w", dir, err)
+		}
+		result.Caches = append(result.Caches, dir)
+	}
+	return result, nil
+}
+
+// planCaches finds the plan cache directories of stackRel in every
+// environment and workspace.
+func planCaches(rootAbs, stackRel string) ([]string, error) {
+	cacheRoot := filepath.Join(rootAbs, ".terraform-wrapper", "cache")
+	var dirs []string
+	for _, pattern := range []string{
+		filepath.Join(cacheRoot, "*", stackRel),
+		filepath.Join(cacheRoot, "*", "workspaces", "*", stackRel),
+	} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && info.IsDir() {
+				dirs = append(dirs, match)
+			} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+		}
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
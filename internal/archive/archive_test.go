@@ -0,0 +1,84 @@
+package archive_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/archive"
+	"terraform-wrapper/internal/graph"
+)
+
+func TestArchiveMovesStackAndDetachesDependents(t *testing.T) {
+	root := t.TempDir()
+	write := func(rel, content string) string {
+		dir := filepath.Join(root, rel)
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "dependencies.json"), []byte(content), 0o644))
+		return dir
+	}
+	write("core-services/network", `{}`)
+	legacy := write("core-services/legacy", `{"dependencies": {"paths": ["core-services/network"]}}`)
+	write("applications/web", `{
+  "dependencies": {
+    "paths": ["core-services/network"],
+    "edges": [{"path": "core-services/legacy", "soft": true}]
+  },
+  "tags": ["web"]
+}`)
+	write("applications/worker", `{"dependencies": {"paths": ["core-services/legacy", "core-services/network"]}}`)
+	require.NoError(t, os.MkdirAll(filepath.Join(legacy, ".terraform"), 0o755))
+	cacheDirs := []string{
+		filepath.Join(root, ".terraform-wrapper", "cache", "staging", "core-services", "legacy"),
+		filepath.Join(root, ".terraform-wrapper", "cache", "dev", "workspaces", "pr-1", "core-services", "legacy"),
+	}
+	for _, dir := range cacheDirs {
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+	}
+	networkCache := filepath.Join(root, ".terraform-wrapper", "cache", "staging", "core-services", "network")
+	require.NoError(t, os.MkdirAll(networkCache, 0o755))
+
+	g, err := graph.Build(root)
+	require.NoError(t, err)
+	legacyAbs, err := filepath.Abs(legacy)
+	require.NoError(t, err)
+
+	result, err := archive.Archive(root, g, legacyAbs)
+	require.NoError(t, err)
+	rootAbs, err := filepath.Abs(root)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(rootAbs, "archive", "core-services", "legacy"), result.Destination)
+	require.Equal(t, []string{
+		filepath.Join(rootAbs, "applications", "web"),
+		filepath.Join(rootAbs, "applications", "worker"),
+	}, result.Dependents)
+	require.Len(t, result.Caches, 2)
+
+	require.NoDirExists(t, legacy)
+	require.FileExists(t, filepath.Join(result.Destination, "dependencies.json"))
+	require.NoDirExists(t, filepath.Join(result.Destination, ".terraform"))
+	for _, dir := range cacheDirs {
+		require.NoDirExists(t, dir)
+	}
+	require.DirExists(t, networkCache)
+
+	data, err := os.ReadFile(filepath.Join(root, "applications", "web", "dependencies.json"))
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"tags"`)
+
+	g, err = graph.Build(root)
+	require.NoError(t, err)
+	require.Len(t, g, 3)
+	network := filepath.Join(rootAbs, "core-services", "network")
+	require.Equal(t, []string{network}, g[filepath.Join(rootAbs, "applications", "web")].Dependencies)
+	require.Empty(t, g[filepath.Join(rootAbs, "applications", "web")].Edges)
+	require.Equal(t, []string{network}, g[filepath.Join(rootAbs, "applications", "worker")].Dependencies)
+
+	_, err = archive.Archive(root, g, network)
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(network, 0o755))
+	_, err = archive.Archive(root, g, network)
+	require.ErrorContains(t, err, "already archived")
+}
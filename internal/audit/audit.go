@@ -0,0 +1,114 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3API captures the subset of S3 operations required to publish audit entries.
+type S3API interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// Entry is a single audit record for an operator action against an environment.
+type Entry struct {
+	Timestamp   time.Time         `json:"timestamp"`
+	Environment string            `json:"environment"`
+	Action      string            `json:"action"`
+	Actor       string            `json:"actor"`
+	CallerARN   string            `json:"caller_arn,omitempty"`
+	Reason      string            `json:"reason,omitempty"`
+	Details     map[string]string `json:"details,omitempty"`
+}
+
+// Trail appends entries to .terraform-wrapper/audit/<env>.jsonl and, when a
+// client is configured, mirrors each entry to audit/<env>/ in the bucket.
+type Trail struct {
+	Root        string
+	Environment string
+	Client      S3API
+	Bucket      string
+	// CallerARN is the AWS identity recorded on entries that do not name
+	// one.
+	CallerARN string
+}
+
+// Path returns the local audit log for env.
+func Path(root, env string) string {
+	return filepath.Join(root, ".terraform-wrapper", "audit", env+".jsonl")
+}
+
+// Record stamps and persists entry.
+func (t *Trail) Record(ctx context.Context, entry Entry) error {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now().UTC()
+	}
+	if entry.Environment == "" {
+		entry.Environment = t.Environment
+	}
+	if entry.Actor == "" {
+		entry.Actor = Actor()
+	}
+	if entry.CallerARN == "" {
+		entry.CallerARN = t.CallerARN
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	path := Path(t.Root, entry.Environment)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create audit directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("write audit log: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if t.Client == nil || t.Bucket == "" {
+		return nil
+	}
+	key := fmt.Sprintf("audit/%s/%s-%s.json", entry.Environment, entry.Timestamp.Format("20060102T150405.000000000Z"), entry.Action)
+	_, err = t.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(t.Bucket),
+		Key:         aws.String(key),
+		Body:        strings.NewReader(string(line)),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("publish audit entry: %w", err)
+	}
+	return nil
+}
+
+// Actor identifies who is running the wrapper, preferring CI identities.
+func Actor() string {
+	for _, key := range []string{"GITHUB_ACTOR", "GITLAB_USER_LOGIN", "CI_JOB_NAME"} {
+		if v := os.Getenv(key); v != "" {
+			return v
+		}
+	}
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	host, _ := os.Hostname()
+	return host
+}
@@ -0,0 +1,56 @@
+package audit_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/audit"
+)
+
+type stubS3 struct {
+	keys []string
+}
+
+func (s *stubS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	s.keys = append(s.keys, aws.ToString(params.Key))
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestTrailRecordAppendsAndPublishes(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	client := &stubS3{}
+	trail := &audit.Trail{Root: root, Environment: "prod", Client: client, Bucket: "state", CallerARN: "arn:aws:iam::123456789012:user/alice"}
+
+	ctx := context.Background()
+	require.NoError(t, trail.Record(ctx, audit.Entry{Action: "freeze", Actor: "alice", Reason: "year-end"}))
+	require.NoError(t, trail.Record(ctx, audit.Entry{Action: "break-freeze", Actor: "bob", Reason: "hotfix"}))
+
+	f, err := os.Open(audit.Path(root, "prod"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	var entries []audit.Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e audit.Entry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		entries = append(entries, e)
+	}
+	require.Len(t, entries, 2)
+	require.Equal(t, "prod", entries[1].Environment)
+	require.Equal(t, "hotfix", entries[1].Reason)
+	require.Equal(t, "arn:aws:iam::123456789012:user/alice", entries[1].CallerARN)
+	require.False(t, entries[1].Timestamp.IsZero())
+
+	require.Len(t, client.keys, 2)
+	require.Regexp(t, `^audit/prod/\d{8}T.*-break-freeze\.json$`, client.keys[1])
+}
@@ -9,25 +9,42 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
+// Caller is the identity of the credentials the wrapper runs with.
+type Caller struct {
+	AccountID string
+	// ARN is the caller's user or assumed-role session ARN, for example
+	// arn:aws:sts::123456789012:assumed-role/ci-deploy/session.
+	ARN string
+}
+
 func CallerAccountID(ctx context.Context, region string) (string, error) {
+	caller, err := CallerIdentity(ctx, region)
+	if err != nil {
+		return "", err
+	}
+	return caller.AccountID, nil
+}
+
+// CallerIdentity asks STS who the default credentials belong to.
+func CallerIdentity(ctx context.Context, region string) (Caller, error) {
 	if region == "" {
 		region = "us-east-1"
 	}
 
 	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
 	if err != nil {
-		return "", fmt.Errorf("load AWS config: %w", err)
+		return Caller{}, fmt.Errorf("load AWS config: %w", err)
 	}
 
 	stsClient := sts.NewFromConfig(cfg)
 	resp, err := stsClient.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
 	if err != nil {
-		return "", fmt.Errorf("get caller identity: %w", err)
+		return Caller{}, fmt.Errorf("get caller identity: %w", err)
 	}
 
 	if resp.Account == nil || *resp.Account == "" {
-		return "", fmt.Errorf("caller identity returned empty account")
+		return Caller{}, fmt.Errorf("caller identity returned empty account")
 	}
 
-	return aws.ToString(resp.Account), nil
+	return Caller{AccountID: aws.ToString(resp.Account), ARN: aws.ToString(resp.Arn)}, nil
 }
@@ -0,0 +1,48 @@
+package awsaccount
+
+import (
+	"regexp"
+	"strings"
+)
+
+// RoleARNFromSession returns the IAM role ARN behind an assumed-role session
+// ARN, for example arn:aws:iam::123456789012:role/ci-deploy for
+// arn:aws:sts::123456789012:assumed-role/ci-deploy/session. Other ARNs are
+// returned unchanged. Role paths are not part of session ARNs, so they are
+// lost.
+func RoleARNFromSession(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "sts" {
+		return arn
+	}
+	session, ok := strings.CutPrefix(parts[5], "assumed-role/")
+	if !ok {
+		return arn
+	}
+	role, _, _ := strings.Cut(session, "/")
+	return "arn:" + parts[1] + ":iam::" + parts[4] + ":role/" + role
+}
+
+// MatchARN reports whether the caller ARN matches one of patterns. A pattern
+// matches the ARN itself or, for an assumed-role session, the ARN of its
+// role, so arn:aws:iam::123456789012:role/ci-deploy admits every session of
+// that role. * in a pattern matches any run of characters.
+func MatchARN(arn string, patterns []string) bool {
+	if arn == "" {
+		return false
+	}
+	candidates := []string{arn, RoleARNFromSession(arn)}
+	for _, pattern := range patterns {
+		expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$"
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			continue
+		}
+		for _, candidate := range candidates {
+			if re.MatchString(candidate) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package awsaccount
+
+import "testing"
+
+func TestRoleARNFromSession(t *testing.T) {
+	cases := map[string]string{
+		"arn:aws:sts::123456789012:assumed-role/ci-deploy/gh-1234": "arn:aws:iam::123456789012:role/ci-deploy",
+		"arn:aws:iam::123456789012:user/alice":                     "arn:aws:iam::123456789012:user/alice",
+		"not-an-arn":                                               "not-an-arn",
+	}
+	for arn, want := range cases {
+		if got := RoleARNFromSession(arn); got != want {
+			t.Fatalf("RoleARNFromSession(%q) = %q, want %q", arn, got, want)
+		}
+	}
+}
+
+func TestMatchARN(t *testing.T) {
+	patterns := []string{"arn:aws:iam::123456789012:role/ci-deploy", "arn:aws:iam::*:role/release-*"}
+	cases := map[string]bool{
+		"arn:aws:sts::123456789012:assumed-role/ci-deploy/gh-1234":     true,
+		"arn:aws:sts::210987654321:assumed-role/release-prod/session":  true,
+		"arn:aws:sts::123456789012:assumed-role/ci-deploy-dev/gh-1234": false,
+		"arn:aws:iam::123456789012:user/alice":                         false,
+		"":                                                             false,
+	}
+	for arn, want := range cases {
+		if got := MatchARN(arn, patterns); got != want {
+			t.Fatalf("MatchARN(%q) = %v, want %v", arn, got, want)
+		}
+	}
+}
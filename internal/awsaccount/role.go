@@ -0,0 +1,118 @@
+package awsaccount
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// refreshWindow is how long before expiry cached role credentials are
+// replaced, so a terraform run does not start with credentials about to lapse.
+const refreshWindow = 10 * time.Minute
+
+// AssumeRoleAPI captures the STS operation required to assume a role.
+type AssumeRoleAPI interface {
+	AssumeRole(ctx context.Context, params *sts.AssumeRoleInput, optFns ...func(*sts.Options)) (*sts.AssumeRoleOutput, error)
+}
+
+// RoleAssumer exchanges the caller's credentials for temporary credentials of
+// roles in other accounts. Credentials are cached per role until shortly
+// before they expire, so many stacks in one account share one session.
+type RoleAssumer struct {
+	Region      string
+	SessionName string
+	// Client is created from the default AWS configuration when nil.
+	Client AssumeRoleAPI
+	Now    func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]aws.Credentials
+}
+
+// Credentials returns temporary credentials for roleARN.
+func (a *RoleAssumer) Credentials(ctx context.Context, roleARN string) (aws.Credentials, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now
+	if a.Now != nil {
+		now = a.Now
+	}
+	if creds, ok := a.cache[roleARN]; ok && now().Add(refreshWindow).Before(creds.Expires) {
+		return creds, nil
+	}
+
+	if a.Client == nil {
+		region := a.Region
+		if region == "" {
+			region = "us-east-1"
+		}
+		cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+		if err != nil {
+			return aws.Credentials{}, fmt.Errorf("load AWS config: %w", err)
+		}
+		a.Client = sts.NewFromConfig(cfg)
+	}
+	sessionName := a.SessionName
+	if sessionName == "" {
+		sessionName = "terraform-wrapper"
+	}
+
+	resp, err := a.Client.AssumeRole(ctx, &sts.AssumeRoleInput{
+		RoleArn:         aws.String(roleARN),
+		RoleSessionName: aws.String(sessionName),
+	})
+	if err != nil {
+		return aws.Credentials{}, fmt.Errorf("assume role %s: %w", roleARN, err)
+	}
+	if resp.Credentials == nil {
+		return aws.Credentials{}, fmt.Errorf("assume role %s: response contained no credentials", roleARN)
+	}
+
+	creds := aws.Credentials{
+		AccessKeyID:     aws.ToString(resp.Credentials.AccessKeyId),
+		SecretAccessKey: aws.ToString(resp.Credentials.SecretAccessKey),
+		SessionToken:    aws.ToString(resp.Credentials.SessionToken),
+		CanExpire:       true,
+		Expires:         aws.ToTime(resp.Credentials.Expiration),
+	}
+	if a.cache == nil {
+		a.cache = make(map[string]aws.Credentials)
+	}
+	a.cache[roleARN] = creds
+	return creds, nil
+}
+
+// RoleEnv returns the environment variables that make terraform and its AWS
+// provider act as roleARN.
+func (a *RoleAssumer) RoleEnv(ctx context.Context, roleARN string) (map[string]string, error) {
+	creds, err := a.Credentials(ctx, roleARN)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"AWS_ACCESS_KEY_ID":     creds.AccessKeyID,
+		"AWS_SECRET_ACCESS_KEY": creds.SecretAccessKey,
+		"AWS_SESSION_TOKEN":     creds.SessionToken,
+	}, nil
+}
+
+// AccountIDFromRoleARN returns the account that owns an IAM role, for example
+// 123456789012 for arn:aws:iam::123456789012:role/deploy.
+func AccountIDFromRoleARN(roleARN string) (string, error) {
+	parts := strings.SplitN(roleARN, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "iam" || !strings.HasPrefix(parts[5], "role/") {
+		return "", fmt.Errorf("invalid role ARN %q: expected arn:<partition>:iam::<account>:role/<name>", roleARN)
+	}
+	account := parts[4]
+	if len(account) != 12 || strings.Trim(account, "0123456789") != "" {
+		return "", fmt.Errorf("invalid role ARN %q: account %q is not a 12-digit ID", roleARN, account)
+	}
+	return account, nil
+}
@@ -0,0 +1,77 @@
+package awsaccount
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+type fakeAssumeRole struct {
+	calls   []string
+	expires time.Time
+}
+
+func (f *fakeAssumeRole) AssumeRole(ctx context.Context, params *sts.AssumeRoleInput, optFns ...func(*sts.Options)) (*sts.AssumeRoleOutput, error) {
+	f.calls = append(f.calls, aws.ToString(params.RoleArn))
+	return &sts.AssumeRoleOutput{Credentials: &ststypes.Credentials{
+		AccessKeyId:     aws.String("ASIAEXAMPLE"),
+		SecretAccessKey: aws.String("secret"),
+		SessionToken:    aws.String("token"),
+		Expiration:      aws.Time(f.expires),
+	}}, nil
+}
+
+func TestRoleAssumerCachesUntilNearExpiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	client := &fakeAssumeRole{expires: now.Add(time.Hour)}
+	assumer := &RoleAssumer{Client: client, Now: func() time.Time { return now }}
+
+	const role = "arn:aws:iam::123456789012:role/deploy"
+	env, err := assumer.RoleEnv(ctx, role)
+	if err != nil {
+		t.Fatalf("RoleEnv returned error: %v", err)
+	}
+	if env["AWS_ACCESS_KEY_ID"] != "ASIAEXAMPLE" || env["AWS_SESSION_TOKEN"] != "token" {
+		t.Fatalf("unexpected role environment: %v", env)
+	}
+	if _, err := assumer.RoleEnv(ctx, role); err != nil {
+		t.Fatalf("RoleEnv returned error: %v", err)
+	}
+	if len(client.calls) != 1 {
+		t.Fatalf("expected cached credentials to be reused, got %d AssumeRole calls", len(client.calls))
+	}
+
+	now = now.Add(55 * time.Minute)
+	if _, err := assumer.RoleEnv(ctx, role); err != nil {
+		t.Fatalf("RoleEnv returned error: %v", err)
+	}
+	if len(client.calls) != 2 {
+		t.Fatalf("expected credentials near expiry to be refreshed, got %d AssumeRole calls", len(client.calls))
+	}
+}
+
+func TestAccountIDFromRoleARN(t *testing.T) {
+	account, err := AccountIDFromRoleARN("arn:aws-us-gov:iam::123456789012:role/path/deploy")
+	if err != nil {
+		t.Fatalf("AccountIDFromRoleARN returned error: %v", err)
+	}
+	if account != "123456789012" {
+		t.Fatalf("expected account 123456789012, got %s", account)
+	}
+
+	for _, arn := range []string{
+		"",
+		"arn:aws:iam::123456789012:user/deploy",
+		"arn:aws:s3:::bucket",
+		"arn:aws:iam::12345:role/deploy",
+	} {
+		if _, err := AccountIDFromRoleARN(arn); err == nil {
+			t.Fatalf("expected error for %q", arn)
+		}
+	}
+}
@@ -9,10 +9,11 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/hashicorp/terraform-exec/tfexec"
 	"terraform-wrapper/internal/awsaccount"
+	"terraform-wrapper/internal/logging"
+	"terraform-wrapper/internal/output"
 	"terraform-wrapper/internal/stacks"
 )
 
@@ -22,8 +23,29 @@ type Options struct {
 	Environment   string
 	AccountID     string
 	Region        string
+	// LockTable, when set, locks the bootstrap stack's state with this
+	// DynamoDB table rather than an S3 lock file. The stack is asked to
+	// create it through its state_lock_table variable.
+	LockTable string
+	// Bucket is the state bucket; empty means <account>-<region>-state.
+	// The bootstrap stack's state_bucket_name or state_bucket_id output
+	// takes precedence once it has been applied.
+	Bucket string
+	// StateKey is the key the bootstrap stack's state is migrated to;
+	// empty means <env>/bootstrap/terraform.tfstate.
+	StateKey string
+	// Client inspects the state bucket. Nil means S3 with the caller's
+	// default credentials.
+	Client S3API
+	// LockTables inspects and creates LockTable. Nil means DynamoDB with
+	// the caller's default credentials.
+	LockTables DynamoDBAPI
 }
 
+// lockTableVarFile holds the state_lock_table variable passed to the
+// bootstrap stack when a DynamoDB lock table is used.
+const lockTableVarFile = "terraform-wrapper-bootstrap.tfvars"
+
 func (o *Options) applyDefaults() {
 	if o.RootDir == "" {
 		o.RootDir = "."
@@ -60,13 +82,33 @@ func Run(ctx context.Context, opts Options) error {
 	}
 
 	if _, err := os.Stat(backendPath); err != nil {
-		return fmt.Errorf("backend.tf not found in %s: %w", stateStack, err)
+		if _, disabledErr := os.Stat(disabledBackendPath); disabledErr != nil {
+			return fmt.Errorf("backend.tf not found in %s: %w", stateStack, err)
+		}
+		// An interrupted run left the backend disabled.
+		if err := os.Rename(disabledBackendPath, backendPath); err != nil {
+			return fmt.Errorf("failed to restore backend left disabled by an earlier run: %w", err)
+		}
+		logging.Warnf("[bootstrap] Restored backend.tf left disabled by an earlier run")
 	}
 
 	if _, err := os.Stat(disabledBackendPath); err == nil {
 		return fmt.Errorf("backend already disabled at %s (found existing backend.tf.disabled)", disabledBackendPath)
 	}
 
+	client, err := s3Client(ctx, opts)
+	if err != nil {
+		return err
+	}
+	bootstrapped, err := remoteStateExists(ctx, client, deriveBackendNames(opts), stateKey(opts))
+	if err != nil {
+		return fmt.Errorf("check for an existing backend: %w", err)
+	}
+	if bootstrapped {
+		logging.Infof("[bootstrap] Backend already bootstrapped: s3://%s/%s exists", deriveBackendNames(opts), stateKey(opts))
+		return nil
+	}
+
 	if err := os.Rename(backendPath, disabledBackendPath); err != nil {
 		return fmt.Errorf("failed to disable backend: %w", err)
 	}
@@ -75,7 +117,7 @@ func Run(ctx context.Context, opts Options) error {
 	defer func() {
 		if !restored {
 			if err := os.Rename(disabledBackendPath, backendPath); err != nil {
-				fmt.Fprintf(os.Stderr, "[bootstrap] warning: failed to restore backend.tf: %v\n", err)
+				logging.Warnf("[bootstrap] warning: failed to restore backend.tf: %v", err)
 			}
 		}
 	}()
@@ -88,16 +130,29 @@ func Run(ctx context.Context, opts Options) error {
 	if err != nil {
 		return fmt.Errorf("failed to create terraform executor: %w", err)
 	}
-	tf.SetStdout(os.Stdout)
+	tf.SetStdout(output.Progress())
 	tf.SetStderr(os.Stderr)
 
-	fmt.Println("[bootstrap] Running local apply for backend creation")
+	logging.Infof("[bootstrap] Running local apply for backend creation")
 
 	if err := tf.Init(ctx, tfexec.Backend(false)); err != nil {
 		return fmt.Errorf("local init failed: %w", err)
 	}
 
-	varFiles := stacks.VarFiles(rootAbs, stateStack, opts.Environment)
+	varFiles := stacks.VarFiles(rootAbs, stateStack, opts.Environment, "")
+
+	if opts.LockTable != "" {
+		// A variable the stack does not declare is only a warning when it
+		// comes from a var file, so stacks without a lock table still apply.
+		path := filepath.Join(stateStack, ".terraform", lockTableVarFile)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return fmt.Errorf("create %s: %w", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(fmt.Sprintf("state_lock_table = %q\n", opts.LockTable)), 0o644); err != nil {
+			return fmt.Errorf("write lock table variable: %w", err)
+		}
+		varFiles = append(varFiles, path)
+	}
 
 	applyOpts := make([]tfexec.ApplyOption, 0, len(varFiles))
 	for _, vf := range varFiles {
@@ -109,6 +164,7 @@ func Run(ctx context.Context, opts Options) error {
 	}
 
 	bucketName := deriveBackendNames(opts)
+	lockTable := opts.LockTable
 
 	if outputs, err := tf.Output(ctx); err == nil {
 		if val, ok := extractStringOutput(outputs, "state_bucket_name"); ok {
@@ -117,15 +173,29 @@ func Run(ctx context.Context, opts Options) error {
 		if val, ok := extractStringOutput(outputs, "state_bucket_id"); ok {
 			bucketName = val
 		}
+		if val, ok := extractStringOutput(outputs, "state_lock_table_name"); ok && lockTable != "" {
+			lockTable = val
+		}
 	}
 
-	fmt.Printf("[bootstrap] Waiting for S3 bucket %s to become available...\n", bucketName)
-	if err := waitForS3Bucket(ctx, bucketName, opts.Region); err != nil {
+	logging.Infof("[bootstrap] Waiting for S3 bucket %s to become available...", bucketName)
+	if err := waitForS3Bucket(ctx, client, bucketName); err != nil {
 		return fmt.Errorf("wait for S3 bucket %s: %w", bucketName, err)
 	}
-	fmt.Printf("[bootstrap] Bucket %s is ready\n", bucketName)
+	logging.Infof("[bootstrap] Bucket %s is ready", bucketName)
 
-	fmt.Printf("[bootstrap] Created S3 bucket: %s\n", bucketName)
+	logging.Infof("[bootstrap] Created S3 bucket: %s", bucketName)
+
+	if lockTable != "" {
+		lockClient, err := dynamoDBClient(ctx, opts)
+		if err != nil {
+			return err
+		}
+		logging.Infof("[bootstrap] Waiting for DynamoDB lock table %s to become active...", lockTable)
+		if err := ensureLockTable(ctx, lockClient, lockTable); err != nil {
+			return fmt.Errorf("lock table %s is not usable, local state remains at %s: %w", lockTable, filepath.Join(stateStack, "terraform.tfstate"), err)
+		}
+	}
 
 	if err := os.Rename(disabledBackendPath, backendPath); err != nil {
 		return fmt.Errorf("failed to restore backend: %w", err)
@@ -133,11 +203,16 @@ func Run(ctx context.Context, opts Options) error {
 	restored = true
 
 	backendConfig := map[string]string{
-		"bucket":       bucketName,
-		"key":          fmt.Sprintf("%s/bootstrap/terraform.tfstate", opts.Environment),
-		"region":       opts.Region,
-		"encrypt":      "true",
-		"use_lockfile": "true",
+		"bucket":  bucketName,
+		"key":     stateKey(opts),
+		"region":  opts.Region,
+		"encrypt": "true",
+	}
+	if lockTable != "" {
+		logging.Infof("[bootstrap] Locking state with DynamoDB table %s", lockTable)
+		backendConfig["dynamodb_table"] = lockTable
+	} else {
+		backendConfig["use_lockfile"] = "true"
 	}
 
 	var initOpts []tfexec.InitOption
@@ -146,24 +221,35 @@ func Run(ctx context.Context, opts Options) error {
 	}
 	initOpts = append(initOpts, tfexec.ForceCopy(true))
 
-	fmt.Println("[bootstrap] Migrating local state to remote backend...")
+	logging.Infof("[bootstrap] Migrating local state to remote backend...")
 
 	if err := tf.Init(ctx, initOpts...); err != nil {
-		fmt.Fprintf(os.Stderr, "[bootstrap] migration failed: %v\n", err)
-		fmt.Fprintf(os.Stderr, "[bootstrap] local state remains at %s\n", filepath.Join(stateStack, "terraform.tfstate"))
+		logging.Errorf("[bootstrap] migration failed: %v", err)
+		logging.Errorf("[bootstrap] local state remains at %s", filepath.Join(stateStack, "terraform.tfstate"))
 		return fmt.Errorf("state migration failed: %w", err)
 	}
 
-	fmt.Println("[bootstrap] Backend bootstrapped")
+	logging.Infof("[bootstrap] Backend bootstrapped")
 
 	return nil
 }
 
 func deriveBackendNames(opts Options) string {
+	if opts.Bucket != "" {
+		return opts.Bucket
+	}
 	bucket := fmt.Sprintf("%s-%s-state", opts.AccountID, opts.Region)
 	return bucket
 }
 
+// stateKey returns the key the bootstrap stack's state is migrated to.
+func stateKey(opts Options) string {
+	if opts.StateKey != "" {
+		return opts.StateKey
+	}
+	return fmt.Sprintf("%s/bootstrap/terraform.tfstate", opts.Environment)
+}
+
 func extractStringOutput(outputs map[string]tfexec.OutputMeta, key string) (string, bool) {
 	meta, ok := outputs[key]
 	if !ok {
@@ -176,20 +262,11 @@ func extractStringOutput(outputs map[string]tfexec.OutputMeta, key string) (stri
 	return value, true
 }
 
-func waitForS3Bucket(ctx context.Context, bucket, region string) error {
+func waitForS3Bucket(ctx context.Context, client S3API, bucket string) error {
 	if bucket == "" {
 		return fmt.Errorf("bucket name is empty")
 	}
-	if region == "" {
-		region = "eu-west-2"
-	}
-
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
-	if err != nil {
-		return fmt.Errorf("load AWS config: %w", err)
-	}
 
-	client := s3.NewFromConfig(cfg)
 	timeoutCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
 	defer cancel()
 
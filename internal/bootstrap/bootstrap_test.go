@@ -10,6 +10,12 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 )
 
 func TestRunSuccess(t *testing.T) {
@@ -43,7 +49,7 @@ func TestRunSuccess(t *testing.T) {
 	requests := make(chan *http.Request, 5)
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		requests <- r
-		w.WriteHeader(http.StatusOK)
+		w.WriteHeader(bucketOnlyStatus(r))
 	}))
 	t.Cleanup(server.Close)
 
@@ -107,6 +113,123 @@ func TestRunSuccess(t *testing.T) {
 	}
 }
 
+func TestRunLocksStateWithDynamoDBTable(t *testing.T) {
+	ctx := context.Background()
+	rootDir := t.TempDir()
+
+	stackDir := filepath.Join(rootDir, "core-services", "bootstrap")
+	mustWriteFile(t, filepath.Join(stackDir, "backend.tf"), "terraform {}")
+
+	logPath := filepath.Join(rootDir, "terraform.log")
+	tfPath := newFakeTerraformBinary(t, rootDir, logPath, `{}`, false)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(bucketOnlyStatus(r))
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "us-west-2")
+	t.Setenv("AWS_ENDPOINT_URL_S3", server.URL)
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	opts := Options{
+		RootDir:       rootDir,
+		TerraformPath: tfPath,
+		Environment:   "dev",
+		AccountID:     "123456789012",
+		Region:        "us-west-2",
+		LockTable:     "123456789012-us-west-2-state-lock",
+		LockTables:    &fakeDynamoDB{},
+	}
+	if err := Run(ctx, opts); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if desc := opts.LockTables.(*fakeDynamoDB).tables[opts.LockTable]; desc == nil || lockTableKeyError(opts.LockTable, desc) != nil {
+		t.Fatalf("expected the lock table to be created with a LockID key, got %+v", desc)
+	}
+
+	varFile := filepath.Join(stackDir, ".terraform", lockTableVarFile)
+	if got := readFile(t, varFile); got != "state_lock_table = \"123456789012-us-west-2-state-lock\"\n" {
+		t.Fatalf("unexpected lock table variable file: %q", got)
+	}
+	logContent := readFile(t, logPath)
+	if !strings.Contains(logContent, "-var-file="+varFile) {
+		t.Fatalf("expected apply to pass the lock table variable, log: %s", logContent)
+	}
+	if !strings.Contains(logContent, "-backend-config=dynamodb_table=123456789012-us-west-2-state-lock") {
+		t.Fatalf("expected migration init to lock with the DynamoDB table, log: %s", logContent)
+	}
+	if strings.Contains(logContent, "use_lockfile") {
+		t.Fatalf("expected no S3 lock file with a DynamoDB table, log: %s", logContent)
+	}
+}
+
+func TestRunRejectsLockTableWithoutLockID(t *testing.T) {
+	ctx := context.Background()
+	rootDir := t.TempDir()
+
+	stackDir := filepath.Join(rootDir, "core-services", "bootstrap")
+	mustWriteFile(t, filepath.Join(stackDir, "backend.tf"), "terraform {}")
+
+	logPath := filepath.Join(rootDir, "terraform.log")
+	opts := Options{
+		RootDir:       rootDir,
+		TerraformPath: newFakeTerraformBinary(t, rootDir, logPath, `{}`, false),
+		Environment:   "dev",
+		AccountID:     "123456789012",
+		Region:        "us-west-2",
+		LockTable:     "locks",
+		Client:        &fakeS3{buckets: map[string]bool{"123456789012-us-west-2-state": true}},
+		LockTables: &fakeDynamoDB{tables: map[string]*dynamodbtypes.TableDescription{
+			"locks": lockTable("id", dynamodbtypes.TableStatusActive),
+		}},
+	}
+	err := Run(ctx, opts)
+	if err == nil || !strings.Contains(err.Error(), "partition key LockID") {
+		t.Fatalf("expected a lock table key error, got %v", err)
+	}
+
+	expectFileExists(t, filepath.Join(stackDir, "backend.tf"))
+	expectFileMissing(t, filepath.Join(stackDir, "backend.tf.disabled"))
+	if logContent := readFile(t, logPath); strings.Contains(logContent, "-force-copy") {
+		t.Fatalf("expected no state migration, log: %s", logContent)
+	}
+}
+
+func TestCheckReportsLockTable(t *testing.T) {
+	ctx := context.Background()
+	lockTables := &fakeDynamoDB{}
+	opts := Options{
+		Environment: "dev",
+		AccountID:   "123456789012",
+		Region:      "us-west-2",
+		LockTable:   "locks",
+		Client:      &fakeS3{},
+		LockTables:  lockTables,
+	}
+
+	for _, tc := range []struct {
+		table *dynamodbtypes.TableDescription
+		ok    bool
+	}{
+		{table: nil, ok: false},
+		{table: lockTable(lockTableHashKey, dynamodbtypes.TableStatusCreating), ok: false},
+		{table: lockTable("id", dynamodbtypes.TableStatusActive), ok: false},
+		{table: lockTable(lockTableHashKey, dynamodbtypes.TableStatusActive), ok: true},
+	} {
+		lockTables.tables = map[string]*dynamodbtypes.TableDescription{"locks": tc.table}
+		results, err := Check(ctx, opts)
+		if err != nil {
+			t.Fatalf("Check returned error: %v", err)
+		}
+		last := results[len(results)-1]
+		if last.Name != "lock table" || last.OK != tc.ok {
+			t.Fatalf("expected lock table check ok=%t, got %+v", tc.ok, results)
+		}
+	}
+}
+
 func TestRunRestoresBackendOnApplyFailure(t *testing.T) {
 	ctx := context.Background()
 	rootDir := t.TempDir()
@@ -132,6 +255,7 @@ func TestRunRestoresBackendOnApplyFailure(t *testing.T) {
 		Environment:   "dev",
 		AccountID:     "123456789012",
 		Region:        "us-west-2",
+		Client:        &fakeS3{},
 	}
 
 	err := Run(ctx, opts)
@@ -146,6 +270,107 @@ func TestRunRestoresBackendOnApplyFailure(t *testing.T) {
 	expectFileMissing(t, filepath.Join(stackDir, "backend.tf.disabled"))
 }
 
+func TestRunIsNoOpOnceBootstrapped(t *testing.T) {
+	ctx := context.Background()
+	rootDir := t.TempDir()
+
+	stackDir := filepath.Join(rootDir, "core-services", "bootstrap")
+	// An earlier run was interrupted with the backend disabled.
+	mustWriteFile(t, filepath.Join(stackDir, "backend.tf.disabled"), "terraform {}")
+
+	logPath := filepath.Join(rootDir, "terraform.log")
+	opts := Options{
+		RootDir:       rootDir,
+		TerraformPath: newFakeTerraformBinary(t, rootDir, logPath, `{}`, false),
+		Environment:   "dev",
+		AccountID:     "123456789012",
+		Region:        "us-west-2",
+		Client: &fakeS3{
+			buckets: map[string]bool{"123456789012-us-west-2-state": true},
+			objects: map[string]bool{"123456789012-us-west-2-state/dev/bootstrap/terraform.tfstate": true},
+		},
+	}
+	if err := Run(ctx, opts); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	expectFileExists(t, filepath.Join(stackDir, "backend.tf"))
+	expectFileMissing(t, filepath.Join(stackDir, "backend.tf.disabled"))
+	expectFileMissing(t, logPath)
+}
+
+func TestRunUsesStateKey(t *testing.T) {
+	ctx := context.Background()
+	rootDir := t.TempDir()
+
+	stackDir := filepath.Join(rootDir, "core-services", "bootstrap")
+	mustWriteFile(t, filepath.Join(stackDir, "backend.tf"), "terraform {}")
+
+	client := &fakeS3{
+		buckets: map[string]bool{"123456789012-us-west-2-state": true},
+		objects: map[string]bool{"123456789012-us-west-2-state/dev/bootstrap/terraform.tfstate": true},
+	}
+	logPath := filepath.Join(rootDir, "terraform.log")
+	opts := Options{
+		RootDir:       rootDir,
+		TerraformPath: newFakeTerraformBinary(t, rootDir, logPath, `{}`, false),
+		Environment:   "dev",
+		AccountID:     "123456789012",
+		Region:        "us-west-2",
+		StateKey:      "tfstate/dev/core-services/bootstrap.tfstate",
+		Client:        client,
+	}
+
+	// State at the default key does not count when the key is templated.
+	results, err := Check(ctx, opts)
+	if err != nil {
+		t.Fatalf("Check returned error: %v", err)
+	}
+	if last := results[len(results)-1]; last.Name != "state" || last.OK || !strings.Contains(last.Detail, opts.StateKey) {
+		t.Fatalf("expected a failed state check of %s, got %+v", opts.StateKey, last)
+	}
+
+	if err := Run(ctx, opts); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	logContent := readFile(t, logPath)
+	if !strings.Contains(logContent, "-backend-config=key="+opts.StateKey) {
+		t.Fatalf("expected migration init to target key %s, log: %s", opts.StateKey, logContent)
+	}
+}
+
+func TestCheckReportsBackendSettings(t *testing.T) {
+	ctx := context.Background()
+	opts := Options{Environment: "dev", AccountID: "123456789012", Region: "us-west-2"}
+
+	opts.Client = &fakeS3{}
+	results, err := Check(ctx, opts)
+	if err != nil {
+		t.Fatalf("Check returned error: %v", err)
+	}
+	if len(results) != 1 || results[0].OK || results[0].Name != "bucket" {
+		t.Fatalf("expected only a failed bucket check, got %+v", results)
+	}
+
+	opts.Client = &fakeS3{
+		buckets:    map[string]bool{"123456789012-us-west-2-state": true},
+		encryption: true,
+		versioning: s3types.BucketVersioningStatusSuspended,
+	}
+	results, err = Check(ctx, opts)
+	if err != nil {
+		t.Fatalf("Check returned error: %v", err)
+	}
+	got := map[string]bool{}
+	for _, r := range results {
+		got[r.Name] = r.OK
+	}
+	want := map[string]bool{"bucket": true, "encryption": true, "versioning": false, "policy": false, "state": false}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("expected %v, got %+v", want, results)
+	}
+}
+
 func TestRunFailsWhenBackendMissing(t *testing.T) {
 	ctx := context.Background()
 	rootDir := t.TempDir()
@@ -173,6 +398,90 @@ func TestRunFailsWhenBackendMissing(t *testing.T) {
 	expectFileMissing(t, filepath.Join(stackDir, "backend.tf.disabled"))
 }
 
+// bucketOnlyStatus answers requests for a bucket with 200 and requests for
+// objects in it with 404, so the bucket exists but holds no state yet.
+func bucketOnlyStatus(r *http.Request) int {
+	if strings.Contains(strings.Trim(r.URL.Path, "/"), "/") {
+		return http.StatusNotFound
+	}
+	return http.StatusOK
+}
+
+type fakeS3 struct {
+	buckets    map[string]bool
+	objects    map[string]bool
+	encryption bool
+	versioning s3types.BucketVersioningStatus
+	policy     bool
+}
+
+func (f *fakeS3) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	if !f.buckets[*params.Bucket] {
+		return nil, &smithy.GenericAPIError{Code: "NotFound"}
+	}
+	return &s3.HeadBucketOutput{}, nil
+}
+
+func (f *fakeS3) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if !f.objects[*params.Bucket+"/"+*params.Key] {
+		return nil, &smithy.GenericAPIError{Code: "NotFound"}
+	}
+	return &s3.HeadObjectOutput{}, nil
+}
+
+func (f *fakeS3) GetBucketEncryption(ctx context.Context, params *s3.GetBucketEncryptionInput, optFns ...func(*s3.Options)) (*s3.GetBucketEncryptionOutput, error) {
+	if !f.encryption {
+		return nil, &smithy.GenericAPIError{Code: "ServerSideEncryptionConfigurationNotFoundError"}
+	}
+	return &s3.GetBucketEncryptionOutput{ServerSideEncryptionConfiguration: &s3types.ServerSideEncryptionConfiguration{
+		Rules: []s3types.ServerSideEncryptionRule{{
+			ApplyServerSideEncryptionByDefault: &s3types.ServerSideEncryptionByDefault{SSEAlgorithm: s3types.ServerSideEncryptionAwsKms},
+		}},
+	}}, nil
+}
+
+func (f *fakeS3) GetBucketVersioning(ctx context.Context, params *s3.GetBucketVersioningInput, optFns ...func(*s3.Options)) (*s3.GetBucketVersioningOutput, error) {
+	return &s3.GetBucketVersioningOutput{Status: f.versioning}, nil
+}
+
+func (f *fakeS3) GetBucketPolicy(ctx context.Context, params *s3.GetBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.GetBucketPolicyOutput, error) {
+	if !f.policy {
+		return nil, &smithy.GenericAPIError{Code: "NoSuchBucketPolicy"}
+	}
+	return &s3.GetBucketPolicyOutput{}, nil
+}
+
+type fakeDynamoDB struct {
+	tables map[string]*dynamodbtypes.TableDescription
+}
+
+func (f *fakeDynamoDB) DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	table := f.tables[*params.TableName]
+	if table == nil {
+		return nil, &smithy.GenericAPIError{Code: "ResourceNotFoundException"}
+	}
+	return &dynamodb.DescribeTableOutput{Table: table}, nil
+}
+
+func (f *fakeDynamoDB) CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error) {
+	if f.tables == nil {
+		f.tables = make(map[string]*dynamodbtypes.TableDescription)
+	}
+	f.tables[*params.TableName] = &dynamodbtypes.TableDescription{
+		TableName:   params.TableName,
+		KeySchema:   params.KeySchema,
+		TableStatus: dynamodbtypes.TableStatusActive,
+	}
+	return &dynamodb.CreateTableOutput{}, nil
+}
+
+func lockTable(hashKey string, status dynamodbtypes.TableStatus) *dynamodbtypes.TableDescription {
+	return &dynamodbtypes.TableDescription{
+		KeySchema:   []dynamodbtypes.KeySchemaElement{{AttributeName: &hashKey, KeyType: dynamodbtypes.KeyTypeHash}},
+		TableStatus: status,
+	}
+}
+
 func newFakeTerraformBinary(t *testing.T, dir, logPath, outputJSON string, failApply bool) string {
 	t.Helper()
 
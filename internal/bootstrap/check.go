@@ -0,0 +1,190 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+
+	"terraform-wrapper/internal/awsaccount"
+)
+
+// S3API captures the S3 operations bootstrap uses to inspect the state
+// bucket. None of them change it.
+type S3API interface {
+	HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	GetBucketEncryption(ctx context.Context, params *s3.GetBucketEncryptionInput, optFns ...func(*s3.Options)) (*s3.GetBucketEncryptionOutput, error)
+	GetBucketVersioning(ctx context.Context, params *s3.GetBucketVersioningInput, optFns ...func(*s3.Options)) (*s3.GetBucketVersioningOutput, error)
+	GetBucketPolicy(ctx context.Context, params *s3.GetBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.GetBucketPolicyOutput, error)
+}
+
+// CheckResult is the outcome of one check of the state backend.
+type CheckResult struct {
+	Name   string
+	OK     bool
+	Detail string
+}
+
+// Check validates the environment's state backend without changing anything:
+// that the bucket exists, has default encryption, versioning and a bucket
+// policy, and holds the bootstrap stack's state, and that LockTable, when
+// set, is active. Checks of the bucket's settings are skipped when the
+// bucket does not exist. An error means the
+// checks could not run; failed checks are reported in the results.
+func Check(ctx context.Context, opts Options) ([]CheckResult, error) {
+	opts.applyDefaults()
+	if opts.AccountID == "" {
+		account, err := awsaccount.CallerAccountID(ctx, opts.Region)
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover AWS account ID: %w", err)
+		}
+		opts.AccountID = account
+	}
+	client, err := s3Client(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	bucket := deriveBackendNames(opts)
+	key := stateKey(opts)
+
+	exists, err := bucketExists(ctx, client, bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		results := []CheckResult{{Name: "bucket", Detail: fmt.Sprintf("%s does not exist", bucket)}}
+		return appendLockTableResult(ctx, opts, results)
+	}
+	results := []CheckResult{{Name: "bucket", OK: true, Detail: fmt.Sprintf("%s exists", bucket)}}
+
+	encryption, err := client.GetBucketEncryption(ctx, &s3.GetBucketEncryptionInput{Bucket: aws.String(bucket)})
+	switch {
+	case apiErrorCode(err) == "ServerSideEncryptionConfigurationNotFoundError":
+		results = append(results, CheckResult{Name: "encryption", Detail: "no default encryption"})
+	case err != nil:
+		return nil, fmt.Errorf("get encryption of %s: %w", bucket, err)
+	default:
+		results = append(results, encryptionResult(encryption))
+	}
+
+	versioning, err := client.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return nil, fmt.Errorf("get versioning of %s: %w", bucket, err)
+	}
+	if versioning.Status == s3types.BucketVersioningStatusEnabled {
+		results = append(results, CheckResult{Name: "versioning", OK: true, Detail: "enabled"})
+	} else {
+		status := string(versioning.Status)
+		if status == "" {
+			status = "never enabled"
+		}
+		results = append(results, CheckResult{Name: "versioning", Detail: status})
+	}
+
+	_, err = client.GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{Bucket: aws.String(bucket)})
+	switch {
+	case apiErrorCode(err) == "NoSuchBucketPolicy":
+		results = append(results, CheckResult{Name: "policy", Detail: "no bucket policy"})
+	case err != nil:
+		return nil, fmt.Errorf("get policy of %s: %w", bucket, err)
+	default:
+		results = append(results, CheckResult{Name: "policy", OK: true, Detail: "present"})
+	}
+
+	migrated, err := objectExists(ctx, client, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	if migrated {
+		results = append(results, CheckResult{Name: "state", OK: true, Detail: fmt.Sprintf("s3://%s/%s exists", bucket, key)})
+	} else {
+		results = append(results, CheckResult{Name: "state", Detail: fmt.Sprintf("s3://%s/%s does not exist", bucket, key)})
+	}
+	return appendLockTableResult(ctx, opts, results)
+}
+
+func appendLockTableResult(ctx context.Context, opts Options, results []CheckResult) ([]CheckResult, error) {
+	if opts.LockTable == "" {
+		return results, nil
+	}
+	client, err := dynamoDBClient(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	result, err := lockTableResult(ctx, client, opts.LockTable)
+	if err != nil {
+		return nil, err
+	}
+	return append(results, result), nil
+}
+
+func encryptionResult(out *s3.GetBucketEncryptionOutput) CheckResult {
+	if out.ServerSideEncryptionConfiguration != nil {
+		for _, rule := range out.ServerSideEncryptionConfiguration.Rules {
+			if rule.ApplyServerSideEncryptionByDefault != nil {
+				return CheckResult{Name: "encryption", OK: true, Detail: string(rule.ApplyServerSideEncryptionByDefault.SSEAlgorithm)}
+			}
+		}
+	}
+	return CheckResult{Name: "encryption", Detail: "no default encryption"}
+}
+
+// remoteStateExists reports whether a previous run already bootstrapped the
+// backend: the bucket exists and holds the bootstrap stack's state.
+func remoteStateExists(ctx context.Context, client S3API, bucket, key string) (bool, error) {
+	exists, err := bucketExists(ctx, client, bucket)
+	if err != nil || !exists {
+		return false, err
+	}
+	return objectExists(ctx, client, bucket, key)
+}
+
+func bucketExists(ctx context.Context, client S3API, bucket string) (bool, error) {
+	_, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+	switch apiErrorCode(err) {
+	case "":
+		return true, nil
+	case "NotFound", "NoSuchBucket":
+		return false, nil
+	}
+	return false, fmt.Errorf("check bucket %s: %w", bucket, err)
+}
+
+func objectExists(ctx context.Context, client S3API, bucket, key string) (bool, error) {
+	_, err := client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	switch apiErrorCode(err) {
+	case "":
+		return true, nil
+	case "NotFound", "NoSuchKey":
+		return false, nil
+	}
+	return false, fmt.Errorf("check s3://%s/%s: %w", bucket, key, err)
+}
+
+func s3Client(ctx context.Context, opts Options) (S3API, error) {
+	if opts.Client != nil {
+		return opts.Client, nil
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(opts.Region))
+	if err != nil {
+		return nil, fmt.Errorf("load AWS config: %w", err)
+	}
+	return s3.NewFromConfig(cfg), nil
+}
+
+func apiErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return "Unknown"
+}
@@ -0,0 +1,135 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"terraform-wrapper/internal/logging"
+)
+
+// lockTableHashKey is the partition key the S3 backend writes locks under.
+const lockTableHashKey = "LockID"
+
+// DynamoDBAPI captures the DynamoDB operations bootstrap uses to make sure
+// the state lock table exists.
+type DynamoDBAPI interface {
+	DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error)
+	CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error)
+}
+
+// describeLockTable returns the table, or nil when it does not exist.
+func describeLockTable(ctx context.Context, client DynamoDBAPI, table string) (*dynamodbtypes.TableDescription, error) {
+	out, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	switch apiErrorCode(err) {
+	case "":
+		return out.Table, nil
+	case "ResourceNotFoundException":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("describe lock table %s: %w", table, err)
+}
+
+// lockTableKeyError reports a table the S3 backend cannot lock with because
+// its partition key is not LockID.
+func lockTableKeyError(table string, desc *dynamodbtypes.TableDescription) error {
+	for _, key := range desc.KeySchema {
+		if key.KeyType == dynamodbtypes.KeyTypeHash && aws.ToString(key.AttributeName) == lockTableHashKey {
+			return nil
+		}
+	}
+	return fmt.Errorf("lock table %s must have the partition key %s", table, lockTableHashKey)
+}
+
+// ensureLockTable creates the lock table when the bootstrap stack did not,
+// and waits until it is active so the state migration can lock with it.
+func ensureLockTable(ctx context.Context, client DynamoDBAPI, table string) error {
+	desc, err := describeLockTable(ctx, client, table)
+	if err != nil {
+		return err
+	}
+	if desc == nil {
+		_, err := client.CreateTable(ctx, &dynamodb.CreateTableInput{
+			TableName:   aws.String(table),
+			BillingMode: dynamodbtypes.BillingModePayPerRequest,
+			AttributeDefinitions: []dynamodbtypes.AttributeDefinition{{
+				AttributeName: aws.String(lockTableHashKey),
+				AttributeType: dynamodbtypes.ScalarAttributeTypeS,
+			}},
+			KeySchema: []dynamodbtypes.KeySchemaElement{{
+				AttributeName: aws.String(lockTableHashKey),
+				KeyType:       dynamodbtypes.KeyTypeHash,
+			}},
+		})
+		// A table created concurrently is waited for like any other.
+		if err != nil && apiErrorCode(err) != "ResourceInUseException" {
+			return fmt.Errorf("create lock table %s: %w", table, err)
+		}
+		if err == nil {
+			logging.Infof("[bootstrap] Created DynamoDB lock table %s", table)
+		}
+	} else if err := lockTableKeyError(table, desc); err != nil {
+		return err
+	}
+	return waitForLockTable(ctx, client, table)
+}
+
+func waitForLockTable(ctx context.Context, client DynamoDBAPI, table string) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	status := "missing"
+	for {
+		desc, err := describeLockTable(timeoutCtx, client, table)
+		if err != nil && timeoutCtx.Err() == nil {
+			return err
+		}
+		if desc != nil {
+			if desc.TableStatus == dynamodbtypes.TableStatusActive {
+				return nil
+			}
+			status = string(desc.TableStatus)
+		}
+		select {
+		case <-timeoutCtx.Done():
+			return fmt.Errorf("timeout waiting for lock table %s to become active (status %s): %w", table, status, timeoutCtx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// lockTableResult checks the lock table for Check.
+func lockTableResult(ctx context.Context, client DynamoDBAPI, table string) (CheckResult, error) {
+	desc, err := describeLockTable(ctx, client, table)
+	if err != nil {
+		return CheckResult{}, err
+	}
+	switch {
+	case desc == nil:
+		return CheckResult{Name: "lock table", Detail: fmt.Sprintf("%s does not exist", table)}, nil
+	case lockTableKeyError(table, desc) != nil:
+		return CheckResult{Name: "lock table", Detail: fmt.Sprintf("%s has no %s partition key", table, lockTableHashKey)}, nil
+	case desc.TableStatus != dynamodbtypes.TableStatusActive:
+		return CheckResult{Name: "lock table", Detail: fmt.Sprintf("%s is %s", table, desc.TableStatus)}, nil
+	}
+	return CheckResult{Name: "lock table", OK: true, Detail: fmt.Sprintf("%s is active", table)}, nil
+}
+
+func dynamoDBClient(ctx context.Context, opts Options) (DynamoDBAPI, error) {
+	if opts.LockTables != nil {
+		return opts.LockTables, nil
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(opts.Region))
+	if err != nil {
+		return nil, fmt.Errorf("load AWS config: %w", err)
+	}
+	return dynamodb.NewFromConfig(cfg), nil
+}
@@ -9,17 +9,30 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 )
 
-func PlanDir(root, env, stackRel string) string {
-	return filepath.Join(root, ".terraform-wrapper", "cache", env, stackRel)
+// PlanDir returns the cache directory for a stack. A non-empty workspace
+// scopes the cache under <env>/workspaces/<workspace>, matching the state and
+// lock keys used in workspace mode. With a tenant, env is its tenant.Scope.
+func PlanDir(root, env, workspace, stackRel string) string {
+	if workspace != "" {
+		return filepath.Join(Dir(root), env, "workspaces", workspace, stackRel)
+	}
+	return filepath.Join(Dir(root), env, stackRel)
 }
 
-func PlanFiles(root, env, stackRel string) (planPath, hashPath string) {
-	dir := PlanDir(root, env, stackRel)
+func PlanFiles(root, env, workspace, stackRel string) (planPath, hashPath string) {
+	dir := PlanDir(root, env, workspace, stackRel)
 	return filepath.Join(dir, "plan.tfplan"), filepath.Join(dir, "plan.hash")
 }
 
+// DestroyPlanFile returns where a stack's destroy plan is written. It is kept
+// apart from the regular plan so a teardown preview never replaces it.
+func DestroyPlanFile(root, env, workspace, stackRel string) string {
+	return filepath.Join(PlanDir(root, env, workspace, stackRel), "destroy.tfplan")
+}
+
 func SaveHash(path string, hash []byte) error {
 	if err := ensureDir(filepath.Dir(path)); err != nil {
 		return err
@@ -40,8 +53,32 @@ func LoadHash(path string) ([]byte, error) {
 	return decoded[:n], nil
 }
 
-func ComputeHash(files []string) ([]byte, error) {
+// SaveChanges records next to hashPath whether the cached plan has changes, so
+// a cache hit can still report them.
+func SaveChanges(hashPath string, changed bool) error {
+	return os.WriteFile(changesPath(hashPath), []byte(strconv.FormatBool(changed)), 0o644)
+}
+
+// LoadChanges reports whether the cached plan next to hashPath has changes.
+// Plans cached without a marker are treated as changed.
+func LoadChanges(hashPath string) bool {
+	data, err := os.ReadFile(changesPath(hashPath))
+	if err != nil {
+		return true
+	}
+	changed, err := strconv.ParseBool(string(data))
+	return err != nil || changed
+}
+
+func changesPath(hashPath string) string {
+	return filepath.Join(filepath.Dir(hashPath), "plan.changes")
+}
+
+// ComputeHash hashes the contents of files and the Terraform version plans
+// are made with, since a plan from another version may not apply.
+func ComputeHash(files []string, terraformVersion string) ([]byte, error) {
 	h := sha256.New()
+	h.Write([]byte("terraform " + terraformVersion + "\x00"))
 	sorted := append([]string(nil), files...)
 	sort.Strings(sorted)
 	for _, path := range sorted {
@@ -70,6 +107,9 @@ func hashFile(h hash.Hash, path string) error {
 	return nil
 }
 
+// StackContentFiles lists the files a stack's plan depends on: its .tf and
+// .tfvars files, its dependency lock file, every file of the local modules it
+// calls, and extras such as var files outside the stack.
 func StackContentFiles(stackDir string, extras []string) ([]string, error) {
 	var files []string
 	err := filepath.WalkDir(stackDir, func(path string, d fs.DirEntry, err error) error {
@@ -83,7 +123,7 @@ func StackContentFiles(stackDir string, extras []string) ([]string, error) {
 			return nil
 		}
 		ext := filepath.Ext(path)
-		if ext == ".tf" || ext == ".tfvars" {
+		if ext == ".tf" || ext == ".tfvars" || d.Name() == LockFileName {
 			files = append(files, path)
 		}
 		return nil
@@ -91,6 +131,31 @@ func StackContentFiles(stackDir string, extras []string) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	modules, err := LocalModuleDirs(stackDir)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(files))
+	for _, path := range files {
+		seen[path] = true
+	}
+	for _, dir := range modules {
+		// A missing module is left for terraform to report.
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		moduleFiles, err := moduleFiles(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range moduleFiles {
+			if !seen[path] {
+				seen[path] = true
+				files = append(files, path)
+			}
+		}
+	}
 	files = append(files, extras...)
 	return files, nil
 }
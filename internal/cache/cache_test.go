@@ -15,12 +15,15 @@ func TestPlanDirAndFiles(t *testing.T) {
 	t.Parallel()
 
 	root := "/workspace"
-	dir := cache.PlanDir(root, "dev", "core-services/network")
+	dir := cache.PlanDir(root, "dev", "", "core-services/network")
 	require.Equal(t, filepath.Join(root, ".terraform-wrapper", "cache", "dev", "core-services/network"), dir)
 
-	plan, hash := cache.PlanFiles(root, "dev", "core-services/network")
+	plan, hash := cache.PlanFiles(root, "dev", "", "core-services/network")
 	require.Equal(t, filepath.Join(dir, "plan.tfplan"), plan)
 	require.Equal(t, filepath.Join(dir, "plan.hash"), hash)
+
+	scoped := cache.PlanDir(root, "dev", "feature-x", "core-services/network")
+	require.Equal(t, filepath.Join(root, ".terraform-wrapper", "cache", "dev", "workspaces", "feature-x", "core-services/network"), scoped)
 }
 
 func TestSaveAndLoadHash(t *testing.T) {
@@ -37,6 +40,19 @@ func TestSaveAndLoadHash(t *testing.T) {
 	require.Equal(t, original, loaded)
 }
 
+func TestSaveAndLoadChanges(t *testing.T) {
+	t.Parallel()
+
+	hashPath := filepath.Join(t.TempDir(), "plan.hash")
+	require.True(t, cache.LoadChanges(hashPath), "missing marker counts as changed")
+
+	require.NoError(t, cache.SaveChanges(hashPath, false))
+	require.False(t, cache.LoadChanges(hashPath))
+
+	require.NoError(t, cache.SaveChanges(hashPath, true))
+	require.True(t, cache.LoadChanges(hashPath))
+}
+
 func TestComputeHashDetectsChanges(t *testing.T) {
 	t.Parallel()
 
@@ -48,20 +64,25 @@ func TestComputeHashDetectsChanges(t *testing.T) {
 	writeFile(t, fileA, "resource \"null_resource\" \"a\" {}")
 	writeFile(t, fileB, "foo = \"bar\"")
 
-	firstHash, err := cache.ComputeHash([]string{fileA, fileB})
+	firstHash, err := cache.ComputeHash([]string{fileA, fileB}, "1.7.5")
 	require.NoError(t, err)
 	require.Len(t, firstHash, 32)
 
 	// Reordering should not affect hash.
-	secondHash, err := cache.ComputeHash([]string{fileB, fileA})
+	secondHash, err := cache.ComputeHash([]string{fileB, fileA}, "1.7.5")
 	require.NoError(t, err)
 	require.Equal(t, firstHash, secondHash)
 
 	// Modifying a file should change hash.
 	writeFile(t, fileB, "foo = \"baz\"")
-	thirdHash, err := cache.ComputeHash([]string{fileA, fileB})
+	thirdHash, err := cache.ComputeHash([]string{fileA, fileB}, "1.7.5")
 	require.NoError(t, err)
 	require.NotEqual(t, firstHash, thirdHash)
+
+	// Planning with another Terraform version should change hash.
+	otherVersion, err := cache.ComputeHash([]string{fileA, fileB}, "1.8.0")
+	require.NoError(t, err)
+	require.NotEqual(t, thirdHash, otherVersion)
 }
 
 func TestStackContentFiles(t *testing.T) {
@@ -101,6 +122,57 @@ func TestStackContentFiles(t *testing.T) {
 	require.Equal(t, extras[0], collected[len(collected)-1])
 }
 
+func TestStackContentFilesIncludesLockFileAndLocalModules(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	stackDir := filepath.Join(root, "stacks", "app")
+	writeFile(t, filepath.Join(stackDir, "main.tf"), `
+module "service" {
+  source = "../../modules/service"
+}
+
+module "vpc" {
+  source  = "terraform-aws-modules/vpc/aws"
+  version = "5.0.0"
+}
+`)
+	writeFile(t, filepath.Join(stackDir, ".terraform.lock.hcl"), "# lock")
+	writeFile(t, filepath.Join(root, "modules", "service", "main.tf"), `
+module "policy" {
+  source = "./policy"
+}
+`)
+	writeFile(t, filepath.Join(root, "modules", "service", "user-data.sh.tpl"), "#!/bin/sh")
+	writeFile(t, filepath.Join(root, "modules", "service", "policy", "main.tf"), "locals {}")
+	writeFile(t, filepath.Join(root, "modules", "service", ".terraform", "ignored.tf"), "ignored")
+	writeFile(t, filepath.Join(root, "modules", "unused", "main.tf"), "locals {}")
+
+	dirs, err := cache.LocalModuleDirs(stackDir)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		filepath.Join(root, "modules", "service"),
+		filepath.Join(root, "modules", "service", "policy"),
+	}, dirs)
+
+	collected, err := cache.StackContentFiles(stackDir, nil)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{
+		filepath.Join(stackDir, "main.tf"),
+		filepath.Join(stackDir, ".terraform.lock.hcl"),
+		filepath.Join(root, "modules", "service", "main.tf"),
+		filepath.Join(root, "modules", "service", "user-data.sh.tpl"),
+		filepath.Join(root, "modules", "service", "policy", "main.tf"),
+	}, collected)
+
+	before, err := cache.ComputeHash(collected, "1.7.5")
+	require.NoError(t, err)
+	writeFile(t, filepath.Join(root, "modules", "service", "policy", "main.tf"), "locals { changed = true }")
+	after, err := cache.ComputeHash(collected, "1.7.5")
+	require.NoError(t, err)
+	require.NotEqual(t, before, after, "editing a shared module busts the cache")
+}
+
 func writeFile(t *testing.T, path, body string) {
 	t.Helper()
 	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
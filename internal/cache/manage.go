@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"terraform-wrapper/internal/tenant"
+)
+
+// Dir returns the root of the local plan cache.
+func Dir(root string) string {
+	return filepath.Join(root, ".terraform-wrapper", "cache")
+}
+
+// Entry is the cache of one stack in one environment and workspace: its
+// plans, their hash and changes markers.
+type Entry struct {
+	Tenant      string
+	Environment string
+	Workspace   string
+	Stack       string
+	Dir         string
+	Files       int
+	Size        int64
+	// Modified is when the newest file of the entry was written.
+	Modified time.Time
+}
+
+// List returns the cache entries of env, or of every environment when env is
+// empty, sorted by environment, workspace and stack. Only the entries of
+// tenantName are listed, or those kept outside any tenant when it is empty.
+func List(root, tenantName, env string) ([]Entry, error) {
+	cacheDir := filepath.Join(Dir(root), filepath.FromSlash(tenant.Scope(tenantName, "")))
+	envs, err := os.ReadDir(cacheDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, e := range envs {
+		if !e.IsDir() || (env != "" && e.Name() != env) || (tenantName == "" && e.Name() == tenant.Dir) {
+			continue
+		}
+		envDir := filepath.Join(cacheDir, e.Name())
+		err := filepath.WalkDir(envDir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return err
+			}
+			entry, ok, err := readEntry(path)
+			if err != nil || !ok {
+				return err
+			}
+			rel, err := filepath.Rel(envDir, path)
+			if err != nil {
+				return err
+			}
+			entry.Tenant = tenantName
+			entry.Environment = e.Name()
+			entry.Stack = filepath.ToSlash(rel)
+			if parts := strings.SplitN(entry.Stack, "/", 3); len(parts) == 3 && parts[0] == "workspaces" {
+				entry.Workspace, entry.Stack = parts[1], parts[2]
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("list plan cache: %w", err)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Environment != b.Environment {
+			return a.Environment < b.Environment
+		}
+		if a.Workspace != b.Workspace {
+			return a.Workspace < b.Workspace
+		}
+		return a.Stack < b.Stack
+	})
+	return entries, nil
+}
+
+// readEntry sums the files directly in dir, which is an entry when it has any.
+// Subdirectories belong to nested stacks.
+func readEntry(dir string) (Entry, bool, error) {
+	children, err := os.ReadDir(dir)
+	if err != nil {
+		return Entry{}, false, err
+	}
+	entry := Entry{Dir: dir}
+	for _, child := range children {
+		if !child.Type().IsRegular() {
+			continue
+		}
+		info, err := child.Info()
+		if err != nil {
+			return Entry{}, false, err
+		}
+		entry.Files++
+		entry.Size += info.Size()
+		if info.ModTime().After(entry.Modified) {
+			entry.Modified = info.ModTime()
+		}
+	}
+	return entry, entry.Files > 0, nil
+}
+
+// Remove deletes the files of entries, keeping the directories of nested
+// stacks, and then every cache directory left empty.
+func Remove(root string, entries []Entry) error {
+	for _, entry := range entries {
+		children, err := os.ReadDir(entry.Dir)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		for _, child := range children {
+			if child.IsDir() {
+				continue
+			}
+			if err := os.Remove(filepath.Join(entry.Dir, child.Name())); err != nil {
+				return fmt.Errorf("remove cached plan of %s: %w", entry.Stack, err)
+			}
+		}
+		removeEmptyParents(Dir(root), entry.Dir)
+	}
+	return nil
+}
+
+// removeEmptyParents removes dir and its parents below cacheDir while they
+// are empty.
+func removeEmptyParents(cacheDir, dir string) {
+	for dir != cacheDir && strings.HasPrefix(dir, cacheDir+string(filepath.Separator)) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
@@ -0,0 +1,73 @@
+package cache_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/cache"
+	"terraform-wrapper/internal/tenant"
+)
+
+func TestListAndRemoveEntries(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	write := func(env, workspace, stack string, age time.Duration) {
+		plan, hash := cache.PlanFiles(root, env, workspace, stack)
+		require.NoError(t, os.MkdirAll(filepath.Dir(plan), 0o755))
+		require.NoError(t, os.WriteFile(plan, []byte("plan"), 0o644))
+		require.NoError(t, cache.SaveHash(hash, []byte{0x01}))
+		modified := time.Now().Add(-age)
+		require.NoError(t, os.Chtimes(plan, modified, modified))
+		require.NoError(t, os.Chtimes(hash, modified, modified))
+	}
+	write("dev", "", "core-services/network", 10*24*time.Hour)
+	write("dev", "", "core-services/network/peering", time.Hour)
+	write("dev", "feature-x", "applications/frontend", time.Hour)
+	write("prod", "", "core-services/network", time.Hour)
+	write(tenant.Scope("payments", "dev"), "", "payments/api", time.Hour)
+
+	entries, err := cache.List(root, "", "dev")
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.Equal(t, "core-services/network", entries[0].Stack)
+	require.Equal(t, 2, entries[0].Files)
+	require.EqualValues(t, 6, entries[0].Size)
+	require.WithinDuration(t, time.Now().Add(-10*24*time.Hour), entries[0].Modified, time.Minute)
+	require.Equal(t, "core-services/network/peering", entries[1].Stack)
+	require.Equal(t, "feature-x", entries[2].Workspace)
+	require.Equal(t, "applications/frontend", entries[2].Stack)
+
+	all, err := cache.List(root, "", "")
+	require.NoError(t, err)
+	require.Len(t, all, 4)
+
+	// A tenant's plans are listed apart from everyone else's.
+	owned, err := cache.List(root, "payments", "dev")
+	require.NoError(t, err)
+	require.Len(t, owned, 1)
+	require.Equal(t, "payments", owned[0].Tenant)
+	require.Equal(t, "dev", owned[0].Environment)
+	require.Equal(t, "payments/api", owned[0].Stack)
+
+	// Removing a stack keeps the plans of the stacks nested below it.
+	require.NoError(t, cache.Remove(root, entries[:1]))
+	entries, err = cache.List(root, "", "dev")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, "core-services/network/peering", entries[0].Stack)
+
+	require.NoError(t, cache.Remove(root, entries))
+	_, err = os.Stat(filepath.Join(cache.Dir(root), "dev"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+	_, err = os.Stat(cache.PlanDir(root, "prod", "", "core-services/network"))
+	require.NoError(t, err)
+
+	empty, err := cache.List(t.TempDir(), "", "dev")
+	require.NoError(t, err)
+	require.Empty(t, empty)
+}
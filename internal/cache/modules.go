@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// LockFileName is the dependency lock file pinning a stack's providers.
+const LockFileName = ".terraform.lock.hcl"
+
+// LocalModuleDirs returns the local module directories stackDir calls,
+// directly or through other local modules: those whose source is a path
+// starting with ./ or ../. Registry and remote modules are pinned by version
+// and left out. Files that fail to parse are skipped; terraform reports them.
+func LocalModuleDirs(stackDir string) ([]string, error) {
+	seen := map[string]bool{}
+	var dirs []string
+	queue := []string{stackDir}
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+		sources, err := localModuleSources(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, source := range sources {
+			moduleDir := filepath.Clean(filepath.Join(dir, filepath.FromSlash(source)))
+			if seen[moduleDir] || moduleDir == filepath.Clean(stackDir) {
+				continue
+			}
+			seen[moduleDir] = true
+			dirs = append(dirs, moduleDir)
+			queue = append(queue, moduleDir)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// localModuleSources returns the local sources of the module blocks in the
+// .tf files of dir.
+func localModuleSources(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+	var sources []string
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		file, diags := hclsyntax.ParseConfig(src, path, hcl.InitialPos)
+		if diags.HasErrors() {
+			continue
+		}
+		body, ok := file.Body.(*hclsyntax.Body)
+		if !ok {
+			continue
+		}
+		for _, block := range body.Blocks {
+			if block.Type != "module" {
+				continue
+			}
+			attr, ok := block.Body.Attributes["source"]
+			if !ok {
+				continue
+			}
+			value, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() || !value.Type().Equals(cty.String) || value.IsNull() {
+				continue
+			}
+			source := value.AsString()
+			if strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../") {
+				sources = append(sources, source)
+			}
+		}
+	}
+	return sources, nil
+}
+
+// moduleFiles returns every file of a local module, since templates and
+// policy documents it reads change its plans as much as its .tf files do.
+func moduleFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
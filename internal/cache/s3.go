@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Plan cache backends selectable with --cache-backend.
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// Key identifies a cached plan: the stack it was planned for and the hash of
+// everything the plan depends on. Environment is the tenant.Scope of the
+// environment when a tenant is set.
+type Key struct {
+	Environment string
+	Workspace   string
+	Stack       string
+	Hash        []byte
+}
+
+func (k Key) path() string {
+	env := k.Environment
+	if k.Workspace != "" {
+		env = path.Join(env, "workspaces", k.Workspace)
+	}
+	return path.Join(env, filepath.ToSlash(k.Stack), hex.EncodeToString(k.Hash))
+}
+
+// Remote is a plan cache shared between machines. The local cache under
+// .terraform-wrapper/cache stays the working copy: plans are fetched into it
+// on a local miss and published after they are made, so runners on
+// ephemeral machines reuse each other's plans.
+type Remote interface {
+	// Fetch writes the plan cached under key to planPath and reports whether
+	// it has changes; found is false when there is none.
+	Fetch(ctx context.Context, key Key, planPath string) (changed, found bool, err error)
+	// Store publishes the plan at planPath under key.
+	Store(ctx context.Context, key Key, planPath string, changed bool) error
+	// Invalidate removes the plan cached under key once it is applied.
+	Invalidate(ctx context.Context, key Key) error
+}
+
+// S3API captures the subset of S3 operations required by the S3 plan cache.
+type S3API interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+}
+
+// changesMetadata is the object metadata recording whether a plan has changes.
+const changesMetadata = "changes"
+
+// S3 keeps plans in a bucket under <prefix>/<env>/<stack>/<hash>/plan.tfplan.
+// Plans are keyed by their hash, so an object is never replaced by a plan of
+// other content and a bucket lifecycle rule can expire old ones.
+type S3 struct {
+	Client S3API
+	Bucket string
+	// Prefix defaults to "plan-cache".
+	Prefix string
+}
+
+func (c *S3) key(key Key) string {
+	prefix := c.Prefix
+	if prefix == "" {
+		prefix = "plan-cache"
+	}
+	return path.Join(prefix, key.path(), "plan.tfplan")
+}
+
+func (c *S3) Fetch(ctx context.Context, key Key, planPath string) (changed, found bool, err error) {
+	out, err := c.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(c.Bucket),
+		Key:    aws.String(c.key(key)),
+	})
+	if err != nil {
+		var noKey *s3types.NoSuchKey
+		if errors.As(err, &noKey) {
+			return false, false, nil
+		}
+		return false, false, fmt.Errorf("fetch cached plan for %s: %w", key.Stack, err)
+	}
+	defer func() {
+		if cerr := out.Body.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("fetch cached plan for %s: %w", key.Stack, cerr)
+		}
+	}()
+
+	if err := ensureDir(filepath.Dir(planPath)); err != nil {
+		return false, false, err
+	}
+	// Write next to planPath and rename, so an interrupted download never
+	// leaves a truncated plan in the local cache.
+	tmp, err := os.CreateTemp(filepath.Dir(planPath), ".plan-*.tfplan")
+	if err != nil {
+		return false, false, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, out.Body); err != nil {
+		_ = tmp.Close()
+		return false, false, fmt.Errorf("fetch cached plan for %s: %w", key.Stack, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return false, false, err
+	}
+	if err := os.Rename(tmp.Name(), planPath); err != nil {
+		return false, false, err
+	}
+
+	changed, parseErr := strconv.ParseBool(out.Metadata[changesMetadata])
+	return parseErr != nil || changed, true, nil
+}
+
+func (c *S3) Store(ctx context.Context, key Key, planPath string, changed bool) (err error) {
+	f, err := os.Open(planPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	_, err = c.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:   aws.String(c.Bucket),
+		Key:      aws.String(c.key(key)),
+		Body:     f,
+		Metadata: map[string]string{changesMetadata: strconv.FormatBool(changed)},
+	})
+	if err != nil {
+		return fmt.Errorf("store cached plan for %s: %w", key.Stack, err)
+	}
+	return nil
+}
+
+func (c *S3) Invalidate(ctx context.Context, key Key) error {
+	_, err := c.Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(c.Bucket),
+		Key:    aws.String(c.key(key)),
+	})
+	if err != nil {
+		return fmt.Errorf("invalidate cached plan for %s: %w", key.Stack, err)
+	}
+	return nil
+}
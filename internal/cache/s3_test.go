@@ -0,0 +1,93 @@
+package cache_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/cache"
+)
+
+type memoryS3 struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	metadata map[string]map[string]string
+}
+
+func newMemoryS3() *memoryS3 {
+	return &memoryS3{objects: map[string][]byte{}, metadata: map[string]map[string]string{}}
+}
+
+func (m *memoryS3) PutObject(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[aws.ToString(params.Key)] = body
+	m.metadata[aws.ToString(params.Key)] = params.Metadata
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (m *memoryS3) GetObject(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	body, ok := m.objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &s3types.NoSuchKey{}
+	}
+	return &s3.GetObjectOutput{
+		Body:     io.NopCloser(bytes.NewReader(body)),
+		Metadata: m.metadata[aws.ToString(params.Key)],
+	}, nil
+}
+
+func (m *memoryS3) DeleteObject(_ context.Context, params *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, aws.ToString(params.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func TestS3StoresAndFetchesPlansByHash(t *testing.T) {
+	ctx := context.Background()
+	client := newMemoryS3()
+	remote := &cache.S3{Client: client, Bucket: "ci-cache"}
+	key := cache.Key{Environment: "dev", Workspace: "pr-12", Stack: "core/network", Hash: []byte{0xab, 0xcd}}
+
+	dir := t.TempDir()
+	planPath := filepath.Join(dir, "plan.tfplan")
+	require.NoError(t, os.WriteFile(planPath, []byte("plan"), 0o644))
+	require.NoError(t, remote.Store(ctx, key, planPath, false))
+	require.Contains(t, client.objects, "plan-cache/dev/workspaces/pr-12/core/network/abcd/plan.tfplan")
+
+	fetched := filepath.Join(dir, "other", "plan.tfplan")
+	changed, found, err := remote.Fetch(ctx, key, fetched)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.False(t, changed)
+	data, err := os.ReadFile(fetched)
+	require.NoError(t, err)
+	require.Equal(t, "plan", string(data))
+
+	other := key
+	other.Hash = []byte{0x01}
+	_, found, err = remote.Fetch(ctx, other, fetched)
+	require.NoError(t, err)
+	require.False(t, found)
+
+	require.NoError(t, remote.Invalidate(ctx, key))
+	_, found, err = remote.Fetch(ctx, key, fetched)
+	require.NoError(t, err)
+	require.False(t, found)
+}
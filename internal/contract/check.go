@@ -0,0 +1,114 @@
+package contract
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Violation is an output a stack consumes that its upstream does not produce.
+type Violation struct {
+	// Stack is the consuming stack and Consumption what it reads.
+	Stack       string
+	Consumption Consumption
+	// Removed is set when the upstream produced the output in the previous
+	// contracts, so the output was removed rather than never declared.
+	Removed bool
+}
+
+// Check returns the consumed outputs that current upstreams do not produce.
+// Upstreams missing from current, such as stacks left out by a filter, are
+// not checked. previous, which may be nil, tells removed outputs apart.
+func Check(current, previous []Contract) []Violation {
+	produced := outputsByStack(current)
+	before := outputsByStack(previous)
+
+	var violations []Violation
+	for _, c := range current {
+		for _, consumed := range c.Consumes {
+			outputs, ok := produced[consumed.Stack]
+			if !ok || outputs[consumed.Output] {
+				continue
+			}
+			violations = append(violations, Violation{
+				Stack:       c.Stack,
+				Consumption: consumed,
+				Removed:     before[consumed.Stack][consumed.Output],
+			})
+		}
+	}
+	return violations
+}
+
+// Removed returns, per stack, the outputs produced in previous but no longer
+// in current, whether or not anything consumes them.
+func Removed(current, previous []Contract) map[string][]string {
+	produced := outputsByStack(current)
+	removed := make(map[string][]string)
+	for _, c := range previous {
+		outputs, ok := produced[c.Stack]
+		if !ok {
+			continue
+		}
+		for _, output := range c.Outputs {
+			if !outputs[output] {
+				removed[c.Stack] = append(removed[c.Stack], output)
+			}
+		}
+	}
+	return removed
+}
+
+func outputsByStack(contracts []Contract) map[string]map[string]bool {
+	byStack := make(map[string]map[string]bool, len(contracts))
+	for _, c := range contracts {
+		outputs := make(map[string]bool, len(c.Outputs))
+		for _, output := range c.Outputs {
+			outputs[output] = true
+		}
+		byStack[c.Stack] = outputs
+	}
+	return byStack
+}
+
+// Report describes violations grouped by the upstream output they break,
+// one line per consumer.
+func Report(violations []Violation) string {
+	type missing struct {
+		stack, output string
+	}
+	groups := make(map[missing][]Violation)
+	var keys []missing
+	for _, v := range violations {
+		key := missing{v.Consumption.Stack, v.Consumption.Output}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], v)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].stack != keys[j].stack {
+			return keys[i].stack < keys[j].stack
+		}
+		return keys[i].output < keys[j].output
+	})
+
+	var b strings.Builder
+	b.WriteString("consumed outputs are not produced by their stacks:\n")
+	for _, key := range keys {
+		group := groups[key]
+		state := "is not declared"
+		if group[0].Removed {
+			state = "was removed"
+		}
+		fmt.Fprintf(&b, "  %s: output %q %s but is consumed by\n", key.stack, key.output, state)
+		for _, v := range group {
+			fmt.Fprintf(&b, "    - %s via %s", v.Stack, v.Consumption.Via)
+			if v.Consumption.Location != "" {
+				fmt.Fprintf(&b, " (%s)", v.Consumption.Location)
+			}
+			b.WriteString("\n")
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
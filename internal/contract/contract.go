@@ -0,0 +1,250 @@
+// Package contract derives each stack's interface from its configuration: the
+// variables it declares, the outputs it produces and the upstream outputs it
+// consumes. Comparing consumers against producers, and against the contracts
+// recorded by an earlier run, catches outputs removed while dependents still
+// read them before anything is planned.
+package contract
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+
+	"terraform-wrapper/internal/graph"
+)
+
+// Ways a stack consumes an upstream output.
+const (
+	ViaRemoteState      = "terraform_remote_state"
+	ViaRequiredOutputs  = "required_outputs"
+	ViaPropagateOutputs = "propagate_outputs"
+)
+
+// Contract is a stack's interface. Stacks are paths relative to the root.
+type Contract struct {
+	Stack     string   `json:"stack"`
+	Variables []string `json:"variables,omitempty"`
+	Outputs   []string `json:"outputs,omitempty"`
+	// RemoteStates lists the stacks whose state the stack reads.
+	RemoteStates []string      `json:"remote_states,omitempty"`
+	Consumes     []Consumption `json:"consumes,omitempty"`
+}
+
+// Consumption is an upstream output a stack reads.
+type Consumption struct {
+	Stack  string `json:"stack"`
+	Output string `json:"output"`
+	Via    string `json:"via"`
+	// Location is the file and line of a terraform_remote_state reference,
+	// relative to the consuming stack.
+	Location string `json:"location,omitempty"`
+}
+
+// Build derives the contract of every stack in g, sorted by stack.
+func Build(root string, g graph.Graph) ([]Contract, error) {
+	rootAbs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	rel := func(path string) string {
+		r, err := filepath.Rel(rootAbs, path)
+		if err != nil {
+			return filepath.ToSlash(path)
+		}
+		return filepath.ToSlash(r)
+	}
+
+	contracts := make([]Contract, 0, len(g))
+	for path, stack := range g {
+		c := Contract{Stack: rel(path)}
+		bodies, err := parseStackFiles(path)
+		if err != nil {
+			return nil, err
+		}
+		sources := make(map[string]string, len(stack.RemoteStates))
+		for name, dep := range stack.RemoteStates {
+			sources[name] = rel(dep)
+		}
+		for _, file := range bodies {
+			for _, block := range file.body.Blocks {
+				if len(block.Labels) == 0 {
+					continue
+				}
+				switch block.Type {
+				case "variable":
+					c.Variables = append(c.Variables, block.Labels[0])
+				case "output":
+					c.Outputs = append(c.Outputs, block.Labels[0])
+				}
+			}
+			c.Consumes = append(c.Consumes, remoteStateReads(file, sources)...)
+		}
+		for _, dep := range stack.RemoteStateRefs {
+			c.RemoteStates = append(c.RemoteStates, rel(dep))
+		}
+		for dep, edge := range stack.Edges {
+			for _, output := range edge.RequiredOutputs {
+				c.Consumes = append(c.Consumes, Consumption{Stack: rel(dep), Output: output, Via: ViaRequiredOutputs})
+			}
+			for _, output := range edge.PropagateOutputs {
+				c.Consumes = append(c.Consumes, Consumption{Stack: rel(dep), Output: output, Via: ViaPropagateOutputs})
+			}
+		}
+		c.normalize()
+		contracts = append(contracts, c)
+	}
+	sort.Slice(contracts, func(i, j int) bool { return contracts[i].Stack < contracts[j].Stack })
+	return contracts, nil
+}
+
+func (c *Contract) normalize() {
+	sort.Strings(c.Variables)
+	sort.Strings(c.Outputs)
+	sort.Strings(c.RemoteStates)
+	sort.Slice(c.Consumes, func(i, j int) bool {
+		a, b := c.Consumes[i], c.Consumes[j]
+		if a.Stack != b.Stack {
+			return a.Stack < b.Stack
+		}
+		if a.Output != b.Output {
+			return a.Output < b.Output
+		}
+		if a.Via != b.Via {
+			return a.Via < b.Via
+		}
+		return a.Location < b.Location
+	})
+}
+
+type stackFile struct {
+	name string
+	body *hclsyntax.Body
+}
+
+// parseStackFiles parses the top-level .tf files of stackDir. Files that fail
+// to parse are skipped; terraform reports them when the stack runs.
+func parseStackFiles(stackDir string) ([]stackFile, error) {
+	paths, err := filepath.Glob(filepath.Join(stackDir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	var files []stackFile
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		file, diags := hclsyntax.ParseConfig(src, filepath.Base(path), hcl.InitialPos)
+		if diags.HasErrors() {
+			continue
+		}
+		if body, ok := file.Body.(*hclsyntax.Body); ok {
+			files = append(files, stackFile{name: filepath.Base(path), body: body})
+		}
+	}
+	return files, nil
+}
+
+// remoteStateReads finds references such as
+// data.terraform_remote_state.network.outputs.vpc_id in file, for the data
+// sources in sources, which maps their names to the stacks they read. Uses
+// of the whole outputs object name no output and are not reported.
+func remoteStateReads(file stackFile, sources map[string]string) []Consumption {
+	var reads []Consumption
+	_ = hclsyntax.VisitAll(file.body, func(node hclsyntax.Node) hcl.Diagnostics {
+		expr, ok := node.(*hclsyntax.ScopeTraversalExpr)
+		if !ok {
+			return nil
+		}
+		name, output, ok := remoteStateOutput(expr.Traversal)
+		if !ok {
+			return nil
+		}
+		upstream, ok := sources[name]
+		if !ok {
+			return nil
+		}
+		reads = append(reads, Consumption{
+			Stack:    upstream,
+			Output:   output,
+			Via:      ViaRemoteState,
+			Location: fmt.Sprintf("%s:%d", file.name, expr.SrcRange.Start.Line),
+		})
+		return nil
+	})
+	return reads
+}
+
+// remoteStateOutput returns the data source and output named by a traversal
+// of the form data.terraform_remote_state.<name>[<index>].outputs.<output>.
+func remoteStateOutput(traversal hcl.Traversal) (string, string, bool) {
+	steps := make([]string, 0, 5)
+	for i, step := range traversal {
+		// Anything after the output is an attribute of its value.
+		if len(steps) == 5 {
+			break
+		}
+		switch s := step.(type) {
+		case hcl.TraverseRoot:
+			steps = append(steps, s.Name)
+		case hcl.TraverseAttr:
+			steps = append(steps, s.Name)
+		case hcl.TraverseIndex:
+			// The instance key of a data source with count or for_each.
+			if i == 3 {
+				continue
+			}
+			if s.Key.Type() != cty.String || !s.Key.IsKnown() || s.Key.IsNull() {
+				return "", "", false
+			}
+			steps = append(steps, s.Key.AsString())
+		default:
+			return "", "", false
+		}
+	}
+	if len(steps) < 5 || steps[0] != "data" || steps[1] != "terraform_remote_state" || steps[3] != "outputs" {
+		return "", "", false
+	}
+	return steps[2], steps[4], true
+}
+
+// SnapshotPath is where the contracts of the last checked run are recorded.
+func SnapshotPath(root string) string {
+	return filepath.Join(root, ".terraform-wrapper", "contracts.json")
+}
+
+// Load reads the contracts recorded at path; none is not an error.
+func Load(path string) ([]Contract, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var contracts []Contract
+	if err := json.Unmarshal(data, &contracts); err != nil {
+		return nil, fmt.Errorf("invalid contract snapshot %s: %w", path, err)
+	}
+	return contracts, nil
+}
+
+// Save records contracts at path.
+func Save(path string, contracts []Contract) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(contracts, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,131 @@
+package contract_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/contract"
+	"terraform-wrapper/internal/graph"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+// writeStacks lays out a network stack whose outputs an app stack reads
+// through terraform_remote_state and declares under required_outputs.
+func writeStacks(t *testing.T, root, networkOutputs string) {
+	t.Helper()
+	writeFile(t, filepath.Join(root, "network", "dependencies.json"), `{"dependencies": {"paths": []}}`)
+	writeFile(t, filepath.Join(root, "network", "main.tf"), `
+variable "cidr" {}
+`+networkOutputs)
+	writeFile(t, filepath.Join(root, "app", "dependencies.json"), `{"dependencies": {"edges": [
+  {"path": "./network", "required_outputs": ["vpc_id"]}
+]}}`)
+	writeFile(t, filepath.Join(root, "app", "main.tf"), `variable "image" {}
+variable "replicas" {}
+
+data "terraform_remote_state" "network" {
+  backend = "s3"
+  config = {
+    key = "${var.environment}/network/terraform.tfstate"
+  }
+}
+
+locals {
+  vpc    = data.terraform_remote_state.network.outputs.vpc_id
+  subnet = data.terraform_remote_state.network.outputs["subnet_ids"][0]
+  all    = data.terraform_remote_state.network.outputs
+}
+
+output "url" {
+  value = "https://${local.vpc}"
+}
+`)
+}
+
+func build(t *testing.T, root string) []contract.Contract {
+	t.Helper()
+	g, err := graph.Build(root)
+	require.NoError(t, err)
+	contracts, err := contract.Build(root, g)
+	require.NoError(t, err)
+	return contracts
+}
+
+func TestBuildDerivesContracts(t *testing.T) {
+	root := t.TempDir()
+	writeStacks(t, root, `
+output "vpc_id" { value = "vpc-1" }
+output "subnet_ids" { value = ["subnet-1"] }
+`)
+
+	contracts := build(t, root)
+	require.Equal(t, []contract.Contract{
+		{
+			Stack:        "app",
+			Variables:    []string{"image", "replicas"},
+			Outputs:      []string{"url"},
+			RemoteStates: []string{"network"},
+			Consumes: []contract.Consumption{
+				{Stack: "network", Output: "subnet_ids", Via: contract.ViaRemoteState, Location: "main.tf:13"},
+				{Stack: "network", Output: "vpc_id", Via: contract.ViaRequiredOutputs},
+				{Stack: "network", Output: "vpc_id", Via: contract.ViaRemoteState, Location: "main.tf:12"},
+			},
+		},
+		{
+			Stack:     "network",
+			Variables: []string{"cidr"},
+			Outputs:   []string{"subnet_ids", "vpc_id"},
+		},
+	}, contracts)
+	require.Empty(t, contract.Check(contracts, nil))
+
+	markdown := contract.Markdown(contracts)
+	require.Contains(t, markdown, "- `vpc_id`, consumed by app\n")
+	require.Contains(t, markdown, "- `subnet_ids` of network via terraform_remote_state (main.tf:13)\n")
+}
+
+func TestCheckReportsRemovedOutputsStillConsumed(t *testing.T) {
+	root := t.TempDir()
+	writeStacks(t, root, `
+output "vpc_id" { value = "vpc-1" }
+output "subnet_ids" { value = ["subnet-1"] }
+output "cidr" { value = var.cidr }
+`)
+	previous := build(t, root)
+
+	writeStacks(t, root, `
+output "subnet_ids" { value = ["subnet-1"] }
+`)
+	current := build(t, root)
+
+	violations := contract.Check(current, previous)
+	require.Len(t, violations, 2)
+	require.True(t, violations[0].Removed)
+	require.Equal(t, map[string][]string{"network": {"cidr", "vpc_id"}}, contract.Removed(current, previous))
+	require.Equal(t, `consumed outputs are not produced by their stacks:
+  network: output "vpc_id" was removed but is consumed by
+    - app via required_outputs
+    - app via terraform_remote_state (main.tf:12)`, contract.Report(violations))
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	path := contract.SnapshotPath(root)
+	previous, err := contract.Load(path)
+	require.NoError(t, err)
+	require.Nil(t, previous)
+
+	contracts := []contract.Contract{{Stack: "network", Outputs: []string{"vpc_id"}}}
+	require.NoError(t, contract.Save(path, contracts))
+	loaded, err := contract.Load(path)
+	require.NoError(t, err)
+	require.Equal(t, contracts, loaded)
+}
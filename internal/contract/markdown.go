@@ -0,0 +1,67 @@
+package contract
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Markdown documents contracts, one section per stack, listing which stacks
+// consume each output.
+func Markdown(contracts []Contract) string {
+	consumers := make(map[string]map[string][]string)
+	for _, c := range contracts {
+		for _, consumed := range c.Consumes {
+			if consumers[consumed.Stack] == nil {
+				consumers[consumed.Stack] = make(map[string][]string)
+			}
+			stacks := consumers[consumed.Stack][consumed.Output]
+			if len(stacks) == 0 || stacks[len(stacks)-1] != c.Stack {
+				consumers[consumed.Stack][consumed.Output] = append(stacks, c.Stack)
+			}
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("# Stack Contracts\n")
+	for _, c := range contracts {
+		fmt.Fprintf(&b, "\n## %s\n\n", c.Stack)
+		fmt.Fprintf(&b, "Variables: %s\n\n", codeList(c.Variables))
+		if len(c.Outputs) == 0 {
+			b.WriteString("Outputs: none\n")
+		} else {
+			b.WriteString("Outputs:\n\n")
+			for _, output := range c.Outputs {
+				fmt.Fprintf(&b, "- `%s`", output)
+				if stacks := consumers[c.Stack][output]; len(stacks) > 0 {
+					fmt.Fprintf(&b, ", consumed by %s", strings.Join(stacks, ", "))
+				}
+				b.WriteString("\n")
+			}
+		}
+		if len(c.RemoteStates) > 0 {
+			fmt.Fprintf(&b, "\nReads the state of: %s\n", strings.Join(c.RemoteStates, ", "))
+		}
+		if len(c.Consumes) > 0 {
+			b.WriteString("\nConsumes:\n\n")
+			for _, consumed := range c.Consumes {
+				fmt.Fprintf(&b, "- `%s` of %s via %s", consumed.Output, consumed.Stack, consumed.Via)
+				if consumed.Location != "" {
+					fmt.Fprintf(&b, " (%s)", consumed.Location)
+				}
+				b.WriteString("\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+func codeList(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = "`" + name + "`"
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,99 @@
+package cost
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+)
+
+// Estimator prices the changes of a Terraform plan.
+type Estimator interface {
+	// Estimate returns the monthly cost delta of every priced resource in
+	// the JSON plan at planPath.
+	Estimate(ctx context.Context, planPath string) (*Estimate, error)
+}
+
+// Estimate is the monthly cost delta of a plan's resources.
+type Estimate struct {
+	Currency  string
+	Resources []Resource
+}
+
+// Resource is the monthly cost delta of one resource address; negative when
+// the plan makes the resource cheaper or removes it.
+type Resource struct {
+	Address      string
+	MonthlyDelta float64
+}
+
+// Infracost prices plans with the infracost CLI, which reads the pricing API
+// key from INFRACOST_API_KEY or its own configuration.
+type Infracost struct {
+	// Binary is the infracost executable; "infracost" on PATH when empty.
+	Binary string
+}
+
+// Estimate runs infracost breakdown on the JSON plan at planPath.
+func (i *Infracost) Estimate(ctx context.Context, planPath string) (*Estimate, error) {
+	binary := i.Binary
+	if binary == "" {
+		binary = "infracost"
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, binary, "breakdown", "--path", planPath, "--format", "json", "--log-level", "warn")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("infracost breakdown: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return ParseInfracost(stdout.Bytes())
+}
+
+// infracostOutput is the subset of infracost's JSON output the estimate is
+// read from. Costs are decimal strings, or null when a resource has no price.
+type infracostOutput struct {
+	Currency string `json:"currency"`
+	Projects []struct {
+		Diff struct {
+			Resources []struct {
+				Name        string  `json:"name"`
+				MonthlyCost *string `json:"monthlyCost"`
+			} `json:"resources"`
+		} `json:"diff"`
+	} `json:"projects"`
+}
+
+// ParseInfracost reads the per-resource monthly cost deltas from the output
+// of infracost breakdown --format json. Resources without a price are left
+// out.
+func ParseInfracost(data []byte) (*Estimate, error) {
+	var out infracostOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("invalid infracost output: %w", err)
+	}
+	estimate := &Estimate{Currency: out.Currency}
+	for _, project := range out.Projects {
+		for _, res := range project.Diff.Resources {
+			if res.MonthlyCost == nil {
+				continue
+			}
+			delta, err := strconv.ParseFloat(*res.MonthlyCost, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid monthly cost %q for %s: %w", *res.MonthlyCost, res.Name, err)
+			}
+			estimate.Resources = append(estimate.Resources, Resource{Address: res.Name, MonthlyDelta: delta})
+		}
+	}
+	return estimate, nil
+}
+
+// Format renders a monthly cost delta with its sign, such as "+12.34 USD/month".
+func Format(delta float64, currency string) string {
+	if currency == "" {
+		currency = "USD"
+	}
+	return fmt.Sprintf("%+.2f %s/month", delta, currency)
+}
@@ -0,0 +1,40 @@
+package cost_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/cost"
+)
+
+func TestParseInfracostReadsResourceDeltas(t *testing.T) {
+	t.Parallel()
+
+	estimate, err := cost.ParseInfracost([]byte(`{
+  "currency": "USD",
+  "projects": [{
+    "diff": {
+      "resources": [
+        {"name": "aws_instance.network_nat", "monthlyCost": "32.85"},
+        {"name": "module.app_cluster.aws_ecs_service.api", "monthlyCost": "-12.5"},
+        {"name": "aws_iam_role.app_task", "monthlyCost": null}
+      ]
+    }
+  }]
+}`))
+	require.NoError(t, err)
+	require.Equal(t, &cost.Estimate{
+		Currency: "USD",
+		Resources: []cost.Resource{
+			{Address: "aws_instance.network_nat", MonthlyDelta: 32.85},
+			{Address: "module.app_cluster.aws_ecs_service.api", MonthlyDelta: -12.5},
+		},
+	}, estimate)
+
+	require.Equal(t, "+32.85 USD/month", cost.Format(32.85, "USD"))
+	require.Equal(t, "-12.50 EUR/month", cost.Format(-12.5, "EUR"))
+
+	_, err = cost.ParseInfracost([]byte(`{"projects": [{"diff": {"resources": [{"name": "x", "monthlyCost": "n/a"}]}}]}`))
+	require.ErrorContains(t, err, "invalid monthly cost")
+}
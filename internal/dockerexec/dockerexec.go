@@ -0,0 +1,139 @@
+package dockerexec
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Options describes the container used in place of a local terraform binary.
+type Options struct {
+	Image          string
+	RootDir        string
+	PluginCacheDir string
+	// Mounts lists additional host directories shared with the container at the
+	// same path, such as the temporary directory used by superplan.
+	Mounts []string
+}
+
+// ShimDir returns the directory holding the generated terraform shims.
+func ShimDir(root string) string {
+	return filepath.Join(root, ".terraform-wrapper", "docker")
+}
+
+// shimPath returns where the shim with this script is written. Shims are
+// named after a hash of their script, so concurrent runs using different
+// images or mounts never overwrite each other's shim.
+func shimPath(root, script string) string {
+	sum := sha256.Sum256([]byte(script))
+	return filepath.Join(ShimDir(root), hex.EncodeToString(sum[:])[:16], "terraform")
+}
+
+// DefaultPluginCacheDir honours TF_PLUGIN_CACHE_DIR and otherwise falls back to
+// Terraform's conventional per-user plugin cache.
+func DefaultPluginCacheDir() (string, error) {
+	if dir := os.Getenv("TF_PLUGIN_CACHE_DIR"); dir != "" {
+		return filepath.Abs(dir)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("determine user home: %w", err)
+	}
+	return filepath.Join(home, ".terraform.d", "plugin-cache"), nil
+}
+
+// WriteShim writes an executable script that runs terraform inside the
+// configured image. The repository root, plugin cache and extra mounts are
+// bind-mounted at identical paths so plan files, var files and the working
+// directory chosen by terraform-exec resolve unchanged inside the container.
+func WriteShim(opts Options) (string, error) {
+	if opts.Image == "" {
+		return "", fmt.Errorf("docker image must not be empty")
+	}
+	rootAbs, err := filepath.Abs(opts.RootDir)
+	if err != nil {
+		return "", err
+	}
+	pluginCache := opts.PluginCacheDir
+	if pluginCache == "" {
+		if pluginCache, err = DefaultPluginCacheDir(); err != nil {
+			return "", err
+		}
+	}
+	if err := os.MkdirAll(pluginCache, 0o755); err != nil {
+		return "", fmt.Errorf("create plugin cache %s: %w", pluginCache, err)
+	}
+
+	mounts := map[string]struct{}{rootAbs: {}, pluginCache: {}}
+	for _, m := range opts.Mounts {
+		abs, err := filepath.Abs(m)
+		if err != nil {
+			return "", err
+		}
+		mounts[abs] = struct{}{}
+	}
+	sortedMounts := make([]string, 0, len(mounts))
+	for m := range mounts {
+		sortedMounts = append(sortedMounts, m)
+	}
+	sort.Strings(sortedMounts)
+
+	script := shimScript(opts.Image, pluginCache, sortedMounts)
+	path := shimPath(rootAbs, script)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("create shim directory: %w", err)
+	}
+	// Another run may be executing the same shim, so it is replaced
+	// atomically rather than rewritten in place.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".terraform-*")
+	if err != nil {
+		return "", fmt.Errorf("write docker shim: %w", err)
+	}
+	_, err = tmp.WriteString(script)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o755)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", fmt.Errorf("write docker shim: %w", err)
+	}
+	return path, nil
+}
+
+func shimScript(image, pluginCache string, mounts []string) string {
+	var b strings.Builder
+	b.WriteString("#!/usr/bin/env bash\n")
+	b.WriteString("# Generated by terraform-wrapper --exec-docker; do not edit.\n")
+	b.WriteString("set -euo pipefail\n\n")
+	b.WriteString(`args=(run --rm -i -u "$(id -u):$(id -g)" -w "$(pwd)" -e HOME=/tmp)` + "\n")
+	for _, m := range mounts {
+		fmt.Fprintf(&b, "args+=(-v %s)\n", quote(m+":"+m))
+	}
+	fmt.Fprintf(&b, "args+=(-e %s)\n", quote("TF_PLUGIN_CACHE_DIR="+pluginCache))
+	b.WriteString(`if [ -d "$HOME/.aws" ]; then
+  args+=(-v "$HOME/.aws:/tmp/.aws:ro")
+fi
+while IFS='=' read -r name _; do
+  case "$name" in
+    TF_PLUGIN_CACHE_DIR) ;;
+    AWS_*|TF_*|CHECKPOINT_DISABLE) args+=(-e "$name") ;;
+  esac
+done < <(env)
+`)
+	fmt.Fprintf(&b, "exec docker \"${args[@]}\" %s \"$@\"\n", quote(image))
+	return b.String()
+}
+
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
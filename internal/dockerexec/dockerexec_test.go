@@ -0,0 +1,87 @@
+package dockerexec_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/dockerexec"
+)
+
+func TestWriteShimRunsTerraformInContainer(t *testing.T) {
+	root := t.TempDir()
+	pluginCache := filepath.Join(t.TempDir(), "plugins")
+	stackDir := filepath.Join(root, "core-services", "network")
+	require.NoError(t, os.MkdirAll(stackDir, 0o755))
+
+	binDir := t.TempDir()
+	fakeDocker := "#!/bin/sh\nfor a in \"$@\"; do echo \"$a\"; done\n"
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "docker"), []byte(fakeDocker), 0o755))
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("AWS_PROFILE", "prod")
+
+	shim, err := dockerexec.WriteShim(dockerexec.Options{
+		Image:          "hashicorp/terraform:1.6.6",
+		RootDir:        root,
+		PluginCacheDir: pluginCache,
+	})
+	require.NoError(t, err)
+	require.Equal(t, dockerexec.ShimDir(root), filepath.Dir(filepath.Dir(shim)))
+	require.DirExists(t, pluginCache)
+
+	cmd := exec.Command(shim, "plan", "-out=plan.tfplan")
+	cmd.Dir = stackDir
+	out, err := cmd.Output()
+	require.NoError(t, err)
+
+	args := strings.Split(strings.TrimSpace(string(out)), "\n")
+	require.Equal(t, "run", args[0])
+	require.Contains(t, args, root+":"+root)
+	require.Contains(t, args, pluginCache+":"+pluginCache)
+	require.Contains(t, args, "TF_PLUGIN_CACHE_DIR="+pluginCache)
+	require.Contains(t, args, "AWS_PROFILE")
+
+	workdir := args[indexOf(args, "-w")+1]
+	resolvedStack, err := filepath.EvalSymlinks(stackDir)
+	require.NoError(t, err)
+	require.Equal(t, resolvedStack, workdir)
+
+	require.Equal(t, []string{"hashicorp/terraform:1.6.6", "plan", "-out=plan.tfplan"}, args[len(args)-3:])
+}
+
+func TestWriteShimKeepsShimsOfDifferentImagesApart(t *testing.T) {
+	root := t.TempDir()
+	pluginCache := filepath.Join(t.TempDir(), "plugins")
+
+	write := func(image string) string {
+		shim, err := dockerexec.WriteShim(dockerexec.Options{Image: image, RootDir: root, PluginCacheDir: pluginCache})
+		require.NoError(t, err)
+		return shim
+	}
+	older := write("hashicorp/terraform:1.6.6")
+	newer := write("hashicorp/terraform:1.8.2")
+	require.NotEqual(t, older, newer)
+	require.Equal(t, older, write("hashicorp/terraform:1.6.6"))
+
+	script, err := os.ReadFile(older)
+	require.NoError(t, err)
+	require.Contains(t, string(script), "'hashicorp/terraform:1.6.6'")
+}
+
+func TestWriteShimRequiresImage(t *testing.T) {
+	_, err := dockerexec.WriteShim(dockerexec.Options{RootDir: t.TempDir()})
+	require.Error(t, err)
+}
+
+func indexOf(values []string, target string) int {
+	for i, v := range values {
+		if v == target {
+			return i
+		}
+	}
+	return -1
+}
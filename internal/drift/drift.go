@@ -0,0 +1,208 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"terraform-wrapper/internal/graph"
+	"terraform-wrapper/internal/output"
+)
+
+// Planner runs a refresh-only plan for a stack directory.
+type Planner interface {
+	RefreshOnlyPlan(ctx context.Context, stackDir string) (*tfjson.Plan, error)
+}
+
+// Options configures Detect.
+type Options struct {
+	RootDir     string
+	Environment string
+	Parallelism int
+	Planner     Planner
+}
+
+// Resource is a resource whose real infrastructure differs from state.
+type Resource struct {
+	Address string   `json:"address"`
+	Type    string   `json:"type"`
+	Actions []string `json:"actions"`
+}
+
+// StackResult is the drift detected for a single stack.
+type StackResult struct {
+	Stack     string     `json:"stack"`
+	Drifted   bool       `json:"drifted"`
+	Resources []Resource `json:"resources,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// Report aggregates drift across stacks.
+type Report struct {
+	GeneratedAt time.Time     `json:"generated_at"`
+	Environment string        `json:"environment"`
+	Stacks      []StackResult `json:"stacks"`
+}
+
+// Drifted returns the stacks with drift, sorted.
+func (r *Report) Drifted() []string {
+	var out []string
+	for _, s := range r.Stacks {
+		if s.Drifted {
+			out = append(out, s.Stack)
+		}
+	}
+	return out
+}
+
+// Failed returns the stacks whose drift check could not run, keyed by stack.
+func (r *Report) Failed() map[string]string {
+	out := make(map[string]string)
+	for _, s := range r.Stacks {
+		if s.Error != "" {
+			out[s.Stack] = s.Error
+		}
+	}
+	return out
+}
+
+// Resources returns the drifted resources recorded in a refresh-only plan,
+// sorted by address.
+func Resources(plan *tfjson.Plan) []Resource {
+	if plan == nil {
+		return nil
+	}
+	var out []Resource
+	for _, rc := range plan.ResourceDrift {
+		if rc == nil || rc.Change == nil || rc.Change.Actions.NoOp() {
+			continue
+		}
+		actions := make([]string, 0, len(rc.Change.Actions))
+		for _, a := range rc.Change.Actions {
+			actions = append(actions, string(a))
+		}
+		out = append(out, Resource{Address: rc.Address, Type: rc.Type, Actions: actions})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Address < out[j].Address })
+	return out
+}
+
+// Detect runs a refresh-only plan for every stack, up to Parallelism at a
+// time. Refresh-only plans do not depend on each other, so stacks are not
+// ordered by dependency. Per-stack failures are recorded in the report rather
+// than aborting the run.
+func Detect(ctx context.Context, stacks []*graph.Stack, opts Options) (*Report, error) {
+	if opts.Planner == nil {
+		return nil, fmt.Errorf("drift planner not configured")
+	}
+	if opts.Parallelism < 1 {
+		opts.Parallelism = 1
+	}
+	rootAbs, err := filepath.Abs(opts.RootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]StackResult, len(stacks))
+	sem := make(chan struct{}, opts.Parallelism)
+	var wg sync.WaitGroup
+	for i, stack := range stacks {
+		rel, err := filepath.Rel(rootAbs, stack.Path)
+		if err != nil {
+			return nil, err
+		}
+		rel = filepath.ToSlash(rel)
+
+		wg.Add(1)
+		go func(i int, stack *graph.Stack, rel string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			output.Printf("[drift] checking %s\n", rel)
+			result := StackResult{Stack: rel}
+			plan, err := opts.Planner.RefreshOnlyPlan(ctx, stack.Path)
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Resources = Resources(plan)
+				result.Drifted = len(result.Resources) > 0
+			}
+			results[i] = result
+		}(i, stack, rel)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Stack < results[j].Stack })
+	return &Report{
+		GeneratedAt: time.Now().UTC(),
+		Environment: opts.Environment,
+		Stacks:      results,
+	}, nil
+}
+
+// Dir returns the directory drift reports for env are written to.
+func Dir(outputDir, env string) string {
+	return filepath.Join(outputDir, "drift", env)
+}
+
+// Write stores report as a timestamped JSON file under Dir and as latest.json,
+// returning the timestamped path.
+func Write(outputDir string, report *Report) (string, error) {
+	dir := Dir(outputDir, report.Environment)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("create drift report directory: %w", err)
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	data = append(data, '\n')
+	path := filepath.Join(dir, report.GeneratedAt.UTC().Format("2006-01-02T15-04-05Z")+".json")
+	for _, target := range []string{path, filepath.Join(dir, "latest.json")} {
+		if err := os.WriteFile(target, data, 0o644); err != nil {
+			return "", fmt.Errorf("write drift report: %w", err)
+		}
+	}
+	return path, nil
+}
+
+// PrintTable writes a console table of every stack and its drifted resources.
+func PrintTable(w io.Writer, report *Report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STACK\tSTATUS\tRESOURCE\tACTIONS")
+	for _, s := range report.Stacks {
+		switch {
+		case s.Error != "":
+			fmt.Fprintf(tw, "%s\terror\t%s\t\n", s.Stack, firstLine(s.Error))
+		case !s.Drifted:
+			fmt.Fprintf(tw, "%s\tin sync\t\t\n", s.Stack)
+		default:
+			for i, r := range s.Resources {
+				stack, status := s.Stack, "drifted"
+				if i > 0 {
+					stack, status = "", ""
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", stack, status, r.Address, strings.Join(r.Actions, ","))
+			}
+		}
+	}
+	return tw.Flush()
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
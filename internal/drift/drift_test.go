@@ -0,0 +1,81 @@
+package drift_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/drift"
+	"terraform-wrapper/internal/graph"
+)
+
+type fakePlanner struct {
+	plans map[string]*tfjson.Plan
+	errs  map[string]error
+}
+
+func (f *fakePlanner) RefreshOnlyPlan(_ context.Context, stackDir string) (*tfjson.Plan, error) {
+	name := filepath.Base(stackDir)
+	if err := f.errs[name]; err != nil {
+		return nil, err
+	}
+	return f.plans[name], nil
+}
+
+func TestDetectAggregatesDriftPerStack(t *testing.T) {
+	root := t.TempDir()
+	planner := &fakePlanner{
+		plans: map[string]*tfjson.Plan{
+			"network": {ResourceDrift: []*tfjson.ResourceChange{
+				{Address: "aws_vpc.main", Type: "aws_vpc", Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionUpdate}}},
+				{Address: "aws_subnet.a", Type: "aws_subnet", Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionDelete}}},
+			}},
+			"ecs": {},
+		},
+		errs: map[string]error{"db": errors.New("access denied\ndetails")},
+	}
+	targets := []*graph.Stack{
+		{Path: filepath.Join(root, "network")},
+		{Path: filepath.Join(root, "ecs")},
+		{Path: filepath.Join(root, "db")},
+	}
+
+	report, err := drift.Detect(context.Background(), targets, drift.Options{
+		RootDir:     root,
+		Environment: "prod",
+		Parallelism: 2,
+		Planner:     planner,
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, []drift.StackResult{
+		{Stack: "db", Error: "access denied\ndetails"},
+		{Stack: "ecs"},
+		{Stack: "network", Drifted: true, Resources: []drift.Resource{
+			{Address: "aws_subnet.a", Type: "aws_subnet", Actions: []string{"delete"}},
+			{Address: "aws_vpc.main", Type: "aws_vpc", Actions: []string{"update"}},
+		}},
+	}, report.Stacks)
+	require.Equal(t, []string{"network"}, report.Drifted())
+	require.Equal(t, map[string]string{"db": "access denied\ndetails"}, report.Failed())
+
+	var buf bytes.Buffer
+	require.NoError(t, drift.PrintTable(&buf, report))
+	require.Contains(t, buf.String(), "aws_vpc.main")
+	require.Contains(t, buf.String(), "in sync")
+	require.NotContains(t, buf.String(), "details")
+
+	out := t.TempDir()
+	path, err := drift.Write(out, report)
+	require.NoError(t, err)
+	require.FileExists(t, path)
+	latest, err := os.ReadFile(filepath.Join(drift.Dir(out, "prod"), "latest.json"))
+	require.NoError(t, err)
+	require.Contains(t, string(latest), `"drifted": true`)
+}
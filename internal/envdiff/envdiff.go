@@ -0,0 +1,120 @@
+// Package envdiff compares the variable values two environments give a stack
+// once all of their tfvars layers are applied, naming the file each value
+// comes from, to explain why the environments plan differently.
+package envdiff
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// Kinds of difference, from the first environment to the second.
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// Value is the final value of a variable and the tfvars file that set it.
+type Value struct {
+	// Value is the value as compact JSON, or the source text of an expression
+	// that cannot be evaluated without context.
+	Value string `json:"value"`
+	// Source is the file path relative to the repository root.
+	Source string `json:"source"`
+}
+
+// Change is a variable whose value differs between two environments. From is
+// nil for an added variable and To for a removed one.
+type Change struct {
+	Variable string `json:"variable"`
+	Kind     string `json:"kind"`
+	From     *Value `json:"from,omitempty"`
+	To       *Value `json:"to,omitempty"`
+}
+
+// Resolve reads tfvars files in precedence order, later files overriding
+// earlier ones, and returns the final value of each variable they set.
+func Resolve(root string, files []string) (map[string]Value, error) {
+	values := make(map[string]Value)
+	for _, path := range files {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		file, diags := hclsyntax.ParseConfig(src, path, hcl.InitialPos)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("parse %s: %s", path, diags.Error())
+		}
+		body, ok := file.Body.(*hclsyntax.Body)
+		if !ok {
+			continue
+		}
+		source, err := filepath.Rel(root, path)
+		if err != nil {
+			source = path
+		}
+		for name, attr := range body.Attributes {
+			values[name] = Value{Value: render(attr.Expr, src), Source: filepath.ToSlash(source)}
+		}
+	}
+	return values, nil
+}
+
+// render returns expr's value as JSON, so equal values written differently
+// compare equal, falling back to its source text.
+func render(expr hclsyntax.Expression, src []byte) string {
+	v, diags := expr.Value(nil)
+	if !diags.HasErrors() && v.IsWhollyKnown() {
+		if data, err := ctyjson.Marshal(v, v.Type()); err == nil {
+			return string(data)
+		}
+	}
+	return strings.TrimSpace(string(expr.Range().SliceBytes(src)))
+}
+
+// Diff returns the variables whose values differ between from and to, sorted
+// by name. A variable set to the same value by different files is unchanged.
+func Diff(from, to map[string]Value) []Change {
+	var changes []Change
+	for name, before := range from {
+		after, ok := to[name]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Variable: name, Kind: Removed, From: &before})
+		case before.Value != after.Value:
+			changes = append(changes, Change{Variable: name, Kind: Changed, From: &before, To: &after})
+		}
+	}
+	for name, after := range to {
+		if _, ok := from[name]; !ok {
+			changes = append(changes, Change{Variable: name, Kind: Added, To: &after})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Variable < changes[j].Variable })
+	return changes
+}
+
+// Declared keeps the changes to the variables a stack declares. Terraform
+// ignores tfvars entries for undeclared variables, so they cannot explain a
+// difference in plans.
+func Declared(changes []Change, variables []string) []Change {
+	declared := make(map[string]bool, len(variables))
+	for _, name := range variables {
+		declared[name] = true
+	}
+	var kept []Change
+	for _, change := range changes {
+		if declared[change.Variable] {
+			kept = append(kept, change)
+		}
+	}
+	return kept
+}
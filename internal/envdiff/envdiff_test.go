@@ -0,0 +1,68 @@
+package envdiff_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/envdiff"
+)
+
+func write(t *testing.T, root, rel, content string) string {
+	t.Helper()
+	path := filepath.Join(root, rel)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestResolveAttributesEachValueToTheLastFileSettingIt(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	files := []string{
+		write(t, root, "globals.tfvars", "owner = \"platform\"\ninstance_type = \"t3.small\"\n"),
+		write(t, root, "environment/prod.tfvars", "instance_type = \"m5.large\"\ntags = { Team = \"core\", Tier = 1 }\n"),
+		write(t, root, "network/tfvars/prod.tfvars", "cidr = cidrsubnet(var.base, 8, 1)\n"),
+	}
+	values, err := envdiff.Resolve(root, files)
+	require.NoError(t, err)
+	require.Equal(t, map[string]envdiff.Value{
+		"owner":         {Value: `"platform"`, Source: "globals.tfvars"},
+		"instance_type": {Value: `"m5.large"`, Source: "environment/prod.tfvars"},
+		"tags":          {Value: `{"Team":"core","Tier":1}`, Source: "environment/prod.tfvars"},
+		"cidr":          {Value: "cidrsubnet(var.base, 8, 1)", Source: "network/tfvars/prod.tfvars"},
+	}, values)
+}
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+
+	dev := map[string]envdiff.Value{
+		"owner":         {Value: `"platform"`, Source: "globals.tfvars"},
+		"instance_type": {Value: `"t3.small"`, Source: "globals.tfvars"},
+		"debug":         {Value: "true", Source: "environment/dev.tfvars"},
+	}
+	prod := map[string]envdiff.Value{
+		"owner":         {Value: `"platform"`, Source: "environment/prod.tfvars"},
+		"instance_type": {Value: `"m5.large"`, Source: "environment/prod.tfvars"},
+		"replicas":      {Value: "3", Source: "network/tfvars/prod.tfvars"},
+	}
+	changes := envdiff.Diff(dev, prod)
+	require.Equal(t, []envdiff.Change{
+		{Variable: "debug", Kind: envdiff.Removed, From: &envdiff.Value{Value: "true", Source: "environment/dev.tfvars"}},
+		{
+			Variable: "instance_type",
+			Kind:     envdiff.Changed,
+			From:     &envdiff.Value{Value: `"t3.small"`, Source: "globals.tfvars"},
+			To:       &envdiff.Value{Value: `"m5.large"`, Source: "environment/prod.tfvars"},
+		},
+		{Variable: "replicas", Kind: envdiff.Added, To: &envdiff.Value{Value: "3", Source: "network/tfvars/prod.tfvars"}},
+	}, changes)
+
+	declared := envdiff.Declared(changes, []string{"instance_type", "replicas"})
+	require.Len(t, declared, 2)
+	require.Equal(t, "instance_type", declared[0].Variable)
+}
@@ -0,0 +1,154 @@
+package executor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"terraform-wrapper/internal/logging"
+)
+
+// throttleCooldown is how long after cutting parallelism further throttling
+// is ignored. Stacks already running when the API started throttling keep
+// reporting it for a while; one cut is enough for all of them.
+const throttleCooldown = 30 * time.Second
+
+// throttleClasses are the retry classes that signal too much concurrency,
+// rather than a failure more parallelism would not cause.
+var throttleClasses = map[string]bool{
+	"throttling": true,
+	"state lock": true,
+}
+
+// limiter bounds how many stacks run at once across the layers of a run.
+// When adaptive, throttling halves the limit, down to one stack, and each
+// run of as many successes as the current limit raises it by one, back up
+// to max.
+type limiter struct {
+	mu       sync.Mutex
+	max      int
+	limit    int
+	active   int
+	adaptive bool
+	// reserve is the number of slots only priority stacks may take. Other
+	// stacks always get at least one.
+	reserve   int
+	successes int
+	cooldown  time.Duration
+	lastCut   time.Time
+	// wake is closed and replaced whenever a slot may have become free.
+	wake chan struct{}
+}
+
+func newLimiter(max int, adaptive bool) *limiter {
+	return &limiter{
+		max:      max,
+		limit:    max,
+		adaptive: adaptive,
+		cooldown: throttleCooldown,
+		wake:     make(chan struct{}),
+	}
+}
+
+// acquire waits for a free slot, failing when ctx ends first. Only a
+// priority stack may take a reserved slot.
+func (l *limiter) acquire(ctx context.Context, priority bool) error {
+	for {
+		l.mu.Lock()
+		if l.take(priority) {
+			l.mu.Unlock()
+			return nil
+		}
+		wake := l.wake
+		l.mu.Unlock()
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// tryAcquire takes a free slot without waiting and reports whether it did.
+func (l *limiter) tryAcquire(priority bool) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.take(priority)
+}
+
+// take claims a slot when one is free. It is called with mu held.
+func (l *limiter) take(priority bool) bool {
+	free := l.limit
+	if !priority {
+		free = max(1, l.limit-l.reserve)
+	}
+	if l.active < free {
+		l.active++
+		return true
+	}
+	return false
+}
+
+// setReserve sets the number of slots kept for priority stacks.
+func (l *limiter) setReserve(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reserve = n
+	l.signal()
+}
+
+func (l *limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	l.signal()
+}
+
+func (l *limiter) signal() {
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+// current returns the number of stacks allowed to run at once.
+func (l *limiter) current() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// throttled records a transient failure of class. Running stacks are not
+// interrupted; fewer are started until the limit has recovered.
+func (l *limiter) throttled(class string) {
+	if !l.adaptive || !throttleClasses[class] {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.successes = 0
+	if l.limit == 1 || (!l.lastCut.IsZero() && time.Since(l.lastCut) < l.cooldown) {
+		return
+	}
+	l.limit = max(1, l.limit/2)
+	l.lastCut = time.Now()
+	logging.Warnf("[run] %s detected, reducing parallelism to %d", class, l.limit)
+}
+
+// succeeded records a stack that finished successfully.
+func (l *limiter) succeeded() {
+	if !l.adaptive {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limit >= l.max {
+		return
+	}
+	l.successes++
+	if l.successes < l.limit {
+		return
+	}
+	l.successes = 0
+	l.limit++
+	logging.Infof("[run] raising parallelism to %d", l.limit)
+	l.signal()
+}
@@ -4,10 +4,11 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
+	"time"
 
+	"terraform-wrapper/internal/cache"
 	"terraform-wrapper/internal/graph"
-	"terraform-wrapper/internal/output"
-	"terraform-wrapper/internal/stacks"
+	"terraform-wrapper/internal/triage"
 )
 
 func ApplyAll(ctx context.Context, g graph.Graph, opts Options) (*Summary, error) {
@@ -15,9 +16,18 @@ func ApplyAll(ctx context.Context, g graph.Graph, opts Options) (*Summary, error
 	return RunAll(ctx, g, opts, OperationApply)
 }
 
+// DestroyAll destroys every stack in reverse dependency order. Stacks marked
+// skip_when_destroying are skipped unless opts.ForceDestroySkipped is set.
 func DestroyAll(ctx context.Context, g graph.Graph, opts Options) (*Summary, error) {
 	opts.UseCache = false
-	return RunAll(ctx, g, opts, OperationDestroy)
+	return RunAll(ctx, g.DestroyGraph(), opts, OperationDestroy)
+}
+
+// PlanDestroyAll previews DestroyAll: it writes a destroy plan for every stack
+// in the same order and skips the same stacks.
+func PlanDestroyAll(ctx context.Context, g graph.Graph, opts Options) (*Summary, error) {
+	opts.UseCache = false
+	return RunAll(ctx, g.DestroyGraph(), opts, OperationPlanDestroy)
 }
 
 func InitAll(ctx context.Context, g graph.Graph, opts Options) (*Summary, error) {
@@ -33,6 +43,11 @@ func DestroyStack(ctx context.Context, stack *graph.Stack, opts Options) (*Summa
 	return runSingle(ctx, stack, opts, OperationDestroy)
 }
 
+// PlanDestroyStack writes a destroy plan for a single stack.
+func PlanDestroyStack(ctx context.Context, stack *graph.Stack, opts Options) (*Summary, error) {
+	return runSingle(ctx, stack, opts, OperationPlanDestroy)
+}
+
 func InitStack(ctx context.Context, stack *graph.Stack, opts Options) (*Summary, error) {
 	return runSingle(ctx, stack, opts, OperationInit)
 }
@@ -43,14 +58,7 @@ func runSingle(ctx context.Context, stack *graph.Stack, opts Options, op Operati
 		return nil, fmt.Errorf("terraform binary path not provided")
 	}
 
-	runner, err := newRunner(ctx, stacks.RunnerOptions{
-		RootDir:        opts.RootDir,
-		Environment:    opts.Environment,
-		AccountID:      opts.AccountID,
-		Region:         opts.Region,
-		TerraformPath:  opts.TerraformPath,
-		DisableRefresh: opts.DisableRefresh,
-	})
+	runner, err := runnerFor(ctx, opts, opts.TerraformPath)
 	if err != nil {
 		return nil, err
 	}
@@ -63,28 +71,79 @@ func runSingle(ctx context.Context, stack *graph.Stack, opts Options, op Operati
 	if err != nil {
 		return nil, err
 	}
-
-	progress := output.NewManager()
-	progress.Register(rel)
-	progress.Start(rel)
-
-	var execErr error
-	switch op {
-	case OperationApply:
-		execErr = runner.Apply(ctx, stack.Path)
-	case OperationDestroy:
-		execErr = runner.Destroy(ctx, stack.Path)
-	case OperationInit:
-		execErr = runner.InitOnly(ctx, stack.Path, true)
-	default:
-		execErr = fmt.Errorf("unknown operation")
+	if op == OperationApply {
+		if err := opts.checkPropagation(rootAbs, graph.Graph{stack.Path: stack}); err != nil {
+			return nil, err
+		}
 	}
 
+	progress := opts.newProgress()
+	progress.register(rel)
+	progress.start(rel)
+
+	runCtx, cancel := opts.runContext(ctx)
+	defer cancel()
+	ctx, cancelStack := opts.stackContext(runCtx)
+	defer cancelStack()
+
+	started := time.Now()
+	var changed bool
+	_, usage, execErr := opts.monitor(stack.Path, func() (ResultStatus, error) {
+		switch op {
+		case OperationApply:
+			if err := applySingle(ctx, runner, stack.Path, rel, opts); err != nil {
+				return StatusExecuted, err
+			}
+			tagState(ctx, stack, opts)
+			return StatusExecuted, exportOutputs(ctx, runner, stack, rel, opts)
+		case OperationDestroy:
+			return StatusExecuted, runner.Destroy(ctx, stack.Path)
+		case OperationPlanDestroy:
+			planPath := cache.DestroyPlanFile(opts.RootDir, opts.scope(), opts.Workspace, rel)
+			if err := ensureDir(filepath.Dir(planPath)); err != nil {
+				return StatusExecuted, err
+			}
+			var err error
+			changed, err = runner.PlanDestroy(ctx, stack.Path, planPath)
+			return StatusExecuted, err
+		case OperationInit:
+			return StatusExecuted, runner.InitOnly(ctx, stack.Path, true)
+		default:
+			return StatusExecuted, fmt.Errorf("unknown operation")
+		}
+	})
+
+	execErr = triage.Inspect(stack.Path, started, opts.timeoutError(runCtx, ctx, execErr))
+	summary := &Summary{}
+	summary.recordUsage(rel, usage)
 	if execErr != nil {
-		progress.Fail(rel, execErr)
-		return &Summary{Failed: map[string]error{rel: execErr}}, execErr
+		outcome := failureOutcome(execErr)
+		progress.finish(rel, outcome, execErr)
+		summary.Failed = map[string]error{rel: execErr}
+		if outcome == OutcomeTimedOut {
+			summary.TimedOut = []string{rel}
+		}
+		return summary, execErr
+	}
+
+	if changed {
+		summary.Changed = []string{rel}
 	}
+	progress.finish(rel, OutcomeSucceeded, nil)
+	summary.Executed = 1
+	summary.Completed = []string{rel}
+	return summary, nil
+}
 
-	progress.Succeed(rel)
-	return &Summary{Executed: 1}, nil
+// applySingle applies one stack, from the plan cached by PlanStack when
+// FromPlan is set.
+func applySingle(ctx context.Context, runner runner, stackDir, rel string, opts Options) error {
+	if !opts.FromPlan {
+		return applyChecked(ctx, runner, opts, stackDir, rel)
+	}
+	hash, err := contentHash(runner, stackDir, opts)
+	if err != nil {
+		return err
+	}
+	return applyCachedPlan(ctx, runner, opts, stackDir, rel, hash)
 }
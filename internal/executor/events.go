@@ -0,0 +1,177 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"terraform-wrapper/internal/logging"
+	"terraform-wrapper/internal/output"
+)
+
+// Event is a typed progress event: LayerStarted, StackWaiting, StackStarted,
+// StackPlanned or StackFinished.
+type Event interface {
+	event()
+}
+
+// LayerStarted is emitted when RunAll starts a layer of stacks whose
+// dependencies have all finished. Index counts layers from 1.
+type LayerStarted struct {
+	Index  int
+	Stacks []string
+}
+
+// StackWaiting is emitted once for a stack that cannot start until the
+// stacks in WaitingOn finish.
+type StackWaiting struct {
+	Stack     string
+	WaitingOn []string
+}
+
+// StackStarted is emitted when terraform starts running for a stack.
+type StackStarted struct {
+	Stack string
+}
+
+// StackPlanned is emitted when a stack's plan has been written or reused
+// from the plan cache, before the stack finishes, with the resource changes
+// the plan makes.
+type StackPlanned struct {
+	Stack  string
+	Counts PlanCounts
+}
+
+// Outcome is how a stack finished.
+type Outcome string
+
+const (
+	OutcomeSucceeded Outcome = "succeeded"
+	OutcomeFailed    Outcome = "failed"
+	OutcomeCached    Outcome = "cached"
+	OutcomeSkipped   Outcome = "skipped"
+	// OutcomeTimedOut is a failure caused by the stack timeout or the run's
+	// deadline.
+	OutcomeTimedOut Outcome = "timed_out"
+)
+
+// StackFinished is emitted when a stack succeeds, fails, reuses its cached
+// plan or is skipped. Skipped stacks are never started, so their Duration is
+// zero; Reason says why they were skipped.
+type StackFinished struct {
+	Stack    string
+	Outcome  Outcome
+	Reason   string
+	Err      error
+	Duration time.Duration
+}
+
+func (LayerStarted) event()  {}
+func (StackWaiting) event()  {}
+func (StackStarted) event()  {}
+func (StackPlanned) event()  {}
+func (StackFinished) event() {}
+
+// EventSink receives the progress of RunAll, PlanStack and ApplyStack as
+// typed events, so embedders need not parse the log lines. Events of stacks
+// running concurrently may arrive from different goroutines, but never at
+// the same time.
+type EventSink interface {
+	Handle(Event)
+}
+
+// EventSinkFunc adapts a function to an EventSink.
+type EventSinkFunc func(Event)
+
+func (f EventSinkFunc) Handle(event Event) { f(event) }
+
+// progressSink renders events as log lines or NDJSON through an
+// output.Manager and forwards them to the embedder's sink, if any.
+type progressSink struct {
+	mu      sync.Mutex
+	manager *output.Manager
+	started map[string]time.Time
+	group   *output.Group
+	next    EventSink
+}
+
+func (o *Options) newProgress() *progressSink {
+	manager := output.NewManager()
+	if o.EventWriter != nil {
+		manager = output.NewJSONManager(o.EventWriter)
+	}
+	return &progressSink{manager: manager, started: make(map[string]time.Time), group: o.OutputGroup, next: o.EventSink}
+}
+
+func (p *progressSink) register(stack string) {
+	p.manager.Register(stack)
+}
+
+func (p *progressSink) Handle(event Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch ev := event.(type) {
+	case LayerStarted:
+		logging.Infof("[layer %d] running: %s", ev.Index, strings.Join(ev.Stacks, ", "))
+	case StackWaiting:
+		reason := fmt.Sprintf("waiting for %s", strings.Join(ev.WaitingOn, ", "))
+		p.manager.Waiting(ev.Stack, reason)
+		logging.Stack(ev.Stack).Recordf("[wait] %s", reason)
+	case StackStarted:
+		p.manager.Start(ev.Stack)
+		logging.Stack(ev.Stack).Recordf("[run] started")
+	case StackPlanned:
+		p.manager.Planned(ev.Stack, ev.Counts.Adds, ev.Counts.Changes, ev.Counts.Destroys)
+		logging.Stack(ev.Stack).Recordf("[plan] %d to add, %d to change, %d to destroy", ev.Counts.Adds, ev.Counts.Changes, ev.Counts.Destroys)
+	case StackFinished:
+		if p.group != nil {
+			if err := p.group.Flush(ev.Stack); err != nil {
+				logging.Warnf("[run] warning: print output of %s: %v", ev.Stack, err)
+			}
+		}
+		switch ev.Outcome {
+		case OutcomeSucceeded:
+			p.manager.Succeed(ev.Stack)
+		case OutcomeFailed, OutcomeTimedOut:
+			p.manager.Fail(ev.Stack, ev.Err)
+		case OutcomeCached:
+			p.manager.CacheHit(ev.Stack)
+		default:
+			p.manager.Skip(ev.Stack, ev.Reason)
+		}
+		line := fmt.Sprintf("[%s] %s", ev.Outcome, ev.Duration.Round(100*time.Millisecond))
+		switch {
+		case ev.Err != nil:
+			line += ": " + ev.Err.Error()
+		case ev.Reason != "":
+			line += ": " + ev.Reason
+		}
+		logging.Stack(ev.Stack).Recordf("%s", line)
+	}
+	if p.next != nil {
+		p.next.Handle(event)
+	}
+}
+
+func (p *progressSink) waiting(stack string, waitingOn []string) {
+	p.Handle(StackWaiting{Stack: stack, WaitingOn: waitingOn})
+}
+
+func (p *progressSink) start(stack string) {
+	p.mu.Lock()
+	p.started[stack] = time.Now()
+	p.mu.Unlock()
+	p.Handle(StackStarted{Stack: stack})
+}
+
+func (p *progressSink) skip(stack, reason string) {
+	p.Handle(StackFinished{Stack: stack, Outcome: OutcomeSkipped, Reason: reason})
+}
+
+func (p *progressSink) finish(stack string, outcome Outcome, err error) {
+	p.mu.Lock()
+	duration := time.Since(p.started[stack])
+	p.mu.Unlock()
+	p.Handle(StackFinished{Stack: stack, Outcome: outcome, Err: err, Duration: duration})
+}
@@ -2,7 +2,21 @@ package executor
 
 import (
 	"context"
+	"io"
 	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/terraform-exec/tfexec"
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"terraform-wrapper/internal/cache"
+	"terraform-wrapper/internal/graph"
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/procmon"
+	"terraform-wrapper/internal/remote"
+	"terraform-wrapper/internal/stacks"
+	"terraform-wrapper/internal/tenant"
+	"terraform-wrapper/internal/workdir"
 )
 
 type Operation int
@@ -12,27 +26,172 @@ const (
 	OperationPlan
 	OperationApply
 	OperationDestroy
+	OperationPlanDestroy
+	// OperationPipeline runs Options.Pipeline on each stack.
+	OperationPipeline
 )
 
+// plans reports whether op only plans and changes no infrastructure.
+func (op Operation) plans() bool {
+	return op == OperationPlan || op == OperationPlanDestroy
+}
+
 type runner interface {
 	Apply(context.Context, string) error
+	ApplyPlan(context.Context, string, string) error
 	Destroy(context.Context, string) error
+	Validate(context.Context, string) error
 	InitOnly(context.Context, string, bool) error
-	PlanWithOutput(context.Context, string, string) error
+	PlanWithOutput(context.Context, string, string) (bool, error)
+	PlanDestroy(context.Context, string, string) (bool, error)
+	Outputs(context.Context, string) (map[string]tfexec.OutputMeta, error)
+	ShowPlan(context.Context, string, string) (*tfjson.Plan, error)
 	VarFilesFor(string) []string
 }
 
+// OutputExporter publishes declared stack outputs after a successful apply.
+type OutputExporter interface {
+	Export(ctx context.Context, stackRel string, exports []graph.OutputExport, outputs map[string]tfexec.OutputMeta) error
+}
+
+// OutputPropagator writes the outputs of an applied stack into the generated
+// tfvars of the stacks that consume them.
+type OutputPropagator interface {
+	Consumes(stackPath string) bool
+	Propagate(ctx context.Context, stackPath string, outputs map[string]tfexec.OutputMeta) error
+}
+
+// Checkpointer persists that a stack finished so an interrupted run can be
+// resumed elsewhere.
+type Checkpointer interface {
+	MarkDone(ctx context.Context, stackRel string) error
+}
+
+// StateTagger records run metadata on a stack's state object after a
+// successful apply.
+type StateTagger interface {
+	TagState(ctx context.Context, stackPath string) error
+}
+
+// PolicyGate vets a stack's plan before it is applied; an error blocks the
+// apply.
+type PolicyGate interface {
+	Check(ctx context.Context, stackRel string, plan *tfjson.Plan) error
+}
+
 type Options struct {
 	RootDir          string
 	Environment      string
+	Profile          string
+	Workspace        string
+	Tenant           string
+	StateKMSKeyID    string
 	AccountID        string
 	Region           string
 	TerraformPath    string
 	TerraformVersion string
-	Parallelism      int
-	UseCache         bool
-	ForceStacks      map[string]struct{}
-	DisableRefresh   bool
+	// Engine names the engine TerraformVersion belongs to, terraform or
+	// tofu, so remote runs resolve the same binary.
+	Engine      string
+	Parallelism int
+	UseCache    bool
+	// RemoteCache, when set, shares plans between machines: local cache
+	// misses are looked up in it and new plans are published to it.
+	RemoteCache     cache.Remote
+	ForceStacks     map[string]struct{}
+	DisableRefresh  bool
+	DisableLocking  bool
+	CompletedStacks map[string]struct{}
+	Exporter        OutputExporter
+	Propagator      OutputPropagator
+	Checkpoint      Checkpointer
+	Backend         remote.Backend
+	// RemoteFlags are passed on to every stack invocation Backend starts,
+	// so it runs the stack the way this run would locally.
+	RemoteFlags []string
+	Revision    string
+	// EventWriter, when set, receives stack progress as NDJSON instead of
+	// the human-readable log lines.
+	EventWriter io.Writer
+	// EventSink, when set, receives every progress event as well, for
+	// embedders that want typed events instead of the output.
+	EventSink EventSink
+	// MaxRSSBytes, when non-zero, kills and fails a stack whose Terraform
+	// processes together exceed this resident set size.
+	MaxRSSBytes uint64
+	// StateTagger, when set, tags each applied stack's state object.
+	StateTagger StateTagger
+	// StateBackups, when set, receives a copy of each stack's state before
+	// it is applied or destroyed.
+	StateBackups stacks.StateBackups
+	// StateBackend selects the state backend for stacks without their own
+	// backend.tfwrapper.json. Nil means S3.
+	StateBackend *stacks.BackendSettings
+	// AssumeRoleARN runs terraform with credentials for this role unless a
+	// stack's dependencies.json names its own.
+	AssumeRoleARN string
+	// KeepGoing keeps running after a stack fails: only the stacks depending
+	// on it are skipped, instead of stopping the whole run.
+	KeepGoing bool
+	// StackTimeout kills a stack's terraform and fails the stack once it
+	// has run this long; zero means no limit.
+	StackTimeout time.Duration
+	// Timeout is the deadline of the whole run: running stacks are killed
+	// and stacks not started yet are skipped once it passes.
+	Timeout time.Duration
+	// ForceDestroySkipped destroys stacks marked skip_when_destroying too.
+	ForceDestroySkipped bool
+	// PrefixOutput prefixes each line of terraform output with its stack;
+	// Color colours the prefixes.
+	PrefixOutput bool
+	Color        bool
+	// OutputGroup, when set, buffers each stack's terraform output and
+	// prints it as one block when the stack finishes. It takes precedence
+	// over PrefixOutput.
+	OutputGroup *output.Group
+	// FromPlan applies each stack's cached plan instead of replanning. A
+	// stack fails when its content changed since the plan was cached.
+	FromPlan bool
+	// Retry retries terraform commands of local runners that fail
+	// transiently, so one throttled request does not fail a whole layer.
+	Retry stacks.RetryPolicy
+	// ExtraVarFiles are appended to every stack's var files. Remote
+	// backends do not support them.
+	ExtraVarFiles []string
+	// Workdir holds generated files of the run, such as the plans checked
+	// by the policy gate; each gets a temporary directory when nil.
+	Workdir *workdir.Workdir
+	// TFLog captures terraform's log per stack at this level, trace or
+	// debug, in the run log directory TFLogDir, for local runners.
+	TFLog    string
+	TFLogDir string
+	// Policy, when set, checks each stack's plan before it is applied.
+	// Stacks are then planned into a file, checked and applied from it.
+	Policy PolicyGate
+	// Pipeline holds the steps OperationPipeline runs on each stack. After
+	// a plan step, apply applies that plan once Policy has checked it, in
+	// the policy step when there is one.
+	Pipeline []Step
+	// AdaptiveParallelism lowers Parallelism while terraform reports
+	// throttling or state lock contention and raises it back as stacks
+	// succeed.
+	AdaptiveParallelism bool
+	// BackendChange migrates each stack's state to a changed backend, or
+	// reconfigures it, when OperationInit runs. Remote backends do not
+	// support it.
+	BackendChange stacks.BackendChange
+}
+
+// skipsDestroy reports whether op must leave stack alone because it is
+// marked skip_when_destroying.
+func (o Options) skipsDestroy(stack *graph.Stack, op Operation) bool {
+	return stack.SkipDestroy && !o.ForceDestroySkipped && (op == OperationDestroy || op == OperationPlanDestroy)
+}
+
+// scope is the environment segment of the plan cache and log paths, which
+// keeps a tenant's apart from other teams'.
+func (o Options) scope() string {
+	return tenant.Scope(o.Tenant, o.Environment)
 }
 
 func (o *Options) Defaults() {
@@ -53,6 +212,18 @@ func (o *Options) Defaults() {
 	}
 }
 
+// monitor runs fn while sampling the resource usage of the Terraform processes
+// working in stackPath. Exceeding MaxRSSBytes replaces fn's error.
+func (o *Options) monitor(stackPath string, fn func() (ResultStatus, error)) (ResultStatus, procmon.Usage, error) {
+	mon := procmon.Start(stackPath, o.MaxRSSBytes, 0)
+	status, err := fn()
+	usage, limitErr := mon.Stop()
+	if limitErr != nil {
+		err = limitErr
+	}
+	return status, usage, err
+}
+
 func (o *Options) Relative(path string) (string, error) {
 	rootAbs, err := filepath.Abs(o.RootDir)
 	if err != nil {
@@ -72,3 +243,11 @@ func (o *Options) IsForced(stackRel string) bool {
 	_, ok := o.ForceStacks[stackRel]
 	return ok
 }
+
+func (o *Options) IsCompleted(stackRel string) bool {
+	if o.CompletedStacks == nil {
+		return false
+	}
+	_, ok := o.CompletedStacks[stackRel]
+	return ok
+}
@@ -0,0 +1,146 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"terraform-wrapper/internal/cache"
+	"terraform-wrapper/internal/graph"
+	"terraform-wrapper/internal/logging"
+)
+
+// Step is one operation of a pipeline, run on each stack in turn.
+type Step string
+
+const (
+	StepInit     Step = "init"
+	StepValidate Step = "validate"
+	StepPlan     Step = "plan"
+	StepPolicy   Step = "policy"
+	StepApply    Step = "apply"
+)
+
+// stepOrder is the order steps must appear in within a pipeline.
+var stepOrder = []Step{StepInit, StepValidate, StepPlan, StepPolicy, StepApply}
+
+// ParsePipeline parses a comma-separated list of steps such as
+// "init,validate,plan,policy,apply". Any subset may be given, each step at
+// most once and in that order; policy needs plan to check.
+func ParsePipeline(spec string) ([]Step, error) {
+	rank := make(map[Step]int, len(stepOrder))
+	for i, step := range stepOrder {
+		rank[step] = i
+	}
+
+	var steps []Step
+	last := -1
+	for _, name := range strings.Split(spec, ",") {
+		step := Step(strings.TrimSpace(name))
+		if step == "" {
+			continue
+		}
+		r, ok := rank[step]
+		if !ok {
+			return nil, fmt.Errorf("unknown pipeline step %q", step)
+		}
+		if r == last {
+			return nil, fmt.Errorf("pipeline step %q appears twice", step)
+		}
+		if r < last {
+			return nil, fmt.Errorf("pipeline step %q must come before %q", step, steps[len(steps)-1])
+		}
+		last = r
+		steps = append(steps, step)
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("pipeline must name at least one step")
+	}
+	if HasStep(steps, StepPolicy) && !HasStep(steps, StepPlan) {
+		return nil, fmt.Errorf("pipeline step %q needs %q", StepPolicy, StepPlan)
+	}
+	return steps, nil
+}
+
+// HasStep reports whether steps include step.
+func HasStep(steps []Step, step Step) bool {
+	for _, s := range steps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+// RunPipeline runs steps on every stack in dependency order: a stack goes
+// through the whole pipeline before its dependents start theirs. With a plan
+// step, later steps check and apply the plan it wrote to the plan cache.
+func RunPipeline(ctx context.Context, g graph.Graph, opts Options, steps []Step) (*Summary, error) {
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("pipeline must name at least one step")
+	}
+	// Remote runners neither validate nor keep plans locally.
+	if opts.Backend != nil {
+		return nil, fmt.Errorf("pipelines are not supported with the %s backend", opts.Backend.Name())
+	}
+	opts.UseCache = false
+	opts.FromPlan = false
+	opts.Pipeline = steps
+	return RunAll(ctx, g, opts, OperationPipeline)
+}
+
+// planOnly reports whether op changes no infrastructure, which for a
+// pipeline means it does not apply.
+func (o Options) planOnly(op Operation) bool {
+	if op == OperationPipeline {
+		return !HasStep(o.Pipeline, StepApply)
+	}
+	return op.plans()
+}
+
+// runPipeline runs the pipeline's steps on one stack, stopping at the first
+// that fails.
+func (e *executor) runPipeline(ctx context.Context, runner runner, stack *graph.Stack, rel string) error {
+	var planPath string
+	for _, step := range e.options.Pipeline {
+		logging.Stack(rel).Infof("[%s] %s", step, rel)
+		var err error
+		switch step {
+		case StepInit:
+			err = runner.InitOnly(ctx, stack.Path, true)
+		case StepValidate:
+			err = runner.Validate(ctx, stack.Path)
+		case StepPlan:
+			var status ResultStatus
+			if status, err = e.planStack(ctx, runner, stack, rel); err == nil {
+				planPath, _ = cache.PlanFiles(e.options.RootDir, e.options.scope(), e.options.Workspace, rel)
+				if status == StatusExecuted {
+					reportPlan(ctx, runner, e.progress, e.options, stack.Path, rel, planPath, e.hasChanges(stack.Path))
+				}
+			}
+		case StepPolicy:
+			err = checkPolicy(ctx, runner, e.options, stack.Path, rel, planPath)
+		case StepApply:
+			switch {
+			case planPath == "":
+				err = applyChecked(ctx, runner, e.options, stack.Path, rel)
+			case !HasStep(e.options.Pipeline, StepPolicy):
+				if err = checkPolicy(ctx, runner, e.options, stack.Path, rel, planPath); err == nil {
+					err = runner.ApplyPlan(ctx, stack.Path, planPath)
+				}
+			default:
+				err = runner.ApplyPlan(ctx, stack.Path, planPath)
+			}
+			if err == nil {
+				tagState(ctx, stack, e.options)
+				err = exportOutputs(ctx, runner, stack, rel, e.options)
+			}
+		default:
+			err = fmt.Errorf("unknown pipeline step %q", step)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", step, err)
+		}
+	}
+	return nil
+}
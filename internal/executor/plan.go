@@ -3,14 +3,19 @@ package executor
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
+
+	tfjson "github.com/hashicorp/terraform-json"
 
 	"terraform-wrapper/internal/cache"
+	"terraform-wrapper/internal/featureflags"
 	"terraform-wrapper/internal/graph"
-	"terraform-wrapper/internal/output"
-	"terraform-wrapper/internal/stacks"
+	"terraform-wrapper/internal/logging"
+	"terraform-wrapper/internal/triage"
 )
 
 func PlanAll(ctx context.Context, g graph.Graph, opts Options) (*Summary, error) {
@@ -23,14 +28,7 @@ func PlanStack(ctx context.Context, stack *graph.Stack, opts Options) (*Summary,
 		return nil, fmt.Errorf("terraform binary path not provided")
 	}
 
-	runner, err := newRunner(ctx, stacks.RunnerOptions{
-		RootDir:        opts.RootDir,
-		Environment:    opts.Environment,
-		AccountID:      opts.AccountID,
-		Region:         opts.Region,
-		TerraformPath:  opts.TerraformPath,
-		DisableRefresh: opts.DisableRefresh,
-	})
+	runner, err := runnerFor(ctx, opts, opts.TerraformPath)
 	if err != nil {
 		return nil, err
 	}
@@ -44,43 +42,124 @@ func PlanStack(ctx context.Context, stack *graph.Stack, opts Options) (*Summary,
 		return nil, err
 	}
 
-	progress := output.NewManager()
-	progress.Register(rel)
-	progress.Start(rel)
+	progress := opts.newProgress()
+	progress.register(rel)
+	progress.start(rel)
 
-	status, err := planSingle(ctx, runner, stack, rel, opts)
+	runCtx, cancel := opts.runContext(ctx)
+	defer cancel()
+	ctx, cancelStack := opts.stackContext(runCtx)
+	defer cancelStack()
+
+	started := time.Now()
+	var changed bool
+	status, usage, err := opts.monitor(stack.Path, func() (ResultStatus, error) {
+		var status ResultStatus
+		var err error
+		status, changed, err = planSingle(ctx, runner, stack, rel, opts)
+		return status, err
+	})
+	err = triage.Inspect(stack.Path, started, opts.timeoutError(runCtx, ctx, err))
+	summary := &Summary{}
+	summary.recordUsage(rel, usage)
 	if err != nil {
-		progress.Fail(rel, err)
-		return &Summary{Failed: map[string]error{rel: err}}, err
+		outcome := failureOutcome(err)
+		progress.finish(rel, outcome, err)
+		summary.Failed = map[string]error{rel: err}
+		if outcome == OutcomeTimedOut {
+			summary.TimedOut = []string{rel}
+		}
+		return summary, err
+	}
+	if changed {
+		summary.Changed = []string{rel}
+	}
+	if status == StatusExecuted {
+		planPath, _ := cache.PlanFiles(opts.RootDir, opts.scope(), opts.Workspace, rel)
+		reportPlan(ctx, runner, progress, opts, stack.Path, rel, planPath, changed)
 	}
 
 	if status == StatusCached {
-		progress.Skip(rel, "cache hit")
-		return &Summary{Cached: 1}, nil
+		progress.finish(rel, OutcomeCached, nil)
+		summary.Cached = 1
+		summary.Completed = []string{rel}
+		return summary, nil
 	}
 
-	progress.Succeed(rel)
-	return &Summary{Executed: 1}, nil
+	progress.finish(rel, OutcomeSucceeded, nil)
+	summary.Executed = 1
+	summary.Completed = []string{rel}
+	return summary, nil
 }
 
-func planSingle(ctx context.Context, runner runner, stack *graph.Stack, rel string, opts Options) (ResultStatus, error) {
-	varFiles := runner.VarFilesFor(stack.Path)
-	files, err := cache.StackContentFiles(stack.Path, varFiles)
-	if err != nil {
-		return StatusExecuted, err
+// PlanCounts are the resource changes of a plan, counted the way terraform's
+// own plan summary counts them: a replacement is one add and one destroy.
+type PlanCounts struct {
+	Adds     int
+	Changes  int
+	Destroys int
+}
+
+func countPlan(plan *tfjson.Plan) PlanCounts {
+	var counts PlanCounts
+	if plan == nil {
+		return counts
+	}
+	for _, rc := range plan.ResourceChanges {
+		if rc.Change == nil {
+			continue
+		}
+		for _, action := range rc.Change.Actions {
+			switch action {
+			case tfjson.ActionCreate:
+				counts.Adds++
+			case tfjson.ActionUpdate:
+				counts.Changes++
+			case tfjson.ActionDelete:
+				counts.Destroys++
+			}
+		}
+	}
+	return counts
+}
+
+// reportPlan emits the resource changes of the stack's plan at planPath as
+// soon as it is written, so they can be read before the run ends. Plans made
+// on a remote backend are not kept locally and are not reported, and callers
+// skip plans restored from the cache, which may not be initialised to show.
+func reportPlan(ctx context.Context, runner runner, progress *progressSink, opts Options, stackDir, rel, planPath string, changed bool) {
+	if opts.Backend != nil {
+		return
+	}
+	var counts PlanCounts
+	if changed {
+		planPathAbs, err := filepath.Abs(planPath)
+		if err != nil {
+			logging.Warnf("[plan] warning: summarise plan of %s: %v", rel, err)
+			return
+		}
+		plan, err := runner.ShowPlan(ctx, stackDir, planPathAbs)
+		if err != nil {
+			logging.Warnf("[plan] warning: summarise plan of %s: %v", rel, err)
+			return
+		}
+		counts = countPlan(plan)
 	}
+	progress.Handle(StackPlanned{Stack: rel, Counts: counts})
+}
 
-	hashBytes, err := cache.ComputeHash(files)
+func planSingle(ctx context.Context, runner runner, stack *graph.Stack, rel string, opts Options) (ResultStatus, bool, error) {
+	hashBytes, err := contentHash(runner, stack.Path, opts)
 	if err != nil {
-		return StatusExecuted, err
+		return StatusExecuted, false, err
 	}
 
-	planPath, hashPath := cache.PlanFiles(opts.RootDir, opts.Environment, rel)
+	planPath, hashPath := cache.PlanFiles(opts.RootDir, opts.scope(), opts.Workspace, rel)
 	planPathAbs := planPath
 	if !filepath.IsAbs(planPathAbs) {
 		planPathAbs, err = filepath.Abs(planPathAbs)
 		if err != nil {
-			return StatusExecuted, err
+			return StatusExecuted, false, err
 		}
 	}
 
@@ -88,23 +167,134 @@ func planSingle(ctx context.Context, runner runner, stack *graph.Stack, rel stri
 		if cachedHash, err := cache.LoadHash(hashPath); err == nil {
 			if bytes.Equal(cachedHash, hashBytes) {
 				if _, err := os.Stat(planPathAbs); err == nil {
-					return StatusCached, nil
+					return StatusCached, cache.LoadChanges(hashPath), nil
 				}
 			}
 		}
+		if changed, ok := fetchPlan(ctx, opts, rel, hashBytes); ok {
+			return StatusCached, changed, nil
+		}
 	}
 
 	if err := ensureDir(filepath.Dir(planPathAbs)); err != nil {
-		return StatusExecuted, err
+		return StatusExecuted, false, err
 	}
 
-	if err := runner.PlanWithOutput(ctx, stack.Path, planPathAbs); err != nil {
-		return StatusExecuted, err
+	changed, err := runner.PlanWithOutput(ctx, stack.Path, planPathAbs)
+	if err != nil {
+		return StatusExecuted, false, err
 	}
 
 	if err := cache.SaveHash(hashPath, hashBytes); err != nil {
-		return StatusExecuted, err
+		return StatusExecuted, false, err
+	}
+	if err := cache.SaveChanges(hashPath, changed); err != nil {
+		return StatusExecuted, false, err
 	}
+	storePlan(ctx, opts, rel, hashBytes, changed)
+
+	return StatusExecuted, changed, nil
+}
 
-	return StatusExecuted, nil
+// contentHash hashes the stack's configuration, the var files it is planned
+// with and the environment's feature flags.
+func contentHash(runner runner, stackDir string, opts Options) ([]byte, error) {
+	extras := runner.VarFilesFor(stackDir)
+	flags := featureflags.Path(opts.RootDir, opts.Environment)
+	if _, err := os.Stat(flags); err == nil {
+		extras = append(extras, flags)
+	}
+	files, err := cache.StackContentFiles(stackDir, extras)
+	if err != nil {
+		return nil, err
+	}
+	return cache.ComputeHash(files, opts.TerraformVersion)
+}
+
+// applyCachedPlan applies the plan cached for rel, provided hash still matches
+// the hash recorded when it was planned. The hash is removed afterwards: an
+// applied plan is stale and must not be served from the cache again.
+func applyCachedPlan(ctx context.Context, runner runner, opts Options, stackDir, rel string, hash []byte) error {
+	planPath, hashPath := cache.PlanFiles(opts.RootDir, opts.scope(), opts.Workspace, rel)
+	planPathAbs, err := filepath.Abs(planPath)
+	if err != nil {
+		return err
+	}
+	cachedHash, err := cache.LoadHash(hashPath)
+	if errors.Is(err, os.ErrNotExist) || err == nil && !bytes.Equal(cachedHash, hash) {
+		// The plan may have been made on another machine.
+		if _, ok := fetchPlan(ctx, opts, rel, hash); ok {
+			cachedHash, err = hash, nil
+		}
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("no cached plan for %s; run plan first", rel)
+	}
+	if err != nil {
+		return fmt.Errorf("read cached plan hash for %s: %w", rel, err)
+	}
+	if !bytes.Equal(cachedHash, hash) {
+		return fmt.Errorf("cached plan for %s is stale: the stack changed since it was planned", rel)
+	}
+	if _, err := os.Stat(planPathAbs); err != nil {
+		return fmt.Errorf("no cached plan for %s: %w", rel, err)
+	}
+
+	if err := checkPolicy(ctx, runner, opts, stackDir, rel, planPathAbs); err != nil {
+		return err
+	}
+	if err := runner.ApplyPlan(ctx, stackDir, planPathAbs); err != nil {
+		return err
+	}
+	if err := os.Remove(hashPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("invalidate cached plan for %s: %w", rel, err)
+	}
+	if opts.RemoteCache != nil {
+		if err := opts.RemoteCache.Invalidate(ctx, opts.cacheKey(rel, hash)); err != nil {
+			logging.Warnf("[cache] warning: %v", err)
+		}
+	}
+	return nil
+}
+
+func (o Options) cacheKey(rel string, hash []byte) cache.Key {
+	return cache.Key{Environment: o.scope(), Workspace: o.Workspace, Stack: rel, Hash: hash}
+}
+
+// fetchPlan fills the local plan cache of rel from RemoteCache when it holds
+// a plan for hash, and reports whether that plan has changes. A failure only
+// costs a replan, so it is reported and treated as a miss.
+func fetchPlan(ctx context.Context, opts Options, rel string, hash []byte) (changed, found bool) {
+	// Remote backends keep their plans on the runner.
+	if opts.RemoteCache == nil || opts.Backend != nil {
+		return false, false
+	}
+	planPath, hashPath := cache.PlanFiles(opts.RootDir, opts.scope(), opts.Workspace, rel)
+	changed, found, err := opts.RemoteCache.Fetch(ctx, opts.cacheKey(rel, hash), planPath)
+	if err == nil && found {
+		err = cache.SaveHash(hashPath, hash)
+		if err == nil {
+			err = cache.SaveChanges(hashPath, changed)
+		}
+	}
+	if err != nil {
+		logging.Warnf("[cache] warning: %v", err)
+		return false, false
+	}
+	if found {
+		logging.Stack(rel).Infof("[cache] fetched plan for %s from the shared cache", rel)
+	}
+	return changed, found
+}
+
+// storePlan publishes the plan just made for rel to RemoteCache. The local
+// plan is already saved, so a failure is only reported.
+func storePlan(ctx context.Context, opts Options, rel string, hash []byte, changed bool) {
+	if opts.RemoteCache == nil || opts.Backend != nil {
+		return
+	}
+	planPath, _ := cache.PlanFiles(opts.RootDir, opts.scope(), opts.Workspace, rel)
+	if err := opts.RemoteCache.Store(ctx, opts.cacheKey(rel, hash), planPath, changed); err != nil {
+		logging.Warnf("[cache] warning: %v", err)
+	}
 }
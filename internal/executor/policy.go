@@ -0,0 +1,42 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+)
+
+// applyChecked applies stackDir. With a policy gate, the stack is planned
+// into a temporary file first and that plan is applied once it passes.
+func applyChecked(ctx context.Context, runner runner, opts Options, stackDir, rel string) error {
+	// Remote backends run the wrapper's own apply, which checks the policies itself.
+	if opts.Policy == nil || opts.Backend != nil {
+		return runner.Apply(ctx, stackDir)
+	}
+	tmpDir, cleanup, err := opts.Workdir.Sub("apply-" + rel)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	planPath := filepath.Join(tmpDir, "apply.tfplan")
+
+	if _, err := runner.PlanWithOutput(ctx, stackDir, planPath); err != nil {
+		return err
+	}
+	if err := checkPolicy(ctx, runner, opts, stackDir, rel, planPath); err != nil {
+		return err
+	}
+	return runner.ApplyPlan(ctx, stackDir, planPath)
+}
+
+// checkPolicy runs the policy gate, if any, on the plan file at planPath.
+func checkPolicy(ctx context.Context, runner runner, opts Options, stackDir, rel, planPath string) error {
+	if opts.Policy == nil || opts.Backend != nil {
+		return nil
+	}
+	plan, err := runner.ShowPlan(ctx, stackDir, planPath)
+	if err != nil {
+		return fmt.Errorf("show plan for policy check: %w", err)
+	}
+	return opts.Policy.Check(ctx, rel, plan)
+}
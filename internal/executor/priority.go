@@ -0,0 +1,100 @@
+package executor
+
+import "sort"
+
+// prioritize orders a layer for dispatch: stacks marked critical first, then
+// stacks with longer chains of dependents, since those gate the most
+// remaining work, then by name.
+func (e *executor) prioritize(layer []string) []string {
+	depth := make(map[string]int, len(e.graph))
+	ordered := append([]string(nil), layer...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if ca, cb := e.graph[a].Critical, e.graph[b].Critical; ca != cb {
+			return ca
+		}
+		if da, db := e.chainDepth(a, depth), e.chainDepth(b, depth); da != db {
+			return da > db
+		}
+		return e.relNames[a] < e.relNames[b]
+	})
+	return ordered
+}
+
+// chainDepth returns the length of the longest chain of dependents below
+// path, memoised in depth.
+func (e *executor) chainDepth(path string, depth map[string]int) int {
+	if d, ok := depth[path]; ok {
+		return d
+	}
+	// Guard against cycles, which RunAll reports separately.
+	depth[path] = 0
+	longest := 0
+	for _, dependent := range e.dependents[path] {
+		if d := e.chainDepth(dependent, depth) + 1; d > longest {
+			longest = d
+		}
+	}
+	depth[path] = longest
+	return longest
+}
+
+// priorityStacks returns the stacks that may take the slot reserved for the
+// critical path: those marked critical and those on a longest chain of
+// dependencies.
+func (e *executor) priorityStacks() map[string]bool {
+	below := make(map[string]int, len(e.graph))
+	above := make(map[string]int, len(e.graph))
+	longest := 0
+	for path := range e.graph {
+		longest = max(longest, e.chainDepth(path, below)+e.dependencyDepth(path, above))
+	}
+	priority := make(map[string]bool)
+	for path, stack := range e.graph {
+		if stack.Critical || (longest > 0 && below[path]+above[path] == longest) {
+			priority[path] = true
+		}
+	}
+	return priority
+}
+
+// dependencyDepth returns the length of the longest chain of dependencies
+// above path, memoised in depth.
+func (e *executor) dependencyDepth(path string, depth map[string]int) int {
+	if d, ok := depth[path]; ok {
+		return d
+	}
+	depth[path] = 0
+	longest := 0
+	for _, dep := range e.graph[path].Dependencies {
+		if _, ok := e.graph[dep]; !ok {
+			continue
+		}
+		if d := e.dependencyDepth(dep, depth) + 1; d > longest {
+			longest = d
+		}
+	}
+	depth[path] = longest
+	return longest
+}
+
+// isPending reports whether path is a priority stack that has not started.
+func (e *executor) isPending(path string) bool {
+	e.pendingMu.Lock()
+	defer e.pendingMu.Unlock()
+	return e.pending[path]
+}
+
+// started records that path no longer waits for a slot. Once no priority
+// stack is left waiting, the reserved slot is given back to every stack.
+func (e *executor) started(path string) {
+	e.pendingMu.Lock()
+	defer e.pendingMu.Unlock()
+	if !e.pending[path] {
+		return
+	}
+	delete(e.pending, path)
+	if len(e.pending) == 0 {
+		e.limiter.setReserve(0)
+	}
+}
@@ -0,0 +1,185 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/hashicorp/terraform-exec/tfexec"
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"terraform-wrapper/internal/graph"
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/remote"
+	"terraform-wrapper/internal/stacks"
+)
+
+// runnerFor selects the local terraform runner or, when a remote backend is
+// configured, a runner that dispatches each stack to that backend.
+func runnerFor(ctx context.Context, opts Options, terraformPath string) (runner, error) {
+	if opts.Backend != nil {
+		if len(opts.ExtraVarFiles) > 0 {
+			return nil, fmt.Errorf("extra var files are not supported with the %s backend", opts.Backend.Name())
+		}
+		if opts.TFLog != "" {
+			return nil, fmt.Errorf("terraform logs are not captured with the %s backend", opts.Backend.Name())
+		}
+		rootAbs, err := filepath.Abs(opts.RootDir)
+		if err != nil {
+			return nil, err
+		}
+		return &remoteRunner{options: opts, rootAbs: rootAbs}, nil
+	}
+	return newRunner(ctx, stacks.RunnerOptions{
+		RootDir:        opts.RootDir,
+		Environment:    opts.Environment,
+		AccountID:      opts.AccountID,
+		Region:         opts.Region,
+		TerraformPath:  terraformPath,
+		DisableRefresh: opts.DisableRefresh,
+		DisableLocking: opts.DisableLocking,
+		Profile:        opts.Profile,
+		Workspace:      opts.Workspace,
+		StateKMSKeyID:  opts.StateKMSKeyID,
+		StateBackend:   opts.StateBackend,
+		AssumeRoleARN:  opts.AssumeRoleARN,
+		PrefixOutput:   opts.PrefixOutput,
+		Group:          opts.OutputGroup,
+		ExtraVarFiles:  opts.ExtraVarFiles,
+		Color:          opts.Color,
+		Retry:          opts.Retry,
+		TFLog:          opts.TFLog,
+		TFLogDir:       opts.TFLogDir,
+		StateBackups:   opts.StateBackups,
+		BackendChange:  opts.BackendChange,
+	})
+}
+
+// checkPropagation refuses to apply stacks whose outputs other stacks consume
+// through propagate_outputs on a remote backend. The remote runner applies
+// them in its own checkout, so the outputs would never reach the consumers'
+// generated tfvars here.
+func (o Options) checkPropagation(rootAbs string, g graph.Graph) error {
+	if o.Backend == nil || o.Propagator == nil {
+		return nil
+	}
+	paths := make([]string, 0, len(g))
+	for path := range g {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if !o.Propagator.Consumes(path) {
+			continue
+		}
+		rel, err := filepath.Rel(rootAbs, path)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("outputs of %s are propagated to the stacks that consume them, which is not supported with the %s backend; apply it locally", filepath.ToSlash(rel), o.Backend.Name())
+	}
+	return nil
+}
+
+// remoteRunner runs the wrapper's single-stack commands on a remote backend and
+// tees the streamed logs to stdout and .terraform-wrapper/remote/<env>/.
+type remoteRunner struct {
+	options Options
+	rootAbs string
+}
+
+func (r *remoteRunner) Apply(ctx context.Context, stackDir string) error {
+	return r.run(ctx, "apply", stackDir)
+}
+
+// ApplyPlan is not supported remotely: plans cached on this machine are not
+// available to the remote runner.
+func (r *remoteRunner) ApplyPlan(ctx context.Context, stackDir, planPath string) error {
+	return fmt.Errorf("applying cached plans is not supported with the %s backend", r.options.Backend.Name())
+}
+
+func (r *remoteRunner) Destroy(ctx context.Context, stackDir string) error {
+	return r.run(ctx, "destroy", stackDir)
+}
+
+// PlanDestroy plans the teardown remotely; like PlanWithOutput it does not
+// write planPath and always reports changes.
+func (r *remoteRunner) PlanDestroy(ctx context.Context, stackDir, planPath string) (bool, error) {
+	return true, r.run(ctx, "plan", stackDir, "--destroy")
+}
+
+// Validate is not supported remotely: the remote runner only runs the
+// wrapper's plan, apply, destroy and init.
+func (r *remoteRunner) Validate(ctx context.Context, stackDir string) error {
+	return fmt.Errorf("validating stacks is not supported with the %s backend", r.options.Backend.Name())
+}
+
+func (r *remoteRunner) InitOnly(ctx context.Context, stackDir string, upgrade bool) error {
+	if r.options.BackendChange != stacks.BackendUnchanged {
+		return fmt.Errorf("--%s is not supported with the %s backend", r.options.BackendChange, r.options.Backend.Name())
+	}
+	return r.run(ctx, "init", stackDir)
+}
+
+// PlanWithOutput plans remotely. The binary plan stays with the remote runner,
+// so planPath is not written and the stack is re-planned on the next run. The
+// remote exit status does not say whether the plan has changes, so it is
+// always reported as changed.
+func (r *remoteRunner) PlanWithOutput(ctx context.Context, stackDir, planPath string) (bool, error) {
+	return true, r.run(ctx, "plan", stackDir)
+}
+
+// ShowPlan is not supported remotely: remote plans are not written locally.
+func (r *remoteRunner) ShowPlan(ctx context.Context, stackDir, planPath string) (*tfjson.Plan, error) {
+	return nil, fmt.Errorf("showing plans is not supported with the %s backend", r.options.Backend.Name())
+}
+
+// Outputs is not available remotely; the remote apply publishes its own exports.
+func (r *remoteRunner) Outputs(ctx context.Context, stackDir string) (map[string]tfexec.OutputMeta, error) {
+	return nil, fmt.Errorf("stack outputs are not available from the %s backend", r.options.Backend.Name())
+}
+
+func (r *remoteRunner) VarFilesFor(stackDir string) []string {
+	return stacks.VarFiles(r.rootAbs, stackDir, r.options.Environment, r.options.Profile)
+}
+
+func (r *remoteRunner) run(ctx context.Context, command, stackDir string, flags ...string) error {
+	rel, err := filepath.Rel(r.rootAbs, stackDir)
+	if err != nil {
+		return err
+	}
+	rel = filepath.ToSlash(rel)
+
+	logPath := remote.LogPath(r.rootAbs, r.options.scope(), rel)
+	if err := ensureDir(filepath.Dir(logPath)); err != nil {
+		return err
+	}
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		return fmt.Errorf("create remote log: %w", err)
+	}
+
+	err = r.options.Backend.Run(ctx, remote.Job{
+		Command:          command,
+		Flags:            flags,
+		Stack:            rel,
+		Environment:      r.options.Environment,
+		Profile:          r.options.Profile,
+		Workspace:        r.options.Workspace,
+		AccountID:        r.options.AccountID,
+		Region:           r.options.Region,
+		TerraformVersion: r.options.TerraformVersion,
+		Engine:           r.options.Engine,
+		Revision:         r.options.Revision,
+		AssumeRoleARN:    r.options.AssumeRoleARN,
+		Tenant:           r.options.Tenant,
+		RunFlags:         r.options.RemoteFlags,
+	}, io.MultiWriter(output.Progress(), logFile))
+	if cerr := logFile.Close(); cerr != nil && err == nil {
+		err = fmt.Errorf("close remote log: %w", cerr)
+	}
+	return err
+}
@@ -8,13 +8,16 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"terraform-wrapper/internal/cache"
 	"terraform-wrapper/internal/graph"
-	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/logging"
 	"terraform-wrapper/internal/stacks"
+	"terraform-wrapper/internal/triage"
 )
 
 type ResultStatus int
@@ -40,10 +43,20 @@ type executor struct {
 	relNames        map[string]string
 	indegree        map[string]int
 	dependents      map[string][]string
-	progress        *output.Manager
+	progress        *progressSink
+	limiter         *limiter
 	waitingNotified map[string]bool
 	planHashes      map[string][]byte
+	planChanges     map[string]bool
 	hashMu          sync.Mutex
+	failed          []string
+	// notStarted holds the stacks a layer skipped because it was cancelled
+	// before they started.
+	notStarted []string
+	// pending holds the priority stacks that have not started yet; while
+	// there are any, the limiter keeps a slot for them.
+	pending   map[string]bool
+	pendingMu sync.Mutex
 }
 
 func newExecutor(ctx context.Context, g graph.Graph, opts Options) (*executor, error) {
@@ -61,21 +74,32 @@ func newExecutor(ctx context.Context, g graph.Graph, opts Options) (*executor, e
 	relNames := make(map[string]string)
 	indegree := make(map[string]int)
 	dependents := make(map[string][]string)
-	progress := output.NewManager()
+	progress := opts.newProgress()
 	for path, stack := range g {
 		rel, err := filepath.Rel(rootAbs, path)
 		if err != nil {
 			return nil, err
 		}
 		relNames[path] = rel
-		progress.Register(rel)
+		progress.register(rel)
 		indegree[path] = len(stack.Dependencies)
 		for _, dep := range stack.Dependencies {
 			dependents[dep] = append(dependents[dep], path)
 		}
 	}
 
-	return &executor{
+	limiter := newLimiter(opts.Parallelism, opts.AdaptiveParallelism)
+	if opts.AdaptiveParallelism {
+		onTransient := opts.Retry.OnTransient
+		opts.Retry.OnTransient = func(class string) {
+			limiter.throttled(class)
+			if onTransient != nil {
+				onTransient(class)
+			}
+		}
+	}
+
+	e := &executor{
 		ctx:             ctx,
 		options:         opts,
 		graph:           g,
@@ -85,9 +109,18 @@ func newExecutor(ctx context.Context, g graph.Graph, opts Options) (*executor, e
 		indegree:        indegree,
 		dependents:      dependents,
 		progress:        progress,
+		limiter:         limiter,
 		waitingNotified: make(map[string]bool),
 		planHashes:      make(map[string][]byte),
-	}, nil
+		planChanges:     make(map[string]bool),
+	}
+	if opts.Parallelism > 1 {
+		e.pending = e.priorityStacks()
+		if len(e.pending) > 0 {
+			limiter.setReserve(1)
+		}
+	}
+	return e, nil
 }
 
 func (e *executor) readyNodes(processed map[string]bool) []string {
@@ -118,20 +151,27 @@ func (e *executor) notifyWaiting(processed map[string]bool) {
 			continue
 		}
 		e.waitingNotified[path] = true
-		rel := e.relNames[path]
-		e.progress.Waiting(rel, fmt.Sprintf("waiting for %s", strings.Join(waitingOn, ", ")))
+		e.progress.waiting(e.relNames[path], waitingOn)
 	}
 }
 
 func RunAll(ctx context.Context, g graph.Graph, opts Options, op Operation) (*Summary, error) {
+	ctx, cancel := opts.runContext(ctx)
+	defer cancel()
 	exec, err := newExecutor(ctx, g, opts)
 	if err != nil {
 		return nil, err
 	}
+	if op == OperationApply {
+		if err := opts.checkPropagation(exec.rootAbs, g); err != nil {
+			return nil, err
+		}
+	}
 
 	summary := &Summary{}
 	processed := make(map[string]bool)
 	layerIndex := 1
+	var runErr error
 
 	for len(processed) < len(g) {
 		exec.notifyWaiting(processed)
@@ -140,172 +180,534 @@ func RunAll(ctx context.Context, g graph.Graph, opts Options, op Operation) (*Su
 			return summary, errors.New("dependency cycle detected")
 		}
 
-		fmt.Printf("[layer %d] running: %s\n", layerIndex, exec.layerNames(layer))
-		layerSummary, err := exec.runLayer(layer, op)
+		exec.progress.Handle(LayerStarted{Index: layerIndex, Stacks: exec.layerNames(layer)})
+		layerSummary, admitted, err := exec.runLayer(layer, op, processed)
 		summary.Merge(layerSummary)
-		if err != nil {
-			return summary, err
-		}
+		layer = append(layer, admitted...)
 
 		for _, node := range layer {
-			processed[node] = true
-			for _, dep := range exec.dependents[node] {
-				exec.indegree[dep]--
+			exec.markProcessed(node, processed)
+		}
+		if err != nil && runErr == nil {
+			runErr = err
+		}
+		if runDeadlineExceeded(ctx) {
+			summary.Merge(exec.skipRemaining(processed, reasonRunDeadline))
+			if runErr == nil {
+				runErr = fmt.Errorf("run deadline of %s exceeded", opts.Timeout)
+			}
+			break
+		}
+		if err != nil {
+			if opts.KeepGoing {
+				summary.Merge(exec.skipDependents(layer, layerSummary, processed))
+			} else {
+				exec.stopAfterFailure(layer, layerSummary, processed)
 			}
 		}
 		layerIndex++
 	}
 
-	return summary, nil
+	return summary, runErr
+}
+
+func (e *executor) markProcessed(node string, processed map[string]bool) {
+	processed[node] = true
+	e.started(node)
+	for _, dep := range e.dependents[node] {
+		e.indegree[dep]--
+	}
+}
+
+// stopAfterFailure drops the remaining stacks once a layer has failed. Stacks
+// downstream of a failure only through soft edges keep running, together
+// with whatever else they depend on; everything else, including every stack
+// that depends on a failed stack through a regular edge, is not run.
+func (e *executor) stopAfterFailure(layer []string, layerSummary Summary, processed map[string]bool) {
+	for _, node := range layer {
+		if _, ok := layerSummary.Failed[e.relNames[node]]; ok {
+			e.failed = append(e.failed, node)
+		}
+	}
+
+	// Stacks that never started did not fail, but what depends on them
+	// cannot run either.
+	blocked := e.blockedBy(append(append([]string(nil), e.failed...), e.notStarted...))
+
+	keep := make(map[string]bool)
+	for _, failed := range e.failed {
+		for _, node := range e.graph.Downstream(failed) {
+			if processed[node] || blocked[node] {
+				continue
+			}
+			keep[node] = true
+			for _, up := range e.graph.Upstream(node) {
+				if !processed[up] && !blocked[up] {
+					keep[up] = true
+				}
+			}
+		}
+	}
+
+	var continuing []string
+	for node := range e.graph {
+		if processed[node] {
+			continue
+		}
+		if keep[node] {
+			continuing = append(continuing, e.relNames[node])
+			continue
+		}
+		e.markProcessed(node, processed)
+	}
+	if len(continuing) > 0 {
+		sort.Strings(continuing)
+		logging.Infof("[run] continuing with stacks that depend on the failure only through soft edges: %s", strings.Join(continuing, ", "))
+	}
 }
 
-func (e *executor) layerNames(layer []string) string {
+// Reasons stacks of a layer are skipped when the layer is cancelled before
+// they start.
+const (
+	reasonLayerFailed  = "not started: another stack failed"
+	reasonRunCancelled = "not started: run cancelled"
+)
+
+// blockedBy returns every stack that depends on one of failed through a
+// chain of regular edges.
+func (e *executor) blockedBy(failed []string) map[string]bool {
+	blocked := make(map[string]bool)
+	queue := append([]string(nil), failed...)
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, dependent := range e.dependents[node] {
+			if blocked[dependent] || e.graph[dependent].IsSoft(node) {
+				continue
+			}
+			blocked[dependent] = true
+			queue = append(queue, dependent)
+		}
+	}
+	return blocked
+}
+
+// skipDependents is stopAfterFailure for --keep-going: only the stacks that
+// depend on a failed stack of the layer through regular edges are skipped,
+// and every other branch keeps running.
+func (e *executor) skipDependents(layer []string, layerSummary Summary, processed map[string]bool) Summary {
+	var failed []string
+	for _, node := range layer {
+		if _, ok := layerSummary.Failed[e.relNames[node]]; ok {
+			failed = append(failed, node)
+		}
+	}
+	e.failed = append(e.failed, failed...)
+
+	var summary Summary
+	for node := range e.blockedBy(failed) {
+		if processed[node] {
+			continue
+		}
+		e.markProcessed(node, processed)
+		summary.Skipped++
+		summary.DependencyFailed = append(summary.DependencyFailed, e.relNames[node])
+	}
+	sort.Strings(summary.DependencyFailed)
+	for _, rel := range summary.DependencyFailed {
+		e.progress.skip(rel, "dependency failed")
+	}
+	return summary
+}
+
+// skipRemaining skips every stack not processed yet, such as those left when
+// the run's deadline passes.
+func (e *executor) skipRemaining(processed map[string]bool, reason string) Summary {
+	var skipped []string
+	for node := range e.graph {
+		if processed[node] {
+			continue
+		}
+		e.markProcessed(node, processed)
+		skipped = append(skipped, e.relNames[node])
+	}
+	sort.Strings(skipped)
+	for _, rel := range skipped {
+		e.progress.skip(rel, reason)
+	}
+	return Summary{Skipped: len(skipped)}
+}
+
+func (e *executor) layerNames(layer []string) []string {
 	rels := make([]string, len(layer))
 	for i, path := range layer {
 		rels[i] = e.relNames[path]
 	}
-	return strings.Join(rels, ", ")
+	return rels
 }
 
-func (e *executor) runLayer(layer []string, op Operation) (Summary, error) {
+// runLayer runs the stacks of layer. Critical stacks whose dependencies all
+// finish during the layer start straight away rather than waiting for the
+// next layer; they are returned so the caller treats them as part of it.
+func (e *executor) runLayer(layer []string, op Operation, processed map[string]bool) (Summary, []string, error) {
 	ctx, cancel := context.WithCancel(e.ctx)
 	defer cancel()
 
-	sem := make(chan struct{}, e.options.Parallelism)
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 	var firstErr error
 	summary := Summary{Failed: make(map[string]error)}
+	// done holds the stacks of the layer that finished without failing.
+	done := make(map[string]bool)
+	scheduled := make(map[string]bool, len(layer))
+	for _, path := range layer {
+		scheduled[path] = true
+	}
+	var admitted []string
+
+	skipNotStarted := func(paths []string) {
+		reason := reasonLayerFailed
+		switch {
+		case runDeadlineExceeded(ctx):
+			reason = reasonRunDeadline
+		case e.ctx.Err() != nil:
+			reason = reasonRunCancelled
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, path := range paths {
+			e.progress.skip(e.relNames[path], reason)
+			summary.Skipped++
+		}
+		e.notStarted = append(e.notStarted, paths...)
+	}
 
-	for _, stackPath := range layer {
-		// looks like an error, not an error! shadow loop variable so each goroutine gets its own copy.
-		stackPath := stackPath
-		rel := e.relNames[stackPath]
-		stack := e.graph[stackPath]
-		wg.Add(1)
-		go func(rel string, stack *graph.Stack) {
-			defer wg.Done()
-			select {
-			case sem <- struct{}{}:
-			case <-ctx.Done():
-				return
-			}
-			defer func() { <-sem }()
+	var run func(stackPath string)
 
-			e.progress.Start(rel)
+	// finished admits the critical dependents of stackPath that have
+	// nothing left to wait for. It is called with mu held.
+	finished := func(stackPath string) {
+		done[stackPath] = true
+		if firstErr != nil || e.pending == nil {
+			return
+		}
+		for _, dependent := range e.dependents[stackPath] {
+			if !e.graph[dependent].Critical || processed[dependent] || scheduled[dependent] {
+				continue
+			}
+			ready := true
+			for _, dep := range e.graph[dependent].Dependencies {
+				if !processed[dep] && !done[dep] {
+					ready = false
+					break
+				}
+			}
+			if !ready {
+				continue
+			}
+			scheduled[dependent] = true
+			admitted = append(admitted, dependent)
+			wg.Add(1)
+			// The stack takes a free slot straight away, before the one
+			// stackPath holds is released to the rest of the layer.
+			if e.limiter.tryAcquire(true) {
+				e.started(dependent)
+				go run(dependent)
+				continue
+			}
+			go func() {
+				acquired := e.limiter.acquire(ctx, true) == nil
+				if ctx.Err() != nil {
+					if acquired {
+						e.limiter.release()
+					}
+					wg.Done()
+					skipNotStarted([]string{dependent})
+					return
+				}
+				e.started(dependent)
+				run(dependent)
+			}()
+		}
+	}
 
-			status, err := e.executeStack(ctx, stack, rel, op)
+	run = func(stackPath string) {
+		defer wg.Done()
+		defer e.limiter.release()
 
+		rel := e.relNames[stackPath]
+		stack := e.graph[stackPath]
+		if e.options.IsCompleted(rel) {
+			mu.Lock()
+			defer mu.Unlock()
+			e.progress.skip(rel, "completed in previous run")
+			summary.Skipped++
+			summary.Completed = append(summary.Completed, rel)
+			finished(stackPath)
+			return
+		}
+		if e.options.skipsDestroy(stack, op) {
 			mu.Lock()
 			defer mu.Unlock()
-			if err != nil {
-				e.progress.Fail(rel, err)
-				summary.Failed[rel] = err
-				if firstErr == nil {
-					firstErr = err
+			e.progress.skip(rel, "skip_when_destroying")
+			summary.Skipped++
+			finished(stackPath)
+			return
+		}
+
+		e.progress.start(rel)
+
+		started := time.Now()
+		stackCtx, cancelStack := e.options.stackContext(ctx)
+		status, usage, err := e.options.monitor(stack.Path, func() (ResultStatus, error) {
+			return e.executeStack(stackCtx, stack, rel, op)
+		})
+		err = e.options.timeoutError(ctx, stackCtx, err)
+		cancelStack()
+		err = triage.Inspect(stack.Path, started, err)
+		if err == nil {
+			e.limiter.succeeded()
+		}
+		if err == nil && status == StatusExecuted && !e.options.planOnly(op) && e.options.Checkpoint != nil {
+			if markErr := e.options.Checkpoint.MarkDone(ctx, rel); markErr != nil {
+				logging.Warnf("[run] warning: %v", markErr)
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		summary.recordUsage(rel, usage)
+		if err != nil {
+			outcome := failureOutcome(err)
+			e.progress.finish(rel, outcome, err)
+			summary.Failed[rel] = err
+			if outcome == OutcomeTimedOut {
+				summary.TimedOut = append(summary.TimedOut, rel)
+			}
+			if firstErr == nil {
+				firstErr = err
+				if !e.options.KeepGoing {
 					cancel()
 				}
-				return
 			}
-			switch status {
-			case StatusCached:
-				e.progress.Skip(rel, "cache hit")
-				summary.Cached++
-			case StatusSkipped:
-				e.progress.Skip(rel, "skipped")
-				summary.Skipped++
-			default:
-				e.progress.Succeed(rel)
-				summary.Executed++
+			return
+		}
+		if (op.plans() || op == OperationPipeline) && e.hasChanges(stack.Path) {
+			summary.Changed = append(summary.Changed, rel)
+		}
+		switch status {
+		case StatusCached:
+			e.progress.finish(rel, OutcomeCached, nil)
+			summary.Cached++
+			summary.Completed = append(summary.Completed, rel)
+		case StatusSkipped:
+			e.progress.skip(rel, "skipped")
+			summary.Skipped++
+		default:
+			e.progress.finish(rel, OutcomeSucceeded, nil)
+			summary.Executed++
+			summary.Completed = append(summary.Completed, rel)
+		}
+		finished(stackPath)
+	}
+
+	// Stacks are started in priority order, so critical stacks and those
+	// with the longest chains of dependents take the first free slots, and
+	// the limiter keeps a slot free for them while any are still to come.
+	order := e.prioritize(layer)
+	for i, stackPath := range order {
+		acquired := e.limiter.acquire(ctx, e.isPending(stackPath)) == nil
+		if ctx.Err() != nil {
+			if acquired {
+				e.limiter.release()
 			}
-		}(rel, stack)
+			skipNotStarted(order[i:])
+			break
+		}
+		e.started(stackPath)
+		wg.Add(1)
+		go run(stackPath)
 	}
 
 	wg.Wait()
 	if len(summary.Failed) == 0 {
 		summary.Failed = nil
 	}
-	return summary, firstErr
+	return summary, admitted, firstErr
 }
 
 func (e *executor) executeStack(ctx context.Context, stack *graph.Stack, rel string, op Operation) (ResultStatus, error) {
-	runner, err := newRunner(ctx, stacks.RunnerOptions{
-		RootDir:        e.options.RootDir,
-		Environment:    e.options.Environment,
-		AccountID:      e.options.AccountID,
-		Region:         e.options.Region,
-		TerraformPath:  e.terraformPath,
-		DisableRefresh: e.options.DisableRefresh,
-	})
+	runner, err := runnerFor(ctx, e.options, e.terraformPath)
 	if err != nil {
 		return StatusExecuted, err
 	}
 
 	switch op {
 	case OperationPlan:
-		return e.planStack(ctx, runner, stack, rel)
+		status, err := e.planStack(ctx, runner, stack, rel)
+		if err == nil && status == StatusExecuted {
+			planPath, _ := cache.PlanFiles(e.options.RootDir, e.options.scope(), e.options.Workspace, rel)
+			reportPlan(ctx, runner, e.progress, e.options, stack.Path, rel, planPath, e.hasChanges(stack.Path))
+		}
+		return status, err
 	case OperationApply:
-		return StatusExecuted, runner.Apply(ctx, stack.Path)
+		if err := e.applyStack(ctx, runner, stack, rel); err != nil {
+			return StatusExecuted, err
+		}
+		tagState(ctx, stack, e.options)
+		return StatusExecuted, exportOutputs(ctx, runner, stack, rel, e.options)
 	case OperationDestroy:
 		return StatusExecuted, runner.Destroy(ctx, stack.Path)
+	case OperationPlanDestroy:
+		status, err := e.planDestroyStack(ctx, runner, stack, rel)
+		if err == nil && status == StatusExecuted {
+			planPath := cache.DestroyPlanFile(e.options.RootDir, e.options.scope(), e.options.Workspace, rel)
+			reportPlan(ctx, runner, e.progress, e.options, stack.Path, rel, planPath, e.hasChanges(stack.Path))
+		}
+		return status, err
 	case OperationInit:
 		return StatusExecuted, runner.InitOnly(ctx, stack.Path, true)
+	case OperationPipeline:
+		return StatusExecuted, e.runPipeline(ctx, runner, stack, rel)
 	default:
 		return StatusExecuted, fmt.Errorf("unknown operation")
 	}
 }
 
-func (e *executor) planStack(ctx context.Context, runner runner, stack *graph.Stack, rel string) (ResultStatus, error) {
-	stackDir := stack.Path
-	varFiles := runner.VarFilesFor(stackDir)
-
-	contentFiles, err := cache.StackContentFiles(stackDir, varFiles)
+// applyStack applies the stack, from its cached plan when FromPlan is set.
+// The cached plan's hash covers the plan hashes of the stack's dependencies,
+// as planStack computed it.
+func (e *executor) applyStack(ctx context.Context, runner runner, stack *graph.Stack, rel string) error {
+	if !e.options.FromPlan {
+		return applyChecked(ctx, runner, e.options, stack.Path, rel)
+	}
+	hash, err := e.planHash(runner, stack)
 	if err != nil {
-		return StatusExecuted, err
+		return err
 	}
+	e.setPlanHash(stack.Path, hash)
+	return applyCachedPlan(ctx, runner, e.options, stack.Path, rel, hash)
+}
 
-	baseHash, err := cache.ComputeHash(contentFiles)
+// planDestroyStack writes the stack's destroy plan. Destroy plans are never
+// served from the plan cache.
+func (e *executor) planDestroyStack(ctx context.Context, runner runner, stack *graph.Stack, rel string) (ResultStatus, error) {
+	planPath := cache.DestroyPlanFile(e.options.RootDir, e.options.scope(), e.options.Workspace, rel)
+	if err := ensureDir(filepath.Dir(planPath)); err != nil {
+		return StatusExecuted, err
+	}
+	changed, err := runner.PlanDestroy(ctx, stack.Path, planPath)
 	if err != nil {
 		return StatusExecuted, err
 	}
+	e.setChanges(stack.Path, changed)
+	return StatusExecuted, nil
+}
 
-	hasher := sha256.New()
-	hasher.Write(baseHash)
-	for _, dep := range stack.Dependencies {
-		if depHash := e.getPlanHash(dep); depHash != nil {
-			hasher.Write(depHash)
+// exportOutputs publishes the applied stack's declared exports and propagates
+// the outputs its dependents consume.
+func exportOutputs(ctx context.Context, runner runner, stack *graph.Stack, rel string, opts Options) error {
+	// Remote backends run the wrapper's own apply, which exports outputs
+	// itself. Propagated outputs were refused before the run started.
+	if opts.Backend != nil {
+		return nil
+	}
+	export := opts.Exporter != nil && len(stack.Exports) > 0
+	propagate := opts.Propagator != nil && opts.Propagator.Consumes(stack.Path)
+	if !export && !propagate {
+		return nil
+	}
+	outputs, err := runner.Outputs(ctx, stack.Path)
+	if err != nil {
+		return fmt.Errorf("read outputs for export: %w", err)
+	}
+	if export {
+		if err := opts.Exporter.Export(ctx, rel, stack.Exports, outputs); err != nil {
+			return err
 		}
 	}
-	hashBytes := hasher.Sum(nil)
+	if propagate {
+		return opts.Propagator.Propagate(ctx, stack.Path, outputs)
+	}
+	return nil
+}
+
+// tagState labels the applied stack's state object with the current run. The
+// apply has already succeeded, so a tagging failure is only reported.
+func tagState(ctx context.Context, stack *graph.Stack, opts Options) {
+	// Remote backends run the wrapper's own apply, which tags the state itself.
+	if opts.StateTagger == nil || opts.Backend != nil {
+		return
+	}
+	if err := opts.StateTagger.TagState(ctx, stack.Path); err != nil {
+		logging.Warnf("[run] warning: %v", err)
+	}
+}
+
+func (e *executor) planStack(ctx context.Context, runner runner, stack *graph.Stack, rel string) (ResultStatus, error) {
+	stackDir := stack.Path
+	hashBytes, err := e.planHash(runner, stack)
+	if err != nil {
+		return StatusExecuted, err
+	}
 
-	planPath, hashPath := cache.PlanFiles(e.options.RootDir, e.options.Environment, rel)
+	planPath, hashPath := cache.PlanFiles(e.options.RootDir, e.options.scope(), e.options.Workspace, rel)
 
 	if e.options.UseCache && !e.options.IsForced(rel) {
 		if cachedHash, err := cache.LoadHash(hashPath); err == nil {
 			if bytes.Equal(cachedHash, hashBytes) {
 				if _, err := os.Stat(planPath); err == nil {
 					e.setPlanHash(stack.Path, cachedHash)
+					e.setChanges(stack.Path, cache.LoadChanges(hashPath))
 					return StatusCached, nil
 				}
 			}
 		}
+		if changed, ok := fetchPlan(ctx, e.options, rel, hashBytes); ok {
+			e.setPlanHash(stack.Path, hashBytes)
+			e.setChanges(stack.Path, changed)
+			return StatusCached, nil
+		}
 	}
 
 	if err := ensureDir(filepath.Dir(planPath)); err != nil {
 		return StatusExecuted, err
 	}
 
-	if err := runner.PlanWithOutput(ctx, stackDir, planPath); err != nil {
+	changed, err := runner.PlanWithOutput(ctx, stackDir, planPath)
+	if err != nil {
 		return StatusExecuted, err
 	}
 
 	if err := cache.SaveHash(hashPath, hashBytes); err != nil {
 		return StatusExecuted, err
 	}
+	if err := cache.SaveChanges(hashPath, changed); err != nil {
+		return StatusExecuted, err
+	}
+	storePlan(ctx, e.options, rel, hashBytes, changed)
 	e.setPlanHash(stack.Path, hashBytes)
+	e.setChanges(stack.Path, changed)
 	return StatusExecuted, nil
 }
 
+// planHash combines the stack's content hash with the plan hashes of its
+// dependencies, so a dependency's change invalidates its dependents' plans.
+func (e *executor) planHash(runner runner, stack *graph.Stack) ([]byte, error) {
+	baseHash, err := contentHash(runner, stack.Path, e.options)
+	if err != nil {
+		return nil, err
+	}
+	hasher := sha256.New()
+	hasher.Write(baseHash)
+	for _, dep := range stack.Dependencies {
+		if depHash := e.getPlanHash(dep); depHash != nil {
+			hasher.Write(depHash)
+		}
+	}
+	return hasher.Sum(nil), nil
+}
+
 func (e *executor) getPlanHash(stackPath string) []byte {
 	e.hashMu.Lock()
 	defer e.hashMu.Unlock()
@@ -318,6 +720,18 @@ func (e *executor) setPlanHash(stackPath string, hash []byte) {
 	e.planHashes[stackPath] = hash
 }
 
+func (e *executor) hasChanges(stackPath string) bool {
+	e.hashMu.Lock()
+	defer e.hashMu.Unlock()
+	return e.planChanges[stackPath]
+}
+
+func (e *executor) setChanges(stackPath string, changed bool) {
+	e.hashMu.Lock()
+	defer e.hashMu.Unlock()
+	e.planChanges[stackPath] = changed
+}
+
 func ensureDir(path string) error {
 	return os.MkdirAll(path, 0o755)
 }
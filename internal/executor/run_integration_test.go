@@ -11,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/hashicorp/terraform-exec/tfexec"
+	tfjson "github.com/hashicorp/terraform-json"
 	"github.com/stretchr/testify/require"
 
 	"terraform-wrapper/internal/graph"
@@ -107,11 +108,23 @@ func (r *integrationRunner) Apply(context.Context, string) error {
 	return errors.New("apply not supported in integration runner")
 }
 
+func (r *integrationRunner) ApplyPlan(context.Context, string, string) error {
+	return errors.New("apply not supported in integration runner")
+}
+
 func (r *integrationRunner) Destroy(context.Context, string) error {
 	// TODO: implement destroy intergration test against Localstack
 	return errors.New("destroy not supported in integration runner")
 }
 
+func (r *integrationRunner) PlanDestroy(context.Context, string, string) (bool, error) {
+	return false, errors.New("destroy plans not supported in integration runner")
+}
+
+func (r *integrationRunner) Validate(context.Context, string) error {
+	return errors.New("validate not supported in integration runner")
+}
+
 func (r *integrationRunner) InitOnly(ctx context.Context, stack string, upgrade bool) error {
 	tf, err := r.newTerraform(stack)
 	if err != nil {
@@ -125,14 +138,14 @@ func (r *integrationRunner) InitOnly(ctx context.Context, stack string, upgrade
 	return tf.Init(ctx, initOpts...)
 }
 
-func (r *integrationRunner) PlanWithOutput(ctx context.Context, stack, planPath string) error {
+func (r *integrationRunner) PlanWithOutput(ctx context.Context, stack, planPath string) (bool, error) {
 	tf, err := r.newTerraform(stack)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	if err := tf.Init(ctx, tfexec.Backend(false)); err != nil {
-		return err
+		return false, err
 	}
 
 	opts := []tfexec.PlanOption{tfexec.Out(planPath), tfexec.Lock(false), tfexec.Refresh(false)}
@@ -140,12 +153,27 @@ func (r *integrationRunner) PlanWithOutput(ctx context.Context, stack, planPath
 		opts = append(opts, tfexec.VarFile(vf))
 	}
 
-	_, err = tf.Plan(ctx, opts...)
-	return err
+	return tf.Plan(ctx, opts...)
+}
+
+func (r *integrationRunner) Outputs(ctx context.Context, stack string) (map[string]tfexec.OutputMeta, error) {
+	tf, err := r.newTerraform(stack)
+	if err != nil {
+		return nil, err
+	}
+	return tf.Output(ctx)
+}
+
+func (r *integrationRunner) ShowPlan(ctx context.Context, stack, planPath string) (*tfjson.Plan, error) {
+	tf, err := r.newTerraform(stack)
+	if err != nil {
+		return nil, err
+	}
+	return tf.ShowPlanFile(ctx, planPath)
 }
 
 func (r *integrationRunner) VarFilesFor(stack string) []string {
-	return stacks.VarFiles(r.root, stack, r.environment)
+	return stacks.VarFiles(r.root, stack, r.environment, "")
 }
 
 func (r *integrationRunner) newTerraform(stack string) (*tfexec.Terraform, error) {
@@ -2,17 +2,23 @@ package executor
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/hashicorp/terraform-exec/tfexec"
+	tfjson "github.com/hashicorp/terraform-json"
 	"github.com/stretchr/testify/require"
 
 	"terraform-wrapper/internal/cache"
 	"terraform-wrapper/internal/graph"
+	"terraform-wrapper/internal/remote"
 	"terraform-wrapper/internal/stacks"
 )
 
@@ -53,10 +59,670 @@ func TestRunAllApplyRespectsDependencies(t *testing.T) {
 	require.Less(t, index["apply:b"], index["apply:c"])
 }
 
+func TestPlanDestroyAllRunsInReverseOrderAndSkipsMarkedStacks(t *testing.T) {
+	root := t.TempDir()
+	factory := newFakeRunnerFactory(root)
+	withFakeRunner(t, factory)
+
+	stackA := filepath.Join(root, "a")
+	stackB := filepath.Join(root, "b")
+	stackC := filepath.Join(root, "c")
+
+	g := graph.Graph{
+		stackA: {Path: stackA},
+		stackB: {Path: stackB, Dependencies: []string{stackA}, SkipDestroy: true},
+		stackC: {Path: stackC, Dependencies: []string{stackB}},
+	}
+
+	opts := Options{
+		RootDir:       root,
+		Environment:   "dev",
+		AccountID:     "123456789012",
+		Region:        "eu-west-2",
+		Parallelism:   2,
+		TerraformPath: "/tmp/terraform",
+	}
+
+	summary, err := PlanDestroyAll(context.Background(), g, opts)
+	require.NoError(t, err)
+	require.Equal(t, 2, summary.Executed)
+	require.Equal(t, 1, summary.Skipped)
+	require.ElementsMatch(t, []string{"a", "c"}, summary.Changed)
+	require.Equal(t, []string{"plan-destroy:c", "show:c", "plan-destroy:a", "show:a"}, factory.records())
+	require.FileExists(t, cache.DestroyPlanFile(root, "dev", "", "a"))
+
+	factory.reset()
+	opts.ForceDestroySkipped = true
+	summary, err = DestroyAll(context.Background(), g, opts)
+	require.NoError(t, err)
+	require.Equal(t, 3, summary.Executed)
+	require.Zero(t, summary.Skipped)
+	require.Equal(t, []string{"destroy:c", "destroy:b", "destroy:a"}, factory.records())
+}
+
 func TestRunAllStopsOnError(t *testing.T) {
 	root := t.TempDir()
 	factory := newFakeRunnerFactory(root)
-	factory.failures["b"] = errors.New("boom")
+	factory.failures["b"] = errors.New("boom")
+	withFakeRunner(t, factory)
+
+	stackA := filepath.Join(root, "a")
+	stackB := filepath.Join(root, "b")
+
+	g := graph.Graph{
+		stackA: {Path: stackA},
+		stackB: {Path: stackB, Dependencies: []string{stackA}},
+	}
+
+	opts := Options{
+		RootDir:       root,
+		Environment:   "dev",
+		AccountID:     "123",
+		Region:        "eu-west-2",
+		UseCache:      true,
+		TerraformPath: "/tmp/terraform",
+	}
+
+	summary, err := RunAll(context.Background(), g, opts, OperationApply)
+	require.Error(t, err)
+	require.NotNil(t, summary.Failed)
+	require.Contains(t, summary.Failed, "b")
+}
+
+func TestRunAllSendsTypedEventsToSink(t *testing.T) {
+	root := t.TempDir()
+	factory := newFakeRunnerFactory(root)
+	factory.failures["b"] = errors.New("boom")
+	withFakeRunner(t, factory)
+
+	stackA := filepath.Join(root, "a")
+	stackB := filepath.Join(root, "b")
+
+	g := graph.Graph{
+		stackA: {Path: stackA},
+		stackB: {Path: stackB, Dependencies: []string{stackA}},
+	}
+
+	var events []Event
+	opts := Options{
+		RootDir:       root,
+		Environment:   "dev",
+		AccountID:     "123",
+		Region:        "eu-west-2",
+		TerraformPath: "/tmp/terraform",
+		EventSink:     EventSinkFunc(func(event Event) { events = append(events, event) }),
+	}
+
+	_, err := RunAll(context.Background(), g, opts, OperationApply)
+	require.Error(t, err)
+
+	require.Len(t, events, 7)
+	require.Equal(t, StackWaiting{Stack: "b", WaitingOn: []string{"a"}}, events[0])
+	require.Equal(t, LayerStarted{Index: 1, Stacks: []string{"a"}}, events[1])
+	require.Equal(t, StackStarted{Stack: "a"}, events[2])
+	require.Equal(t, OutcomeSucceeded, events[3].(StackFinished).Outcome)
+	require.Equal(t, LayerStarted{Index: 2, Stacks: []string{"b"}}, events[4])
+	require.Equal(t, StackStarted{Stack: "b"}, events[5])
+	failed := events[6].(StackFinished)
+	require.Equal(t, OutcomeFailed, failed.Outcome)
+	require.EqualError(t, failed.Err, "boom")
+}
+
+func TestRunAllStartsCriticalAndDeepStacksFirst(t *testing.T) {
+	root := t.TempDir()
+	factory := newFakeRunnerFactory(root)
+	withFakeRunner(t, factory)
+
+	path := func(name string) string { return filepath.Join(root, name) }
+	g := graph.Graph{
+		path("a-leaf"):   {Path: path("a-leaf")},
+		path("b-leaf"):   {Path: path("b-leaf")},
+		path("network"):  {Path: path("network")},
+		path("database"): {Path: path("database"), Critical: true},
+		path("ecs"):      {Path: path("ecs"), Dependencies: []string{path("network")}},
+		path("service"):  {Path: path("service"), Dependencies: []string{path("ecs")}},
+	}
+
+	opts := Options{
+		RootDir:       root,
+		Environment:   "dev",
+		AccountID:     "123",
+		Region:        "eu-west-2",
+		TerraformPath: "/tmp/terraform",
+		Parallelism:   1,
+	}
+	_, err := RunAll(context.Background(), g, opts, OperationApply)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"apply:database",
+		"apply:network",
+		"apply:a-leaf",
+		"apply:b-leaf",
+		"apply:ecs",
+		"apply:service",
+	}, factory.records())
+}
+
+func TestRunAllKeepGoingSkipsOnlyDependentsOfFailure(t *testing.T) {
+	root := t.TempDir()
+	factory := newFakeRunnerFactory(root)
+	factory.failures["a"] = errors.New("boom")
+	withFakeRunner(t, factory)
+
+	path := func(name string) string { return filepath.Join(root, name) }
+	g := graph.Graph{
+		path("a"): {Path: path("a")},
+		path("b"): {Path: path("b"), Dependencies: []string{path("a")}},
+		path("c"): {Path: path("c")},
+		path("d"): {Path: path("d"), Dependencies: []string{path("c")}},
+		path("e"): {Path: path("e"), Dependencies: []string{path("b"), path("d")}},
+		path("f"): {Path: path("f"), Dependencies: []string{path("d")}},
+	}
+
+	var skipped []StackFinished
+	opts := Options{
+		RootDir:       root,
+		Environment:   "dev",
+		AccountID:     "123",
+		Region:        "eu-west-2",
+		TerraformPath: "/tmp/terraform",
+		KeepGoing:     true,
+		EventSink: EventSinkFunc(func(event Event) {
+			if ev, ok := event.(StackFinished); ok && ev.Outcome == OutcomeSkipped {
+				skipped = append(skipped, ev)
+			}
+		}),
+	}
+	summary, err := RunAll(context.Background(), g, opts, OperationApply)
+	require.EqualError(t, err, "boom")
+
+	require.ElementsMatch(t, []string{"apply:a", "apply:c", "apply:d", "apply:f"}, factory.records())
+	require.Equal(t, []string{"b", "e"}, summary.DependencyFailed)
+	require.Equal(t, 2, summary.Skipped)
+	require.Equal(t, 3, summary.Executed)
+	require.Contains(t, summary.Failed, "a")
+	require.Len(t, skipped, 2)
+	require.Equal(t, "dependency failed", skipped[0].Reason)
+}
+
+func TestRunAllStackTimeoutFailsOnlyHungStack(t *testing.T) {
+	root := t.TempDir()
+	factory := newFakeRunnerFactory(root)
+	factory.hangs["hung"] = true
+	withFakeRunner(t, factory)
+
+	path := func(name string) string { return filepath.Join(root, name) }
+	g := graph.Graph{
+		path("hung"): {Path: path("hung")},
+		path("ok"):   {Path: path("ok")},
+		path("next"): {Path: path("next"), Dependencies: []string{path("hung")}},
+	}
+
+	var outcomes []Outcome
+	opts := Options{
+		RootDir:       root,
+		Environment:   "dev",
+		AccountID:     "123",
+		Region:        "eu-west-2",
+		TerraformPath: "/tmp/terraform",
+		StackTimeout:  50 * time.Millisecond,
+		KeepGoing:     true,
+		EventSink: EventSinkFunc(func(event Event) {
+			if ev, ok := event.(StackFinished); ok && ev.Stack == "hung" {
+				outcomes = append(outcomes, ev.Outcome)
+			}
+		}),
+	}
+	summary, err := RunAll(context.Background(), g, opts, OperationApply)
+	require.Error(t, err)
+
+	var timeout *TimeoutError
+	require.ErrorAs(t, summary.Failed["hung"], &timeout)
+	require.False(t, timeout.Run)
+	require.ErrorIs(t, summary.Failed["hung"], context.DeadlineExceeded)
+	require.Equal(t, []string{"hung"}, summary.TimedOut)
+	require.Equal(t, []Outcome{OutcomeTimedOut}, outcomes)
+	require.Equal(t, []string{"next"}, summary.DependencyFailed)
+	require.Contains(t, summary.Completed, "ok")
+}
+
+func TestRunAllDeadlineSkipsStacksNotStarted(t *testing.T) {
+	root := t.TempDir()
+	factory := newFakeRunnerFactory(root)
+	factory.hangs["slow"] = true
+	withFakeRunner(t, factory)
+
+	path := func(name string) string { return filepath.Join(root, name) }
+	g := graph.Graph{
+		path("slow"):  {Path: path("slow")},
+		path("after"): {Path: path("after"), Dependencies: []string{path("slow")}},
+		path("other"): {Path: path("other"), Dependencies: []string{path("slow")}},
+	}
+
+	var skipped []string
+	opts := Options{
+		RootDir:       root,
+		Environment:   "dev",
+		AccountID:     "123",
+		Region:        "eu-west-2",
+		TerraformPath: "/tmp/terraform",
+		Timeout:       50 * time.Millisecond,
+		EventSink: EventSinkFunc(func(event Event) {
+			if ev, ok := event.(StackFinished); ok && ev.Outcome == OutcomeSkipped {
+				require.Equal(t, "run deadline exceeded", ev.Reason)
+				skipped = append(skipped, ev.Stack)
+			}
+		}),
+	}
+	summary, err := RunAll(context.Background(), g, opts, OperationApply)
+	require.Error(t, err)
+
+	var timeout *TimeoutError
+	require.ErrorAs(t, summary.Failed["slow"], &timeout)
+	require.True(t, timeout.Run)
+	require.Equal(t, []string{"slow"}, summary.TimedOut)
+	require.Equal(t, []string{"after", "other"}, skipped)
+	require.Equal(t, 2, summary.Skipped)
+	require.Equal(t, []string{"apply:slow"}, factory.records())
+}
+
+func TestRunAllContinuesPastFailedSoftDependency(t *testing.T) {
+	root := t.TempDir()
+	factory := newFakeRunnerFactory(root)
+	factory.failures["a"] = errors.New("boom")
+	withFakeRunner(t, factory)
+
+	stackA := filepath.Join(root, "a")
+	stackB := filepath.Join(root, "b")
+	stackC := filepath.Join(root, "c")
+	stackD := filepath.Join(root, "d")
+
+	g := graph.Graph{
+		stackA: {Path: stackA},
+		stackB: {Path: stackB, Dependencies: []string{stackA}, Edges: map[string]graph.Edge{stackA: {Path: stackA, Soft: true}}},
+		stackC: {Path: stackC, Dependencies: []string{stackA}},
+		stackD: {Path: stackD, Dependencies: []string{stackC}, Edges: map[string]graph.Edge{stackC: {Path: stackC, Soft: true}}},
+	}
+
+	opts := Options{
+		RootDir:       root,
+		Environment:   "dev",
+		AccountID:     "123",
+		Region:        "eu-west-2",
+		TerraformPath: "/tmp/terraform",
+	}
+
+	summary, err := RunAll(context.Background(), g, opts, OperationApply)
+	require.Error(t, err)
+	require.Contains(t, summary.Failed, "a")
+	require.ElementsMatch(t, []string{"b", "d"}, summary.Completed)
+	require.NotContains(t, factory.records(), "apply:c")
+}
+
+func TestRunAllSkipsStacksNotStartedAfterFailure(t *testing.T) {
+	root := t.TempDir()
+	factory := newFakeRunnerFactory(root)
+	factory.failures["a"] = errors.New("boom")
+	withFakeRunner(t, factory)
+
+	path := func(name string) string { return filepath.Join(root, name) }
+	g := graph.Graph{
+		path("a"): {Path: path("a"), Critical: true},
+		path("b"): {Path: path("b")},
+		path("c"): {Path: path("c"), Dependencies: []string{path("a")}, Edges: map[string]graph.Edge{path("a"): {Path: path("a"), Soft: true}}},
+		path("d"): {
+			Path:         path("d"),
+			Dependencies: []string{path("a"), path("b")},
+			Edges:        map[string]graph.Edge{path("a"): {Path: path("a"), Soft: true}},
+		},
+	}
+
+	var skipped []StackFinished
+	opts := Options{
+		RootDir:       root,
+		Environment:   "dev",
+		AccountID:     "123",
+		Region:        "eu-west-2",
+		TerraformPath: "/tmp/terraform",
+		Parallelism:   1,
+		EventSink: EventSinkFunc(func(event Event) {
+			if ev, ok := event.(StackFinished); ok && ev.Outcome == OutcomeSkipped {
+				skipped = append(skipped, ev)
+			}
+		}),
+	}
+	summary, err := RunAll(context.Background(), g, opts, OperationApply)
+	require.EqualError(t, err, "boom")
+
+	// b never started, so it did not fail: c still runs past the soft edge,
+	// but d, which needs b, does not.
+	require.Equal(t, []string{"apply:a", "apply:c"}, factory.records())
+	require.Equal(t, map[string]error{"a": errors.New("boom")}, summary.Failed)
+	require.Equal(t, []string{"c"}, summary.Completed)
+	require.Equal(t, 1, summary.Skipped)
+	require.Len(t, skipped, 1)
+	require.Equal(t, "b", skipped[0].Stack)
+	require.Equal(t, reasonLayerFailed, skipped[0].Reason)
+}
+
+func TestRunAllSkipsCompletedStacks(t *testing.T) {
+	root := t.TempDir()
+	factory := newFakeRunnerFactory(root)
+	withFakeRunner(t, factory)
+
+	stackA := filepath.Join(root, "a")
+	stackB := filepath.Join(root, "b")
+
+	g := graph.Graph{
+		stackA: {Path: stackA},
+		stackB: {Path: stackB, Dependencies: []string{stackA}},
+	}
+
+	opts := Options{
+		RootDir:         root,
+		Environment:     "dev",
+		AccountID:       "123",
+		Region:          "eu-west-2",
+		TerraformPath:   "/tmp/terraform",
+		CompletedStacks: map[string]struct{}{"a": {}},
+	}
+
+	summary, err := RunAll(context.Background(), g, opts, OperationApply)
+	require.NoError(t, err)
+	require.Equal(t, 1, summary.Executed)
+	require.Equal(t, 1, summary.Skipped)
+	require.ElementsMatch(t, []string{"a", "b"}, summary.Completed)
+	require.Equal(t, []string{"apply:b"}, factory.records())
+}
+
+func TestRunAllCheckpointsExecutedStacks(t *testing.T) {
+	root := t.TempDir()
+	factory := newFakeRunnerFactory(root)
+	factory.failures["c"] = errors.New("boom")
+	withFakeRunner(t, factory)
+
+	stackA := filepath.Join(root, "a")
+	stackB := filepath.Join(root, "b")
+	stackC := filepath.Join(root, "c")
+
+	g := graph.Graph{
+		stackA: {Path: stackA},
+		stackB: {Path: stackB, Dependencies: []string{stackA}},
+		stackC: {Path: stackC, Dependencies: []string{stackB}},
+	}
+
+	checkpoint := &fakeCheckpoint{}
+	opts := Options{
+		RootDir:         root,
+		Environment:     "dev",
+		AccountID:       "123",
+		Region:          "eu-west-2",
+		TerraformPath:   "/tmp/terraform",
+		CompletedStacks: map[string]struct{}{"a": {}},
+		Checkpoint:      checkpoint,
+	}
+
+	_, err := RunAll(context.Background(), g, opts, OperationApply)
+	require.Error(t, err)
+	require.Equal(t, []string{"b"}, checkpoint.done)
+}
+
+func TestRunAllDispatchesToRemoteBackend(t *testing.T) {
+	root := t.TempDir()
+	factory := newFakeRunnerFactory(root)
+	withFakeRunner(t, factory)
+
+	stackA := filepath.Join(root, "a")
+	stackB := filepath.Join(root, "b")
+
+	g := graph.Graph{
+		stackA: {Path: stackA},
+		stackB: {Path: stackB, Dependencies: []string{stackA}},
+	}
+
+	backend := &fakeBackend{}
+	opts := Options{
+		RootDir:       root,
+		Environment:   "dev",
+		AccountID:     "123",
+		Region:        "eu-west-2",
+		TerraformPath: "/tmp/terraform",
+		Backend:       backend,
+		Revision:      "abc",
+	}
+
+	summary, err := RunAll(context.Background(), g, opts, OperationApply)
+	require.NoError(t, err)
+	require.Equal(t, 2, summary.Executed)
+	require.Empty(t, factory.records())
+	require.Equal(t, []string{"apply:a@abc", "apply:b@abc"}, backend.jobs)
+
+	logData, err := os.ReadFile(remote.LogPath(root, "dev", "b"))
+	require.NoError(t, err)
+	require.Equal(t, "remote apply b\n", string(logData))
+}
+
+func TestInitAllRejectsBackendChangeOnRemoteBackend(t *testing.T) {
+	root := t.TempDir()
+	withFakeRunner(t, newFakeRunnerFactory(root))
+
+	stackA := filepath.Join(root, "a")
+	g := graph.Graph{stackA: {Path: stackA}}
+
+	backend := &fakeBackend{}
+	opts := Options{
+		RootDir:       root,
+		Environment:   "dev",
+		AccountID:     "123",
+		Region:        "eu-west-2",
+		TerraformPath: "/tmp/terraform",
+		Backend:       backend,
+		BackendChange: stacks.BackendMigrateState,
+	}
+
+	_, err := InitAll(context.Background(), g, opts)
+	require.ErrorContains(t, err, "--migrate-state is not supported with the fake backend")
+	require.Empty(t, backend.jobs)
+}
+
+func TestRunAllRejectsTFLogOnRemoteBackend(t *testing.T) {
+	root := t.TempDir()
+	withFakeRunner(t, newFakeRunnerFactory(root))
+
+	stackA := filepath.Join(root, "a")
+	g := graph.Graph{stackA: {Path: stackA}}
+
+	backend := &fakeBackend{}
+	opts := Options{
+		RootDir:       root,
+		Environment:   "dev",
+		AccountID:     "123",
+		Region:        "eu-west-2",
+		TerraformPath: "/tmp/terraform",
+		Backend:       backend,
+		TFLog:         stacks.TFLogTrace,
+	}
+
+	_, err := RunAll(context.Background(), g, opts, OperationApply)
+	require.ErrorContains(t, err, "terraform logs are not captured with the fake backend")
+	require.Empty(t, backend.jobs)
+}
+
+func TestRunAllRejectsPropagatedOutputsOnRemoteBackend(t *testing.T) {
+	root := t.TempDir()
+	withFakeRunner(t, newFakeRunnerFactory(root))
+
+	stackA := filepath.Join(root, "a")
+	stackB := filepath.Join(root, "b")
+	g := graph.Graph{
+		stackA: {Path: stackA},
+		stackB: {Path: stackB, Dependencies: []string{stackA}},
+	}
+
+	backend := &fakeBackend{}
+	opts := Options{
+		RootDir:       root,
+		Environment:   "dev",
+		AccountID:     "123",
+		Region:        "eu-west-2",
+		TerraformPath: "/tmp/terraform",
+		Backend:       backend,
+		Propagator:    fakePropagator{stackA: true},
+	}
+
+	_, err := RunAll(context.Background(), g, opts, OperationApply)
+	require.ErrorContains(t, err, "outputs of a are propagated to the stacks that consume them, which is not supported with the fake backend")
+	require.Empty(t, backend.jobs)
+
+	// Stacks nothing consumes still run remotely.
+	_, err = ApplyStack(context.Background(), g[stackB], opts)
+	require.NoError(t, err)
+	require.Equal(t, []string{"apply:b@"}, backend.jobs)
+}
+
+func TestPlanStackUsesCache(t *testing.T) {
+	root := t.TempDir()
+	factory := newFakeRunnerFactory(root)
+	withFakeRunner(t, factory)
+
+	stackDir := filepath.Join(root, "stack")
+	require.NoError(t, os.MkdirAll(stackDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(stackDir, "main.tf"), []byte("terraform {}"), 0o644))
+
+	stack := &graph.Stack{Path: stackDir}
+	opts := Options{
+		RootDir:       root,
+		Environment:   "dev",
+		AccountID:     "123",
+		Region:        "eu-west-2",
+		UseCache:      true,
+		TerraformPath: "/tmp/terraform",
+	}
+
+	summary, err := PlanStack(context.Background(), stack, opts)
+	require.NoError(t, err)
+	require.Equal(t, 1, summary.Executed)
+	require.Zero(t, summary.Cached)
+	require.Equal(t, []string{"stack"}, summary.Changed)
+	require.Contains(t, factory.records(), "plan:stack")
+
+	planPath, hashPath := cache.PlanFiles(root, opts.Environment, opts.Workspace, "stack")
+	require.FileExists(t, planPath)
+	require.FileExists(t, hashPath)
+
+	factory.reset()
+	summary, err = PlanStack(context.Background(), stack, opts)
+	require.NoError(t, err)
+	require.Equal(t, 1, summary.Cached)
+	require.Zero(t, summary.Executed)
+	require.Equal(t, []string{"stack"}, summary.Changed, "cached plans keep their change status")
+	require.Empty(t, factory.records())
+
+	require.NoError(t, cache.SaveChanges(hashPath, false))
+	summary, err = PlanStack(context.Background(), stack, opts)
+	require.NoError(t, err)
+	require.Empty(t, summary.Changed)
+}
+
+func TestPlanAllReportsEachStacksChangesAsItFinishes(t *testing.T) {
+	root := t.TempDir()
+	factory := newFakeRunnerFactory(root)
+	withFakeRunner(t, factory)
+
+	stackA := filepath.Join(root, "a")
+	stackB := filepath.Join(root, "b")
+	for _, dir := range []string{stackA, stackB} {
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+	}
+	g := graph.Graph{
+		stackA: {Path: stackA},
+		stackB: {Path: stackB, Dependencies: []string{stackA}},
+	}
+
+	var events []Event
+	opts := Options{
+		RootDir:       root,
+		Environment:   "dev",
+		AccountID:     "123",
+		Region:        "eu-west-2",
+		TerraformPath: "/tmp/terraform",
+		EventSink:     EventSinkFunc(func(event Event) { events = append(events, event) }),
+	}
+	_, err := PlanAll(context.Background(), g, opts)
+	require.NoError(t, err)
+
+	var planned []string
+	for i, event := range events {
+		if event, ok := event.(StackPlanned); ok {
+			planned = append(planned, event.Stack)
+			finished, ok := events[i+1].(StackFinished)
+			require.True(t, ok, "the plan is reported before the stack finishes")
+			require.Equal(t, event.Stack, finished.Stack)
+		}
+	}
+	require.Equal(t, []string{"a", "b"}, planned)
+}
+
+func TestCountPlan(t *testing.T) {
+	plan := &tfjson.Plan{ResourceChanges: []*tfjson.ResourceChange{
+		{Address: "a.new", Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionCreate}}},
+		{Address: "a.edit", Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionUpdate}}},
+		{Address: "a.replace", Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionDelete, tfjson.ActionCreate}}},
+		{Address: "a.same", Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionNoop}}},
+		{Address: "a.read", Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionRead}}},
+	}}
+	require.Equal(t, PlanCounts{Adds: 2, Changes: 1, Destroys: 1}, countPlan(plan))
+	require.Equal(t, PlanCounts{}, countPlan(nil))
+}
+
+func TestApplyFromPlanUsesCachedPlansAndRejectsStaleOnes(t *testing.T) {
+	root := t.TempDir()
+	factory := newFakeRunnerFactory(root)
+	withFakeRunner(t, factory)
+
+	stackA := filepath.Join(root, "a")
+	stackB := filepath.Join(root, "b")
+	for _, dir := range []string{stackA, stackB} {
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte("terraform {}"), 0o644))
+	}
+	g := graph.Graph{
+		stackA: {Path: stackA},
+		stackB: {Path: stackB, Dependencies: []string{stackA}},
+	}
+	opts := Options{
+		RootDir:       root,
+		Environment:   "dev",
+		AccountID:     "123",
+		Region:        "eu-west-2",
+		TerraformPath: "/tmp/terraform",
+	}
+
+	_, err := PlanAll(context.Background(), g, opts)
+	require.NoError(t, err)
+	factory.reset()
+
+	fromPlan := opts
+	fromPlan.FromPlan = true
+	summary, err := ApplyAll(context.Background(), g, fromPlan)
+	require.NoError(t, err)
+	require.Equal(t, 2, summary.Executed)
+	require.Equal(t, []string{"apply-plan:a", "apply-plan:b"}, factory.records())
+
+	_, err = ApplyStack(context.Background(), g[stackA], fromPlan)
+	require.ErrorContains(t, err, "no cached plan for a")
+
+	_, err = PlanStack(context.Background(), g[stackA], opts)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(stackA, "main.tf"), []byte("terraform { }"), 0o644))
+	_, err = ApplyStack(context.Background(), g[stackA], fromPlan)
+	require.ErrorContains(t, err, "cached plan for a is stale")
+}
+
+func TestRunAllApplyChecksPolicyBeforeApplying(t *testing.T) {
+	root := t.TempDir()
+	factory := newFakeRunnerFactory(root)
 	withFakeRunner(t, factory)
 
 	stackA := filepath.Join(root, "a")
@@ -67,56 +733,164 @@ func TestRunAllStopsOnError(t *testing.T) {
 		stackB: {Path: stackB, Dependencies: []string{stackA}},
 	}
 
+	gate := &fakePolicyGate{deny: map[string]bool{"b": true}}
 	opts := Options{
 		RootDir:       root,
 		Environment:   "dev",
 		AccountID:     "123",
 		Region:        "eu-west-2",
-		UseCache:      true,
 		TerraformPath: "/tmp/terraform",
+		Policy:        gate,
 	}
 
 	summary, err := RunAll(context.Background(), g, opts, OperationApply)
-	require.Error(t, err)
-	require.NotNil(t, summary.Failed)
+	require.ErrorContains(t, err, "policy denied b")
 	require.Contains(t, summary.Failed, "b")
+	require.Equal(t, []string{"plan:a", "show:a", "apply-plan:a", "plan:b", "show:b"}, factory.records())
+	require.Equal(t, []string{"a", "b"}, gate.checked)
 }
 
-func TestPlanStackUsesCache(t *testing.T) {
+func TestWarmCachePlansAllStacksWithoutLocking(t *testing.T) {
 	root := t.TempDir()
 	factory := newFakeRunnerFactory(root)
 	withFakeRunner(t, factory)
 
-	stackDir := filepath.Join(root, "stack")
-	require.NoError(t, os.MkdirAll(stackDir, 0o755))
-	require.NoError(t, os.WriteFile(filepath.Join(stackDir, "main.tf"), []byte("terraform {}"), 0o644))
+	var mu sync.Mutex
+	var lockingDisabled []bool
+	newRunner = func(ctx context.Context, opts stacks.RunnerOptions) (runner, error) {
+		mu.Lock()
+		lockingDisabled = append(lockingDisabled, opts.DisableLocking)
+		mu.Unlock()
+		return factory.new(ctx, opts)
+	}
 
-	stack := &graph.Stack{Path: stackDir}
+	stackA := filepath.Join(root, "a")
+	stackB := filepath.Join(root, "b")
+	require.NoError(t, os.MkdirAll(stackA, 0o755))
+	require.NoError(t, os.MkdirAll(stackB, 0o755))
+
+	g := graph.Graph{
+		stackA: {Path: stackA},
+		stackB: {Path: stackB, Dependencies: []string{stackA}},
+	}
 	opts := Options{
 		RootDir:       root,
 		Environment:   "dev",
 		AccountID:     "123",
 		Region:        "eu-west-2",
-		UseCache:      true,
 		TerraformPath: "/tmp/terraform",
 	}
 
-	summary, err := PlanStack(context.Background(), stack, opts)
+	summary, err := WarmCache(context.Background(), g, opts)
+	require.NoError(t, err)
+	require.Equal(t, 2, summary.Executed)
+	require.ElementsMatch(t, []string{"plan:a", "show:a", "plan:b", "show:b"}, factory.records())
+	require.Equal(t, []bool{true, true}, lockingDisabled)
+	require.Equal(t, []string{stackA}, g[stackB].Dependencies)
+
+	factory.reset()
+	summary, err = WarmCache(context.Background(), g, opts)
+	require.NoError(t, err)
+	require.Equal(t, 2, summary.Cached)
+	require.Empty(t, factory.records())
+}
+
+func TestParsePipeline(t *testing.T) {
+	steps, err := ParsePipeline("init, validate,plan,policy,apply")
+	require.NoError(t, err)
+	require.Equal(t, []Step{StepInit, StepValidate, StepPlan, StepPolicy, StepApply}, steps)
+
+	for _, spec := range []string{"", "init,lint", "plan,init", "plan,plan", "init,policy,apply"} {
+		_, err := ParsePipeline(spec)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestRunPipelineRunsStepsPerStackInDependencyOrder(t *testing.T) {
+	root := t.TempDir()
+	factory := newFakeRunnerFactory(root)
+	withFakeRunner(t, factory)
+
+	stackA := filepath.Join(root, "a")
+	stackB := filepath.Join(root, "b")
+	stackC := filepath.Join(root, "c")
+	for _, dir := range []string{stackA, stackB, stackC} {
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+	}
+
+	g := graph.Graph{
+		stackA: {Path: stackA},
+		stackB: {Path: stackB, Dependencies: []string{stackA}},
+		stackC: {Path: stackC, Dependencies: []string{stackB}},
+	}
+
+	gate := &fakePolicyGate{deny: map[string]bool{"b": true}}
+	opts := Options{
+		RootDir:       root,
+		Environment:   "dev",
+		AccountID:     "123456789012",
+		Region:        "eu-west-2",
+		TerraformPath: "/tmp/terraform",
+		Policy:        gate,
+	}
+
+	steps, err := ParsePipeline("init,validate,plan,policy,apply")
 	require.NoError(t, err)
+	summary, err := RunPipeline(context.Background(), g, opts, steps)
+	require.ErrorContains(t, err, "policy: policy denied b")
 	require.Equal(t, 1, summary.Executed)
-	require.Zero(t, summary.Cached)
-	require.Contains(t, factory.records(), "plan:stack")
+	require.Equal(t, []string{"a"}, summary.Completed)
+	require.Contains(t, summary.Failed, "b")
+	require.Equal(t, []string{"a"}, summary.Changed)
+	require.Equal(t, []string{
+		"init:a", "validate:a", "plan:a", "show:a", "show:a", "apply-plan:a",
+		"init:b", "validate:b", "plan:b", "show:b", "show:b",
+	}, factory.records())
+	require.Equal(t, []string{"a", "b"}, gate.checked)
+}
 
-	planPath, hashPath := cache.PlanFiles(root, opts.Environment, "stack")
-	require.FileExists(t, planPath)
-	require.FileExists(t, hashPath)
+func TestSharedPlanCacheIsReusedAcrossMachines(t *testing.T) {
+	base := t.TempDir()
+	factory := newFakeRunnerFactory(base)
+	withFakeRunner(t, factory)
+	shared := newFakeRemoteCache()
+
+	machine := func(name string) (graph.Graph, Options) {
+		root := filepath.Join(base, name)
+		stack := filepath.Join(root, "a")
+		require.NoError(t, os.MkdirAll(stack, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(stack, "main.tf"), []byte("terraform {}"), 0o644))
+		return graph.Graph{stack: {Path: stack}}, Options{
+			RootDir:       root,
+			Environment:   "dev",
+			AccountID:     "123",
+			Region:        "eu-west-2",
+			TerraformPath: "/tmp/terraform",
+			UseCache:      true,
+			RemoteCache:   shared,
+		}
+	}
+
+	g, opts := machine("ci-1")
+	_, err := PlanAll(context.Background(), g, opts)
+	require.NoError(t, err)
+	require.Equal(t, []string{"plan:ci-1/a", "show:ci-1/a"}, factory.records())
+	require.Len(t, shared.plans, 1)
 
 	factory.reset()
-	summary, err = PlanStack(context.Background(), stack, opts)
+	g, opts = machine("ci-2")
+	summary, err := PlanAll(context.Background(), g, opts)
 	require.NoError(t, err)
 	require.Equal(t, 1, summary.Cached)
-	require.Zero(t, summary.Executed)
+	require.Equal(t, []string{"a"}, summary.Changed)
 	require.Empty(t, factory.records())
+
+	g, opts = machine("ci-3")
+	opts.FromPlan = true
+	_, err = ApplyAll(context.Background(), g, opts)
+	require.NoError(t, err)
+	require.Equal(t, []string{"apply-plan:ci-3/a"}, factory.records())
+	require.Empty(t, shared.plans)
 }
 
 // --- test helpers ---
@@ -125,12 +899,15 @@ type fakeRunnerFactory struct {
 	mu        sync.Mutex
 	recording []string
 	failures  map[string]error
-	root      string
+	// hangs holds stacks whose apply blocks until its context ends.
+	hangs map[string]bool
+	root  string
 }
 
 func newFakeRunnerFactory(root string) *fakeRunnerFactory {
 	return &fakeRunnerFactory{
 		failures: make(map[string]error),
+		hangs:    make(map[string]bool),
 		root:     root,
 	}
 }
@@ -173,28 +950,271 @@ type fakeRunner struct {
 }
 
 func (r *fakeRunner) Apply(ctx context.Context, stack string) error {
+	rel, _ := filepath.Rel(r.factory.root, stack)
+	if r.factory.hangs[filepath.ToSlash(rel)] {
+		<-ctx.Done()
+		return r.factory.record("apply", stack, ctx.Err())
+	}
 	return r.factory.record("apply", stack, nil)
 }
 
+func (r *fakeRunner) ApplyPlan(ctx context.Context, stack string, planPath string) error {
+	if _, err := os.Stat(planPath); err != nil {
+		return err
+	}
+	return r.factory.record("apply-plan", stack, nil)
+}
+
 func (r *fakeRunner) Destroy(ctx context.Context, stack string) error {
 	return r.factory.record("destroy", stack, nil)
 }
 
+func (r *fakeRunner) Validate(ctx context.Context, stack string) error {
+	return r.factory.record("validate", stack, nil)
+}
+
 func (r *fakeRunner) InitOnly(ctx context.Context, stack string, upgrade bool) error {
 	return r.factory.record("init", stack, nil)
 }
 
-func (r *fakeRunner) PlanWithOutput(ctx context.Context, stack string, planPath string) error {
+func (r *fakeRunner) PlanWithOutput(ctx context.Context, stack string, planPath string) (bool, error) {
 	if err := r.factory.record("plan", stack, nil); err != nil {
-		return err
+		return false, err
+	}
+	return true, os.WriteFile(planPath, []byte("plan"), 0o644)
+}
+
+func (r *fakeRunner) PlanDestroy(ctx context.Context, stack string, planPath string) (bool, error) {
+	if err := r.factory.record("plan-destroy", stack, nil); err != nil {
+		return false, err
+	}
+	return true, os.WriteFile(planPath, []byte("plan"), 0o644)
+}
+
+func (r *fakeRunner) Outputs(ctx context.Context, stack string) (map[string]tfexec.OutputMeta, error) {
+	if err := r.factory.record("output", stack, nil); err != nil {
+		return nil, err
 	}
-	return os.WriteFile(planPath, []byte("plan"), 0o644)
+	return map[string]tfexec.OutputMeta{
+		"id": {Value: json.RawMessage(`"value"`)},
+	}, nil
+}
+
+func (r *fakeRunner) ShowPlan(ctx context.Context, stack string, planPath string) (*tfjson.Plan, error) {
+	if _, err := os.Stat(planPath); err != nil {
+		return nil, err
+	}
+	if err := r.factory.record("show", stack, nil); err != nil {
+		return nil, err
+	}
+	return &tfjson.Plan{}, nil
 }
 
 func (r *fakeRunner) VarFilesFor(stack string) []string {
 	return nil
 }
 
+type fakeBackend struct {
+	mu   sync.Mutex
+	jobs []string
+}
+
+func (b *fakeBackend) Name() string { return "fake" }
+
+func (b *fakeBackend) Run(ctx context.Context, job remote.Job, logs io.Writer) error {
+	b.mu.Lock()
+	b.jobs = append(b.jobs, fmt.Sprintf("%s:%s@%s", job.Command, job.Stack, job.Revision))
+	b.mu.Unlock()
+	_, err := fmt.Fprintf(logs, "remote %s %s\n", job.Command, job.Stack)
+	return err
+}
+
+// fakePropagator consumes the outputs of the stacks set to true.
+type fakePropagator map[string]bool
+
+func (p fakePropagator) Consumes(stackPath string) bool { return p[stackPath] }
+
+func (p fakePropagator) Propagate(ctx context.Context, stackPath string, outputs map[string]tfexec.OutputMeta) error {
+	return nil
+}
+
+type fakePolicyGate struct {
+	deny    map[string]bool
+	checked []string
+}
+
+func (g *fakePolicyGate) Check(ctx context.Context, stackRel string, plan *tfjson.Plan) error {
+	g.checked = append(g.checked, stackRel)
+	if g.deny[stackRel] {
+		return fmt.Errorf("policy denied %s", stackRel)
+	}
+	return nil
+}
+
+type fakeRemoteCache struct {
+	mu    sync.Mutex
+	plans map[string]bool
+}
+
+func newFakeRemoteCache() *fakeRemoteCache {
+	return &fakeRemoteCache{plans: make(map[string]bool)}
+}
+
+func (c *fakeRemoteCache) id(key cache.Key) string {
+	return fmt.Sprintf("%s/%s/%x", key.Environment, key.Stack, key.Hash)
+}
+
+func (c *fakeRemoteCache) Fetch(ctx context.Context, key cache.Key, planPath string) (bool, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	changed, ok := c.plans[c.id(key)]
+	if !ok {
+		return false, false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(planPath), 0o755); err != nil {
+		return false, false, err
+	}
+	return changed, true, os.WriteFile(planPath, []byte("plan"), 0o644)
+}
+
+func (c *fakeRemoteCache) Store(ctx context.Context, key cache.Key, planPath string, changed bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.plans[c.id(key)] = changed
+	return nil
+}
+
+func (c *fakeRemoteCache) Invalidate(ctx context.Context, key cache.Key) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.plans, c.id(key))
+	return nil
+}
+
+func TestAdaptiveLimiterBacksOffOnThrottlingAndRecovers(t *testing.T) {
+	l := newLimiter(4, true)
+	l.cooldown = 0
+
+	l.throttled("throttling")
+	require.Equal(t, 2, l.current())
+	l.throttled("network")
+	require.Equal(t, 2, l.current())
+	l.throttled("state lock")
+	require.Equal(t, 1, l.current())
+	l.throttled("throttling")
+	require.Equal(t, 1, l.current())
+
+	// A slot is added back after as many successes as the current limit.
+	l.succeeded()
+	require.Equal(t, 2, l.current())
+	l.succeeded()
+	require.Equal(t, 2, l.current())
+	l.succeeded()
+	require.Equal(t, 3, l.current())
+	for i := 0; i < 10; i++ {
+		l.succeeded()
+	}
+	require.Equal(t, 4, l.current())
+
+	// Throttling reported by the stacks already running cuts only once.
+	l.cooldown = time.Hour
+	l.lastCut = time.Time{}
+	l.throttled("throttling")
+	l.throttled("throttling")
+	require.Equal(t, 2, l.current())
+
+	static := newLimiter(4, false)
+	static.throttled("throttling")
+	require.Equal(t, 4, static.current())
+}
+
+func TestAdaptiveLimiterStartsNoMoreStacksThanTheLimit(t *testing.T) {
+	l := newLimiter(2, true)
+	l.cooldown = 0
+	ctx := context.Background()
+	require.NoError(t, l.acquire(ctx, false))
+	require.NoError(t, l.acquire(ctx, false))
+	l.throttled("throttling")
+
+	// Both stacks still run; the next starts once active is below the limit.
+	l.release()
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, l.acquire(waitCtx, false), context.DeadlineExceeded)
+
+	acquired := make(chan error)
+	go func() { acquired <- l.acquire(ctx, false) }()
+	l.release()
+	require.NoError(t, <-acquired)
+}
+
+func TestLimiterKeepsReservedSlotForPriorityStacks(t *testing.T) {
+	l := newLimiter(2, false)
+	l.setReserve(1)
+	ctx := context.Background()
+	require.NoError(t, l.acquire(ctx, false))
+
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, l.acquire(waitCtx, false), context.DeadlineExceeded)
+	require.NoError(t, l.acquire(ctx, true))
+
+	l.release()
+	l.release()
+	l.setReserve(0)
+	require.NoError(t, l.acquire(ctx, false))
+	require.NoError(t, l.acquire(ctx, false))
+}
+
+func TestRunAllStartsCriticalStackWithoutWaitingForLeaves(t *testing.T) {
+	root := t.TempDir()
+	factory := newFakeRunnerFactory(root)
+	withFakeRunner(t, factory)
+
+	path := func(name string) string { return filepath.Join(root, name) }
+	g := graph.Graph{
+		path("network"):  {Path: path("network")},
+		path("database"): {Path: path("database"), Dependencies: []string{path("network")}, Critical: true},
+	}
+	var leaves []string
+	for i := 1; i <= 8; i++ {
+		leaf := fmt.Sprintf("leaf-%d", i)
+		g[path(leaf)] = &graph.Stack{Path: path(leaf)}
+		leaves = append(leaves, "apply:"+leaf)
+	}
+
+	opts := Options{
+		RootDir:       root,
+		Environment:   "dev",
+		AccountID:     "123",
+		Region:        "eu-west-2",
+		TerraformPath: "/tmp/terraform",
+		Parallelism:   2,
+	}
+	summary, err := RunAll(context.Background(), g, opts, OperationApply)
+	require.NoError(t, err)
+	require.Equal(t, 10, summary.Executed)
+
+	// The leaves hold at most one slot until the database has started, so
+	// it starts as soon as the network is done rather than after the leaves.
+	records := factory.records()
+	index := indexOf(records)
+	require.Equal(t, "apply:network", records[0])
+	require.Less(t, index["apply:database"], index[leaves[2]], records)
+}
+
+type fakeCheckpoint struct {
+	mu   sync.Mutex
+	done []string
+}
+
+func (c *fakeCheckpoint) MarkDone(ctx context.Context, stackRel string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.done = append(c.done, stackRel)
+	return nil
+}
+
 func withFakeRunner(t *testing.T, factory *fakeRunnerFactory) {
 	origRunner := newRunner
 
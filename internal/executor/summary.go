@@ -1,16 +1,34 @@
 package executor
 
+import "terraform-wrapper/internal/procmon"
+
 type Summary struct {
-	Executed int
-	Cached   int
-	Skipped  int
-	Failed   map[string]error
+	Executed  int
+	Cached    int
+	Skipped   int
+	Failed    map[string]error
+	Completed []string
+	// Changed lists the planned stacks whose plan contains changes.
+	Changed []string
+	// DependencyFailed lists the stacks skipped under KeepGoing because a
+	// stack they depend on failed. They are counted in Skipped too.
+	DependencyFailed []string
+	// TimedOut lists the stacks killed by the stack timeout or the run's
+	// deadline. They are in Failed too.
+	TimedOut []string
+	// Usage holds the peak resource usage of each stack's Terraform
+	// processes, where it could be sampled.
+	Usage map[string]procmon.Usage
 }
 
 func (s *Summary) Merge(other Summary) {
 	s.Executed += other.Executed
 	s.Cached += other.Cached
 	s.Skipped += other.Skipped
+	s.Completed = append(s.Completed, other.Completed...)
+	s.Changed = append(s.Changed, other.Changed...)
+	s.DependencyFailed = append(s.DependencyFailed, other.DependencyFailed...)
+	s.TimedOut = append(s.TimedOut, other.TimedOut...)
 	if other.Failed != nil {
 		if s.Failed == nil {
 			s.Failed = make(map[string]error)
@@ -19,4 +37,17 @@ func (s *Summary) Merge(other Summary) {
 			s.Failed[k] = v
 		}
 	}
+	for k, v := range other.Usage {
+		s.recordUsage(k, v)
+	}
+}
+
+func (s *Summary) recordUsage(stack string, usage procmon.Usage) {
+	if usage == (procmon.Usage{}) {
+		return
+	}
+	if s.Usage == nil {
+		s.Usage = make(map[string]procmon.Usage)
+	}
+	s.Usage[stack] = usage
 }
@@ -0,0 +1,79 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TimeoutError is the failure of a stack whose terraform was killed because
+// it ran past the stack timeout or the run's deadline.
+type TimeoutError struct {
+	Limit time.Duration
+	// Run is set when the run's deadline expired rather than the stack's
+	// own timeout.
+	Run bool
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Run {
+		return fmt.Sprintf("run deadline of %s exceeded: %v", e.Limit, e.Err)
+	}
+	return fmt.Sprintf("timed out after %s: %v", e.Limit, e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error { return e.Err }
+
+// Is makes every TimeoutError match context.DeadlineExceeded, whatever
+// error terraform was killed with.
+func (e *TimeoutError) Is(target error) bool { return target == context.DeadlineExceeded }
+
+// reasonRunDeadline is why stacks not started before the run's deadline are
+// skipped.
+const reasonRunDeadline = "run deadline exceeded"
+
+// runContext bounds ctx by the run's Timeout, if any.
+func (o *Options) runContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, o.Timeout)
+}
+
+// stackContext bounds one stack's run by StackTimeout, if any.
+func (o *Options) stackContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.StackTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, o.StackTimeout)
+}
+
+// timeoutError wraps err in a TimeoutError when the deadline of stackCtx
+// ended the stack, telling the run's deadline, which runCtx also carries,
+// from the stack's own timeout.
+func (o *Options) timeoutError(runCtx, stackCtx context.Context, err error) error {
+	if err == nil || !errors.Is(stackCtx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		return &TimeoutError{Limit: o.Timeout, Run: true, Err: err}
+	}
+	return &TimeoutError{Limit: o.StackTimeout, Err: err}
+}
+
+// failureOutcome is the outcome of a stack that failed with err.
+func failureOutcome(err error) Outcome {
+	var timeout *TimeoutError
+	if errors.As(err, &timeout) {
+		return OutcomeTimedOut
+	}
+	return OutcomeFailed
+}
+
+// runDeadlineExceeded reports whether ctx ended because the run's deadline
+// passed.
+func runDeadlineExceeded(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
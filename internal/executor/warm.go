@@ -0,0 +1,26 @@
+package executor
+
+import (
+	"context"
+
+	"terraform-wrapper/internal/graph"
+)
+
+// WarmCache plans every stack to populate the plan and provider caches ahead
+// of gated jobs. Dependencies are ignored so all stacks plan concurrently, the
+// state lock is not taken, and stacks whose cached plan is still current are
+// skipped. A non-positive Parallelism plans every stack at once.
+func WarmCache(ctx context.Context, g graph.Graph, opts Options) (*Summary, error) {
+	flat := make(graph.Graph, len(g))
+	for path, stack := range g {
+		independent := *stack
+		independent.Dependencies = nil
+		flat[path] = &independent
+	}
+	if opts.Parallelism <= 0 {
+		opts.Parallelism = len(flat)
+	}
+	opts.UseCache = true
+	opts.DisableLocking = true
+	return RunAll(ctx, flat, opts, OperationPlan)
+}
@@ -0,0 +1,152 @@
+package exports
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"text/template"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/hashicorp/terraform-exec/tfexec"
+
+	"terraform-wrapper/internal/graph"
+	"terraform-wrapper/internal/output"
+)
+
+// SSMAPI captures the subset of SSM operations required to publish outputs.
+type SSMAPI interface {
+	PutParameter(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error)
+}
+
+// SecretsAPI captures the subset of Secrets Manager operations required to publish outputs.
+type SecretsAPI interface {
+	PutSecretValue(ctx context.Context, params *secretsmanager.PutSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.PutSecretValueOutput, error)
+	CreateSecret(ctx context.Context, params *secretsmanager.CreateSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.CreateSecretOutput, error)
+}
+
+// Publisher writes declared stack outputs to SSM parameters and Secrets Manager entries.
+type Publisher struct {
+	Environment string
+	SSM         SSMAPI
+	Secrets     SecretsAPI
+}
+
+type pathData struct {
+	Env       string
+	Stack     string
+	StackName string
+	Output    string
+}
+
+// Export publishes each declared output of a freshly applied stack.
+func (p *Publisher) Export(ctx context.Context, stackRel string, exports []graph.OutputExport, outputs map[string]tfexec.OutputMeta) error {
+	for _, exp := range exports {
+		meta, ok := outputs[exp.Output]
+		if !ok {
+			return fmt.Errorf("output %q declared for export is not defined by %s", exp.Output, stackRel)
+		}
+		value, err := outputValue(meta.Value)
+		if err != nil {
+			return fmt.Errorf("decode output %q: %w", exp.Output, err)
+		}
+
+		data := pathData{
+			Env:       p.Environment,
+			Stack:     filepath.ToSlash(stackRel),
+			StackName: filepath.Base(stackRel),
+			Output:    exp.Output,
+		}
+
+		if exp.SSMParameter != "" {
+			name, err := RenderPath(exp.SSMParameter, data)
+			if err != nil {
+				return err
+			}
+			if err := p.putParameter(ctx, name, value, meta.Sensitive); err != nil {
+				return fmt.Errorf("publish %s to SSM parameter %s: %w", exp.Output, name, err)
+			}
+			output.Printf("[export] %s.%s -> ssm:%s\n", stackRel, exp.Output, name)
+		}
+
+		if exp.Secret != "" {
+			name, err := RenderPath(exp.Secret, data)
+			if err != nil {
+				return err
+			}
+			if err := p.putSecret(ctx, name, value); err != nil {
+				return fmt.Errorf("publish %s to secret %s: %w", exp.Output, name, err)
+			}
+			output.Printf("[export] %s.%s -> secretsmanager:%s\n", stackRel, exp.Output, name)
+		}
+	}
+	return nil
+}
+
+func (p *Publisher) putParameter(ctx context.Context, name, value string, sensitive bool) error {
+	if p.SSM == nil {
+		return errors.New("ssm client not configured")
+	}
+	paramType := ssmtypes.ParameterTypeString
+	if sensitive {
+		paramType = ssmtypes.ParameterTypeSecureString
+	}
+	_, err := p.SSM.PutParameter(ctx, &ssm.PutParameterInput{
+		Name:      aws.String(name),
+		Value:     aws.String(value),
+		Type:      paramType,
+		Overwrite: aws.Bool(true),
+	})
+	return err
+}
+
+func (p *Publisher) putSecret(ctx context.Context, name, value string) error {
+	if p.Secrets == nil {
+		return errors.New("secrets manager client not configured")
+	}
+	_, err := p.Secrets.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(name),
+		SecretString: aws.String(value),
+	})
+	var notFound *smtypes.ResourceNotFoundException
+	if !errors.As(err, &notFound) {
+		return err
+	}
+	_, err = p.Secrets.CreateSecret(ctx, &secretsmanager.CreateSecretInput{
+		Name:         aws.String(name),
+		SecretString: aws.String(value),
+	})
+	return err
+}
+
+// RenderPath expands an export destination template.
+func RenderPath(tmpl string, data any) (string, error) {
+	t, err := template.New("path").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("parse export path %q: %w", tmpl, err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("render export path %q: %w", tmpl, err)
+	}
+	return buf.String(), nil
+}
+
+// outputValue returns string outputs verbatim and any other type as compact JSON.
+func outputValue(raw json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,98 @@
+package exports_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/hashicorp/terraform-exec/tfexec"
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/exports"
+	"terraform-wrapper/internal/graph"
+)
+
+type stubSSM struct {
+	inputs []*ssm.PutParameterInput
+}
+
+func (s *stubSSM) PutParameter(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error) {
+	s.inputs = append(s.inputs, params)
+	return &ssm.PutParameterOutput{}, nil
+}
+
+type stubSecrets struct {
+	existing map[string]string
+	created  []string
+}
+
+func (s *stubSecrets) PutSecretValue(ctx context.Context, params *secretsmanager.PutSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.PutSecretValueOutput, error) {
+	id := aws.ToString(params.SecretId)
+	if _, ok := s.existing[id]; !ok {
+		return nil, &smtypes.ResourceNotFoundException{Message: aws.String("not found")}
+	}
+	s.existing[id] = aws.ToString(params.SecretString)
+	return &secretsmanager.PutSecretValueOutput{}, nil
+}
+
+func (s *stubSecrets) CreateSecret(ctx context.Context, params *secretsmanager.CreateSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.CreateSecretOutput, error) {
+	name := aws.ToString(params.Name)
+	s.created = append(s.created, name)
+	s.existing[name] = aws.ToString(params.SecretString)
+	return &secretsmanager.CreateSecretOutput{}, nil
+}
+
+func TestExportPublishesOutputs(t *testing.T) {
+	t.Parallel()
+
+	ssmClient := &stubSSM{}
+	secrets := &stubSecrets{existing: map[string]string{}}
+	publisher := &exports.Publisher{Environment: "dev", SSM: ssmClient, Secrets: secrets}
+
+	outputs := map[string]tfexec.OutputMeta{
+		"vpc_id":      {Value: json.RawMessage(`"vpc-123"`)},
+		"subnet_ids":  {Value: json.RawMessage(`[ "a", "b" ]`)},
+		"db_password": {Value: json.RawMessage(`"hunter2"`), Sensitive: true},
+	}
+	decls := []graph.OutputExport{
+		{Output: "vpc_id", SSMParameter: "/{{.Env}}/{{.StackName}}/{{.Output}}"},
+		{Output: "subnet_ids", SSMParameter: "/{{.Env}}/{{.Stack}}/subnets"},
+		{Output: "db_password", SSMParameter: "/{{.Env}}/db/password", Secret: "{{.Env}}/db/password"},
+	}
+
+	require.NoError(t, publisher.Export(context.Background(), "core-services/network", decls, outputs))
+
+	require.Len(t, ssmClient.inputs, 3)
+	require.Equal(t, "/dev/network/vpc_id", aws.ToString(ssmClient.inputs[0].Name))
+	require.Equal(t, "vpc-123", aws.ToString(ssmClient.inputs[0].Value))
+	require.Equal(t, ssmtypes.ParameterTypeString, ssmClient.inputs[0].Type)
+	require.Equal(t, "/dev/core-services/network/subnets", aws.ToString(ssmClient.inputs[1].Name))
+	require.Equal(t, `["a","b"]`, aws.ToString(ssmClient.inputs[1].Value))
+	require.Equal(t, ssmtypes.ParameterTypeSecureString, ssmClient.inputs[2].Type)
+
+	require.Equal(t, []string{"dev/db/password"}, secrets.created)
+	require.Equal(t, "hunter2", secrets.existing["dev/db/password"])
+
+	require.NoError(t, publisher.Export(context.Background(), "core-services/network", decls[2:], outputs))
+	require.Len(t, secrets.created, 1)
+}
+
+func TestExportMissingOutput(t *testing.T) {
+	t.Parallel()
+
+	publisher := &exports.Publisher{Environment: "dev", SSM: &stubSSM{}}
+	err := publisher.Export(context.Background(), "network", []graph.OutputExport{{Output: "missing", SSMParameter: "/x"}}, nil)
+	require.ErrorContains(t, err, `output "missing"`)
+}
+
+func TestRenderPathRejectsUnknownField(t *testing.T) {
+	t.Parallel()
+
+	_, err := exports.RenderPath("/{{.Region}}/x", struct{ Env string }{Env: "dev"})
+	require.Error(t, err)
+}
@@ -0,0 +1,138 @@
+package exports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/hashicorp/terraform-exec/tfexec"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+
+	"terraform-wrapper/internal/graph"
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/stacks"
+)
+
+const propagatedHeader = "# Generated by terraform-wrapper from upstream stack outputs. Do not edit.\n\n"
+
+// Propagator writes the outputs of applied stacks into the generated tfvars
+// of the downstream stacks that declare them under propagate_outputs, so the
+// downstream stacks can be planned without reading upstream state.
+type Propagator struct {
+	RootDir     string
+	Environment string
+	Graph       graph.Graph
+
+	// mu serialises writes, since stacks applied in parallel may feed the
+	// same downstream stack.
+	mu sync.Mutex
+}
+
+// Consumes reports whether any stack consumes outputs of stackPath.
+func (p *Propagator) Consumes(stackPath string) bool {
+	return len(p.Graph.Consumers(stackPath)) > 0
+}
+
+// Propagate writes the consumed outputs of the freshly applied stackPath to
+// each consumer's generated tfvars, keeping the values other upstream stacks
+// wrote there. Sensitive outputs are refused, since the files are plain text.
+func (p *Propagator) Propagate(ctx context.Context, stackPath string, outputs map[string]tfexec.OutputMeta) error {
+	rootAbs, err := filepath.Abs(p.RootDir)
+	if err != nil {
+		return err
+	}
+	upstreamRel, err := filepath.Rel(rootAbs, stackPath)
+	if err != nil {
+		return err
+	}
+	upstreamRel = filepath.ToSlash(upstreamRel)
+
+	consumers := p.Graph.Consumers(stackPath)
+	paths := make([]string, 0, len(consumers))
+	for path := range consumers {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, path := range paths {
+		values := make(map[string]cty.Value, len(consumers[path]))
+		for _, name := range consumers[path] {
+			meta, ok := outputs[name]
+			if !ok {
+				return fmt.Errorf("output %q propagated from %s is not defined", name, upstreamRel)
+			}
+			if meta.Sensitive {
+				return fmt.Errorf("output %q of %s is sensitive and cannot be propagated; export it to Secrets Manager instead", name, upstreamRel)
+			}
+			value, err := ctyValue(meta.Value)
+			if err != nil {
+				return fmt.Errorf("decode output %q of %s: %w", name, upstreamRel, err)
+			}
+			values[name] = value
+		}
+
+		file := stacks.PropagatedVarFile(path, p.Environment)
+		if err := writePropagated(file, values); err != nil {
+			return err
+		}
+		fileRel, err := filepath.Rel(rootAbs, file)
+		if err != nil {
+			fileRel = file
+		}
+		for _, name := range consumers[path] {
+			output.Printf("[propagate] %s.%s -> %s\n", upstreamRel, name, filepath.ToSlash(fileRel))
+		}
+	}
+	return nil
+}
+
+// writePropagated sets values in the tfvars file at path, creating it if
+// needed.
+func writePropagated(path string, values map[string]cty.Value) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		data, err = []byte(propagatedHeader), nil
+	}
+	if err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+	file, diags := hclwrite.ParseConfig(data, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return fmt.Errorf("parse %s: %s", path, diags.Error())
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		file.Body().SetAttributeValue(name, values[name])
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create %s: %w", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, file.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
+
+// ctyValue converts a terraform output's JSON value.
+func ctyValue(raw []byte) (cty.Value, error) {
+	ty, err := ctyjson.ImpliedType(raw)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	return ctyjson.Unmarshal(raw, ty)
+}
@@ -0,0 +1,80 @@
+package exports_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform-exec/tfexec"
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/exports"
+	"terraform-wrapper/internal/graph"
+	"terraform-wrapper/internal/stacks"
+)
+
+func TestPropagateWritesConsumedOutputsToDownstreamTFVars(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	network := filepath.Join(root, "core-services", "network")
+	dns := filepath.Join(root, "core-services", "dns")
+	app := filepath.Join(root, "applications", "frontend")
+	g := graph.Graph{
+		network: {Path: network},
+		dns:     {Path: dns},
+		app: {
+			Path:         app,
+			Dependencies: []string{network, dns},
+			Edges: map[string]graph.Edge{
+				network: {Path: network, PropagateOutputs: []string{"vpc_id", "private_subnet_ids"}},
+				dns:     {Path: dns, PropagateOutputs: []string{"zone_id"}},
+			},
+		},
+	}
+	p := &exports.Propagator{RootDir: root, Environment: "dev", Graph: g}
+	require.True(t, p.Consumes(network))
+	require.False(t, p.Consumes(app))
+
+	require.NoError(t, p.Propagate(context.Background(), network, map[string]tfexec.OutputMeta{
+		"vpc_id":             {Value: json.RawMessage(`"vpc-123"`)},
+		"private_subnet_ids": {Value: json.RawMessage(`["subnet-a","subnet-b"]`)},
+		"nat_ip":             {Value: json.RawMessage(`"10.0.0.1"`)},
+	}))
+	require.NoError(t, p.Propagate(context.Background(), dns, map[string]tfexec.OutputMeta{
+		"zone_id": {Value: json.RawMessage(`"Z123"`)},
+	}))
+
+	data, err := os.ReadFile(stacks.PropagatedVarFile(app, "dev"))
+	require.NoError(t, err)
+	require.Equal(t, `# Generated by terraform-wrapper from upstream stack outputs. Do not edit.
+
+private_subnet_ids = ["subnet-a", "subnet-b"]
+vpc_id             = "vpc-123"
+zone_id            = "Z123"
+`, string(data))
+	require.Contains(t, stacks.VarFiles(root, app, "dev", ""), stacks.PropagatedVarFile(app, "dev"))
+}
+
+func TestPropagateRefusesSensitiveAndMissingOutputs(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	db := filepath.Join(root, "db")
+	app := filepath.Join(root, "app")
+	g := graph.Graph{
+		db:  {Path: db},
+		app: {Path: app, Dependencies: []string{db}, Edges: map[string]graph.Edge{db: {Path: db, PropagateOutputs: []string{"password"}}}},
+	}
+	p := &exports.Propagator{RootDir: root, Environment: "dev", Graph: g}
+
+	err := p.Propagate(context.Background(), db, map[string]tfexec.OutputMeta{
+		"password": {Value: json.RawMessage(`"hunter2"`), Sensitive: true},
+	})
+	require.ErrorContains(t, err, "sensitive")
+	err = p.Propagate(context.Background(), db, map[string]tfexec.OutputMeta{})
+	require.ErrorContains(t, err, `output "password" propagated from db is not defined`)
+	require.NoFileExists(t, stacks.PropagatedVarFile(app, "dev"))
+}
@@ -0,0 +1,58 @@
+// Package featureflags reads the per-environment flags file that gates
+// stacks and is passed to every stack as a map variable, so new
+// infrastructure can be rolled out one environment at a time.
+package featureflags
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Variable is the map(bool) variable stacks declare to read the flags.
+const Variable = "feature_flags"
+
+// Flags maps flag names to whether they are on.
+type Flags map[string]bool
+
+// Path returns the flags file of env under root.
+func Path(root, env string) string {
+	return filepath.Join(root, "flags", env+".yaml")
+}
+
+// Load reads the flags of env. An environment without a flags file has no
+// flags, so every flag is off.
+func Load(root, env string) (Flags, error) {
+	path := Path(root, env)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	flags := Flags{}
+	if err := yaml.Unmarshal(data, &flags); err != nil {
+		return nil, fmt.Errorf("invalid feature flags in %s: %w", path, err)
+	}
+	return flags, nil
+}
+
+// Enabled reports whether flag is on.
+func (f Flags) Enabled(flag string) bool {
+	return f[flag]
+}
+
+// Value renders the flags as the value of Variable. JSON is also valid HCL,
+// so it can be passed as TF_VAR_feature_flags or written to a tfvars file.
+func (f Flags) Value() string {
+	if f == nil {
+		return "{}"
+	}
+	encoded, _ := json.Marshal(map[string]bool(f))
+	return string(encoded)
+}
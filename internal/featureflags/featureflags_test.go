@@ -0,0 +1,34 @@
+package featureflags_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/featureflags"
+)
+
+func TestLoadFlags(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	flags, err := featureflags.Load(root, "dev")
+	require.NoError(t, err)
+	require.Nil(t, flags)
+	require.False(t, flags.Enabled("new_vpc"))
+	require.Equal(t, "{}", flags.Value())
+
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "flags"), 0o755))
+	require.NoError(t, os.WriteFile(featureflags.Path(root, "dev"), []byte("new_vpc: true\nredis: false\n"), 0o644))
+	flags, err = featureflags.Load(root, "dev")
+	require.NoError(t, err)
+	require.True(t, flags.Enabled("new_vpc"))
+	require.False(t, flags.Enabled("redis"))
+	require.Equal(t, `{"new_vpc":true,"redis":false}`, flags.Value())
+
+	require.NoError(t, os.WriteFile(featureflags.Path(root, "prod"), []byte("new_vpc: maybe\n"), 0o644))
+	_, err = featureflags.Load(root, "prod")
+	require.ErrorContains(t, err, "invalid feature flags")
+}
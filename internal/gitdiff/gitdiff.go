@@ -0,0 +1,170 @@
+// Package gitdiff maps the files changed on a branch to the stacks whose
+// plans they can change, so a pull request only plans the stacks it touches.
+package gitdiff
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"terraform-wrapper/internal/cache"
+	"terraform-wrapper/internal/featureflags"
+	"terraform-wrapper/internal/graph"
+	"terraform-wrapper/internal/stacks"
+	"terraform-wrapper/internal/wrapperconfig"
+)
+
+// ChangedFiles returns the files under root changed between the commit where
+// the current branch left base and the working tree, as slash-separated paths
+// relative to root. Renames are listed under both names, so a stack a file
+// moved out of is affected too.
+func ChangedFiles(ctx context.Context, root, base string) ([]string, error) {
+	mergeBase, err := git(ctx, root, "merge-base", base, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	out, err := git(ctx, root, "diff", "--name-only", "--no-renames", "--relative", strings.TrimSpace(mergeBase))
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, line)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// Affected maps each stack of g whose plan in env and profile files can
+// change to the first of files that changes it. files are relative to root,
+// which g was built from. A file changes:
+//   - the innermost stack it is in, unless it is in the stack's tfvars
+//     directory for another environment;
+//   - every stack calling the local module it is in, directly or through
+//     other local modules;
+//   - every stack when it is globals.tfvars, the environment's tfvars or
+//     terraform-wrapper.hcl;
+//   - every stack behind a feature flag when it is the environment's flags
+//     file.
+//
+// Other files, such as documentation, change no stack.
+func Affected(root string, g graph.Graph, files []string, env, profile string) (map[string]string, error) {
+	rootAbs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	shared := map[string]bool{
+		"globals.tfvars":       true,
+		wrapperconfig.FileName: true,
+	}
+	for _, name := range stacks.VarFileNames(env, profile) {
+		shared["environment/"+name] = true
+	}
+	flagsFile := filepath.ToSlash(mustRel(rootAbs, featureflags.Path(rootAbs, env)))
+
+	modules := make(map[string][]string)
+	for path := range g {
+		dirs, err := cache.LocalModuleDirs(path)
+		if err != nil {
+			return nil, fmt.Errorf("read modules of %s: %w", mustRel(rootAbs, path), err)
+		}
+		for _, dir := range dirs {
+			modules[dir] = append(modules[dir], path)
+		}
+	}
+
+	affected := make(map[string]string)
+	mark := func(stack, file string) {
+		if _, ok := affected[stack]; !ok {
+			affected[stack] = file
+		}
+	}
+	for _, file := range files {
+		switch {
+		case shared[file]:
+			for path := range g {
+				mark(path, file)
+			}
+			continue
+		case file == flagsFile:
+			for path, stack := range g {
+				if stack.FeatureFlag != "" {
+					mark(path, file)
+				}
+			}
+			continue
+		}
+
+		abs := filepath.Join(rootAbs, filepath.FromSlash(file))
+		if stack := innermost(g, abs); stack != "" && !otherVarFile(abs, env, profile) {
+			mark(stack, file)
+		}
+		for dir, callers := range modules {
+			if within(abs, dir) {
+				for _, caller := range callers {
+					mark(caller, file)
+				}
+			}
+		}
+	}
+	return affected, nil
+}
+
+// innermost returns the deepest stack of g containing path, or "".
+func innermost(g graph.Graph, path string) string {
+	var best string
+	for stack := range g {
+		if within(path, stack) && len(stack) > len(best) {
+			best = stack
+		}
+	}
+	return best
+}
+
+// otherVarFile reports whether path is a file of a stack's tfvars directory
+// that env and profile do not read. Files terraform loads itself, such as
+// terraform.tfvars, are read in every environment.
+func otherVarFile(path, env, profile string) bool {
+	if filepath.Ext(path) != ".tfvars" || filepath.Base(filepath.Dir(path)) != "tfvars" {
+		return false
+	}
+	name := filepath.Base(path)
+	for _, own := range stacks.VarFileNames(env, profile) {
+		if name == own {
+			return false
+		}
+	}
+	// Propagated outputs are generated per environment too.
+	return name != filepath.Base(stacks.PropagatedVarFile("", env))
+}
+
+func within(path, dir string) bool {
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+func mustRel(base, target string) string {
+	rel, err := filepath.Rel(base, target)
+	if err != nil {
+		return target
+	}
+	return rel
+}
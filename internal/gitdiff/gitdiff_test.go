@@ -0,0 +1,105 @@
+package gitdiff_test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/gitdiff"
+	"terraform-wrapper/internal/graph"
+)
+
+func write(t *testing.T, root, rel, content string) {
+	t.Helper()
+	path := filepath.Join(root, filepath.FromSlash(rel))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func git(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+}
+
+func TestChangedFilesSinceTheBranchLeftBase(t *testing.T) {
+	repo := t.TempDir()
+	root := filepath.Join(repo, "infra")
+	write(t, root, "network/main.tf", "# network\n")
+	write(t, root, "dns/main.tf", "# dns\n")
+	write(t, repo, "README.md", "readme\n")
+	git(t, repo, "init", "-q", "-b", "main")
+	git(t, repo, "add", "-A")
+	git(t, repo, "commit", "-q", "-m", "base")
+	git(t, repo, "checkout", "-q", "-b", "feature")
+	write(t, root, "network/main.tf", "# network v2\n")
+	git(t, repo, "commit", "-q", "-am", "change network")
+	git(t, repo, "checkout", "-q", "main")
+	write(t, root, "dns/main.tf", "# dns v2\n")
+	git(t, repo, "commit", "-q", "-am", "change dns on main")
+	git(t, repo, "checkout", "-q", "feature")
+	// Uncommitted changes count as well.
+	write(t, repo, "README.md", "readme v2\n")
+	git(t, repo, "mv", "infra/network/main.tf", "infra/network/network.tf")
+
+	files, err := gitdiff.ChangedFiles(context.Background(), root, "main")
+	require.NoError(t, err)
+	require.Equal(t, []string{"network/main.tf", "network/network.tf"}, files)
+}
+
+func TestAffectedMapsFilesToStacks(t *testing.T) {
+	root := t.TempDir()
+	write(t, root, "core/network/main.tf", `module "vpc" {
+  source = "../../modules/vpc"
+}
+`)
+	write(t, root, "modules/vpc/main.tf", `module "subnets" {
+  source = "../subnets"
+}
+`)
+	write(t, root, "modules/subnets/main.tf", "")
+	write(t, root, "apps/web/main.tf", "")
+	write(t, root, "apps/web/jobs/main.tf", "")
+
+	network := filepath.Join(root, "core", "network")
+	web := filepath.Join(root, "apps", "web")
+	jobs := filepath.Join(root, "apps", "web", "jobs")
+	g := graph.Graph{
+		network: {Path: network},
+		web:     {Path: web, Dependencies: []string{network}},
+		jobs:    {Path: jobs, FeatureFlag: "jobs"},
+	}
+
+	affected, err := gitdiff.Affected(root, g, []string{
+		"README.md",
+		"apps/web/jobs/main.tf",
+		"apps/web/tfvars/prod.tfvars",
+		"modules/subnets/variables.tf",
+	}, "dev", "")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		jobs:    "apps/web/jobs/main.tf",
+		network: "modules/subnets/variables.tf",
+	}, affected)
+
+	affected, err = gitdiff.Affected(root, g, []string{"apps/web/tfvars/dev.tfvars", "flags/dev.yaml"}, "dev", "")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		web:  "apps/web/tfvars/dev.tfvars",
+		jobs: "flags/dev.yaml",
+	}, affected)
+
+	affected, err = gitdiff.Affected(root, g, []string{"environment/dev.blue.tfvars"}, "dev", "blue")
+	require.NoError(t, err)
+	require.Len(t, affected, 3)
+
+	affected, err = gitdiff.Affected(root, g, []string{"environment/prod.tfvars"}, "dev", "")
+	require.NoError(t, err)
+	require.Empty(t, affected)
+}
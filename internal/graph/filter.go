@@ -0,0 +1,110 @@
+package graph
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// tagPrefix marks a filter pattern that selects stacks by tag rather than by
+// path.
+const tagPrefix = "tag:"
+
+// Filter returns the paths of the stacks matching any of only, or every stack
+// when only is empty, minus the stacks matching any of exclude. Patterns are
+// globs matched against a stack's path relative to root or one of its parent
+// directories, or tag:<name> to match stacks tagged name in dependencies.json.
+func Filter(g Graph, root string, only, exclude []string) ([]string, error) {
+	rootAbs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	var selected []string
+	for p, stack := range g {
+		rel, err := filepath.Rel(rootAbs, p)
+		if err != nil {
+			return nil, err
+		}
+		rel = filepath.ToSlash(rel)
+		included := len(only) == 0
+		if !included {
+			if included, err = matchesAny(stack, rel, only); err != nil {
+				return nil, err
+			}
+		}
+		if !included {
+			continue
+		}
+		excluded, err := matchesAny(stack, rel, exclude)
+		if err != nil {
+			return nil, err
+		}
+		if !excluded {
+			selected = append(selected, p)
+		}
+	}
+	sort.Strings(selected)
+	return selected, nil
+}
+
+func matchesAny(stack *Stack, rel string, patterns []string) (bool, error) {
+	for _, pattern := range patterns {
+		if tag, ok := strings.CutPrefix(pattern, tagPrefix); ok {
+			if slices.Contains(stack.Tags, tag) {
+				return true, nil
+			}
+			continue
+		}
+		pattern = strings.TrimSuffix(filepath.ToSlash(pattern), "/")
+		for dir := rel; dir != "." && dir != "/"; dir = path.Dir(dir) {
+			ok, err := path.Match(pattern, dir)
+			if err != nil {
+				return false, fmt.Errorf("invalid stack filter %q: %w", pattern, err)
+			}
+			if ok {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// Select returns a graph restricted to paths. Unlike Subgraph, a selected
+// stack keeps depending on the selected stacks it reached through stacks that
+// were left out, so the subset runs in the same relative order as the whole
+// graph.
+func (g Graph) Select(paths []string) Graph {
+	keep := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		if _, ok := g[p]; ok {
+			keep[p] = true
+		}
+	}
+	sub := make(Graph, len(keep))
+	for p := range keep {
+		stack := *g[p]
+		stack.Dependencies = nil
+		seen := make(map[string]bool)
+		var visit func(string)
+		visit = func(from string) {
+			for _, dep := range g[from].Dependencies {
+				if seen[dep] {
+					continue
+				}
+				seen[dep] = true
+				if keep[dep] {
+					stack.Dependencies = append(stack.Dependencies, dep)
+				} else if _, ok := g[dep]; ok {
+					visit(dep)
+				}
+			}
+		}
+		visit(p)
+		sort.Strings(stack.Dependencies)
+		sub[p] = &stack
+	}
+	return sub
+}
@@ -0,0 +1,56 @@
+package graph
+
+import "sort"
+
+// Gated records why Gate removed a stack: Flag is off, on the stack itself or,
+// when Via is set, on the upstream stack Via it depends on.
+type Gated struct {
+	Flag string
+	Via  string
+}
+
+// Gate removes the stacks whose feature flag is off according to enabled,
+// together with every stack that depends on one of them through a regular
+// edge, since those cannot run without it. It returns the remaining graph and
+// the removed stacks keyed by path.
+func (g Graph) Gate(enabled func(flag string) bool) (Graph, map[string]Gated) {
+	dependents := make(map[string][]string)
+	for path, stack := range g {
+		for _, dep := range stack.Dependencies {
+			if !stack.IsSoft(dep) {
+				dependents[dep] = append(dependents[dep], path)
+			}
+		}
+	}
+
+	var off []string
+	for path, stack := range g {
+		if stack.FeatureFlag != "" && !enabled(stack.FeatureFlag) {
+			off = append(off, path)
+		}
+	}
+	if len(off) == 0 {
+		return g, nil
+	}
+	sort.Strings(off)
+
+	removed := make(map[string]Gated)
+	for _, path := range off {
+		removed[path] = Gated{Flag: g[path].FeatureFlag}
+	}
+	for _, path := range off {
+		for _, dependent := range g.walk(path, func(node string) []string { return dependents[node] }) {
+			if _, ok := removed[dependent]; !ok {
+				removed[dependent] = Gated{Flag: g[path].FeatureFlag, Via: path}
+			}
+		}
+	}
+
+	var kept []string
+	for path := range g {
+		if _, ok := removed[path]; !ok {
+			kept = append(kept, path)
+		}
+	}
+	return g.Subgraph(kept), removed
+}
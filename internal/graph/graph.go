@@ -6,21 +6,101 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 )
 
 type Stack struct {
 	Path         string
 	Dependencies []string
 	SkipDestroy  bool
+	Exports      []OutputExport
+	// Inferred lists dependencies discovered from terraform_remote_state data
+	// sources that dependencies.json does not declare. They are also present
+	// in Dependencies.
+	Inferred []string
+	// Edges holds the annotations of dependencies declared under
+	// dependencies.edges, keyed by dependency path.
+	Edges map[string]Edge
+	// Regions lists the regions of the stack's aws provider blocks.
+	Regions []ProviderRegion
+	// RemoteStateRefs lists the stacks whose state the stack reads through
+	// terraform_remote_state, whether or not dependencies.json declares them.
+	RemoteStateRefs []string
+	// RemoteStates maps the name of each terraform_remote_state data source
+	// that resolves to another stack to that stack's path.
+	RemoteStates map[string]string
+	// Tags are the labels listed under tags in dependencies.json, used to
+	// select stacks with tag:<name> filters.
+	Tags []string
+	// Critical marks a stack on the critical path, which the executor starts
+	// ahead of the other stacks ready to run.
+	Critical bool
+	// FeatureFlag, when set, names the flag in flags/<env>.yaml that must be
+	// on for the stack to run.
+	FeatureFlag string
+
+	// opaqueRemoteState is set when a remote state key cannot be resolved to
+	// a stack, so the stack's remote state references are incomplete.
+	opaqueRemoteState bool
+}
+
+// Edge annotates a dependency. Soft edges only order the two stacks: a failed
+// upstream does not block the dependent. RequiredOutputs documents the
+// upstream outputs the dependent consumes. PropagateOutputs names upstream
+// outputs written, after the upstream is applied, to the dependent's
+// generated tfvars as variables of the same name.
+type Edge struct {
+	Path             string   `json:"path"`
+	Soft             bool     `json:"soft,omitempty"`
+	RequiredOutputs  []string `json:"required_outputs,omitempty"`
+	PropagateOutputs []string `json:"propagate_outputs,omitempty"`
+}
+
+// Consumers returns the stacks that have upstream's outputs propagated to
+// them, with the outputs each consumes.
+func (g Graph) Consumers(upstream string) map[string][]string {
+	consumers := make(map[string][]string)
+	for path, stack := range g {
+		if outputs := stack.Edges[upstream].PropagateOutputs; len(outputs) > 0 {
+			consumers[path] = outputs
+		}
+	}
+	return consumers
+}
+
+// IsSoft reports whether the dependency on dep is ordering-only.
+func (s *Stack) IsSoft(dep string) bool {
+	return s.Edges[dep].Soft
+}
+
+// OutputExport publishes a stack output to SSM Parameter Store and/or Secrets
+// Manager after a successful apply. Destinations are Go templates that may
+// reference {{.Env}}, {{.Stack}}, {{.StackName}} and {{.Output}}.
+type OutputExport struct {
+	Output       string `json:"output"`
+	SSMParameter string `json:"ssm_parameter,omitempty"`
+	Secret       string `json:"secret,omitempty"`
 }
 
 type Graph map[string]*Stack
 
+// ArchiveDir is the directory under the root that archived stacks are moved
+// to. Build does not look for stacks inside it.
+const ArchiveDir = "archive"
+
 type fileDependencies struct {
 	Dependencies struct {
 		Paths []string `json:"paths"`
+		Edges []Edge   `json:"edges"`
 	} `json:"dependencies"`
-	SkipWhenDestroying bool `json:"skip_when_destroying"`
+	SkipWhenDestroying bool           `json:"skip_when_destroying"`
+	OutputExports      []OutputExport `json:"output_exports"`
+	Tags               []string       `json:"tags"`
+	Critical           bool           `json:"critical"`
+	FeatureFlag        string         `json:"feature_flag"`
 }
 
 func Build(root string) (Graph, error) {
@@ -30,11 +110,15 @@ func Build(root string) (Graph, error) {
 	}
 
 	result := make(Graph)
+	archiveAbs := filepath.Join(rootAbs, ArchiveDir)
 
 	err = filepath.WalkDir(rootAbs, func(path string, d fs.DirEntry, walkErr error) error {
 		if walkErr != nil {
 			return walkErr
 		}
+		if d.IsDir() && path == archiveAbs {
+			return filepath.SkipDir
+		}
 
 		if d.IsDir() || filepath.Base(path) != "dependencies.json" {
 			return nil
@@ -58,24 +142,63 @@ func Build(root string) (Graph, error) {
 
 		stack := ensureStack(result, stackDirAbs)
 		stack.SkipDestroy = deps.SkipWhenDestroying
+		for _, exp := range deps.OutputExports {
+			if exp.Output == "" || (exp.SSMParameter == "" && exp.Secret == "") {
+				return fmt.Errorf("invalid output_exports entry in %s: output and at least one of ssm_parameter or secret are required", path)
+			}
+		}
+		stack.Exports = deps.OutputExports
+		stack.Tags = deps.Tags
+		stack.Critical = deps.Critical
+		stack.FeatureFlag = deps.FeatureFlag
 
-		for _, dep := range deps.Dependencies.Paths {
-			depPath := dep
-			if !filepath.IsAbs(depPath) {
-				depPath = filepath.Join(rootAbs, depPath)
+		resolve := func(dep string) (string, error) {
+			if !filepath.IsAbs(dep) {
+				dep = filepath.Join(rootAbs, dep)
 			}
-			depAbs, err := filepath.Abs(depPath)
+			return filepath.Abs(dep)
+		}
+		for _, dep := range deps.Dependencies.Paths {
+			depAbs, err := resolve(dep)
 			if err != nil {
 				return err
 			}
 			stack.Dependencies = append(stack.Dependencies, depAbs)
 			ensureStack(result, depAbs)
 		}
+		for _, edge := range deps.Dependencies.Edges {
+			if edge.Path == "" {
+				return fmt.Errorf("invalid dependencies.edges entry in %s: path is required", path)
+			}
+			for _, output := range edge.PropagateOutputs {
+				if !hclsyntax.ValidIdentifier(output) {
+					return fmt.Errorf("invalid dependencies.edges entry in %s: propagated output %q is not a valid variable name", path, output)
+				}
+			}
+			depAbs, err := resolve(edge.Path)
+			if err != nil {
+				return err
+			}
+			if !slices.Contains(stack.Dependencies, depAbs) {
+				stack.Dependencies = append(stack.Dependencies, depAbs)
+				ensureStack(result, depAbs)
+			}
+			if stack.Edges == nil {
+				stack.Edges = make(map[string]Edge)
+			}
+			edge.Path = depAbs
+			stack.Edges[depAbs] = edge
+		}
 
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	return result, err
+	inferDependencies(result)
+	discoverRegions(result)
+	return result, nil
 }
 
 func ensureStack(g Graph, path string) *Stack {
@@ -125,3 +248,96 @@ func TopoSort(g Graph) ([]string, error) {
 
 	return order, nil
 }
+
+// Upstream returns every stack path reachable through dependencies of path,
+// excluding path itself.
+func (g Graph) Upstream(path string) []string {
+	return g.walk(path, func(node string) []string {
+		if stack, ok := g[node]; ok {
+			return stack.Dependencies
+		}
+		return nil
+	})
+}
+
+// Downstream returns every stack path that depends on path directly or
+// transitively, excluding path itself.
+func (g Graph) Downstream(path string) []string {
+	dependents := make(map[string][]string)
+	for node, stack := range g {
+		for _, dep := range stack.Dependencies {
+			dependents[dep] = append(dependents[dep], node)
+		}
+	}
+	return g.walk(path, func(node string) []string {
+		return dependents[node]
+	})
+}
+
+func (g Graph) walk(start string, next func(string) []string) []string {
+	seen := map[string]bool{start: true}
+	queue := []string{start}
+	var found []string
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, n := range next(node) {
+			if seen[n] {
+				continue
+			}
+			seen[n] = true
+			found = append(found, n)
+			queue = append(queue, n)
+		}
+	}
+	sort.Strings(found)
+	return found
+}
+
+// Subgraph returns a graph restricted to paths. Dependencies on stacks outside
+// the subset are dropped so the result can be sorted and executed on its own.
+func (g Graph) Subgraph(paths []string) Graph {
+	keep := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		if _, ok := g[p]; ok {
+			keep[p] = true
+		}
+	}
+	sub := make(Graph, len(keep))
+	for p := range keep {
+		stack := *g[p]
+		stack.Dependencies = nil
+		for _, dep := range g[p].Dependencies {
+			if keep[dep] {
+				stack.Dependencies = append(stack.Dependencies, dep)
+			}
+		}
+		sub[p] = &stack
+	}
+	return sub
+}
+
+// DestroyGraph returns the graph in teardown order: every stack depends on
+// the stacks that depend on it, so dependents are destroyed first. Edge
+// annotations are dropped; every teardown edge is a regular one.
+func (g Graph) DestroyGraph() Graph {
+	destroy := make(Graph, len(g))
+	for path, stack := range g {
+		reversed := *stack
+		reversed.Dependencies = nil
+		reversed.Inferred = nil
+		reversed.Edges = nil
+		destroy[path] = &reversed
+	}
+	for path, stack := range g {
+		for _, dep := range stack.Dependencies {
+			if reversed, ok := destroy[dep]; ok && !slices.Contains(reversed.Dependencies, path) {
+				reversed.Dependencies = append(reversed.Dependencies, path)
+			}
+		}
+	}
+	for _, stack := range destroy {
+		sort.Strings(stack.Dependencies)
+	}
+	return destroy
+}
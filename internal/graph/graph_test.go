@@ -1,7 +1,9 @@
 package graph_test
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
@@ -153,3 +155,368 @@ func indexList(items []string) map[string]int {
 	}
 	return result
 }
+
+func TestBuildGraphParsesOutputExports(t *testing.T) {
+	root := t.TempDir()
+	network := filepath.Join(root, "core-services", "network")
+	require.NoError(t, os.MkdirAll(network, 0o755))
+
+	data := []byte(`{
+  "dependencies": {"paths": []},
+  "output_exports": [
+    {"output": "vpc_id", "ssm_parameter": "/{{.Env}}/{{.StackName}}/vpc_id"},
+    {"output": "db_password", "secret": "{{.Env}}/db"}
+  ]
+}`)
+	require.NoError(t, os.WriteFile(filepath.Join(network, "dependencies.json"), data, 0o644))
+
+	g, err := graph.Build(root)
+	require.NoError(t, err)
+
+	stack := g[network]
+	require.NotNil(t, stack)
+	require.Equal(t, []graph.OutputExport{
+		{Output: "vpc_id", SSMParameter: "/{{.Env}}/{{.StackName}}/vpc_id"},
+		{Output: "db_password", Secret: "{{.Env}}/db"},
+	}, stack.Exports)
+
+	require.NoError(t, os.WriteFile(filepath.Join(network, "dependencies.json"), []byte(`{"output_exports": [{"output": "vpc_id"}]}`), 0o644))
+	_, err = graph.Build(root)
+	require.ErrorContains(t, err, "output_exports")
+}
+
+func TestUpstreamDownstreamAndSubgraph(t *testing.T) {
+	t.Parallel()
+
+	g := graph.Graph{
+		"network":  {Path: "network"},
+		"dns":      {Path: "dns"},
+		"ecs":      {Path: "ecs", Dependencies: []string{"network"}},
+		"frontend": {Path: "frontend", Dependencies: []string{"ecs", "dns"}},
+		"backend":  {Path: "backend", Dependencies: []string{"ecs"}},
+	}
+
+	require.Equal(t, []string{"dns", "ecs", "network"}, g.Upstream("frontend"))
+	require.Empty(t, g.Upstream("network"))
+	require.Equal(t, []string{"backend", "ecs", "frontend"}, g.Downstream("network"))
+	require.Empty(t, g.Downstream("frontend"))
+
+	sub := g.Subgraph([]string{"frontend", "ecs", "missing"})
+	require.Len(t, sub, 2)
+	require.Equal(t, []string{"ecs"}, sub["frontend"].Dependencies)
+	require.Empty(t, sub["ecs"].Dependencies)
+	require.Equal(t, []string{"ecs", "dns"}, g["frontend"].Dependencies, "original graph must not be modified")
+
+	order, err := graph.TopoSort(sub)
+	require.NoError(t, err)
+	require.Equal(t, []string{"ecs", "frontend"}, order)
+}
+
+func TestBuildInfersRemoteStateDependencies(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	network := filepath.Join(root, "core-services", "network")
+	ecs := filepath.Join(root, "core-services", "ecs")
+	app := filepath.Join(root, "applications", "frontend")
+	for _, dir := range []string{network, ecs, app} {
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+	}
+
+	writeDependencies(t, filepath.Join(network, "dependencies.json"), nil, false)
+	writeDependencies(t, filepath.Join(ecs, "dependencies.json"), []string{"./core-services/network"}, false)
+	writeDependencies(t, filepath.Join(app, "dependencies.json"), []string{"./core-services/ecs"}, false)
+
+	remoteState := `
+data "terraform_remote_state" "%s" {
+  backend = "s3"
+  config = {
+    bucket = "state-${var.account_id}"
+    key    = "${var.environment}/%s/terraform.tfstate"
+  }
+}
+`
+	require.NoError(t, os.WriteFile(filepath.Join(ecs, "data.tf"), []byte(fmt.Sprintf(remoteState, "network", "network")), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(app, "data.tf"),
+		[]byte(fmt.Sprintf(remoteState, "ecs", "ecs")+fmt.Sprintf(remoteState, "network", "network")+fmt.Sprintf(remoteState, "other", "${var.stack}")), 0o644))
+
+	g, err := graph.Build(root)
+	require.NoError(t, err)
+
+	require.Empty(t, g[absPath(t, ecs)].Inferred)
+	require.Equal(t, []string{absPath(t, network)}, g[absPath(t, ecs)].Dependencies)
+
+	require.Equal(t, []string{absPath(t, network)}, g[absPath(t, app)].Inferred)
+	require.ElementsMatch(t, []string{absPath(t, ecs), absPath(t, network)}, g[absPath(t, app)].Dependencies)
+	require.Equal(t, map[string]string{"ecs": absPath(t, ecs), "network": absPath(t, network)}, g[absPath(t, app)].RemoteStates)
+}
+
+func TestRenderHighlightsCyclesAndSkipDestroy(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	network := filepath.Join(root, "network")
+	ecs := filepath.Join(root, "ecs")
+	app := filepath.Join(root, "app")
+	g := graph.Graph{
+		network: {Path: network, Dependencies: []string{app}},
+		ecs:     {Path: ecs, Dependencies: []string{network}},
+		app:     {Path: app, Dependencies: []string{ecs}, SkipDestroy: true},
+	}
+	other := filepath.Join(root, "other")
+	g[other] = &graph.Stack{Path: other, Dependencies: []string{network}}
+
+	require.Equal(t, [][]string{{app, ecs, network}}, graph.Cycles(g))
+
+	var dot bytes.Buffer
+	require.NoError(t, graph.Render(&dot, g, root, graph.FormatDOT))
+	require.Contains(t, dot.String(), `"app" [label="app\n(skip destroy)", style=dashed, color=red, fontcolor=red];`)
+	require.Contains(t, dot.String(), `"ecs" -> "app" [color=red];`)
+	require.Contains(t, dot.String(), `"network" -> "other";`)
+
+	var mermaid bytes.Buffer
+	require.NoError(t, graph.Render(&mermaid, g, root, graph.FormatMermaid))
+	require.Contains(t, mermaid.String(), "graph LR\n")
+	require.Contains(t, mermaid.String(), "linkStyle 0,1,2 stroke:#d00")
+
+	var out bytes.Buffer
+	require.NoError(t, graph.Render(&out, g, root, graph.FormatJSON))
+	var decoded struct {
+		Stacks []struct {
+			Path        string `json:"path"`
+			SkipDestroy bool   `json:"skip_destroy"`
+			InCycle     bool   `json:"in_cycle"`
+		} `json:"stacks"`
+		Cycles [][]string `json:"cycles"`
+	}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	require.Equal(t, [][]string{{"app", "ecs", "network"}}, decoded.Cycles)
+	require.Len(t, decoded.Stacks, 4)
+	require.False(t, decoded.Stacks[3].InCycle)
+
+	require.Error(t, graph.Render(&out, g, root, "svg"))
+}
+
+func TestBuildParsesEdgeAnnotationsAndRendersThem(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	network := filepath.Join(root, "network")
+	dns := filepath.Join(root, "dns")
+	app := filepath.Join(root, "app")
+	for _, dir := range []string{network, dns, app} {
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+	}
+	writeDependencies(t, filepath.Join(network, "dependencies.json"), nil, false)
+	writeDependencies(t, filepath.Join(dns, "dependencies.json"), nil, false)
+	require.NoError(t, os.WriteFile(filepath.Join(app, "dependencies.json"), []byte(`{
+  "dependencies": {
+    "paths": ["./network"],
+    "edges": [
+      {"path": "./network", "required_outputs": ["vpc_id", "subnet_ids"]},
+      {"path": "./dns", "soft": true, "propagate_outputs": ["zone_id"]}
+    ]
+  }
+}`), 0o644))
+
+	g, err := graph.Build(root)
+	require.NoError(t, err)
+	stack := g[absPath(t, app)]
+	require.ElementsMatch(t, []string{absPath(t, network), absPath(t, dns)}, stack.Dependencies)
+	require.True(t, stack.IsSoft(absPath(t, dns)))
+	require.False(t, stack.IsSoft(absPath(t, network)))
+	require.Equal(t, []string{"vpc_id", "subnet_ids"}, stack.Edges[absPath(t, network)].RequiredOutputs)
+	require.Equal(t, map[string][]string{absPath(t, app): {"zone_id"}}, g.Consumers(absPath(t, dns)))
+	require.Empty(t, g.Consumers(absPath(t, network)))
+
+	var dot bytes.Buffer
+	require.NoError(t, graph.Render(&dot, g, root, graph.FormatDOT))
+	require.Contains(t, dot.String(), `"dns" -> "app" [style=dashed];`)
+	require.Contains(t, dot.String(), `"network" -> "app" [label="vpc_id, subnet_ids"];`)
+
+	var mermaid bytes.Buffer
+	require.NoError(t, graph.Render(&mermaid, g, root, graph.FormatMermaid))
+	require.Contains(t, mermaid.String(), `s1 -.-> s0`)
+	require.Contains(t, mermaid.String(), `s2 -->|"vpc_id, subnet_ids"| s0`)
+
+	require.NoError(t, os.WriteFile(filepath.Join(app, "dependencies.json"), []byte(`{"dependencies": {"edges": [{"soft": true}]}}`), 0o644))
+	_, err = graph.Build(root)
+	require.ErrorContains(t, err, "dependencies.edges")
+
+	require.NoError(t, os.WriteFile(filepath.Join(app, "dependencies.json"), []byte(`{"dependencies": {"edges": [{"path": "./dns", "propagate_outputs": ["zone.id"]}]}}`), 0o644))
+	_, err = graph.Build(root)
+	require.ErrorContains(t, err, `propagated output "zone.id" is not a valid variable name`)
+}
+
+func TestBuildDiscoversProviderRegions(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	network := filepath.Join(root, "network")
+	dns := filepath.Join(root, "dns")
+	for _, dir := range []string{network, filepath.Join(dns, "tfvars")} {
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+	}
+	writeDependencies(t, filepath.Join(network, "dependencies.json"), nil, false)
+	writeDependencies(t, filepath.Join(dns, "dependencies.json"), nil, false)
+
+	require.NoError(t, os.WriteFile(filepath.Join(network, "providers.tf"), []byte(`
+provider "aws" {
+  region = "eu-west-2"
+}
+`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dns, "providers.tf"), []byte(`
+variable "region" {
+  default = "eu-west-1"
+}
+
+provider "aws" {
+  region = var.region
+}
+
+provider "aws" {
+  alias  = "global"
+  region = "us-east-1"
+}
+`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dns, "tfvars", "prod.tfvars"), []byte(`region = "eu-west-2"`), 0o644))
+
+	g, err := graph.Build(root)
+	require.NoError(t, err)
+	require.Equal(t, []graph.ProviderRegion{
+		{Region: "eu-west-1", Variable: "region"},
+		{Alias: "global", Region: "us-east-1"},
+	}, g[absPath(t, dns)].Regions)
+
+	graph.ResolveRegionVariables(g, func(stackDir string) []string {
+		return []string{filepath.Join(stackDir, "tfvars", "prod.tfvars")}
+	})
+	require.Equal(t, "eu-west-2", g[absPath(t, dns)].Regions[0].Region)
+	require.Equal(t, map[string][]string{
+		"eu-west-2": {absPath(t, dns), absPath(t, network)},
+		"us-east-1": {absPath(t, dns)},
+	}, graph.RegionInventory(g))
+
+	var buf bytes.Buffer
+	require.NoError(t, graph.Render(&buf, g, root, graph.FormatJSON))
+	var rendered struct {
+		Regions map[string][]string `json:"regions"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &rendered))
+	require.Equal(t, []string{"dns", "network"}, rendered.Regions["eu-west-2"])
+}
+
+func TestDependencyDeltasAndSync(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	network := filepath.Join(root, "network")
+	iam := filepath.Join(root, "iam")
+	app := filepath.Join(root, "app")
+	for _, dir := range []string{network, iam, app} {
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+		writeDependencies(t, filepath.Join(dir, "dependencies.json"), nil, false)
+	}
+	writeDependencies(t, filepath.Join(app, "dependencies.json"), []string{"./iam"}, true)
+	require.NoError(t, os.WriteFile(filepath.Join(app, "data.tf"), []byte(`
+data "terraform_remote_state" "network" {
+  backend = "s3"
+  config = {
+    key = "${var.environment}/network/terraform.tfstate"
+  }
+}
+`), 0o644))
+
+	g, err := graph.Build(root)
+	require.NoError(t, err)
+	require.Equal(t, []string{absPath(t, network)}, g[absPath(t, app)].RemoteStateRefs)
+	require.Equal(t, []graph.DependencyDelta{{
+		Stack:  absPath(t, app),
+		Add:    []string{absPath(t, network)},
+		Remove: []string{absPath(t, iam)},
+	}}, graph.DependencyDeltas(g))
+
+	require.NoError(t, graph.SyncDependencies(root, graph.DependencyDeltas(g)))
+	data, err := os.ReadFile(filepath.Join(app, "dependencies.json"))
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"skip_when_destroying": true`)
+
+	g, err = graph.Build(root)
+	require.NoError(t, err)
+	require.Equal(t, []string{absPath(t, network)}, g[absPath(t, app)].Dependencies)
+	require.Empty(t, g[absPath(t, app)].Inferred)
+	require.Empty(t, graph.DependencyDeltas(g))
+}
+
+func TestGateRemovesFlaggedStacksAndTheirDependents(t *testing.T) {
+	t.Parallel()
+
+	g := graph.Graph{
+		"network":    {Path: "network"},
+		"new-vpc":    {Path: "new-vpc", FeatureFlag: "new_vpc", Dependencies: []string{"network"}},
+		"peering":    {Path: "peering", Dependencies: []string{"new-vpc"}},
+		"dashboards": {Path: "dashboards", Dependencies: []string{"new-vpc"}, Edges: map[string]graph.Edge{"new-vpc": {Path: "new-vpc", Soft: true}}},
+		"endpoints":  {Path: "endpoints", Dependencies: []string{"peering"}},
+		"cache":      {Path: "cache", FeatureFlag: "redis", Dependencies: []string{"network"}},
+	}
+
+	enabled := map[string]bool{"redis": true}
+	gated, removed := g.Gate(func(flag string) bool { return enabled[flag] })
+	require.Equal(t, map[string]graph.Gated{
+		"new-vpc":   {Flag: "new_vpc"},
+		"peering":   {Flag: "new_vpc", Via: "new-vpc"},
+		"endpoints": {Flag: "new_vpc", Via: "new-vpc"},
+	}, removed)
+	require.Len(t, gated, 3)
+	// Soft dependents only ordered after the gated stack and still run.
+	require.Empty(t, gated["dashboards"].Dependencies)
+	require.Equal(t, []string{"network"}, gated["cache"].Dependencies)
+
+	enabled["new_vpc"] = true
+	gated, removed = g.Gate(func(flag string) bool { return enabled[flag] })
+	require.Empty(t, removed)
+	require.Len(t, gated, len(g))
+}
+
+func TestFilterByGlobAndTagKeepsTransitiveOrder(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	write := func(rel, content string) string {
+		dir := filepath.Join(root, rel)
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "dependencies.json"), []byte(content), 0o644))
+		return dir
+	}
+	network := write("core-services/network", `{"tags": ["core"]}`)
+	ecs := write("core-services/ecs", `{"dependencies": {"paths": ["core-services/network"]}}`)
+	frontend := write("applications/frontend", `{"dependencies": {"paths": ["core-services/ecs"]}, "tags": ["web"]}`)
+	backend := write("applications/backend", `{"dependencies": {"paths": ["core-services/ecs"]}, "feature_flag": "backend_v2"}`)
+
+	g, err := graph.Build(root)
+	require.NoError(t, err)
+	require.Equal(t, []string{"core"}, g[absPath(t, network)].Tags)
+	require.Equal(t, "backend_v2", g[absPath(t, backend)].FeatureFlag)
+
+	paths, err := graph.Filter(g, root, []string{"core-services/*"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{absPath(t, ecs), absPath(t, network)}, paths)
+
+	paths, err = graph.Filter(g, root, []string{"core-services", "applications"}, []string{"core-services/ecs", "applications/backend"})
+	require.NoError(t, err)
+	require.Equal(t, []string{absPath(t, frontend), absPath(t, network)}, paths)
+
+	paths, err = graph.Filter(g, root, []string{"tag:core", "tag:web"}, nil)
+	require.NoError(t, err)
+	require.Len(t, paths, 2)
+
+	// The frontend depends on the network through the excluded ECS stack.
+	sub := g.Select(paths)
+	require.Equal(t, []string{absPath(t, network)}, sub[absPath(t, frontend)].Dependencies)
+	order, err := graph.TopoSort(sub)
+	require.NoError(t, err)
+	require.Equal(t, []string{absPath(t, network), absPath(t, frontend)}, order)
+
+	_, err = graph.Filter(g, root, []string{"["}, nil)
+	require.ErrorContains(t, err, "invalid stack filter")
+}
@@ -0,0 +1,201 @@
+package graph
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// stateFileName is the final segment of every stack's S3 state key,
+// <env>/<stack>/terraform.tfstate.
+const stateFileName = "terraform.tfstate"
+
+// inferDependencies adds an edge for every terraform_remote_state data source
+// whose S3 key resolves to another stack in g. Edges not already declared in
+// dependencies.json are recorded in Stack.Inferred; every resolved reference
+// is recorded in Stack.RemoteStateRefs.
+func inferDependencies(g Graph) {
+	byName := make(map[string][]string)
+	for path := range g {
+		name := stateKeyName(backendKey(path))
+		if name == "" {
+			name = filepath.Base(path)
+		}
+		byName[name] = append(byName[name], path)
+	}
+
+	for path, stack := range g {
+		declared := make(map[string]bool, len(stack.Dependencies))
+		for _, dep := range stack.Dependencies {
+			declared[dep] = true
+		}
+		for _, source := range remoteStateSources(path) {
+			candidates := byName[stateKeyName(source.key)]
+			if len(candidates) != 1 {
+				stack.opaqueRemoteState = true
+				continue
+			}
+			if candidates[0] == path {
+				continue
+			}
+			dep := candidates[0]
+			if stack.RemoteStates == nil {
+				stack.RemoteStates = make(map[string]string)
+			}
+			stack.RemoteStates[source.name] = dep
+			if !slices.Contains(stack.RemoteStateRefs, dep) {
+				stack.RemoteStateRefs = append(stack.RemoteStateRefs, dep)
+			}
+			if declared[dep] {
+				continue
+			}
+			declared[dep] = true
+			stack.Dependencies = append(stack.Dependencies, dep)
+			stack.Inferred = append(stack.Inferred, dep)
+		}
+		sort.Strings(stack.Inferred)
+		sort.Strings(stack.RemoteStateRefs)
+	}
+}
+
+// stateKeyName returns the stack segment of an <env>/<stack>/terraform.tfstate
+// key, or "" when the key does not follow that layout or the segment is not a
+// literal.
+func stateKeyName(key string) string {
+	parts := strings.Split(key, "/")
+	if len(parts) < 2 || parts[len(parts)-1] != stateFileName {
+		return ""
+	}
+	name := parts[len(parts)-2]
+	if name == "" || strings.Contains(name, "*") {
+		return ""
+	}
+	return name
+}
+
+// remoteStateSource is a terraform_remote_state data source and the S3 key
+// it reads.
+type remoteStateSource struct {
+	name string
+	key  string
+}
+
+// remoteStateSources returns the terraform_remote_state data sources in the
+// stack's .tf files that read S3 keys. Interpolated parts of the keys are
+// replaced with "*".
+func remoteStateSources(stackDir string) []remoteStateSource {
+	var sources []remoteStateSource
+	for _, body := range parseStackFiles(stackDir) {
+		for _, block := range body.Blocks {
+			if block.Type != "data" || len(block.Labels) == 0 || block.Labels[0] != "terraform_remote_state" {
+				continue
+			}
+			if backend, ok := block.Body.Attributes["backend"]; !ok || templateString(backend.Expr) != "s3" {
+				continue
+			}
+			config, ok := block.Body.Attributes["config"]
+			if !ok {
+				continue
+			}
+			if len(block.Labels) < 2 {
+				continue
+			}
+			if key := objectAttribute(config.Expr, "key"); key != "" {
+				sources = append(sources, remoteStateSource{name: block.Labels[1], key: key})
+			}
+		}
+	}
+	return sources
+}
+
+// backendKey returns the key declared in the stack's own backend "s3" block,
+// if any.
+func backendKey(stackDir string) string {
+	for _, body := range parseStackFiles(stackDir) {
+		for _, block := range body.Blocks {
+			if block.Type != "terraform" {
+				continue
+			}
+			for _, inner := range block.Body.Blocks {
+				if inner.Type != "backend" || len(inner.Labels) == 0 || inner.Labels[0] != "s3" {
+					continue
+				}
+				if attr, ok := inner.Body.Attributes["key"]; ok {
+					return templateString(attr.Expr)
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// parseStackFiles parses the top-level .tf files of stackDir. Files that fail
+// to parse are ignored; Terraform reports those errors when the stack runs.
+func parseStackFiles(stackDir string) []*hclsyntax.Body {
+	matches, err := filepath.Glob(filepath.Join(stackDir, "*.tf"))
+	if err != nil {
+		return nil
+	}
+	sort.Strings(matches)
+	var bodies []*hclsyntax.Body
+	for _, path := range matches {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		file, diags := hclsyntax.ParseConfig(src, path, hcl.InitialPos)
+		if diags.HasErrors() {
+			continue
+		}
+		if body, ok := file.Body.(*hclsyntax.Body); ok {
+			bodies = append(bodies, body)
+		}
+	}
+	return bodies
+}
+
+func objectAttribute(expr hclsyntax.Expression, name string) string {
+	obj, ok := expr.(*hclsyntax.ObjectConsExpr)
+	if !ok {
+		return ""
+	}
+	for _, item := range obj.Items {
+		if hcl.ExprAsKeyword(item.KeyExpr) == name {
+			return templateString(item.ValueExpr)
+		}
+		if key, diags := item.KeyExpr.Value(nil); !diags.HasErrors() && key.Type() == cty.String && key.AsString() == name {
+			return templateString(item.ValueExpr)
+		}
+	}
+	return ""
+}
+
+// templateString renders a string expression, substituting "*" for any part
+// that is not a literal.
+func templateString(expr hclsyntax.Expression) string {
+	switch e := expr.(type) {
+	case *hclsyntax.LiteralValueExpr:
+		if e.Val.Type() == cty.String && e.Val.IsKnown() && !e.Val.IsNull() {
+			return e.Val.AsString()
+		}
+	case *hclsyntax.TemplateExpr:
+		var b strings.Builder
+		for _, part := range e.Parts {
+			if lit, ok := part.(*hclsyntax.LiteralValueExpr); ok && lit.Val.Type() == cty.String {
+				b.WriteString(lit.Val.AsString())
+				continue
+			}
+			b.WriteString("*")
+		}
+		return b.String()
+	case *hclsyntax.TemplateWrapExpr:
+		return "*"
+	}
+	return ""
+}
@@ -0,0 +1,149 @@
+package graph
+
+import (
+	"os"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// ProviderRegion is the region an aws provider block of a stack targets.
+// Region is empty when it cannot be determined statically.
+type ProviderRegion struct {
+	Alias  string `json:"alias,omitempty"`
+	Region string `json:"region"`
+	// Variable names the input variable the region is read from, if any.
+	Variable string `json:"variable,omitempty"`
+}
+
+// discoverRegions records the region of every aws provider block. Regions
+// set from a variable take the variable's default until
+// ResolveRegionVariables applies an environment's tfvars.
+func discoverRegions(g Graph) {
+	for path, stack := range g {
+		bodies := parseStackFiles(path)
+		defaults := make(map[string]string)
+		for _, body := range bodies {
+			for _, block := range body.Blocks {
+				if block.Type != "variable" || len(block.Labels) == 0 {
+					continue
+				}
+				if attr, ok := block.Body.Attributes["default"]; ok {
+					defaults[block.Labels[0]] = literalString(attr.Expr)
+				}
+			}
+		}
+		for _, body := range bodies {
+			for _, block := range body.Blocks {
+				if block.Type != "provider" || len(block.Labels) == 0 || block.Labels[0] != "aws" {
+					continue
+				}
+				var pr ProviderRegion
+				if attr, ok := block.Body.Attributes["alias"]; ok {
+					pr.Alias = literalString(attr.Expr)
+				}
+				if attr, ok := block.Body.Attributes["region"]; ok {
+					pr.Region = literalString(attr.Expr)
+					if name := variableName(attr.Expr); name != "" {
+						pr.Variable = name
+						pr.Region = defaults[name]
+					}
+				}
+				stack.Regions = append(stack.Regions, pr)
+			}
+		}
+		sort.Slice(stack.Regions, func(i, j int) bool { return stack.Regions[i].Alias < stack.Regions[j].Alias })
+	}
+}
+
+// ResolveRegionVariables sets regions read from variables to the values the
+// tfvars files returned by varFiles assign them, later files winning.
+func ResolveRegionVariables(g Graph, varFiles func(stackDir string) []string) {
+	for path, stack := range g {
+		var values map[string]string
+		for i, pr := range stack.Regions {
+			if pr.Variable == "" {
+				continue
+			}
+			if values == nil {
+				values = tfvarsStrings(varFiles(path))
+			}
+			if v, ok := values[pr.Variable]; ok {
+				stack.Regions[i].Region = v
+			}
+		}
+	}
+}
+
+// RegionInventory maps each known region to the stacks that target it.
+func RegionInventory(g Graph) map[string][]string {
+	inventory := make(map[string][]string)
+	for path, stack := range g {
+		seen := make(map[string]bool)
+		for _, pr := range stack.Regions {
+			if pr.Region == "" || seen[pr.Region] {
+				continue
+			}
+			seen[pr.Region] = true
+			inventory[pr.Region] = append(inventory[pr.Region], path)
+		}
+	}
+	for _, paths := range inventory {
+		sort.Strings(paths)
+	}
+	return inventory
+}
+
+// tfvarsStrings returns the literal string assignments of files, later files
+// overriding earlier ones.
+func tfvarsStrings(files []string) map[string]string {
+	values := make(map[string]string)
+	for _, path := range files {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		file, diags := hclsyntax.ParseConfig(src, path, hcl.InitialPos)
+		if diags.HasErrors() {
+			continue
+		}
+		body, ok := file.Body.(*hclsyntax.Body)
+		if !ok {
+			continue
+		}
+		for name, attr := range body.Attributes {
+			if v := literalString(attr.Expr); v != "" {
+				values[name] = v
+			}
+		}
+	}
+	return values
+}
+
+// literalString returns expr's value when it is a plain string, else "".
+func literalString(expr hclsyntax.Expression) string {
+	s := templateString(expr)
+	if s == "*" {
+		return ""
+	}
+	if t, ok := expr.(*hclsyntax.TemplateExpr); ok && !t.IsStringLiteral() {
+		return ""
+	}
+	return s
+}
+
+// variableName returns x for the expression var.x or "${var.x}".
+func variableName(expr hclsyntax.Expression) string {
+	if wrap, ok := expr.(*hclsyntax.TemplateWrapExpr); ok {
+		expr = wrap.Wrapped
+	}
+	traversal, ok := expr.(*hclsyntax.ScopeTraversalExpr)
+	if !ok || len(traversal.Traversal) != 2 || traversal.Traversal.RootName() != "var" {
+		return ""
+	}
+	if attr, ok := traversal.Traversal[1].(hcl.TraverseAttr); ok {
+		return attr.Name
+	}
+	return ""
+}
@@ -0,0 +1,309 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Supported Render formats.
+const (
+	FormatDOT     = "dot"
+	FormatMermaid = "mermaid"
+	FormatJSON    = "json"
+)
+
+type renderStack struct {
+	Path         string           `json:"path"`
+	Dependencies []string         `json:"dependencies"`
+	Inferred     []string         `json:"inferred_dependencies,omitempty"`
+	SkipDestroy  bool             `json:"skip_destroy"`
+	InCycle      bool             `json:"in_cycle"`
+	Edges        []Edge           `json:"edges,omitempty"`
+	Regions      []ProviderRegion `json:"regions,omitempty"`
+}
+
+// edge returns the annotation of the dependency on dep, if any.
+func (s renderStack) edge(dep string) Edge {
+	for _, e := range s.Edges {
+		if e.Path == dep {
+			return e
+		}
+	}
+	return Edge{Path: dep}
+}
+
+type renderGraph struct {
+	Stacks []renderStack `json:"stacks"`
+	Cycles [][]string    `json:"cycles"`
+	// Regions maps each region to the stacks whose providers target it.
+	Regions map[string][]string `json:"regions,omitempty"`
+}
+
+// Render writes g in format with stack paths relative to root. Edges point
+// from a dependency to the stack that depends on it, matching execution
+// order. Skip-destroy stacks are annotated, soft edges are dashed, required
+// outputs label their edge, and stacks and edges that form a dependency cycle
+// are highlighted.
+func Render(w io.Writer, g Graph, root, format string) error {
+	model, err := newRenderGraph(g, root)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case FormatDOT:
+		return renderDOT(w, model)
+	case FormatMermaid:
+		return renderMermaid(w, model)
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(model)
+	default:
+		return fmt.Errorf("unsupported graph format %q (expected dot, mermaid or json)", format)
+	}
+}
+
+func newRenderGraph(g Graph, root string) (renderGraph, error) {
+	rootAbs, err := filepath.Abs(root)
+	if err != nil {
+		return renderGraph{}, err
+	}
+	rel := func(path string) string {
+		r, err := filepath.Rel(rootAbs, path)
+		if err != nil {
+			return filepath.ToSlash(path)
+		}
+		return filepath.ToSlash(r)
+	}
+
+	cycles := Cycles(g)
+	inCycle := make(map[string]bool)
+	model := renderGraph{Cycles: make([][]string, 0, len(cycles))}
+	for region, stacks := range RegionInventory(g) {
+		if model.Regions == nil {
+			model.Regions = make(map[string][]string)
+		}
+		for _, path := range stacks {
+			model.Regions[region] = append(model.Regions[region], rel(path))
+		}
+	}
+	for _, cycle := range cycles {
+		rels := make([]string, 0, len(cycle))
+		for _, path := range cycle {
+			inCycle[path] = true
+			rels = append(rels, rel(path))
+		}
+		model.Cycles = append(model.Cycles, rels)
+	}
+
+	paths := make([]string, 0, len(g))
+	for path := range g {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		stack := g[path]
+		rs := renderStack{
+			Path:         rel(path),
+			Dependencies: make([]string, 0, len(stack.Dependencies)),
+			SkipDestroy:  stack.SkipDestroy,
+			InCycle:      inCycle[path],
+		}
+		for _, dep := range stack.Dependencies {
+			rs.Dependencies = append(rs.Dependencies, rel(dep))
+		}
+		for _, dep := range stack.Inferred {
+			rs.Inferred = append(rs.Inferred, rel(dep))
+		}
+		sort.Strings(rs.Dependencies)
+		for _, edge := range stack.Edges {
+			edge.Path = rel(edge.Path)
+			rs.Edges = append(rs.Edges, edge)
+		}
+		sort.Slice(rs.Edges, func(i, j int) bool { return rs.Edges[i].Path < rs.Edges[j].Path })
+		rs.Regions = stack.Regions
+		model.Stacks = append(model.Stacks, rs)
+	}
+	return model, nil
+}
+
+// Cycles returns the groups of stacks that depend on each other, each sorted,
+// using Tarjan's strongly connected components algorithm. A stack that
+// depends on itself forms a cycle of one.
+func Cycles(g Graph) [][]string {
+	index := 0
+	indices := make(map[string]int)
+	lowlink := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	var cycles [][]string
+
+	paths := make([]string, 0, len(g))
+	for path := range g {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var connect func(string)
+	connect = func(v string) {
+		indices[v] = index
+		lowlink[v] = index
+		index++
+		stack = append(stack, v)
+		onStack[v] = true
+
+		selfLoop := false
+		if node, ok := g[v]; ok {
+			for _, w := range node.Dependencies {
+				if w == v {
+					selfLoop = true
+				}
+				if _, seen := indices[w]; !seen {
+					connect(w)
+					lowlink[v] = min(lowlink[v], lowlink[w])
+				} else if onStack[w] {
+					lowlink[v] = min(lowlink[v], indices[w])
+				}
+			}
+		}
+
+		if lowlink[v] != indices[v] {
+			return
+		}
+		var component []string
+		for {
+			w := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[w] = false
+			component = append(component, w)
+			if w == v {
+				break
+			}
+		}
+		if len(component) > 1 || selfLoop {
+			sort.Strings(component)
+			cycles = append(cycles, component)
+		}
+	}
+
+	for _, path := range paths {
+		if _, seen := indices[path]; !seen {
+			connect(path)
+		}
+	}
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i][0] < cycles[j][0] })
+	return cycles
+}
+
+func renderDOT(w io.Writer, model renderGraph) error {
+	var b strings.Builder
+	b.WriteString("digraph stacks {\n  rankdir=LR;\n  node [shape=box];\n")
+	for _, s := range model.Stacks {
+		label := dotEscape(s.Path)
+		var attrs []string
+		if s.SkipDestroy {
+			label += `\n(skip destroy)`
+			attrs = append(attrs, "style=dashed")
+		}
+		attrs = append([]string{`label="` + label + `"`}, attrs...)
+		if s.InCycle {
+			attrs = append(attrs, "color=red", "fontcolor=red")
+		}
+		fmt.Fprintf(&b, "  %q [%s];\n", s.Path, strings.Join(attrs, ", "))
+	}
+	for _, s := range model.Stacks {
+		for _, dep := range s.Dependencies {
+			var attrs []string
+			edge := s.edge(dep)
+			if edge.Soft {
+				attrs = append(attrs, "style=dashed")
+			}
+			if len(edge.RequiredOutputs) > 0 {
+				attrs = append(attrs, `label="`+dotEscape(strings.Join(edge.RequiredOutputs, ", "))+`"`)
+			}
+			if sameCycle(model.Cycles, dep, s.Path) {
+				attrs = append(attrs, "color=red")
+			}
+			if len(attrs) == 0 {
+				fmt.Fprintf(&b, "  %q -> %q;\n", dep, s.Path)
+				continue
+			}
+			fmt.Fprintf(&b, "  %q -> %q [%s];\n", dep, s.Path, strings.Join(attrs, ", "))
+		}
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func renderMermaid(w io.Writer, model renderGraph) error {
+	var b strings.Builder
+	b.WriteString("graph LR\n")
+	ids := make(map[string]string, len(model.Stacks))
+	for i, s := range model.Stacks {
+		ids[s.Path] = fmt.Sprintf("s%d", i)
+	}
+	for _, s := range model.Stacks {
+		label := s.Path
+		if s.SkipDestroy {
+			label += "<br/>(skip destroy)"
+		}
+		class := ""
+		switch {
+		case s.InCycle:
+			class = ":::cycle"
+		case s.SkipDestroy:
+			class = ":::skipDestroy"
+		}
+		fmt.Fprintf(&b, "  %s[\"%s\"]%s\n", ids[s.Path], label, class)
+	}
+	link := 0
+	var cycleLinks []string
+	for _, s := range model.Stacks {
+		for _, dep := range s.Dependencies {
+			edge := s.edge(dep)
+			arrow := "-->"
+			if edge.Soft {
+				arrow = "-.->"
+			}
+			if len(edge.RequiredOutputs) > 0 {
+				arrow += fmt.Sprintf("|\"%s\"|", strings.Join(edge.RequiredOutputs, ", "))
+			}
+			fmt.Fprintf(&b, "  %s %s %s\n", ids[dep], arrow, ids[s.Path])
+			if sameCycle(model.Cycles, dep, s.Path) {
+				cycleLinks = append(cycleLinks, fmt.Sprint(link))
+			}
+			link++
+		}
+	}
+	b.WriteString("  classDef skipDestroy stroke-dasharray: 5 5\n")
+	b.WriteString("  classDef cycle stroke:#d00,color:#d00\n")
+	if len(cycleLinks) > 0 {
+		fmt.Fprintf(&b, "  linkStyle %s stroke:#d00\n", strings.Join(cycleLinks, ","))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dotEscape escapes s for use inside a double-quoted DOT string.
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+func sameCycle(cycles [][]string, a, b string) bool {
+	for _, cycle := range cycles {
+		var hasA, hasB bool
+		for _, p := range cycle {
+			hasA = hasA || p == a
+			hasB = hasB || p == b
+		}
+		if hasA && hasB {
+			return true
+		}
+	}
+	return false
+}
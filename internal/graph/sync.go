@@ -0,0 +1,184 @@
+package graph
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+)
+
+// DependencyDelta is the change to a stack's dependencies.json implied by its
+// terraform_remote_state data sources. Add lists stacks whose state is read
+// but not declared; Remove lists dependencies.paths entries whose state is no
+// longer read. Entries under dependencies.edges are never removed, so
+// ordering-only dependencies belong there.
+type DependencyDelta struct {
+	Stack  string
+	Add    []string
+	Remove []string
+}
+
+// DependencyDeltas returns the delta of every stack whose declared
+// dependencies disagree with its remote state references, sorted by stack.
+// Removals are only suggested for stacks that read at least one other stack's
+// state and whose every remote state key resolves to a stack.
+func DependencyDeltas(g Graph) []DependencyDelta {
+	var deltas []DependencyDelta
+	for path, stack := range g {
+		delta := DependencyDelta{Stack: path, Add: slices.Clone(stack.Inferred)}
+		if len(stack.RemoteStateRefs) > 0 && !stack.opaqueRemoteState {
+			for _, dep := range stack.Dependencies {
+				if slices.Contains(stack.Inferred, dep) || slices.Contains(stack.RemoteStateRefs, dep) {
+					continue
+				}
+				if _, ok := stack.Edges[dep]; ok {
+					continue
+				}
+				delta.Remove = append(delta.Remove, dep)
+			}
+			sort.Strings(delta.Remove)
+		}
+		if len(delta.Add) > 0 || len(delta.Remove) > 0 {
+			deltas = append(deltas, delta)
+		}
+	}
+	sort.Slice(deltas, func(i, j int) bool { return deltas[i].Stack < deltas[j].Stack })
+	return deltas
+}
+
+// SyncDependencies rewrites the dependencies.paths list of each delta's
+// dependencies.json, adding paths relative to root and dropping entries that
+// resolve to a removed stack. Other settings in the file are preserved.
+func SyncDependencies(root string, deltas []DependencyDelta) error {
+	rootAbs, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	for _, delta := range deltas {
+		if err := syncStack(rootAbs, delta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func syncStack(rootAbs string, delta DependencyDelta) error {
+	path := filepath.Join(delta.Stack, "dependencies.json")
+	doc := make(map[string]interface{})
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("read %s: %w", path, err)
+	default:
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("invalid JSON in %s: %w", path, err)
+		}
+	}
+
+	deps, _ := doc["dependencies"].(map[string]interface{})
+	if deps == nil {
+		deps = make(map[string]interface{})
+	}
+	existing, _ := deps["paths"].([]interface{})
+
+	paths := make([]interface{}, 0, len(existing)+len(delta.Add))
+	for _, entry := range existing {
+		if s, ok := entry.(string); ok && slices.Contains(delta.Remove, resolveFrom(rootAbs, s)) {
+			continue
+		}
+		paths = append(paths, entry)
+	}
+	for _, dep := range delta.Add {
+		rel, err := filepath.Rel(rootAbs, dep)
+		if err != nil {
+			rel = dep
+		}
+		paths = append(paths, filepath.ToSlash(rel))
+	}
+	deps["paths"] = paths
+	doc["dependencies"] = deps
+
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, append(out, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
+
+// RemoveDependency drops every dependencies.paths and dependencies.edges
+// entry of stackPath's dependencies.json that resolves to dep, preserving the
+// file's other settings. It reports whether the file changed.
+func RemoveDependency(root, stackPath, dep string) (bool, error) {
+	rootAbs, err := filepath.Abs(root)
+	if err != nil {
+		return false, err
+	}
+	path := filepath.Join(stackPath, "dependencies.json")
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("read %s: %w", path, err)
+	}
+	doc := make(map[string]interface{})
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return false, fmt.Errorf("invalid JSON in %s: %w", path, err)
+	}
+	deps, _ := doc["dependencies"].(map[string]interface{})
+	if deps == nil {
+		return false, nil
+	}
+
+	changed := false
+	if existing, ok := deps["paths"].([]interface{}); ok {
+		paths := make([]interface{}, 0, len(existing))
+		for _, entry := range existing {
+			if s, ok := entry.(string); ok && resolveFrom(rootAbs, s) == dep {
+				changed = true
+				continue
+			}
+			paths = append(paths, entry)
+		}
+		deps["paths"] = paths
+	}
+	if existing, ok := deps["edges"].([]interface{}); ok {
+		edges := make([]interface{}, 0, len(existing))
+		for _, entry := range existing {
+			edge, _ := entry.(map[string]interface{})
+			if s, ok := edge["path"].(string); ok && resolveFrom(rootAbs, s) == dep {
+				changed = true
+				continue
+			}
+			edges = append(edges, entry)
+		}
+		deps["edges"] = edges
+	}
+	if !changed {
+		return false, nil
+	}
+
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return false, fmt.Errorf("encode %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, append(out, '\n'), 0o644); err != nil {
+		return false, fmt.Errorf("write %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// resolveFrom resolves a dependencies.json path entry the way Build does.
+func resolveFrom(rootAbs, dep string) string {
+	if !filepath.IsAbs(dep) {
+		dep = filepath.Join(rootAbs, dep)
+	}
+	return filepath.Clean(dep)
+}
@@ -0,0 +1,277 @@
+package iampolicy
+
+import (
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// Document is an IAM policy document.
+type Document struct {
+	Version   string      `json:"Version"`
+	Statement []Statement `json:"Statement"`
+}
+
+// Statement grants a set of actions for one AWS service.
+type Statement struct {
+	Sid      string   `json:"Sid"`
+	Effect   string   `json:"Effect"`
+	Action   []string `json:"Action"`
+	Resource string   `json:"Resource"`
+}
+
+// Suggestion is the policy derived from a plan together with the resource
+// types that could not be mapped to an AWS service.
+type Suggestion struct {
+	Policy   Document
+	Unmapped []string
+}
+
+type operation string
+
+const (
+	opRead   operation = "read"
+	opCreate operation = "create"
+	opUpdate operation = "update"
+	opDelete operation = "delete"
+)
+
+// knownActions lists curated permissions for frequently managed resource types
+// where the generic naming convention does not match the AWS API.
+var knownActions = map[string]map[operation][]string{
+	"aws_s3_bucket": {
+		opRead:   {"s3:ListBucket", "s3:GetBucket*", "s3:GetAccelerateConfiguration", "s3:GetEncryptionConfiguration", "s3:GetLifecycleConfiguration", "s3:GetReplicationConfiguration"},
+		opCreate: {"s3:CreateBucket", "s3:PutBucketTagging"},
+		opUpdate: {"s3:PutBucket*"},
+		opDelete: {"s3:DeleteBucket"},
+	},
+	"aws_iam_role": {
+		opRead:   {"iam:GetRole", "iam:ListRolePolicies", "iam:ListAttachedRolePolicies", "iam:ListInstanceProfilesForRole"},
+		opCreate: {"iam:CreateRole", "iam:TagRole"},
+		opUpdate: {"iam:UpdateRole", "iam:UpdateAssumeRolePolicy", "iam:TagRole", "iam:UntagRole"},
+		opDelete: {"iam:DeleteRole"},
+	},
+	"aws_iam_role_policy_attachment": {
+		opRead:   {"iam:ListAttachedRolePolicies"},
+		opCreate: {"iam:AttachRolePolicy"},
+		opDelete: {"iam:DetachRolePolicy"},
+	},
+	"aws_security_group": {
+		opRead:   {"ec2:DescribeSecurityGroups", "ec2:DescribeSecurityGroupRules"},
+		opCreate: {"ec2:CreateSecurityGroup", "ec2:CreateTags", "ec2:AuthorizeSecurityGroupIngress", "ec2:AuthorizeSecurityGroupEgress", "ec2:RevokeSecurityGroupEgress"},
+		opUpdate: {"ec2:AuthorizeSecurityGroupIngress", "ec2:AuthorizeSecurityGroupEgress", "ec2:RevokeSecurityGroupIngress", "ec2:RevokeSecurityGroupEgress", "ec2:CreateTags", "ec2:DeleteTags"},
+		opDelete: {"ec2:DeleteSecurityGroup"},
+	},
+	"aws_instance": {
+		opRead:   {"ec2:DescribeInstances", "ec2:DescribeInstanceAttribute", "ec2:DescribeVolumes", "ec2:DescribeInstanceCreditSpecifications"},
+		opCreate: {"ec2:RunInstances", "ec2:CreateTags", "iam:PassRole"},
+		opUpdate: {"ec2:ModifyInstanceAttribute", "ec2:StopInstances", "ec2:StartInstances", "ec2:CreateTags", "ec2:DeleteTags"},
+		opDelete: {"ec2:TerminateInstances"},
+	},
+	"aws_lambda_function": {
+		opRead:   {"lambda:GetFunction", "lambda:GetFunctionCodeSigningConfig", "lambda:ListVersionsByFunction"},
+		opCreate: {"lambda:CreateFunction", "lambda:TagResource", "iam:PassRole"},
+		opUpdate: {"lambda:UpdateFunctionCode", "lambda:UpdateFunctionConfiguration", "lambda:TagResource", "lambda:UntagResource", "iam:PassRole"},
+		opDelete: {"lambda:DeleteFunction"},
+	},
+	"aws_cloudwatch_log_group": {
+		opRead:   {"logs:DescribeLogGroups", "logs:ListTagsForResource"},
+		opCreate: {"logs:CreateLogGroup", "logs:PutRetentionPolicy", "logs:TagResource"},
+		opUpdate: {"logs:PutRetentionPolicy", "logs:DeleteRetentionPolicy", "logs:TagResource", "logs:UntagResource"},
+		opDelete: {"logs:DeleteLogGroup"},
+	},
+}
+
+// servicePrefixes maps resource type prefixes to IAM service namespaces. Longer
+// prefixes win, so aws_cloudwatch_log_ resolves to logs rather than cloudwatch.
+var servicePrefixes = map[string]string{
+	"aws_acm_":              "acm",
+	"aws_alb":               "elasticloadbalancing",
+	"aws_alb_":              "elasticloadbalancing",
+	"aws_api_gateway_":      "apigateway",
+	"aws_apigatewayv2_":     "apigateway",
+	"aws_autoscaling_":      "autoscaling",
+	"aws_cloudfront_":       "cloudfront",
+	"aws_cloudwatch_":       "cloudwatch",
+	"aws_cloudwatch_event_": "events",
+	"aws_cloudwatch_log_":   "logs",
+	"aws_db_":               "rds",
+	"aws_dynamodb_":         "dynamodb",
+	"aws_ebs_":              "ec2",
+	"aws_ecr_":              "ecr",
+	"aws_ecs_":              "ecs",
+	"aws_eip":               "ec2",
+	"aws_eks_":              "eks",
+	"aws_elasticache_":      "elasticache",
+	"aws_iam_":              "iam",
+	"aws_instance":          "ec2",
+	"aws_internet_gateway":  "ec2",
+	"aws_kinesis_":          "kinesis",
+	"aws_kms_":              "kms",
+	"aws_lambda_":           "lambda",
+	"aws_launch_template":   "ec2",
+	"aws_lb":                "elasticloadbalancing",
+	"aws_lb_":               "elasticloadbalancing",
+	"aws_nat_gateway":       "ec2",
+	"aws_network_":          "ec2",
+	"aws_rds_":              "rds",
+	"aws_route53_":          "route53",
+	"aws_route":             "ec2",
+	"aws_s3_":               "s3",
+	"aws_secretsmanager_":   "secretsmanager",
+	"aws_security_group":    "ec2",
+	"aws_sfn_":              "states",
+	"aws_sns_":              "sns",
+	"aws_sqs_":              "sqs",
+	"aws_ssm_":              "ssm",
+	"aws_subnet":            "ec2",
+	"aws_vpc":               "ec2",
+	"aws_wafv2_":            "wafv2",
+}
+
+// Suggest derives the permissions an apply of plan needs. Every managed
+// resource needs read access for refresh; changed resources additionally need
+// the create, update or delete actions matching their planned change.
+func Suggest(plan *tfjson.Plan) Suggestion {
+	actions := make(map[string]map[string]struct{})
+	unmapped := make(map[string]struct{})
+
+	if plan != nil {
+		for _, rc := range plan.ResourceChanges {
+			if rc == nil || rc.Change == nil || rc.Mode != tfjson.ManagedResourceMode {
+				continue
+			}
+			if !strings.HasPrefix(rc.Type, "aws_") {
+				continue
+			}
+			ops := []operation{opRead}
+			for _, a := range rc.Change.Actions {
+				switch a {
+				case tfjson.ActionCreate:
+					ops = append(ops, opCreate)
+				case tfjson.ActionUpdate:
+					ops = append(ops, opUpdate)
+				case tfjson.ActionDelete:
+					ops = append(ops, opDelete)
+				}
+			}
+
+			found := false
+			for _, op := range ops {
+				for _, action := range resourceActions(rc.Type, op) {
+					found = true
+					service := action[:strings.Index(action, ":")]
+					if actions[service] == nil {
+						actions[service] = make(map[string]struct{})
+					}
+					actions[service][action] = struct{}{}
+				}
+			}
+			if !found {
+				unmapped[rc.Type] = struct{}{}
+			}
+		}
+	}
+
+	services := make([]string, 0, len(actions))
+	for service := range actions {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	doc := Document{Version: "2012-10-17", Statement: []Statement{}}
+	for _, service := range services {
+		list := make([]string, 0, len(actions[service]))
+		for a := range actions[service] {
+			list = append(list, a)
+		}
+		sort.Strings(list)
+		doc.Statement = append(doc.Statement, Statement{
+			Sid:      "TerraformApply" + camel(service),
+			Effect:   "Allow",
+			Action:   list,
+			Resource: "*",
+		})
+	}
+
+	return Suggestion{Policy: doc, Unmapped: sortedKeys(unmapped)}
+}
+
+func resourceActions(resourceType string, op operation) []string {
+	if known, ok := knownActions[resourceType]; ok {
+		return known[op]
+	}
+
+	service, noun := serviceFor(resourceType)
+	if service == "" || noun == "" {
+		return nil
+	}
+
+	if service == "ec2" {
+		switch op {
+		case opRead:
+			return []string{"ec2:Describe" + noun + "s"}
+		case opCreate:
+			return []string{"ec2:Create" + noun, "ec2:CreateTags"}
+		case opUpdate:
+			return []string{"ec2:Modify" + noun + "*", "ec2:CreateTags", "ec2:DeleteTags"}
+		case opDelete:
+			return []string{"ec2:Delete" + noun}
+		}
+		return nil
+	}
+
+	switch op {
+	case opRead:
+		return []string{service + ":Describe" + noun + "*", service + ":Get" + noun + "*", service + ":List*"}
+	case opCreate:
+		return []string{service + ":Create" + noun, service + ":TagResource"}
+	case opUpdate:
+		return []string{service + ":Update" + noun + "*", service + ":Put" + noun + "*", service + ":TagResource", service + ":UntagResource"}
+	case opDelete:
+		return []string{service + ":Delete" + noun}
+	}
+	return nil
+}
+
+// serviceFor returns the IAM namespace and API noun for a resource type, for
+// example aws_sqs_queue -> ("sqs", "Queue") and aws_vpc -> ("ec2", "Vpc").
+func serviceFor(resourceType string) (string, string) {
+	best := ""
+	for prefix := range servicePrefixes {
+		if strings.HasPrefix(resourceType, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return "", ""
+	}
+
+	rest := strings.TrimPrefix(resourceType, best)
+	if !strings.HasSuffix(best, "_") || rest == "" {
+		rest = strings.TrimPrefix(resourceType, "aws_")
+	}
+	return servicePrefixes[best], camel(rest)
+}
+
+func camel(s string) string {
+	parts := strings.Split(s, "_")
+	var b strings.Builder
+	for _, p := range parts {
+		if p == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(p[:1]) + p[1:])
+	}
+	return b.String()
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,61 @@
+package iampolicy_test
+
+import (
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/iampolicy"
+)
+
+func change(resourceType string, actions ...tfjson.Action) *tfjson.ResourceChange {
+	return &tfjson.ResourceChange{
+		Type:   resourceType,
+		Mode:   tfjson.ManagedResourceMode,
+		Change: &tfjson.Change{Actions: actions},
+	}
+}
+
+func TestSuggestCoversPlannedActions(t *testing.T) {
+	t.Parallel()
+
+	plan := &tfjson.Plan{ResourceChanges: []*tfjson.ResourceChange{
+		change("aws_s3_bucket", tfjson.ActionNoop),
+		change("aws_sqs_queue", tfjson.ActionCreate),
+		change("aws_vpc", tfjson.ActionUpdate),
+		change("aws_cloudwatch_log_group", tfjson.ActionDelete, tfjson.ActionCreate),
+		change("aws_unknown_widget", tfjson.ActionCreate),
+		change("random_id", tfjson.ActionCreate),
+		{Type: "aws_caller_identity", Mode: tfjson.DataResourceMode, Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionRead}}},
+	}}
+
+	suggestion := iampolicy.Suggest(plan)
+	require.Equal(t, "2012-10-17", suggestion.Policy.Version)
+	require.Equal(t, []string{"aws_unknown_widget"}, suggestion.Unmapped)
+
+	bySid := map[string][]string{}
+	for _, st := range suggestion.Policy.Statement {
+		require.Equal(t, "Allow", st.Effect)
+		require.Equal(t, "*", st.Resource)
+		bySid[st.Sid] = st.Action
+	}
+
+	require.Contains(t, bySid["TerraformApplyS3"], "s3:ListBucket")
+	require.NotContains(t, bySid["TerraformApplyS3"], "s3:CreateBucket")
+	require.Contains(t, bySid["TerraformApplySqs"], "sqs:CreateQueue")
+	require.NotContains(t, bySid["TerraformApplySqs"], "sqs:DeleteQueue")
+	require.Contains(t, bySid["TerraformApplyEc2"], "ec2:DescribeVpcs")
+	require.Contains(t, bySid["TerraformApplyEc2"], "ec2:ModifyVpc*")
+	require.Contains(t, bySid["TerraformApplyLogs"], "logs:DeleteLogGroup")
+	require.Contains(t, bySid["TerraformApplyLogs"], "logs:CreateLogGroup")
+	require.NotContains(t, bySid, "TerraformApplyCloudwatch")
+}
+
+func TestSuggestEmptyPlan(t *testing.T) {
+	t.Parallel()
+
+	suggestion := iampolicy.Suggest(nil)
+	require.Empty(t, suggestion.Policy.Statement)
+	require.Empty(t, suggestion.Unmapped)
+}
@@ -0,0 +1,125 @@
+// Package imports reads manifests of existing resources to adopt into stack
+// state with terraform import.
+package imports
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Import is one resource to adopt: the existing object id is imported into
+// the state of Stack at Address.
+type Import struct {
+	// Stack is the stack name or path; empty means the stack given on the
+	// command line.
+	Stack   string `json:"stack,omitempty"`
+	Address string `json:"address"`
+	ID      string `json:"id"`
+}
+
+func (i Import) String() string {
+	return fmt.Sprintf("%s (id %s)", i.Address, i.ID)
+}
+
+// Load reads a manifest, as JSON (an array of imports) when path ends in
+// .json and as CSV otherwise. A CSV manifest starts with a header naming
+// its columns: address and id, and optionally stack.
+func Load(path string) ([]Import, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read import manifest: %w", err)
+	}
+	var imports []Import
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if err := json.Unmarshal(data, &imports); err != nil {
+			return nil, fmt.Errorf("invalid JSON in %s: %w", path, err)
+		}
+	} else if imports, err = parseCSV(string(data)); err != nil {
+		return nil, fmt.Errorf("invalid CSV in %s: %w", path, err)
+	}
+	if len(imports) == 0 {
+		return nil, fmt.Errorf("%s lists no imports", path)
+	}
+	for n, imp := range imports {
+		imports[n] = Import{
+			Stack:   strings.TrimSpace(imp.Stack),
+			Address: strings.TrimSpace(imp.Address),
+			ID:      strings.TrimSpace(imp.ID),
+		}
+		if imports[n].Address == "" || imports[n].ID == "" {
+			return nil, fmt.Errorf("%s: import %d needs an address and an id", path, n+1)
+		}
+	}
+	return imports, nil
+}
+
+func parseCSV(data string) ([]Import, error) {
+	r := csv.NewReader(strings.NewReader(data))
+	r.TrimLeadingSpace = true
+	r.Comment = '#'
+	header, err := r.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"address", "id"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("the header has no %s column", required)
+		}
+	}
+	var imports []Import
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return imports, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		imp := Import{Address: record[columns["address"]], ID: record[columns["id"]]}
+		if i, ok := columns["stack"]; ok {
+			imp.Stack = record[i]
+		}
+		imports = append(imports, imp)
+	}
+}
+
+// Group sets the stack of imports without one to defaultStack and groups
+// them by stack, keeping the manifest's order within each stack and the
+// order in which stacks first appear. An address imported twice into one
+// stack is an error.
+func Group(imports []Import, defaultStack string) ([]string, map[string][]Import, error) {
+	var stacks []string
+	byStack := make(map[string][]Import)
+	seen := make(map[[2]string]bool)
+	for _, imp := range imports {
+		if imp.Stack == "" {
+			if defaultStack == "" {
+				return nil, nil, fmt.Errorf("import of %s names no stack; add a stack column or pass --stack", imp.Address)
+			}
+			imp.Stack = defaultStack
+		}
+		key := [2]string{imp.Stack, imp.Address}
+		if seen[key] {
+			return nil, nil, fmt.Errorf("%s is imported twice into %s", imp.Address, imp.Stack)
+		}
+		seen[key] = true
+		if _, ok := byStack[imp.Stack]; !ok {
+			stacks = append(stacks, imp.Stack)
+		}
+		byStack[imp.Stack] = append(byStack[imp.Stack], imp)
+	}
+	return stacks, byStack, nil
+}
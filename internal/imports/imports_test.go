@@ -0,0 +1,74 @@
+package imports_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/imports"
+)
+
+func writeManifest(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestLoadCSV(t *testing.T) {
+	t.Parallel()
+
+	path := writeManifest(t, "imports.csv", `# buckets created by hand
+address, id, stack
+aws_s3_bucket.logs, acme-logs, storage
+"aws_iam_role.deploy[""ci""]", deploy-ci,
+`)
+	got, err := imports.Load(path)
+	require.NoError(t, err)
+	require.Equal(t, []imports.Import{
+		{Stack: "storage", Address: "aws_s3_bucket.logs", ID: "acme-logs"},
+		{Address: `aws_iam_role.deploy["ci"]`, ID: "deploy-ci"},
+	}, got)
+}
+
+func TestLoadJSON(t *testing.T) {
+	t.Parallel()
+
+	path := writeManifest(t, "imports.json", `[{"address": "aws_vpc.main", "id": "vpc-123"}]`)
+	got, err := imports.Load(path)
+	require.NoError(t, err)
+	require.Equal(t, []imports.Import{{Address: "aws_vpc.main", ID: "vpc-123"}}, got)
+}
+
+func TestLoadRejectsIncompleteManifests(t *testing.T) {
+	t.Parallel()
+
+	_, err := imports.Load(writeManifest(t, "imports.csv", "stack,address\nnetwork,aws_vpc.main\n"))
+	require.ErrorContains(t, err, "no id column")
+	_, err = imports.Load(writeManifest(t, "imports.json", `[{"address": "aws_vpc.main"}]`))
+	require.ErrorContains(t, err, "import 1 needs an address and an id")
+	_, err = imports.Load(writeManifest(t, "imports.csv", "address,id\n"))
+	require.ErrorContains(t, err, "lists no imports")
+}
+
+func TestGroup(t *testing.T) {
+	t.Parallel()
+
+	list := []imports.Import{
+		{Stack: "storage", Address: "aws_s3_bucket.logs", ID: "acme-logs"},
+		{Address: "aws_vpc.main", ID: "vpc-123"},
+		{Stack: "storage", Address: "aws_s3_bucket.data", ID: "acme-data"},
+	}
+	stacks, byStack, err := imports.Group(list, "network")
+	require.NoError(t, err)
+	require.Equal(t, []string{"storage", "network"}, stacks)
+	require.Len(t, byStack["storage"], 2)
+	require.Equal(t, "network", byStack["network"][0].Stack)
+
+	_, _, err = imports.Group(list, "")
+	require.ErrorContains(t, err, "names no stack")
+	_, _, err = imports.Group(append(list, imports.Import{Stack: "storage", Address: "aws_s3_bucket.logs", ID: "other"}), "network")
+	require.ErrorContains(t, err, "imported twice into storage")
+}
@@ -0,0 +1,148 @@
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// FreezeAPI captures the subset of S3 operations required to manage change freezes.
+type FreezeAPI interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+}
+
+// Freeze is the change-freeze marker stored next to the orchestration lock.
+type Freeze struct {
+	Env       string    `json:"env"`
+	Until     time.Time `json:"until"`
+	Reason    string    `json:"reason,omitempty"`
+	Owner     string    `json:"owner"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Active reports whether the freeze is still in effect at now.
+func (f *Freeze) Active(now time.Time) bool {
+	return f != nil && now.Before(f.Until)
+}
+
+// FrozenError conveys that an environment is under a change freeze.
+type FrozenError struct {
+	Freeze *Freeze
+}
+
+func (e *FrozenError) Error() string {
+	msg := fmt.Sprintf("environment %q is frozen until %s by %s", e.Freeze.Env, e.Freeze.Until.Format(time.RFC3339), e.Freeze.Owner)
+	if e.Freeze.Reason != "" {
+		msg += fmt.Sprintf(" (%s)", e.Freeze.Reason)
+	}
+	return msg + "; pass --break-freeze with a reason to override"
+}
+
+func (e *FrozenError) ExitCode() int {
+	return LockedExitCode
+}
+
+func freezeKey(env string) string {
+	return fmt.Sprintf("locks/%s/freeze.json", env)
+}
+
+// SetFreeze writes or replaces the freeze marker for f.Env.
+func SetFreeze(ctx context.Context, client FreezeAPI, bucket string, f Freeze) error {
+	if client == nil {
+		return fmt.Errorf("freeze client must not be nil")
+	}
+	if f.Env == "" {
+		return fmt.Errorf("freeze environment must not be empty")
+	}
+	if f.Owner == "" {
+		f.Owner = defaultOwner()
+	}
+	if f.CreatedAt.IsZero() {
+		f.CreatedAt = time.Now().UTC()
+	}
+
+	payload, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	_, err = client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(freezeKey(f.Env)),
+		Body:        strings.NewReader(string(payload)),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write freeze marker: %w", err)
+	}
+	return nil
+}
+
+// GetFreeze returns the freeze marker for env, or nil when none exists.
+func GetFreeze(ctx context.Context, client FreezeAPI, bucket, env string) (freeze *Freeze, err error) {
+	if client == nil {
+		return nil, fmt.Errorf("freeze client must not be nil")
+	}
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(freezeKey(env)),
+	})
+	if err != nil {
+		var noKey *s3types.NoSuchKey
+		if errors.As(err, &noKey) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read freeze marker: %w", err)
+	}
+	defer func() {
+		if cerr := out.Body.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("close freeze marker: %w", cerr)
+		}
+	}()
+
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, err
+	}
+	var f Freeze
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid freeze marker for %s: %w", env, err)
+	}
+	return &f, nil
+}
+
+// ClearFreeze removes the freeze marker for env.
+func ClearFreeze(ctx context.Context, client FreezeAPI, bucket, env string) error {
+	if client == nil {
+		return fmt.Errorf("freeze client must not be nil")
+	}
+	_, err := client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(freezeKey(env)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove freeze marker: %w", err)
+	}
+	return nil
+}
+
+// CheckFreeze returns a FrozenError when env is frozen at now.
+func CheckFreeze(ctx context.Context, client FreezeAPI, bucket, env string, now time.Time) (*Freeze, error) {
+	f, err := GetFreeze(ctx, client, bucket, env)
+	if err != nil {
+		return nil, err
+	}
+	if !f.Active(now) {
+		return nil, nil
+	}
+	return f, &FrozenError{Freeze: f}
+}
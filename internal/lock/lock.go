@@ -3,6 +3,7 @@ package lock
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -11,8 +12,12 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/smithy-go/middleware"
 	smithyhttp "github.com/aws/smithy-go/transport/http"
+
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/tenant"
 )
 
 const (
@@ -53,8 +58,11 @@ func (e *LockedError) ExitCode() int {
 type OrchestrationLock struct {
 	Bucket       string
 	Env          string
+	Workspace    string
+	Tenant       string
 	Owner        string
 	Command      string
+	CallerARN    string
 	TTL          time.Duration
 	PollInterval time.Duration
 	Client       S3API
@@ -65,7 +73,11 @@ type OrchestrationLock struct {
 
 // key returns the S3 key for the orchestration lock.
 func (l *OrchestrationLock) key() string {
-	return fmt.Sprintf("locks/%s/superplan-lock.json", l.Env)
+	env := tenant.Scope(l.Tenant, l.Env)
+	if l.Workspace != "" {
+		return fmt.Sprintf("locks/%s/workspaces/%s/superplan-lock.json", env, l.Workspace)
+	}
+	return fmt.Sprintf("locks/%s/superplan-lock.json", env)
 }
 
 // Acquire attempts to acquire the orchestration lock, optionally waiting or forcing
@@ -102,6 +114,9 @@ func (l *OrchestrationLock) Acquire(ctx context.Context, wait bool, force bool)
 	if l.Command != "" {
 		lockData["command"] = l.Command
 	}
+	if l.CallerARN != "" {
+		lockData["caller_arn"] = l.CallerARN
+	}
 
 	payload, _ := json.Marshal(lockData)
 	metadata := map[string]string{
@@ -111,6 +126,9 @@ func (l *OrchestrationLock) Acquire(ctx context.Context, wait bool, force bool)
 	if l.Command != "" {
 		metadata["command"] = l.Command
 	}
+	if l.CallerARN != "" {
+		metadata["caller-arn"] = l.CallerARN
+	}
 
 	for {
 		_, err := l.Client.PutObject(ctx, &s3.PutObjectInput{
@@ -123,7 +141,7 @@ func (l *OrchestrationLock) Acquire(ctx context.Context, wait bool, force bool)
 			o.APIOptions = append(o.APIOptions, ifNoneMatchOption("*"))
 		})
 		if err == nil {
-			fmt.Printf("Acquired orchestration lock for %s\n", l.Env)
+			output.Printf("Acquired orchestration lock for %s\n", l.Env)
 			l.locked = true
 			return nil
 		}
@@ -146,7 +164,7 @@ func (l *OrchestrationLock) Acquire(ctx context.Context, wait bool, force bool)
 		age := time.Since(createdAt)
 
 		if age > l.TTL {
-			fmt.Printf("Stale lock detected for %s (age %s) — releasing\n", l.Env, age.Round(time.Second))
+			output.Printf("Stale lock detected for %s (age %s) — releasing\n", l.Env, age.Round(time.Second))
 			_, _ = l.Client.DeleteObject(ctx, &s3.DeleteObjectInput{
 				Bucket: aws.String(l.Bucket),
 				Key:    aws.String(l.key()),
@@ -163,7 +181,7 @@ func (l *OrchestrationLock) Acquire(ctx context.Context, wait bool, force bool)
 		}
 
 		if wait {
-			fmt.Printf("Waiting for orchestration lock (held by %s since %s)\n", meta["owner"], createdAt.Format(time.RFC3339))
+			output.Printf("Waiting for orchestration lock (held by %s since %s)\n", meta["owner"], createdAt.Format(time.RFC3339))
 			select {
 			case <-time.After(l.PollInterval):
 				continue
@@ -199,10 +217,83 @@ func (l *OrchestrationLock) Release(ctx context.Context) error {
 	}
 
 	l.locked = false
-	fmt.Printf("Released orchestration lock for %s\n", l.Env)
+	output.Printf("Released orchestration lock for %s\n", l.Env)
+	return nil
+}
+
+// LockInfo describes the current holder of an orchestration lock.
+type LockInfo struct {
+	Env       string
+	Owner     string
+	Command   string
+	CallerARN string
+	Timestamp time.Time
+	// Stale reports whether the lock is older than the TTL, in which case the
+	// next Acquire releases it.
+	Stale bool
+}
+
+// Describe returns the current holder of the orchestration lock, or nil when
+// the environment is not locked.
+func (l *OrchestrationLock) Describe(ctx context.Context) (*LockInfo, error) {
+	if l.Client == nil {
+		return nil, fmt.Errorf("lock client must not be nil")
+	}
+	existing, err := l.Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(l.Bucket),
+		Key:    aws.String(l.key()),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to inspect orchestration lock: %w", err)
+	}
+
+	ttl := l.TTL
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	meta := normalizeMetadata(existing.Metadata)
+	createdAt, _ := time.Parse(time.RFC3339, meta["timestamp"])
+	return &LockInfo{
+		Env:       l.Env,
+		Owner:     meta["owner"],
+		Command:   meta["command"],
+		CallerARN: meta["caller-arn"],
+		Timestamp: createdAt,
+		Stale:     time.Since(createdAt) > ttl,
+	}, nil
+}
+
+// ForceRelease deletes the orchestration lock object whoever holds it. It is
+// meant for locks left behind by runs that were killed before releasing them.
+func (l *OrchestrationLock) ForceRelease(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.Client == nil {
+		return fmt.Errorf("lock client must not be nil")
+	}
+	_, err := l.Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(l.Bucket),
+		Key:    aws.String(l.key()),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to release orchestration lock: %w", err)
+	}
+	l.locked = false
 	return nil
 }
 
+func isNotFound(err error) bool {
+	var notFound *s3types.NotFound
+	if errors.As(err, &notFound) {
+		return true
+	}
+	return strings.Contains(strings.ToLower(err.Error()), "notfound")
+}
+
 func isPreconditionFailed(err error) bool {
 	if err == nil {
 		return false
@@ -1,6 +1,7 @@
 package lock_test
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/stretchr/testify/require"
 
 	"terraform-wrapper/internal/lock"
@@ -38,6 +40,33 @@ func TestAcquireReleaseLock(t *testing.T) {
 	require.False(t, s3stub.exists(lockKey(l.Env)))
 }
 
+func TestTenantLocksAreIndependent(t *testing.T) {
+	t.Parallel()
+
+	s3stub := newMemoryS3()
+	newLock := func(tenant string) *lock.OrchestrationLock {
+		return &lock.OrchestrationLock{
+			Bucket:  "test-bucket",
+			Env:     "dev",
+			Tenant:  tenant,
+			Owner:   "unit-test-" + tenant,
+			Command: "apply-all",
+			Client:  s3stub,
+			TTL:     time.Minute,
+		}
+	}
+
+	ctx := context.Background()
+	require.NoError(t, newLock("payments").Acquire(ctx, false, false))
+	require.NoError(t, newLock("search").Acquire(ctx, false, false))
+	require.True(t, s3stub.exists("locks/tenants/payments/dev/superplan-lock.json"))
+	require.True(t, s3stub.exists("locks/tenants/search/dev/superplan-lock.json"))
+	require.False(t, s3stub.exists(lockKey("dev")))
+
+	var locked *lock.LockedError
+	require.ErrorAs(t, newLock("payments").Acquire(ctx, false, false), &locked)
+}
+
 func TestAcquireWhileLockedReturnsError(t *testing.T) {
 	t.Parallel()
 
@@ -71,6 +100,39 @@ func TestAcquireWhileLockedReturnsError(t *testing.T) {
 	require.Equal(t, lock.LockedExitCode, lockedErr.ExitCode())
 }
 
+func TestFreezeLifecycle(t *testing.T) {
+	t.Parallel()
+
+	s3stub := newMemoryS3()
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	f, err := lock.CheckFreeze(ctx, s3stub, "test", "prod", now)
+	require.NoError(t, err)
+	require.Nil(t, f)
+
+	require.NoError(t, lock.SetFreeze(ctx, s3stub, "test", lock.Freeze{
+		Env:    "prod",
+		Until:  now.Add(24 * time.Hour),
+		Reason: "year-end",
+		Owner:  "release-manager",
+	}))
+
+	f, err = lock.CheckFreeze(ctx, s3stub, "test", "prod", now)
+	var frozen *lock.FrozenError
+	require.ErrorAs(t, err, &frozen)
+	require.Equal(t, "release-manager", f.Owner)
+	require.Contains(t, err.Error(), "year-end")
+	require.Equal(t, lock.LockedExitCode, frozen.ExitCode())
+
+	f, err = lock.CheckFreeze(ctx, s3stub, "test", "prod", now.Add(48*time.Hour))
+	require.NoError(t, err)
+	require.Nil(t, f)
+
+	require.NoError(t, lock.ClearFreeze(ctx, s3stub, "test", "prod"))
+	require.False(t, s3stub.exists("locks/prod/freeze.json"))
+}
+
 func TestAcquireWaitsUntilReleased(t *testing.T) {
 	t.Parallel()
 
@@ -122,6 +184,7 @@ func TestAcquireForceStaleLock(t *testing.T) {
 		Bucket:       "test",
 		Env:          "dev",
 		Client:       s3stub,
+		CallerARN:    "arn:aws:iam::123456789012:user/alice",
 		TTL:          30 * time.Minute,
 		PollInterval: 10 * time.Millisecond,
 	}
@@ -130,6 +193,46 @@ func TestAcquireForceStaleLock(t *testing.T) {
 	require.True(t, s3stub.exists(key))
 	meta := s3stub.metadata(key)
 	require.Equal(t, l.Owner, meta["owner"])
+	require.Equal(t, l.CallerARN, meta["caller-arn"])
+}
+
+func TestDescribeAndForceRelease(t *testing.T) {
+	t.Parallel()
+
+	s3stub := newMemoryS3()
+	l := &lock.OrchestrationLock{
+		Bucket: "test",
+		Env:    "dev",
+		Client: s3stub,
+		TTL:    30 * time.Minute,
+	}
+	ctx := context.Background()
+
+	info, err := l.Describe(ctx)
+	require.NoError(t, err)
+	require.Nil(t, info)
+
+	started := time.Now().UTC().Add(-2 * time.Hour).Truncate(time.Second)
+	s3stub.putExisting(lockKey("dev"), map[string]string{
+		"owner":      "killed-job",
+		"timestamp":  started.Format(time.RFC3339),
+		"command":    "apply-all",
+		"caller-arn": "arn:aws:sts::123456789012:assumed-role/ci-deploy/gh-1",
+	})
+
+	info, err = l.Describe(ctx)
+	require.NoError(t, err)
+	require.Equal(t, &lock.LockInfo{
+		Env:       "dev",
+		Owner:     "killed-job",
+		Command:   "apply-all",
+		CallerARN: "arn:aws:sts::123456789012:assumed-role/ci-deploy/gh-1",
+		Timestamp: started,
+		Stale:     true,
+	}, info)
+
+	require.NoError(t, l.ForceRelease(ctx))
+	require.False(t, s3stub.exists(lockKey("dev")))
 }
 
 // memoryS3 implements a minimal in-memory S3API for testing.
@@ -189,6 +292,20 @@ func (m *memoryS3) HeadObject(_ context.Context, params *s3.HeadObjectInput, _ .
 	}, nil
 }
 
+func (m *memoryS3) GetObject(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	obj, ok := m.objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &s3types.NoSuchKey{}
+	}
+
+	return &s3.GetObjectOutput{
+		Body: io.NopCloser(bytes.NewReader(obj.body)),
+	}, nil
+}
+
 func (m *memoryS3) DeleteObject(_ context.Context, params *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -0,0 +1,217 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log line.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// ParseLevel validates a --log-level value.
+func ParseLevel(s string) (Level, error) {
+	for level, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return level, nil
+		}
+	}
+	if strings.EqualFold(s, "warning") {
+		return LevelWarn, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q: expected debug, info, warn or error", s)
+}
+
+// Options configure a Logger.
+type Options struct {
+	// Level is the lowest level written to the console. Stack log files
+	// receive every level.
+	Level Level
+	// StackLogDir, when set, receives a <stack>.log file for every stack
+	// that logs, so the output of stacks running concurrently can be read
+	// apart afterwards.
+	StackLogDir string
+	// Stdout receives debug and info lines and Stderr warn and error lines;
+	// os.Stdout and os.Stderr at the time of writing when nil.
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// sink is the state shared by a Logger and its stack loggers.
+type sink struct {
+	mu    sync.Mutex
+	opts  Options
+	files map[string]*os.File
+}
+
+// Logger writes levelled lines to the console and, for a stack logger with
+// StackLogDir set, to the stack's log file.
+type Logger struct {
+	sink  *sink
+	stack string
+}
+
+// New returns a Logger for opts.
+func New(opts Options) *Logger {
+	return &Logger{sink: &sink{opts: opts, files: make(map[string]*os.File)}}
+}
+
+// Stack returns a logger that also writes to the log file of stack, named by
+// its path relative to the root.
+func (l *Logger) Stack(stack string) *Logger {
+	return &Logger{sink: l.sink, stack: stack}
+}
+
+func (l *Logger) Debugf(format string, args ...interface{}) { l.log(LevelDebug, true, format, args...) }
+func (l *Logger) Infof(format string, args ...interface{})  { l.log(LevelInfo, true, format, args...) }
+func (l *Logger) Warnf(format string, args ...interface{})  { l.log(LevelWarn, true, format, args...) }
+func (l *Logger) Errorf(format string, args ...interface{}) { l.log(LevelError, true, format, args...) }
+
+// Recordf writes an info line to the stack's log file only, for lines that
+// are already shown on the console some other way.
+func (l *Logger) Recordf(format string, args ...interface{}) {
+	l.log(LevelInfo, false, format, args...)
+}
+
+// Writer returns a writer appending raw output, such as terraform's, to the
+// stack's log file, or nil when the logger has no stack log file.
+func (l *Logger) Writer() io.Writer {
+	if l.stack == "" || l.sink.opts.StackLogDir == "" {
+		return nil
+	}
+	return stackWriter{l}
+}
+
+type stackWriter struct{ l *Logger }
+
+func (w stackWriter) Write(p []byte) (int, error) {
+	w.l.sink.mu.Lock()
+	defer w.l.sink.mu.Unlock()
+	f, err := w.l.sink.file(w.l.stack)
+	if err != nil {
+		return 0, err
+	}
+	return f.Write(p)
+}
+
+func (l *Logger) log(level Level, console bool, format string, args ...interface{}) {
+	msg := strings.TrimSuffix(fmt.Sprintf(format, args...), "\n")
+	s := l.sink
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if console && level >= s.opts.Level {
+		out := s.opts.Stdout
+		if out == nil {
+			out = os.Stdout
+		}
+		if level >= LevelWarn {
+			out = s.opts.Stderr
+			if out == nil {
+				out = os.Stderr
+			}
+		}
+		fmt.Fprintln(out, msg)
+	}
+
+	if l.stack == "" || s.opts.StackLogDir == "" {
+		return
+	}
+	f, err := s.file(l.stack)
+	if err != nil {
+		// The console line above is the record of last resort.
+		return
+	}
+	stamp := time.Now().UTC().Format(time.RFC3339)
+	for _, line := range strings.Split(msg, "\n") {
+		fmt.Fprintf(f, "%s %-5s %s\n", stamp, strings.ToUpper(level.String()), line)
+	}
+}
+
+// file opens the stack's log file for appending. Callers hold s.mu.
+func (s *sink) file(stack string) (*os.File, error) {
+	if f, ok := s.files[stack]; ok {
+		return f, nil
+	}
+	path := filepath.Join(s.opts.StackLogDir, filepath.FromSlash(stack)+".log")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create stack log directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open stack log: %w", err)
+	}
+	s.files[stack] = f
+	return f, nil
+}
+
+// Close closes the stack log files.
+func (l *Logger) Close() error {
+	s := l.sink
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var first error
+	for stack, f := range s.files {
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
+		delete(s.files, stack)
+	}
+	return first
+}
+
+var (
+	stdMu sync.RWMutex
+	std   = New(Options{Level: LevelInfo})
+)
+
+// Configure replaces the default logger used by the package-level functions.
+func Configure(opts Options) {
+	stdMu.Lock()
+	defer stdMu.Unlock()
+	_ = std.Close()
+	std = New(opts)
+}
+
+// Default returns the default logger.
+func Default() *Logger {
+	stdMu.RLock()
+	defer stdMu.RUnlock()
+	return std
+}
+
+// Stack returns the default logger for stack.
+func Stack(stack string) *Logger { return Default().Stack(stack) }
+
+func Debugf(format string, args ...interface{}) { Default().Debugf(format, args...) }
+func Infof(format string, args ...interface{})  { Default().Infof(format, args...) }
+func Warnf(format string, args ...interface{})  { Default().Warnf(format, args...) }
+func Errorf(format string, args ...interface{}) { Default().Errorf(format, args...) }
+
+// Close closes the default logger's stack log files.
+func Close() error { return Default().Close() }
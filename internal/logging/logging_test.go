@@ -0,0 +1,84 @@
+package logging_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/logging"
+)
+
+func TestLoggerFiltersConsoleByLevel(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	log := logging.New(logging.Options{Level: logging.LevelWarn, Stdout: &stdout, Stderr: &stderr})
+
+	log.Debugf("[x] debug")
+	log.Infof("[x] info %d\n", 1)
+	log.Warnf("[x] warn %d", 2)
+	log.Errorf("[x] error")
+
+	require.Empty(t, stdout.String())
+	require.Equal(t, "[x] warn 2\n[x] error\n", stderr.String())
+
+	stdout.Reset()
+	log = logging.New(logging.Options{Level: logging.LevelDebug, Stdout: &stdout, Stderr: &stderr})
+	log.Debugf("[x] debug")
+	log.Infof("[x] info")
+	require.Equal(t, "[x] debug\n[x] info\n", stdout.String())
+}
+
+func TestStackLoggerWritesStackLogFile(t *testing.T) {
+	dir := t.TempDir()
+	var stdout bytes.Buffer
+	log := logging.New(logging.Options{Level: logging.LevelInfo, StackLogDir: dir, Stdout: &stdout, Stderr: &stdout})
+	t.Cleanup(func() { require.NoError(t, log.Close()) })
+
+	network := log.Stack("core-services/network")
+	network.Debugf("refreshing %d resources", 3)
+	network.Infof("planned\nwith two lines")
+	network.Recordf("[run] started")
+	_, err := fmt.Fprint(network.Writer(), "Plan: 1 to add, 0 to change, 0 to destroy.\n")
+	require.NoError(t, err)
+	log.Stack("core-services/ecs").Warnf("throttled")
+	log.Infof("not written to any stack log")
+
+	require.Equal(t, "planned\nwith two lines\nthrottled\nnot written to any stack log\n", stdout.String())
+	require.NoError(t, log.Close())
+
+	data, err := os.ReadFile(filepath.Join(dir, "core-services", "network.log"))
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	require.Len(t, lines, 5)
+	require.Contains(t, lines[0], " DEBUG refreshing 3 resources")
+	require.Contains(t, lines[1], " INFO  planned")
+	require.Contains(t, lines[2], " INFO  with two lines")
+	require.Contains(t, lines[3], " INFO  [run] started")
+	require.Equal(t, "Plan: 1 to add, 0 to change, 0 to destroy.", lines[4])
+
+	data, err = os.ReadFile(filepath.Join(dir, "core-services", "ecs.log"))
+	require.NoError(t, err)
+	require.Contains(t, string(data), " WARN  throttled")
+
+	require.Nil(t, logging.New(logging.Options{}).Stack("core-services/network").Writer())
+}
+
+func TestParseLevel(t *testing.T) {
+	for input, want := range map[string]logging.Level{
+		"debug":   logging.LevelDebug,
+		"INFO":    logging.LevelInfo,
+		"warn":    logging.LevelWarn,
+		"warning": logging.LevelWarn,
+		"error":   logging.LevelError,
+	} {
+		got, err := logging.ParseLevel(input)
+		require.NoError(t, err, input)
+		require.Equal(t, want, got, input)
+	}
+	_, err := logging.ParseLevel("verbose")
+	require.ErrorContains(t, err, "unknown log level")
+}
@@ -0,0 +1,181 @@
+package manifest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// S3API captures the subset of S3 operations required to publish manifests.
+type S3API interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// Manifest records exactly which versions were deployed to an environment.
+type Manifest struct {
+	GeneratedAt      time.Time `json:"generated_at"`
+	Environment      string    `json:"environment"`
+	AccountID        string    `json:"account_id,omitempty"`
+	Region           string    `json:"region,omitempty"`
+	TerraformVersion string    `json:"terraform_version,omitempty"`
+	GitSHA           string    `json:"git_sha,omitempty"`
+	Stacks           []Stack   `json:"stacks"`
+}
+
+// Stack lists the provider and module versions a stack was applied with.
+type Stack struct {
+	Path      string            `json:"path"`
+	Providers map[string]string `json:"providers"`
+	Modules   []Module          `json:"modules"`
+}
+
+// Module is a module call resolved by terraform init.
+type Module struct {
+	Key     string `json:"key"`
+	Source  string `json:"source"`
+	Version string `json:"version,omitempty"`
+}
+
+// ForStack reads the provider lock file and the module manifest written by
+// terraform init in stackDir.
+func ForStack(stackDir, rel string) (Stack, error) {
+	providers, err := lockedProviders(filepath.Join(stackDir, ".terraform.lock.hcl"))
+	if err != nil {
+		return Stack{}, err
+	}
+	modules, err := installedModules(filepath.Join(stackDir, ".terraform", "modules", "modules.json"))
+	if err != nil {
+		return Stack{}, err
+	}
+	return Stack{Path: rel, Providers: providers, Modules: modules}, nil
+}
+
+func lockedProviders(path string) (map[string]string, error) {
+	providers := make(map[string]string)
+	src, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return providers, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	file, diags := hclparse.NewParser().ParseHCL(src, path)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("parse %s: %s", path, diags.Error())
+	}
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return providers, nil
+	}
+	for _, block := range body.Blocks {
+		if block.Type != "provider" || len(block.Labels) != 1 {
+			continue
+		}
+		attr, ok := block.Body.Attributes["version"]
+		if !ok {
+			continue
+		}
+		val, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() || val.Type() != cty.String {
+			continue
+		}
+		providers[block.Labels[0]] = val.AsString()
+	}
+	return providers, nil
+}
+
+func installedModules(path string) ([]Module, error) {
+	modules := []Module{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return modules, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	var doc struct {
+		Modules []Module `json:"Modules"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for _, m := range doc.Modules {
+		if m.Key == "" {
+			continue
+		}
+		modules = append(modules, m)
+	}
+	sort.Slice(modules, func(i, j int) bool { return modules[i].Key < modules[j].Key })
+	return modules, nil
+}
+
+// Dir returns where manifests for env are written under the output directory.
+func Dir(outputDir, env string) string {
+	return filepath.Join(outputDir, "manifests", env)
+}
+
+func fileName(ts time.Time) string {
+	return ts.UTC().Format("2006-01-02T15-04-05Z") + ".json"
+}
+
+// Write stores m as a timestamped manifest and as latest.json, returning the
+// timestamped path.
+func Write(outputDir string, m *Manifest) (string, error) {
+	dir := Dir(outputDir, m.Environment)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("create manifest directory: %w", err)
+	}
+	data, err := encode(m)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fileName(m.GeneratedAt))
+	for _, target := range []string{path, filepath.Join(dir, "latest.json")} {
+		if err := os.WriteFile(target, data, 0o644); err != nil {
+			return "", fmt.Errorf("write manifest: %w", err)
+		}
+	}
+	return path, nil
+}
+
+// Publish uploads m to manifests/<env>/ in bucket, alongside latest.json.
+func Publish(ctx context.Context, client S3API, bucket string, m *Manifest) error {
+	data, err := encode(m)
+	if err != nil {
+		return err
+	}
+	prefix := fmt.Sprintf("manifests/%s/", m.Environment)
+	for _, key := range []string{prefix + fileName(m.GeneratedAt), prefix + "latest.json"} {
+		_, err := client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(bucket),
+			Key:         aws.String(key),
+			Body:        strings.NewReader(string(data)),
+			ContentType: aws.String("application/json"),
+		})
+		if err != nil {
+			return fmt.Errorf("publish manifest %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func encode(m *Manifest) ([]byte, error) {
+	sort.Slice(m.Stacks, func(i, j int) bool { return m.Stacks[i].Path < m.Stacks[j].Path })
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal manifest: %w", err)
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,105 @@
+package manifest_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/manifest"
+)
+
+const lockFile = `# This file is maintained automatically by "terraform init".
+provider "registry.terraform.io/hashicorp/aws" {
+  version     = "5.31.0"
+  constraints = "~> 5.0"
+  hashes = [
+    "h1:abc=",
+  ]
+}
+
+provider "registry.terraform.io/hashicorp/random" {
+  version = "3.6.0"
+}
+`
+
+const modulesJSON = `{"Modules":[
+  {"Key":"","Source":"","Dir":"."},
+  {"Key":"vpc","Source":"registry.terraform.io/terraform-aws-modules/vpc/aws","Version":"5.1.0","Dir":".terraform/modules/vpc"},
+  {"Key":"labels","Source":"../modules/labels","Dir":"../modules/labels"}
+]}`
+
+type memoryS3 struct {
+	objects map[string]string
+}
+
+func (m *memoryS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.objects[aws.ToString(params.Key)] = string(data)
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestManifestRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	network := filepath.Join(root, "core-services", "network")
+	require.NoError(t, os.MkdirAll(filepath.Join(network, ".terraform", "modules"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(network, ".terraform.lock.hcl"), []byte(lockFile), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(network, ".terraform", "modules", "modules.json"), []byte(modulesJSON), 0o644))
+
+	dns := filepath.Join(root, "core-services", "dns")
+	require.NoError(t, os.MkdirAll(dns, 0o755))
+
+	networkStack, err := manifest.ForStack(network, "core-services/network")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"registry.terraform.io/hashicorp/aws":    "5.31.0",
+		"registry.terraform.io/hashicorp/random": "3.6.0",
+	}, networkStack.Providers)
+	require.Equal(t, []manifest.Module{
+		{Key: "labels", Source: "../modules/labels"},
+		{Key: "vpc", Source: "registry.terraform.io/terraform-aws-modules/vpc/aws", Version: "5.1.0"},
+	}, networkStack.Modules)
+
+	dnsStack, err := manifest.ForStack(dns, "core-services/dns")
+	require.NoError(t, err)
+	require.Empty(t, dnsStack.Providers)
+	require.Empty(t, dnsStack.Modules)
+
+	m := &manifest.Manifest{
+		GeneratedAt:      time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		Environment:      "prod",
+		TerraformVersion: "1.9.8",
+		GitSHA:           "abc123",
+		Stacks:           []manifest.Stack{networkStack, dnsStack},
+	}
+
+	out := t.TempDir()
+	path, err := manifest.Write(out, m)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(out, "manifests", "prod", "2025-01-02T03-04-05Z.json"), path)
+
+	latest, err := os.ReadFile(filepath.Join(manifest.Dir(out, "prod"), "latest.json"))
+	require.NoError(t, err)
+	var decoded manifest.Manifest
+	require.NoError(t, json.Unmarshal(latest, &decoded))
+	require.Equal(t, "abc123", decoded.GitSHA)
+	require.Equal(t, "core-services/dns", decoded.Stacks[0].Path)
+
+	client := &memoryS3{objects: map[string]string{}}
+	require.NoError(t, manifest.Publish(context.Background(), client, "state", m))
+	require.Contains(t, client.objects, "manifests/prod/latest.json")
+	require.Contains(t, client.objects, "manifests/prod/2025-01-02T03-04-05Z.json")
+	require.JSONEq(t, string(latest), client.objects["manifests/prod/latest.json"])
+}
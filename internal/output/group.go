@@ -0,0 +1,119 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Terraform output modes, selected with --output-mode.
+const (
+	// ModeStream streams terraform's output live, each line prefixed with
+	// its stack.
+	ModeStream = "stream"
+	// ModeGroup buffers each stack's output and prints it as one block when
+	// the stack finishes.
+	ModeGroup = "group"
+)
+
+// ParseMode validates an --output-mode value. The empty string keeps
+// terraform's output unprefixed and ungrouped.
+func ParseMode(s string) (string, error) {
+	switch s {
+	case "", ModeStream, ModeGroup:
+		return s, nil
+	default:
+		return "", fmt.Errorf("unsupported output mode %q (expected %s or %s)", s, ModeStream, ModeGroup)
+	}
+}
+
+// Group buffers the terraform output of each stack, so stacks running in
+// parallel print contiguous blocks instead of interleaved lines.
+type Group struct {
+	mu   sync.Mutex
+	bufs map[string]*bytes.Buffer
+	// out receives the flushed blocks; Progress at the time of flushing
+	// when nil.
+	out io.Writer
+}
+
+// NewGroup returns a Group flushing to Progress.
+func NewGroup() *Group {
+	return &Group{bufs: make(map[string]*bytes.Buffer)}
+}
+
+// NewGroupTo returns a Group flushing to w.
+func NewGroupTo(w io.Writer) *Group {
+	g := NewGroup()
+	g.out = w
+	return g
+}
+
+// Writer returns a writer buffering output of stack until Flush.
+func (g *Group) Writer(stack string) io.Writer {
+	return groupWriter{g: g, stack: stack}
+}
+
+type groupWriter struct {
+	g     *Group
+	stack string
+}
+
+func (w groupWriter) Write(data []byte) (int, error) {
+	w.g.mu.Lock()
+	defer w.g.mu.Unlock()
+	buf, ok := w.g.bufs[w.stack]
+	if !ok {
+		buf = &bytes.Buffer{}
+		w.g.bufs[w.stack] = buf
+	}
+	return buf.Write(data)
+}
+
+// Flush prints the output buffered for stack as one block under a header
+// naming the stack, and forgets it. Nothing is printed when the stack wrote
+// no output.
+func (g *Group) Flush(stack string) error {
+	g.mu.Lock()
+	buf := g.bufs[stack]
+	delete(g.bufs, stack)
+	g.mu.Unlock()
+	if buf == nil || buf.Len() == 0 {
+		return nil
+	}
+
+	var block bytes.Buffer
+	fmt.Fprintf(&block, "=== %s ===\n", stack)
+	block.Write(buf.Bytes())
+	if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		block.WriteByte('\n')
+	}
+	out := g.out
+	if out == nil {
+		out = Progress()
+	}
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	_, err := out.Write(block.Bytes())
+	return err
+}
+
+// FlushAll flushes the output still buffered for every stack, in stack
+// order.
+func (g *Group) FlushAll() error {
+	g.mu.Lock()
+	stacks := make([]string, 0, len(g.bufs))
+	for stack := range g.bufs {
+		stacks = append(stacks, stack)
+	}
+	g.mu.Unlock()
+	sort.Strings(stacks)
+	for _, stack := range stacks {
+		if err := g.Flush(stack); err != nil {
+			return err
+		}
+	}
+	return nil
+}
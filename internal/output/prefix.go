@@ -0,0 +1,65 @@
+package output
+
+import (
+	"bytes"
+	"hash/fnv"
+	"io"
+	"sync"
+)
+
+// stackColors are the ANSI foreground colours assigned to stack prefixes.
+// Red is left out so prefixes are not mistaken for errors.
+var stackColors = []string{"32", "33", "34", "35", "36", "92", "93", "94", "95", "96"}
+
+// writeMu serialises prefixed writes from concurrently running stacks so
+// their lines never interleave mid-line.
+var writeMu sync.Mutex
+
+// StackPrefix returns the "[stack] " prefix for a stack's output, coloured
+// with a colour derived from the stack name when color is set.
+func StackPrefix(stack string, color bool) []byte {
+	if !color {
+		return []byte("[" + stack + "] ")
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(stack))
+	code := stackColors[h.Sum32()%uint32(len(stackColors))]
+	return []byte("\x1b[" + code + "m[" + stack + "]\x1b[0m ")
+}
+
+// PrefixWriter writes every line it receives to an underlying writer with a
+// fixed prefix. Each Write is treated as ending a line, which matches how
+// terraform-exec forwards terraform's output one line at a time.
+type PrefixWriter struct {
+	w      io.Writer
+	prefix []byte
+}
+
+// NewPrefixWriter returns a PrefixWriter that prefixes lines written to w.
+func NewPrefixWriter(w io.Writer, prefix []byte) *PrefixWriter {
+	return &PrefixWriter{w: w, prefix: prefix}
+}
+
+func (p *PrefixWriter) Write(data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	var buf bytes.Buffer
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		buf.Write(p.prefix)
+		buf.Write(line)
+	}
+	if data[len(data)-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	if _, err := p.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
@@ -1,7 +1,9 @@
 package output
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"sync"
 	"time"
@@ -18,10 +20,94 @@ const (
 	StateSkipped   State = "skipped"
 )
 
+// Format selects how progress is rendered.
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatJSON Format = "json"
+)
+
+// ParseFormat validates a --output value.
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case "", FormatText:
+		return FormatText, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	default:
+		return "", fmt.Errorf("unsupported output format %q (expected text or json)", s)
+	}
+}
+
+// Event is a single machine-readable progress record, written as one line of
+// NDJSON in JSON mode.
+type Event struct {
+	Time            time.Time         `json:"time"`
+	Event           string            `json:"event"`
+	Stack           string            `json:"stack,omitempty"`
+	State           State             `json:"state,omitempty"`
+	Reason          string            `json:"reason,omitempty"`
+	Error           string            `json:"error,omitempty"`
+	DurationSeconds float64           `json:"duration_seconds,omitempty"`
+	Counts          map[string]int    `json:"counts,omitempty"`
+	Failed          map[string]string `json:"failed,omitempty"`
+}
+
+// WriteEvent encodes event as a single NDJSON line, stamping the time if unset.
+func WriteEvent(w io.Writer, event Event) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// progress is where human-readable progress goes instead of os.Stdout.
+var (
+	progressMu sync.Mutex
+	progress   io.Writer
+)
+
+// SetProgress sends human-readable progress, such as the wrapper's own
+// lines and terraform's output, to w, so stdout is left to the command's
+// results and --output json events. Nil restores os.Stdout.
+func SetProgress(w io.Writer) {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	progress = w
+}
+
+// Progress returns the writer set with SetProgress, or os.Stdout at the time
+// of the call.
+func Progress() io.Writer {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	if progress == nil {
+		return os.Stdout
+	}
+	return progress
+}
+
+// Printf writes a progress line to Progress, like fmt.Printf.
+func Printf(format string, args ...interface{}) {
+	_, _ = fmt.Fprintf(Progress(), format, args...)
+}
+
+// Println writes a progress line to Progress, like fmt.Println.
+func Println(args ...interface{}) {
+	_, _ = fmt.Fprintln(Progress(), args...)
+}
+
 type Manager struct {
 	mu     sync.Mutex
 	states map[string]State
 	start  map[string]time.Time
+	events io.Writer
 }
 
 func NewManager() *Manager {
@@ -31,6 +117,14 @@ func NewManager() *Manager {
 	}
 }
 
+// NewJSONManager returns a Manager that writes every stack event to w as NDJSON
+// instead of human-readable log lines.
+func NewJSONManager(w io.Writer) *Manager {
+	m := NewManager()
+	m.events = w
+	return m
+}
+
 func (m *Manager) Register(stack string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -41,9 +135,7 @@ func (m *Manager) Waiting(stack string, reason string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.states[stack] = StateWaiting
-	if _, err := fmt.Fprintf(os.Stdout, "[wait] %s (%s)\n", stack, reason); err != nil {
-		panic(fmt.Sprintf("progress.Waiting failed to write: %v", err)) //nolint:gocritic // writing to stdout should not fail; panic keeps tests obvious
-	}
+	m.emit(Event{Event: "wait", Stack: stack, State: StateWaiting, Reason: reason}, "[wait] %s (%s)\n", stack, reason)
 }
 
 func (m *Manager) Start(stack string) {
@@ -51,18 +143,22 @@ func (m *Manager) Start(stack string) {
 	defer m.mu.Unlock()
 	m.states[stack] = StateRunning
 	m.start[stack] = time.Now()
-	if _, err := fmt.Fprintf(os.Stdout, "[run] %s\n", stack); err != nil {
-		panic(fmt.Sprintf("progress.Start failed to write: %v", err)) //nolint:gocritic // writing to stdout should not fail; panic keeps tests obvious
-	}
+	m.emit(Event{Event: "start", Stack: stack, State: StateRunning}, "[run] %s\n", stack)
 }
 
 func (m *Manager) Skip(stack string, reason string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.states[stack] = StateSkipped
-	if _, err := fmt.Fprintf(os.Stdout, "[skip] %s (%s)\n", stack, reason); err != nil {
-		panic(fmt.Sprintf("progress.Skip failed to write: %v", err)) //nolint:gocritic // writing to stdout should not fail; panic keeps tests obvious
-	}
+	m.emit(Event{Event: "skip", Stack: stack, State: StateSkipped, Reason: reason}, "[skip] %s (%s)\n", stack, reason)
+}
+
+// CacheHit records a stack whose cached plan was reused.
+func (m *Manager) CacheHit(stack string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.states[stack] = StateSkipped
+	m.emit(Event{Event: "cache_hit", Stack: stack, State: StateSkipped, Reason: "cache hit"}, "[skip] %s (%s)\n", stack, "cache hit")
 }
 
 func (m *Manager) Succeed(stack string) {
@@ -70,9 +166,20 @@ func (m *Manager) Succeed(stack string) {
 	defer m.mu.Unlock()
 	m.states[stack] = StateSucceeded
 	dur := time.Since(m.start[stack])
-	if _, err := fmt.Fprintf(os.Stdout, "[done] %s (%.1fs)\n", stack, dur.Seconds()); err != nil {
-		panic(fmt.Sprintf("progress.Succeed failed to write: %v", err)) //nolint:gocritic // writing to stdout should not fail; panic keeps tests obvious
+	m.emit(Event{Event: "success", Stack: stack, State: StateSucceeded, DurationSeconds: dur.Seconds()}, "[done] %s (%.1fs)\n", stack, dur.Seconds())
+}
+
+// Planned records the resource changes of a stack's plan as soon as it is
+// written.
+func (m *Manager) Planned(stack string, adds, changes, destroys int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts := map[string]int{"add": adds, "change": changes, "destroy": destroys}
+	if adds+changes+destroys == 0 {
+		m.emit(Event{Event: "plan", Stack: stack, Counts: counts}, "[plan] %s: no changes\n", stack)
+		return
 	}
+	m.emit(Event{Event: "plan", Stack: stack, Counts: counts}, "[plan] %s: %d to add, %d to change, %d to destroy\n", stack, adds, changes, destroys)
 }
 
 func (m *Manager) Fail(stack string, err error) {
@@ -80,7 +187,18 @@ func (m *Manager) Fail(stack string, err error) {
 	defer m.mu.Unlock()
 	m.states[stack] = StateFailed
 	dur := time.Since(m.start[stack])
-	if _, writeErr := fmt.Fprintf(os.Stdout, "[fail] %s (%.1fs): %v\n", stack, dur.Seconds(), err); writeErr != nil {
-		panic(fmt.Sprintf("progress.Fail failed to write: %v", writeErr)) //nolint:gocritic
+	m.emit(Event{Event: "fail", Stack: stack, State: StateFailed, Error: err.Error(), DurationSeconds: dur.Seconds()}, "[fail] %s (%.1fs): %v\n", stack, dur.Seconds(), err)
+}
+
+// emit writes event in JSON mode or the formatted line otherwise. Callers hold m.mu.
+func (m *Manager) emit(event Event, format string, args ...interface{}) {
+	if m.events != nil {
+		if err := WriteEvent(m.events, event); err != nil {
+			panic(fmt.Sprintf("progress.%s failed to write: %v", event.Event, err)) //nolint:gocritic // writing events should not fail; panic keeps tests obvious
+		}
+		return
+	}
+	if _, err := fmt.Fprintf(Progress(), format, args...); err != nil {
+		panic(fmt.Sprintf("progress.%s failed to write: %v", event.Event, err)) //nolint:gocritic // writing to stdout should not fail; panic keeps tests obvious
 	}
 }
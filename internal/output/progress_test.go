@@ -2,9 +2,11 @@ package output
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"io"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -70,6 +72,26 @@ func TestManagerFail(t *testing.T) {
 	require.Contains(t, logs, "boom")
 }
 
+func TestManagerPlanned(t *testing.T) {
+	m := NewManager()
+	m.Register("stack")
+	logs := captureStdout(t, func() {
+		m.Planned("stack", 2, 1, 0)
+		m.Planned("other", 0, 0, 0)
+	})
+
+	require.Contains(t, logs, "[plan] stack: 2 to add, 1 to change, 0 to destroy")
+	require.Contains(t, logs, "[plan] other: no changes")
+
+	var buf bytes.Buffer
+	m = NewJSONManager(&buf)
+	m.Planned("stack", 2, 1, 0)
+	var event Event
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &event))
+	require.Equal(t, "plan", event.Event)
+	require.Equal(t, map[string]int{"add": 2, "change": 1, "destroy": 0}, event.Counts)
+}
+
 func runWithCapture(t *testing.T, fn func()) (time.Duration, string) {
 	t.Helper()
 
@@ -77,3 +99,114 @@ func runWithCapture(t *testing.T, fn func()) (time.Duration, string) {
 	logs := captureStdout(t, fn)
 	return time.Since(start), logs
 }
+
+func TestJSONManagerEmitsNDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewJSONManager(&buf)
+	m.Register("stack")
+
+	stdout := captureStdout(t, func() {
+		m.Waiting("stack", "deps")
+		m.Start("stack")
+		m.CacheHit("stack")
+		m.Succeed("stack")
+		m.Fail("stack", errors.New("boom"))
+	})
+	require.Empty(t, stdout)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 5)
+
+	var events []Event
+	for _, line := range lines {
+		var event Event
+		require.NoError(t, json.Unmarshal([]byte(line), &event))
+		require.Equal(t, "stack", event.Stack)
+		require.False(t, event.Time.IsZero())
+		events = append(events, event)
+	}
+	require.Equal(t, "wait", events[0].Event)
+	require.Equal(t, "deps", events[0].Reason)
+	require.Equal(t, "start", events[1].Event)
+	require.Equal(t, "cache_hit", events[2].Event)
+	require.Equal(t, "success", events[3].Event)
+	require.Equal(t, StateSucceeded, events[3].State)
+	require.Equal(t, "fail", events[4].Event)
+	require.Equal(t, "boom", events[4].Error)
+}
+
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat("")
+	require.NoError(t, err)
+	require.Equal(t, FormatText, format)
+
+	format, err = ParseFormat("json")
+	require.NoError(t, err)
+	require.Equal(t, FormatJSON, format)
+
+	_, err = ParseFormat("yaml")
+	require.Error(t, err)
+}
+
+func TestPrefixWriterPrefixesEveryLine(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewPrefixWriter(&buf, StackPrefix("core-services/network", false))
+
+	n, err := w.Write([]byte("Plan: 1 to add\nApply complete"))
+	require.NoError(t, err)
+	require.Equal(t, len("Plan: 1 to add\nApply complete"), n)
+	require.Equal(t, "[core-services/network] Plan: 1 to add\n[core-services/network] Apply complete\n", buf.String())
+
+	colored := string(StackPrefix("core-services/network", true))
+	require.Equal(t, colored, string(StackPrefix("core-services/network", true)), "a stack keeps its colour")
+	require.True(t, strings.HasPrefix(colored, "\x1b["))
+	require.Contains(t, colored, "[core-services/network]\x1b[0m ")
+}
+
+func TestGroupFlushesEachStackAsOneBlock(t *testing.T) {
+	var buf bytes.Buffer
+	group := NewGroupTo(&buf)
+	network := group.Writer("core-services/network")
+	ecs := group.Writer("core-services/ecs")
+
+	_, _ = network.Write([]byte("Initializing...\n"))
+	_, _ = ecs.Write([]byte("Initializing...\n"))
+	_, _ = network.Write([]byte("Plan: 1 to add, 0 to change, 0 to destroy."))
+	_, _ = ecs.Write([]byte("No changes.\n"))
+	require.Empty(t, buf.String())
+
+	require.NoError(t, group.Flush("core-services/network"))
+	require.NoError(t, group.Flush("core-services/network"))
+	require.Equal(t, "=== core-services/network ===\nInitializing...\nPlan: 1 to add, 0 to change, 0 to destroy.\n", buf.String())
+
+	buf.Reset()
+	_, _ = group.Writer("applications/web").Write([]byte("Apply complete!\n"))
+	require.NoError(t, group.FlushAll())
+	require.Equal(t, "=== applications/web ===\nApply complete!\n=== core-services/ecs ===\nInitializing...\nNo changes.\n", buf.String())
+}
+
+func TestParseMode(t *testing.T) {
+	for _, mode := range []string{"", ModeStream, ModeGroup} {
+		got, err := ParseMode(mode)
+		require.NoError(t, err)
+		require.Equal(t, mode, got)
+	}
+	_, err := ParseMode("buffered")
+	require.Error(t, err)
+}
+
+func TestSetProgressRedirectsProgressLines(t *testing.T) {
+	var buf bytes.Buffer
+	SetProgress(&buf)
+	defer SetProgress(nil)
+
+	stdout := captureStdout(t, func() {
+		Printf("[run] %s\n", "network")
+		Println("[run] done")
+	})
+	require.Empty(t, stdout)
+	require.Equal(t, "[run] network\n[run] done\n", buf.String())
+
+	SetProgress(nil)
+	require.Equal(t, os.Stdout, Progress())
+}
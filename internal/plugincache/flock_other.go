@@ -0,0 +1,15 @@
+//go:build !unix
+
+package plugincache
+
+import "os"
+
+// tryLock is unsupported outside Unix; inits are only serialised within the
+// process.
+func tryLock(file *os.File) (bool, error) {
+	return true, nil
+}
+
+func unlock(file *os.File) error {
+	return nil
+}
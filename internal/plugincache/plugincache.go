@@ -0,0 +1,117 @@
+// Package plugincache shares one provider plugin cache between the stacks
+// of a root, so parallel inits install each provider once rather than once
+// per stack.
+package plugincache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// EnvVar is the variable terraform reads the plugin cache directory from.
+const EnvVar = "TF_PLUGIN_CACHE_DIR"
+
+// pollInterval is how often a held lock file is retried.
+const pollInterval = 100 * time.Millisecond
+
+var (
+	mu       sync.Mutex
+	lockPath string
+	// slot serialises lock holders within the process; the lock file
+	// serialises them across processes.
+	slot = make(chan struct{}, 1)
+)
+
+// Dir is the shared plugin cache of the stacks under root. It is kept apart
+// from .terraform-wrapper/providers, where providers bump writes its reports.
+func Dir(root string) string {
+	return filepath.Join(root, ".terraform-wrapper", "plugin-cache")
+}
+
+// Options configure the plugin cache.
+type Options struct {
+	// Root is the stack root whose Dir is used unless TF_PLUGIN_CACHE_DIR
+	// is already set.
+	Root string
+	// Lock makes Lock serialise inits. Terraform does not guard the cache
+	// against concurrent writers, so inits installing the same provider at
+	// once can corrupt it.
+	Lock bool
+}
+
+// Setup creates the plugin cache and exports it as TF_PLUGIN_CACHE_DIR to
+// every terraform process started afterwards. A cache directory already set
+// in the environment is kept. It returns the cache directory.
+func Setup(opts Options) (string, error) {
+	dir := os.Getenv(EnvVar)
+	if dir == "" {
+		abs, err := filepath.Abs(Dir(opts.Root))
+		if err != nil {
+			return "", fmt.Errorf("resolve plugin cache: %w", err)
+		}
+		dir = abs
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("create plugin cache %s: %w", dir, err)
+	}
+	if err := os.Setenv(EnvVar, dir); err != nil {
+		return "", err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	lockPath = ""
+	if opts.Lock {
+		lockPath = filepath.Clean(dir) + ".lock"
+	}
+	return dir, nil
+}
+
+// Lock waits until no other init, in this process or another, holds the
+// plugin cache, and returns the function that releases it. Without
+// Options.Lock it returns at once.
+func Lock(ctx context.Context) (func(), error) {
+	mu.Lock()
+	path := lockPath
+	mu.Unlock()
+	if path == "" {
+		return func() {}, nil
+	}
+
+	select {
+	case slot <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		<-slot
+		return nil, fmt.Errorf("open plugin cache lock: %w", err)
+	}
+	for {
+		locked, err := tryLock(file)
+		if err != nil {
+			_ = file.Close()
+			<-slot
+			return nil, fmt.Errorf("lock plugin cache: %w", err)
+		}
+		if locked {
+			break
+		}
+		select {
+		case <-time.After(pollInterval):
+		case <-ctx.Done():
+			_ = file.Close()
+			<-slot
+			return nil, ctx.Err()
+		}
+	}
+	return func() {
+		_ = unlock(file)
+		_ = file.Close()
+		<-slot
+	}, nil
+}
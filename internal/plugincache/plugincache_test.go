@@ -0,0 +1,88 @@
+package plugincache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetupExportsSharedCache(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv(EnvVar, "")
+
+	dir, err := Setup(Options{Root: root})
+	require.NoError(t, err)
+	require.Equal(t, Dir(root), dir)
+	require.DirExists(t, dir)
+	require.Equal(t, dir, os.Getenv(EnvVar))
+
+	// A cache chosen by the caller is kept.
+	own := filepath.Join(t.TempDir(), "plugins")
+	t.Setenv(EnvVar, own)
+	dir, err = Setup(Options{Root: root})
+	require.NoError(t, err)
+	require.Equal(t, own, dir)
+	require.DirExists(t, own)
+}
+
+func TestLockSerialisesInits(t *testing.T) {
+	t.Setenv(EnvVar, filepath.Join(t.TempDir(), "plugins"))
+	ctx := context.Background()
+
+	dir, err := Setup(Options{Lock: false})
+	require.NoError(t, err)
+	release, err := Lock(ctx)
+	require.NoError(t, err)
+	release()
+	require.NoFileExists(t, dir+".lock", "without Options.Lock nothing is locked")
+
+	_, err = Setup(Options{Lock: true})
+	require.NoError(t, err)
+	t.Cleanup(func() { _, _ = Setup(Options{}) })
+
+	release, err = Lock(ctx)
+	require.NoError(t, err)
+	acquired := make(chan func())
+	go func() {
+		next, err := Lock(ctx)
+		if err == nil {
+			acquired <- next
+		}
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("second init acquired the held lock")
+	case <-time.After(3 * pollInterval):
+	}
+	release()
+	select {
+	case next := <-acquired:
+		next()
+	case <-time.After(5 * time.Second):
+		t.Fatal("second init never acquired the released lock")
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	// Another process holding the lock file blocks until the context ends.
+	other, err := os.OpenFile(dir+".lock", os.O_RDWR, 0o644)
+	require.NoError(t, err)
+	defer other.Close()
+	locked, err := tryLock(other)
+	require.NoError(t, err)
+	require.True(t, locked)
+	timeout, cancel := context.WithTimeout(ctx, 3*pollInterval)
+	defer cancel()
+	_, err = Lock(timeout)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.NoError(t, unlock(other))
+	release, err = Lock(ctx)
+	require.NoError(t, err)
+	release()
+}
@@ -0,0 +1,203 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"terraform-wrapper/internal/workdir"
+)
+
+// Levels of a finding. Deny findings block the apply; warn findings are only
+// printed.
+const (
+	LevelDeny = "deny"
+	LevelWarn = "warn"
+)
+
+// Finding is one message produced by a deny or warn rule.
+type Finding struct {
+	Level string
+	// Rule is the rule's package path and name, such as "terraform.s3.deny".
+	Rule string
+	// Resource is the resource address the rule reported, if any.
+	Resource string
+	Message  string
+}
+
+// Evaluator evaluates policies against a Terraform plan.
+type Evaluator interface {
+	// Evaluate returns the findings of every deny and warn rule for the JSON
+	// plan at planPath.
+	Evaluate(ctx context.Context, planPath string) ([]Finding, error)
+}
+
+// OPA evaluates the Rego policies in Dir with the opa CLI. Every deny and warn
+// rule, in any package, is evaluated with the plan JSON as input. A rule's
+// messages are either strings or objects with a msg and an optional resource
+// naming the offending address.
+type OPA struct {
+	// Binary is the opa executable; "opa" on PATH when empty.
+	Binary string
+	Dir    string
+}
+
+// Evaluate runs opa eval on the JSON plan at planPath.
+func (o *OPA) Evaluate(ctx context.Context, planPath string) ([]Finding, error) {
+	binary := o.Binary
+	if binary == "" {
+		binary = "opa"
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, binary, "eval", "--format", "json", "--data", o.Dir, "--input", planPath, "data")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("opa eval: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return ParseOPA(stdout.Bytes())
+}
+
+// opaOutput is the subset of opa eval --format json output the findings are
+// read from.
+type opaOutput struct {
+	Result []struct {
+		Expressions []struct {
+			Value interface{} `json:"value"`
+		} `json:"expressions"`
+	} `json:"result"`
+}
+
+// ParseOPA reads the findings from the output of opa eval --format json for
+// the query "data", sorted by rule, resource and message.
+func ParseOPA(data []byte) ([]Finding, error) {
+	var out opaOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("invalid opa output: %w", err)
+	}
+	var findings []Finding
+	for _, result := range out.Result {
+		for _, expr := range result.Expressions {
+			findings = collect(findings, nil, expr.Value)
+		}
+	}
+	sort.Slice(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+		if a.Resource != b.Resource {
+			return a.Resource < b.Resource
+		}
+		return a.Message < b.Message
+	})
+	return findings, nil
+}
+
+// collect walks the documents under path, turning the messages of deny and
+// warn rules into findings.
+func collect(findings []Finding, path []string, value interface{}) []Finding {
+	doc, ok := value.(map[string]interface{})
+	if !ok {
+		return findings
+	}
+	for name, child := range doc {
+		rulePath := append(append([]string(nil), path...), name)
+		messages, isSet := child.([]interface{})
+		if isSet && (name == LevelDeny || name == LevelWarn) {
+			rule := strings.Join(rulePath, ".")
+			for _, msg := range messages {
+				findings = append(findings, finding(name, rule, msg))
+			}
+			continue
+		}
+		findings = collect(findings, rulePath, child)
+	}
+	return findings
+}
+
+func finding(level, rule string, msg interface{}) Finding {
+	f := Finding{Level: level, Rule: rule}
+	switch m := msg.(type) {
+	case string:
+		f.Message = m
+	case map[string]interface{}:
+		f.Message, _ = m["msg"].(string)
+		f.Resource, _ = m["resource"].(string)
+		if f.Message == "" {
+			data, _ := json.Marshal(m)
+			f.Message = string(data)
+		}
+	default:
+		data, _ := json.Marshal(m)
+		f.Message = string(data)
+	}
+	return f
+}
+
+// Gate blocks applying plans that violate deny rules.
+type Gate struct {
+	Evaluator Evaluator
+	// Warnings receives the warn findings; stderr when nil.
+	Warnings io.Writer
+	// Workdir receives the plan JSON the policies are evaluated against.
+	Workdir *workdir.Workdir
+}
+
+// Check evaluates the policies against a stack's plan, prints its warnings
+// and fails with every deny finding.
+func (g *Gate) Check(ctx context.Context, stack string, plan *tfjson.Plan) error {
+	tmpDir, cleanup, err := g.Workdir.Sub("policy-" + stack)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	planPath := filepath.Join(tmpDir, "plan.json")
+	data, err := json.Marshal(plan)
+	if err != nil {
+		return fmt.Errorf("encode plan for policy evaluation: %w", err)
+	}
+	if err := os.WriteFile(planPath, data, 0o600); err != nil {
+		return fmt.Errorf("write plan for policy evaluation: %w", err)
+	}
+
+	findings, err := g.Evaluator.Evaluate(ctx, planPath)
+	if err != nil {
+		return fmt.Errorf("evaluate policies for %s: %w", stack, err)
+	}
+	warnings := g.Warnings
+	if warnings == nil {
+		warnings = os.Stderr
+	}
+	var denied []string
+	for _, f := range findings {
+		line := Describe(stack, f)
+		if f.Level == LevelDeny {
+			denied = append(denied, line)
+			continue
+		}
+		fmt.Fprintf(warnings, "[policy] warning: %s\n", line)
+	}
+	if len(denied) > 0 {
+		return fmt.Errorf("plan for %s violates %d policies:\n  %s", stack, len(denied), strings.Join(denied, "\n  "))
+	}
+	return nil
+}
+
+// Describe renders a finding as "stack resource: message (rule)".
+func Describe(stack string, f Finding) string {
+	target := stack
+	if f.Resource != "" {
+		target += " " + f.Resource
+	}
+	return fmt.Sprintf("%s: %s (%s)", target, f.Message, f.Rule)
+}
@@ -0,0 +1,74 @@
+package policy_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/policy"
+)
+
+func TestParseOPACollectsDenyAndWarnRules(t *testing.T) {
+	t.Parallel()
+
+	findings, err := policy.ParseOPA([]byte(`{
+  "result": [{
+    "expressions": [{
+      "value": {
+        "terraform": {
+          "s3": {
+            "deny": [{"msg": "bucket must be encrypted", "resource": "aws_s3_bucket.logs"}],
+            "warn": ["bucket has no lifecycle rules"]
+          },
+          "tags": {"deny": [], "required": ["owner"]}
+        },
+        "allowed_regions": ["eu-west-2"]
+      },
+      "text": "data"
+    }]
+  }]
+}`))
+	require.NoError(t, err)
+	require.Equal(t, []policy.Finding{
+		{Level: policy.LevelDeny, Rule: "terraform.s3.deny", Resource: "aws_s3_bucket.logs", Message: "bucket must be encrypted"},
+		{Level: policy.LevelWarn, Rule: "terraform.s3.warn", Message: "bucket has no lifecycle rules"},
+	}, findings)
+}
+
+func TestParseOPARejectsInvalidOutput(t *testing.T) {
+	t.Parallel()
+
+	_, err := policy.ParseOPA([]byte("not json"))
+	require.ErrorContains(t, err, "invalid opa output")
+}
+
+type fakeEvaluator struct {
+	findings []policy.Finding
+}
+
+func (f *fakeEvaluator) Evaluate(ctx context.Context, planPath string) ([]policy.Finding, error) {
+	return f.findings, nil
+}
+
+func TestGateBlocksDenyFindingsAndPrintsWarnings(t *testing.T) {
+	t.Parallel()
+
+	var warnings bytes.Buffer
+	gate := &policy.Gate{
+		Evaluator: &fakeEvaluator{findings: []policy.Finding{
+			{Level: policy.LevelDeny, Rule: "terraform.s3.deny", Resource: "aws_s3_bucket.logs", Message: "bucket must be encrypted"},
+			{Level: policy.LevelWarn, Rule: "terraform.s3.warn", Message: "bucket has no lifecycle rules"},
+		}},
+		Warnings: &warnings,
+	}
+
+	err := gate.Check(context.Background(), "core-services/logging", &tfjson.Plan{FormatVersion: "1.2"})
+	require.EqualError(t, err, "plan for core-services/logging violates 1 policies:\n  core-services/logging aws_s3_bucket.logs: bucket must be encrypted (terraform.s3.deny)")
+	require.Equal(t, "[policy] warning: core-services/logging: bucket has no lifecycle rules (terraform.s3.warn)\n", warnings.String())
+
+	gate.Evaluator = &fakeEvaluator{}
+	require.NoError(t, gate.Check(context.Background(), "core-services/logging", &tfjson.Plan{FormatVersion: "1.2"}))
+}
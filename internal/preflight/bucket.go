@@ -0,0 +1,50 @@
+package preflight
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// BucketAPI captures the S3 operation used to check that the state bucket
+// exists.
+type BucketAPI interface {
+	HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error)
+}
+
+// MissingBucketError reports that the environment's state bucket has not been
+// created, so no stack can initialise its backend.
+type MissingBucketError struct {
+	Bucket      string
+	Environment string
+}
+
+func (e *MissingBucketError) Error() string {
+	return fmt.Sprintf("state bucket %s does not exist; run `terraform-wrapper bootstrap --env %s` to create it before running stacks", e.Bucket, e.Environment)
+}
+
+// VerifyStateBucket checks that the state bucket exists and is readable with
+// the current credentials before any stack initialises against it, turning
+// the init failure every stack would report into one actionable error.
+func VerifyStateBucket(ctx context.Context, client BucketAPI, bucket, environment string) error {
+	if client == nil {
+		return fmt.Errorf("s3 client must not be nil")
+	}
+	if bucket == "" {
+		return fmt.Errorf("state bucket must not be empty")
+	}
+
+	_, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+	switch errorCode(err) {
+	case "":
+		return nil
+	case "NotFound", "NoSuchBucket":
+		return &MissingBucketError{Bucket: bucket, Environment: environment}
+	case "Forbidden", "AccessDenied":
+		return fmt.Errorf("state bucket %s is not accessible: it belongs to another account, or the credentials lack s3:ListBucket on it: %w", bucket, err)
+	default:
+		return fmt.Errorf("unable to check state bucket %s: %w", bucket, err)
+	}
+}
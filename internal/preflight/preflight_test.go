@@ -0,0 +1,77 @@
+package preflight_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/preflight"
+)
+
+type stubS3 struct {
+	err   error
+	calls int
+}
+
+func (s *stubS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	s.calls++
+	return &s3.PutObjectOutput{}, s.err
+}
+
+func TestVerifyReadOnlyAccessDenied(t *testing.T) {
+	t.Parallel()
+
+	client := &stubS3{err: &smithy.GenericAPIError{Code: "AccessDenied", Message: "denied"}}
+	require.NoError(t, preflight.VerifyReadOnly(context.Background(), client, "123-eu-west-2-state"))
+	require.Equal(t, 1, client.calls)
+}
+
+func TestVerifyReadOnlyDetectsWriteAccess(t *testing.T) {
+	t.Parallel()
+
+	for _, code := range []string{"PreconditionFailed", "NoSuchKey"} {
+		client := &stubS3{err: &smithy.GenericAPIError{Code: code}}
+		err := preflight.VerifyReadOnly(context.Background(), client, "bucket")
+
+		var writable *preflight.WritableError
+		require.ErrorAs(t, err, &writable, code)
+		require.Equal(t, "bucket", writable.Bucket)
+	}
+}
+
+func TestVerifyReadOnlyUnexpectedError(t *testing.T) {
+	t.Parallel()
+
+	client := &stubS3{err: errors.New("network unreachable")}
+	err := preflight.VerifyReadOnly(context.Background(), client, "bucket")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unable to verify")
+}
+
+type stubBuckets struct {
+	err error
+}
+
+func (s *stubBuckets) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	return &s3.HeadBucketOutput{}, s.err
+}
+
+func TestVerifyStateBucket(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	require.NoError(t, preflight.VerifyStateBucket(ctx, &stubBuckets{}, "123-eu-west-2-state", "dev"))
+
+	err := preflight.VerifyStateBucket(ctx, &stubBuckets{err: &smithy.GenericAPIError{Code: "NotFound"}}, "123-eu-west-2-state", "dev")
+	var missing *preflight.MissingBucketError
+	require.ErrorAs(t, err, &missing)
+	require.Contains(t, err.Error(), "terraform-wrapper bootstrap --env dev")
+
+	err = preflight.VerifyStateBucket(ctx, &stubBuckets{err: &smithy.GenericAPIError{Code: "Forbidden"}}, "123-eu-west-2-state", "dev")
+	require.ErrorContains(t, err, "not accessible")
+	require.False(t, errors.As(err, &missing))
+}
@@ -0,0 +1,91 @@
+package preflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// probeKey is never created: the probe write carries an If-Match header that
+// cannot be satisfied, so S3 only evaluates authorization and the precondition.
+const probeKey = ".terraform-wrapper/read-only-probe"
+
+// S3API captures the subset of S3 operations required by the preflight checks.
+type S3API interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// WritableError reports that credentials expected to be read-only can mutate state.
+type WritableError struct {
+	Bucket string
+}
+
+func (e *WritableError) Error() string {
+	return fmt.Sprintf("credentials are not read-only: write access to state bucket %s is permitted", e.Bucket)
+}
+
+// VerifyReadOnly asserts that the current credentials cannot write to the state
+// bucket by issuing a dry-run conditional write that S3 rejects before persisting.
+func VerifyReadOnly(ctx context.Context, client S3API, bucket string) error {
+	if client == nil {
+		return fmt.Errorf("s3 client must not be nil")
+	}
+	if bucket == "" {
+		return fmt.Errorf("state bucket must not be empty")
+	}
+
+	_, err := client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(probeKey),
+		Body:   strings.NewReader(""),
+	}, func(o *s3.Options) {
+		o.APIOptions = append(o.APIOptions, headerOption("If-Match", `"terraform-wrapper-read-only-probe"`))
+	})
+
+	switch errorCode(err) {
+	case "AccessDenied", "Forbidden", "AllAccessDisabled":
+		return nil
+	case "PreconditionFailed", "NoSuchKey", "":
+		return &WritableError{Bucket: bucket}
+	default:
+		return fmt.Errorf("unable to verify read-only access to %s: %w", bucket, err)
+	}
+}
+
+func errorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return "Unknown"
+}
+
+func headerOption(name, value string) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Serialize.Add(&headerMiddleware{name: name, value: value}, middleware.After)
+	}
+}
+
+type headerMiddleware struct {
+	name  string
+	value string
+}
+
+func (m *headerMiddleware) ID() string { return "PreflightHeader" + m.name }
+
+func (m *headerMiddleware) HandleSerialize(ctx context.Context, in middleware.SerializeInput, next middleware.SerializeHandler) (middleware.SerializeOutput, middleware.Metadata, error) {
+	if req, ok := in.Request.(*smithyhttp.Request); ok {
+		req.Header.Set(m.name, m.value)
+	}
+	return next.HandleSerialize(ctx, in)
+}
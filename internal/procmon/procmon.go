@@ -0,0 +1,183 @@
+package procmon
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultInterval is how often process usage is sampled.
+const DefaultInterval = time.Second
+
+// Usage is the resource consumption observed for one stack's processes.
+type Usage struct {
+	PeakRSSBytes uint64  `json:"peak_rss_bytes"`
+	CPUSeconds   float64 `json:"cpu_seconds"`
+}
+
+// LimitError reports that a stack's processes were killed for exceeding the
+// RSS limit.
+type LimitError struct {
+	Dir        string
+	RSSBytes   uint64
+	LimitBytes uint64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("terraform processes in %s used %s, exceeding --max-rss %s; killed", e.Dir, FormatBytes(e.RSSBytes), FormatBytes(e.LimitBytes))
+}
+
+// process is a single sample of a running process.
+type process struct {
+	PID        int
+	RSSBytes   uint64
+	CPUSeconds float64
+}
+
+// Monitor samples the descendant processes of this process whose working
+// directory is a stack directory, which is how Terraform and its provider
+// plugins run under terraform-exec.
+type Monitor struct {
+	dir      string
+	limit    uint64
+	interval time.Duration
+
+	mu       sync.Mutex
+	usage    Usage
+	cpuByPID map[int]float64
+	limitErr *LimitError
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Start begins sampling processes running in dir every interval. A non-zero
+// limit kills them once their combined RSS exceeds it. Sampling is a no-op on
+// platforms without process inspection support.
+func Start(dir string, limit uint64, interval time.Duration) *Monitor {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	m := &Monitor{
+		dir:      dir,
+		limit:    limit,
+		interval: interval,
+		cpuByPID: make(map[int]float64),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go m.run()
+	return m
+}
+
+// Stop ends sampling and returns the observed usage. The error is a
+// *LimitError when the processes were killed for exceeding the limit.
+func (m *Monitor) Stop() (Usage, error) {
+	close(m.stop)
+	<-m.done
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.limitErr != nil {
+		return m.usage, m.limitErr
+	}
+	return m.usage, nil
+}
+
+func (m *Monitor) run() {
+	defer close(m.done)
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		m.sample()
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Monitor) sample() {
+	procs, err := scan(m.dir)
+	if err != nil || len(procs) == 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var rss uint64
+	for _, p := range procs {
+		rss += p.RSSBytes
+		if p.CPUSeconds > m.cpuByPID[p.PID] {
+			m.cpuByPID[p.PID] = p.CPUSeconds
+		}
+	}
+	if rss > m.usage.PeakRSSBytes {
+		m.usage.PeakRSSBytes = rss
+	}
+	var cpu float64
+	for _, seconds := range m.cpuByPID {
+		cpu += seconds
+	}
+	m.usage.CPUSeconds = cpu
+
+	if m.limit > 0 && rss > m.limit && m.limitErr == nil {
+		m.limitErr = &LimitError{Dir: m.dir, RSSBytes: rss, LimitBytes: m.limit}
+		for _, p := range procs {
+			_ = kill(p.PID)
+		}
+	}
+}
+
+// FormatBytes renders n using binary units, e.g. 1.5GiB.
+func FormatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// ParseBytes parses a size such as 512M, 2GiB or 1073741824. Units are
+// binary (K=1024).
+func ParseBytes(s string) (uint64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	trimmed := strings.TrimSuffix(strings.TrimSuffix(s, "B"), "i")
+	multiplier := uint64(1)
+	if n := len(trimmed); n > 0 {
+		switch trimmed[n-1] {
+		case 'K', 'k':
+			multiplier = 1 << 10
+		case 'M', 'm':
+			multiplier = 1 << 20
+		case 'G', 'g':
+			multiplier = 1 << 30
+		case 'T', 't':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			trimmed = trimmed[:n-1]
+		}
+	}
+	value, err := strconv.ParseUint(trimmed, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: expected a number with an optional K, M, G or T suffix", s)
+	}
+	return value * multiplier, nil
+}
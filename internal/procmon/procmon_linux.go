@@ -0,0 +1,96 @@
+package procmon
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// clockTicks is USER_HZ, which is 100 on every supported Linux architecture.
+const clockTicks = 100
+
+type procStat struct {
+	ppid       int
+	cpuSeconds float64
+	rssBytes   uint64
+}
+
+// scan returns the descendants of this process whose working directory is dir.
+func scan(dir string) ([]process, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	stats := make(map[int]procStat, len(entries))
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		if st, ok := readStat(pid); ok {
+			stats[pid] = st
+		}
+	}
+
+	self := os.Getpid()
+	var out []process
+	for pid, st := range stats {
+		if pid == self || !descendsFrom(pid, self, stats) {
+			continue
+		}
+		cwd, err := os.Readlink(filepath.Join("/proc", strconv.Itoa(pid), "cwd"))
+		if err != nil || cwd != dir {
+			continue
+		}
+		out = append(out, process{PID: pid, RSSBytes: st.rssBytes, CPUSeconds: st.cpuSeconds})
+	}
+	return out, nil
+}
+
+func descendsFrom(pid, ancestor int, stats map[int]procStat) bool {
+	for i := 0; i < 64; i++ {
+		st, ok := stats[pid]
+		if !ok || st.ppid <= 1 {
+			return false
+		}
+		if st.ppid == ancestor {
+			return true
+		}
+		pid = st.ppid
+	}
+	return false
+}
+
+// readStat parses /proc/<pid>/stat. The command name may contain spaces, so
+// fields are counted from the closing parenthesis.
+func readStat(pid int) (procStat, bool) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return procStat{}, false
+	}
+	s := string(data)
+	end := strings.LastIndexByte(s, ')')
+	if end < 0 {
+		return procStat{}, false
+	}
+	// fields[0] is the state (field 3 in proc(5)).
+	fields := strings.Fields(s[end+1:])
+	if len(fields) < 22 {
+		return procStat{}, false
+	}
+	ppid, _ := strconv.Atoi(fields[1])
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	rssPages, _ := strconv.ParseUint(fields[21], 10, 64)
+	return procStat{
+		ppid:       ppid,
+		cpuSeconds: float64(utime+stime) / clockTicks,
+		rssBytes:   rssPages * uint64(os.Getpagesize()),
+	}, true
+}
+
+func kill(pid int) error {
+	return syscall.Kill(pid, syscall.SIGKILL)
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package procmon
+
+// scan is unsupported outside Linux; no usage is recorded.
+func scan(dir string) ([]process, error) {
+	return nil, nil
+}
+
+func kill(pid int) error {
+	return nil
+}
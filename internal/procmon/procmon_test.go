@@ -0,0 +1,53 @@
+package procmon_test
+
+import (
+	"errors"
+	"os/exec"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/procmon"
+)
+
+func TestParseAndFormatBytes(t *testing.T) {
+	for input, want := range map[string]uint64{
+		"":     0,
+		"1024": 1024,
+		"512M": 512 << 20,
+		"2GiB": 2 << 30,
+		"4g":   4 << 30,
+		"16Ki": 16 << 10,
+	} {
+		got, err := procmon.ParseBytes(input)
+		require.NoError(t, err, input)
+		require.Equal(t, want, got, input)
+	}
+	_, err := procmon.ParseBytes("lots")
+	require.Error(t, err)
+
+	require.Equal(t, "512B", procmon.FormatBytes(512))
+	require.Equal(t, "1.5GiB", procmon.FormatBytes(3<<29))
+}
+
+func TestMonitorKillsProcessesOverLimit(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("process sampling is only supported on Linux")
+	}
+	dir := t.TempDir()
+	cmd := exec.Command("sleep", "30")
+	cmd.Dir = dir
+	require.NoError(t, cmd.Start())
+
+	mon := procmon.Start(dir, 1, 10*time.Millisecond)
+	waitErr := cmd.Wait()
+	usage, err := mon.Stop()
+
+	require.Error(t, waitErr)
+	var limitErr *procmon.LimitError
+	require.True(t, errors.As(err, &limitErr))
+	require.Equal(t, uint64(1), limitErr.LimitBytes)
+	require.NotZero(t, usage.PeakRSSBytes)
+}
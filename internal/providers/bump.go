@@ -0,0 +1,175 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-version"
+)
+
+// ErrUnsupportedConstraint marks constraints that cannot be bumped mechanically,
+// such as ranges with several clauses.
+var ErrUnsupportedConstraint = errors.New("unsupported constraint")
+
+var constraintPattern = regexp.MustCompile(`^\s*(=|>=|~>)?\s*v?(\d+(?:\.\d+){0,2})\s*$`)
+
+// Bump is a proposed constraint change for one provider requirement.
+type Bump struct {
+	Requirement
+	To     string
+	Latest string
+}
+
+// NextConstraint returns the constraint that admits the newest available
+// release. Without allowMajor, releases outside the current major are ignored.
+// The operator and number of version segments of the original are preserved.
+func NextConstraint(constraint string, available []*version.Version, allowMajor bool) (string, *version.Version, error) {
+	m := constraintPattern.FindStringSubmatch(constraint)
+	if m == nil {
+		return "", nil, fmt.Errorf("%w %q", ErrUnsupportedConstraint, constraint)
+	}
+	op, literal := m[1], m[2]
+	current, err := version.NewVersion(literal)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w %q", ErrUnsupportedConstraint, constraint)
+	}
+
+	var latest *version.Version
+	for _, v := range available {
+		if v.Prerelease() != "" || v.LessThan(current) {
+			continue
+		}
+		if !allowMajor && v.Segments()[0] != current.Segments()[0] {
+			continue
+		}
+		if latest == nil || v.GreaterThan(latest) {
+			latest = v
+		}
+	}
+	if latest == nil {
+		return constraint, nil, nil
+	}
+
+	segments := strings.Count(literal, ".") + 1
+	parts := make([]string, segments)
+	for i := range parts {
+		parts[i] = strconv.Itoa(latest.Segments()[i])
+	}
+	next := strings.Join(parts, ".")
+	if op != "" {
+		next = op + " " + next
+	}
+	return next, latest, nil
+}
+
+// Propose looks up the latest releases for each requirement and returns the
+// constraints that would change. Requirements with unsupported constraints are
+// returned separately so callers can report them.
+func Propose(ctx context.Context, reqs []Requirement, registry Registry, allowMajor bool) ([]Bump, []Requirement, error) {
+	cache := make(map[string][]*version.Version)
+	var bumps []Bump
+	var skipped []Requirement
+	for _, req := range reqs {
+		available, ok := cache[req.Source]
+		if !ok {
+			versions, err := registry.Versions(ctx, req.Source)
+			if err != nil {
+				return nil, nil, err
+			}
+			cache[req.Source] = versions
+			available = versions
+		}
+
+		next, latest, err := NextConstraint(req.Constraint, available, allowMajor)
+		if errors.Is(err, ErrUnsupportedConstraint) {
+			skipped = append(skipped, req)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if latest == nil || next == req.Constraint {
+			continue
+		}
+		bumps = append(bumps, Bump{Requirement: req, To: next, Latest: latest.String()})
+	}
+	return bumps, skipped, nil
+}
+
+// ImpactedStacks returns the sorted, de-duplicated stack directories touched by bumps.
+func ImpactedStacks(bumps []Bump) []string {
+	seen := make(map[string]struct{})
+	var stacks []string
+	for _, b := range bumps {
+		if _, ok := seen[b.Stack]; ok {
+			continue
+		}
+		seen[b.Stack] = struct{}{}
+		stacks = append(stacks, b.Stack)
+	}
+	sort.Strings(stacks)
+	return stacks
+}
+
+// ReportDir returns where the bump summary and patch are written.
+func ReportDir(root string, ts time.Time) string {
+	return filepath.Join(root, ".terraform-wrapper", "providers", ts.UTC().Format("20060102T150405Z"))
+}
+
+// WriteReport writes summary.md describing the bumps and, when non-empty, the
+// git patch of the rewritten files.
+func WriteReport(dir, root string, bumps []Bump, planResults map[string]error, patch []byte) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create report directory: %w", err)
+	}
+
+	var b strings.Builder
+	b.WriteString("# Terraform provider bumps\n\n")
+	b.WriteString("| Stack | Provider | From | To | Latest |\n")
+	b.WriteString("|-------|----------|------|----|--------|\n")
+	for _, bump := range bumps {
+		fmt.Fprintf(&b, "| %s | %s | `%s` | `%s` | %s |\n", relPath(root, bump.Stack), bump.Source, bump.Constraint, bump.To, bump.Latest)
+	}
+
+	if len(planResults) > 0 {
+		b.WriteString("\n## Plans\n\n")
+		stacks := make([]string, 0, len(planResults))
+		for stack := range planResults {
+			stacks = append(stacks, stack)
+		}
+		sort.Strings(stacks)
+		for _, stack := range stacks {
+			status := "ok"
+			if err := planResults[stack]; err != nil {
+				status = "failed: " + err.Error()
+			}
+			fmt.Fprintf(&b, "- %s: %s\n", relPath(root, stack), status)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "summary.md"), []byte(b.String()), 0o644); err != nil {
+		return err
+	}
+	if len(patch) > 0 {
+		if err := os.WriteFile(filepath.Join(dir, "bump.patch"), patch, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func relPath(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
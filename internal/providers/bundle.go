@@ -0,0 +1,211 @@
+package providers
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// BundleManifest is the file at the root of a bundle listing its packages.
+const BundleManifest = "bundle.json"
+
+// Package is one provider release for one platform in a filesystem mirror.
+type Package struct {
+	Source   string `json:"source"`
+	Version  string `json:"version"`
+	Platform string `json:"platform"`
+}
+
+// MirrorPackages lists the packages of the filesystem mirror in dir, which
+// uses the packed layout written by terraform providers mirror:
+// <hostname>/<namespace>/<type>/terraform-provider-<type>_<version>_<os>_<arch>.zip.
+func MirrorPackages(dir string) ([]Package, error) {
+	var packages []Package
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(d.Name(), ".zip") {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if pkg, ok := parsePackage(filepath.ToSlash(rel)); ok {
+			packages = append(packages, pkg)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortPackages(packages)
+	return packages, nil
+}
+
+func parsePackage(rel string) (Package, bool) {
+	parts := strings.Split(rel, "/")
+	if len(parts) != 4 {
+		return Package{}, false
+	}
+	host, namespace, typ, file := parts[0], parts[1], parts[2], parts[3]
+	rest, ok := strings.CutPrefix(strings.TrimSuffix(file, ".zip"), "terraform-provider-"+typ+"_")
+	if !ok {
+		return Package{}, false
+	}
+	// <version>_<os>_<arch>; versions contain no underscores.
+	fields := strings.SplitN(rest, "_", 2)
+	if len(fields) != 2 {
+		return Package{}, false
+	}
+	source := path.Join(host, namespace, typ)
+	if host == "registry.terraform.io" {
+		source = path.Join(namespace, typ)
+	}
+	return Package{
+		Source:   source,
+		Version:  fields[0],
+		Platform: fields[1],
+	}, true
+}
+
+func sortPackages(packages []Package) {
+	sort.Slice(packages, func(i, j int) bool {
+		a, b := packages[i], packages[j]
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		if a.Version != b.Version {
+			return a.Version < b.Version
+		}
+		return a.Platform < b.Platform
+	})
+}
+
+// Pack writes the filesystem mirror in dir to w as a gzipped tarball, with a
+// manifest of its packages, and returns the packages.
+func Pack(dir string, w io.Writer) ([]Package, error) {
+	packages, err := MirrorPackages(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(packages) == 0 {
+		return nil, fmt.Errorf("no provider packages in %s", dir)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	manifest, err := json.MarshalIndent(packages, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: BundleManifest, Mode: 0o644, Size: int64(len(manifest))}); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return nil, err
+	}
+
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: filepath.ToSlash(rel), Mode: 0o644, Size: info.Size(), ModTime: info.ModTime()}); err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, f)
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("pack provider mirror: %w", err)
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return packages, nil
+}
+
+// Unpack extracts a bundle written by Pack into the filesystem mirror in dir,
+// alongside any packages already there, and returns the bundle's packages.
+func Unpack(r io.Reader, dir string) (packages []Package, err error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("read provider bundle: %w", err)
+	}
+	defer func() {
+		if cerr := gz.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("read provider bundle: %w", cerr)
+		}
+	}()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read provider bundle: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if hdr.Name == BundleManifest {
+			if err := json.NewDecoder(tr).Decode(&packages); err != nil {
+				return nil, fmt.Errorf("read provider bundle manifest: %w", err)
+			}
+			continue
+		}
+		name := path.Clean(hdr.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("provider bundle entry %q escapes the mirror", hdr.Name)
+		}
+		if err := extractFile(tr, filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+			return nil, err
+		}
+	}
+	if packages == nil {
+		return nil, fmt.Errorf("provider bundle has no %s", BundleManifest)
+	}
+	return packages, nil
+}
+
+func extractFile(r io.Reader, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("extract %s: %w", dest, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,168 @@
+package providers_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-version"
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/providers"
+)
+
+const versionsTF = `terraform {
+  required_version = ">= 1.5.0"
+
+  required_providers {
+    aws = {
+      source  = "registry.terraform.io/hashicorp/aws"
+      version = "~> 5.10"
+    }
+    random = {
+      source  = "hashicorp/random"
+      version = ">= 3.1.0, < 4.0.0"
+    }
+    null = {
+      source = "hashicorp/null"
+    }
+  }
+}
+`
+
+type stubRegistry map[string][]string
+
+func (s stubRegistry) Versions(ctx context.Context, source string) ([]*version.Version, error) {
+	var out []*version.Version
+	for _, raw := range s[source] {
+		out = append(out, version.Must(version.NewVersion(raw)))
+	}
+	return out, nil
+}
+
+func TestNextConstraint(t *testing.T) {
+	t.Parallel()
+
+	available := []*version.Version{
+		version.Must(version.NewVersion("5.9.0")),
+		version.Must(version.NewVersion("5.31.0")),
+		version.Must(version.NewVersion("6.0.0-beta1")),
+		version.Must(version.NewVersion("6.2.0")),
+	}
+
+	next, latest, err := providers.NextConstraint("~> 5.10", available, false)
+	require.NoError(t, err)
+	require.Equal(t, "~> 5.31", next)
+	require.Equal(t, "5.31.0", latest.String())
+
+	next, _, err = providers.NextConstraint(">= 5.10.1", available, true)
+	require.NoError(t, err)
+	require.Equal(t, ">= 6.2.0", next)
+
+	next, _, err = providers.NextConstraint("5.31.0", available, false)
+	require.NoError(t, err)
+	require.Equal(t, "5.31.0", next)
+
+	_, _, err = providers.NextConstraint(">= 3.1.0, < 4.0.0", available, false)
+	require.ErrorIs(t, err, providers.ErrUnsupportedConstraint)
+}
+
+func TestScanProposeAndRewrite(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	stack := filepath.Join(root, "core-services", "network")
+	require.NoError(t, os.MkdirAll(stack, 0o755))
+	path := filepath.Join(stack, "versions.tf")
+	require.NoError(t, os.WriteFile(path, []byte(versionsTF), 0o644))
+
+	reqs, err := providers.Scan(stack)
+	require.NoError(t, err)
+	require.Len(t, reqs, 2)
+	require.Equal(t, "hashicorp/aws", reqs[0].Source)
+	require.Equal(t, "~> 5.10", reqs[0].Constraint)
+
+	registry := stubRegistry{
+		"hashicorp/aws":    {"5.10.0", "5.31.0", "6.0.0"},
+		"hashicorp/random": {"3.6.0"},
+	}
+	bumps, skipped, err := providers.Propose(context.Background(), reqs, registry, false)
+	require.NoError(t, err)
+	require.Len(t, bumps, 1)
+	require.Equal(t, "~> 5.31", bumps[0].To)
+	require.Len(t, skipped, 1)
+	require.Equal(t, "random", skipped[0].Name)
+	require.Equal(t, []string{stack}, providers.ImpactedStacks(bumps))
+
+	require.NoError(t, providers.Rewrite(bumps))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `version = "~> 5.31"`)
+	require.Contains(t, string(data), `version = ">= 3.1.0, < 4.0.0"`)
+
+	dir := providers.ReportDir(root, time.Unix(0, 0))
+	require.NoError(t, providers.WriteReport(dir, root, bumps, map[string]error{stack: nil}, []byte("diff")))
+	summary, err := os.ReadFile(filepath.Join(dir, "summary.md"))
+	require.NoError(t, err)
+	require.Contains(t, string(summary), "| core-services/network | hashicorp/aws | `~> 5.10` | `~> 5.31` | 5.31.0 |")
+	require.FileExists(t, filepath.Join(dir, "bump.patch"))
+}
+
+func TestRegistryClientVersions(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/providers/hashicorp/aws/versions", r.URL.Path)
+		_, _ = w.Write([]byte(`{"versions":[{"version":"5.31.0"},{"version":"not-a-version"}]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	client := &providers.RegistryClient{BaseURL: server.URL + "/v1/providers/"}
+	versions, err := client.Versions(context.Background(), "hashicorp/aws")
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	require.Equal(t, "5.31.0", versions[0].String())
+}
+
+func TestBundlePackAndUnpack(t *testing.T) {
+	t.Parallel()
+
+	mirror := t.TempDir()
+	write := func(rel, content string) {
+		path := filepath.Join(mirror, filepath.FromSlash(rel))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	write("registry.terraform.io/hashicorp/aws/terraform-provider-aws_5.31.0_linux_amd64.zip", "aws")
+	write("registry.terraform.io/hashicorp/aws/5.31.0.json", "{}")
+	write("registry.terraform.io/hashicorp/aws/index.json", "{}")
+	write("example.com/acme/widgets/terraform-provider-widgets_1.2.0-beta.1_darwin_arm64.zip", "widgets")
+
+	var bundle bytes.Buffer
+	packages, err := providers.Pack(mirror, &bundle)
+	require.NoError(t, err)
+	expected := []providers.Package{
+		{Source: "example.com/acme/widgets", Version: "1.2.0-beta.1", Platform: "darwin_arm64"},
+		{Source: "hashicorp/aws", Version: "5.31.0", Platform: "linux_amd64"},
+	}
+	require.Equal(t, expected, packages)
+
+	target := t.TempDir()
+	imported, err := providers.Unpack(&bundle, target)
+	require.NoError(t, err)
+	require.Equal(t, expected, imported)
+	data, err := os.ReadFile(filepath.Join(target, "registry.terraform.io", "hashicorp", "aws", "terraform-provider-aws_5.31.0_linux_amd64.zip"))
+	require.NoError(t, err)
+	require.Equal(t, "aws", string(data))
+	listed, err := providers.MirrorPackages(target)
+	require.NoError(t, err)
+	require.Equal(t, expected, listed)
+
+	_, err = providers.Pack(t.TempDir(), &bytes.Buffer{})
+	require.ErrorContains(t, err, "no provider packages")
+}
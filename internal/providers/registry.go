@@ -0,0 +1,78 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-version"
+)
+
+const defaultRegistryURL = "https://registry.terraform.io/v1/providers/"
+
+// Registry lists the published versions of a provider source such as hashicorp/aws.
+type Registry interface {
+	Versions(ctx context.Context, source string) ([]*version.Version, error)
+}
+
+// RegistryClient queries the public Terraform registry protocol.
+type RegistryClient struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+type registryVersions struct {
+	Versions []struct {
+		Version string `json:"version"`
+	} `json:"versions"`
+}
+
+func (c *RegistryClient) Versions(ctx context.Context, source string) (versions []*version.Version, err error) {
+	base := c.BaseURL
+	if base == "" {
+		base = defaultRegistryURL
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 15 * time.Second}
+	}
+
+	url := strings.TrimSuffix(base, "/") + "/" + source + "/versions"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("build registry request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s versions: %w", source, err)
+	}
+	defer func() {
+		if cerr := resp.Body.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("close %s versions body: %w", source, cerr)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("fetch %s versions: unexpected status %s: %s", source, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var payload registryVersions
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("parse %s versions: %w", source, err)
+	}
+
+	versions = make([]*version.Version, 0, len(payload.Versions))
+	for _, entry := range payload.Versions {
+		v, err := version.NewVersion(entry.Version)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
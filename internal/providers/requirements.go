@@ -0,0 +1,149 @@
+package providers
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Requirement is a single required_providers entry with a version constraint.
+type Requirement struct {
+	Stack      string
+	File       string
+	Name       string
+	Source     string
+	Constraint string
+
+	start int
+	end   int
+}
+
+// Scan returns the version-constrained provider requirements declared in the
+// .tf files of stackDir. Entries without a version attribute are ignored.
+func Scan(stackDir string) ([]Requirement, error) {
+	var reqs []Requirement
+	err := filepath.WalkDir(stackDir, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if d.IsDir() {
+			if d.Name() == ".terraform" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".tf" {
+			return nil
+		}
+		found, err := scanFile(stackDir, path)
+		if err != nil {
+			return err
+		}
+		reqs = append(reqs, found...)
+		return nil
+	})
+	return reqs, err
+}
+
+func scanFile(stackDir, path string) ([]Requirement, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file, diags := hclsyntax.ParseConfig(data, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil, fmt.Errorf("%s: unexpected HCL body type %T", path, file.Body)
+	}
+
+	var reqs []Requirement
+	for _, block := range body.Blocks {
+		if block.Type != "terraform" || len(block.Labels) > 0 {
+			continue
+		}
+		for _, nested := range block.Body.Blocks {
+			if nested.Type != "required_providers" {
+				continue
+			}
+			for name, attr := range nested.Body.Attributes {
+				obj, ok := attr.Expr.(*hclsyntax.ObjectConsExpr)
+				if !ok {
+					continue
+				}
+				req := Requirement{Stack: stackDir, File: path, Name: name, Source: "hashicorp/" + name}
+				hasVersion := false
+				for _, item := range obj.Items {
+					key, diags := item.KeyExpr.Value(nil)
+					if diags.HasErrors() || key.Type() != cty.String {
+						continue
+					}
+					val, diags := item.ValueExpr.Value(nil)
+					if diags.HasErrors() || val.Type() != cty.String {
+						continue
+					}
+					switch key.AsString() {
+					case "source":
+						req.Source = normalizeSource(val.AsString())
+					case "version":
+						rng := item.ValueExpr.Range()
+						req.Constraint = strings.TrimSpace(val.AsString())
+						req.start, req.end = rng.Start.Byte, rng.End.Byte
+						hasVersion = true
+					}
+				}
+				if hasVersion {
+					reqs = append(reqs, req)
+				}
+			}
+		}
+	}
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].start < reqs[j].start })
+	return reqs, nil
+}
+
+// normalizeSource strips the default registry hostname from a provider source.
+func normalizeSource(source string) string {
+	parts := strings.Split(strings.TrimSpace(source), "/")
+	if len(parts) == 3 {
+		return parts[1] + "/" + parts[2]
+	}
+	return strings.Join(parts, "/")
+}
+
+// Rewrite replaces the version constraints of the given bumps in place,
+// preserving the surrounding formatting of each file.
+func Rewrite(bumps []Bump) error {
+	byFile := make(map[string][]Bump)
+	for _, b := range bumps {
+		byFile[b.File] = append(byFile[b.File], b)
+	}
+	for file, fileBumps := range byFile {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		sort.Slice(fileBumps, func(i, j int) bool { return fileBumps[i].start > fileBumps[j].start })
+		for _, b := range fileBumps {
+			if b.end > len(data) || b.start >= b.end {
+				return fmt.Errorf("%s: stale position for provider %s", file, b.Name)
+			}
+			replacement := []byte(strconv.Quote(b.To))
+			data = append(data[:b.start], append(replacement, data[b.end:]...)...)
+		}
+		if err := os.WriteFile(file, data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
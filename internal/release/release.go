@@ -0,0 +1,144 @@
+// Package release reads release manifests: curated lists of stacks, each
+// pinned to a git ref, that make up one release train of infrastructure
+// changes.
+package release
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest is a release manifest such as releases/2025-06.yaml:
+//
+//	name: 2025-06
+//	stacks:
+//	  - path: core-services/network
+//	    ref: v1.4.0
+//	  - path: applications/api
+//	    ref: 3f2c1ab
+type Manifest struct {
+	Name   string  `yaml:"name"`
+	Stacks []Stack `yaml:"stacks"`
+}
+
+// Stack is a stack of the release, as a slash-separated path relative to the
+// root, and the git ref its configuration is pinned to. A stack without a
+// ref runs as it is in the working tree.
+type Stack struct {
+	Path string `yaml:"path"`
+	Ref  string `yaml:"ref"`
+}
+
+// Pin is a stack whose ref was resolved to a commit.
+type Pin struct {
+	Stack
+	Commit string
+}
+
+// Load reads and validates the manifest at file.
+func Load(file string) (*Manifest, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read release manifest: %w", err)
+	}
+	var m Manifest
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&m); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parse release manifest %s: %w", file, err)
+	}
+	if len(m.Stacks) == 0 {
+		return nil, fmt.Errorf("release manifest %s lists no stacks", file)
+	}
+	seen := make(map[string]bool, len(m.Stacks))
+	for i, stack := range m.Stacks {
+		if stack.Path == "" {
+			return nil, fmt.Errorf("release manifest %s: stack %d has no path", file, i+1)
+		}
+		clean := path.Clean(stack.Path)
+		if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("release manifest %s: stack path %q must be relative to the root", file, stack.Path)
+		}
+		if seen[clean] {
+			return nil, fmt.Errorf("release manifest %s: stack %s is listed twice", file, clean)
+		}
+		seen[clean] = true
+		m.Stacks[i].Path = clean
+	}
+	return &m, nil
+}
+
+// Resolve resolves the ref of each stack of m to a commit of the repository
+// holding root.
+func Resolve(ctx context.Context, root string, m *Manifest) ([]Pin, error) {
+	pins := make([]Pin, 0, len(m.Stacks))
+	for _, stack := range m.Stacks {
+		pin := Pin{Stack: stack}
+		if stack.Ref != "" {
+			out, err := git(ctx, root, "rev-parse", "--verify", "--quiet", stack.Ref+"^{commit}")
+			if err != nil {
+				return nil, fmt.Errorf("stack %s: ref %s is not a commit: %w", stack.Path, stack.Ref, err)
+			}
+			pin.Commit = strings.TrimSpace(out)
+		}
+		pins = append(pins, pin)
+	}
+	return pins, nil
+}
+
+// Verify returns an error naming every pinned stack whose tracked files in
+// the working tree differ from its commit.
+func Verify(ctx context.Context, root string, pins []Pin) error {
+	var differ []string
+	for _, pin := range pins {
+		if pin.Commit == "" {
+			continue
+		}
+		out, err := git(ctx, root, "diff", "--name-only", pin.Commit, "--", pin.Path)
+		if err != nil {
+			return fmt.Errorf("compare stack %s with %s: %w", pin.Path, pin.Ref, err)
+		}
+		if strings.TrimSpace(out) != "" {
+			differ = append(differ, fmt.Sprintf("%s differs from %s", pin.Path, pin.Ref))
+		}
+	}
+	if len(differ) > 0 {
+		return fmt.Errorf("the working tree does not match the release manifest: %s", strings.Join(differ, "; "))
+	}
+	return nil
+}
+
+// Checkout replaces the tracked files of each pinned stack in the working
+// tree with those of its commit.
+func Checkout(ctx context.Context, root string, pins []Pin) error {
+	for _, pin := range pins {
+		if pin.Commit == "" {
+			continue
+		}
+		if _, err := git(ctx, root, "restore", "--source="+pin.Commit, "--worktree", "--", pin.Path); err != nil {
+			return fmt.Errorf("check out stack %s at %s: %w", pin.Path, pin.Ref, err)
+		}
+	}
+	return nil
+}
+
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
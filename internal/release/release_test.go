@@ -0,0 +1,102 @@
+package release_test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/release"
+)
+
+func write(t *testing.T, root, rel, content string) {
+	t.Helper()
+	path := filepath.Join(root, filepath.FromSlash(rel))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func git(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+}
+
+func TestLoadValidatesManifest(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	write(t, dir, "release.yaml", `name: 2025-06
+stacks:
+  - path: core/network/
+    ref: v1
+  - path: apps/web
+`)
+	m, err := release.Load(filepath.Join(dir, "release.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, &release.Manifest{Name: "2025-06", Stacks: []release.Stack{
+		{Path: "core/network", Ref: "v1"},
+		{Path: "apps/web"},
+	}}, m)
+
+	for name, content := range map[string]string{
+		"empty.yaml":   "",
+		"twice.yaml":   "stacks:\n  - path: apps/web\n  - path: apps/web/\n",
+		"outside.yaml": "stacks:\n  - path: ../other\n",
+		"unknown.yaml": "stacks:\n  - path: apps/web\n    branch: main\n",
+		"unnamed.yaml": "stacks:\n  - ref: v1\n",
+	} {
+		write(t, dir, name, content)
+		_, err := release.Load(filepath.Join(dir, name))
+		require.Error(t, err, name)
+	}
+}
+
+func TestVerifyAndCheckoutPinnedStacks(t *testing.T) {
+	t.Parallel()
+
+	repo := t.TempDir()
+	root := filepath.Join(repo, "infra")
+	write(t, root, "core/network/main.tf", "# network v1\n")
+	write(t, root, "apps/web/main.tf", "# web v1\n")
+	git(t, repo, "init", "-q", "-b", "main")
+	git(t, repo, "add", "-A")
+	git(t, repo, "commit", "-q", "-m", "v1")
+	git(t, repo, "tag", "v1")
+	write(t, root, "core/network/main.tf", "# network v2\n")
+	write(t, root, "core/network/extra.tf", "# added in v2\n")
+	write(t, root, "apps/web/main.tf", "# web v2\n")
+	git(t, repo, "add", "-A")
+	git(t, repo, "commit", "-q", "-m", "v2")
+
+	ctx := context.Background()
+	m := &release.Manifest{Stacks: []release.Stack{
+		{Path: "core/network", Ref: "v1"},
+		{Path: "apps/web"},
+	}}
+	pins, err := release.Resolve(ctx, root, m)
+	require.NoError(t, err)
+	require.Len(t, pins[0].Commit, 40)
+	require.Empty(t, pins[1].Commit)
+
+	err = release.Verify(ctx, root, pins)
+	require.ErrorContains(t, err, "core/network differs from v1")
+
+	require.NoError(t, release.Checkout(ctx, root, pins))
+	require.NoError(t, release.Verify(ctx, root, pins))
+	data, err := os.ReadFile(filepath.Join(root, "core", "network", "main.tf"))
+	require.NoError(t, err)
+	require.Equal(t, "# network v1\n", string(data))
+	require.NoFileExists(t, filepath.Join(root, "core", "network", "extra.tf"))
+	data, err = os.ReadFile(filepath.Join(root, "apps", "web", "main.tf"))
+	require.NoError(t, err)
+	require.Equal(t, "# web v2\n", string(data), "stacks without a ref are left alone")
+
+	_, err = release.Resolve(ctx, root, &release.Manifest{Stacks: []release.Stack{{Path: "apps/web", Ref: "missing"}}})
+	require.ErrorContains(t, err, "ref missing is not a commit")
+}
@@ -0,0 +1,128 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild"
+	cbtypes "github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+
+	"terraform-wrapper/internal/output"
+)
+
+// CodeBuildAPI captures the subset of CodeBuild operations required to run stacks as builds.
+type CodeBuildAPI interface {
+	StartBuild(ctx context.Context, params *codebuild.StartBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.StartBuildOutput, error)
+	BatchGetBuilds(ctx context.Context, params *codebuild.BatchGetBuildsInput, optFns ...func(*codebuild.Options)) (*codebuild.BatchGetBuildsOutput, error)
+	StopBuild(ctx context.Context, params *codebuild.StopBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.StopBuildOutput, error)
+}
+
+// CodeBuildConfig selects the project whose buildspec runs
+// `terraform-wrapper $TERRAFORM_WRAPPER_ARGS`.
+type CodeBuildConfig struct {
+	Project string `json:"project"`
+}
+
+// CodeBuildBackend runs each stack operation as a CodeBuild build.
+type CodeBuildBackend struct {
+	Config       CodeBuildConfig
+	CodeBuild    CodeBuildAPI
+	Logs         LogsAPI
+	PollInterval time.Duration
+}
+
+func (b *CodeBuildBackend) Name() string { return BackendCodeBuild }
+
+func (b *CodeBuildBackend) Run(ctx context.Context, job Job, logs io.Writer) (err error) {
+	if b.CodeBuild == nil {
+		return fmt.Errorf("codebuild client not configured")
+	}
+	if b.Config.Project == "" {
+		return fmt.Errorf("codebuild backend requires project")
+	}
+
+	input := &codebuild.StartBuildInput{
+		ProjectName:                  aws.String(b.Config.Project),
+		EnvironmentVariablesOverride: codeBuildEnvironment(job.Env()),
+	}
+	if job.Revision != "" {
+		input.SourceVersion = aws.String(job.Revision)
+	}
+
+	out, err := b.CodeBuild.StartBuild(ctx, input)
+	if err != nil {
+		return fmt.Errorf("start codebuild build for %s: %w", job.Stack, err)
+	}
+	if out.Build == nil {
+		return fmt.Errorf("start codebuild build for %s: no build started", job.Stack)
+	}
+	buildID := aws.ToString(out.Build.Id)
+	output.Printf("[remote] %s dispatched to codebuild build %s\n", job.Stack, buildID)
+
+	// A cancelled run must not leave the build applying on its own.
+	defer func() {
+		if err == nil || ctx.Err() == nil {
+			return
+		}
+		stopCtx, cancel := stopContext(ctx)
+		defer cancel()
+		if _, stopErr := b.CodeBuild.StopBuild(stopCtx, &codebuild.StopBuildInput{Id: aws.String(buildID)}); stopErr != nil {
+			err = fmt.Errorf("%w; stopping codebuild build %s failed, it may still be running: %v", err, buildID, stopErr)
+			return
+		}
+		output.Printf("[remote] %s: stopped codebuild build %s\n", job.Stack, buildID)
+	}()
+
+	tail := &logTail{client: b.Logs}
+	for {
+		if err := wait(ctx, b.PollInterval); err != nil {
+			return err
+		}
+
+		desc, err := b.CodeBuild.BatchGetBuilds(ctx, &codebuild.BatchGetBuildsInput{Ids: []string{buildID}})
+		if err != nil {
+			return fmt.Errorf("describe codebuild build %s: %w", buildID, err)
+		}
+		if len(desc.Builds) == 0 {
+			return fmt.Errorf("describe codebuild build %s: build not found", buildID)
+		}
+		build := desc.Builds[0]
+		if build.Logs != nil && tail.stream == "" {
+			tail.group = aws.ToString(build.Logs.GroupName)
+			tail.stream = aws.ToString(build.Logs.StreamName)
+		}
+		if err := tail.poll(ctx, logs); err != nil {
+			return err
+		}
+
+		if !build.BuildComplete {
+			continue
+		}
+		if build.BuildStatus == cbtypes.StatusTypeSucceeded {
+			return nil
+		}
+		return &ExitError{Backend: BackendCodeBuild, Stack: job.Stack, ID: buildID, Reason: string(build.BuildStatus)}
+	}
+}
+
+func codeBuildEnvironment(env map[string]string) []cbtypes.EnvironmentVariable {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	vars := make([]cbtypes.EnvironmentVariable, 0, len(keys))
+	for _, k := range keys {
+		vars = append(vars, cbtypes.EnvironmentVariable{
+			Name:  aws.String(k),
+			Value: aws.String(env[k]),
+			Type:  cbtypes.EnvironmentVariableTypePlaintext,
+		})
+	}
+	return vars
+}
@@ -0,0 +1,186 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+
+	"terraform-wrapper/internal/output"
+)
+
+// ECSAPI captures the subset of ECS operations required to run stacks as tasks.
+type ECSAPI interface {
+	RunTask(ctx context.Context, params *ecs.RunTaskInput, optFns ...func(*ecs.Options)) (*ecs.RunTaskOutput, error)
+	DescribeTasks(ctx context.Context, params *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error)
+	StopTask(ctx context.Context, params *ecs.StopTaskInput, optFns ...func(*ecs.Options)) (*ecs.StopTaskOutput, error)
+}
+
+// ECSConfig selects the Fargate task that runs terraform-wrapper remotely. The
+// task definition's container must use the awslogs driver with LogGroup and
+// LogStreamPrefix so output can be streamed back.
+type ECSConfig struct {
+	Cluster         string   `json:"cluster"`
+	TaskDefinition  string   `json:"task_definition"`
+	Container       string   `json:"container"`
+	Subnets         []string `json:"subnets"`
+	SecurityGroups  []string `json:"security_groups"`
+	AssignPublicIP  bool     `json:"assign_public_ip"`
+	LogGroup        string   `json:"log_group"`
+	LogStreamPrefix string   `json:"log_stream_prefix"`
+}
+
+// ECSBackend runs each stack operation as a one-off ECS task.
+type ECSBackend struct {
+	Config       ECSConfig
+	ECS          ECSAPI
+	Logs         LogsAPI
+	PollInterval time.Duration
+}
+
+func (b *ECSBackend) Name() string { return BackendECS }
+
+func (b *ECSBackend) Run(ctx context.Context, job Job, logs io.Writer) (err error) {
+	if b.ECS == nil {
+		return fmt.Errorf("ecs client not configured")
+	}
+	if b.Config.Cluster == "" || b.Config.TaskDefinition == "" || b.Config.Container == "" {
+		return fmt.Errorf("ecs backend requires cluster, task_definition and container")
+	}
+
+	assignIP := ecstypes.AssignPublicIpDisabled
+	if b.Config.AssignPublicIP {
+		assignIP = ecstypes.AssignPublicIpEnabled
+	}
+
+	out, err := b.ECS.RunTask(ctx, &ecs.RunTaskInput{
+		Cluster:        aws.String(b.Config.Cluster),
+		TaskDefinition: aws.String(b.Config.TaskDefinition),
+		LaunchType:     ecstypes.LaunchTypeFargate,
+		Count:          aws.Int32(1),
+		StartedBy:      aws.String("terraform-wrapper"),
+		NetworkConfiguration: &ecstypes.NetworkConfiguration{
+			AwsvpcConfiguration: &ecstypes.AwsVpcConfiguration{
+				Subnets:        b.Config.Subnets,
+				SecurityGroups: b.Config.SecurityGroups,
+				AssignPublicIp: assignIP,
+			},
+		},
+		Overrides: &ecstypes.TaskOverride{
+			ContainerOverrides: []ecstypes.ContainerOverride{{
+				Name:        aws.String(b.Config.Container),
+				Command:     job.Args(),
+				Environment: ecsEnvironment(job.Env()),
+			}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("run ecs task for %s: %w", job.Stack, err)
+	}
+	if len(out.Failures) > 0 {
+		f := out.Failures[0]
+		return fmt.Errorf("run ecs task for %s: %s %s", job.Stack, aws.ToString(f.Reason), aws.ToString(f.Detail))
+	}
+	if len(out.Tasks) == 0 {
+		return fmt.Errorf("run ecs task for %s: no task started", job.Stack)
+	}
+
+	taskArn := aws.ToString(out.Tasks[0].TaskArn)
+	taskID := path.Base(taskArn)
+	output.Printf("[remote] %s dispatched to ecs task %s\n", job.Stack, taskID)
+
+	// A cancelled run must not leave the task applying on its own.
+	defer func() {
+		if err == nil || ctx.Err() == nil {
+			return
+		}
+		stopCtx, cancel := stopContext(ctx)
+		defer cancel()
+		_, stopErr := b.ECS.StopTask(stopCtx, &ecs.StopTaskInput{
+			Cluster: aws.String(b.Config.Cluster),
+			Task:    aws.String(taskArn),
+			Reason:  aws.String("terraform-wrapper run cancelled"),
+		})
+		if stopErr != nil {
+			err = fmt.Errorf("%w; stopping ecs task %s failed, it may still be running: %v", err, taskID, stopErr)
+			return
+		}
+		output.Printf("[remote] %s: stopped ecs task %s\n", job.Stack, taskID)
+	}()
+
+	tail := &logTail{
+		client: b.Logs,
+		group:  b.Config.LogGroup,
+		stream: strings.Join([]string{b.Config.LogStreamPrefix, b.Config.Container, taskID}, "/"),
+	}
+
+	for {
+		if err := wait(ctx, b.PollInterval); err != nil {
+			return err
+		}
+		if err := tail.poll(ctx, logs); err != nil {
+			return err
+		}
+
+		desc, err := b.ECS.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+			Cluster: aws.String(b.Config.Cluster),
+			Tasks:   []string{taskArn},
+		})
+		if err != nil {
+			return fmt.Errorf("describe ecs task %s: %w", taskID, err)
+		}
+		if len(desc.Tasks) == 0 {
+			return fmt.Errorf("describe ecs task %s: task not found", taskID)
+		}
+		task := desc.Tasks[0]
+		if aws.ToString(task.LastStatus) != string(ecstypes.DesiredStatusStopped) {
+			continue
+		}
+
+		if err := tail.poll(ctx, logs); err != nil {
+			return err
+		}
+		return taskResult(task, b.Config.Container, job.Stack, taskID)
+	}
+}
+
+func taskResult(task ecstypes.Task, container, stack, taskID string) error {
+	for _, c := range task.Containers {
+		if aws.ToString(c.Name) != container {
+			continue
+		}
+		if c.ExitCode != nil && *c.ExitCode == 0 {
+			return nil
+		}
+		reason := aws.ToString(c.Reason)
+		if c.ExitCode != nil {
+			reason = strings.TrimSpace(fmt.Sprintf("exit code %d %s", *c.ExitCode, reason))
+		}
+		if reason == "" {
+			reason = aws.ToString(task.StoppedReason)
+		}
+		return &ExitError{Backend: BackendECS, Stack: stack, ID: taskID, Reason: reason}
+	}
+	return &ExitError{Backend: BackendECS, Stack: stack, ID: taskID, Reason: aws.ToString(task.StoppedReason)}
+}
+
+func ecsEnvironment(env map[string]string) []ecstypes.KeyValuePair {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]ecstypes.KeyValuePair, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, ecstypes.KeyValuePair{Name: aws.String(k), Value: aws.String(env[k])})
+	}
+	return pairs
+}
@@ -0,0 +1,64 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	cwltypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// LogsAPI captures the subset of CloudWatch Logs operations required to stream remote output.
+type LogsAPI interface {
+	GetLogEvents(ctx context.Context, params *cloudwatchlogs.GetLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.GetLogEventsOutput, error)
+}
+
+// logTail follows a CloudWatch log stream from the beginning.
+type logTail struct {
+	client LogsAPI
+	group  string
+	stream string
+	token  *string
+}
+
+// drain copies every event available so far to w.
+func (t *logTail) drain(ctx context.Context, w io.Writer) error {
+	if t.client == nil || t.group == "" || t.stream == "" {
+		return nil
+	}
+	for {
+		out, err := t.client.GetLogEvents(ctx, &cloudwatchlogs.GetLogEventsInput{
+			LogGroupName:  aws.String(t.group),
+			LogStreamName: aws.String(t.stream),
+			NextToken:     t.token,
+			StartFromHead: aws.Bool(true),
+		})
+		if err != nil {
+			var notFound *cwltypes.ResourceNotFoundException
+			if errors.As(err, &notFound) {
+				return errLogStreamPending
+			}
+			return fmt.Errorf("read remote logs %s/%s: %w", t.group, t.stream, err)
+		}
+		for _, event := range out.Events {
+			fmt.Fprintln(w, aws.ToString(event.Message))
+		}
+		next := out.NextForwardToken
+		if next == nil || aws.ToString(next) == aws.ToString(t.token) {
+			t.token = next
+			return nil
+		}
+		t.token = next
+	}
+}
+
+// poll drains the stream, tolerating streams that have not been created yet.
+func (t *logTail) poll(ctx context.Context, w io.Writer) error {
+	if err := t.drain(ctx, w); err != nil && !errors.Is(err, errLogStreamPending) {
+		return err
+	}
+	return nil
+}
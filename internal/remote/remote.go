@@ -0,0 +1,163 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	BackendLocal     = "local"
+	BackendECS       = "ecs"
+	BackendCodeBuild = "codebuild"
+)
+
+const defaultPollInterval = 10 * time.Second
+
+// stopTimeout bounds the request stopping a remote job after the run was
+// cancelled, which cannot use the cancelled context.
+const stopTimeout = 30 * time.Second
+
+// Backend dispatches a single-stack wrapper invocation to a remote runner and
+// streams its logs back while it executes.
+type Backend interface {
+	Name() string
+	Run(ctx context.Context, job Job, logs io.Writer) error
+}
+
+// Job describes one stack operation executed remotely. The remote runner
+// invokes terraform-wrapper with Args() against the checked out Revision.
+type Job struct {
+	Command          string
+	Stack            string
+	Environment      string
+	Profile          string
+	Workspace        string
+	AccountID        string
+	Region           string
+	TerraformVersion string
+	// Engine is the engine TerraformVersion belongs to, terraform when
+	// empty.
+	Engine   string
+	Revision string
+	// AssumeRoleARN and Tenant repeat the run's --assume-role-arn and
+	// --tenant, so the remote runner uses the same credentials and scope.
+	AssumeRoleARN string
+	Tenant        string
+	// Flags are extra arguments for Command, such as --destroy.
+	Flags []string
+	// RunFlags repeat the run's flags that change how a stack runs, such
+	// as --refresh=false and the retry settings.
+	RunFlags []string
+}
+
+// Args returns the terraform-wrapper arguments for the remote invocation.
+func (j Job) Args() []string {
+	args := []string{
+		j.Command,
+		"--stack", j.Stack,
+		"--env", j.Environment,
+		"--account-id", j.AccountID,
+		"--region", j.Region,
+	}
+	args = append(args, j.Flags...)
+	args = append(args, j.RunFlags...)
+	if j.Profile != "" {
+		args = append(args, "--profile", j.Profile)
+	}
+	if j.Workspace != "" {
+		args = append(args, "--workspace", j.Workspace)
+	}
+	if j.AssumeRoleARN != "" {
+		args = append(args, "--assume-role-arn", j.AssumeRoleARN)
+	}
+	if j.Tenant != "" {
+		args = append(args, "--tenant", j.Tenant)
+	}
+	if j.Engine != "" && j.Engine != "terraform" {
+		args = append(args, "--engine", j.Engine)
+	}
+	if j.TerraformVersion != "" {
+		args = append(args, "--terraform-version", j.TerraformVersion)
+	}
+	return args
+}
+
+// Env returns the environment variables passed to the remote runner.
+func (j Job) Env() map[string]string {
+	return map[string]string{
+		"TERRAFORM_WRAPPER_ARGS":     strings.Join(j.Args(), " "),
+		"TERRAFORM_WRAPPER_REVISION": j.Revision,
+	}
+}
+
+// ExitError reports a remote job that finished unsuccessfully.
+type ExitError struct {
+	Backend string
+	Stack   string
+	ID      string
+	Reason  string
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("remote %s job %s for %s failed: %s", e.Backend, e.ID, e.Stack, e.Reason)
+}
+
+// Config holds the settings for each remote backend, typically loaded from
+// remote-execution.json at the repository root.
+type Config struct {
+	ECS       *ECSConfig       `json:"ecs,omitempty"`
+	CodeBuild *CodeBuildConfig `json:"codebuild,omitempty"`
+}
+
+// LoadConfig reads backend settings from path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read remote execution config: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid JSON in %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// LogDir returns the directory holding the streamed logs of remote stack runs
+// for an environment.
+func LogDir(root, env string) string {
+	return filepath.Join(root, ".terraform-wrapper", "remote", env)
+}
+
+// LogPath returns where the streamed log of a remote stack run is kept locally.
+func LogPath(root, env, stackRel string) string {
+	return filepath.Join(LogDir(root, env), filepath.FromSlash(stackRel)+".log")
+}
+
+func wait(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// stopContext returns a short-lived context for stopping a remote job once
+// ctx, the run's context, is done.
+func stopContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), stopTimeout)
+}
+
+var errLogStreamPending = errors.New("log stream not yet available")
@@ -0,0 +1,267 @@
+package remote_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	cwltypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild"
+	cbtypes "github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/remote"
+)
+
+type stubECS struct {
+	runInput  *ecs.RunTaskInput
+	statuses  []string
+	exitCode  int32
+	describes int
+	// cancel, when set, cancels the run on the first describe.
+	cancel  context.CancelFunc
+	stopped []string
+}
+
+func (s *stubECS) RunTask(ctx context.Context, params *ecs.RunTaskInput, optFns ...func(*ecs.Options)) (*ecs.RunTaskOutput, error) {
+	s.runInput = params
+	return &ecs.RunTaskOutput{Tasks: []ecstypes.Task{{TaskArn: aws.String("arn:aws:ecs:eu-west-2:123:task/cluster/abc123")}}}, nil
+}
+
+func (s *stubECS) DescribeTasks(ctx context.Context, params *ecs.DescribeTasksInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTasksOutput, error) {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	status := s.statuses[s.describes]
+	s.describes++
+	task := ecstypes.Task{LastStatus: aws.String(status)}
+	if status == "STOPPED" {
+		task.Containers = []ecstypes.Container{{Name: aws.String("wrapper"), ExitCode: aws.Int32(s.exitCode)}}
+	}
+	return &ecs.DescribeTasksOutput{Tasks: []ecstypes.Task{task}}, nil
+}
+
+func (s *stubECS) StopTask(ctx context.Context, params *ecs.StopTaskInput, optFns ...func(*ecs.Options)) (*ecs.StopTaskOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.stopped = append(s.stopped, aws.ToString(params.Task))
+	return &ecs.StopTaskOutput{}, nil
+}
+
+type stubLogs struct {
+	streams map[string][]string
+	served  map[string]bool
+}
+
+func (s *stubLogs) GetLogEvents(ctx context.Context, params *cloudwatchlogs.GetLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.GetLogEventsOutput, error) {
+	stream := aws.ToString(params.LogStreamName)
+	messages, ok := s.streams[stream]
+	if !ok {
+		return nil, &cwltypes.ResourceNotFoundException{Message: aws.String("missing")}
+	}
+	if params.NextToken != nil || s.served[stream] {
+		return &cloudwatchlogs.GetLogEventsOutput{NextForwardToken: aws.String("end")}, nil
+	}
+	s.served[stream] = true
+	out := &cloudwatchlogs.GetLogEventsOutput{NextForwardToken: aws.String("end")}
+	for _, m := range messages {
+		out.Events = append(out.Events, cwltypes.OutputLogEvent{Message: aws.String(m)})
+	}
+	return out, nil
+}
+
+func testJob() remote.Job {
+	return remote.Job{
+		Command:     "apply",
+		Stack:       "core-services/network",
+		Environment: "prod",
+		AccountID:   "123456789012",
+		Region:      "eu-west-2",
+		Revision:    "deadbeef",
+	}
+}
+
+func TestECSBackendRunsTaskAndStreamsLogs(t *testing.T) {
+	t.Parallel()
+
+	client := &stubECS{statuses: []string{"PROVISIONING", "RUNNING", "STOPPED"}}
+	logs := &stubLogs{
+		streams: map[string][]string{"tf/wrapper/abc123": {"Apply complete!"}},
+		served:  map[string]bool{},
+	}
+	backend := &remote.ECSBackend{
+		Config: remote.ECSConfig{
+			Cluster:         "infra",
+			TaskDefinition:  "terraform-wrapper:3",
+			Container:       "wrapper",
+			Subnets:         []string{"subnet-1"},
+			LogGroup:        "/ecs/terraform-wrapper",
+			LogStreamPrefix: "tf",
+		},
+		ECS:          client,
+		Logs:         logs,
+		PollInterval: time.Millisecond,
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, backend.Run(context.Background(), testJob(), &buf))
+	require.Equal(t, "Apply complete!\n", buf.String())
+
+	override := client.runInput.Overrides.ContainerOverrides[0]
+	require.Equal(t, []string{
+		"apply", "--stack", "core-services/network", "--env", "prod",
+		"--account-id", "123456789012", "--region", "eu-west-2",
+	}, override.Command)
+	require.Equal(t, "TERRAFORM_WRAPPER_REVISION", aws.ToString(override.Environment[1].Name))
+	require.Equal(t, "deadbeef", aws.ToString(override.Environment[1].Value))
+}
+
+func TestECSBackendReportsExitCode(t *testing.T) {
+	t.Parallel()
+
+	backend := &remote.ECSBackend{
+		Config:       remote.ECSConfig{Cluster: "infra", TaskDefinition: "td", Container: "wrapper"},
+		ECS:          &stubECS{statuses: []string{"STOPPED"}, exitCode: 1},
+		PollInterval: time.Millisecond,
+	}
+
+	err := backend.Run(context.Background(), testJob(), &bytes.Buffer{})
+	var exitErr *remote.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	require.Equal(t, "abc123", exitErr.ID)
+	require.Contains(t, exitErr.Reason, "exit code 1")
+}
+
+func TestJobArgsForwardEngine(t *testing.T) {
+	t.Parallel()
+
+	job := testJob()
+	job.TerraformVersion = "1.8.2"
+	require.NotContains(t, job.Args(), "--engine")
+
+	job.Engine = "tofu"
+	args := job.Args()
+	require.Contains(t, strings.Join(args, " "), "--engine tofu --terraform-version 1.8.2")
+}
+
+func TestJobArgsForwardRoleAndTenant(t *testing.T) {
+	t.Parallel()
+
+	job := testJob()
+	job.AssumeRoleARN = "arn:aws:iam::123456789012:role/terraform-deploy"
+	job.Tenant = "acme"
+	args := strings.Join(job.Args(), " ")
+	require.Contains(t, args, "--assume-role-arn arn:aws:iam::123456789012:role/terraform-deploy")
+	require.Contains(t, args, "--tenant acme")
+}
+
+func TestJobArgsForwardRunFlags(t *testing.T) {
+	t.Parallel()
+
+	job := testJob()
+	job.Flags = []string{"--destroy"}
+	job.RunFlags = []string{"--refresh=false", "--lock-wait", "10m0s"}
+	args := strings.Join(job.Args(), " ")
+	require.Contains(t, args, "--destroy --refresh=false --lock-wait 10m0s")
+}
+
+type stubCodeBuild struct {
+	startInput *codebuild.StartBuildInput
+	polls      int
+	status     cbtypes.StatusType
+	// cancel, when set, cancels the run on the first poll.
+	cancel  context.CancelFunc
+	stopped []string
+}
+
+func (s *stubCodeBuild) StartBuild(ctx context.Context, params *codebuild.StartBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.StartBuildOutput, error) {
+	s.startInput = params
+	return &codebuild.StartBuildOutput{Build: &cbtypes.Build{Id: aws.String("tf:1")}}, nil
+}
+
+func (s *stubCodeBuild) BatchGetBuilds(ctx context.Context, params *codebuild.BatchGetBuildsInput, optFns ...func(*codebuild.Options)) (*codebuild.BatchGetBuildsOutput, error) {
+	s.polls++
+	if s.cancel != nil {
+		s.cancel()
+	}
+	build := cbtypes.Build{
+		Id:            aws.String("tf:1"),
+		BuildComplete: s.polls > 1,
+		Logs:          &cbtypes.LogsLocation{GroupName: aws.String("/codebuild/tf"), StreamName: aws.String("1")},
+	}
+	if s.polls > 1 {
+		build.BuildStatus = s.status
+	}
+	return &codebuild.BatchGetBuildsOutput{Builds: []cbtypes.Build{build}}, nil
+}
+
+func (s *stubCodeBuild) StopBuild(ctx context.Context, params *codebuild.StopBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.StopBuildOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.stopped = append(s.stopped, aws.ToString(params.Id))
+	return &codebuild.StopBuildOutput{}, nil
+}
+
+func TestECSBackendStopsTaskWhenCancelled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := &stubECS{statuses: []string{"RUNNING", "RUNNING"}, cancel: cancel}
+	backend := &remote.ECSBackend{
+		Config:       remote.ECSConfig{Cluster: "infra", TaskDefinition: "td", Container: "wrapper"},
+		ECS:          client,
+		PollInterval: time.Millisecond,
+	}
+
+	err := backend.Run(ctx, testJob(), &bytes.Buffer{})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, []string{"arn:aws:ecs:eu-west-2:123:task/cluster/abc123"}, client.stopped)
+}
+
+func TestCodeBuildBackendStopsBuildWhenCancelled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := &stubCodeBuild{cancel: cancel}
+	backend := &remote.CodeBuildBackend{
+		Config:       remote.CodeBuildConfig{Project: "terraform-wrapper"},
+		CodeBuild:    client,
+		Logs:         &stubLogs{streams: map[string][]string{}, served: map[string]bool{}},
+		PollInterval: time.Millisecond,
+	}
+
+	err := backend.Run(ctx, testJob(), &bytes.Buffer{})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, []string{"tf:1"}, client.stopped)
+}
+
+func TestCodeBuildBackend(t *testing.T) {
+	t.Parallel()
+
+	client := &stubCodeBuild{status: cbtypes.StatusTypeFailed}
+	logs := &stubLogs{streams: map[string][]string{"1": {"Error: boom"}}, served: map[string]bool{}}
+	backend := &remote.CodeBuildBackend{
+		Config:       remote.CodeBuildConfig{Project: "terraform-wrapper"},
+		CodeBuild:    client,
+		Logs:         logs,
+		PollInterval: time.Millisecond,
+	}
+
+	var buf bytes.Buffer
+	err := backend.Run(context.Background(), testJob(), &buf)
+	var exitErr *remote.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	require.Equal(t, "FAILED", exitErr.Reason)
+	require.Equal(t, "Error: boom\n", buf.String())
+	require.Equal(t, "deadbeef", aws.ToString(client.startInput.SourceVersion))
+}
@@ -0,0 +1,254 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// maxValueLength bounds how much of an attribute value is rendered inline.
+const maxValueLength = 200
+
+// Summary is the data rendered into the HTML superplan report.
+type Summary struct {
+	GeneratedAt       time.Time
+	Environment       string
+	AccountID         string
+	TerraformVersion  string
+	TotalStacks       int
+	StacksWithChanges int
+	Adds              int
+	Changes           int
+	Destroys          int
+	Stacks            []Stack
+	// SecurityFocus adds a section listing SecurityChanges ahead of the
+	// per-stack details.
+	SecurityFocus   bool
+	SecurityChanges []SecurityChange
+	// DependencyChanges lists dependencies.json edits implied by the stacks'
+	// terraform_remote_state data sources.
+	DependencyChanges []DependencyChange
+	// NetworkIssues lists CIDR overlaps and security group references that
+	// are inconsistent between stacks.
+	NetworkIssues []NetworkIssue
+}
+
+// NetworkIssue is an inconsistency between the network resources of stacks.
+type NetworkIssue struct {
+	Kind   string
+	Stacks []string
+	Detail string
+}
+
+// DependencyChange is a dependency a stack should add to or remove from its
+// dependencies.json.
+type DependencyChange struct {
+	Stack  string
+	Add    []string
+	Remove []string
+}
+
+// SecurityChange is a planned change to a security-relevant resource.
+type SecurityChange struct {
+	Stack    string
+	Address  string
+	Category string
+	Actions  []string
+}
+
+// Stack is one stack's section of the report.
+type Stack struct {
+	Name         string
+	Reason       string
+	Adds         int
+	Changes      int
+	Destroys     int
+	Dependencies []string
+	Dependents   []string
+	Resources    []Resource
+}
+
+// Resource is a planned resource change within a stack.
+type Resource struct {
+	Address    string
+	Actions    []string
+	Attributes []AttributeDiff
+}
+
+// AttributeDiff is a top-level attribute whose value changes.
+type AttributeDiff struct {
+	Name   string
+	Before string
+	After  string
+}
+
+// Diff returns the top-level attributes that differ between the before and
+// after values of change, sorted by name. Sensitive values are masked and
+// unknown values are shown as known after apply.
+func Diff(change *tfjson.Change) []AttributeDiff {
+	if change == nil {
+		return nil
+	}
+	before, _ := change.Before.(map[string]interface{})
+	after, _ := change.After.(map[string]interface{})
+
+	names := make(map[string]struct{}, len(before)+len(after))
+	for k := range before {
+		names[k] = struct{}{}
+	}
+	for k := range after {
+		names[k] = struct{}{}
+	}
+	unknown, _ := change.AfterUnknown.(map[string]interface{})
+	for k, v := range unknown {
+		if v == true {
+			names[k] = struct{}{}
+		}
+	}
+
+	var diffs []AttributeDiff
+	for name := range names {
+		isUnknown := unknown[name] == true
+		if !isUnknown && reflect.DeepEqual(before[name], after[name]) {
+			continue
+		}
+		diff := AttributeDiff{
+			Name:   name,
+			Before: formatValue(before[name], sensitive(change.BeforeSensitive, name)),
+			After:  formatValue(after[name], sensitive(change.AfterSensitive, name)),
+		}
+		if isUnknown {
+			diff.After = "(known after apply)"
+		}
+		diffs = append(diffs, diff)
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Name < diffs[j].Name })
+	return diffs
+}
+
+func sensitive(marks interface{}, name string) bool {
+	switch m := marks.(type) {
+	case bool:
+		return m
+	case map[string]interface{}:
+		v, ok := m[name].(bool)
+		return ok && v
+	}
+	return false
+}
+
+func formatValue(v interface{}, masked bool) string {
+	if masked {
+		return "(sensitive)"
+	}
+	if v == nil {
+		return "null"
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	s := string(data)
+	if len(s) > maxValueLength {
+		s = s[:maxValueLength] + "…"
+	}
+	return s
+}
+
+// WriteHTML renders summary to path as a self-contained HTML document.
+func WriteHTML(path string, summary Summary) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create HTML report: %w", err)
+	}
+	if err := RenderHTML(f, summary); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// RenderHTML writes summary as a self-contained HTML document with no external
+// assets.
+func RenderHTML(w io.Writer, summary Summary) error {
+	if err := page.Execute(w, summary); err != nil {
+		return fmt.Errorf("render HTML report: %w", err)
+	}
+	return nil
+}
+
+var page = template.Must(template.New("report").Funcs(template.FuncMap{
+	"join": func(items []string) string {
+		return strings.Join(items, ", ")
+	},
+	"anchor": func(stack string) string {
+		return "stack-" + template.URLQueryEscaper(stack)
+	},
+}).Parse(pageTemplate))
+
+const pageTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Superplan summary: {{.Environment}}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; margin: 2rem; color: #1f2328; }
+table { border-collapse: collapse; margin: 1rem 0; }
+th, td { border: 1px solid #d0d7de; padding: 0.3rem 0.6rem; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; }
+code, .value { font-family: ui-monospace, SFMono-Regular, Menlo, monospace; font-size: 0.85rem; word-break: break-all; }
+.add { color: #1a7f37; } .change { color: #9a6700; } .destroy { color: #cf222e; }
+.deps { color: #57606a; margin: 0.2rem 0; }
+section { border-top: 1px solid #d0d7de; margin-top: 1.5rem; }
+</style>
+</head>
+<body>
+<h1>Superplan summary: {{.Environment}}</h1>
+<p>Generated {{.GeneratedAt.Format "2006-01-02 15:04 MST"}}{{if .AccountID}} for account {{.AccountID}}{{end}}{{if .TerraformVersion}} with Terraform {{.TerraformVersion}}{{end}}.</p>
+<p>{{.StacksWithChanges}} of {{.TotalStacks}} stacks have changes:
+<span class="add">{{.Adds}} to add</span>,
+<span class="change">{{.Changes}} to change</span>,
+<span class="destroy">{{.Destroys}} to destroy</span>.</p>
+
+{{if .SecurityFocus}}<h2>Security-relevant changes</h2>
+{{if .SecurityChanges}}<table>
+<tr><th>Category</th><th>Stack</th><th>Actions</th><th>Resource</th></tr>
+{{range .SecurityChanges}}<tr><td>{{.Category}}</td><td><a href="#{{anchor .Stack}}">{{.Stack}}</a></td><td>{{join .Actions}}</td><td><code>{{.Address}}</code></td></tr>
+{{end}}</table>{{else}}<p>No security-relevant changes.</p>{{end}}
+{{end}}{{if .DependencyChanges}}<h2>Dependency changes</h2>
+<table>
+<tr><th>Stack</th><th>Add</th><th>Remove</th></tr>
+{{range .DependencyChanges}}<tr><td><a href="#{{anchor .Stack}}">{{.Stack}}</a></td><td class="add">{{join .Add}}</td><td class="destroy">{{join .Remove}}</td></tr>
+{{end}}</table>
+{{end}}{{if .NetworkIssues}}<h2>Cross-stack network issues</h2>
+<table>
+<tr><th>Kind</th><th>Stacks</th><th>Issue</th></tr>
+{{range .NetworkIssues}}<tr><td>{{.Kind}}</td><td>{{range $i, $s := .Stacks}}{{if $i}}, {{end}}<a href="#{{anchor $s}}">{{$s}}</a>{{end}}</td><td>{{.Detail}}</td></tr>
+{{end}}</table>
+{{end}}<table>
+<tr><th>Stack</th><th>Add</th><th>Change</th><th>Destroy</th><th>Reason</th></tr>
+{{range .Stacks}}<tr><td><a href="#{{anchor .Name}}">{{.Name}}</a></td><td class="add">{{.Adds}}</td><td class="change">{{.Changes}}</td><td class="destroy">{{.Destroys}}</td><td>{{.Reason}}</td></tr>
+{{end}}</table>
+
+{{range .Stacks}}<section id="{{anchor .Name}}">
+<h2>{{.Name}}</h2>
+{{if .Dependencies}}<p class="deps">{{join .Dependencies}} &rarr; <strong>{{.Name}}</strong></p>{{end}}
+{{if .Dependents}}<p class="deps"><strong>{{.Name}}</strong> &rarr; {{join .Dependents}}</p>{{end}}
+{{if .Resources}}{{range .Resources}}<h3><code>{{join .Actions}} {{.Address}}</code></h3>
+{{if .Attributes}}<table>
+<tr><th>Attribute</th><th>Before</th><th>After</th></tr>
+{{range .Attributes}}<tr><td><code>{{.Name}}</code></td><td class="value">{{.Before}}</td><td class="value">{{.After}}</td></tr>
+{{end}}</table>{{end}}
+{{end}}{{else}}<p>No resource changes.</p>{{end}}
+</section>
+{{end}}</body>
+</html>
+`
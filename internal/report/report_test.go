@@ -0,0 +1,63 @@
+package report_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/report"
+)
+
+func TestDiffMasksSensitiveAndUnknownValues(t *testing.T) {
+	diffs := report.Diff(&tfjson.Change{
+		Actions:         tfjson.Actions{tfjson.ActionUpdate},
+		Before:          map[string]interface{}{"name": "api", "size": float64(1), "password": "old"},
+		After:           map[string]interface{}{"name": "api", "size": float64(2), "password": "new"},
+		AfterUnknown:    map[string]interface{}{"arn": true},
+		BeforeSensitive: map[string]interface{}{"password": true},
+		AfterSensitive:  map[string]interface{}{"password": true},
+	})
+
+	require.Equal(t, []report.AttributeDiff{
+		{Name: "arn", Before: "null", After: "(known after apply)"},
+		{Name: "password", Before: "(sensitive)", After: "(sensitive)"},
+		{Name: "size", Before: "1", After: "2"},
+	}, diffs)
+}
+
+func TestRenderHTMLIsSelfContained(t *testing.T) {
+	var buf bytes.Buffer
+	err := report.RenderHTML(&buf, report.Summary{
+		GeneratedAt:       time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Environment:       "staging",
+		TotalStacks:       2,
+		StacksWithChanges: 1,
+		Adds:              1,
+		Stacks: []report.Stack{
+			{Name: "core/ecs", Reason: "dependency", Dependencies: []string{"core/network"}},
+			{
+				Name:       "core/network",
+				Reason:     "direct",
+				Adds:       1,
+				Dependents: []string{"core/ecs"},
+				Resources: []report.Resource{{
+					Address:    "aws_vpc.main",
+					Actions:    []string{"create"},
+					Attributes: []report.AttributeDiff{{Name: "cidr_block", Before: "null", After: `"10.0.0.0/16"`}},
+				}},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	html := buf.String()
+	require.Contains(t, html, "<h2>core/network</h2>")
+	require.Contains(t, html, "core/network &rarr; <strong>core/ecs</strong>")
+	require.Contains(t, html, "create aws_vpc.main")
+	require.Contains(t, html, "cidr_block")
+	require.NotContains(t, html, "<script src=")
+	require.NotContains(t, html, "<link ")
+}
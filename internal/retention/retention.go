@@ -0,0 +1,225 @@
+// Package retention bounds what runs leave under .terraform-wrapper: run
+// history, failure bundles, logs and cached plans, which otherwise grow
+// without limit on long-lived runners.
+package retention
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"terraform-wrapper/internal/cache"
+	"terraform-wrapper/internal/remote"
+	"terraform-wrapper/internal/runs"
+	"terraform-wrapper/internal/tenant"
+	"terraform-wrapper/internal/triage"
+)
+
+// Kinds of artifact.
+const (
+	KindRun     = "run"
+	KindFailure = "failure"
+	KindLog     = "log"
+	KindPlan    = "plan"
+)
+
+// Policy is how much of an environment's artifacts is kept.
+type Policy struct {
+	// KeepRuns is how many of the newest run records, failure bundles and
+	// run log directories are kept. Zero keeps them all.
+	KeepRuns int
+	// MaxAge removes artifacts last written longer ago than this. Zero keeps
+	// them however old they are.
+	MaxAge time.Duration
+}
+
+// Enabled reports whether the policy removes anything at all.
+func (p Policy) Enabled() bool {
+	return p.KeepRuns > 0 || p.MaxAge > 0
+}
+
+// Artifact is one file or directory the policy removes.
+type Artifact struct {
+	Kind     string
+	Path     string
+	Size     int64
+	Modified time.Time
+
+	entry *cache.Entry
+}
+
+// Expired returns the artifacts of the environment env of tenantName that
+// policy removes at now. Records of runs still in progress are never removed.
+func Expired(root, tenantName, env string, policy Policy, now time.Time) ([]Artifact, error) {
+	if !policy.Enabled() {
+		return nil, nil
+	}
+	var cutoff time.Time
+	if policy.MaxAge > 0 {
+		cutoff = now.Add(-policy.MaxAge)
+	}
+	scope := tenant.Scope(tenantName, env)
+
+	var expired []Artifact
+	records, err := runRecords(root, scope)
+	if err != nil {
+		return nil, err
+	}
+	expired = append(expired, policy.prune(records, cutoff)...)
+
+	bundles, err := runDirs(triage.BundleDir(root, scope), KindFailure)
+	if err != nil {
+		return nil, err
+	}
+	expired = append(expired, policy.prune(bundles, cutoff)...)
+
+	runLogs, err := runDirs(triage.LogDir(root, scope), KindLog)
+	if err != nil {
+		return nil, err
+	}
+	expired = append(expired, policy.prune(runLogs, cutoff)...)
+
+	if !cutoff.IsZero() {
+		logs, err := logFiles(remote.LogDir(root, scope))
+		if err != nil {
+			return nil, err
+		}
+		for _, log := range logs {
+			if log.Modified.Before(cutoff) {
+				expired = append(expired, log)
+			}
+		}
+
+		entries, err := cache.List(root, tenantName, env)
+		if err != nil {
+			return nil, err
+		}
+		for i := range entries {
+			entry := &entries[i]
+			if entry.Modified.Before(cutoff) {
+				expired = append(expired, Artifact{Kind: KindPlan, Path: entry.Dir, Size: entry.Size, Modified: entry.Modified, entry: entry})
+			}
+		}
+	}
+	return expired, nil
+}
+
+// prune keeps the newest KeepRuns of artifacts and returns the rest, along
+// with any of the kept ones written before cutoff.
+func (p Policy) prune(artifacts []Artifact, cutoff time.Time) []Artifact {
+	sort.SliceStable(artifacts, func(i, j int) bool { return artifacts[i].Modified.After(artifacts[j].Modified) })
+	var expired []Artifact
+	for i, artifact := range artifacts {
+		if (p.KeepRuns > 0 && i >= p.KeepRuns) || artifact.Modified.Before(cutoff) {
+			expired = append(expired, artifact)
+		}
+	}
+	return expired
+}
+
+// Remove deletes artifacts, along with the cache directories their plans
+// leave empty.
+func Remove(root string, artifacts []Artifact) error {
+	var entries []cache.Entry
+	for _, artifact := range artifacts {
+		if artifact.entry != nil {
+			entries = append(entries, *artifact.entry)
+			continue
+		}
+		if err := os.RemoveAll(artifact.Path); err != nil {
+			return fmt.Errorf("remove %s %s: %w", artifact.Kind, artifact.Path, err)
+		}
+	}
+	return cache.Remove(root, entries)
+}
+
+func runRecords(root, scope string) ([]Artifact, error) {
+	dir := runs.Dir(root, scope)
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read run records: %w", err)
+	}
+	var records []Artifact
+	for _, file := range files {
+		id, ok := strings.CutSuffix(file.Name(), ".json")
+		if !ok || file.IsDir() {
+			continue
+		}
+		rec, err := runs.Load(root, scope, id)
+		if err != nil {
+			return nil, err
+		}
+		if rec == nil || rec.Status == runs.StatusRunning {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, Artifact{Kind: KindRun, Path: filepath.Join(dir, file.Name()), Size: info.Size(), Modified: info.ModTime()})
+	}
+	return records, nil
+}
+
+// runDirs lists the directories one run each leaves in dir, such as failure
+// bundles and run logs, each dated by its newest file.
+func runDirs(dir, kind string) ([]Artifact, error) {
+	children, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", dir, err)
+	}
+	var artifacts []Artifact
+	for _, child := range children {
+		if !child.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, child.Name())
+		files, err := logFiles(path)
+		if err != nil {
+			return nil, err
+		}
+		artifact := Artifact{Kind: kind, Path: path}
+		for _, file := range files {
+			artifact.Size += file.Size
+			if file.Modified.After(artifact.Modified) {
+				artifact.Modified = file.Modified
+			}
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	return artifacts, nil
+}
+
+// logFiles lists the files below dir.
+func logFiles(dir string) ([]Artifact, error) {
+	var files []Artifact
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) && path == dir {
+			return fs.SkipAll
+		}
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, Artifact{Kind: KindLog, Path: path, Size: info.Size(), Modified: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list %s: %w", dir, err)
+	}
+	return files, nil
+}
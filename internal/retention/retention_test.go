@@ -0,0 +1,124 @@
+package retention_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/cache"
+	"terraform-wrapper/internal/remote"
+	"terraform-wrapper/internal/retention"
+	"terraform-wrapper/internal/runs"
+	"terraform-wrapper/internal/triage"
+)
+
+func writeAged(t *testing.T, path string, age time.Duration) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte("data"), 0o644))
+	modified := time.Now().Add(-age)
+	require.NoError(t, os.Chtimes(path, modified, modified))
+}
+
+func saveRun(t *testing.T, root, id, status string, age time.Duration) {
+	t.Helper()
+	require.NoError(t, runs.Save(root, &runs.Record{ID: id, Environment: "dev", Status: status}))
+	modified := time.Now().Add(-age)
+	require.NoError(t, os.Chtimes(runs.Path(root, "dev", id), modified, modified))
+}
+
+func kinds(artifacts []retention.Artifact) map[string][]string {
+	byKind := make(map[string][]string)
+	for _, artifact := range artifacts {
+		byKind[artifact.Kind] = append(byKind[artifact.Kind], filepath.Base(artifact.Path))
+	}
+	return byKind
+}
+
+func TestExpiredKeepsNewestRunsAndBundles(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	saveRun(t, root, "newest", runs.StatusSucceeded, time.Hour)
+	saveRun(t, root, "middle", runs.StatusFailed, 2*time.Hour)
+	saveRun(t, root, "oldest", runs.StatusSucceeded, 3*time.Hour)
+	saveRun(t, root, "running", runs.StatusRunning, 4*time.Hour)
+	bundles := triage.BundleDir(root, "dev")
+	writeAged(t, filepath.Join(bundles, "2026-01-02T00-00-00Z-apply-all", "failures.json"), time.Hour)
+	writeAged(t, filepath.Join(bundles, "2026-01-01T00-00-00Z-apply-all", "failures.json"), 2*time.Hour)
+	newLogs := triage.NewRunLogDir(root, "dev", time.Now().Add(-time.Hour))
+	oldLogs := triage.NewRunLogDir(root, "dev", time.Now().Add(-2*time.Hour))
+	writeAged(t, triage.LogPath(newLogs, "network"), time.Hour)
+	writeAged(t, triage.LogPath(oldLogs, "network"), 2*time.Hour)
+
+	expired, err := retention.Expired(root, "", "dev", retention.Policy{KeepRuns: 1}, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, map[string][]string{
+		retention.KindRun:     {"middle.json", "oldest.json"},
+		retention.KindFailure: {"2026-01-01T00-00-00Z-apply-all"},
+		retention.KindLog:     {filepath.Base(oldLogs)},
+	}, kinds(expired))
+
+	require.NoError(t, retention.Remove(root, expired))
+	rec, err := runs.Load(root, "dev", "oldest")
+	require.NoError(t, err)
+	require.Nil(t, rec)
+	rec, err = runs.Load(root, "dev", "running")
+	require.NoError(t, err)
+	require.NotNil(t, rec, "records of runs in progress are kept")
+	require.DirExists(t, filepath.Join(bundles, "2026-01-02T00-00-00Z-apply-all"))
+	require.DirExists(t, newLogs)
+	require.NoDirExists(t, oldLogs)
+}
+
+func TestExpiredRemovesArtifactsOlderThanMaxAge(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	saveRun(t, root, "recent", runs.StatusSucceeded, time.Hour)
+	saveRun(t, root, "stale", runs.StatusSucceeded, 48*time.Hour)
+	staleLogs := triage.NewRunLogDir(root, "dev", time.Now().Add(-48*time.Hour))
+	recentLogs := triage.NewRunLogDir(root, "dev", time.Now().Add(-time.Hour))
+	writeAged(t, triage.LogPath(staleLogs, "network"), 48*time.Hour)
+	writeAged(t, triage.LogPath(recentLogs, "dns"), time.Hour)
+	writeAged(t, remote.LogPath(root, "dev", "network"), 48*time.Hour)
+	planPath, hashPath := cache.PlanFiles(root, "dev", "", "network")
+	writeAged(t, planPath, 48*time.Hour)
+	writeAged(t, hashPath, 48*time.Hour)
+	planPath, _ = cache.PlanFiles(root, "dev", "", "dns")
+	writeAged(t, planPath, time.Hour)
+	// Other environments are left alone.
+	prodLogs := triage.NewRunLogDir(root, "prod", time.Now().Add(-48*time.Hour))
+	writeAged(t, triage.LogPath(prodLogs, "network"), 48*time.Hour)
+
+	expired, err := retention.Expired(root, "", "dev", retention.Policy{MaxAge: 24 * time.Hour}, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, map[string][]string{
+		retention.KindRun:  {"stale.json"},
+		retention.KindLog:  {filepath.Base(staleLogs), "network.log"},
+		retention.KindPlan: {"network"},
+	}, kinds(expired))
+
+	require.NoError(t, retention.Remove(root, expired))
+	entries, err := cache.List(root, "", "dev")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "dns", entries[0].Stack)
+	require.NoFileExists(t, remote.LogPath(root, "dev", "network"))
+	require.NoDirExists(t, staleLogs)
+	require.FileExists(t, triage.LogPath(recentLogs, "dns"))
+	require.FileExists(t, triage.LogPath(prodLogs, "network"))
+}
+
+func TestExpiredWithoutPolicyKeepsEverything(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	saveRun(t, root, "old", runs.StatusSucceeded, 365*24*time.Hour)
+	expired, err := retention.Expired(root, "", "dev", retention.Policy{}, time.Now())
+	require.NoError(t, err)
+	require.Empty(t, expired)
+}
@@ -0,0 +1,304 @@
+// Package rollback helps undo a partially failed apply. It compares the state
+// saved before the apply with the current state and pins the changed
+// resource arguments back to their prior values through a Terraform override
+// file, so a targeted plan restores them.
+package rollback
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/hashicorp/terraform-exec/tfexec"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// OverrideFileName is written to the stack while the rollback is planned and
+// applied, and removed afterwards.
+const OverrideFileName = "terraform-wrapper-rollback_override.tf"
+
+// Change restores the prior arguments of one resource.
+type Change struct {
+	Address    string                 `json:"address"`
+	Type       string                 `json:"type"`
+	Name       string                 `json:"name"`
+	Attributes map[string]interface{} `json:"attributes"`
+	// Skipped lists changed attributes that cannot be set from configuration:
+	// computed-only, sensitive or nested block values.
+	Skipped []string `json:"skipped,omitempty"`
+
+	types map[string]cty.Type
+}
+
+// Result describes what a rollback can and cannot restore.
+type Result struct {
+	Restore []Change `json:"restore"`
+	// Created lists resources the failed apply created. Rolling them back
+	// means destroying them, which is left to the operator.
+	Created []string `json:"created,omitempty"`
+	// Destroyed lists resources the failed apply destroyed; they cannot be
+	// restored from the backup.
+	Destroyed []string `json:"destroyed,omitempty"`
+	// Manual lists changed resources an override cannot target: resources in
+	// child modules or created with count or for_each.
+	Manual []string `json:"manual,omitempty"`
+}
+
+// Targets returns the addresses the rollback plan is limited to.
+func (r *Result) Targets() []string {
+	targets := make([]string, 0, len(r.Restore))
+	for _, c := range r.Restore {
+		targets = append(targets, c.Address)
+	}
+	return targets
+}
+
+// Analyze compares the pre-apply backup with the current state.
+func Analyze(backup, current *tfjson.State, schemas *tfjson.ProviderSchemas) *Result {
+	before := managedResources(backup)
+	after := managedResources(current)
+	result := &Result{}
+
+	for addr := range after {
+		if _, ok := before[addr]; !ok {
+			result.Created = append(result.Created, addr)
+		}
+	}
+	for addr, prior := range before {
+		now, ok := after[addr]
+		if !ok {
+			result.Destroyed = append(result.Destroyed, addr)
+			continue
+		}
+		if reflect.DeepEqual(prior.AttributeValues, now.AttributeValues) {
+			continue
+		}
+		if prior.Index != nil || !isRootModule(prior) {
+			result.Manual = append(result.Manual, addr)
+			continue
+		}
+		change := restoreChange(prior, now, resourceSchema(schemas, prior))
+		if len(change.Attributes) == 0 {
+			result.Manual = append(result.Manual, addr)
+			continue
+		}
+		result.Restore = append(result.Restore, change)
+	}
+
+	sort.Strings(result.Created)
+	sort.Strings(result.Destroyed)
+	sort.Strings(result.Manual)
+	sort.Slice(result.Restore, func(i, j int) bool { return result.Restore[i].Address < result.Restore[j].Address })
+	return result
+}
+
+func restoreChange(prior, now *tfjson.StateResource, schema *tfjson.SchemaBlock) Change {
+	change := Change{
+		Address:    prior.Address,
+		Type:       prior.Type,
+		Name:       prior.Name,
+		Attributes: make(map[string]interface{}),
+		types:      make(map[string]cty.Type),
+	}
+	names := make(map[string]struct{})
+	for name := range prior.AttributeValues {
+		names[name] = struct{}{}
+	}
+	for name := range now.AttributeValues {
+		names[name] = struct{}{}
+	}
+	for name := range names {
+		was, is := prior.AttributeValues[name], now.AttributeValues[name]
+		if reflect.DeepEqual(was, is) {
+			continue
+		}
+		var attr *tfjson.SchemaAttribute
+		if schema != nil {
+			attr = schema.Attributes[name]
+		}
+		if attr == nil || attr.Sensitive || !(attr.Required || attr.Optional) {
+			change.Skipped = append(change.Skipped, name)
+			continue
+		}
+		change.Attributes[name] = was
+		change.types[name] = attr.AttributeType
+	}
+	sort.Strings(change.Skipped)
+	return change
+}
+
+func managedResources(state *tfjson.State) map[string]*tfjson.StateResource {
+	resources := make(map[string]*tfjson.StateResource)
+	if state == nil || state.Values == nil {
+		return resources
+	}
+	var walk func(*tfjson.StateModule)
+	walk = func(m *tfjson.StateModule) {
+		if m == nil {
+			return
+		}
+		for _, r := range m.Resources {
+			if r.Mode == tfjson.ManagedResourceMode {
+				resources[r.Address] = r
+			}
+		}
+		for _, child := range m.ChildModules {
+			walk(child)
+		}
+	}
+	walk(state.Values.RootModule)
+	return resources
+}
+
+func isRootModule(r *tfjson.StateResource) bool {
+	return r.Address == r.Type+"."+r.Name
+}
+
+func resourceSchema(schemas *tfjson.ProviderSchemas, r *tfjson.StateResource) *tfjson.SchemaBlock {
+	if schemas == nil {
+		return nil
+	}
+	provider, ok := schemas.Schemas[r.ProviderName]
+	if !ok || provider == nil {
+		return nil
+	}
+	schema, ok := provider.ResourceSchemas[r.Type]
+	if !ok || schema == nil {
+		return nil
+	}
+	return schema.Block
+}
+
+// RenderOverride returns an override file pinning each change's attributes
+// to their prior values.
+func RenderOverride(changes []Change) ([]byte, error) {
+	file := hclwrite.NewEmptyFile()
+	body := file.Body()
+	for i, change := range changes {
+		if i > 0 {
+			body.AppendNewline()
+		}
+		block := body.AppendNewBlock("resource", []string{change.Type, change.Name}).Body()
+		names := make([]string, 0, len(change.Attributes))
+		for name := range change.Attributes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			val, err := ctyValue(change.Attributes[name], change.types[name])
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", change.Address, name, err)
+			}
+			block.SetAttributeValue(name, val)
+		}
+	}
+	return file.Bytes(), nil
+}
+
+func ctyValue(v interface{}, ty cty.Type) (cty.Value, error) {
+	if v == nil {
+		return cty.NullVal(cty.DynamicPseudoType), nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	if ty == cty.NilType {
+		if ty, err = ctyjson.ImpliedType(data); err != nil {
+			return cty.NilVal, err
+		}
+	}
+	return ctyjson.Unmarshal(data, ty)
+}
+
+// Terraform is the subset of tfexec.Terraform a rollback drives.
+type Terraform interface {
+	Show(ctx context.Context, opts ...tfexec.ShowOption) (*tfjson.State, error)
+	ShowStateFile(ctx context.Context, statePath string, opts ...tfexec.ShowOption) (*tfjson.State, error)
+	ProvidersSchema(ctx context.Context) (*tfjson.ProviderSchemas, error)
+	Plan(ctx context.Context, opts ...tfexec.PlanOption) (bool, error)
+	ShowPlanFileRaw(ctx context.Context, planPath string, opts ...tfexec.ShowOption) (string, error)
+	Apply(ctx context.Context, opts ...tfexec.ApplyOption) error
+}
+
+// Options configure Run.
+type Options struct {
+	StackDir   string
+	BackupPath string
+	PlanPath   string
+	VarFiles   []string
+	// Approve reviews the rendered rollback plan; nothing is applied unless
+	// it returns true.
+	Approve func(plan string) (bool, error)
+}
+
+// Run analyses the backup against the current state of an initialised
+// stack, plans the restorable changes with an override file and, once
+// approved, applies that plan. It returns the analysis and whether the plan
+// was applied.
+func Run(ctx context.Context, tf Terraform, opts Options) (*Result, bool, error) {
+	backup, err := tf.ShowStateFile(ctx, opts.BackupPath)
+	if err != nil {
+		return nil, false, fmt.Errorf("read state backup %s: %w", opts.BackupPath, err)
+	}
+	current, err := tf.Show(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("read current state: %w", err)
+	}
+	schemas, err := tf.ProvidersSchema(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("read provider schemas: %w", err)
+	}
+
+	result := Analyze(backup, current, schemas)
+	if len(result.Restore) == 0 {
+		return result, false, nil
+	}
+
+	override, err := RenderOverride(result.Restore)
+	if err != nil {
+		return result, false, err
+	}
+	overridePath := filepath.Join(opts.StackDir, OverrideFileName)
+	if err := os.WriteFile(overridePath, override, 0o644); err != nil {
+		return result, false, fmt.Errorf("write rollback override: %w", err)
+	}
+	defer os.Remove(overridePath)
+
+	if err := os.MkdirAll(filepath.Dir(opts.PlanPath), 0o755); err != nil {
+		return result, false, err
+	}
+	planOpts := []tfexec.PlanOption{tfexec.Out(opts.PlanPath)}
+	for _, target := range result.Targets() {
+		planOpts = append(planOpts, tfexec.Target(target))
+	}
+	for _, vf := range opts.VarFiles {
+		planOpts = append(planOpts, tfexec.VarFile(vf))
+	}
+	if _, err := tf.Plan(ctx, planOpts...); err != nil {
+		return result, false, fmt.Errorf("plan rollback: %w", err)
+	}
+	rendered, err := tf.ShowPlanFileRaw(ctx, opts.PlanPath)
+	if err != nil {
+		return result, false, fmt.Errorf("show rollback plan: %w", err)
+	}
+
+	if opts.Approve == nil {
+		return result, false, nil
+	}
+	approved, err := opts.Approve(rendered)
+	if err != nil || !approved {
+		return result, false, err
+	}
+	if err := tf.Apply(ctx, tfexec.DirOrPlan(opts.PlanPath)); err != nil {
+		return result, false, fmt.Errorf("apply rollback: %w", err)
+	}
+	return result, true, nil
+}
@@ -0,0 +1,101 @@
+package rollback_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/rollback"
+)
+
+const provider = "registry.terraform.io/hashicorp/aws"
+
+func state(t *testing.T, resources ...string) *tfjson.State {
+	t.Helper()
+	raw := `{"format_version":"1.0","values":{"root_module":{"resources":[`
+	for i, r := range resources {
+		if i > 0 {
+			raw += ","
+		}
+		raw += r
+	}
+	raw += `]}}}`
+	var s tfjson.State
+	require.NoError(t, json.Unmarshal([]byte(raw), &s))
+	return &s
+}
+
+func schemas(t *testing.T) *tfjson.ProviderSchemas {
+	t.Helper()
+	raw := `{"format_version":"1.0","provider_schemas":{"` + provider + `":{"resource_schemas":{
+		"aws_instance":{"version":1,"block":{"attributes":{
+			"id":{"type":"string","computed":true},
+			"instance_type":{"type":"string","required":true},
+			"tags":{"type":["map","string"],"optional":true},
+			"user_data":{"type":"string","optional":true,"sensitive":true},
+			"private_ip":{"type":"string","computed":true}
+		}}}
+	}}}}`
+	var s tfjson.ProviderSchemas
+	require.NoError(t, json.Unmarshal([]byte(raw), &s))
+	return &s
+}
+
+func resource(address, values string) string {
+	return `{"address":"` + address + `","mode":"managed","type":"aws_instance","name":"` +
+		address[len("aws_instance."):] + `","provider_name":"` + provider + `","values":` + values + `}`
+}
+
+func TestAnalyzeRestoresConfigurableAttributes(t *testing.T) {
+	t.Parallel()
+
+	backup := state(t,
+		resource("aws_instance.web", `{"id":"i-1","instance_type":"t3.micro","tags":{"team":"core"},"user_data":"a","private_ip":"10.0.0.1"}`),
+		resource("aws_instance.old", `{"id":"i-2","instance_type":"t3.micro"}`),
+		resource("aws_instance.same", `{"id":"i-3","instance_type":"t3.micro"}`),
+	)
+	current := state(t,
+		resource("aws_instance.web", `{"id":"i-1","instance_type":"t3.large","tags":null,"user_data":"b","private_ip":"10.0.0.2"}`),
+		resource("aws_instance.same", `{"id":"i-3","instance_type":"t3.micro"}`),
+		resource("aws_instance.new", `{"id":"i-4","instance_type":"t3.micro"}`),
+	)
+
+	result := rollback.Analyze(backup, current, schemas(t))
+	require.Equal(t, []string{"aws_instance.new"}, result.Created)
+	require.Equal(t, []string{"aws_instance.old"}, result.Destroyed)
+	require.Empty(t, result.Manual)
+	require.Len(t, result.Restore, 1)
+
+	change := result.Restore[0]
+	require.Equal(t, "aws_instance.web", change.Address)
+	require.Equal(t, map[string]interface{}{
+		"instance_type": "t3.micro",
+		"tags":          map[string]interface{}{"team": "core"},
+	}, change.Attributes)
+	require.Equal(t, []string{"private_ip", "user_data"}, change.Skipped)
+	require.Equal(t, []string{"aws_instance.web"}, result.Targets())
+
+	override, err := rollback.RenderOverride(result.Restore)
+	require.NoError(t, err)
+	require.Contains(t, string(override), `resource "aws_instance" "web" {`)
+	require.Contains(t, string(override), `instance_type = "t3.micro"`)
+	require.Contains(t, string(override), `team = "core"`)
+}
+
+func TestAnalyzeLeavesIndexedResourcesManual(t *testing.T) {
+	t.Parallel()
+
+	indexed := func(values string) string {
+		return `{"address":"aws_instance.pool[0]","mode":"managed","type":"aws_instance","name":"pool","index":0,"provider_name":"` +
+			provider + `","values":` + values + `}`
+	}
+	result := rollback.Analyze(
+		state(t, indexed(`{"instance_type":"t3.micro"}`)),
+		state(t, indexed(`{"instance_type":"t3.large"}`)),
+		schemas(t),
+	)
+	require.Empty(t, result.Restore)
+	require.Equal(t, []string{"aws_instance.pool[0]"}, result.Manual)
+}
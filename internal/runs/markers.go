@@ -0,0 +1,92 @@
+package runs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// MarkerAPI captures the subset of S3 operations required to persist stack
+// completion markers.
+type MarkerAPI interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+}
+
+const markerSuffix = ".done"
+
+// Markers records per-stack completion in the state bucket under
+// runs/<env>/<run-id>/<stack>.done so that a run interrupted on one CI runner
+// can be resumed from another.
+type Markers struct {
+	Client      MarkerAPI
+	Bucket      string
+	Environment string
+	RunID       string
+}
+
+// MarkerPrefix returns the key prefix holding the markers of a run.
+func MarkerPrefix(env, id string) string {
+	return fmt.Sprintf("runs/%s/%s/", env, id)
+}
+
+// MarkerKey returns the object key marking stack as completed in a run.
+func MarkerKey(env, id, stack string) string {
+	return MarkerPrefix(env, id) + strings.Trim(stack, "/") + markerSuffix
+}
+
+// MarkDone writes the completion marker for stack.
+func (m *Markers) MarkDone(ctx context.Context, stack string) error {
+	if m == nil || m.Client == nil {
+		return nil
+	}
+	body := fmt.Sprintf(`{"stack":%q,"completed_at":%q}`, stack, time.Now().UTC().Format(time.RFC3339))
+	_, err := m.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(m.Bucket),
+		Key:         aws.String(MarkerKey(m.Environment, m.RunID, stack)),
+		Body:        strings.NewReader(body),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("write completion marker for %s: %w", stack, err)
+	}
+	return nil
+}
+
+// Completed lists the stacks with completion markers for the run.
+func (m *Markers) Completed(ctx context.Context) ([]string, error) {
+	if m == nil || m.Client == nil {
+		return nil, nil
+	}
+	prefix := MarkerPrefix(m.Environment, m.RunID)
+	var stacks []string
+	var token *string
+	for {
+		out, err := m.Client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String(m.Bucket),
+			Prefix:            aws.String(prefix),
+			ContinuationToken: token,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("list completion markers: %w", err)
+		}
+		for _, obj := range out.Contents {
+			key := aws.ToString(obj.Key)
+			if !strings.HasSuffix(key, markerSuffix) {
+				continue
+			}
+			stacks = append(stacks, strings.TrimSuffix(strings.TrimPrefix(key, prefix), markerSuffix))
+		}
+		if !aws.ToBool(out.IsTruncated) || out.NextContinuationToken == nil {
+			break
+		}
+		token = out.NextContinuationToken
+	}
+	sort.Strings(stacks)
+	return stacks, nil
+}
@@ -0,0 +1,173 @@
+package runs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"terraform-wrapper/internal/tenant"
+)
+
+const (
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Record captures the outcome of a single orchestration run.
+type Record struct {
+	ID             string            `json:"id"`
+	Environment    string            `json:"environment"`
+	Tenant         string            `json:"tenant,omitempty"`
+	Operation      string            `json:"operation"`
+	GitSHA         string            `json:"git_sha,omitempty"`
+	IdempotencyKey string            `json:"idempotency_key,omitempty"`
+	Actor          string            `json:"actor,omitempty"`
+	CallerARN      string            `json:"caller_arn,omitempty"`
+	Status         string            `json:"status"`
+	StartedAt      time.Time         `json:"started_at"`
+	FinishedAt     time.Time         `json:"finished_at,omitempty"`
+	Completed      []string          `json:"completed"`
+	Failed         map[string]string `json:"failed,omitempty"`
+	// ExtraVarFiles lists the ad-hoc var files the run layered over every
+	// stack's standard ones.
+	ExtraVarFiles []string `json:"extra_var_files,omitempty"`
+}
+
+// NewID derives a stable run identifier from the environment, git SHA, operation
+// and optional idempotency key so that retried CI jobs resolve to the same run.
+func NewID(env, gitSHA, operation, key string) string {
+	h := sha256.New()
+	for _, part := range []string{env, gitSHA, operation, key} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// Dir returns the directory holding run records for an environment. With a
+// tenant, env is its tenant.Scope.
+func Dir(root, env string) string {
+	return filepath.Join(root, ".terraform-wrapper", "runs", env)
+}
+
+// Path returns the record file for a run.
+func Path(root, env, id string) string {
+	return filepath.Join(Dir(root, env), id+".json")
+}
+
+// Load reads a run record, returning nil without error when none exists.
+func Load(root, env, id string) (*Record, error) {
+	data, err := os.ReadFile(Path(root, env, id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read run record: %w", err)
+	}
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("parse run record %s: %w", id, err)
+	}
+	return &rec, nil
+}
+
+// Save persists a run record, replacing any previous record with the same ID.
+func Save(root string, rec *Record) error {
+	if rec == nil || rec.ID == "" {
+		return errors.New("run record must have an ID")
+	}
+	sort.Strings(rec.Completed)
+	path := Path(root, tenant.Scope(rec.Tenant, rec.Environment), rec.ID)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create run record directory: %w", err)
+	}
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal run record: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write run record: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// Latest returns the most recently started run of operation in env that has
+// finished, or nil when there is none.
+func Latest(root, env, operation string) (*Record, error) {
+	entries, err := os.ReadDir(Dir(root, env))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read run records: %w", err)
+	}
+	var latest *Record
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		rec, err := Load(root, env, id)
+		if err != nil {
+			return nil, err
+		}
+		if rec == nil || rec.Operation != operation || rec.Status == StatusRunning {
+			continue
+		}
+		if latest == nil || rec.StartedAt.After(latest.StartedAt) {
+			latest = rec
+		}
+	}
+	return latest, nil
+}
+
+// CompletedSet returns the stacks recorded as completed, keyed by relative path.
+func (r *Record) CompletedSet() map[string]struct{} {
+	if r == nil {
+		return nil
+	}
+	set := make(map[string]struct{}, len(r.Completed))
+	for _, stack := range r.Completed {
+		set[stack] = struct{}{}
+	}
+	return set
+}
+
+// MarkCompleted adds stacks to the completed list, ignoring duplicates.
+func (r *Record) MarkCompleted(stacks ...string) {
+	seen := r.CompletedSet()
+	for _, stack := range stacks {
+		if _, ok := seen[stack]; ok {
+			continue
+		}
+		seen[stack] = struct{}{}
+		r.Completed = append(r.Completed, stack)
+	}
+}
+
+// GitSHA returns the commit being deployed, preferring CI-provided values.
+func GitSHA(ctx context.Context, root string) string {
+	for _, key := range []string{"GITHUB_SHA", "CI_COMMIT_SHA"} {
+		if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+			return v
+		}
+	}
+	cmd := exec.CommandContext(ctx, "git", "rev-parse", "HEAD")
+	cmd.Dir = root
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,216 @@
+package runs_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/runs"
+)
+
+func TestNewIDIsStable(t *testing.T) {
+	t.Parallel()
+
+	a := runs.NewID("dev", "abc123", "apply-all", "job-1")
+	b := runs.NewID("dev", "abc123", "apply-all", "job-1")
+	require.Equal(t, a, b)
+	require.Len(t, a, 16)
+
+	require.NotEqual(t, a, runs.NewID("prod", "abc123", "apply-all", "job-1"))
+	require.NotEqual(t, a, runs.NewID("dev", "def456", "apply-all", "job-1"))
+	require.NotEqual(t, a, runs.NewID("dev", "abc123", "destroy-all", "job-1"))
+	require.NotEqual(t, a, runs.NewID("dev", "abc123", "apply-all", "job-2"))
+}
+
+func TestSaveAndLoadRecord(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+
+	missing, err := runs.Load(root, "dev", "nope")
+	require.NoError(t, err)
+	require.Nil(t, missing)
+
+	rec := &runs.Record{
+		ID:          runs.NewID("dev", "sha", "apply-all", "key"),
+		Environment: "dev",
+		Operation:   "apply-all",
+		Status:      runs.StatusFailed,
+		StartedAt:   time.Now().UTC().Truncate(time.Second),
+	}
+	rec.MarkCompleted("core-services/network", "core-services/ecs", "core-services/network")
+	require.NoError(t, runs.Save(root, rec))
+
+	loaded, err := runs.Load(root, "dev", rec.ID)
+	require.NoError(t, err)
+	require.Equal(t, []string{"core-services/ecs", "core-services/network"}, loaded.Completed)
+	require.Equal(t, runs.StatusFailed, loaded.Status)
+	require.Contains(t, loaded.CompletedSet(), "core-services/ecs")
+}
+
+func TestLatestReturnsMostRecentFinishedRun(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	latest, err := runs.Latest(root, "dev", "plan-all")
+	require.NoError(t, err)
+	require.Nil(t, latest)
+
+	started := time.Now().UTC().Truncate(time.Second)
+	for i, rec := range []*runs.Record{
+		{Operation: "plan-all", Status: runs.StatusFailed, StartedAt: started, Failed: map[string]string{"network": "boom"}},
+		{Operation: "plan-all", Status: runs.StatusSucceeded, StartedAt: started.Add(-time.Hour)},
+		{Operation: "plan-all", Status: runs.StatusRunning, StartedAt: started.Add(time.Hour)},
+		{Operation: "apply-all", Status: runs.StatusSucceeded, StartedAt: started.Add(time.Hour)},
+	} {
+		rec.ID = runs.NewID("dev", "sha", rec.Operation, strconv.Itoa(i))
+		rec.Environment = "dev"
+		require.NoError(t, runs.Save(root, rec))
+	}
+
+	latest, err = runs.Latest(root, "dev", "plan-all")
+	require.NoError(t, err)
+	require.Equal(t, runs.StatusFailed, latest.Status)
+	require.Equal(t, map[string]string{"network": "boom"}, latest.Failed)
+}
+
+type markerS3 struct {
+	objects map[string]string
+}
+
+func (m *markerS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.objects[aws.ToString(params.Key)] = string(data)
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (m *markerS3) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	var keys []string
+	for key := range m.objects {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	// Return one object per page to exercise pagination.
+	start := 0
+	if params.ContinuationToken != nil {
+		start, _ = strconv.Atoi(*params.ContinuationToken)
+	}
+	out := &s3.ListObjectsV2Output{}
+	if start < len(keys) {
+		out.Contents = []s3types.Object{{Key: aws.String(keys[start])}}
+	}
+	if start+1 < len(keys) {
+		out.IsTruncated = aws.Bool(true)
+		out.NextContinuationToken = aws.String(strconv.Itoa(start + 1))
+	}
+	return out, nil
+}
+
+func TestMarkersRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	client := &markerS3{objects: map[string]string{
+		"runs/dev/other/core-services/network.done": "{}",
+	}}
+	markers := &runs.Markers{Client: client, Bucket: "state", Environment: "dev", RunID: "abc"}
+
+	done, err := markers.Completed(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, done)
+
+	require.NoError(t, markers.MarkDone(context.Background(), "core-services/network"))
+	require.NoError(t, markers.MarkDone(context.Background(), "core-services/ecs"))
+	require.Contains(t, client.objects, "runs/dev/abc/core-services/network.done")
+	require.Contains(t, client.objects["runs/dev/abc/core-services/ecs.done"], `"stack":"core-services/ecs"`)
+
+	done, err = markers.Completed(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"core-services/ecs", "core-services/network"}, done)
+}
+
+type taggingS3 struct {
+	tags map[string]map[string]string
+}
+
+func (m *taggingS3) PutObjectTagging(ctx context.Context, params *s3.PutObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.PutObjectTaggingOutput, error) {
+	tags := make(map[string]string)
+	for _, tag := range params.Tagging.TagSet {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	m.tags[aws.ToString(params.Bucket)+"/"+aws.ToString(params.Key)] = tags
+	return &s3.PutObjectTaggingOutput{}, nil
+}
+
+func TestStateTaggerTagsStateObject(t *testing.T) {
+	t.Parallel()
+
+	client := &taggingS3{tags: make(map[string]map[string]string)}
+	tagger := &runs.StateTagger{
+		Client:      client,
+		Bucket:      "state",
+		Environment: "prod",
+		Workspace:   "blue",
+		RunID:       "abc",
+		GitSHA:      "0123456",
+		Actor:       "Jane Doe <jane@example.com>",
+		Now:         func() time.Time { return time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC) },
+	}
+
+	require.NoError(t, tagger.TagState(context.Background(), "/repo/core-services/network"))
+	require.Equal(t, map[string]string{
+		runs.TagRunID:     "abc",
+		runs.TagGitSHA:    "0123456",
+		runs.TagActor:     "Jane Doe _jane@example.com_",
+		runs.TagAppliedAt: "2025-01-02T03:04:05Z",
+	}, client.tags["state/prod/workspaces/blue/network/terraform.tfstate"])
+
+	tagger.GitSHA = ""
+	tagger.Workspace = ""
+	require.NoError(t, tagger.TagState(context.Background(), "/repo/core-services/ecs"))
+	require.NotContains(t, client.tags["state/prod/ecs/terraform.tfstate"], runs.TagGitSHA)
+}
+
+func TestStateTaggerTagsWorkspaceState(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	network := filepath.Join(root, "core-services", "network")
+	dns := filepath.Join(root, "core-services", "dns")
+	require.NoError(t, os.MkdirAll(network, 0o755))
+	require.NoError(t, os.MkdirAll(dns, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dns, "backend.tfwrapper.json"), []byte(`{"type": "s3"}`), 0o644))
+
+	client := &taggingS3{tags: make(map[string]map[string]string)}
+	tagger := &runs.StateTagger{
+		Client:                client,
+		Bucket:                "state",
+		Environment:           "prod",
+		RunID:                 "abc",
+		Root:                  root,
+		EnvironmentWorkspaces: true,
+	}
+
+	require.NoError(t, tagger.TagState(context.Background(), network))
+	require.Contains(t, client.tags, "state/env:/prod/network/terraform.tfstate")
+
+	// The stack's own backend.tfwrapper.json leaves workspaces off.
+	require.NoError(t, tagger.TagState(context.Background(), dns))
+	require.Contains(t, client.tags, "state/prod/dns/terraform.tfstate")
+}
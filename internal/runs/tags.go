@@ -0,0 +1,145 @@
+package runs
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"terraform-wrapper/internal/stacks"
+)
+
+// Tag keys written to state objects after a successful apply.
+const (
+	TagRunID     = "terraform-wrapper:run-id"
+	TagGitSHA    = "terraform-wrapper:git-sha"
+	TagActor     = "terraform-wrapper:actor"
+	TagAppliedAt = "terraform-wrapper:applied-at"
+)
+
+// maxTagValue is the S3 limit on the length of a tag value.
+const maxTagValue = 256
+
+// TaggingAPI captures the S3 operation required to tag state objects.
+type TaggingAPI interface {
+	PutObjectTagging(ctx context.Context, params *s3.PutObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.PutObjectTaggingOutput, error)
+}
+
+// StateTagger tags a stack's state object with the run that last applied it,
+// so the bucket can be queried for when each stack changed and by whom. The
+// tag set replaces any tags already on the object.
+type StateTagger struct {
+	Client      TaggingAPI
+	Bucket      string
+	Environment string
+	Workspace   string
+	RunID       string
+	GitSHA      string
+	Actor       string
+	Now         func() time.Time
+	// Root and KeyPattern locate state stored under a key pattern; the
+	// default layout is used when KeyPattern is empty.
+	Root       string
+	KeyPattern string
+	// Naming, when set, names keys with the backend's key_template.
+	Naming *stacks.StateNaming
+	// EnvironmentWorkspaces is the repository backend's
+	// environment_workspaces setting.
+	//
+	// Like Naming, it applies to stacks without a backend.tfwrapper.json;
+	// a stack's own file replaces both, as it does for the runner.
+	EnvironmentWorkspaces bool
+}
+
+// TagState tags the state object of the stack at stackPath.
+func (t *StateTagger) TagState(ctx context.Context, stackPath string) error {
+	if t == nil || t.Client == nil {
+		return nil
+	}
+	now := time.Now
+	if t.Now != nil {
+		now = t.Now
+	}
+	stackRel, err := filepath.Rel(t.Root, stackPath)
+	if err != nil {
+		stackRel = stackPath
+	}
+	target := stacks.BackendTarget{
+		Environment: t.Environment,
+		Workspace:   t.Workspace,
+		Stack:       filepath.Base(stackPath),
+		StackPath:   filepath.ToSlash(stackRel),
+		KeyPattern:  t.KeyPattern,
+		Naming:      t.Naming,
+	}
+	workspaces := t.EnvironmentWorkspaces
+	settings, err := stacks.LoadBackendSettings(stackPath)
+	if err != nil {
+		return err
+	}
+	if settings != nil {
+		if settings.Type != "" && settings.Type != stacks.BackendS3 {
+			// The stack's state is not in the bucket.
+			return nil
+		}
+		if target.Naming, err = settings.Naming(); err != nil {
+			return fmt.Errorf("%s: %w", filepath.Join(stackPath, stacks.BackendFileName), err)
+		}
+		workspaces = settings.EnvironmentWorkspaces
+	}
+	if workspaces {
+		target.TerraformWorkspace = t.Environment
+	}
+	key := target.S3Key()
+	_, err = t.Client.PutObjectTagging(ctx, &s3.PutObjectTaggingInput{
+		Bucket:  aws.String(t.Bucket),
+		Key:     aws.String(key),
+		Tagging: &s3types.Tagging{TagSet: t.tags(now().UTC())},
+	})
+	if err != nil {
+		return fmt.Errorf("tag state s3://%s/%s: %w", t.Bucket, key, err)
+	}
+	return nil
+}
+
+func (t *StateTagger) tags(at time.Time) []s3types.Tag {
+	values := []struct{ key, value string }{
+		{TagRunID, t.RunID},
+		{TagGitSHA, t.GitSHA},
+		{TagActor, t.Actor},
+		{TagAppliedAt, at.Format(time.RFC3339)},
+	}
+	var tags []s3types.Tag
+	for _, v := range values {
+		value := tagValue(v.value)
+		if value == "" {
+			continue
+		}
+		tags = append(tags, s3types.Tag{Key: aws.String(v.key), Value: aws.String(value)})
+	}
+	return tags
+}
+
+// tagValue replaces characters S3 does not accept in tag values and trims the
+// result to the maximum length.
+func tagValue(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case strings.ContainsRune(" +-=._:/@", r):
+			return r
+		default:
+			return '_'
+		}
+	}, strings.TrimSpace(s))
+	if len(s) > maxTagValue {
+		s = s[:maxTagValue]
+	}
+	return s
+}
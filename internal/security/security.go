@@ -0,0 +1,93 @@
+package security
+
+import (
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// Categories of security-relevant resources.
+const (
+	CategoryIAM            = "iam"
+	CategoryNetwork        = "network"
+	CategoryKMS            = "kms"
+	CategoryResourcePolicy = "resource-policy"
+)
+
+var prefixCategories = []struct {
+	prefix   string
+	category string
+}{
+	{"aws_iam_", CategoryIAM},
+	{"aws_security_group", CategoryNetwork},
+	{"aws_vpc_security_group_", CategoryNetwork},
+	{"aws_network_acl", CategoryNetwork},
+	{"aws_kms_", CategoryKMS},
+}
+
+var typeCategories = map[string]string{
+	"aws_s3_bucket_policy":                      CategoryResourcePolicy,
+	"aws_s3_bucket_acl":                         CategoryResourcePolicy,
+	"aws_s3_bucket_public_access_block":         CategoryResourcePolicy,
+	"aws_s3_account_public_access_block":        CategoryResourcePolicy,
+	"aws_sns_topic_policy":                      CategoryResourcePolicy,
+	"aws_sqs_queue_policy":                      CategoryResourcePolicy,
+	"aws_ecr_repository_policy":                 CategoryResourcePolicy,
+	"aws_secretsmanager_secret_policy":          CategoryResourcePolicy,
+	"aws_lambda_permission":                     CategoryResourcePolicy,
+	"aws_cloudwatch_log_resource_policy":        CategoryResourcePolicy,
+	"aws_organizations_policy":                  CategoryIAM,
+	"aws_organizations_policy_attachment":       CategoryIAM,
+	"aws_ssoadmin_permission_set_inline_policy": CategoryIAM,
+}
+
+// Category returns the security category of resourceType, or "" when the
+// type is not security-relevant.
+func Category(resourceType string) string {
+	if category, ok := typeCategories[resourceType]; ok {
+		return category
+	}
+	for _, pc := range prefixCategories {
+		if strings.HasPrefix(resourceType, pc.prefix) {
+			return pc.category
+		}
+	}
+	return ""
+}
+
+// Change is a planned change to a security-relevant resource.
+type Change struct {
+	Address  string   `json:"address"`
+	Type     string   `json:"type"`
+	Category string   `json:"category"`
+	Actions  []string `json:"actions"`
+}
+
+// Changes returns the security-relevant managed resource changes in plan,
+// sorted by address. No-op and read-only changes are omitted.
+func Changes(plan *tfjson.Plan) []Change {
+	if plan == nil {
+		return nil
+	}
+	var out []Change
+	for _, rc := range plan.ResourceChanges {
+		if rc == nil || rc.Change == nil || rc.Mode == tfjson.DataResourceMode {
+			continue
+		}
+		if rc.Change.Actions.NoOp() || rc.Change.Actions.Read() {
+			continue
+		}
+		category := Category(rc.Type)
+		if category == "" {
+			continue
+		}
+		actions := make([]string, 0, len(rc.Change.Actions))
+		for _, a := range rc.Change.Actions {
+			actions = append(actions, string(a))
+		}
+		out = append(out, Change{Address: rc.Address, Type: rc.Type, Category: category, Actions: actions})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Address < out[j].Address })
+	return out
+}
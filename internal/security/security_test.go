@@ -0,0 +1,34 @@
+package security_test
+
+import (
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/security"
+)
+
+func TestCategory(t *testing.T) {
+	require.Equal(t, security.CategoryIAM, security.Category("aws_iam_role_policy"))
+	require.Equal(t, security.CategoryNetwork, security.Category("aws_security_group_rule"))
+	require.Equal(t, security.CategoryNetwork, security.Category("aws_vpc_security_group_ingress_rule"))
+	require.Equal(t, security.CategoryKMS, security.Category("aws_kms_key"))
+	require.Equal(t, security.CategoryResourcePolicy, security.Category("aws_s3_bucket_policy"))
+	require.Empty(t, security.Category("aws_s3_bucket"))
+}
+
+func TestChangesFiltersToSecurityRelevantResources(t *testing.T) {
+	plan := &tfjson.Plan{ResourceChanges: []*tfjson.ResourceChange{
+		{Address: "aws_s3_bucket.logs", Type: "aws_s3_bucket", Mode: tfjson.ManagedResourceMode, Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionCreate}}},
+		{Address: "aws_s3_bucket_policy.logs", Type: "aws_s3_bucket_policy", Mode: tfjson.ManagedResourceMode, Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionUpdate}}},
+		{Address: "aws_iam_role.app", Type: "aws_iam_role", Mode: tfjson.ManagedResourceMode, Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionDelete, tfjson.ActionCreate}}},
+		{Address: "aws_kms_key.state", Type: "aws_kms_key", Mode: tfjson.ManagedResourceMode, Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionNoop}}},
+		{Address: "data.aws_iam_policy_document.app", Type: "aws_iam_policy_document", Mode: tfjson.DataResourceMode, Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionRead}}},
+	}}
+
+	require.Equal(t, []security.Change{
+		{Address: "aws_iam_role.app", Type: "aws_iam_role", Category: security.CategoryIAM, Actions: []string{"delete", "create"}},
+		{Address: "aws_s3_bucket_policy.logs", Type: "aws_s3_bucket_policy", Category: security.CategoryResourcePolicy, Actions: []string{"update"}},
+	}, security.Changes(plan))
+}
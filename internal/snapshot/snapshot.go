@@ -0,0 +1,320 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"terraform-wrapper/internal/graph"
+	"terraform-wrapper/internal/output"
+)
+
+// sensitiveValue replaces values Terraform marks as sensitive, so snapshots
+// can be committed.
+const sensitiveValue = "(sensitive)"
+
+// Planner plans a stack and returns the plan's JSON representation.
+type Planner interface {
+	PlanJSON(ctx context.Context, stackDir string) (*tfjson.Plan, error)
+}
+
+// Options configures Take and Verify.
+type Options struct {
+	RootDir     string
+	Environment string
+	// Dir is the directory holding the golden files, relative to RootDir
+	// unless absolute.
+	Dir         string
+	Parallelism int
+	Planner     Planner
+}
+
+// Resource is a planned resource change. Values are only recorded for
+// resources that change, so unrelated state does not churn snapshots.
+type Resource struct {
+	Address         string      `json:"address"`
+	PreviousAddress string      `json:"previous_address,omitempty"`
+	Actions         []string    `json:"actions"`
+	Before          interface{} `json:"before,omitempty"`
+	After           interface{} `json:"after,omitempty"`
+	AfterUnknown    interface{} `json:"after_unknown,omitempty"`
+}
+
+// Output is a planned output change.
+type Output struct {
+	Actions []string    `json:"actions"`
+	After   interface{} `json:"after,omitempty"`
+}
+
+// Snapshot is the normalized plan of a stack. It leaves out everything that
+// varies between otherwise identical plans, such as timestamps, the
+// Terraform version and the prior state.
+type Snapshot struct {
+	Stack     string            `json:"stack"`
+	Resources []Resource        `json:"resources"`
+	Outputs   map[string]Output `json:"outputs,omitempty"`
+}
+
+// Normalize converts a plan into a Snapshot with sensitive values redacted
+// and resources sorted by address.
+func Normalize(stack string, plan *tfjson.Plan) *Snapshot {
+	snap := &Snapshot{Stack: stack, Resources: []Resource{}}
+	if plan == nil {
+		return snap
+	}
+	for _, rc := range plan.ResourceChanges {
+		if rc == nil || rc.Change == nil {
+			continue
+		}
+		res := Resource{
+			Address:         rc.Address,
+			PreviousAddress: rc.PreviousAddress,
+			Actions:         actions(rc.Change.Actions),
+		}
+		if !rc.Change.Actions.NoOp() && !rc.Change.Actions.Read() {
+			res.Before = redact(rc.Change.Before, rc.Change.BeforeSensitive)
+			res.After = redact(rc.Change.After, rc.Change.AfterSensitive)
+			res.AfterUnknown = rc.Change.AfterUnknown
+		}
+		snap.Resources = append(snap.Resources, res)
+	}
+	sort.Slice(snap.Resources, func(i, j int) bool { return snap.Resources[i].Address < snap.Resources[j].Address })
+
+	for name, change := range plan.OutputChanges {
+		if change == nil {
+			continue
+		}
+		if snap.Outputs == nil {
+			snap.Outputs = make(map[string]Output)
+		}
+		snap.Outputs[name] = Output{
+			Actions: actions(change.Actions),
+			After:   redact(change.After, change.AfterSensitive),
+		}
+	}
+	return snap
+}
+
+func actions(in tfjson.Actions) []string {
+	out := make([]string, 0, len(in))
+	for _, a := range in {
+		out = append(out, string(a))
+	}
+	return out
+}
+
+// redact replaces the parts of value that sensitive marks true.
+func redact(value, sensitive interface{}) interface{} {
+	switch mask := sensitive.(type) {
+	case bool:
+		if mask && value != nil {
+			return sensitiveValue
+		}
+	case map[string]interface{}:
+		if obj, ok := value.(map[string]interface{}); ok {
+			out := make(map[string]interface{}, len(obj))
+			for k, v := range obj {
+				out[k] = redact(v, mask[k])
+			}
+			return out
+		}
+	case []interface{}:
+		if list, ok := value.([]interface{}); ok {
+			out := make([]interface{}, len(list))
+			for i, v := range list {
+				var m interface{}
+				if i < len(mask) {
+					m = mask[i]
+				}
+				out[i] = redact(v, m)
+			}
+			return out
+		}
+	}
+	return value
+}
+
+// Path returns the golden file of a stack, named after its path relative to
+// the root.
+func Path(dir, env, stack string) string {
+	return filepath.Join(dir, env, filepath.FromSlash(stack)+".json")
+}
+
+// Encode returns the canonical file contents of a snapshot.
+func Encode(snap *Snapshot) ([]byte, error) {
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Result is the outcome of snapshotting or verifying one stack.
+type Result struct {
+	Stack string
+	// Changes lists how the plan differs from the golden file; empty when
+	// they match or when snapshots are being taken.
+	Changes []string
+	// Missing is set when verifying a stack that has no golden file.
+	Missing bool
+	Err     error
+}
+
+// Take plans every stack and writes its snapshot to the golden files,
+// replacing any existing one.
+func Take(ctx context.Context, stacks []*graph.Stack, opts Options) ([]Result, error) {
+	return run(ctx, stacks, opts, func(path string, snap *Snapshot, result *Result) error {
+		data, err := Encode(snap)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return fmt.Errorf("create snapshot directory: %w", err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return fmt.Errorf("write snapshot: %w", err)
+		}
+		return nil
+	})
+}
+
+// Verify plans every stack and compares the result with its golden file.
+func Verify(ctx context.Context, stacks []*graph.Stack, opts Options) ([]Result, error) {
+	return run(ctx, stacks, opts, func(path string, snap *Snapshot, result *Result) error {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			result.Missing = true
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read snapshot: %w", err)
+		}
+		var golden Snapshot
+		if err := json.Unmarshal(data, &golden); err != nil {
+			return fmt.Errorf("invalid snapshot %s: %w", path, err)
+		}
+		current, err := Encode(snap)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(current, data) {
+			return nil
+		}
+		// Round-trip the plan so values compare the way they were stored.
+		var planned Snapshot
+		if err := json.Unmarshal(current, &planned); err != nil {
+			return err
+		}
+		result.Changes = Diff(&golden, &planned)
+		return nil
+	})
+}
+
+// run plans stacks up to Parallelism at a time and hands each normalized plan
+// to handle. Per-stack failures are recorded in the results, sorted by stack.
+func run(ctx context.Context, stacks []*graph.Stack, opts Options, handle func(path string, snap *Snapshot, result *Result) error) ([]Result, error) {
+	if opts.Planner == nil {
+		return nil, fmt.Errorf("snapshot planner not configured")
+	}
+	if opts.Parallelism < 1 {
+		opts.Parallelism = 1
+	}
+	rootAbs, err := filepath.Abs(opts.RootDir)
+	if err != nil {
+		return nil, err
+	}
+	dir := opts.Dir
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(rootAbs, dir)
+	}
+
+	results := make([]Result, len(stacks))
+	sem := make(chan struct{}, opts.Parallelism)
+	var wg sync.WaitGroup
+	for i, stack := range stacks {
+		rel, err := filepath.Rel(rootAbs, stack.Path)
+		if err != nil {
+			return nil, err
+		}
+		rel = filepath.ToSlash(rel)
+
+		wg.Add(1)
+		go func(i int, stack *graph.Stack, rel string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			output.Printf("[snapshot] planning %s\n", rel)
+			result := Result{Stack: rel}
+			plan, err := opts.Planner.PlanJSON(ctx, stack.Path)
+			if err == nil {
+				err = handle(Path(dir, opts.Environment, rel), Normalize(rel, plan), &result)
+			}
+			result.Err = err
+			results[i] = result
+		}(i, stack, rel)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Stack < results[j].Stack })
+	return results, nil
+}
+
+// Diff describes how a planned snapshot differs from the golden one, one line
+// per resource or output.
+func Diff(golden, planned *Snapshot) []string {
+	var changes []string
+	want := make(map[string]Resource, len(golden.Resources))
+	for _, r := range golden.Resources {
+		want[r.Address] = r
+	}
+	seen := make(map[string]bool, len(planned.Resources))
+	for _, r := range planned.Resources {
+		seen[r.Address] = true
+		old, ok := want[r.Address]
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("+ %s (%s)", r.Address, strings.Join(r.Actions, ",")))
+		case !reflect.DeepEqual(old, r):
+			changes = append(changes, fmt.Sprintf("~ %s (%s, was %s)", r.Address, strings.Join(r.Actions, ","), strings.Join(old.Actions, ",")))
+		}
+	}
+	for _, r := range golden.Resources {
+		if !seen[r.Address] {
+			changes = append(changes, fmt.Sprintf("- %s (%s)", r.Address, strings.Join(r.Actions, ",")))
+		}
+	}
+
+	names := make(map[string]bool)
+	for name := range golden.Outputs {
+		names[name] = true
+	}
+	for name := range planned.Outputs {
+		names[name] = true
+	}
+	var outputs []string
+	for name := range names {
+		old, hadOld := golden.Outputs[name]
+		cur, hasCur := planned.Outputs[name]
+		switch {
+		case !hadOld:
+			outputs = append(outputs, fmt.Sprintf("+ output.%s", name))
+		case !hasCur:
+			outputs = append(outputs, fmt.Sprintf("- output.%s", name))
+		case !reflect.DeepEqual(old, cur):
+			outputs = append(outputs, fmt.Sprintf("~ output.%s", name))
+		}
+	}
+	sort.Strings(outputs)
+	return append(changes, outputs...)
+}
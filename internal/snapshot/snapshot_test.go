@@ -0,0 +1,115 @@
+package snapshot_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/graph"
+	"terraform-wrapper/internal/snapshot"
+)
+
+type fakePlanner struct {
+	plans map[string]*tfjson.Plan
+	errs  map[string]error
+}
+
+func (f *fakePlanner) PlanJSON(_ context.Context, stackDir string) (*tfjson.Plan, error) {
+	name := filepath.Base(stackDir)
+	if err := f.errs[name]; err != nil {
+		return nil, err
+	}
+	return f.plans[name], nil
+}
+
+func TestNormalizeRedactsSensitiveValuesAndDropsVolatileFields(t *testing.T) {
+	plan := &tfjson.Plan{
+		TerraformVersion: "1.9.0",
+		Timestamp:        "2025-01-01T00:00:00Z",
+		ResourceChanges: []*tfjson.ResourceChange{
+			{Address: "aws_vpc.main", Change: &tfjson.Change{
+				Actions: tfjson.Actions{tfjson.ActionNoop},
+				Before:  map[string]interface{}{"cidr_block": "10.0.0.0/16"},
+				After:   map[string]interface{}{"cidr_block": "10.0.0.0/16"},
+			}},
+			{Address: "aws_db_instance.main", Change: &tfjson.Change{
+				Actions:        tfjson.Actions{tfjson.ActionCreate},
+				After:          map[string]interface{}{"engine": "postgres", "password": "hunter2"},
+				AfterSensitive: map[string]interface{}{"password": true},
+				AfterUnknown:   map[string]interface{}{"id": true},
+			}},
+		},
+		OutputChanges: map[string]*tfjson.Change{
+			"token": {Actions: tfjson.Actions{tfjson.ActionCreate}, After: "secret", AfterSensitive: true},
+		},
+	}
+
+	require.Equal(t, &snapshot.Snapshot{
+		Stack: "db",
+		Resources: []snapshot.Resource{
+			{
+				Address:      "aws_db_instance.main",
+				Actions:      []string{"create"},
+				After:        map[string]interface{}{"engine": "postgres", "password": "(sensitive)"},
+				AfterUnknown: map[string]interface{}{"id": true},
+			},
+			{Address: "aws_vpc.main", Actions: []string{"no-op"}},
+		},
+		Outputs: map[string]snapshot.Output{
+			"token": {Actions: []string{"create"}, After: "(sensitive)"},
+		},
+	}, snapshot.Normalize("db", plan))
+}
+
+func TestVerifyReportsPlansThatDifferFromSnapshots(t *testing.T) {
+	root := t.TempDir()
+	targets := []*graph.Stack{
+		{Path: filepath.Join(root, "network")},
+		{Path: filepath.Join(root, "app")},
+	}
+	planner := &fakePlanner{plans: map[string]*tfjson.Plan{
+		"network": {ResourceChanges: []*tfjson.ResourceChange{
+			{Address: "aws_vpc.main", Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionNoop}}},
+		}},
+		"app": {ResourceChanges: []*tfjson.ResourceChange{
+			{Address: "aws_ecs_service.app", Change: &tfjson.Change{
+				Actions: tfjson.Actions{tfjson.ActionUpdate},
+				Before:  map[string]interface{}{"desired_count": 2},
+				After:   map[string]interface{}{"desired_count": 3},
+			}},
+		}},
+	}}
+	opts := snapshot.Options{RootDir: root, Environment: "dev", Dir: "snapshots", Parallelism: 2, Planner: planner}
+	ctx := context.Background()
+
+	results, err := snapshot.Take(ctx, targets, opts)
+	require.NoError(t, err)
+	require.Equal(t, []snapshot.Result{{Stack: "app"}, {Stack: "network"}}, results)
+	require.FileExists(t, filepath.Join(root, "snapshots", "dev", "network.json"))
+
+	results, err = snapshot.Verify(ctx, targets, opts)
+	require.NoError(t, err)
+	require.Equal(t, []snapshot.Result{{Stack: "app"}, {Stack: "network"}}, results)
+
+	// A refactor that renames the VPC and changes the service is caught.
+	planner.plans["network"].ResourceChanges[0].Address = "aws_vpc.this"
+	planner.plans["app"].ResourceChanges[0].Change.After = map[string]interface{}{"desired_count": 4}
+	results, err = snapshot.Verify(ctx, targets, opts)
+	require.NoError(t, err)
+	require.Equal(t, []snapshot.Result{
+		{Stack: "app", Changes: []string{"~ aws_ecs_service.app (update, was update)"}},
+		{Stack: "network", Changes: []string{"+ aws_vpc.this (no-op)", "- aws_vpc.main (no-op)"}},
+	}, results)
+
+	require.NoError(t, os.Remove(filepath.Join(root, "snapshots", "dev", "app.json")))
+	planner.errs = map[string]error{"network": errors.New("plan failed")}
+	results, err = snapshot.Verify(ctx, targets, opts)
+	require.NoError(t, err)
+	require.True(t, results[0].Missing)
+	require.EqualError(t, results[1].Err, "plan failed")
+}
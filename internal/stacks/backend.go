@@ -0,0 +1,360 @@
+package stacks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/hashicorp/terraform-exec/tfexec"
+	"github.com/zclconf/go-cty/cty"
+
+	"terraform-wrapper/internal/statelayout"
+)
+
+// Supported state backend types.
+const (
+	BackendS3             = "s3"
+	BackendAzureRM        = "azurerm"
+	BackendGCS            = "gcs"
+	BackendTerraformCloud = "remote"
+)
+
+// BackendFileName is the optional per-stack file that selects a state backend
+// other than the one configured for the whole repository.
+const BackendFileName = "backend.tfwrapper.json"
+
+// BackendSettings selects a state backend and holds its type-specific
+// settings. It is read from the backend block of terraform-wrapper.hcl or a
+// stack's backend.tfwrapper.json; an empty type means S3.
+type BackendSettings struct {
+	Type string `json:"type" hcl:"type"`
+	// azurerm
+	ResourceGroupName  string `json:"resource_group_name,omitempty" hcl:"resource_group_name,optional"`
+	StorageAccountName string `json:"storage_account_name,omitempty" hcl:"storage_account_name,optional"`
+	ContainerName      string `json:"container_name,omitempty" hcl:"container_name,optional"`
+	// gcs
+	Bucket string `json:"bucket,omitempty" hcl:"bucket,optional"`
+	// Terraform Cloud / Enterprise
+	Hostname     string `json:"hostname,omitempty" hcl:"hostname,optional"`
+	Organization string `json:"organization,omitempty" hcl:"organization,optional"`
+	// s3: BucketTemplate and KeyTemplate name the state bucket and key with
+	// Go templates instead of the conventional layout; see StateNaming.
+	BucketTemplate string `json:"bucket_template,omitempty" hcl:"bucket_template,optional"`
+	KeyTemplate    string `json:"key_template,omitempty" hcl:"key_template,optional"`
+	// s3: UseDynamoDBLock locks state with a DynamoDB table rather than an
+	// S3 lock file. DynamoDBTable names the table, <bucket>-lock by default.
+	UseDynamoDBLock bool   `json:"use_dynamodb_lock,omitempty" hcl:"use_dynamodb_lock,optional"`
+	DynamoDBTable   string `json:"dynamodb_table,omitempty" hcl:"dynamodb_table,optional"`
+	// EnvironmentWorkspaces keeps each environment's state in a Terraform
+	// workspace named after it rather than under an environment key prefix.
+	EnvironmentWorkspaces bool `json:"environment_workspaces,omitempty" hcl:"environment_workspaces,optional"`
+}
+
+// BackendTarget identifies the state a backend configuration is built for.
+type BackendTarget struct {
+	Environment   string
+	Workspace     string
+	Stack         string
+	AccountID     string
+	Region        string
+	StateKMSKeyID string
+	// StackPath is the stack's slash-separated path from the repository
+	// root.
+	StackPath string
+	// KeyPattern, when set, names the S3 state key instead of StateKey; see
+	// statelayout.Validate.
+	KeyPattern string
+	// Naming names the S3 bucket and key; nil uses StateBucket and StateKey.
+	// A KeyPattern takes precedence over its key template.
+	Naming *StateNaming
+	// TerraformWorkspace, when set, is the Terraform workspace holding the
+	// state. The environment is then part of the workspace rather than the
+	// key, so the key's leading environment segment is dropped.
+	TerraformWorkspace string
+}
+
+// S3WorkspaceKeyPrefix is where the S3 backend keeps the state of Terraform
+// workspaces other than default: <prefix>/<workspace>/<key>.
+const S3WorkspaceKeyPrefix = "env:"
+
+// S3Key returns the S3 key of the target's state.
+func (t BackendTarget) S3Key() string {
+	key := t.s3ConfigKey()
+	if t.TerraformWorkspace == "" || t.TerraformWorkspace == "default" {
+		return key
+	}
+	return strings.Join([]string{S3WorkspaceKeyPrefix, t.TerraformWorkspace, key}, "/")
+}
+
+// S3Bucket returns the S3 bucket holding the target's state.
+func (t BackendTarget) S3Bucket() string {
+	return t.Naming.Bucket(t.nameVars())
+}
+
+// s3ConfigKey returns the key passed to the S3 backend, which the backend
+// places under S3WorkspaceKeyPrefix for a workspace.
+func (t BackendTarget) s3ConfigKey() string {
+	if t.KeyPattern == "" {
+		return t.scopedKey(t.Naming.Key(t.nameVars()))
+	}
+	return t.scopedKey(statelayout.Render(t.KeyPattern, statelayout.Vars{
+		Environment: t.Environment,
+		Workspace:   t.Workspace,
+		Stack:       t.Stack,
+		StackPath:   t.StackPath,
+	}))
+}
+
+func (t BackendTarget) nameVars() NameVars {
+	return NameVars{
+		AccountID: t.AccountID,
+		Region:    t.Region,
+		Env:       t.Environment,
+		Workspace: t.Workspace,
+		Stack:     t.Stack,
+		StackRel:  t.StackPath,
+	}
+}
+
+// scopedKey drops the environment from key when the target's state lives in
+// a Terraform workspace.
+func (t BackendTarget) scopedKey(key string) string {
+	if t.TerraformWorkspace == "" {
+		return key
+	}
+	return strings.TrimPrefix(key, t.Environment+"/")
+}
+
+// BackendProvider builds the partial backend configuration passed to
+// terraform init for a stack. Attributes of nested blocks use dotted keys,
+// such as workspaces.name.
+type BackendProvider interface {
+	Config(t BackendTarget) map[string]string
+}
+
+// S3Backend stores state in the conventional per-account bucket, under the
+// environment's key pattern, unless Naming templates either.
+type S3Backend struct {
+	Naming *StateNaming
+	// DynamoDBLock locks state with the DynamoDB table LockTable, or the
+	// bucket's StateLockTable when LockTable is empty.
+	DynamoDBLock bool
+	LockTable    string
+}
+
+func (b S3Backend) Config(t BackendTarget) map[string]string {
+	if b.Naming != nil {
+		t.Naming = b.Naming
+	}
+	bucket := t.S3Bucket()
+	config := map[string]string{
+		"bucket":  bucket,
+		"key":     t.s3ConfigKey(),
+		"region":  t.Region,
+		"encrypt": "true",
+	}
+	if t.StateKMSKeyID != "" {
+		config["kms_key_id"] = t.StateKMSKeyID
+	}
+	if b.DynamoDBLock {
+		config["dynamodb_table"] = b.LockTable
+		if b.LockTable == "" {
+			config["dynamodb_table"] = StateLockTable(bucket)
+		}
+	}
+	return config
+}
+
+// StateLockTable returns the conventional DynamoDB lock table of a state
+// bucket.
+func StateLockTable(bucket string) string {
+	return bucket + "-lock"
+}
+
+// AzureRMBackend stores state as blobs in an Azure storage container, using
+// the same key layout as S3.
+type AzureRMBackend struct {
+	ResourceGroupName  string
+	StorageAccountName string
+	ContainerName      string
+}
+
+func (b AzureRMBackend) Config(t BackendTarget) map[string]string {
+	return map[string]string{
+		"resource_group_name":  b.ResourceGroupName,
+		"storage_account_name": b.StorageAccountName,
+		"container_name":       b.ContainerName,
+		"key":                  t.scopedKey(StateKey(t.Environment, t.Workspace, t.Stack)),
+	}
+}
+
+// GCSBackend stores state in a Google Cloud Storage bucket under a prefix
+// per stack.
+type GCSBackend struct {
+	Bucket string
+}
+
+func (b GCSBackend) Config(t BackendTarget) map[string]string {
+	return map[string]string{
+		"bucket": b.Bucket,
+		"prefix": strings.TrimSuffix(t.scopedKey(StateKey(t.Environment, t.Workspace, t.Stack)), "/terraform.tfstate"),
+	}
+}
+
+// TerraformCloudBackend stores state in a Terraform Cloud or Enterprise
+// workspace named <env>[-<workspace>]-<stack>.
+type TerraformCloudBackend struct {
+	Hostname     string
+	Organization string
+}
+
+func (b TerraformCloudBackend) Config(t BackendTarget) map[string]string {
+	hostname := b.Hostname
+	if hostname == "" {
+		hostname = "app.terraform.io"
+	}
+	name := []string{t.Environment}
+	if t.Workspace != "" {
+		name = append(name, t.Workspace)
+	}
+	name = append(name, t.Stack)
+	return map[string]string{
+		"hostname":        hostname,
+		"organization":    b.Organization,
+		"workspaces.name": strings.Join(name, "-"),
+	}
+}
+
+// NewBackendProvider returns the provider for settings, defaulting to S3.
+func NewBackendProvider(settings *BackendSettings) (BackendProvider, error) {
+	if settings == nil {
+		return S3Backend{}, nil
+	}
+	var missing []string
+	require := func(name, value string) {
+		if value == "" {
+			missing = append(missing, name)
+		}
+	}
+	var provider BackendProvider
+	naming, err := settings.Naming()
+	if err != nil {
+		return nil, err
+	}
+	if naming != nil && settings.Type != "" && settings.Type != BackendS3 {
+		return nil, fmt.Errorf("bucket_template and key_template apply to the s3 state backend only, not %s", settings.Type)
+	}
+	if (settings.UseDynamoDBLock || settings.DynamoDBTable != "") && settings.Type != "" && settings.Type != BackendS3 {
+		return nil, fmt.Errorf("use_dynamodb_lock and dynamodb_table apply to the s3 state backend only, not %s", settings.Type)
+	}
+	if settings.DynamoDBTable != "" && !settings.UseDynamoDBLock {
+		return nil, errors.New("dynamodb_table needs use_dynamodb_lock = true")
+	}
+	switch settings.Type {
+	case "", BackendS3:
+		provider = S3Backend{Naming: naming, DynamoDBLock: settings.UseDynamoDBLock, LockTable: settings.DynamoDBTable}
+	case BackendAzureRM:
+		require("resource_group_name", settings.ResourceGroupName)
+		require("storage_account_name", settings.StorageAccountName)
+		require("container_name", settings.ContainerName)
+		provider = AzureRMBackend{
+			ResourceGroupName:  settings.ResourceGroupName,
+			StorageAccountName: settings.StorageAccountName,
+			ContainerName:      settings.ContainerName,
+		}
+	case BackendGCS:
+		require("bucket", settings.Bucket)
+		provider = GCSBackend{Bucket: settings.Bucket}
+	case BackendTerraformCloud:
+		if settings.EnvironmentWorkspaces {
+			return nil, errors.New("remote state backend does not support environment_workspaces: each stack and environment already has its own Terraform Cloud workspace")
+		}
+		require("organization", settings.Organization)
+		provider = TerraformCloudBackend{Hostname: settings.Hostname, Organization: settings.Organization}
+	default:
+		return nil, fmt.Errorf("unknown state backend type %q (expected s3, azurerm, gcs or remote)", settings.Type)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%s state backend requires %s", settings.Type, strings.Join(missing, ", "))
+	}
+	return provider, nil
+}
+
+// Naming parses the settings' bucket and key templates; nil settings, like
+// settings without templates, use the conventional layout.
+func (s *BackendSettings) Naming() (*StateNaming, error) {
+	if s == nil {
+		return nil, nil
+	}
+	return ParseStateNaming(s.BucketTemplate, s.KeyTemplate)
+}
+
+// LoadBackendSettings reads stackDir/backend.tfwrapper.json, returning nil
+// when the stack does not override the backend.
+func LoadBackendSettings(stackDir string) (*BackendSettings, error) {
+	path := filepath.Join(stackDir, BackendFileName)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	var settings BackendSettings
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("invalid JSON in %s: %w", path, err)
+	}
+	return &settings, nil
+}
+
+// backendInitOptions turns a backend configuration into terraform init
+// options. Flat configurations are passed as -backend-config=key=value;
+// nested blocks cannot be, so those configurations are written to a partial
+// configuration file under the stack's .terraform directory instead.
+func backendInitOptions(stackDir string, config map[string]string) ([]tfexec.InitOption, error) {
+	keys := make([]string, 0, len(config))
+	nested := false
+	for k := range config {
+		keys = append(keys, k)
+		nested = nested || strings.Contains(k, ".")
+	}
+	sort.Strings(keys)
+
+	if !nested {
+		opts := make([]tfexec.InitOption, 0, len(keys))
+		for _, k := range keys {
+			opts = append(opts, tfexec.BackendConfig(fmt.Sprintf("%s=%s", k, config[k])))
+		}
+		return opts, nil
+	}
+
+	file := hclwrite.NewEmptyFile()
+	body := file.Body()
+	blocks := make(map[string]*hclwrite.Body)
+	for _, k := range keys {
+		block, attr, ok := strings.Cut(k, ".")
+		if !ok {
+			body.SetAttributeValue(k, cty.StringVal(config[k]))
+			continue
+		}
+		if blocks[block] == nil {
+			blocks[block] = body.AppendNewBlock(block, nil).Body()
+		}
+		blocks[block].SetAttributeValue(attr, cty.StringVal(config[k]))
+	}
+
+	dir := filepath.Join(stackDir, ".terraform")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create %s: %w", dir, err)
+	}
+	path := filepath.Join(dir, "terraform-wrapper.tfbackend")
+	if err := os.WriteFile(path, file.Bytes(), 0o600); err != nil {
+		return nil, fmt.Errorf("write backend configuration: %w", err)
+	}
+	return []tfexec.InitOption{tfexec.BackendConfig(path)}, nil
+}
@@ -0,0 +1,121 @@
+package stacks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-exec/tfexec"
+)
+
+// StateBackupPath returns where the state of stackRel is saved before each
+// apply, so a partially failed apply can be rolled back.
+func StateBackupPath(root, env, workspace, stackRel string) string {
+	return filepath.Join(stateBackupDir(root, env, workspace, stackRel), "pre-apply.tfstate")
+}
+
+// StatePatchBackupPath returns where the state of stackRel is saved before a
+// state patch made at the given time is pushed.
+func StatePatchBackupPath(root, env, workspace, stackRel string, at time.Time) string {
+	name := "pre-patch-" + at.UTC().Format("20060102T150405Z") + ".tfstate"
+	return filepath.Join(stateBackupDir(root, env, workspace, stackRel), name)
+}
+
+// StateMoveBackupPath returns where the state of stackRel is saved before
+// state mv-stack made at the given time pushes it.
+func StateMoveBackupPath(root, env, workspace, stackRel string, at time.Time) string {
+	name := "pre-move-" + at.UTC().Format("20060102T150405Z") + ".tfstate"
+	return filepath.Join(stateBackupDir(root, env, workspace, stackRel), name)
+}
+
+func stateBackupDir(root, env, workspace, stackRel string) string {
+	dir := filepath.Join(root, ".terraform-wrapper", "backups", env)
+	if workspace != "" {
+		dir = filepath.Join(dir, "workspaces", workspace)
+	}
+	return filepath.Join(dir, stackRel)
+}
+
+// BackupPath returns the pre-apply state backup path for stackDir.
+func (r *Runner) BackupPath(stackDir string) (string, error) {
+	rel, err := filepath.Rel(r.root, stackDir)
+	if err != nil {
+		return "", err
+	}
+	return StateBackupPath(r.root, r.environment, r.workspace, rel), nil
+}
+
+// StateBackups keeps copies of stack state outside the stack's backend.
+type StateBackups interface {
+	// Save stores state as a backup of stackRel and returns where.
+	Save(ctx context.Context, stackRel string, state []byte) (string, error)
+}
+
+// backupState saves the stack's current remote state, and uploads it to the
+// runner's state backups when set. A stack without state yet has nothing to
+// restore and is skipped.
+func (r *Runner) backupState(ctx context.Context, stackDir string) error {
+	state, err := r.pullQuietly(ctx, stackDir)
+	if err != nil || state == "" {
+		return err
+	}
+	path, err := r.BackupPath(stackDir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(state), 0o600); err != nil {
+		return err
+	}
+	return r.uploadBackup(ctx, stackDir, state)
+}
+
+// backupStateRemotely uploads the stack's current remote state to the
+// runner's state backups, if any.
+func (r *Runner) backupStateRemotely(ctx context.Context, stackDir string) error {
+	if r.stateBackups == nil {
+		return nil
+	}
+	state, err := r.pullQuietly(ctx, stackDir)
+	if err != nil || state == "" {
+		return err
+	}
+	return r.uploadBackup(ctx, stackDir, state)
+}
+
+func (r *Runner) uploadBackup(ctx context.Context, stackDir, state string) error {
+	if r.stateBackups == nil {
+		return nil
+	}
+	rel, err := filepath.Rel(r.root, stackDir)
+	if err != nil {
+		return err
+	}
+	_, err = r.stateBackups.Save(ctx, filepath.ToSlash(rel), []byte(state))
+	return err
+}
+
+// pullQuietly returns the stack's remote state, or "" when it has none. The
+// state is pulled with a separate executor so it is not echoed to stdout.
+func (r *Runner) pullQuietly(ctx context.Context, stackDir string) (string, error) {
+	tf, err := tfexec.NewTerraform(stackDir, r.terraformPath)
+	if err != nil {
+		return "", err
+	}
+	if err := r.setEnv(ctx, tf, stackDir); err != nil {
+		return "", err
+	}
+	state, err := tf.StatePull(ctx)
+	if err != nil {
+		return "", fmt.Errorf("pull state: %w", err)
+	}
+	if strings.TrimSpace(state) == "" {
+		return "", nil
+	}
+	return state, nil
+}
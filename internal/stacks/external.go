@@ -0,0 +1,229 @@
+package stacks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// ExternalDependency is a stack managed by another repository whose state a
+// stack reads. Its outputs are passed to the stack, read-only, as the value
+// of the variable Name.
+type ExternalDependency struct {
+	Name   string `json:"name"`
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	// Region is the bucket's region; the runner's region when empty.
+	Region string `json:"region,omitempty"`
+}
+
+func (d ExternalDependency) String() string {
+	return fmt.Sprintf("%s (s3://%s/%s)", d.Name, d.Bucket, d.Key)
+}
+
+// StackExternalDependencies returns the external dependencies declared under
+// dependencies.external in a stack's dependencies.json.
+func StackExternalDependencies(stackDir string) ([]ExternalDependency, error) {
+	path := filepath.Join(stackDir, "dependencies.json")
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	var deps struct {
+		Dependencies struct {
+			External []ExternalDependency `json:"external"`
+		} `json:"dependencies"`
+	}
+	if err := json.Unmarshal(data, &deps); err != nil {
+		return nil, fmt.Errorf("invalid JSON in %s: %w", path, err)
+	}
+	seen := make(map[string]bool)
+	for _, dep := range deps.Dependencies.External {
+		if dep.Bucket == "" || dep.Key == "" {
+			return nil, fmt.Errorf("invalid dependencies.external entry in %s: bucket and key are required", path)
+		}
+		if !hclsyntax.ValidIdentifier(dep.Name) {
+			return nil, fmt.Errorf("invalid dependencies.external entry in %s: name %q is not a valid variable name", path, dep.Name)
+		}
+		if seen[dep.Name] {
+			return nil, fmt.Errorf("invalid dependencies.external entry in %s: name %q is used twice", path, dep.Name)
+		}
+		seen[dep.Name] = true
+	}
+	return deps.Dependencies.External, nil
+}
+
+// ExternalOutputSource returns the outputs recorded in an external state.
+type ExternalOutputSource interface {
+	Outputs(ctx context.Context, dep ExternalDependency) (map[string]json.RawMessage, error)
+}
+
+// ExternalStateAPI captures the S3 operation required to read external state.
+type ExternalStateAPI interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// ExternalStates reads external state objects from S3 with the caller's
+// default credentials. Outputs are cached, so every stack reading the same
+// external state shares one download.
+type ExternalStates struct {
+	Region string
+	// NewClient returns a client for a region. Nil uses the default AWS
+	// configuration.
+	NewClient func(ctx context.Context, region string) (ExternalStateAPI, error)
+
+	mu      sync.Mutex
+	clients map[string]ExternalStateAPI
+	outputs map[ExternalDependency]map[string]json.RawMessage
+}
+
+// Outputs returns the output values of dep's state. A missing state object is
+// an error: the dependent stack cannot be planned without it.
+func (e *ExternalStates) Outputs(ctx context.Context, dep ExternalDependency) (map[string]json.RawMessage, error) {
+	if dep.Region == "" {
+		dep.Region = e.Region
+	}
+	cacheKey := dep
+	cacheKey.Name = ""
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if outputs, ok := e.outputs[cacheKey]; ok {
+		return outputs, nil
+	}
+
+	client, err := e.client(ctx, dep.Region)
+	if err != nil {
+		return nil, err
+	}
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(dep.Bucket),
+		Key:    aws.String(dep.Key),
+	})
+	if err != nil {
+		var noKey *s3types.NoSuchKey
+		if errors.As(err, &noKey) {
+			return nil, fmt.Errorf("state s3://%s/%s does not exist", dep.Bucket, dep.Key)
+		}
+		return nil, fmt.Errorf("read state s3://%s/%s: %w", dep.Bucket, dep.Key, err)
+	}
+	data, err := io.ReadAll(out.Body)
+	if cerr := out.Body.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read state s3://%s/%s: %w", dep.Bucket, dep.Key, err)
+	}
+
+	outputs, err := stateOutputs(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid state s3://%s/%s: %w", dep.Bucket, dep.Key, err)
+	}
+
+	if e.outputs == nil {
+		e.outputs = make(map[ExternalDependency]map[string]json.RawMessage)
+	}
+	e.outputs[cacheKey] = outputs
+	return outputs, nil
+}
+
+// LocalExternalStates reads external states from files, for planning
+// without access to the buckets holding them. The state of a dependency is
+// read from <Dir>/<bucket>/<key>.
+type LocalExternalStates struct {
+	Dir string
+}
+
+// Outputs returns the output values of dep's state file.
+func (l *LocalExternalStates) Outputs(ctx context.Context, dep ExternalDependency) (map[string]json.RawMessage, error) {
+	path := LocalExternalStatePath(l.Dir, dep)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read local copy of s3://%s/%s: %w", dep.Bucket, dep.Key, err)
+	}
+	outputs, err := stateOutputs(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid state %s: %w", path, err)
+	}
+	return outputs, nil
+}
+
+// LocalExternalStatePath returns where LocalExternalStates reads the state
+// of dep.
+func LocalExternalStatePath(dir string, dep ExternalDependency) string {
+	return filepath.Join(dir, dep.Bucket, filepath.FromSlash(dep.Key))
+}
+
+// stateOutputs returns the output values recorded in a raw state.
+func stateOutputs(data []byte) (map[string]json.RawMessage, error) {
+	recorded, err := StateOutputs(data)
+	if err != nil {
+		return nil, err
+	}
+	outputs := make(map[string]json.RawMessage, len(recorded))
+	for name, output := range recorded {
+		outputs[name] = output.Value
+	}
+	return outputs, nil
+}
+
+func (e *ExternalStates) client(ctx context.Context, region string) (ExternalStateAPI, error) {
+	if client, ok := e.clients[region]; ok {
+		return client, nil
+	}
+	var client ExternalStateAPI
+	if e.NewClient != nil {
+		var err error
+		if client, err = e.NewClient(ctx, region); err != nil {
+			return nil, err
+		}
+	} else {
+		cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+		if err != nil {
+			return nil, fmt.Errorf("load AWS config: %w", err)
+		}
+		client = s3.NewFromConfig(cfg)
+	}
+	if e.clients == nil {
+		e.clients = make(map[string]ExternalStateAPI)
+	}
+	e.clients[region] = client
+	return client, nil
+}
+
+// ExternalValues returns, for each external dependency of stackDir, the JSON
+// object of the external state's outputs keyed by the dependency's name.
+// JSON is also valid HCL, so the values can be passed as TF_VAR_ variables.
+func (r *Runner) ExternalValues(ctx context.Context, stackDir string) (map[string]string, error) {
+	deps, err := StackExternalDependencies(stackDir)
+	if err != nil || len(deps) == 0 {
+		return nil, err
+	}
+	values := make(map[string]string, len(deps))
+	for _, dep := range deps {
+		outputs, err := r.external.Outputs(ctx, dep)
+		if err != nil {
+			return nil, fmt.Errorf("external dependency %s: %w", dep, err)
+		}
+		encoded, err := json.Marshal(outputs)
+		if err != nil {
+			return nil, fmt.Errorf("external dependency %s: %w", dep, err)
+		}
+		values[dep.Name] = string(encoded)
+	}
+	return values, nil
+}
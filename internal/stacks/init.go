@@ -2,10 +2,11 @@ package stacks
 
 import (
 	"context"
-	"fmt"
 	"path/filepath"
 
 	"github.com/hashicorp/terraform-exec/tfexec"
+
+	"terraform-wrapper/internal/plugincache"
 )
 
 type InitOptions struct {
@@ -14,7 +15,10 @@ type InitOptions struct {
 	Environment   string
 	AccountID     string
 	Region        string
+	Workspace     string
 	Upgrade       bool
+	StateBackend  *BackendSettings
+	AssumeRoleARN string
 }
 
 func Init(ctx context.Context, stackDir string, opts InitOptions) error {
@@ -24,6 +28,9 @@ func Init(ctx context.Context, stackDir string, opts InitOptions) error {
 		Environment:   optionOrDefault(opts.Environment, "dev"),
 		AccountID:     optionOrDefault(opts.AccountID, "636728427214"),
 		Region:        optionOrDefault(opts.Region, "eu-west-2"),
+		Workspace:     opts.Workspace,
+		StateBackend:  opts.StateBackend,
+		AssumeRoleARN: opts.AssumeRoleARN,
 	}
 
 	runner, err := NewRunner(ctx, runnerOpts)
@@ -36,22 +43,29 @@ func Init(ctx context.Context, stackDir string, opts InitOptions) error {
 		return err
 	}
 
-	tf, err := runner.newTerraform(stackAbs)
+	tf, err := runner.newTerraform(ctx, stackAbs)
 	if err != nil {
 		return err
 	}
 
-	backend := runner.backendConfig(stackAbs)
-
-	var initOpts []tfexec.InitOption
-	for k, v := range backend {
-		initOpts = append(initOpts, tfexec.BackendConfig(fmt.Sprintf("%s=%s", k, v)))
+	initOpts, err := runner.BackendInitOptions(stackAbs)
+	if err != nil {
+		return err
 	}
 	if opts.Upgrade {
 		initOpts = append([]tfexec.InitOption{tfexec.Upgrade(true)}, initOpts...)
 	}
 
-	return tf.Init(ctx, initOpts...)
+	release, err := plugincache.Lock(ctx)
+	if err != nil {
+		return err
+	}
+	err = tf.Init(ctx, initOpts...)
+	release()
+	if err != nil {
+		return err
+	}
+	return runner.SelectWorkspace(ctx, tf, stackAbs)
 }
 
 func optionOrDefault(value, fallback string) string {
@@ -0,0 +1,45 @@
+package stacks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ProviderMirrorDir is the filesystem mirror a provider bundle is imported
+// into. While it exists, init installs providers only from it.
+func ProviderMirrorDir(root string) string {
+	return filepath.Join(root, ".terraform-wrapper", "provider-mirror")
+}
+
+// MirrorProviders downloads the providers stackDir requires into the
+// filesystem mirror dir, for each of platforms. Modules are installed first,
+// since their provider requirements count too; the backend is not touched.
+func (r *Runner) MirrorProviders(ctx context.Context, stackDir, dir string, platforms []string) error {
+	tf, err := r.newTerraform(ctx, stackDir)
+	if err != nil {
+		return err
+	}
+	if err := r.retry(ctx, stackDir, func() error { return tf.Get(ctx) }); err != nil {
+		return fmt.Errorf("install modules: %w", err)
+	}
+
+	args := []string{"providers", "mirror"}
+	for _, platform := range platforms {
+		args = append(args, "-platform="+platform)
+	}
+	args = append(args, dir)
+	return r.retry(ctx, stackDir, func() error {
+		cmd := exec.CommandContext(ctx, r.terraformPath, args...)
+		cmd.Dir = stackDir
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("terraform %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+		}
+		return nil
+	})
+}
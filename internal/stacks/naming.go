@@ -0,0 +1,128 @@
+package stacks
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// NameVars are the fields available to the state bucket and key templates.
+type NameVars struct {
+	AccountID string
+	Region    string
+	Env       string
+	// Workspace is the --workspace the state is scoped to, "" without one.
+	Workspace string
+	// Stack is the stack's directory name and StackRel its slash-separated
+	// path from the repository root.
+	Stack    string
+	StackRel string
+}
+
+// StateNaming names state buckets and keys with Go templates, so existing
+// layouts such as {{.AccountID}}-{{.Env}}-tfstate can be adopted without
+// renaming buckets. A nil *StateNaming, or an empty template, uses
+// StateBucket and StateKey.
+type StateNaming struct {
+	bucket *template.Template
+	key    *template.Template
+	// keyHasWorkspace is whether keys differ between workspaces.
+	keyHasWorkspace bool
+}
+
+// ParseStateNaming parses the bucket and key templates, either of which may
+// be empty. Templates are rendered with sample values so unknown fields are
+// reported up front.
+func ParseStateNaming(bucket, key string) (*StateNaming, error) {
+	if bucket == "" && key == "" {
+		return nil, nil
+	}
+	naming := &StateNaming{}
+	sample := NameVars{AccountID: "123456789012", Region: "eu-west-2", Env: "dev", Stack: "network", StackRel: "core/network"}
+	if bucket != "" {
+		tmpl, err := template.New("bucket_template").Option("missingkey=error").Parse(bucket)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bucket_template: %w", err)
+		}
+		name, err := render(tmpl, sample)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bucket_template: %w", err)
+		}
+		if name == "" || strings.ContainsAny(name, "/ ") {
+			return nil, fmt.Errorf("invalid bucket_template: %q is not a bucket name", name)
+		}
+		// The bucket also holds locks, freezes and run markers, which
+		// belong to no stack.
+		other := NameVars{AccountID: sample.AccountID, Region: sample.Region, Env: sample.Env, Workspace: "blue", Stack: "dns", StackRel: "dns"}
+		if scoped, err := render(tmpl, other); err != nil || scoped != name {
+			return nil, fmt.Errorf("invalid bucket_template: only {{.AccountID}}, {{.Region}} and {{.Env}} can be used")
+		}
+		naming.bucket = tmpl
+	}
+	if key != "" {
+		tmpl, err := template.New("key_template").Option("missingkey=error").Parse(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key_template: %w", err)
+		}
+		blue, err := render(tmpl, withWorkspace(sample, "blue"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid key_template: %w", err)
+		}
+		green, err := render(tmpl, withWorkspace(sample, "green"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid key_template: %w", err)
+		}
+		if strings.HasPrefix(blue, "/") || strings.HasSuffix(blue, "/") {
+			return nil, fmt.Errorf("invalid key_template: %q is not an object key", blue)
+		}
+		naming.key = tmpl
+		naming.keyHasWorkspace = blue != green
+	}
+	return naming, nil
+}
+
+// Bucket returns the state bucket for v.
+func (n *StateNaming) Bucket(v NameVars) string {
+	if n == nil || n.bucket == nil {
+		return StateBucket(v.AccountID, v.Region)
+	}
+	name, _ := render(n.bucket, v)
+	return name
+}
+
+// Key returns the state key for v.
+func (n *StateNaming) Key(v NameVars) string {
+	if n == nil || n.key == nil {
+		return StateKey(v.Env, v.Workspace, v.Stack)
+	}
+	key, _ := render(n.key, v)
+	return key
+}
+
+// HasKeyTemplate reports whether keys are named by a template rather than
+// the default layout.
+func (n *StateNaming) HasKeyTemplate() bool {
+	return n != nil && n.key != nil
+}
+
+// ValidateWorkspace rejects a --workspace the key template cannot tell apart
+// from the environment's own state.
+func (n *StateNaming) ValidateWorkspace(workspace string) error {
+	if workspace != "" && n.HasKeyTemplate() && !n.keyHasWorkspace {
+		return fmt.Errorf("--workspace %s needs a key_template that uses {{.Workspace}}, or the workspace would share the environment's state", workspace)
+	}
+	return nil
+}
+
+func render(tmpl *template.Template, v NameVars) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, v); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+func withWorkspace(v NameVars, workspace string) NameVars {
+	v.Workspace = workspace
+	return v
+}
@@ -0,0 +1,223 @@
+package stacks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// stateLockClass names the matcher of failures to acquire the state lock,
+// which LockWait retries for longer than other transient failures.
+const stateLockClass = "state lock"
+
+// RetryMatcher classifies a terraform failure as transient when its message
+// matches Pattern.
+type RetryMatcher struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// DefaultRetryMatchers recognise failures that usually succeed when retried:
+// state locks held briefly by another run, AWS and registry throttling,
+// provider downloads and dropped connections.
+var DefaultRetryMatchers = []RetryMatcher{
+	{Name: stateLockClass, Pattern: regexp.MustCompile(`Error acquiring the state lock`)},
+	{Name: "throttling", Pattern: regexp.MustCompile(`(?i)throttl|rate exceeded|TooManyRequests|SlowDown|RequestLimitExceeded`)},
+	{Name: "provider download", Pattern: regexp.MustCompile(`(?i)failed to install provider|failed to query available provider packages|could not connect to registry|error while installing`)},
+	{Name: "network", Pattern: regexp.MustCompile(`(?i)connection reset by peer|i/o timeout|TLS handshake timeout|unexpected EOF|no such host`)},
+}
+
+// RetryMatchers compiles user-supplied patterns and appends them to the
+// defaults.
+func RetryMatchers(patterns []string) ([]RetryMatcher, error) {
+	matchers := append([]RetryMatcher(nil), DefaultRetryMatchers...)
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retry pattern %q: %w", pattern, err)
+		}
+		matchers = append(matchers, RetryMatcher{Name: pattern, Pattern: re})
+	}
+	return matchers, nil
+}
+
+// RetryPolicy retries terraform commands that fail transiently. The zero
+// value runs every command once.
+type RetryPolicy struct {
+	// Attempts is the total number of tries, including the first.
+	Attempts int
+	// Delay is the wait before the first retry; it doubles for each
+	// following one.
+	Delay time.Duration
+	// LockWait, when set, keeps retrying a command that cannot acquire the
+	// state lock until it has run this long, however many attempts that
+	// takes. Terraform also waits for the lock itself on each attempt, for up
+	// to LockTimeout.
+	LockWait time.Duration
+	// Matchers classify transient failures. Nil means DefaultRetryMatchers.
+	Matchers []RetryMatcher
+	// OnTransient, when set, is called with the matcher name of every
+	// transient failure, including one left when attempts run out.
+	OnTransient func(class string)
+}
+
+// Classify returns the name of the matcher recognising err as transient, or
+// "" when err should not be retried.
+func (p RetryPolicy) Classify(err error) string {
+	if err == nil {
+		return ""
+	}
+	matchers := p.Matchers
+	if matchers == nil {
+		matchers = DefaultRetryMatchers
+	}
+	msg := err.Error()
+	for _, m := range matchers {
+		if m.Pattern.MatchString(msg) {
+			return m.Name
+		}
+	}
+	return ""
+}
+
+// LockTimeout returns how long each terraform command waits for a held state
+// lock before failing, passed as -lock-timeout: the retry delay, at most
+// LockWait. It is zero, leaving terraform's default, without LockWait.
+func (p RetryPolicy) LockTimeout() time.Duration {
+	if p.LockWait <= 0 {
+		return 0
+	}
+	return min(p.Delay, p.LockWait)
+}
+
+// Do runs fn until it succeeds, fails with an error that is not transient, or
+// runs out of attempts. label names what is retried in the warnings printed
+// before each retry. A failure to acquire the state lock is retried until
+// LockWait has passed, and the error left then names the lock's holder.
+func (p RetryPolicy) Do(ctx context.Context, label string, fn func() error) error {
+	start := time.Now()
+	delay := p.Delay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		class := p.Classify(err)
+		if class != "" && p.OnTransient != nil {
+			p.OnTransient(class)
+		}
+		if class == "" {
+			return err
+		}
+		if class == stateLockClass && p.LockWait > 0 {
+			remaining := p.LockWait - time.Since(start)
+			if remaining <= 0 {
+				return stateLockError(err, time.Since(start))
+			}
+			wait := min(delay, remaining)
+			fmt.Fprintf(os.Stderr, "[retry] %s: the state lock is held%s, retrying in %s (waiting up to %s)\n", label, lockHolderSuffix(err), wait.Round(time.Second), p.LockWait)
+			if !sleep(ctx, wait) {
+				return stateLockError(err, time.Since(start))
+			}
+			delay *= 2
+			continue
+		}
+		if attempt >= p.Attempts {
+			if class == stateLockClass {
+				return stateLockError(err, time.Since(start))
+			}
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "[retry] %s: transient %s failure, retrying in %s (attempt %d of %d)\n", label, class, delay, attempt+1, p.Attempts)
+		if !sleep(ctx, delay) {
+			return err
+		}
+		delay *= 2
+	}
+}
+
+// sleep waits for d, reporting false when ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// StateLockHolder is the lock info terraform reports when the state lock is
+// held by another process.
+type StateLockHolder struct {
+	ID        string
+	Path      string
+	Operation string
+	Who       string
+	Version   string
+	Created   string
+}
+
+var lockInfoField = regexp.MustCompile(`(?m)^[│\s]*(ID|Path|Operation|Who|Version|Created):[ \t]*(.*?)[ \t]*$`)
+
+// ParseStateLockHolder reads the "Lock Info:" block of a terraform error
+// about a held state lock.
+func ParseStateLockHolder(msg string) (StateLockHolder, bool) {
+	i := strings.Index(msg, "Lock Info:")
+	if i < 0 {
+		return StateLockHolder{}, false
+	}
+	var h StateLockHolder
+	for _, m := range lockInfoField.FindAllStringSubmatch(msg[i:], -1) {
+		switch m[1] {
+		case "ID":
+			h.ID = m[2]
+		case "Path":
+			h.Path = m[2]
+		case "Operation":
+			h.Operation = m[2]
+		case "Who":
+			h.Who = m[2]
+		case "Version":
+			h.Version = m[2]
+		case "Created":
+			h.Created = m[2]
+		}
+	}
+	return h, h.ID != "" || h.Who != ""
+}
+
+func (h StateLockHolder) String() string {
+	s := h.Who
+	if s == "" {
+		s = "another process"
+	}
+	if h.Operation != "" {
+		s += " for " + strings.TrimPrefix(h.Operation, "OperationType")
+	}
+	if h.Created != "" {
+		s += " since " + h.Created
+	}
+	if h.ID != "" {
+		s += " (lock ID " + h.ID + ")"
+	}
+	return s
+}
+
+func lockHolderSuffix(err error) string {
+	if h, ok := ParseStateLockHolder(err.Error()); ok {
+		return " by " + h.String()
+	}
+	return ""
+}
+
+// stateLockError puts the holder of the state lock first in err, so run
+// summaries name who to ask before the lock is released or force-unlocked.
+func stateLockError(err error, waited time.Duration) error {
+	if h, ok := ParseStateLockHolder(err.Error()); ok {
+		return fmt.Errorf("state lock still held by %s after %s: %w", h, waited.Round(time.Second), err)
+	}
+	return err
+}
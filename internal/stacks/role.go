@@ -0,0 +1,124 @@
+package stacks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/terraform-exec/tfexec"
+
+	"terraform-wrapper/internal/awsaccount"
+	"terraform-wrapper/internal/featureflags"
+)
+
+// CredentialSource exchanges a role ARN for temporary AWS credentials,
+// returned as environment variables for terraform.
+type CredentialSource interface {
+	RoleEnv(ctx context.Context, roleARN string) (map[string]string, error)
+}
+
+// StackRoleARN returns the assume_role_arn a stack's dependencies.json sets to
+// run it in another AWS account, or "" when it uses the default role.
+func StackRoleARN(stackDir string) (string, error) {
+	path := filepath.Join(stackDir, "dependencies.json")
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", path, err)
+	}
+	var deps struct {
+		AssumeRoleARN string `json:"assume_role_arn"`
+	}
+	if err := json.Unmarshal(data, &deps); err != nil {
+		return "", fmt.Errorf("invalid JSON in %s: %w", path, err)
+	}
+	return deps.AssumeRoleARN, nil
+}
+
+// roleARN returns the role terraform assumes for stackDir: the stack's own
+// override, else the runner's default.
+func (r *Runner) roleARN(stackDir string) (string, error) {
+	role, err := StackRoleARN(stackDir)
+	if err != nil {
+		return "", err
+	}
+	if role == "" {
+		role = r.assumeRoleARN
+	}
+	return role, nil
+}
+
+// accountFor returns the account whose state bucket holds stackDir's state.
+// Stacks run under an assumed role keep their state in the role's account.
+func (r *Runner) accountFor(stackDir string) (string, error) {
+	role, err := r.roleARN(stackDir)
+	if err != nil || role == "" {
+		return r.accountID, err
+	}
+	return awsaccount.AccountIDFromRoleARN(role)
+}
+
+// Env returns the environment terraform runs with for stackDir. It is nil,
+// meaning the wrapper's own environment, unless the stack runs under an
+// assumed role, in which case the role's credentials replace the caller's,
+// has external dependencies, whose outputs are set as TF_VAR_<name>, or the
+// environment has feature flags, set as TF_VAR_feature_flags. Terraform
+// ignores TF_VAR_ variables the stack does not declare.
+func (r *Runner) Env(ctx context.Context, stackDir string) (map[string]string, error) {
+	role, err := r.roleARN(stackDir)
+	if err != nil {
+		return nil, err
+	}
+	external, err := r.ExternalValues(ctx, stackDir)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" && len(external) == 0 && r.featureFlags == nil {
+		return nil, nil
+	}
+
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+	env = tfexec.CleanEnv(env)
+	for name, value := range external {
+		env["TF_VAR_"+name] = value
+	}
+	if r.featureFlags != nil {
+		env["TF_VAR_"+featureflags.Variable] = r.featureFlags.Value()
+	}
+	if role == "" {
+		return env, nil
+	}
+
+	if _, err := awsaccount.AccountIDFromRoleARN(role); err != nil {
+		return nil, err
+	}
+	creds, err := r.credentials.RoleEnv(ctx, role)
+	if err != nil {
+		return nil, err
+	}
+	// Drop the caller's profile so nothing falls back to its credentials.
+	delete(env, "AWS_PROFILE")
+	for k, v := range creds {
+		env[k] = v
+	}
+	return env, nil
+}
+
+func (r *Runner) setEnv(ctx context.Context, tf *tfexec.Terraform, stackDir string) error {
+	env, err := r.Env(ctx, stackDir)
+	if err != nil || env == nil {
+		return err
+	}
+	return tf.SetEnv(env)
+}
@@ -3,20 +3,54 @@ package stacks
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/hashicorp/terraform-exec/tfexec"
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"terraform-wrapper/internal/awsaccount"
+	"terraform-wrapper/internal/featureflags"
+	"terraform-wrapper/internal/logging"
+	"terraform-wrapper/internal/output"
+	"terraform-wrapper/internal/plugincache"
+	"terraform-wrapper/internal/statelayout"
 )
 
+var profilePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
 type Runner struct {
 	terraformPath  string
 	root           string
 	environment    string
 	accountID      string
 	region         string
+	profile        string
+	workspace      string
+	stateKMSKeyID  string
 	disableRefresh bool
+	disableLocking bool
+	backend        BackendProvider
+	assumeRoleARN  string
+	credentials    CredentialSource
+	external       ExternalOutputSource
+	prefixOutput   bool
+	group          *output.Group
+	extraVarFiles  []string
+	color          bool
+	retryPolicy    RetryPolicy
+	tfLog          string
+	tfLogDir       string
+	featureFlags   featureflags.Flags
+	keyPattern     string
+	stateBackups   StateBackups
+	backendChange  BackendChange
+	// envWorkspaces is the StateBackend's EnvironmentWorkspaces, which a
+	// stack's backend.tfwrapper.json overrides.
+	envWorkspaces bool
 }
 
 type RunnerOptions struct {
@@ -26,8 +60,71 @@ type RunnerOptions struct {
 	Region         string
 	TerraformPath  string
 	DisableRefresh bool
+	// Profile selects an optional tfvars variant layered over the
+	// environment, such as blue or green.
+	Profile string
+	// StateKMSKeyID, when set, encrypts remote state with this SSE-KMS key.
+	StateKMSKeyID string
+	// DisableLocking plans without acquiring the state lock.
+	DisableLocking bool
+	// Workspace, when set, scopes the stack's state key to that workspace.
+	Workspace string
+	// StateBackend selects the state backend for every stack without a
+	// backend.tfwrapper.json. Nil means S3.
+	StateBackend *BackendSettings
+	// AssumeRoleARN, when set, runs terraform with temporary credentials for
+	// this role. A stack's dependencies.json may set assume_role_arn instead.
+	AssumeRoleARN string
+	// Credentials obtains role credentials. Nil means STS with the caller's
+	// default credentials.
+	Credentials CredentialSource
+	// ExternalStates reads the outputs of external dependencies. Nil means S3
+	// with the caller's default credentials.
+	ExternalStates ExternalOutputSource
+	// PrefixOutput prefixes every line of terraform's output with the stack
+	// it belongs to, so the output of stacks running in parallel stays
+	// attributable. Color colours each stack's prefix differently.
+	PrefixOutput bool
+	Color        bool
+	// Group, when set, buffers terraform's output per stack instead of
+	// streaming it; the caller flushes each stack's block when it finishes.
+	Group *output.Group
+	// Retry retries terraform commands that fail transiently. The zero
+	// value runs each command once.
+	Retry RetryPolicy
+	// ExtraVarFiles are appended to every stack's var files, after the
+	// stack's own, for ad-hoc overrides.
+	ExtraVarFiles []string
+	// TFLog, when set to trace or debug, captures terraform's log at that
+	// level in a file per stack under TFLogDir.
+	TFLog string
+	// TFLogDir is the run's log directory, from triage.NewRunLogDir.
+	TFLogDir string
+	// StateBackups, when set, also receives the state saved before each
+	// apply, and the state before each destroy.
+	StateBackups StateBackups
+	// BackendChange says how InitOnly treats a backend whose configuration
+	// changed since the stack was last initialised.
+	BackendChange BackendChange
 }
 
+// BackendChange is how init handles a changed backend configuration, such as
+// a renamed state bucket or a new key convention.
+type BackendChange string
+
+const (
+	// BackendUnchanged fails init when the backend changed, as terraform
+	// does by default.
+	BackendUnchanged BackendChange = ""
+	// BackendMigrateState copies the existing state to the new backend.
+	// Terraform runs without input, so this is init -force-copy, which
+	// implies -migrate-state and answers its prompts.
+	BackendMigrateState BackendChange = "migrate-state"
+	// BackendReconfigure uses the new backend as it is, ignoring the state
+	// the previous one held.
+	BackendReconfigure BackendChange = "reconfigure"
+)
+
 func NewRunner(ctx context.Context, opts RunnerOptions) (*Runner, error) {
 	if opts.RootDir == "" {
 		opts.RootDir = "."
@@ -49,6 +146,35 @@ func NewRunner(ctx context.Context, opts RunnerOptions) (*Runner, error) {
 	if opts.TerraformPath == "" {
 		return nil, fmt.Errorf("terraform binary path is required")
 	}
+	backend, err := NewBackendProvider(opts.StateBackend)
+	if err != nil {
+		return nil, err
+	}
+	if opts.AssumeRoleARN != "" {
+		if _, err := awsaccount.AccountIDFromRoleARN(opts.AssumeRoleARN); err != nil {
+			return nil, err
+		}
+	}
+	credentials := opts.Credentials
+	if credentials == nil {
+		credentials = &awsaccount.RoleAssumer{
+			Region:      opts.Region,
+			SessionName: "terraform-wrapper-" + opts.Environment,
+		}
+	}
+
+	external := opts.ExternalStates
+	if external == nil {
+		external = &ExternalStates{Region: opts.Region}
+	}
+	flags, err := featureflags.Load(rootAbs, opts.Environment)
+	if err != nil {
+		return nil, err
+	}
+	keyPattern, err := statelayout.KeyPattern(rootAbs, opts.Environment)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Runner{
 		terraformPath:  opts.TerraformPath,
@@ -56,12 +182,32 @@ func NewRunner(ctx context.Context, opts RunnerOptions) (*Runner, error) {
 		environment:    opts.Environment,
 		accountID:      opts.AccountID,
 		region:         opts.Region,
+		profile:        opts.Profile,
+		workspace:      opts.Workspace,
+		stateKMSKeyID:  opts.StateKMSKeyID,
 		disableRefresh: opts.DisableRefresh,
+		disableLocking: opts.DisableLocking,
+		backend:        backend,
+		assumeRoleARN:  opts.AssumeRoleARN,
+		credentials:    credentials,
+		external:       external,
+		prefixOutput:   opts.PrefixOutput,
+		group:          opts.Group,
+		extraVarFiles:  opts.ExtraVarFiles,
+		color:          opts.Color,
+		retryPolicy:    opts.Retry,
+		tfLog:          opts.TFLog,
+		tfLogDir:       opts.TFLogDir,
+		featureFlags:   flags,
+		keyPattern:     keyPattern,
+		stateBackups:   opts.StateBackups,
+		backendChange:  opts.BackendChange,
+		envWorkspaces:  opts.StateBackend != nil && opts.StateBackend.EnvironmentWorkspaces,
 	}, nil
 }
 
 func (r *Runner) Plan(ctx context.Context, stackDir string) error {
-	tf, err := r.newTerraform(stackDir)
+	tf, err := r.newTerraform(ctx, stackDir)
 	if err != nil {
 		return err
 	}
@@ -70,27 +216,114 @@ func (r *Runner) Plan(ctx context.Context, stackDir string) error {
 		return err
 	}
 
-	_, err = tf.Plan(ctx, r.planOptions(stackDir)...)
-	return err
+	return r.retry(ctx, stackDir, func() error {
+		_, err := tf.Plan(ctx, r.planOptions(stackDir)...)
+		return err
+	})
 }
 
-func (r *Runner) PlanWithOutput(ctx context.Context, stackDir, planPath string) error {
-	tf, err := r.newTerraform(stackDir)
+// PlanWithOutput plans stackDir into planPath and reports whether the plan
+// contains changes.
+func (r *Runner) PlanWithOutput(ctx context.Context, stackDir, planPath string) (bool, error) {
+	tf, err := r.newTerraform(ctx, stackDir)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	if err := r.init(ctx, tf, stackDir, true); err != nil {
-		return err
+		return false, err
 	}
 
 	planOpts := append([]tfexec.PlanOption{tfexec.Out(planPath)}, r.planOptions(stackDir)...)
-	_, err = tf.Plan(ctx, planOpts...)
-	return err
+	return r.retryPlan(ctx, tf, stackDir, planOpts)
+}
+
+// PlanDestroy plans the destruction of every resource in stackDir into
+// planPath and reports whether there is anything to destroy.
+func (r *Runner) PlanDestroy(ctx context.Context, stackDir, planPath string) (bool, error) {
+	tf, err := r.newTerraform(ctx, stackDir)
+	if err != nil {
+		return false, err
+	}
+
+	if err := r.init(ctx, tf, stackDir, true); err != nil {
+		return false, err
+	}
+
+	planOpts := append([]tfexec.PlanOption{tfexec.Out(planPath), tfexec.Destroy(true)}, r.planOptions(stackDir)...)
+	return r.retryPlan(ctx, tf, stackDir, planOpts)
+}
+
+// RefreshOnlyPlan runs a refresh-only plan for stackDir and returns its JSON
+// representation, whose ResourceDrift lists resources changed outside Terraform.
+func (r *Runner) RefreshOnlyPlan(ctx context.Context, stackDir string) (*tfjson.Plan, error) {
+	tf, err := r.newTerraform(ctx, stackDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.init(ctx, tf, stackDir, false); err != nil {
+		return nil, err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "terraform-wrapper-drift-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+	planPath := filepath.Join(tmpDir, "drift.tfplan")
+
+	planOpts := []tfexec.PlanOption{tfexec.Out(planPath), tfexec.RefreshOnly(true)}
+	if timeout := r.lockTimeout(); timeout != "" {
+		planOpts = append(planOpts, tfexec.LockTimeout(timeout))
+	}
+	for _, vf := range r.varFiles(stackDir) {
+		planOpts = append(planOpts, tfexec.VarFile(vf))
+	}
+	if _, err := r.retryPlan(ctx, tf, stackDir, planOpts); err != nil {
+		return nil, err
+	}
+	return tf.ShowPlanFile(ctx, planPath)
+}
+
+// PlanJSON plans stackDir into a temporary plan file and returns its JSON
+// representation.
+func (r *Runner) PlanJSON(ctx context.Context, stackDir string) (*tfjson.Plan, error) {
+	tf, err := r.newTerraform(ctx, stackDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.init(ctx, tf, stackDir, false); err != nil {
+		return nil, err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "terraform-wrapper-snapshot-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+	planPath := filepath.Join(tmpDir, "snapshot.tfplan")
+
+	planOpts := append([]tfexec.PlanOption{tfexec.Out(planPath)}, r.planOptions(stackDir)...)
+	if _, err := r.retryPlan(ctx, tf, stackDir, planOpts); err != nil {
+		return nil, err
+	}
+	return tf.ShowPlanFile(ctx, planPath)
+}
+
+// ShowPlan returns the JSON representation of the plan file at planPath,
+// which was planned in stackDir.
+func (r *Runner) ShowPlan(ctx context.Context, stackDir, planPath string) (*tfjson.Plan, error) {
+	tf, err := r.newTerraform(ctx, stackDir)
+	if err != nil {
+		return nil, err
+	}
+	return tf.ShowPlanFile(ctx, planPath)
 }
 
 func (r *Runner) Apply(ctx context.Context, stackDir string) error {
-	tf, err := r.newTerraform(stackDir)
+	tf, err := r.newTerraform(ctx, stackDir)
 	if err != nil {
 		return err
 	}
@@ -98,12 +331,42 @@ func (r *Runner) Apply(ctx context.Context, stackDir string) error {
 	if err := r.init(ctx, tf, stackDir, true); err != nil {
 		return err
 	}
+	if err := r.backupState(ctx, stackDir); err != nil {
+		return fmt.Errorf("back up state before apply: %w", err)
+	}
+
+	return r.retry(ctx, stackDir, func() error {
+		return tf.Apply(ctx, r.applyOptions(stackDir)...)
+	})
+}
+
+// ApplyPlan applies the saved plan at planPath to stackDir. The plan carries
+// its own variables, so no var files are passed.
+func (r *Runner) ApplyPlan(ctx context.Context, stackDir, planPath string) error {
+	tf, err := r.newTerraform(ctx, stackDir)
+	if err != nil {
+		return err
+	}
 
-	return tf.Apply(ctx, r.applyOptions(stackDir)...)
+	// Upgrading could select providers other than those the plan recorded.
+	if err := r.init(ctx, tf, stackDir, false); err != nil {
+		return err
+	}
+	if err := r.backupState(ctx, stackDir); err != nil {
+		return fmt.Errorf("back up state before apply: %w", err)
+	}
+
+	return r.retry(ctx, stackDir, func() error {
+		opts := []tfexec.ApplyOption{tfexec.DirOrPlan(planPath)}
+		if timeout := r.lockTimeout(); timeout != "" {
+			opts = append(opts, tfexec.LockTimeout(timeout))
+		}
+		return tf.Apply(ctx, opts...)
+	})
 }
 
 func (r *Runner) Destroy(ctx context.Context, stackDir string) error {
-	tf, err := r.newTerraform(stackDir)
+	tf, err := r.newTerraform(ctx, stackDir)
 	if err != nil {
 		return err
 	}
@@ -111,24 +374,113 @@ func (r *Runner) Destroy(ctx context.Context, stackDir string) error {
 	if err := r.init(ctx, tf, stackDir, true); err != nil {
 		return err
 	}
+	if err := r.backupStateRemotely(ctx, stackDir); err != nil {
+		return fmt.Errorf("back up state before destroy: %w", err)
+	}
+
+	return r.retry(ctx, stackDir, func() error {
+		return tf.Destroy(ctx, r.destroyOptions(stackDir)...)
+	})
+}
+
+// Validate checks the configuration of stackDir and fails with its error
+// diagnostics when it is invalid.
+func (r *Runner) Validate(ctx context.Context, stackDir string) error {
+	tf, err := r.newTerraform(ctx, stackDir)
+	if err != nil {
+		return err
+	}
+
+	if err := r.init(ctx, tf, stackDir, false); err != nil {
+		return err
+	}
+
+	result, err := tf.Validate(ctx)
+	if err != nil {
+		return err
+	}
+	if result.Valid {
+		return nil
+	}
+	var problems []string
+	for _, diag := range result.Diagnostics {
+		if diag.Severity != tfjson.DiagnosticSeverityError {
+			continue
+		}
+		problem := diag.Summary
+		if diag.Range != nil {
+			problem = fmt.Sprintf("%s:%d: %s", diag.Range.Filename, diag.Range.Start.Line, problem)
+		}
+		problems = append(problems, problem)
+	}
+	return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+}
 
-	return tf.Destroy(ctx, r.destroyOptions(stackDir)...)
+// Outputs reads the outputs of an already initialised stack.
+func (r *Runner) Outputs(ctx context.Context, stackDir string) (map[string]tfexec.OutputMeta, error) {
+	tf, err := r.newTerraform(ctx, stackDir)
+	if err != nil {
+		return nil, err
+	}
+	return tf.Output(ctx)
 }
 
-func (r *Runner) newTerraform(stackDir string) (*tfexec.Terraform, error) {
+// LockProviders refreshes the dependency lock file for the given platforms
+// without initialising the backend.
+func (r *Runner) LockProviders(ctx context.Context, stackDir string, platforms []string) error {
+	tf, err := r.newTerraform(ctx, stackDir)
+	if err != nil {
+		return err
+	}
+	var opts []tfexec.ProvidersLockOption
+	for _, p := range platforms {
+		opts = append(opts, tfexec.Platform(p))
+	}
+	return tf.ProvidersLock(ctx, opts...)
+}
+
+func (r *Runner) newTerraform(ctx context.Context, stackDir string) (*tfexec.Terraform, error) {
 	tf, err := tfexec.NewTerraform(stackDir, r.terraformPath)
 	if err != nil {
 		return nil, err
 	}
+	if err := r.setEnv(ctx, tf, stackDir); err != nil {
+		return nil, err
+	}
+	if r.tfLog != "" {
+		if err := r.setLog(tf, stackDir); err != nil {
+			return nil, err
+		}
+	}
 
-	tf.SetStdout(os.Stdout)
-	tf.SetStderr(os.Stderr)
+	rel, err := filepath.Rel(r.root, stackDir)
+	if err != nil {
+		rel = stackDir
+	}
+	rel = filepath.ToSlash(rel)
+	var stdout, stderr io.Writer = output.Progress(), os.Stderr
+	switch {
+	case r.group != nil:
+		stdout = r.group.Writer(rel)
+		stderr = stdout
+	case r.prefixOutput:
+		prefix := output.StackPrefix(rel, r.color)
+		stdout = output.NewPrefixWriter(output.Progress(), prefix)
+		stderr = output.NewPrefixWriter(os.Stderr, prefix)
+	}
+	// Copy terraform's output to the stack log written with --stack-logs.
+	if log := logging.Stack(rel).Writer(); log != nil {
+		stdout = io.MultiWriter(stdout, log)
+		stderr = io.MultiWriter(stderr, log)
+	}
+	tf.SetStdout(stdout)
+	tf.SetStderr(stderr)
 
 	return tf, nil
 }
 
 func (r *Runner) InitOnly(ctx context.Context, stackDir string, upgrade bool) error {
-	tf, err := r.newTerraform(stackDir)
+	tf, err := r.newTerraform(ctx, stackDir)
 	if err != nil {
 		return err
 	}
@@ -136,18 +488,65 @@ func (r *Runner) InitOnly(ctx context.Context, stackDir string, upgrade bool) er
 }
 
 func (r *Runner) init(ctx context.Context, tf *tfexec.Terraform, stackDir string, upgrade bool) error {
-	backendConfig := r.backendConfig(stackDir)
-
-	var opts []tfexec.InitOption
-	for k, v := range backendConfig {
-		opts = append(opts, tfexec.BackendConfig(fmt.Sprintf("%s=%s", k, v)))
+	opts, err := r.BackendInitOptions(stackDir)
+	if err != nil {
+		return err
 	}
 
 	if upgrade {
 		opts = append([]tfexec.InitOption{tfexec.Upgrade(true)}, opts...)
 	}
+	switch r.backendChange {
+	case BackendMigrateState:
+		opts = append(opts, tfexec.ForceCopy(true))
+	case BackendReconfigure:
+		opts = append(opts, tfexec.Reconfigure(true))
+	}
+
+	err = r.retry(ctx, stackDir, func() error {
+		release, err := plugincache.Lock(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+		return tf.Init(ctx, opts...)
+	})
+	if err != nil {
+		return err
+	}
+	return r.retry(ctx, stackDir, func() error {
+		return r.SelectWorkspace(ctx, tf, stackDir)
+	})
+}
+
+// retry runs fn under the runner's retry policy, labelled with the stack.
+func (r *Runner) retry(ctx context.Context, stackDir string, fn func() error) error {
+	rel, err := filepath.Rel(r.root, stackDir)
+	if err != nil {
+		rel = stackDir
+	}
+	return r.retryPolicy.Do(ctx, filepath.ToSlash(rel), fn)
+}
 
-	return tf.Init(ctx, opts...)
+// retryPlan runs a plan under the retry policy and reports whether the
+// successful attempt found changes.
+func (r *Runner) retryPlan(ctx context.Context, tf *tfexec.Terraform, stackDir string, opts []tfexec.PlanOption) (bool, error) {
+	var changes bool
+	err := r.retry(ctx, stackDir, func() error {
+		var err error
+		changes, err = tf.Plan(ctx, opts...)
+		return err
+	})
+	return changes, err
+}
+
+// lockTimeout returns the -lock-timeout terraform commands wait for a held
+// state lock with, "" for terraform's default.
+func (r *Runner) lockTimeout() string {
+	if timeout := r.retryPolicy.LockTimeout(); timeout > 0 {
+		return timeout.String()
+	}
+	return ""
 }
 
 func (r *Runner) planOptions(stackDir string) []tfexec.PlanOption {
@@ -155,6 +554,11 @@ func (r *Runner) planOptions(stackDir string) []tfexec.PlanOption {
 	if r.disableRefresh {
 		opts = append(opts, tfexec.Refresh(false))
 	}
+	if r.disableLocking {
+		opts = append(opts, tfexec.Lock(false))
+	} else if timeout := r.lockTimeout(); timeout != "" {
+		opts = append(opts, tfexec.LockTimeout(timeout))
+	}
 	for _, vf := range r.varFiles(stackDir) {
 		opts = append(opts, tfexec.VarFile(vf))
 	}
@@ -163,6 +567,9 @@ func (r *Runner) planOptions(stackDir string) []tfexec.PlanOption {
 
 func (r *Runner) applyOptions(stackDir string) []tfexec.ApplyOption {
 	var opts []tfexec.ApplyOption
+	if timeout := r.lockTimeout(); timeout != "" {
+		opts = append(opts, tfexec.LockTimeout(timeout))
+	}
 	for _, vf := range r.varFiles(stackDir) {
 		opts = append(opts, tfexec.VarFile(vf))
 	}
@@ -171,39 +578,126 @@ func (r *Runner) applyOptions(stackDir string) []tfexec.ApplyOption {
 
 func (r *Runner) destroyOptions(stackDir string) []tfexec.DestroyOption {
 	var opts []tfexec.DestroyOption
+	if timeout := r.lockTimeout(); timeout != "" {
+		opts = append(opts, tfexec.LockTimeout(timeout))
+	}
 	for _, vf := range r.varFiles(stackDir) {
 		opts = append(opts, tfexec.VarFile(vf))
 	}
 	return opts
 }
 
-func (r *Runner) backendConfig(stackDir string) map[string]string {
-	stackName := filepath.Base(stackDir)
-	keyParts := []string{r.environment, stackName, "terraform.tfstate"}
-	stateKey := strings.Join(keyParts, "/")
-	bucket := fmt.Sprintf("%s-%s-state", r.accountID, r.region)
+func (r *Runner) backendConfig(stackDir string) (map[string]string, error) {
+	backend, workspaces, err := r.stackBackend(stackDir)
+	if err != nil {
+		return nil, err
+	}
+	accountID, err := r.accountFor(stackDir)
+	if err != nil {
+		return nil, err
+	}
+	target := r.backendTarget(stackDir, accountID)
+	if workspaces {
+		target.TerraformWorkspace = r.environment
+	}
+	return backend.Config(target), nil
+}
+
+// stackBackend returns the state backend of stackDir and whether it keeps
+// each environment in its own Terraform workspace.
+func (r *Runner) stackBackend(stackDir string) (BackendProvider, bool, error) {
+	backend, workspaces := r.backend, r.envWorkspaces
+	if backend == nil {
+		backend = S3Backend{}
+	}
+	settings, err := LoadBackendSettings(stackDir)
+	if err != nil {
+		return nil, false, err
+	}
+	if settings != nil {
+		if backend, err = NewBackendProvider(settings); err != nil {
+			return nil, false, fmt.Errorf("%s: %w", filepath.Join(stackDir, BackendFileName), err)
+		}
+		workspaces = settings.EnvironmentWorkspaces
+	}
+	return backend, workspaces, nil
+}
+
+func (r *Runner) backendTarget(stackDir, accountID string) BackendTarget {
+	stackPath, err := filepath.Rel(r.root, stackDir)
+	if err != nil {
+		stackPath = stackDir
+	}
+	return BackendTarget{
+		Environment:   r.environment,
+		Workspace:     r.workspace,
+		Stack:         filepath.Base(stackDir),
+		AccountID:     accountID,
+		Region:        r.region,
+		StateKMSKeyID: r.stateKMSKeyID,
+		StackPath:     filepath.ToSlash(stackPath),
+		KeyPattern:    r.keyPattern,
+	}
+}
 
-	return map[string]string{
-		"bucket":  bucket,
-		"key":     stateKey,
-		"region":  r.region,
-		"encrypt": "true",
+// StateKey returns the S3 key of a stack's state. In workspace mode the key is
+// scoped under <env>/workspaces/<workspace> so workspaces of one stack do not
+// share state.
+func StateKey(environment, workspace, stackName string) string {
+	keyParts := []string{environment}
+	if workspace != "" {
+		keyParts = append(keyParts, "workspaces", workspace)
 	}
+	keyParts = append(keyParts, stackName, "terraform.tfstate")
+	return strings.Join(keyParts, "/")
+}
+
+// StateBucket returns the conventional remote state bucket for an account and region.
+func StateBucket(accountID, region string) string {
+	return fmt.Sprintf("%s-%s-state", accountID, region)
 }
 
 func (r *Runner) varFiles(stackDir string) []string {
-	return VarFiles(r.root, stackDir, r.environment)
+	return append(VarFiles(r.root, stackDir, r.environment, r.profile), r.extraVarFiles...)
 }
 
-func (r *Runner) BackendConfig(stackDir string) map[string]string {
+func (r *Runner) BackendConfig(stackDir string) (map[string]string, error) {
 	return r.backendConfig(stackDir)
 }
 
+// BackendInitOptions returns the terraform init options that configure the
+// stack's state backend and, once a provider bundle has been imported,
+// install providers from its mirror rather than the registry.
+func (r *Runner) BackendInitOptions(stackDir string) ([]tfexec.InitOption, error) {
+	config, err := r.backendConfig(stackDir)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := backendInitOptions(stackDir, config)
+	if err != nil {
+		return nil, err
+	}
+	if mirror := ProviderMirrorDir(r.root); dirExists(mirror) {
+		opts = append(opts, tfexec.PluginDir(mirror))
+	}
+	return opts, nil
+}
+
+// FeatureFlags returns the flags of the environment, nil when it has no flags
+// file.
+func (r *Runner) FeatureFlags() featureflags.Flags {
+	return r.featureFlags
+}
+
 func (r *Runner) VarFilesFor(stackDir string) []string {
 	return r.varFiles(stackDir)
 }
 
-func VarFiles(root, stackDir, environment string) []string {
+// VarFiles returns the tfvars files that exist for a stack, in precedence
+// order: globals, the environment, the environment's profile variant, the
+// outputs propagated from upstream stacks, the stack's environment file and
+// finally the stack's profile variant.
+func VarFiles(root, stackDir, environment, profile string) []string {
 	var files []string
 
 	global := filepath.Join(root, "globals.tfvars")
@@ -211,19 +705,65 @@ func VarFiles(root, stackDir, environment string) []string {
 		files = append(files, global)
 	}
 
-	envFile := filepath.Join(root, "environment", fmt.Sprintf("%s.tfvars", environment))
-	if fileExists(envFile) {
-		files = append(files, envFile)
+	for _, name := range VarFileNames(environment, profile) {
+		envFile := filepath.Join(root, "environment", name)
+		if fileExists(envFile) {
+			files = append(files, envFile)
+		}
 	}
 
-	stackFile := filepath.Join(stackDir, "tfvars", fmt.Sprintf("%s.tfvars", environment))
-	if fileExists(stackFile) {
-		files = append(files, stackFile)
+	if propagated := PropagatedVarFile(stackDir, environment); fileExists(propagated) {
+		files = append(files, propagated)
+	}
+
+	for _, name := range VarFileNames(environment, profile) {
+		stackFile := filepath.Join(stackDir, "tfvars", name)
+		if fileExists(stackFile) {
+			files = append(files, stackFile)
+		}
 	}
 
 	return files
 }
 
+// PropagatedVarFile returns the generated tfvars file holding the upstream
+// outputs propagated to a stack.
+func PropagatedVarFile(stackDir, environment string) string {
+	return filepath.Join(stackDir, "tfvars", fmt.Sprintf("propagated.%s.tfvars", environment))
+}
+
+// VarFileNames returns <env>.tfvars followed by <env>.<profile>.tfvars when a
+// profile is set.
+func VarFileNames(environment, profile string) []string {
+	names := []string{fmt.Sprintf("%s.tfvars", environment)}
+	if profile != "" {
+		names = append(names, fmt.Sprintf("%s.%s.tfvars", environment, profile))
+	}
+	return names
+}
+
+// ValidateProfile rejects profile names that cannot form a tfvars file name.
+func ValidateProfile(profile string) error {
+	if profile != "" && !profilePattern.MatchString(profile) {
+		return fmt.Errorf("invalid profile %q: only letters, digits, '-' and '_' are allowed", profile)
+	}
+	return nil
+}
+
+// ValidateWorkspace rejects workspace names that cannot form a state key or
+// cache path segment.
+func ValidateWorkspace(workspace string) error {
+	if workspace != "" && !profilePattern.MatchString(workspace) {
+		return fmt.Errorf("invalid workspace %q: only letters, digits, '-' and '_' are allowed", workspace)
+	}
+	return nil
+}
+
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
 func fileExists(path string) bool {
 	info, err := os.Stat(path)
 	if err != nil {
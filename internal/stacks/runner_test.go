@@ -2,11 +2,21 @@ package stacks
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/featureflags"
 )
 
 func TestVarFilesAndBackendConfig(t *testing.T) {
@@ -28,13 +38,242 @@ func TestVarFilesAndBackendConfig(t *testing.T) {
 	require.Contains(t, files, filepath.Join(root, "environment", "dev.tfvars"))
 	require.Contains(t, files, filepath.Join(stackDir, "tfvars", "dev.tfvars"))
 
-	backend := r.BackendConfig(stackDir)
+	backend, err := r.BackendConfig(stackDir)
+	require.NoError(t, err)
 	require.Equal(t, map[string]string{
 		"bucket":  "123-eu-west-2-state",
 		"key":     "dev/network/terraform.tfstate",
 		"region":  "eu-west-2",
 		"encrypt": "true",
 	}, backend)
+
+	r.stateKMSKeyID = "arn:aws:kms:eu-west-2:123:key/abc"
+	backend, err = r.BackendConfig(stackDir)
+	require.NoError(t, err)
+	require.Equal(t, "arn:aws:kms:eu-west-2:123:key/abc", backend["kms_key_id"])
+
+	r.workspace = "feature-x"
+	backend, err = r.BackendConfig(stackDir)
+	require.NoError(t, err)
+	require.Equal(t, "dev/workspaces/feature-x/network/terraform.tfstate", backend["key"])
+	require.Error(t, ValidateWorkspace("feature/x"))
+
+	r.keyPattern = "{env}/[{workspace}/]{stack_path}/terraform.tfstate"
+	backend, err = r.BackendConfig(stackDir)
+	require.NoError(t, err)
+	require.Equal(t, "dev/feature-x/network/terraform.tfstate", backend["key"])
+}
+
+func TestBackendProvidersAndStackOverride(t *testing.T) {
+	root := t.TempDir()
+	network := filepath.Join(root, "network")
+	dns := filepath.Join(root, "dns")
+	require.NoError(t, os.MkdirAll(network, 0o755))
+	require.NoError(t, os.MkdirAll(dns, 0o755))
+
+	backend, err := NewBackendProvider(&BackendSettings{Type: BackendGCS, Bucket: "tf-state"})
+	require.NoError(t, err)
+	r := &Runner{root: root, environment: "prod", accountID: "123", region: "eu-west-2", backend: backend}
+
+	config, err := r.BackendConfig(network)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"bucket": "tf-state", "prefix": "prod/network"}, config)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dns, BackendFileName), []byte(`{"type": "remote", "organization": "acme"}`), 0o644))
+	config, err = r.BackendConfig(dns)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"hostname":        "app.terraform.io",
+		"organization":    "acme",
+		"workspaces.name": "prod-dns",
+	}, config)
+
+	opts, err := r.BackendInitOptions(dns)
+	require.NoError(t, err)
+	require.Len(t, opts, 1)
+	written, err := os.ReadFile(filepath.Join(dns, ".terraform", "terraform-wrapper.tfbackend"))
+	require.NoError(t, err)
+	require.Contains(t, string(written), `organization = "acme"`)
+	require.Contains(t, string(written), "workspaces {\n  name = \"prod-dns\"\n}")
+
+	// An imported provider bundle is wired into init.
+	require.NoError(t, os.MkdirAll(ProviderMirrorDir(root), 0o755))
+	opts, err = r.BackendInitOptions(dns)
+	require.NoError(t, err)
+	require.Len(t, opts, 2)
+
+	azure, err := NewBackendProvider(&BackendSettings{Type: BackendAzureRM, ResourceGroupName: "rg", StorageAccountName: "sa", ContainerName: "tfstate"})
+	require.NoError(t, err)
+	require.Equal(t, "prod/network/terraform.tfstate", azure.Config(BackendTarget{Environment: "prod", Stack: "network"})["key"])
+
+	_, err = NewBackendProvider(&BackendSettings{Type: BackendAzureRM, ResourceGroupName: "rg"})
+	require.ErrorContains(t, err, "storage_account_name, container_name")
+	_, err = NewBackendProvider(&BackendSettings{Type: "consul"})
+	require.ErrorContains(t, err, "unknown state backend")
+}
+
+func TestEnvironmentWorkspacesDropEnvironmentFromKey(t *testing.T) {
+	root := t.TempDir()
+	network := filepath.Join(root, "network")
+	dns := filepath.Join(root, "dns")
+	require.NoError(t, os.MkdirAll(network, 0o755))
+	require.NoError(t, os.MkdirAll(dns, 0o755))
+
+	r := &Runner{root: root, environment: "prod", accountID: "123", region: "eu-west-2", envWorkspaces: true}
+
+	config, err := r.BackendConfig(network)
+	require.NoError(t, err)
+	require.Equal(t, "network/terraform.tfstate", config["key"])
+	workspace, err := r.TerraformWorkspace(network)
+	require.NoError(t, err)
+	require.Equal(t, "prod", workspace)
+	require.Equal(t, "env:/prod/network/terraform.tfstate", BackendTarget{
+		Environment: "prod", Stack: "network", TerraformWorkspace: "prod",
+	}.S3Key())
+
+	r.keyPattern = "{env}/[{workspace}/]{stack_path}/terraform.tfstate"
+	config, err = r.BackendConfig(network)
+	require.NoError(t, err)
+	require.Equal(t, "network/terraform.tfstate", config["key"])
+
+	// A stack's backend.tfwrapper.json decides for itself.
+	require.NoError(t, os.WriteFile(filepath.Join(dns, BackendFileName), []byte(`{"type": "gcs", "bucket": "tf-state"}`), 0o644))
+	config, err = r.BackendConfig(dns)
+	require.NoError(t, err)
+	require.Equal(t, "prod/dns", config["prefix"])
+	workspace, err = r.TerraformWorkspace(dns)
+	require.NoError(t, err)
+	require.Empty(t, workspace)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dns, BackendFileName), []byte(`{"type": "gcs", "bucket": "tf-state", "environment_workspaces": true}`), 0o644))
+	config, err = r.BackendConfig(dns)
+	require.NoError(t, err)
+	require.Equal(t, "dns", config["prefix"])
+
+	_, err = NewBackendProvider(&BackendSettings{Type: BackendTerraformCloud, Organization: "acme", EnvironmentWorkspaces: true})
+	require.ErrorContains(t, err, "does not support environment_workspaces")
+}
+
+func TestStateNamingTemplates(t *testing.T) {
+	root := t.TempDir()
+	network := filepath.Join(root, "core", "network")
+	require.NoError(t, os.MkdirAll(network, 0o755))
+
+	backend, err := NewBackendProvider(&BackendSettings{
+		BucketTemplate: "{{.AccountID}}-{{.Env}}-tfstate",
+		KeyTemplate:    "{{.Env}}/{{.StackRel}}/state.tfstate",
+	})
+	require.NoError(t, err)
+	r := &Runner{root: root, environment: "prod", accountID: "123", region: "eu-west-2", backend: backend}
+
+	config, err := r.BackendConfig(network)
+	require.NoError(t, err)
+	require.Equal(t, "123-prod-tfstate", config["bucket"])
+	require.Equal(t, "prod/core/network/state.tfstate", config["key"])
+
+	// A migrated key pattern takes precedence over the key template.
+	r.keyPattern = "{env}/[{workspace}/]{stack}/terraform.tfstate"
+	config, err = r.BackendConfig(network)
+	require.NoError(t, err)
+	require.Equal(t, "123-prod-tfstate", config["bucket"])
+	require.Equal(t, "prod/network/terraform.tfstate", config["key"])
+
+	var naming *StateNaming
+	require.Equal(t, "123-eu-west-2-state", naming.Bucket(NameVars{AccountID: "123", Region: "eu-west-2"}))
+	require.NoError(t, naming.ValidateWorkspace("blue"))
+
+	naming, err = ParseStateNaming("", "{{.Env}}/{{.Stack}}.tfstate")
+	require.NoError(t, err)
+	require.ErrorContains(t, naming.ValidateWorkspace("blue"), "{{.Workspace}}")
+	naming, err = ParseStateNaming("", "{{.Env}}/{{with .Workspace}}{{.}}/{{end}}{{.Stack}}.tfstate")
+	require.NoError(t, err)
+	require.NoError(t, naming.ValidateWorkspace("blue"))
+	require.Equal(t, "dev/blue/dns.tfstate", naming.Key(NameVars{Env: "dev", Workspace: "blue", Stack: "dns"}))
+
+	_, err = ParseStateNaming("{{.Account}}-state", "")
+	require.ErrorContains(t, err, "invalid bucket_template")
+	_, err = ParseStateNaming("{{.Stack}}-state", "")
+	require.ErrorContains(t, err, "only {{.AccountID}}, {{.Region}} and {{.Env}}")
+	_, err = ParseStateNaming("", "{{.Env}/state")
+	require.ErrorContains(t, err, "invalid key_template")
+	_, err = NewBackendProvider(&BackendSettings{Type: BackendGCS, Bucket: "tf-state", KeyTemplate: "{{.Env}}"})
+	require.ErrorContains(t, err, "s3 state backend only")
+}
+
+func TestDynamoDBLockTable(t *testing.T) {
+	root := t.TempDir()
+	network := filepath.Join(root, "network")
+	require.NoError(t, os.MkdirAll(network, 0o755))
+
+	backend, err := NewBackendProvider(&BackendSettings{UseDynamoDBLock: true})
+	require.NoError(t, err)
+	r := &Runner{root: root, environment: "prod", accountID: "123", region: "eu-west-2", backend: backend}
+	config, err := r.BackendConfig(network)
+	require.NoError(t, err)
+	require.Equal(t, "123-eu-west-2-state-lock", config["dynamodb_table"])
+
+	r.backend, err = NewBackendProvider(&BackendSettings{UseDynamoDBLock: true, DynamoDBTable: "terraform-locks"})
+	require.NoError(t, err)
+	config, err = r.BackendConfig(network)
+	require.NoError(t, err)
+	require.Equal(t, "terraform-locks", config["dynamodb_table"])
+
+	_, err = NewBackendProvider(&BackendSettings{DynamoDBTable: "terraform-locks"})
+	require.ErrorContains(t, err, "needs use_dynamodb_lock")
+	_, err = NewBackendProvider(&BackendSettings{Type: BackendGCS, Bucket: "tf-state", UseDynamoDBLock: true})
+	require.ErrorContains(t, err, "s3 state backend only")
+}
+
+func TestVarFilesLayersProfile(t *testing.T) {
+	root := t.TempDir()
+	stackDir := filepath.Join(root, "network")
+	require.NoError(t, os.MkdirAll(filepath.Join(stackDir, "tfvars"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "environment"), 0o755))
+
+	for _, path := range []string{
+		filepath.Join(root, "globals.tfvars"),
+		filepath.Join(root, "environment", "prod.tfvars"),
+		filepath.Join(root, "environment", "prod.blue.tfvars"),
+		filepath.Join(root, "environment", "prod.green.tfvars"),
+		filepath.Join(stackDir, "tfvars", "prod.tfvars"),
+		filepath.Join(stackDir, "tfvars", "prod.blue.tfvars"),
+	} {
+		require.NoError(t, os.WriteFile(path, []byte("x = 1"), 0o644))
+	}
+
+	require.Equal(t, []string{
+		filepath.Join(root, "globals.tfvars"),
+		filepath.Join(root, "environment", "prod.tfvars"),
+		filepath.Join(root, "environment", "prod.blue.tfvars"),
+		filepath.Join(stackDir, "tfvars", "prod.tfvars"),
+		filepath.Join(stackDir, "tfvars", "prod.blue.tfvars"),
+	}, VarFiles(root, stackDir, "prod", "blue"))
+
+	require.Equal(t, []string{
+		filepath.Join(root, "globals.tfvars"),
+		filepath.Join(root, "environment", "prod.tfvars"),
+		filepath.Join(stackDir, "tfvars", "prod.tfvars"),
+	}, VarFiles(root, stackDir, "prod", ""))
+
+	require.NoError(t, ValidateProfile("canary-1"))
+	require.Error(t, ValidateProfile("../blue"))
+
+	override := filepath.Join(t.TempDir(), "emergency.tfvars")
+	r, err := NewRunner(context.Background(), RunnerOptions{
+		RootDir:       root,
+		Environment:   "prod",
+		AccountID:     "123",
+		Region:        "eu",
+		TerraformPath: "/custom/terraform",
+		ExtraVarFiles: []string{override},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		filepath.Join(root, "globals.tfvars"),
+		filepath.Join(root, "environment", "prod.tfvars"),
+		filepath.Join(stackDir, "tfvars", "prod.tfvars"),
+		override,
+	}, r.VarFilesFor(stackDir))
 }
 
 func TestNewRunnerValidatesInputs(t *testing.T) {
@@ -57,3 +296,262 @@ func TestNewRunnerUsesInjectedTerraformPath(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, "/custom/terraform", r.terraformPath)
 }
+
+type fakeCredentials struct{ roles []string }
+
+func (f *fakeCredentials) RoleEnv(ctx context.Context, roleARN string) (map[string]string, error) {
+	f.roles = append(f.roles, roleARN)
+	return map[string]string{
+		"AWS_ACCESS_KEY_ID":     "ASIA" + roleARN[13:25],
+		"AWS_SECRET_ACCESS_KEY": "secret",
+		"AWS_SESSION_TOKEN":     "token",
+	}, nil
+}
+
+func TestAssumeRoleDefaultAndStackOverride(t *testing.T) {
+	root := t.TempDir()
+	network := filepath.Join(root, "network")
+	shared := filepath.Join(root, "shared")
+	require.NoError(t, os.MkdirAll(network, 0o755))
+	require.NoError(t, os.MkdirAll(shared, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(shared, "dependencies.json"),
+		[]byte(`{"assume_role_arn": "arn:aws:iam::222222222222:role/deploy"}`), 0o644))
+
+	t.Setenv("AWS_PROFILE", "caller")
+	creds := &fakeCredentials{}
+	r := &Runner{
+		root:          root,
+		environment:   "prod",
+		accountID:     "000000000000",
+		region:        "eu-west-2",
+		assumeRoleARN: "arn:aws:iam::111111111111:role/deploy",
+		credentials:   creds,
+	}
+
+	config, err := r.BackendConfig(network)
+	require.NoError(t, err)
+	require.Equal(t, "111111111111-eu-west-2-state", config["bucket"])
+	config, err = r.BackendConfig(shared)
+	require.NoError(t, err)
+	require.Equal(t, "222222222222-eu-west-2-state", config["bucket"])
+
+	env, err := r.Env(context.Background(), shared)
+	require.NoError(t, err)
+	require.Equal(t, "ASIA222222222222", env["AWS_ACCESS_KEY_ID"])
+	require.Equal(t, "token", env["AWS_SESSION_TOKEN"])
+	require.NotContains(t, env, "AWS_PROFILE")
+	require.Equal(t, []string{"arn:aws:iam::222222222222:role/deploy"}, creds.roles)
+
+	r.assumeRoleARN = ""
+	env, err = r.Env(context.Background(), network)
+	require.NoError(t, err)
+	require.Nil(t, env)
+	config, err = r.BackendConfig(network)
+	require.NoError(t, err)
+	require.Equal(t, "000000000000-eu-west-2-state", config["bucket"])
+
+	r.featureFlags = featureflags.Flags{"new_vpc": true}
+	env, err = r.Env(context.Background(), network)
+	require.NoError(t, err)
+	require.Equal(t, `{"new_vpc":true}`, env["TF_VAR_feature_flags"])
+	require.Equal(t, "caller", env["AWS_PROFILE"])
+}
+
+type fakeStateObjects map[string]string
+
+func (f fakeStateObjects) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	body, ok := f[aws.ToString(params.Bucket)+"/"+aws.ToString(params.Key)]
+	if !ok {
+		return nil, &s3types.NoSuchKey{}
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(body))}, nil
+}
+
+func TestRetryPolicyRetriesOnlyTransientFailures(t *testing.T) {
+	matchers, err := RetryMatchers([]string{`InternalError`})
+	require.NoError(t, err)
+	policy := RetryPolicy{Attempts: 3, Delay: time.Millisecond, Matchers: matchers}
+	ctx := context.Background()
+
+	require.Equal(t, "state lock", policy.Classify(errors.New("exit status 1\n\nError: Error acquiring the state lock")))
+	require.Equal(t, "throttling", policy.Classify(errors.New("api error Throttling: Rate exceeded")))
+	require.Equal(t, "InternalError", policy.Classify(errors.New("InternalError: please retry")))
+	require.Empty(t, policy.Classify(errors.New("Error: Unsupported argument")))
+
+	calls := 0
+	err = policy.Do(ctx, "network", func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("read: connection reset by peer")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, calls)
+
+	var transient []string
+	policy.OnTransient = func(class string) { transient = append(transient, class) }
+	calls = 0
+	err = policy.Do(ctx, "network", func() error {
+		calls++
+		return errors.New("Error acquiring the state lock")
+	})
+	require.EqualError(t, err, "Error acquiring the state lock")
+	require.Equal(t, 3, calls)
+	require.Equal(t, []string{"state lock", "state lock", "state lock"}, transient)
+
+	calls = 0
+	err = policy.Do(ctx, "network", func() error {
+		calls++
+		return errors.New("Error: Invalid reference")
+	})
+	require.Error(t, err)
+	require.Equal(t, 1, calls)
+
+	_, err = RetryMatchers([]string{"("})
+	require.ErrorContains(t, err, "invalid retry pattern")
+}
+
+func TestRetryPolicyWaitsForStateLock(t *testing.T) {
+	held := errors.New(`exit status 1
+
+Error: Error acquiring the state lock
+
+Error message: ConditionalCheckFailedException: The conditional request failed
+Lock Info:
+  ID:        6f1c1f3e-0a4b-4f7e-9d0e-2b5c7a1d9e10
+  Path:      000000000000-eu-west-2-state/prod/network/terraform.tfstate
+  Operation: OperationTypeApply
+  Who:       alice@build-7
+  Version:   1.7.5
+  Created:   2024-05-01 09:30:00.000000 +0000 UTC
+  Info:
+`)
+	holder, ok := ParseStateLockHolder(held.Error())
+	require.True(t, ok)
+	require.Equal(t, "alice@build-7 for Apply since 2024-05-01 09:30:00.000000 +0000 UTC (lock ID 6f1c1f3e-0a4b-4f7e-9d0e-2b5c7a1d9e10)", holder.String())
+	_, ok = ParseStateLockHolder("Error: Error acquiring the state lock")
+	require.False(t, ok)
+
+	// The lock is retried beyond the attempts other failures get.
+	policy := RetryPolicy{Attempts: 1, Delay: time.Millisecond, LockWait: time.Minute}
+	require.Equal(t, time.Millisecond, policy.LockTimeout())
+	calls := 0
+	err := policy.Do(context.Background(), "network", func() error {
+		calls++
+		if calls < 4 {
+			return held
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 4, calls)
+
+	policy.LockWait = 20 * time.Millisecond
+	err = policy.Do(context.Background(), "network", func() error { return held })
+	require.ErrorContains(t, err, "state lock still held by alice@build-7 for Apply")
+	require.ErrorIs(t, err, held)
+
+	require.Zero(t, RetryPolicy{Delay: time.Second}.LockTimeout())
+}
+
+func TestExternalDependenciesBecomeVariables(t *testing.T) {
+	root := t.TempDir()
+	app := filepath.Join(root, "app")
+	require.NoError(t, os.MkdirAll(app, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(app, "dependencies.json"), []byte(`{"dependencies": {"external": [
+		{"name": "shared_network", "bucket": "platform-state", "key": "prod/network/terraform.tfstate"}
+	]}}`), 0o644))
+
+	objects := fakeStateObjects{
+		"platform-state/prod/network/terraform.tfstate": `{"version":4,"outputs":{"vpc_id":{"value":"vpc-123","type":"string"}}}`,
+	}
+	var regions []string
+	r := &Runner{
+		root:        root,
+		environment: "prod",
+		accountID:   "000000000000",
+		region:      "eu-west-2",
+		external: &ExternalStates{Region: "eu-west-2", NewClient: func(ctx context.Context, region string) (ExternalStateAPI, error) {
+			regions = append(regions, region)
+			return objects, nil
+		}},
+	}
+
+	env, err := r.Env(context.Background(), app)
+	require.NoError(t, err)
+	require.Equal(t, `{"vpc_id":"vpc-123"}`, env["TF_VAR_shared_network"])
+	_, err = r.Env(context.Background(), app)
+	require.NoError(t, err)
+	require.Equal(t, []string{"eu-west-2"}, regions)
+
+	delete(objects, "platform-state/prod/network/terraform.tfstate")
+	r.external = &ExternalStates{NewClient: func(context.Context, string) (ExternalStateAPI, error) { return objects, nil }}
+	_, err = r.Env(context.Background(), app)
+	require.ErrorContains(t, err, "external dependency shared_network (s3://platform-state/prod/network/terraform.tfstate): state s3://platform-state/prod/network/terraform.tfstate does not exist")
+
+	require.NoError(t, os.WriteFile(filepath.Join(app, "dependencies.json"), []byte(`{"dependencies": {"external": [
+		{"name": "", "bucket": "platform-state", "key": "k"}
+	]}}`), 0o644))
+	_, err = StackExternalDependencies(app)
+	require.ErrorContains(t, err, "not a valid variable name")
+}
+
+func TestLocalExternalStatesReadFiles(t *testing.T) {
+	dir := t.TempDir()
+	dep := ExternalDependency{Name: "shared_network", Bucket: "platform-state", Key: "prod/network/terraform.tfstate"}
+	path := LocalExternalStatePath(dir, dep)
+	require.Equal(t, filepath.Join(dir, "platform-state", "prod", "network", "terraform.tfstate"), path)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(`{"version":4,"outputs":{"vpc_id":{"value":"vpc-123","type":"string"}}}`), 0o644))
+
+	local := &LocalExternalStates{Dir: dir}
+	outputs, err := local.Outputs(context.Background(), dep)
+	require.NoError(t, err)
+	require.JSONEq(t, `"vpc-123"`, string(outputs["vpc_id"]))
+
+	dep.Key = "prod/storage/terraform.tfstate"
+	_, err = local.Outputs(context.Background(), dep)
+	require.ErrorContains(t, err, "read local copy of s3://platform-state/prod/storage/terraform.tfstate")
+}
+
+func TestManagedResourcesSkipsDataSourcesAndEmptyResources(t *testing.T) {
+	resources, err := ManagedResources([]byte(""))
+	require.NoError(t, err)
+	require.Empty(t, resources)
+
+	state := `{
+  "version": 4,
+  "resources": [
+    {"mode": "data", "type": "aws_caller_identity", "name": "current", "instances": [{}]},
+    {"mode": "managed", "type": "aws_s3_bucket", "name": "logs", "instances": [{}]},
+    {"module": "module.vpc", "mode": "managed", "type": "aws_vpc", "name": "this", "instances": [{}]},
+    {"mode": "managed", "type": "aws_instance", "name": "gone", "instances": []}
+  ]
+}`
+	resources, err = ManagedResources([]byte(state))
+	require.NoError(t, err)
+	require.Equal(t, []string{"aws_s3_bucket.logs", "module.vpc.aws_vpc.this"}, resources)
+
+	_, err = ManagedResources([]byte("{"))
+	require.Error(t, err)
+}
+
+func TestStateOutputs(t *testing.T) {
+	outputs, err := StateOutputs([]byte(""))
+	require.NoError(t, err)
+	require.Empty(t, outputs)
+
+	outputs, err = StateOutputs([]byte(`{
+  "version": 4,
+  "outputs": {
+    "vpc_id": {"value": "vpc-123", "type": "string"},
+    "db_password": {"value": "hunter2", "type": "string", "sensitive": true}
+  }
+}`))
+	require.NoError(t, err)
+	require.Equal(t, map[string]StateOutput{
+		"vpc_id":      {Value: json.RawMessage(`"vpc-123"`)},
+		"db_password": {Value: json.RawMessage(`"hunter2"`), Sensitive: true},
+	}, outputs)
+}
@@ -0,0 +1,133 @@
+package stacks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform-exec/tfexec"
+)
+
+// StateResources initialises stackDir and lists the managed resources in its
+// remote state. Data sources are left out, since they own no infrastructure.
+func (r *Runner) StateResources(ctx context.Context, stackDir string) ([]string, error) {
+	state, err := r.PullState(ctx, stackDir)
+	if err != nil {
+		return nil, err
+	}
+	return ManagedResources(state)
+}
+
+// PullState initialises stackDir and returns its raw remote state, which is
+// empty for a stack without state yet.
+func (r *Runner) PullState(ctx context.Context, stackDir string) ([]byte, error) {
+	if err := r.InitOnly(ctx, stackDir, false); err != nil {
+		return nil, err
+	}
+	// Pull with a separate executor so the state is not echoed to stdout.
+	tf, err := tfexec.NewTerraform(stackDir, r.terraformPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.setEnv(ctx, tf, stackDir); err != nil {
+		return nil, err
+	}
+	state, err := tf.StatePull(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("pull state: %w", err)
+	}
+	return []byte(state), nil
+}
+
+// PushState replaces the remote state of an initialised stackDir with the
+// state file at path. Terraform refuses states of another lineage or with a
+// serial lower than the remote one.
+func (r *Runner) PushState(ctx context.Context, stackDir, path string) error {
+	tf, err := tfexec.NewTerraform(stackDir, r.terraformPath)
+	if err != nil {
+		return err
+	}
+	if err := r.setEnv(ctx, tf, stackDir); err != nil {
+		return err
+	}
+	if err := tf.StatePush(ctx, path); err != nil {
+		return fmt.Errorf("push state: %w", err)
+	}
+	return nil
+}
+
+// Import adopts the existing object id into the state of an initialised
+// stackDir at address, with the stack's var files so the configuration the
+// address refers to can be evaluated.
+func (r *Runner) Import(ctx context.Context, stackDir, address, id string) error {
+	tf, err := r.newTerraform(ctx, stackDir)
+	if err != nil {
+		return err
+	}
+	var opts []tfexec.ImportOption
+	if r.disableLocking {
+		opts = append(opts, tfexec.Lock(false))
+	} else if timeout := r.lockTimeout(); timeout != "" {
+		opts = append(opts, tfexec.LockTimeout(timeout))
+	}
+	for _, vf := range r.varFiles(stackDir) {
+		opts = append(opts, tfexec.VarFile(vf))
+	}
+	return r.retry(ctx, stackDir, func() error {
+		return tf.Import(ctx, address, id, opts...)
+	})
+}
+
+// StateOutput is an output recorded in a stack's state.
+type StateOutput struct {
+	Value     json.RawMessage `json:"value"`
+	Sensitive bool            `json:"sensitive"`
+}
+
+// StateOutputs returns the outputs recorded in a raw state file. An empty
+// state has none.
+func StateOutputs(state []byte) (map[string]StateOutput, error) {
+	if strings.TrimSpace(string(state)) == "" {
+		return nil, nil
+	}
+	var doc struct {
+		Outputs map[string]StateOutput `json:"outputs"`
+	}
+	if err := json.Unmarshal(state, &doc); err != nil {
+		return nil, fmt.Errorf("invalid state: %w", err)
+	}
+	return doc.Outputs, nil
+}
+
+// ManagedResources returns the addresses of the managed resources with at
+// least one instance in a raw state file. An empty state has none.
+func ManagedResources(state []byte) ([]string, error) {
+	if strings.TrimSpace(string(state)) == "" {
+		return nil, nil
+	}
+	var doc struct {
+		Resources []struct {
+			Module    string            `json:"module"`
+			Mode      string            `json:"mode"`
+			Type      string            `json:"type"`
+			Name      string            `json:"name"`
+			Instances []json.RawMessage `json:"instances"`
+		} `json:"resources"`
+	}
+	if err := json.Unmarshal(state, &doc); err != nil {
+		return nil, fmt.Errorf("invalid state: %w", err)
+	}
+	var addresses []string
+	for _, res := range doc.Resources {
+		if res.Mode != "managed" || len(res.Instances) == 0 {
+			continue
+		}
+		address := res.Type + "." + res.Name
+		if res.Module != "" {
+			address = res.Module + "." + address
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, nil
+}
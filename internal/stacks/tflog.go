@@ -0,0 +1,46 @@
+package stacks
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/terraform-exec/tfexec"
+
+	"terraform-wrapper/internal/triage"
+)
+
+// Terraform log levels the wrapper can capture per stack.
+const (
+	TFLogTrace = "trace"
+	TFLogDebug = "debug"
+)
+
+// ValidateTFLog reports whether level is empty or a level the wrapper can
+// capture.
+func ValidateTFLog(level string) error {
+	switch level {
+	case "", TFLogTrace, TFLogDebug:
+		return nil
+	}
+	return fmt.Errorf("unsupported terraform log level %q (expected %s or %s)", level, TFLogTrace, TFLogDebug)
+}
+
+// setLog points TF_LOG_PATH at the stack's log file, so terraform's own log
+// is captured per stack instead of flooding the console. Every command run
+// for the stack appends to the same file.
+func (r *Runner) setLog(tf *tfexec.Terraform, stackDir string) error {
+	rel, err := filepath.Rel(r.root, stackDir)
+	if err != nil {
+		return err
+	}
+	path := triage.LogPath(r.tfLogDir, filepath.ToSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create terraform log directory: %w", err)
+	}
+	if err := tf.SetLog(strings.ToUpper(r.tfLog)); err != nil {
+		return fmt.Errorf("enable terraform log: %w", err)
+	}
+	return tf.SetLogPath(path)
+}
@@ -0,0 +1,51 @@
+package stacks
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/hashicorp/terraform-exec/tfexec"
+)
+
+// TerraformWorkspace returns the Terraform workspace stackDir's state lives
+// in: the environment when its backend sets environment_workspaces, and ""
+// when the stack uses the default workspace.
+func (r *Runner) TerraformWorkspace(stackDir string) (string, error) {
+	_, workspaces, err := r.stackBackend(stackDir)
+	if err != nil || !workspaces {
+		return "", err
+	}
+	return r.environment, nil
+}
+
+// SelectWorkspace selects the stack's Terraform workspace in the initialised
+// working directory of tf, creating the workspace when it does not exist
+// yet. Stacks using the default workspace are left alone.
+func (r *Runner) SelectWorkspace(ctx context.Context, tf *tfexec.Terraform, stackDir string) error {
+	name, err := r.TerraformWorkspace(stackDir)
+	if err != nil || name == "" {
+		return err
+	}
+	return selectWorkspace(ctx, tf, name)
+}
+
+func selectWorkspace(ctx context.Context, tf *tfexec.Terraform, name string) error {
+	workspaces, current, err := tf.WorkspaceList(ctx)
+	if err != nil {
+		return fmt.Errorf("list workspaces: %w", err)
+	}
+	if current == name {
+		return nil
+	}
+	if slices.Contains(workspaces, name) {
+		if err := tf.WorkspaceSelect(ctx, name); err != nil {
+			return fmt.Errorf("select workspace %s: %w", name, err)
+		}
+		return nil
+	}
+	if err := tf.WorkspaceNew(ctx, name); err != nil {
+		return fmt.Errorf("create workspace %s: %w", name, err)
+	}
+	return nil
+}
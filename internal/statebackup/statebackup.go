@@ -0,0 +1,175 @@
+// Package statebackup keeps timestamped copies of stack state in the state
+// bucket, under backups/<env>/<stack>/, so an earlier state can be found and
+// restored by stack and time rather than through S3 object versions.
+package statebackup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// timeLayout names backups so they sort by the time they were taken.
+const timeLayout = "20060102T150405Z"
+
+// Latest selects the most recent backup of a stack.
+const Latest = "latest"
+
+// S3API captures the subset of S3 operations required to keep backups.
+type S3API interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+}
+
+// Prefix returns the key prefix of the backups of stackRel, with a trailing
+// slash.
+func Prefix(env, workspace, stackRel string) string {
+	prefix := "backups/" + env + "/"
+	if workspace != "" {
+		prefix += "workspaces/" + workspace + "/"
+	}
+	return prefix + strings.Trim(path.Clean("/"+stackRel), "/") + "/"
+}
+
+// Key returns the key of the backup of stackRel taken at the given time.
+func Key(env, workspace, stackRel string, at time.Time) string {
+	return Prefix(env, workspace, stackRel) + at.UTC().Format(timeLayout) + ".tfstate"
+}
+
+// Backup is one stored copy of a stack's state.
+type Backup struct {
+	Key  string
+	Time time.Time
+	Size int64
+}
+
+// Store reads and writes the backups of one environment's stacks.
+type Store struct {
+	Client      S3API
+	Bucket      string
+	Environment string
+	Workspace   string
+	// KMSKeyID, when set, encrypts backups with this SSE-KMS key, like the
+	// state they copy.
+	KMSKeyID string
+	// Now stamps new backups; nil means time.Now.
+	Now func() time.Time
+}
+
+// Save stores state as a new backup of stackRel and returns its key.
+func (s *Store) Save(ctx context.Context, stackRel string, state []byte) (string, error) {
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+	key := Key(s.Environment, s.Workspace, stackRel, now())
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(state),
+		ContentType: aws.String("application/json"),
+	}
+	if s.KMSKeyID != "" {
+		input.ServerSideEncryption = s3types.ServerSideEncryptionAwsKms
+		input.SSEKMSKeyId = aws.String(s.KMSKeyID)
+	}
+	if _, err := s.Client.PutObject(ctx, input); err != nil {
+		return "", fmt.Errorf("upload state backup %s: %w", key, err)
+	}
+	return key, nil
+}
+
+// List returns the backups of stackRel, oldest first.
+func (s *Store) List(ctx context.Context, stackRel string) ([]Backup, error) {
+	prefix := Prefix(s.Environment, s.Workspace, stackRel)
+	var backups []Backup
+	var token *string
+	for {
+		out, err := s.Client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String(s.Bucket),
+			Prefix:            aws.String(prefix),
+			ContinuationToken: token,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("list state backups: %w", err)
+		}
+		for _, obj := range out.Contents {
+			key := aws.ToString(obj.Key)
+			name := strings.TrimPrefix(key, prefix)
+			// Backups of nested stacks share the prefix one level down.
+			if strings.Contains(name, "/") {
+				continue
+			}
+			stamp, ok := strings.CutSuffix(name, ".tfstate")
+			if !ok {
+				continue
+			}
+			at, err := time.Parse(timeLayout, stamp)
+			if err != nil {
+				continue
+			}
+			backups = append(backups, Backup{Key: key, Time: at, Size: aws.ToInt64(obj.Size)})
+		}
+		if !aws.ToBool(out.IsTruncated) || out.NextContinuationToken == nil {
+			break
+		}
+		token = out.NextContinuationToken
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Key < backups[j].Key })
+	return backups, nil
+}
+
+// Find returns the backup of stackRel selected by ref: Latest, a backup's
+// key, or its timestamp as shown by List, e.g. 20240501T093000Z.
+func (s *Store) Find(ctx context.Context, stackRel, ref string) (Backup, error) {
+	backups, err := s.List(ctx, stackRel)
+	if err != nil {
+		return Backup{}, err
+	}
+	if len(backups) == 0 {
+		return Backup{}, fmt.Errorf("no state backups of %s in s3://%s/%s", stackRel, s.Bucket, Prefix(s.Environment, s.Workspace, stackRel))
+	}
+	if ref == Latest {
+		return backups[len(backups)-1], nil
+	}
+	for _, backup := range backups {
+		if backup.Key == ref || backup.Timestamp() == ref {
+			return backup, nil
+		}
+	}
+	return Backup{}, fmt.Errorf("no state backup %q of %s", ref, stackRel)
+}
+
+// Get reads the backup at key.
+func (s *Store) Get(ctx context.Context, key string) ([]byte, error) {
+	out, err := s.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read state backup %s: %w", key, err)
+	}
+	data, err := io.ReadAll(out.Body)
+	if cerr := out.Body.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read state backup %s: %w", key, err)
+	}
+	return data, nil
+}
+
+// Timestamp formats the time of a backup the way Find accepts it.
+func (b Backup) Timestamp() string {
+	return b.Time.Format(timeLayout)
+}
@@ -0,0 +1,111 @@
+package statebackup_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/statebackup"
+)
+
+type fakeS3 struct {
+	objects map[string][]byte
+	puts    []*s3.PutObjectInput
+}
+
+func (f *fakeS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.objects[aws.ToString(params.Key)] = data
+	f.puts = append(f.puts, params)
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	data, ok := f.objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &s3types.NoSuchKey{}
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func (f *fakeS3) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	out := &s3.ListObjectsV2Output{}
+	for _, key := range keys {
+		out.Contents = append(out.Contents, s3types.Object{Key: aws.String(key), Size: aws.Int64(int64(len(f.objects[key])))})
+	}
+	return out, nil
+}
+
+func TestKeys(t *testing.T) {
+	t.Parallel()
+
+	at := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	require.Equal(t, "backups/prod/core-services/network/20240501T093000Z.tfstate", statebackup.Key("prod", "", "core-services/network", at))
+	require.Equal(t, "backups/prod/workspaces/feature-x/network/", statebackup.Prefix("prod", "feature-x", "network"))
+}
+
+func TestStoreSavesListsAndFinds(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := &fakeS3{objects: map[string][]byte{
+		"backups/prod/network/edge/20240101T000000Z.tfstate": []byte("nested"),
+		"backups/prod/network/notes.txt":                     []byte("ignored"),
+	}}
+	at := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	store := &statebackup.Store{
+		Client:      client,
+		Bucket:      "state",
+		Environment: "prod",
+		KMSKeyID:    "arn:key",
+		Now:         func() time.Time { return at },
+	}
+
+	first, err := store.Save(ctx, "network", []byte(`{"serial": 1}`))
+	require.NoError(t, err)
+	require.Equal(t, "backups/prod/network/20240501T093000Z.tfstate", first)
+	require.Equal(t, "arn:key", aws.ToString(client.puts[0].SSEKMSKeyId))
+	at = at.Add(time.Hour)
+	second, err := store.Save(ctx, "network", []byte(`{"serial": 2}`))
+	require.NoError(t, err)
+
+	backups, err := store.List(ctx, "network")
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	require.Equal(t, first, backups[0].Key)
+	require.Equal(t, second, backups[1].Key)
+
+	latest, err := store.Find(ctx, "network", statebackup.Latest)
+	require.NoError(t, err)
+	require.Equal(t, second, latest.Key)
+	byTime, err := store.Find(ctx, "network", "20240501T093000Z")
+	require.NoError(t, err)
+	require.Equal(t, first, byTime.Key)
+	data, err := store.Get(ctx, byTime.Key)
+	require.NoError(t, err)
+	require.Equal(t, `{"serial": 1}`, string(data))
+
+	_, err = store.Find(ctx, "network", "20230101T000000Z")
+	require.ErrorContains(t, err, "no state backup")
+	_, err = store.Find(ctx, "storage", statebackup.Latest)
+	require.ErrorContains(t, err, "no state backups of storage")
+}
@@ -0,0 +1,162 @@
+package statekms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ConfigFile records the SSE-KMS key used for each environment's state so that
+// backend configuration keeps encrypting with the rotated key.
+const ConfigFile = "state-encryption.json"
+
+// S3API captures the subset of S3 operations required to re-encrypt state.
+type S3API interface {
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+}
+
+// Result describes what happened to a single state object.
+type Result struct {
+	Key     string
+	FromKey string
+	Skipped bool
+}
+
+// Config is the contents of state-encryption.json.
+type Config struct {
+	Environments map[string]EnvironmentConfig `json:"environments"`
+}
+
+// EnvironmentConfig holds the encryption settings for one environment.
+type EnvironmentConfig struct {
+	KMSKeyID string `json:"kms_key_id"`
+}
+
+// LoadConfig reads root/state-encryption.json, returning an empty config when
+// the file does not exist.
+func LoadConfig(root string) (*Config, error) {
+	path := filepath.Join(root, ConfigFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Config{Environments: map[string]EnvironmentConfig{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read state encryption config: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid JSON in %s: %w", path, err)
+	}
+	if cfg.Environments == nil {
+		cfg.Environments = map[string]EnvironmentConfig{}
+	}
+	return &cfg, nil
+}
+
+// KeyID returns the configured KMS key for env, or "" to use the bucket default.
+func KeyID(root, env string) (string, error) {
+	cfg, err := LoadConfig(root)
+	if err != nil {
+		return "", err
+	}
+	return cfg.Environments[env].KMSKeyID, nil
+}
+
+// SaveKeyID records keyID as the state encryption key for env.
+func SaveKeyID(root, env, keyID string) error {
+	cfg, err := LoadConfig(root)
+	if err != nil {
+		return err
+	}
+	cfg.Environments[env] = EnvironmentConfig{KMSKeyID: keyID}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(root, ConfigFile), append(data, '\n'), 0o644)
+}
+
+// StateKeys lists the state objects stored for env.
+func StateKeys(ctx context.Context, client S3API, bucket, env string) ([]string, error) {
+	var keys []string
+	var token *string
+	for {
+		out, err := client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String(bucket),
+			Prefix:            aws.String(env + "/"),
+			ContinuationToken: token,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("list state objects: %w", err)
+		}
+		for _, obj := range out.Contents {
+			key := aws.ToString(obj.Key)
+			if strings.HasSuffix(key, "/terraform.tfstate") {
+				keys = append(keys, key)
+			}
+		}
+		if !aws.ToBool(out.IsTruncated) || out.NextContinuationToken == nil {
+			break
+		}
+		token = out.NextContinuationToken
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Rotate re-writes key in place encrypted with newKeyID and verifies the
+// result. Objects already encrypted with newKeyID are left untouched.
+func Rotate(ctx context.Context, client S3API, bucket, key, newKeyID string) (Result, error) {
+	before, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return Result{Key: key}, fmt.Errorf("inspect %s: %w", key, err)
+	}
+	result := Result{Key: key, FromKey: aws.ToString(before.SSEKMSKeyId)}
+	if result.FromKey == newKeyID {
+		result.Skipped = true
+		return result, nil
+	}
+
+	_, err = client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:               aws.String(bucket),
+		Key:                  aws.String(key),
+		CopySource:           aws.String(url.PathEscape(bucket + "/" + key)),
+		CopySourceIfMatch:    before.ETag,
+		MetadataDirective:    s3types.MetadataDirectiveCopy,
+		ServerSideEncryption: s3types.ServerSideEncryptionAwsKms,
+		SSEKMSKeyId:          aws.String(newKeyID),
+	})
+	if err != nil {
+		return result, fmt.Errorf("re-encrypt %s: %w", key, err)
+	}
+
+	after, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return result, fmt.Errorf("verify %s: %w", key, err)
+	}
+	if after.ServerSideEncryption != s3types.ServerSideEncryptionAwsKms || aws.ToString(after.SSEKMSKeyId) != newKeyID {
+		return result, fmt.Errorf("verify %s: object is encrypted with %q, expected %q", key, aws.ToString(after.SSEKMSKeyId), newKeyID)
+	}
+	if aws.ToInt64(after.ContentLength) != aws.ToInt64(before.ContentLength) {
+		return result, fmt.Errorf("verify %s: size changed from %d to %d bytes", key, aws.ToInt64(before.ContentLength), aws.ToInt64(after.ContentLength))
+	}
+	return result, nil
+}
@@ -0,0 +1,109 @@
+package statekms_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/statekms"
+)
+
+type object struct {
+	keyID string
+	size  int64
+	etag  string
+}
+
+type fakeS3 struct {
+	objects map[string]*object
+	copies  []string
+}
+
+func (f *fakeS3) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	out := &s3.ListObjectsV2Output{}
+	for key := range f.objects {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) {
+			out.Contents = append(out.Contents, s3types.Object{Key: aws.String(key)})
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeS3) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	obj, ok := f.objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return &s3.HeadObjectOutput{
+		ETag:                 aws.String(obj.etag),
+		ContentLength:        aws.Int64(obj.size),
+		ServerSideEncryption: s3types.ServerSideEncryptionAwsKms,
+		SSEKMSKeyId:          aws.String(obj.keyID),
+	}, nil
+}
+
+func (f *fakeS3) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	obj := f.objects[aws.ToString(params.Key)]
+	if aws.ToString(params.CopySourceIfMatch) != obj.etag {
+		return nil, errors.New("precondition failed")
+	}
+	obj.keyID = aws.ToString(params.SSEKMSKeyId)
+	obj.etag += "-copy"
+	f.copies = append(f.copies, aws.ToString(params.CopySource))
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func TestRotateReencryptsAndVerifies(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeS3{objects: map[string]*object{
+		"prod/network/terraform.tfstate": {keyID: "arn:old", size: 42, etag: "a"},
+		"prod/ecs/terraform.tfstate":     {keyID: "arn:new", size: 10, etag: "b"},
+		"prod/ecs/notes.txt":             {keyID: "arn:old", size: 1, etag: "c"},
+		"dev/network/terraform.tfstate":  {keyID: "arn:old", size: 5, etag: "d"},
+	}}
+
+	keys, err := statekms.StateKeys(context.Background(), client, "state", "prod")
+	require.NoError(t, err)
+	require.Equal(t, []string{"prod/ecs/terraform.tfstate", "prod/network/terraform.tfstate"}, keys)
+
+	skipped, err := statekms.Rotate(context.Background(), client, "state", keys[0], "arn:new")
+	require.NoError(t, err)
+	require.True(t, skipped.Skipped)
+
+	rotated, err := statekms.Rotate(context.Background(), client, "state", keys[1], "arn:new")
+	require.NoError(t, err)
+	require.False(t, rotated.Skipped)
+	require.Equal(t, "arn:old", rotated.FromKey)
+	require.Equal(t, "arn:new", client.objects[keys[1]].keyID)
+	require.Equal(t, []string{"state%2Fprod%2Fnetwork%2Fterraform.tfstate"}, client.copies)
+	require.Equal(t, "arn:old", client.objects["dev/network/terraform.tfstate"].keyID)
+}
+
+func TestSaveKeyIDPreservesOtherEnvironments(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	keyID, err := statekms.KeyID(root, "prod")
+	require.NoError(t, err)
+	require.Empty(t, keyID)
+
+	require.NoError(t, statekms.SaveKeyID(root, "dev", "arn:dev"))
+	require.NoError(t, statekms.SaveKeyID(root, "prod", "arn:prod"))
+
+	keyID, err = statekms.KeyID(root, "dev")
+	require.NoError(t, err)
+	require.Equal(t, "arn:dev", keyID)
+
+	data, err := os.ReadFile(filepath.Join(root, statekms.ConfigFile))
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"kms_key_id": "arn:prod"`)
+}
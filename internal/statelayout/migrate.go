@@ -0,0 +1,155 @@
+package statelayout
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3API captures the subset of S3 operations required to move state.
+type S3API interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+}
+
+// Result describes the copy of one state object.
+type Result struct {
+	From     string
+	To       string
+	Serial   int64
+	Checksum string
+	// Skipped is set when To already held an identical copy.
+	Skipped bool
+}
+
+// stateObject is a state object read in full.
+type stateObject struct {
+	etag     *string
+	serial   int64
+	lineage  string
+	checksum string
+}
+
+// Copy copies the state object at from to the key to in bucket, encrypted
+// with kmsKeyID when set, and verifies that the copy has the same serial,
+// lineage and SHA-256 checksum. An identical object already at to is left
+// alone, so an interrupted migration can be run again; a different one is an
+// error.
+func Copy(ctx context.Context, client S3API, bucket, from, to, kmsKeyID string) (Result, error) {
+	result := Result{From: from, To: to}
+	src, err := read(ctx, client, bucket, from)
+	if err != nil {
+		return result, err
+	}
+	result.Serial, result.Checksum = src.serial, src.checksum
+
+	existing, err := read(ctx, client, bucket, to)
+	var noKey *s3types.NoSuchKey
+	switch {
+	case err == nil:
+		if existing.checksum != src.checksum {
+			return result, fmt.Errorf("%s already exists with other content (serial %d, lineage %s)", to, existing.serial, existing.lineage)
+		}
+		result.Skipped = true
+		return result, nil
+	case !errors.As(err, &noKey):
+		return result, err
+	}
+
+	input := &s3.CopyObjectInput{
+		Bucket:            aws.String(bucket),
+		Key:               aws.String(to),
+		CopySource:        aws.String(url.PathEscape(bucket + "/" + from)),
+		CopySourceIfMatch: src.etag,
+		MetadataDirective: s3types.MetadataDirectiveCopy,
+	}
+	if kmsKeyID != "" {
+		input.ServerSideEncryption = s3types.ServerSideEncryptionAwsKms
+		input.SSEKMSKeyId = aws.String(kmsKeyID)
+	}
+	if _, err := client.CopyObject(ctx, input); err != nil {
+		return result, fmt.Errorf("copy %s to %s: %w", from, to, err)
+	}
+
+	dst, err := read(ctx, client, bucket, to)
+	if err != nil {
+		return result, fmt.Errorf("verify %s: %w", to, err)
+	}
+	if dst.checksum != src.checksum {
+		return result, fmt.Errorf("verify %s: checksum %s differs from %s of %s", to, dst.checksum, src.checksum, from)
+	}
+	if dst.serial != src.serial || dst.lineage != src.lineage {
+		return result, fmt.Errorf("verify %s: serial %d and lineage %s differ from %d and %s of %s", to, dst.serial, dst.lineage, src.serial, src.lineage, from)
+	}
+	return result, nil
+}
+
+// Exists reports whether bucket has an object at key.
+func Exists(ctx context.Context, client S3API, bucket, key string) (bool, error) {
+	_, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	var notFound *s3types.NotFound
+	if errors.As(err, &notFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("inspect %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// Delete removes a retired state object.
+func Delete(ctx context.Context, client S3API, obj RetiredObject) error {
+	_, err := client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(obj.Bucket),
+		Key:    aws.String(obj.Key),
+	})
+	if err != nil {
+		return fmt.Errorf("delete s3://%s/%s: %w", obj.Bucket, obj.Key, err)
+	}
+	return nil
+}
+
+func read(ctx context.Context, client S3API, bucket, key string) (stateObject, error) {
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return stateObject{}, fmt.Errorf("read %s: %w", key, err)
+	}
+	data, err := io.ReadAll(out.Body)
+	if cerr := out.Body.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return stateObject{}, fmt.Errorf("read %s: %w", key, err)
+	}
+	var doc struct {
+		Serial  int64  `json:"serial"`
+		Lineage string `json:"lineage"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return stateObject{}, fmt.Errorf("invalid state %s: %w", key, err)
+	}
+	sum := sha256.Sum256(data)
+	return stateObject{
+		etag:     out.ETag,
+		serial:   doc.Serial,
+		lineage:  doc.Lineage,
+		checksum: hex.EncodeToString(sum[:]),
+	}, nil
+}
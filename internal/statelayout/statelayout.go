@@ -0,0 +1,223 @@
+// Package statelayout names the S3 keys of stack state from a per-environment
+// key pattern, and moves state between naming schemes.
+package statelayout
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ConfigFile records the state key pattern of each environment, and the state
+// objects a migration left behind, so that backend configuration keeps
+// pointing at the migrated keys.
+const ConfigFile = "state-layout.json"
+
+// DefaultKeyPattern is the layout used while an environment has no pattern.
+const DefaultKeyPattern = "{env}/[workspaces/{workspace}/]{stack}/terraform.tfstate"
+
+// Config is the contents of state-layout.json.
+type Config struct {
+	Environments map[string]EnvironmentConfig `json:"environments"`
+}
+
+// EnvironmentConfig holds the state layout of one environment.
+type EnvironmentConfig struct {
+	KeyPattern string `json:"key_pattern,omitempty"`
+	// Retired lists the state objects copied to new keys by a migration
+	// that are to be deleted once their retention window has passed.
+	Retired []RetiredObject `json:"retired,omitempty"`
+}
+
+// RetiredObject is a state object superseded by a migration.
+type RetiredObject struct {
+	Bucket      string    `json:"bucket"`
+	Key         string    `json:"key"`
+	MigratedTo  string    `json:"migrated_to"`
+	MigratedAt  time.Time `json:"migrated_at"`
+	DeleteAfter time.Time `json:"delete_after"`
+}
+
+// LoadConfig reads root/state-layout.json, returning an empty config when the
+// file does not exist.
+func LoadConfig(root string) (*Config, error) {
+	path := filepath.Join(root, ConfigFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Config{Environments: map[string]EnvironmentConfig{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read state layout config: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid JSON in %s: %w", path, err)
+	}
+	if cfg.Environments == nil {
+		cfg.Environments = map[string]EnvironmentConfig{}
+	}
+	for env, envCfg := range cfg.Environments {
+		if envCfg.KeyPattern == "" {
+			continue
+		}
+		if err := Validate(envCfg.KeyPattern); err != nil {
+			return nil, fmt.Errorf("%s: key pattern of %s: %w", path, env, err)
+		}
+	}
+	return &cfg, nil
+}
+
+// SaveConfig writes cfg to root/state-layout.json.
+func SaveConfig(root string, cfg *Config) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(root, ConfigFile), append(data, '\n'), 0o644)
+}
+
+// KeyPattern returns the configured key pattern for env, or "" for the
+// default layout.
+func KeyPattern(root, env string) (string, error) {
+	cfg, err := LoadConfig(root)
+	if err != nil {
+		return "", err
+	}
+	return cfg.Environments[env].KeyPattern, nil
+}
+
+// Vars are the values substituted into a key pattern.
+type Vars struct {
+	Environment string
+	Workspace   string
+	// Stack is the stack's directory name.
+	Stack string
+	// StackPath is the stack's slash-separated path from the repository
+	// root.
+	StackPath string
+}
+
+var placeholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// Validate checks a key pattern. Patterns use the placeholders {env},
+// {workspace}, {stack} and {stack_path}, start with {env}/ so an environment's
+// state stays under one prefix, and end with /terraform.tfstate. The part
+// holding {workspace} is enclosed in brackets and left out when no workspace
+// is selected, e.g. {env}/[{workspace}/]{stack_path}/terraform.tfstate.
+func Validate(pattern string) error {
+	if !strings.HasPrefix(pattern, "{env}/") || !strings.HasSuffix(pattern, "/terraform.tfstate") {
+		return fmt.Errorf("pattern %q must start with {env}/ and end with /terraform.tfstate", pattern)
+	}
+	for _, name := range placeholder.FindAllString(pattern, -1) {
+		switch name {
+		case "{env}", "{workspace}", "{stack}", "{stack_path}":
+		default:
+			return fmt.Errorf("pattern %q has unknown placeholder %s (expected {env}, {workspace}, {stack} or {stack_path})", pattern, name)
+		}
+	}
+	if strings.ContainsAny(placeholder.ReplaceAllString(pattern, ""), "{}") {
+		return fmt.Errorf("pattern %q has an unbalanced brace", pattern)
+	}
+	if !strings.Contains(pattern, "{stack}") && !strings.Contains(pattern, "{stack_path}") {
+		return fmt.Errorf("pattern %q must contain {stack} or {stack_path}", pattern)
+	}
+	open, end := strings.Index(pattern, "["), strings.Index(pattern, "]")
+	if open < 0 || end < open || strings.Count(pattern, "[") != 1 || strings.Count(pattern, "]") != 1 {
+		return fmt.Errorf("pattern %q must enclose the {workspace} part in one pair of brackets", pattern)
+	}
+	if !strings.Contains(pattern[open:end], "{workspace}") || strings.Count(pattern, "{workspace}") != 1 {
+		return fmt.Errorf("pattern %q must use {workspace} once, inside the brackets", pattern)
+	}
+	return nil
+}
+
+// Render returns the key pattern names for v. The pattern must be valid.
+func Render(pattern string, v Vars) string {
+	open, end := strings.Index(pattern, "["), strings.Index(pattern, "]")
+	section := pattern[open+1 : end]
+	if v.Workspace == "" {
+		section = ""
+	}
+	key := pattern[:open] + section + pattern[end+1:]
+	return strings.NewReplacer(
+		"{env}", v.Environment,
+		"{workspace}", v.Workspace,
+		"{stack}", v.Stack,
+		"{stack_path}", v.StackPath,
+	).Replace(key)
+}
+
+// Match reports whether key is a state key of the stack in v under pattern,
+// for any workspace, and returns the workspace; v.Workspace is ignored.
+func Match(pattern string, v Vars, key string) (string, bool) {
+	expr := strings.NewReplacer(
+		`\{env\}`, regexp.QuoteMeta(v.Environment),
+		`\{workspace\}`, `([^/]+)`,
+		`\{stack\}`, regexp.QuoteMeta(v.Stack),
+		`\{stack_path\}`, regexp.QuoteMeta(v.StackPath),
+		`\[`, `(?:`,
+		`\]`, `)?`,
+	).Replace(regexp.QuoteMeta(pattern))
+	m := regexp.MustCompile("^" + expr + "$").FindStringSubmatch(key)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// Move is the copy of one state object to its key under a new pattern.
+type Move struct {
+	// StackPath is the slash-separated path of the stack owning the state.
+	StackPath string
+	Workspace string
+	From      string
+	To        string
+}
+
+// PlanMoves matches the existing state keys against the stacks under the
+// pattern from and returns the moves to the pattern to, in key order, along
+// with the keys no stack owns, which are left in place. Keys already named
+// by to are not moved. Two stacks sharing a state key, or two keys mapping
+// to one new key, are an error.
+func PlanMoves(from, to string, stacks []Vars, keys []string) ([]Move, []string, error) {
+	var moves []Move
+	var unowned []string
+	targets := make(map[string]string)
+	for _, key := range keys {
+		var move *Move
+		for _, v := range stacks {
+			workspace, ok := Match(from, v, key)
+			if !ok {
+				continue
+			}
+			if move != nil {
+				return nil, nil, fmt.Errorf("state key %s is shared by stacks %s and %s", key, move.StackPath, v.StackPath)
+			}
+			v.Workspace = workspace
+			move = &Move{StackPath: v.StackPath, Workspace: workspace, From: key, To: Render(to, v)}
+		}
+		if move == nil {
+			unowned = append(unowned, key)
+			continue
+		}
+		if move.From == move.To {
+			continue
+		}
+		if other, ok := targets[move.To]; ok {
+			return nil, nil, fmt.Errorf("state keys %s and %s would both move to %s", other, key, move.To)
+		}
+		targets[move.To] = key
+		moves = append(moves, *move)
+	}
+	for _, move := range moves {
+		if _, ok := targets[move.From]; ok {
+			return nil, nil, fmt.Errorf("%s is both moved and the destination of another move", move.From)
+		}
+	}
+	return moves, unowned, nil
+}
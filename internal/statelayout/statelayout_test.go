@@ -0,0 +1,165 @@
+package statelayout_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/stacks"
+	"terraform-wrapper/internal/statelayout"
+)
+
+func TestPatternsRenderMatchAndValidate(t *testing.T) {
+	t.Parallel()
+
+	v := statelayout.Vars{Environment: "prod", Stack: "network", StackPath: "core-services/network"}
+	require.Equal(t, stacks.StateKey("prod", "", "network"), statelayout.Render(statelayout.DefaultKeyPattern, v))
+	v.Workspace = "feature-x"
+	require.Equal(t, stacks.StateKey("prod", "feature-x", "network"), statelayout.Render(statelayout.DefaultKeyPattern, v))
+
+	pattern := "{env}/[{workspace}/]{stack_path}/terraform.tfstate"
+	require.NoError(t, statelayout.Validate(pattern))
+	require.Equal(t, "prod/feature-x/core-services/network/terraform.tfstate", statelayout.Render(pattern, v))
+
+	workspace, ok := statelayout.Match(statelayout.DefaultKeyPattern, v, "prod/workspaces/feature-x/network/terraform.tfstate")
+	require.True(t, ok)
+	require.Equal(t, "feature-x", workspace)
+	workspace, ok = statelayout.Match(statelayout.DefaultKeyPattern, v, "prod/network/terraform.tfstate")
+	require.True(t, ok)
+	require.Empty(t, workspace)
+	_, ok = statelayout.Match(statelayout.DefaultKeyPattern, v, "prod/storage/terraform.tfstate")
+	require.False(t, ok)
+
+	for _, invalid := range []string{
+		"{stack}/terraform.tfstate",
+		"{env}/{stack}/state.json",
+		"{env}/[{workspace}/]{team}/{stack}/terraform.tfstate",
+		"{env}/{workspace}/{stack}/terraform.tfstate",
+		"{env}/[{workspace}/]terraform.tfstate",
+	} {
+		require.Error(t, statelayout.Validate(invalid), invalid)
+	}
+}
+
+func TestPlanMoves(t *testing.T) {
+	t.Parallel()
+
+	stackVars := []statelayout.Vars{
+		{Environment: "prod", Stack: "network", StackPath: "core-services/network"},
+		{Environment: "prod", Stack: "frontend", StackPath: "applications/frontend"},
+	}
+	keys := []string{
+		"prod/bootstrap/terraform.tfstate",
+		"prod/frontend/terraform.tfstate",
+		"prod/network/terraform.tfstate",
+		"prod/workspaces/feature-x/network/terraform.tfstate",
+	}
+	moves, unowned, err := statelayout.PlanMoves(statelayout.DefaultKeyPattern, "{env}/[{workspace}/]{stack_path}/terraform.tfstate", stackVars, keys)
+	require.NoError(t, err)
+	require.Equal(t, []string{"prod/bootstrap/terraform.tfstate"}, unowned)
+	require.Equal(t, []statelayout.Move{
+		{StackPath: "applications/frontend", From: "prod/frontend/terraform.tfstate", To: "prod/applications/frontend/terraform.tfstate"},
+		{StackPath: "core-services/network", From: "prod/network/terraform.tfstate", To: "prod/core-services/network/terraform.tfstate"},
+		{StackPath: "core-services/network", Workspace: "feature-x", From: "prod/workspaces/feature-x/network/terraform.tfstate", To: "prod/feature-x/core-services/network/terraform.tfstate"},
+	}, moves)
+
+	shared := append(stackVars, statelayout.Vars{Environment: "prod", Stack: "network", StackPath: "edge/network"})
+	_, _, err = statelayout.PlanMoves(statelayout.DefaultKeyPattern, "{env}/[{workspace}/]{stack_path}/terraform.tfstate", shared, keys)
+	require.ErrorContains(t, err, "shared by stacks")
+}
+
+type fakeS3 struct {
+	objects map[string][]byte
+	copies  []*s3.CopyObjectInput
+	// corrupt, when set, alters the copied object.
+	corrupt bool
+}
+
+func (f *fakeS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	data, ok := f.objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &s3types.NoSuchKey{}
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data)), ETag: aws.String(etag(data))}, nil
+}
+
+func (f *fakeS3) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if _, ok := f.objects[aws.ToString(params.Key)]; !ok {
+		return nil, &s3types.NotFound{}
+	}
+	return &s3.HeadObjectOutput{}, nil
+}
+
+func (f *fakeS3) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	source, err := url.PathUnescape(aws.ToString(params.CopySource))
+	if err != nil {
+		return nil, err
+	}
+	source = strings.TrimPrefix(source, "state/")
+	data := f.objects[source]
+	if aws.ToString(params.CopySourceIfMatch) != etag(data) {
+		return nil, errors.New("precondition failed")
+	}
+	if f.corrupt {
+		data = bytes.Replace(data, []byte(`"serial": 7`), []byte(`"serial": 8`), 1)
+	}
+	f.objects[aws.ToString(params.Key)] = data
+	f.copies = append(f.copies, params)
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func (f *fakeS3) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	delete(f.objects, aws.ToString(params.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func etag(data []byte) string {
+	return string(rune('a' + len(data)%26))
+}
+
+const state = `{"version": 4, "serial": 7, "lineage": "3f1c2c6e"}`
+
+func TestCopyVerifiesAndResumes(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := &fakeS3{objects: map[string][]byte{"prod/network/terraform.tfstate": []byte(state)}}
+	result, err := statelayout.Copy(ctx, client, "state", "prod/network/terraform.tfstate", "prod/core-services/network/terraform.tfstate", "arn:key")
+	require.NoError(t, err)
+	require.False(t, result.Skipped)
+	require.EqualValues(t, 7, result.Serial)
+	require.Len(t, client.copies, 1)
+	require.Equal(t, "arn:key", aws.ToString(client.copies[0].SSEKMSKeyId))
+
+	// A second run finds the copy in place.
+	result, err = statelayout.Copy(ctx, client, "state", "prod/network/terraform.tfstate", "prod/core-services/network/terraform.tfstate", "")
+	require.NoError(t, err)
+	require.True(t, result.Skipped)
+	require.Len(t, client.copies, 1)
+
+	client.objects["prod/storage/terraform.tfstate"] = []byte(state)
+	client.objects["prod/core-services/storage/terraform.tfstate"] = []byte(`{"version": 4, "serial": 1, "lineage": "other"}`)
+	_, err = statelayout.Copy(ctx, client, "state", "prod/storage/terraform.tfstate", "prod/core-services/storage/terraform.tfstate", "")
+	require.ErrorContains(t, err, "already exists with other content")
+
+	client.corrupt = true
+	_, err = statelayout.Copy(ctx, client, "state", "prod/storage/terraform.tfstate", "prod/edge/storage/terraform.tfstate", "")
+	require.ErrorContains(t, err, "verify prod/edge/storage/terraform.tfstate")
+
+	ok, err := statelayout.Exists(ctx, client, "state", "prod/core-services/network/terraform.tfstate")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, statelayout.Delete(ctx, client, statelayout.RetiredObject{Bucket: "state", Key: "prod/core-services/network/terraform.tfstate"}))
+	ok, err = statelayout.Exists(ctx, client, "state", "prod/core-services/network/terraform.tfstate")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
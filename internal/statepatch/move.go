@@ -0,0 +1,274 @@
+package statepatch
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// MoveResult holds the states of two stacks after resources moved from one
+// to the other, ready to be pushed: the destination first, so the resources
+// are never missing from both.
+type MoveResult struct {
+	Source            []byte
+	SourceSerial      int64
+	Destination       []byte
+	DestinationSerial int64
+	// Rollback is the destination state as it was before the move, with a
+	// serial above DestinationSerial, for undoing the destination push when
+	// the source cannot be pushed.
+	Rollback []byte
+	// Moved lists each moved resource as "<from> -> <to>" with its number
+	// of instances.
+	Moved []string
+}
+
+// address is a module, or a resource within a module, as written in
+// terraform state commands.
+type address struct {
+	module string
+	mode   string
+	typ    string
+	name   string
+}
+
+func (a address) isModule() bool { return a.typ == "" }
+
+func (a address) String() string {
+	if a.isModule() {
+		return a.module
+	}
+	parts := []string{}
+	if a.module != "" {
+		parts = append(parts, a.module)
+	}
+	if a.mode == "data" {
+		parts = append(parts, "data")
+	}
+	return strings.Join(append(parts, a.typ, a.name), ".")
+}
+
+// parseAddress parses a module address such as module.network or a resource
+// address such as module.network.aws_vpc.main. Instance keys are not
+// supported: a resource moves with all its instances.
+func parseAddress(s string) (address, error) {
+	tokens := splitAddress(s)
+	var a address
+	var module []string
+	i := 0
+	for i+1 < len(tokens) && tokens[i] == "module" {
+		module = append(module, "module."+tokens[i+1])
+		i += 2
+	}
+	a.module = strings.Join(module, ".")
+	rest := tokens[i:]
+	switch {
+	case len(rest) == 0 && a.module != "":
+		return a, nil
+	case len(rest) == 2:
+		a.mode, a.typ, a.name = "managed", rest[0], rest[1]
+	case len(rest) == 3 && rest[0] == "data":
+		a.mode, a.typ, a.name = "data", rest[1], rest[2]
+	default:
+		return address{}, fmt.Errorf("invalid address %q: expected a module or resource address without an instance key", s)
+	}
+	if strings.ContainsAny(a.name, `["]`) || strings.ContainsAny(a.typ, `["]`) {
+		return address{}, fmt.Errorf("invalid address %q: resources move with all their instances, leave out the instance key", s)
+	}
+	return a, nil
+}
+
+// splitAddress splits an address on the dots outside module instance keys,
+// so module.zones["eu.west"] stays one token.
+func splitAddress(s string) []string {
+	var tokens []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '.':
+			if depth == 0 {
+				tokens = append(tokens, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(tokens, s[start:])
+}
+
+// Move moves the resources at from in the source state to the destination
+// state, renamed to to: a resource address moves one resource with all its
+// instances, a module address every resource within the module. A resource
+// keeps its type and mode. Both states keep their lineage and have their
+// serial bumped; an empty destination becomes a new state. The instances'
+// recorded dependencies refer to the source stack and are dropped; the next
+// apply of the destination records them again.
+func Move(source, destination []byte, from, to string) (*MoveResult, error) {
+	fromAddr, err := parseAddress(from)
+	if err != nil {
+		return nil, err
+	}
+	toAddr, err := parseAddress(to)
+	if err != nil {
+		return nil, err
+	}
+	if fromAddr.isModule() != toAddr.isModule() {
+		return nil, fmt.Errorf("cannot move %s to %s: both must be modules or both resources", from, to)
+	}
+	if !fromAddr.isModule() && (fromAddr.typ != toAddr.typ || fromAddr.mode != toAddr.mode) {
+		return nil, fmt.Errorf("cannot move %s to %s: a resource keeps its type", from, to)
+	}
+
+	src, srcSerial, err := decodeState(source)
+	if err != nil {
+		return nil, fmt.Errorf("source state: %w", err)
+	}
+	if src == nil {
+		return nil, fmt.Errorf("the source stack has no state")
+	}
+	dst, dstSerial, err := decodeState(destination)
+	if err != nil {
+		return nil, fmt.Errorf("destination state: %w", err)
+	}
+	if dst == nil {
+		lineage, err := newLineage()
+		if err != nil {
+			return nil, err
+		}
+		dst = map[string]interface{}{
+			"version":           json.Number(stateVersion),
+			"terraform_version": src["terraform_version"],
+			"serial":            json.Number("0"),
+			"lineage":           lineage,
+			"outputs":           map[string]interface{}{},
+			"resources":         []interface{}{},
+		}
+	}
+	rollback := deepCopy(dst).(map[string]interface{})
+
+	srcResources, _ := src["resources"].([]interface{})
+	dstResources, _ := dst["resources"].([]interface{})
+	existing := make(map[string]bool, len(dstResources))
+	for _, raw := range dstResources {
+		if res, ok := raw.(map[string]interface{}); ok {
+			existing[resourceAddress(res)] = true
+		}
+	}
+
+	var kept []interface{}
+	var moved []string
+	for _, raw := range srcResources {
+		res, ok := raw.(map[string]interface{})
+		if !ok || !fromAddr.matches(res) {
+			kept = append(kept, raw)
+			continue
+		}
+		before := resourceAddress(res)
+		toAddr.rename(fromAddr, res)
+		after := resourceAddress(res)
+		if existing[after] {
+			return nil, fmt.Errorf("the destination state already has %s", after)
+		}
+		instances, _ := res["instances"].([]interface{})
+		for _, inst := range instances {
+			if inst, ok := inst.(map[string]interface{}); ok {
+				delete(inst, "dependencies")
+			}
+		}
+		dstResources = append(dstResources, res)
+		moved = append(moved, fmt.Sprintf("%s -> %s (%d instances)", before, after, len(instances)))
+	}
+	if len(moved) == 0 {
+		return nil, fmt.Errorf("the source state has no resources at %s", from)
+	}
+	if kept == nil {
+		kept = []interface{}{}
+	}
+	src["resources"] = kept
+	dst["resources"] = dstResources
+
+	for name, doc := range map[string]map[string]interface{}{"source": src, "destination": dst} {
+		if err := checkState(doc); err != nil {
+			return nil, fmt.Errorf("%s state after the move is invalid: %w", name, err)
+		}
+	}
+
+	result := &MoveResult{SourceSerial: srcSerial + 1, DestinationSerial: dstSerial + 1, Moved: moved}
+	src["serial"] = json.Number(fmt.Sprint(result.SourceSerial))
+	dst["serial"] = json.Number(fmt.Sprint(result.DestinationSerial))
+	rollback["serial"] = json.Number(fmt.Sprint(result.DestinationSerial + 1))
+	if result.Source, err = encode(src); err != nil {
+		return nil, err
+	}
+	if result.Destination, err = encode(dst); err != nil {
+		return nil, err
+	}
+	if result.Rollback, err = encode(rollback); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// matches reports whether the state resource res is at a or, for a module
+// address, within it.
+func (a address) matches(res map[string]interface{}) bool {
+	module, _ := res["module"].(string)
+	if a.isModule() {
+		return module == a.module || strings.HasPrefix(module, a.module+".")
+	}
+	return module == a.module && res["mode"] == a.mode && res["type"] == a.typ && res["name"] == a.name
+}
+
+// rename moves the state resource res, which from matches, to a.
+func (a address) rename(from address, res map[string]interface{}) {
+	module := a.module
+	if a.isModule() {
+		old, _ := res["module"].(string)
+		module += strings.TrimPrefix(old, from.module)
+	} else {
+		res["name"] = a.name
+	}
+	if module == "" {
+		delete(res, "module")
+	} else {
+		res["module"] = module
+	}
+}
+
+// decodeState decodes a pulled state, returning nil for an empty one.
+func decodeState(state []byte) (map[string]interface{}, int64, error) {
+	if strings.TrimSpace(string(state)) == "" {
+		return nil, 0, nil
+	}
+	value, err := decode(state)
+	if err != nil {
+		return nil, 0, err
+	}
+	doc, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, 0, fmt.Errorf("not a JSON object")
+	}
+	if version := fmt.Sprint(doc["version"]); version != stateVersion {
+		return nil, 0, fmt.Errorf("state format version %s is not supported; only version %s states can be changed", version, stateVersion)
+	}
+	serial, err := number(doc["serial"])
+	if err != nil {
+		return nil, 0, fmt.Errorf("serial: %w", err)
+	}
+	return doc, serial, nil
+}
+
+// newLineage returns a random version 4 UUID, as Terraform uses for lineage.
+func newLineage() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,40 @@
+package statepatch
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Restore prepares backup, an earlier state of a stack, to replace its
+// current state: both must share a lineage, and the backup's serial is set
+// above the current one so the backend accepts it. A stack without state
+// takes the backup unchanged. It returns the state to push and its serial.
+func Restore(current, backup []byte) ([]byte, int64, error) {
+	doc, serial, err := decodeState(backup)
+	if err != nil {
+		return nil, 0, fmt.Errorf("backup: %w", err)
+	}
+	if doc == nil {
+		return nil, 0, fmt.Errorf("the backup is empty")
+	}
+	if err := checkState(doc); err != nil {
+		return nil, 0, fmt.Errorf("backup is invalid: %w", err)
+	}
+	now, nowSerial, err := decodeState(current)
+	if err != nil {
+		return nil, 0, fmt.Errorf("current state: %w", err)
+	}
+	if now == nil {
+		return backup, serial, nil
+	}
+	if doc["lineage"] != now["lineage"] {
+		return nil, 0, fmt.Errorf("the backup has lineage %v but the current state %v; it belongs to an earlier state of the stack", doc["lineage"], now["lineage"])
+	}
+	serial = max(serial, nowSerial) + 1
+	doc["serial"] = json.Number(fmt.Sprint(serial))
+	data, err := encode(doc)
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, serial, nil
+}
@@ -0,0 +1,301 @@
+package statepatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// stateVersion is the only state format version patches are applied to.
+const stateVersion = "4"
+
+// Change is one difference between the pulled and the patched state.
+type Change struct {
+	// Kind is "add", "remove" or "replace".
+	Kind string
+	// Path is a JSON pointer into the state.
+	Path   string
+	Before interface{}
+	After  interface{}
+}
+
+// String renders the change as a diff line.
+func (c Change) String() string {
+	switch c.Kind {
+	case "add":
+		return fmt.Sprintf("+ %s: %s", c.Path, render(c.After))
+	case "remove":
+		return fmt.Sprintf("- %s: %s", c.Path, render(c.Before))
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", c.Path, render(c.Before), render(c.After))
+}
+
+// Result is a patched state ready to be pushed.
+type Result struct {
+	// State is the patched state with its serial bumped.
+	State []byte
+	// Serial is the serial of the patched state.
+	Serial int64
+	// Changes lists what the patch changed, leaving out the serial.
+	Changes []Change
+}
+
+// Prepare applies ops to a pulled state, checks the result is still a valid
+// state of the same lineage and bumps its serial. Patches may not change the
+// version, lineage, terraform_version or serial themselves.
+func Prepare(state []byte, ops []Operation) (*Result, error) {
+	before, err := decode(state)
+	if err != nil {
+		return nil, fmt.Errorf("invalid state: %w", err)
+	}
+	beforeDoc, ok := before.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid state: not a JSON object")
+	}
+	if version := fmt.Sprint(beforeDoc["version"]); version != stateVersion {
+		return nil, fmt.Errorf("state format version %s is not supported; only version %s states can be patched", version, stateVersion)
+	}
+	serial, err := number(beforeDoc["serial"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid state: serial: %w", err)
+	}
+
+	after, err := applyAll(deepCopy(before), ops)
+	if err != nil {
+		return nil, err
+	}
+	afterDoc, ok := after.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("patched state is not a JSON object")
+	}
+	for _, key := range []string{"version", "lineage", "terraform_version", "serial"} {
+		if !equal(beforeDoc[key], afterDoc[key]) {
+			return nil, fmt.Errorf("the patch changes %s, which state patch manages", key)
+		}
+	}
+	if err := checkState(afterDoc); err != nil {
+		return nil, fmt.Errorf("patched state is invalid: %w", err)
+	}
+
+	changes := diff(nil, before, after, nil)
+	afterDoc["serial"] = json.Number(fmt.Sprint(serial + 1))
+	data, err := encode(afterDoc)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{State: data, Serial: serial + 1, Changes: changes}, nil
+}
+
+// checkState checks the parts of the state format Terraform relies on to
+// read a state: the outputs and the shape of every resource and instance.
+func checkState(doc map[string]interface{}) error {
+	if lineage, _ := doc["lineage"].(string); lineage == "" {
+		return fmt.Errorf("lineage is missing")
+	}
+	if outputs, ok := doc["outputs"]; ok {
+		values, ok := outputs.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("outputs is not an object")
+		}
+		for name, output := range values {
+			if _, ok := output.(map[string]interface{}); !ok {
+				return fmt.Errorf("output %q is not an object", name)
+			}
+		}
+	}
+	resources, ok := doc["resources"].([]interface{})
+	if !ok && doc["resources"] != nil {
+		return fmt.Errorf("resources is not an array")
+	}
+	seen := make(map[string]bool, len(resources))
+	for i, raw := range resources {
+		res, ok := raw.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("resources/%d is not an object", i)
+		}
+		for _, key := range []string{"mode", "type", "name", "provider"} {
+			if value, _ := res[key].(string); value == "" {
+				return fmt.Errorf("resources/%d has no %s", i, key)
+			}
+		}
+		if mode := res["mode"]; mode != "managed" && mode != "data" {
+			return fmt.Errorf("resources/%d has unknown mode %q", i, mode)
+		}
+		address := resourceAddress(res)
+		if seen[address] {
+			return fmt.Errorf("resource %s appears more than once", address)
+		}
+		seen[address] = true
+
+		instances, ok := res["instances"].([]interface{})
+		if !ok {
+			return fmt.Errorf("resource %s has no instances array", address)
+		}
+		keys := make(map[string]bool, len(instances))
+		for j, raw := range instances {
+			inst, ok := raw.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("resource %s instance %d is not an object", address, j)
+			}
+			if _, ok := inst["attributes"].(map[string]interface{}); !ok {
+				if _, flat := inst["attributes_flat"].(map[string]interface{}); !flat {
+					return fmt.Errorf("resource %s instance %d has no attributes", address, j)
+				}
+			}
+			if v, ok := inst["schema_version"]; ok {
+				if _, err := number(v); err != nil {
+					return fmt.Errorf("resource %s instance %d: schema_version: %w", address, j, err)
+				}
+			}
+			key := render(inst["index_key"])
+			if keys[key] {
+				return fmt.Errorf("resource %s has more than one instance with index_key %s", address, key)
+			}
+			keys[key] = true
+		}
+	}
+	return nil
+}
+
+func resourceAddress(res map[string]interface{}) string {
+	parts := []string{}
+	if module, _ := res["module"].(string); module != "" {
+		parts = append(parts, module)
+	}
+	if res["mode"] == "data" {
+		parts = append(parts, "data")
+	}
+	parts = append(parts, fmt.Sprint(res["type"]), fmt.Sprint(res["name"]))
+	return strings.Join(parts, ".")
+}
+
+func number(value interface{}) (int64, error) {
+	n, ok := value.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("%s is not a number", render(value))
+	}
+	return n.Int64()
+}
+
+// diff lists the changes between two decoded documents under path. Arrays of
+// different lengths are matched by element, so removing one resource shows
+// as one removal rather than a shift of every later resource.
+func diff(path []string, before, after interface{}, changes []Change) []Change {
+	if equal(before, after) {
+		return changes
+	}
+	at := func(token string) []string {
+		return append(append([]string(nil), path...), token)
+	}
+	switch b := before.(type) {
+	case map[string]interface{}:
+		a, ok := after.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make(map[string]bool, len(b)+len(a))
+		for k := range b {
+			keys[k] = true
+		}
+		for k := range a {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			bv, inBefore := b[k]
+			av, inAfter := a[k]
+			switch {
+			case !inAfter:
+				changes = append(changes, Change{Kind: "remove", Path: formatPointer(at(k)), Before: bv})
+			case !inBefore:
+				changes = append(changes, Change{Kind: "add", Path: formatPointer(at(k)), After: av})
+			default:
+				changes = diff(at(k), bv, av, changes)
+			}
+		}
+		return changes
+	case []interface{}:
+		a, ok := after.([]interface{})
+		if !ok {
+			break
+		}
+		if len(a) == len(b) {
+			for i := range b {
+				changes = diff(at(fmt.Sprint(i)), b[i], a[i], changes)
+			}
+			return changes
+		}
+		return diffArrays(path, b, a, changes)
+	}
+	return append(changes, Change{Kind: "replace", Path: formatPointer(path), Before: before, After: after})
+}
+
+// diffArrays matches the elements of arrays of different lengths by their
+// longest common subsequence. Between two matched elements, the unmatched
+// elements are paired in order and diffed, so editing one resource while
+// removing another still shows the edit; the rest are reported as removed or
+// added. Paths of removed and changed values point into the pulled state and
+// paths of added values into the patched state.
+func diffArrays(path []string, before, after []interface{}, changes []Change) []Change {
+	bs := make([]string, len(before))
+	for i, v := range before {
+		bs[i] = render(v)
+	}
+	as := make([]string, len(after))
+	for i, v := range after {
+		as[i] = render(v)
+	}
+	lcs := make([][]int, len(bs)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(as)+1)
+	}
+	for i := len(bs) - 1; i >= 0; i-- {
+		for j := len(as) - 1; j >= 0; j-- {
+			if bs[i] == as[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	at := func(i int) []string {
+		return append(append([]string(nil), path...), fmt.Sprint(i))
+	}
+	var removed, added []int
+	flush := func() {
+		paired := min(len(removed), len(added))
+		for k := 0; k < paired; k++ {
+			changes = diff(at(removed[k]), before[removed[k]], after[added[k]], changes)
+		}
+		for _, i := range removed[paired:] {
+			changes = append(changes, Change{Kind: "remove", Path: formatPointer(at(i)), Before: before[i]})
+		}
+		for _, j := range added[paired:] {
+			changes = append(changes, Change{Kind: "add", Path: formatPointer(at(j)), After: after[j]})
+		}
+		removed, added = nil, nil
+	}
+	i, j := 0, 0
+	for i < len(bs) || j < len(as) {
+		switch {
+		case i < len(bs) && j < len(as) && bs[i] == as[j]:
+			flush()
+			i++
+			j++
+		case j == len(as) || (i < len(bs) && lcs[i+1][j] >= lcs[i][j+1]):
+			removed = append(removed, i)
+			i++
+		default:
+			added = append(added, j)
+			j++
+		}
+	}
+	flush()
+	return changes
+}
@@ -0,0 +1,394 @@
+// Package statepatch applies RFC 6902 JSON patches to pulled Terraform state,
+// as a safer alternative to editing state files by hand. A patched state is
+// checked against the state format before it is pushed, and its serial is
+// bumped so the backend accepts it. Resources are moved between the states
+// of two stacks, and backups restored over a stack's state, the same way.
+package statepatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Operation is one operation of a JSON patch.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Parse reads a JSON patch document: an array of operations.
+func Parse(data []byte) ([]Operation, error) {
+	var ops []Operation
+	if err := json.Unmarshal(data, &ops); err != nil {
+		return nil, fmt.Errorf("invalid JSON patch: %w", err)
+	}
+	for i, op := range ops {
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, fmt.Errorf("operation %d (%s %s) has no value", i, op.Op, op.Path)
+			}
+		case "move", "copy":
+			if _, err := pointer(op.From); err != nil {
+				return nil, fmt.Errorf("operation %d (%s %s): from: %w", i, op.Op, op.Path, err)
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("operation %d has unknown op %q", i, op.Op)
+		}
+		if _, err := pointer(op.Path); err != nil {
+			return nil, fmt.Errorf("operation %d (%s): path: %w", i, op.Op, err)
+		}
+	}
+	return ops, nil
+}
+
+// Apply applies ops in order to the JSON document doc, failing the whole
+// patch if any operation fails. Numbers keep their original text.
+func Apply(doc []byte, ops []Operation) ([]byte, error) {
+	value, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	if value, err = applyAll(value, ops); err != nil {
+		return nil, err
+	}
+	return encode(value)
+}
+
+func applyAll(doc interface{}, ops []Operation) (interface{}, error) {
+	for i, op := range ops {
+		var err error
+		if doc, err = applyOne(doc, op); err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+func applyOne(doc interface{}, op Operation) (interface{}, error) {
+	path, err := pointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch op.Op {
+	case "add":
+		value, err := decode(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	case "remove":
+		doc, _, err := remove(doc, path)
+		return doc, err
+	case "replace":
+		value, err := decode(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return value, nil
+		}
+		if doc, _, err = remove(doc, path); err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	case "move":
+		from, err := pointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		if len(path) > len(from) && hasPrefix(path, from) {
+			return nil, fmt.Errorf("cannot move %s into its own child %s", op.From, op.Path)
+		}
+		doc, value, err := remove(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	case "copy":
+		from, err := pointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, deepCopy(value))
+	case "test":
+		want, err := decode(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		got, err := get(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(got, want) {
+			return nil, fmt.Errorf("test failed: value is %s", render(got))
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unknown op %q", op.Op)
+}
+
+// pointer splits an RFC 6901 JSON pointer into its unescaped reference
+// tokens. The empty pointer refers to the whole document.
+func pointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("JSON pointer %q must start with /", p)
+	}
+	tokens := strings.Split(p[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// formatPointer renders reference tokens as a JSON pointer.
+func formatPointer(tokens []string) string {
+	var b strings.Builder
+	for _, token := range tokens {
+		b.WriteString("/")
+		b.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(token))
+	}
+	return b.String()
+}
+
+func hasPrefix(path, prefix []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if path[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func get(doc interface{}, path []string) (interface{}, error) {
+	for i, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			child, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("%s does not exist", formatPointer(path[:i+1]))
+			}
+			doc = child
+		case []interface{}:
+			index, err := arrayIndex(token, len(node))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", formatPointer(path[:i+1]), err)
+			}
+			doc = node[index]
+		default:
+			return nil, fmt.Errorf("%s is not an object or array", formatPointer(path[:i]))
+		}
+	}
+	return doc, nil
+}
+
+// update calls fn on the container holding the last token of path and
+// stores the container fn returns in its parent, since adding to or removing
+// from an array makes a new slice.
+func update(doc interface{}, path []string, fn func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	updated, err := fn(parent, path[len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	if len(path) == 1 {
+		return updated, nil
+	}
+	grandparent, err := get(doc, path[:len(path)-2])
+	if err != nil {
+		return nil, err
+	}
+	token := path[len(path)-2]
+	switch node := grandparent.(type) {
+	case map[string]interface{}:
+		node[token] = updated
+	case []interface{}:
+		index, _ := arrayIndex(token, len(node))
+		node[index] = updated
+	}
+	return doc, nil
+}
+
+func add(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return update(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[token] = value
+			return node, nil
+		case []interface{}:
+			if token == "-" {
+				return append(node, value), nil
+			}
+			index, err := arrayIndex(token, len(node)+1)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", formatPointer(path), err)
+			}
+			node = append(node, nil)
+			copy(node[index+1:], node[index:])
+			node[index] = value
+			return node, nil
+		}
+		return nil, fmt.Errorf("%s is not an object or array", formatPointer(path[:len(path)-1]))
+	})
+}
+
+func remove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("cannot remove the whole document")
+	}
+	var removed interface{}
+	doc, err := update(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("%s does not exist", formatPointer(path))
+			}
+			removed = value
+			delete(node, token)
+			return node, nil
+		case []interface{}:
+			index, err := arrayIndex(token, len(node))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", formatPointer(path), err)
+			}
+			removed = node[index]
+			return append(node[:index:index], node[index+1:]...), nil
+		}
+		return nil, fmt.Errorf("%s is not an object or array", formatPointer(path[:len(path)-1]))
+	})
+	return doc, removed, err
+}
+
+// arrayIndex parses an array index token, which must be below limit.
+func arrayIndex(token string, limit int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if index >= limit {
+		return 0, fmt.Errorf("array index %d is out of range", index)
+	}
+	return index, nil
+}
+
+func decode(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid JSON: unexpected data after the document")
+	}
+	return value, nil
+}
+
+func encode(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			out[k] = deepCopy(child)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, child := range v {
+			out[i] = deepCopy(child)
+		}
+		return out
+	}
+	return value
+}
+
+// equal compares decoded JSON values, treating numbers by value so 1 and
+// 1.0 are equal.
+func equal(a, b interface{}) bool {
+	switch x := a.(type) {
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			w, ok := y[k]
+			if !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if x == y {
+			return true
+		}
+		fx, errx := x.Float64()
+		fy, erry := y.Float64()
+		return errx == nil && erry == nil && fx == fy
+	}
+	return a == b
+}
+
+// render formats a value compactly for diffs and errors.
+func render(value interface{}) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(value); err != nil {
+		return fmt.Sprint(value)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -0,0 +1,241 @@
+package statepatch_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/statepatch"
+)
+
+const state = `{
+  "version": 4,
+  "terraform_version": "1.7.5",
+  "serial": 12,
+  "lineage": "3f1c2c6e-6d1a-4a8e-9d57-1b2f0c6f9a10",
+  "outputs": {},
+  "resources": [
+    {
+      "mode": "managed",
+      "type": "aws_s3_bucket",
+      "name": "logs",
+      "provider": "provider[\"registry.terraform.io/hashicorp/aws\"]",
+      "instances": [
+        {"schema_version": 0, "attributes": {"bucket": "logs", "size": 1.50}}
+      ]
+    },
+    {
+      "mode": "managed",
+      "type": "aws_s3_bucket",
+      "name": "stale",
+      "provider": "provider[\"registry.terraform.io/hashicorp/aws\"]",
+      "instances": [
+        {"schema_version": 0, "attributes": {"bucket": "stale"}}
+      ]
+    },
+    {
+      "mode": "data",
+      "type": "aws_region",
+      "name": "current",
+      "provider": "provider[\"registry.terraform.io/hashicorp/aws\"]",
+      "instances": [
+        {"schema_version": 0, "attributes": {"name": "eu-west-2"}}
+      ]
+    }
+  ]
+}`
+
+func patch(t *testing.T, doc string) []statepatch.Operation {
+	t.Helper()
+	ops, err := statepatch.Parse([]byte(doc))
+	require.NoError(t, err)
+	return ops
+}
+
+func TestApplyOperations(t *testing.T) {
+	doc := `{"a": {"b": [1, 2, 3]}, "c": "x", "n": 1.50}`
+	ops := patch(t, `[
+		{"op": "test", "path": "/c", "value": "x"},
+		{"op": "test", "path": "/n", "value": 1.5},
+		{"op": "add", "path": "/a/b/1", "value": 9},
+		{"op": "add", "path": "/a/b/-", "value": 4},
+		{"op": "remove", "path": "/a/b/0"},
+		{"op": "replace", "path": "/c", "value": "y"},
+		{"op": "copy", "from": "/c", "path": "/d"},
+		{"op": "move", "from": "/d", "path": "/a~1e"}
+	]`)
+	out, err := statepatch.Apply([]byte(doc), ops)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"a": {"b": [9, 2, 3, 4]}, "c": "y", "a/e": "y", "n": 1.50}`, string(out))
+	require.Contains(t, string(out), "1.50")
+}
+
+func TestApplyFailures(t *testing.T) {
+	doc := []byte(`{"a": [1], "c": "x"}`)
+	for name, ops := range map[string]string{
+		"test mismatch":    `[{"op": "test", "path": "/c", "value": "y"}]`,
+		"missing member":   `[{"op": "remove", "path": "/b"}]`,
+		"index too large":  `[{"op": "add", "path": "/a/2", "value": 0}]`,
+		"replace missing":  `[{"op": "replace", "path": "/b", "value": 0}]`,
+		"move into child":  `[{"op": "move", "from": "/a", "path": "/a/0"}]`,
+		"leading zero":     `[{"op": "remove", "path": "/a/00"}]`,
+		"scalar container": `[{"op": "add", "path": "/c/d", "value": 0}]`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := statepatch.Apply(doc, patch(t, ops))
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestParseRejectsInvalidPatches(t *testing.T) {
+	for name, doc := range map[string]string{
+		"not an array":  `{"op": "remove", "path": "/a"}`,
+		"unknown op":    `[{"op": "merge", "path": "/a"}]`,
+		"missing value": `[{"op": "add", "path": "/a"}]`,
+		"bad pointer":   `[{"op": "remove", "path": "a"}]`,
+		"bad from":      `[{"op": "move", "from": "a", "path": "/b"}]`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := statepatch.Parse([]byte(doc))
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestPrepareBumpsSerialAndDiffs(t *testing.T) {
+	ops := patch(t, `[
+		{"op": "test", "path": "/resources/1/name", "value": "stale"},
+		{"op": "remove", "path": "/resources/1"},
+		{"op": "replace", "path": "/resources/0/instances/0/attributes/bucket", "value": "audit-logs"}
+	]`)
+	result, err := statepatch.Prepare([]byte(state), ops)
+	require.NoError(t, err)
+	require.Equal(t, int64(13), result.Serial)
+
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(result.State, &doc))
+	require.Equal(t, float64(13), doc["serial"])
+	require.Equal(t, "3f1c2c6e-6d1a-4a8e-9d57-1b2f0c6f9a10", doc["lineage"])
+	require.Len(t, doc["resources"], 2)
+
+	lines := make([]string, 0, len(result.Changes))
+	for _, change := range result.Changes {
+		lines = append(lines, change.String())
+	}
+	require.Equal(t, []string{
+		`~ /resources/0/instances/0/attributes/bucket: "logs" -> "audit-logs"`,
+		`- /resources/1: {"instances":[{"attributes":{"bucket":"stale"},"schema_version":0}],"mode":"managed","name":"stale","provider":"provider[\"registry.terraform.io/hashicorp/aws\"]","type":"aws_s3_bucket"}`,
+	}, lines)
+}
+
+func TestPrepareRejectsInvalidStates(t *testing.T) {
+	for name, ops := range map[string]string{
+		"lineage":            `[{"op": "replace", "path": "/lineage", "value": "other"}]`,
+		"serial":             `[{"op": "replace", "path": "/serial", "value": 40}]`,
+		"version":            `[{"op": "replace", "path": "/version", "value": 3}]`,
+		"resources type":     `[{"op": "replace", "path": "/resources", "value": {}}]`,
+		"missing provider":   `[{"op": "remove", "path": "/resources/0/provider"}]`,
+		"unknown mode":       `[{"op": "replace", "path": "/resources/0/mode", "value": "import"}]`,
+		"duplicate resource": `[{"op": "replace", "path": "/resources/1/name", "value": "logs"}]`,
+		"no attributes":      `[{"op": "remove", "path": "/resources/0/instances/0/attributes"}]`,
+		"duplicate instance": `[{"op": "copy", "from": "/resources/0/instances/0", "path": "/resources/0/instances/-"}]`,
+		"instances type":     `[{"op": "replace", "path": "/resources/0/instances", "value": null}]`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := statepatch.Prepare([]byte(state), patch(t, ops))
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestPrepareRejectsOldStateVersions(t *testing.T) {
+	_, err := statepatch.Prepare([]byte(`{"version": 3, "serial": 1, "lineage": "x"}`), nil)
+	require.ErrorContains(t, err, "version 3 is not supported")
+}
+
+func TestMoveBetweenStates(t *testing.T) {
+	dest := `{
+  "version": 4,
+  "terraform_version": "1.7.5",
+  "serial": 3,
+  "lineage": "9b0e4c1a-1111-4a8e-9d57-1b2f0c6f9a10",
+  "outputs": {},
+  "resources": [
+    {
+      "module": "module.storage",
+      "mode": "managed",
+      "type": "aws_s3_bucket",
+      "name": "stale",
+      "provider": "provider[\"registry.terraform.io/hashicorp/aws\"]",
+      "instances": [{"attributes": {"bucket": "other"}}]
+    }
+  ]
+}`
+	result, err := statepatch.Move([]byte(state), []byte(dest), "aws_s3_bucket.logs", "module.storage.aws_s3_bucket.logs")
+	require.NoError(t, err)
+	require.Equal(t, []string{"aws_s3_bucket.logs -> module.storage.aws_s3_bucket.logs (1 instances)"}, result.Moved)
+	require.Equal(t, int64(13), result.SourceSerial)
+	require.Equal(t, int64(4), result.DestinationSerial)
+
+	var src, dst, rollback map[string]interface{}
+	require.NoError(t, json.Unmarshal(result.Source, &src))
+	require.NoError(t, json.Unmarshal(result.Destination, &dst))
+	require.NoError(t, json.Unmarshal(result.Rollback, &rollback))
+	require.Len(t, src["resources"], 2)
+	require.Equal(t, "3f1c2c6e-6d1a-4a8e-9d57-1b2f0c6f9a10", src["lineage"])
+	require.Len(t, dst["resources"], 2)
+	require.Equal(t, "9b0e4c1a-1111-4a8e-9d57-1b2f0c6f9a10", dst["lineage"])
+	require.Equal(t, float64(5), rollback["serial"])
+	require.Len(t, rollback["resources"], 1)
+
+	// The destination already has the resource.
+	_, err = statepatch.Move([]byte(state), []byte(dest), "aws_s3_bucket.stale", "module.storage.aws_s3_bucket.stale")
+	require.ErrorContains(t, err, "already has module.storage.aws_s3_bucket.stale")
+
+	// A module moves with everything in it, into a stack without state.
+	result, err = statepatch.Move([]byte(dest), nil, "module.storage", "module.archive")
+	require.NoError(t, err)
+	require.Equal(t, []string{"module.storage.aws_s3_bucket.stale -> module.archive.aws_s3_bucket.stale (1 instances)"}, result.Moved)
+	require.Equal(t, int64(1), result.DestinationSerial)
+	require.NoError(t, json.Unmarshal(result.Destination, &dst))
+	require.Equal(t, "1.7.5", dst["terraform_version"])
+	require.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, dst["lineage"])
+
+	for from, to := range map[string]string{
+		"aws_s3_bucket.missing":      "aws_s3_bucket.missing",
+		"aws_s3_bucket.logs":         "aws_iam_role.logs",
+		"aws_s3_bucket.logs[0]":      "aws_s3_bucket.logs",
+		"module.storage":             "aws_s3_bucket.logs",
+		"aws_s3_bucket":              "aws_s3_bucket.logs",
+		"data.aws_region.current.id": "data.aws_region.current",
+	} {
+		_, err := statepatch.Move([]byte(state), []byte(dest), from, to)
+		require.Error(t, err, from)
+	}
+}
+
+func TestRestoreBumpsSerialAboveCurrent(t *testing.T) {
+	current := strings.Replace(state, `"serial": 12`, `"serial": 20`, 1)
+	restored, serial, err := statepatch.Restore([]byte(current), []byte(state))
+	require.NoError(t, err)
+	require.Equal(t, int64(21), serial)
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(restored, &doc))
+	require.Equal(t, float64(21), doc["serial"])
+	require.Len(t, doc["resources"], 3)
+
+	// A stack without state takes the backup as it is.
+	restored, serial, err = statepatch.Restore(nil, []byte(state))
+	require.NoError(t, err)
+	require.Equal(t, int64(12), serial)
+	require.Equal(t, state, string(restored))
+
+	other := strings.Replace(state, "3f1c2c6e", "00000000", 1)
+	_, _, err = statepatch.Restore([]byte(other), []byte(state))
+	require.ErrorContains(t, err, "lineage")
+	_, _, err = statepatch.Restore([]byte(current), nil)
+	require.ErrorContains(t, err, "empty")
+}
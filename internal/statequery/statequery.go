@@ -0,0 +1,256 @@
+// Package statequery indexes the resources of pulled Terraform states so they
+// can be searched across the stacks of an environment by address, type or
+// attribute value, without touching the states themselves.
+package statequery
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Redacted replaces the values of sensitive attributes.
+const Redacted = "(sensitive)"
+
+// Instance is one resource instance of a stack's state.
+type Instance struct {
+	// Stack is the stack path relative to the repository root.
+	Stack string `json:"stack"`
+	// Address is the full instance address, e.g. module.lb.aws_lb.main[0].
+	Address    string         `json:"address"`
+	Mode       string         `json:"mode"`
+	Type       string         `json:"type"`
+	Attributes map[string]any `json:"attributes"`
+}
+
+// Parse returns the resource instances of a raw state file, with sensitive
+// attribute values redacted. An empty state has none.
+func Parse(stack string, state []byte) ([]Instance, error) {
+	if strings.TrimSpace(string(state)) == "" {
+		return nil, nil
+	}
+	var doc struct {
+		Resources []struct {
+			Module    string `json:"module"`
+			Mode      string `json:"mode"`
+			Type      string `json:"type"`
+			Name      string `json:"name"`
+			Instances []struct {
+				IndexKey            any               `json:"index_key"`
+				Attributes          map[string]any    `json:"attributes"`
+				SensitiveAttributes []json.RawMessage `json:"sensitive_attributes"`
+			} `json:"instances"`
+		} `json:"resources"`
+	}
+	if err := json.Unmarshal(state, &doc); err != nil {
+		return nil, fmt.Errorf("invalid state: %w", err)
+	}
+
+	var instances []Instance
+	for _, res := range doc.Resources {
+		base := res.Type + "." + res.Name
+		if res.Mode == "data" {
+			base = "data." + base
+		}
+		if res.Module != "" {
+			base = res.Module + "." + base
+		}
+		for _, inst := range res.Instances {
+			for _, raw := range inst.SensitiveAttributes {
+				redact(inst.Attributes, raw)
+			}
+			instances = append(instances, Instance{
+				Stack:      stack,
+				Address:    base + indexSuffix(inst.IndexKey),
+				Mode:       res.Mode,
+				Type:       res.Type,
+				Attributes: inst.Attributes,
+			})
+		}
+	}
+	return instances, nil
+}
+
+func indexSuffix(key any) string {
+	switch k := key.(type) {
+	case nil:
+		return ""
+	case float64:
+		return "[" + strconv.FormatFloat(k, 'f', -1, 64) + "]"
+	case string:
+		return "[" + strconv.Quote(k) + "]"
+	default:
+		return fmt.Sprintf("[%v]", k)
+	}
+}
+
+// redact replaces the value at a sensitive attribute path, recorded by
+// Terraform as a list of get_attr and index steps.
+func redact(attrs map[string]any, raw json.RawMessage) {
+	var steps []struct {
+		Type  string          `json:"type"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &steps); err != nil || len(steps) == 0 {
+		return
+	}
+	var parent any = attrs
+	for i, step := range steps {
+		last := i == len(steps)-1
+		switch node := parent.(type) {
+		case map[string]any:
+			var key string
+			if step.Type == "get_attr" {
+				if json.Unmarshal(step.Value, &key) != nil {
+					return
+				}
+			} else {
+				var index struct {
+					Value string `json:"value"`
+				}
+				if json.Unmarshal(step.Value, &index) != nil {
+					return
+				}
+				key = index.Value
+			}
+			if _, ok := node[key]; !ok {
+				return
+			}
+			if last {
+				node[key] = Redacted
+				return
+			}
+			parent = node[key]
+		case []any:
+			var index struct {
+				Value int `json:"value"`
+			}
+			if step.Type != "index" || json.Unmarshal(step.Value, &index) != nil || index.Value < 0 || index.Value >= len(node) {
+				return
+			}
+			if last {
+				node[index.Value] = Redacted
+				return
+			}
+			parent = node[index.Value]
+		default:
+			return
+		}
+	}
+}
+
+// Query selects instances. Empty fields match everything.
+type Query struct {
+	// Address is a glob or substring of the address. Only * and ? are
+	// wildcards; brackets match instance keys literally.
+	Address string
+	// Type is the exact resource type.
+	Type string
+	// Attributes maps attribute paths, e.g. tags.Name, to the exact value
+	// they must have.
+	Attributes map[string]string
+	// Value is a substring any attribute value must contain.
+	Value string
+	// Data includes data sources, which own no infrastructure.
+	Data bool
+}
+
+// Match is an instance selected by a query, with the attribute paths whose
+// values contain the query's Value.
+type Match struct {
+	Instance
+	Paths []string `json:"matched,omitempty"`
+}
+
+// Find returns the instances that match q, ordered by stack and address.
+func Find(instances []Instance, q Query) []Match {
+	var matches []Match
+	for _, inst := range instances {
+		if inst.Mode == "data" && !q.Data {
+			continue
+		}
+		if q.Type != "" && inst.Type != q.Type {
+			continue
+		}
+		if q.Address != "" && !matchAddress(q.Address, inst.Address) {
+			continue
+		}
+		flat := Flatten(inst.Attributes)
+		if !matchAttributes(q.Attributes, flat) {
+			continue
+		}
+		m := Match{Instance: inst}
+		if q.Value != "" {
+			for key, value := range flat {
+				if value != Redacted && strings.Contains(value, q.Value) {
+					m.Paths = append(m.Paths, key)
+				}
+			}
+			if len(m.Paths) == 0 {
+				continue
+			}
+			sort.Strings(m.Paths)
+		}
+		matches = append(matches, m)
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Stack != matches[j].Stack {
+			return matches[i].Stack < matches[j].Stack
+		}
+		return matches[i].Address < matches[j].Address
+	})
+	return matches
+}
+
+func matchAddress(pattern, address string) bool {
+	glob := strings.NewReplacer("[", `\[`, "]", `\]`).Replace(pattern)
+	if ok, err := path.Match(glob, address); err == nil && ok {
+		return true
+	}
+	return strings.Contains(address, pattern)
+}
+
+func matchAttributes(want, flat map[string]string) bool {
+	for key, value := range want {
+		got, ok := flat[key]
+		if !ok || got == Redacted || got != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Flatten maps the scalar attribute values to their paths: nested objects
+// are joined with dots and list elements indexed, e.g. tags.Name or
+// subnets[0].
+func Flatten(attrs map[string]any) map[string]string {
+	flat := make(map[string]string)
+	flatten(flat, "", attrs)
+	return flat
+}
+
+func flatten(flat map[string]string, prefix string, value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			flatten(flat, key, child)
+		}
+	case []any:
+		for i, child := range v {
+			flatten(flat, prefix+"["+strconv.Itoa(i)+"]", child)
+		}
+	case nil:
+	case string:
+		flat[prefix] = v
+	case float64:
+		flat[prefix] = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		flat[prefix] = fmt.Sprint(v)
+	}
+}
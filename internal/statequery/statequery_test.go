@@ -0,0 +1,90 @@
+package statequery_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/statequery"
+)
+
+const state = `{
+  "version": 4,
+  "serial": 3,
+  "resources": [
+    {
+      "module": "module.edge",
+      "mode": "managed",
+      "type": "aws_lb",
+      "name": "public",
+      "instances": [
+        {
+          "index_key": 0,
+          "attributes": {
+            "arn": "arn:aws:elasticloadbalancing:eu-west-1:123456789012:loadbalancer/app/edge/abc",
+            "dns_name": "edge-1.eu-west-1.elb.amazonaws.com",
+            "tags": {"Name": "edge"},
+            "subnets": ["subnet-a", "subnet-b"]
+          },
+          "sensitive_attributes": []
+        }
+      ]
+    },
+    {
+      "mode": "managed",
+      "type": "aws_db_instance",
+      "name": "main",
+      "instances": [
+        {
+          "index_key": "primary",
+          "attributes": {"identifier": "main", "password": "edge-secret"},
+          "sensitive_attributes": [[{"type": "get_attr", "value": "password"}]]
+        }
+      ]
+    },
+    {
+      "mode": "data",
+      "type": "aws_lb",
+      "name": "shared",
+      "instances": [{"attributes": {"dns_name": "shared.elb.amazonaws.com"}}]
+    }
+  ]
+}`
+
+func TestParseAndFind(t *testing.T) {
+	t.Parallel()
+
+	instances, err := statequery.Parse("core-services/network", []byte(state))
+	require.NoError(t, err)
+	require.Len(t, instances, 3)
+	require.Equal(t, "module.edge.aws_lb.public[0]", instances[0].Address)
+	require.Equal(t, `aws_db_instance.main["primary"]`, instances[1].Address)
+	require.Equal(t, statequery.Redacted, instances[1].Attributes["password"])
+	require.Equal(t, "data.aws_lb.shared", instances[2].Address)
+
+	byType := statequery.Find(instances, statequery.Query{Type: "aws_lb"})
+	require.Len(t, byType, 1)
+	withData := statequery.Find(instances, statequery.Query{Type: "aws_lb", Data: true})
+	require.Len(t, withData, 2)
+
+	byGlob := statequery.Find(instances, statequery.Query{Address: "module.edge.*"})
+	require.Len(t, byGlob, 1)
+	byKeyGlob := statequery.Find(instances, statequery.Query{Address: "module.edge.aws_lb.public[*]"})
+	require.Len(t, byKeyGlob, 1)
+	bySubstring := statequery.Find(instances, statequery.Query{Address: "db_instance"})
+	require.Len(t, bySubstring, 1)
+
+	byAttr := statequery.Find(instances, statequery.Query{Attributes: map[string]string{"tags.Name": "edge", "subnets[1]": "subnet-b"}})
+	require.Len(t, byAttr, 1)
+	require.Empty(t, statequery.Find(instances, statequery.Query{Attributes: map[string]string{"tags.Name": "other"}}))
+
+	// Sensitive values are never searched.
+	byValue := statequery.Find(instances, statequery.Query{Value: "edge"})
+	require.Len(t, byValue, 1)
+	require.Equal(t, []string{"arn", "dns_name", "tags.Name"}, byValue[0].Paths)
+	require.Empty(t, statequery.Find(instances, statequery.Query{Value: "secret"}))
+
+	empty, err := statequery.Parse("applications/frontend", []byte(" \n"))
+	require.NoError(t, err)
+	require.Empty(t, empty)
+}
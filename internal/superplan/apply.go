@@ -0,0 +1,286 @@
+package superplan
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"terraform-wrapper/internal/executor"
+	"terraform-wrapper/internal/graph"
+	"terraform-wrapper/internal/logging"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// ResourceChange is a planned change expressed in its originating stack's own
+// address space.
+type ResourceChange struct {
+	Address string   `json:"address"`
+	Actions []string `json:"actions"`
+}
+
+// StackChanges groups the unified plan's changes belonging to one stack.
+type StackChanges struct {
+	Stack   string           `json:"stack"`
+	Changes []ResourceChange `json:"changes"`
+}
+
+// ApplyOptions configures Apply. The embedded Options drive generation of the
+// unified plan; Executor is used for the per-stack applies.
+type ApplyOptions struct {
+	Options
+
+	// Stacks restricts the apply to these relative stack paths. When empty,
+	// every stack with changes in the unified plan is applied.
+	Stacks []string
+
+	// Approve is shown the decomposed changes and returns false to abort.
+	// A nil Approve applies without confirmation.
+	Approve func([]StackChanges) (bool, error)
+
+	Executor executor.Options
+}
+
+type planResult struct {
+	Plan          *tfjson.Plan
+	Graph         graph.Graph
+	Order         []string
+	RootAbs       string
+	PrefixToStack map[string]string
+}
+
+// Apply generates the unified plan, decomposes the approved changes back to
+// their originating stacks, and applies those stacks in dependency order
+// against their own state.
+func Apply(ctx context.Context, opts ApplyOptions) (*executor.Summary, error) {
+	var result *planResult
+	planOpts := opts.Options
+	planOpts.onPlan = func(r *planResult) error {
+		result = r
+		return nil
+	}
+	if err := Run(ctx, planOpts); err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, fmt.Errorf("superplan did not produce a plan")
+	}
+
+	if opts.Executor.Backend != nil {
+		return nil, fmt.Errorf("superplan apply runs stacks locally, so each stack's plan can be checked against the approved changes")
+	}
+
+	changes, err := selectStacks(Decompose(result.Plan, result.PrefixToStack), opts.Stacks)
+	if err != nil {
+		return nil, err
+	}
+	summary := &executor.Summary{}
+	if len(changes) == 0 {
+		logging.Infof("[superplan] no approved stack changes to apply")
+		return summary, nil
+	}
+
+	for _, sc := range changes {
+		logging.Infof("[superplan] %s: %d resource changes", sc.Stack, len(sc.Changes))
+		for _, rc := range sc.Changes {
+			logging.Infof("  %s %s", strings.Join(rc.Actions, ","), rc.Address)
+		}
+	}
+	if opts.Approve != nil {
+		ok, err := opts.Approve(changes)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("superplan apply was not approved")
+		}
+	}
+
+	approved := make(map[string][]ResourceChange, len(changes))
+	for _, sc := range changes {
+		approved[sc.Stack] = sc.Changes
+	}
+	// Each stack is planned to a file, and that plan is applied only if it
+	// makes exactly the approved changes.
+	execOpts := opts.Executor
+	execOpts.Policy = approvedChanges{approved: approved, next: opts.Executor.Policy}
+	for _, stackDir := range result.Order {
+		rel, err := filepath.Rel(result.RootAbs, stackDir)
+		if err != nil {
+			return summary, err
+		}
+		rel = filepath.ToSlash(rel)
+		if _, ok := approved[rel]; !ok {
+			continue
+		}
+		logging.Stack(rel).Infof("[superplan] applying %s", rel)
+		stackSummary, err := executor.ApplyStack(ctx, result.Graph[stackDir], execOpts)
+		if stackSummary != nil {
+			summary.Merge(*stackSummary)
+		}
+		if err != nil {
+			return summary, fmt.Errorf("apply %s: %w", rel, err)
+		}
+	}
+	return summary, nil
+}
+
+// Decompose splits the unified plan's resource changes by originating stack
+// and strips the stack prefix from each address. No-op and read-only changes
+// are omitted. Results are sorted by stack and address.
+func Decompose(plan *tfjson.Plan, prefixToStack map[string]string) []StackChanges {
+	if plan == nil {
+		return nil
+	}
+	stackPrefix := make(map[string]string, len(prefixToStack))
+	for prefix, stack := range prefixToStack {
+		stackPrefix[stack] = prefix
+	}
+
+	byStack := make(map[string][]ResourceChange)
+	for _, rc := range plan.ResourceChanges {
+		change, ok := resourceChange(rc)
+		if !ok {
+			continue
+		}
+		stack := identifyStackFromAddress(rc.Address, prefixToStack)
+		if stack == "" {
+			continue
+		}
+		change.Address = stripStackPrefix(stackPrefix[stack], rc.Address)
+		byStack[stack] = append(byStack[stack], change)
+	}
+
+	stacks := make([]string, 0, len(byStack))
+	for stack := range byStack {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+
+	out := make([]StackChanges, 0, len(stacks))
+	for _, stack := range stacks {
+		rcs := byStack[stack]
+		sort.Slice(rcs, func(i, j int) bool { return rcs[i].Address < rcs[j].Address })
+		out = append(out, StackChanges{Stack: stack, Changes: rcs})
+	}
+	return out
+}
+
+// resourceChange converts rc, reporting false for no-op and read-only
+// changes.
+func resourceChange(rc *tfjson.ResourceChange) (ResourceChange, bool) {
+	if rc == nil || rc.Change == nil || rc.Change.Actions.NoOp() || rc.Change.Actions.Read() {
+		return ResourceChange{}, false
+	}
+	actions := make([]string, 0, len(rc.Change.Actions))
+	for _, a := range rc.Change.Actions {
+		actions = append(actions, string(a))
+	}
+	return ResourceChange{Address: rc.Address, Actions: actions}, true
+}
+
+// approvedChanges is the policy gate of a superplan apply. It refuses a
+// stack's plan unless it makes exactly the changes approved for the stack,
+// so neither drift since the superplan nor changes the superplan left out
+// are applied, and then defers to next.
+type approvedChanges struct {
+	approved map[string][]ResourceChange
+	next     executor.PolicyGate
+}
+
+func (a approvedChanges) Check(ctx context.Context, stackRel string, plan *tfjson.Plan) error {
+	if diff := diffChanges(a.approved[filepath.ToSlash(stackRel)], plan); len(diff) > 0 {
+		return fmt.Errorf("plan of %s differs from the approved superplan, re-run superplan apply to review it:\n  %s", stackRel, strings.Join(diff, "\n  "))
+	}
+	if a.next == nil {
+		return nil
+	}
+	return a.next.Check(ctx, stackRel, plan)
+}
+
+// diffChanges describes how plan's changes differ from approved.
+func diffChanges(approved []ResourceChange, plan *tfjson.Plan) []string {
+	want := make(map[string]string, len(approved))
+	for _, rc := range approved {
+		want[rc.Address] = strings.Join(rc.Actions, ",")
+	}
+	got := make(map[string]string)
+	if plan != nil {
+		for _, rc := range plan.ResourceChanges {
+			if change, ok := resourceChange(rc); ok {
+				got[change.Address] = strings.Join(change.Actions, ",")
+			}
+		}
+	}
+	var diff []string
+	for address, actions := range got {
+		switch approvedActions, ok := want[address]; {
+		case !ok:
+			diff = append(diff, fmt.Sprintf("%s %s was not approved", actions, address))
+		case approvedActions != actions:
+			diff = append(diff, fmt.Sprintf("%s %s was approved as %s", actions, address, approvedActions))
+		}
+	}
+	for address, actions := range want {
+		if _, ok := got[address]; !ok {
+			diff = append(diff, fmt.Sprintf("%s %s is no longer planned", actions, address))
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+// stripStackPrefix reverses rewriteAddress for a single stack prefix.
+func stripStackPrefix(prefix, address string) string {
+	if prefix == "" || address == "" {
+		return address
+	}
+	parts := strings.Split(address, ".")
+	trim := func(i int) {
+		parts[i] = strings.TrimPrefix(parts[i], prefix+"_")
+	}
+
+	if parts[0] == "module" && len(parts) > 1 {
+		trim(1)
+		return strings.Join(parts, ".")
+	}
+
+	nameIdx := 1
+	if parts[0] == "data" {
+		nameIdx = 2
+	}
+	if nameIdx < len(parts) {
+		trim(nameIdx)
+	}
+	return strings.Join(parts, ".")
+}
+
+// selectStacks keeps only the approved stacks. Requesting a stack that has no
+// changes in the unified plan is an error so typos do not silently no-op.
+func selectStacks(changes []StackChanges, approved []string) ([]StackChanges, error) {
+	if len(approved) == 0 {
+		return changes, nil
+	}
+	index := make(map[string]StackChanges, len(changes))
+	for _, sc := range changes {
+		index[sc.Stack] = sc
+	}
+	var out []StackChanges
+	seen := make(map[string]struct{}, len(approved))
+	for _, stack := range approved {
+		stack = filepath.ToSlash(filepath.Clean(stack))
+		if _, ok := seen[stack]; ok {
+			continue
+		}
+		seen[stack] = struct{}{}
+		sc, ok := index[stack]
+		if !ok {
+			return nil, fmt.Errorf("stack %s has no changes in the superplan", stack)
+		}
+		out = append(out, sc)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Stack < out[j].Stack })
+	return out, nil
+}
@@ -0,0 +1,152 @@
+package superplan
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+func TestDecompose(t *testing.T) {
+	plan := &tfjson.Plan{
+		ResourceChanges: []*tfjson.ResourceChange{
+			{Address: "aws_vpc.network_main", Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionUpdate}}},
+			{Address: "module.network_subnets.aws_subnet.private[0]", Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionDelete, tfjson.ActionCreate}}},
+			{Address: "aws_s3_bucket.network_logs", Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionNoop}}},
+			{Address: "data.aws_iam_policy_document.ecs_task", Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionRead}}},
+			{Address: "aws_ecs_service.ecs_api", Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionCreate}}},
+			{Address: "aws_sqs_queue.unknown", Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionCreate}}},
+		},
+	}
+	prefixes := map[string]string{
+		"network": "core/network",
+		"ecs":     "core/ecs",
+	}
+
+	got := Decompose(plan, prefixes)
+	want := []StackChanges{
+		{Stack: "core/ecs", Changes: []ResourceChange{
+			{Address: "aws_ecs_service.api", Actions: []string{"create"}},
+		}},
+		{Stack: "core/network", Changes: []ResourceChange{
+			{Address: "aws_vpc.main", Actions: []string{"update"}},
+			{Address: "module.subnets.aws_subnet.private[0]", Actions: []string{"delete", "create"}},
+		}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected decomposition:\n got %#v\nwant %#v", got, want)
+	}
+}
+
+func TestStripStackPrefix(t *testing.T) {
+	cases := map[string]string{
+		"aws_s3_bucket.state_main":                   "aws_s3_bucket.main",
+		"data.aws_caller_identity.state_current":     "data.aws_caller_identity.current",
+		"module.state_child.aws_s3_bucket.child":     "module.child.aws_s3_bucket.child",
+		"module.state_child.module.inner.aws_x.name": "module.child.module.inner.aws_x.name",
+		"aws_s3_bucket.other":                        "aws_s3_bucket.other",
+	}
+	for in, want := range cases {
+		if got := stripStackPrefix("state", in); got != want {
+			t.Fatalf("stripStackPrefix(%q) = %q, want %q", in, got, want)
+		}
+		if rewritten := rewriteAddress("state", want); want != "aws_s3_bucket.other" && rewritten != in {
+			t.Fatalf("rewriteAddress(%q) = %q, want %q", want, rewritten, in)
+		}
+	}
+}
+
+func TestSelectStacks(t *testing.T) {
+	changes := []StackChanges{{Stack: "core/ecs"}, {Stack: "core/network"}}
+
+	all, err := selectStacks(changes, nil)
+	if err != nil || len(all) != 2 {
+		t.Fatalf("expected all stacks, got %v (%v)", all, err)
+	}
+
+	picked, err := selectStacks(changes, []string{"core/network", "core/network"})
+	if err != nil {
+		t.Fatalf("select stacks: %v", err)
+	}
+	if len(picked) != 1 || picked[0].Stack != "core/network" {
+		t.Fatalf("unexpected selection %v", picked)
+	}
+
+	if _, err := selectStacks(changes, []string{"core/dns"}); err == nil {
+		t.Fatalf("expected error for stack without changes")
+	}
+}
+
+func TestSecurityChangesAttributesStacks(t *testing.T) {
+	plan := &tfjson.Plan{
+		ResourceChanges: []*tfjson.ResourceChange{
+			{Address: "aws_security_group.network_web", Type: "aws_security_group", Mode: tfjson.ManagedResourceMode, Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionUpdate}}},
+			{Address: "aws_iam_role.ecs_task", Type: "aws_iam_role", Mode: tfjson.ManagedResourceMode, Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionCreate}}},
+			{Address: "aws_ecs_service.ecs_api", Type: "aws_ecs_service", Mode: tfjson.ManagedResourceMode, Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionCreate}}},
+		},
+	}
+	prefixes := map[string]string{"network": "core/network", "ecs": "core/ecs"}
+	summaries := map[string]stackChangeSummary{
+		"core/network": {Prefix: "network"},
+		"core/ecs":     {Prefix: "ecs"},
+	}
+
+	got := securityChanges(plan, prefixes, summaries)
+	if len(got) != 2 {
+		t.Fatalf("expected 2 security changes, got %#v", got)
+	}
+	if got[0].Stack != "core/ecs" || got[0].Address != "aws_iam_role.task" || got[0].Category != "iam" {
+		t.Fatalf("unexpected first change: %#v", got[0])
+	}
+	if got[1].Stack != "core/network" || got[1].Address != "aws_security_group.web" || got[1].Category != "network" {
+		t.Fatalf("unexpected second change: %#v", got[1])
+	}
+}
+
+func TestApprovedChangesRefusesChangesThatWereNotApproved(t *testing.T) {
+	gate := approvedChanges{approved: map[string][]ResourceChange{
+		"core/network": {
+			{Address: "aws_vpc.main", Actions: []string{"update"}},
+			{Address: "aws_subnet.private", Actions: []string{"create"}},
+		},
+	}}
+	plan := func(changes ...*tfjson.ResourceChange) *tfjson.Plan {
+		return &tfjson.Plan{ResourceChanges: changes}
+	}
+	change := func(address string, actions ...tfjson.Action) *tfjson.ResourceChange {
+		return &tfjson.ResourceChange{Address: address, Change: &tfjson.Change{Actions: actions}}
+	}
+
+	approved := plan(
+		change("aws_vpc.main", tfjson.ActionUpdate),
+		change("aws_subnet.private", tfjson.ActionCreate),
+		change("aws_s3_bucket.logs", tfjson.ActionNoop),
+	)
+	if err := gate.Check(context.Background(), "core/network", approved); err != nil {
+		t.Fatalf("expected the approved plan to pass, got %v", err)
+	}
+
+	drifted := plan(
+		change("aws_vpc.main", tfjson.ActionDelete, tfjson.ActionCreate),
+		change("aws_s3_bucket.logs", tfjson.ActionUpdate),
+	)
+	err := gate.Check(context.Background(), "core/network", drifted)
+	if err == nil {
+		t.Fatal("expected a plan with other changes to be refused")
+	}
+	for _, want := range []string{
+		"delete,create aws_vpc.main was approved as update",
+		"update aws_s3_bucket.logs was not approved",
+		"create aws_subnet.private is no longer planned",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q in %v", want, err)
+		}
+	}
+
+	if err := gate.Check(context.Background(), "core/ecs", plan(change("aws_ecs_service.api", tfjson.ActionCreate))); err == nil {
+		t.Fatal("expected changes to a stack without approved changes to be refused")
+	}
+}
@@ -0,0 +1,76 @@
+package superplan
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"terraform-wrapper/internal/cost"
+	"terraform-wrapper/internal/logging"
+)
+
+// costSummary is the total monthly cost delta of the superplan.
+type costSummary struct {
+	Currency         string  `json:"currency"`
+	MonthlyCostDelta float64 `json:"monthly_cost_delta"`
+}
+
+// estimateCosts prices the unified plan and attributes each resource's
+// monthly cost delta to its stack in summary. Every stack gets a delta, zero
+// when none of its resources is priced.
+func estimateCosts(ctx context.Context, estimator cost.Estimator, tmpDir string, plan *tfjson.Plan, prefixToStack map[string]string, summary *superplanSummary) error {
+	data, err := json.Marshal(plan)
+	if err != nil {
+		return fmt.Errorf("encode plan for cost estimation: %w", err)
+	}
+	planPath := filepath.Join(tmpDir, "superplan.json")
+	if err := os.WriteFile(planPath, data, 0o600); err != nil {
+		return fmt.Errorf("write plan for cost estimation: %w", err)
+	}
+	estimate, err := estimator.Estimate(ctx, planPath)
+	if err != nil {
+		return err
+	}
+
+	deltas := make(map[string]float64, len(summary.Stacks))
+	total := 0.0
+	for _, res := range estimate.Resources {
+		stackRel := identifyStackFromAddress(res.Address, prefixToStack)
+		if stackRel == "" {
+			continue
+		}
+		deltas[stackRel] += res.MonthlyDelta
+		total += res.MonthlyDelta
+	}
+	for rel, s := range summary.Stacks {
+		delta := deltas[rel]
+		s.MonthlyCostDelta = &delta
+		summary.Stacks[rel] = s
+	}
+	summary.Cost = &costSummary{Currency: estimate.Currency, MonthlyCostDelta: total}
+	return nil
+}
+
+// printCosts prints the monthly cost delta of every stack whose cost changes
+// and the total.
+func printCosts(summary superplanSummary) {
+	if summary.Cost == nil {
+		return
+	}
+	names := make([]string, 0, len(summary.Stacks))
+	for rel, s := range summary.Stacks {
+		if s.MonthlyCostDelta != nil && *s.MonthlyCostDelta != 0 {
+			names = append(names, rel)
+		}
+	}
+	sort.Strings(names)
+	for _, rel := range names {
+		logging.Stack(rel).Infof("[cost] %s: %s", rel, cost.Format(*summary.Stacks[rel].MonthlyCostDelta, summary.Cost.Currency))
+	}
+	logging.Infof("[cost] total: %s", cost.Format(summary.Cost.MonthlyCostDelta, summary.Cost.Currency))
+}
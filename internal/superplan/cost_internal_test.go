@@ -0,0 +1,63 @@
+package superplan
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"terraform-wrapper/internal/cost"
+)
+
+type fakeEstimator struct {
+	estimate *cost.Estimate
+	planPath string
+}
+
+func (f *fakeEstimator) Estimate(_ context.Context, planPath string) (*cost.Estimate, error) {
+	f.planPath = planPath
+	return f.estimate, nil
+}
+
+func TestEstimateCostsAttributesDeltasToStacks(t *testing.T) {
+	estimator := &fakeEstimator{estimate: &cost.Estimate{
+		Currency: "USD",
+		Resources: []cost.Resource{
+			{Address: "aws_nat_gateway.network_main", MonthlyDelta: 32.5},
+			{Address: "aws_instance.network_bastion", MonthlyDelta: -7.5},
+			{Address: "module.app_service.aws_ecs_service.api", MonthlyDelta: 10},
+			{Address: "aws_instance.unknown", MonthlyDelta: 99},
+		},
+	}}
+	summary := superplanSummary{Stacks: map[string]stackChangeSummary{
+		"core-services/network": {Stack: "core-services/network", Prefix: "network"},
+		"applications/app":      {Stack: "applications/app", Prefix: "app"},
+		"applications/dns":      {Stack: "applications/dns", Prefix: "dns"},
+	}}
+	prefixToStack := map[string]string{
+		"network": "core-services/network",
+		"app":     "applications/app",
+		"dns":     "applications/dns",
+	}
+
+	tmpDir := t.TempDir()
+	plan := &tfjson.Plan{FormatVersion: "1.2"}
+	if err := estimateCosts(context.Background(), estimator, tmpDir, plan, prefixToStack, &summary); err != nil {
+		t.Fatalf("estimate costs: %v", err)
+	}
+	if _, err := os.Stat(estimator.planPath); err != nil {
+		t.Fatalf("plan JSON not written for the estimator: %v", err)
+	}
+
+	want := map[string]float64{"core-services/network": 25, "applications/app": 10, "applications/dns": 0}
+	for rel, delta := range want {
+		got := summary.Stacks[rel].MonthlyCostDelta
+		if got == nil || *got != delta {
+			t.Fatalf("%s: monthly cost delta %v, want %v", rel, got, delta)
+		}
+	}
+	if summary.Cost == nil || summary.Cost.MonthlyCostDelta != 35 || summary.Cost.Currency != "USD" {
+		t.Fatalf("unexpected cost total: %+v", summary.Cost)
+	}
+}
@@ -0,0 +1,28 @@
+package superplan
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ChangesExitCode matches terraform plan -detailed-exitcode: 0 means no
+// changes, 2 means changes are present and any other non-zero status is an
+// error.
+const ChangesExitCode = 2
+
+// ChangesPresentError is returned under --detailed-exitcode when a plan
+// succeeded with changes, so CI can gate approvals on the exit status.
+type ChangesPresentError struct {
+	Stacks []string
+}
+
+func (e *ChangesPresentError) Error() string {
+	if len(e.Stacks) == 0 {
+		return "plan has changes"
+	}
+	return fmt.Sprintf("plan has changes in %d stack(s): %s", len(e.Stacks), strings.Join(e.Stacks, ", "))
+}
+
+func (e *ChangesPresentError) ExitCode() int {
+	return ChangesExitCode
+}
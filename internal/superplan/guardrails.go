@@ -0,0 +1,71 @@
+package superplan
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"terraform-wrapper/internal/logging"
+)
+
+// GuardrailExitCode is the exit status of a plan stopped by a guardrail, so
+// pipelines can tell destructive plans that need manual approval from
+// failures and from plans that merely have changes.
+const GuardrailExitCode = 3
+
+// Guardrails bound how destructive a superplan may be.
+type Guardrails struct {
+	// MaxDestroys, when set, is the most resource deletions, replacements
+	// included, the plan may contain.
+	MaxDestroys *int
+	// ForbidDestroyTypes lists resource types the plan must not delete or
+	// replace, such as aws_s3_bucket.
+	ForbidDestroyTypes []string
+}
+
+// GuardrailError is returned when a plan violates a guardrail.
+type GuardrailError struct {
+	Violations []string
+}
+
+func (e *GuardrailError) Error() string {
+	return fmt.Sprintf("plan violates %d guardrail(s): %s", len(e.Violations), strings.Join(e.Violations, "; "))
+}
+
+func (e *GuardrailError) ExitCode() int {
+	return GuardrailExitCode
+}
+
+// checkGuardrails returns the guardrail violations of plan, naming the stack
+// of each forbidden deletion.
+func checkGuardrails(plan *tfjson.Plan, guardrails Guardrails, totalDestroys int, prefixToStack map[string]string) []string {
+	var violations []string
+	if guardrails.MaxDestroys != nil && totalDestroys > *guardrails.MaxDestroys {
+		violations = append(violations, fmt.Sprintf("%d resources would be destroyed, more than --max-destroys %d", totalDestroys, *guardrails.MaxDestroys))
+	}
+	if len(guardrails.ForbidDestroyTypes) == 0 || plan == nil {
+		return violations
+	}
+	for _, rc := range plan.ResourceChanges {
+		if rc == nil || rc.Change == nil || !slices.Contains(guardrails.ForbidDestroyTypes, rc.Type) {
+			continue
+		}
+		if !rc.Change.Actions.Delete() && !rc.Change.Actions.Replace() {
+			continue
+		}
+		location := rc.Address
+		if stack := identifyStackFromAddress(rc.Address, prefixToStack); stack != "" {
+			location = stack + " " + rc.Address
+		}
+		violations = append(violations, fmt.Sprintf("%s would be destroyed, but %s is in --forbid-destroy-types", location, rc.Type))
+	}
+	return violations
+}
+
+func printGuardrailViolations(violations []string) {
+	for _, v := range violations {
+		logging.Errorf("[guardrail] %s", v)
+	}
+}
@@ -0,0 +1,44 @@
+package superplan
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+func TestCheckGuardrails(t *testing.T) {
+	plan := &tfjson.Plan{ResourceChanges: []*tfjson.ResourceChange{
+		{Address: "aws_s3_bucket.data_logs", Type: "aws_s3_bucket", Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionDelete}}},
+		{Address: "aws_rds_cluster.data_main", Type: "aws_rds_cluster", Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionDelete, tfjson.ActionCreate}}},
+		{Address: "aws_s3_bucket.app_assets", Type: "aws_s3_bucket", Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionUpdate}}},
+		{Address: "aws_instance.app_web", Type: "aws_instance", Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionDelete}}},
+	}}
+	prefixToStack := map[string]string{"data": "core-services/data", "app": "applications/app"}
+
+	if violations := checkGuardrails(plan, Guardrails{}, 3, prefixToStack); len(violations) != 0 {
+		t.Fatalf("no guardrails: got %q", violations)
+	}
+
+	limit := 3
+	if violations := checkGuardrails(plan, Guardrails{MaxDestroys: &limit}, 3, prefixToStack); len(violations) != 0 {
+		t.Fatalf("at the limit: got %q", violations)
+	}
+	limit = 2
+	violations := checkGuardrails(plan, Guardrails{MaxDestroys: &limit, ForbidDestroyTypes: []string{"aws_s3_bucket", "aws_rds_cluster"}}, 3, prefixToStack)
+	want := []string{
+		"3 resources would be destroyed, more than --max-destroys 2",
+		"core-services/data aws_s3_bucket.data_logs would be destroyed, but aws_s3_bucket is in --forbid-destroy-types",
+		"core-services/data aws_rds_cluster.data_main would be destroyed, but aws_rds_cluster is in --forbid-destroy-types",
+	}
+	if !reflect.DeepEqual(violations, want) {
+		t.Fatalf("violations %q, want %q", violations, want)
+	}
+
+	var err error = &GuardrailError{Violations: violations}
+	var coded interface{ ExitCode() int }
+	if !errors.As(err, &coded) || coded.ExitCode() != GuardrailExitCode {
+		t.Fatalf("expected exit code %d from %v", GuardrailExitCode, err)
+	}
+}
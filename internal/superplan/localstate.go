@@ -0,0 +1,100 @@
+package superplan
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// LocalStatePath returns where a superplan built from local state reads the
+// state of the stack at the slash-separated path stackRel.
+func LocalStatePath(dir, stackRel string) string {
+	return filepath.Join(dir, filepath.FromSlash(stackRel), "terraform.tfstate")
+}
+
+// LocalExternalDir returns the directory holding the external states of a
+// superplan built from local state, laid out as <bucket>/<key>.
+func LocalExternalDir(dir string) string {
+	return filepath.Join(dir, "external")
+}
+
+// readLocalState reads the exported state of stackRel. A stack must have a
+// state file, as an empty state would plan to create all of its resources.
+func readLocalState(dir, stackRel string) (string, error) {
+	path := LocalStatePath(dir, stackRel)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("no local state for %s at %s", stackRel, path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("read local state for %s: %w", stackRel, err)
+	}
+	return string(data), nil
+}
+
+// offlineAWSSettings keep the aws provider from calling AWS when it is
+// configured; the superplan is planned without refreshing, so resources are
+// not read either.
+var offlineAWSSettings = []struct {
+	name  string
+	value cty.Value
+}{
+	{"access_key", cty.StringVal("offline")},
+	{"secret_key", cty.StringVal("offline")},
+	{"skip_credentials_validation", cty.True},
+	{"skip_requesting_account_id", cty.True},
+	{"skip_metadata_api_check", cty.True},
+	{"skip_region_validation", cty.True},
+}
+
+// configureOfflineProviders rewrites the aws provider blocks of the combined
+// configuration at path to use placeholder credentials and skip the checks
+// that call AWS, dropping role assumption. Without a default aws provider
+// block, one is added for region when the configuration requires aws.
+func configureOfflineProviders(path, region string, requirements providerRequirements) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	file, diags := hclwrite.ParseConfig(src, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return fmt.Errorf("parse %s: %s", path, diags.Error())
+	}
+
+	hasDefault := false
+	for _, block := range file.Body().Blocks() {
+		if block.Type() != "provider" || len(block.Labels()) == 0 || block.Labels()[0] != "aws" {
+			continue
+		}
+		body := block.Body()
+		if body.GetAttribute("alias") == nil {
+			hasDefault = true
+		}
+		for _, nested := range body.Blocks() {
+			switch nested.Type() {
+			case "assume_role", "assume_role_with_web_identity":
+				body.RemoveBlock(nested)
+			}
+		}
+		for _, name := range []string{"profile", "shared_config_files", "shared_credentials_files", "token"} {
+			body.RemoveAttribute(name)
+		}
+		for _, setting := range offlineAWSSettings {
+			body.SetAttributeValue(setting.name, setting.value)
+		}
+	}
+	if _, ok := requirements["aws"]; ok && !hasDefault {
+		file.Body().AppendNewline()
+		body := file.Body().AppendNewBlock("provider", []string{"aws"}).Body()
+		body.SetAttributeValue("region", cty.StringVal(region))
+		for _, setting := range offlineAWSSettings {
+			body.SetAttributeValue(setting.name, setting.value)
+		}
+	}
+	return os.WriteFile(path, file.Bytes(), 0o644)
+}
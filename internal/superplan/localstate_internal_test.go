@@ -0,0 +1,67 @@
+package superplan
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigureOfflineProviders(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "super.tf")
+	src := `provider "aws" {
+  alias   = "replica"
+  region  = "eu-west-1"
+  profile = "prod"
+
+  assume_role {
+    role_arn = "arn:aws:iam::123456789012:role/deploy"
+  }
+}
+
+resource "aws_s3_bucket" "network_logs" {
+  bucket = "logs"
+}
+`
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := configureOfflineProviders(path, "eu-west-2", providerRequirements{"aws": nil}); err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	for _, unwanted := range []string{"assume_role", "profile", "role_arn"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("offline configuration still has %s:\n%s", unwanted, got)
+		}
+	}
+	if n := strings.Count(got, "skip_credentials_validation = true"); n != 2 {
+		t.Errorf("want the aliased provider and an added default provider to skip credential validation, got %d:\n%s", n, got)
+	}
+	if !strings.Contains(got, `region                      = "eu-west-2"`) {
+		t.Errorf("added default provider does not use the region:\n%s", got)
+	}
+}
+
+func TestReadLocalState(t *testing.T) {
+	dir := t.TempDir()
+	path := LocalStatePath(dir, "core-services/network")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(`{"version": 4}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	state, err := readLocalState(dir, "core-services/network")
+	if err != nil || state != `{"version": 4}` {
+		t.Fatalf("read state: %q, %v", state, err)
+	}
+	if _, err := readLocalState(dir, "core-services/storage"); err == nil || !strings.Contains(err.Error(), "no local state for core-services/storage") {
+		t.Fatalf("missing state: got %v", err)
+	}
+}
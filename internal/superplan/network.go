@@ -0,0 +1,184 @@
+package superplan
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"terraform-wrapper/internal/logging"
+)
+
+// Kinds of network issue.
+const (
+	networkIssueCIDROverlap  = "cidr-overlap"
+	networkIssueDeletedGroup = "deleted-group-reference"
+)
+
+// networkIssue is an inconsistency between the network resources of two
+// stacks, which neither stack's own plan can see.
+type networkIssue struct {
+	Kind   string   `json:"kind"`
+	Stacks []string `json:"stacks"`
+	Detail string   `json:"detail"`
+}
+
+// cidrBlock is a CIDR allocated by a resource after the plan is applied.
+// Subnets only conflict with subnets of the same VPC; VPC ranges conflict
+// with each other wherever they are, since they may be peered or attached
+// to the same transit gateway.
+type cidrBlock struct {
+	stack   string
+	address string
+	prefix  netip.Prefix
+	vpcID   string
+	subnet  bool
+}
+
+// groupReference is a resource attribute naming a security group by ID.
+type groupReference struct {
+	stack   string
+	address string
+	groupID string
+}
+
+// groupReferenceAttributes are the attributes of each resource type that
+// hold a security group ID.
+var groupReferenceAttributes = map[string][]string{
+	"aws_security_group_rule":             {"security_group_id", "source_security_group_id"},
+	"aws_vpc_security_group_ingress_rule": {"security_group_id", "referenced_security_group_id"},
+	"aws_vpc_security_group_egress_rule":  {"security_group_id", "referenced_security_group_id"},
+}
+
+// networkIssues inspects the values of the unified plan for CIDR ranges that
+// overlap between stacks and for security group rules that reference a group
+// another stack deletes. Resources deleted by the plan allocate nothing;
+// values only known after apply are skipped.
+func networkIssues(plan *tfjson.Plan, prefixToStack map[string]string, stackSummaries map[string]stackChangeSummary) []networkIssue {
+	if plan == nil {
+		return nil
+	}
+	var blocks []cidrBlock
+	var references []groupReference
+	deletedGroups := make(map[string]groupReference)
+	for _, rc := range plan.ResourceChanges {
+		if rc == nil || rc.Change == nil || rc.Mode != tfjson.ManagedResourceMode {
+			continue
+		}
+		stack := identifyStackFromAddress(rc.Address, prefixToStack)
+		if stack == "" {
+			continue
+		}
+		address := stripStackPrefix(stackSummaries[stack].Prefix, rc.Address)
+		if rc.Change.Actions.Delete() {
+			if before, ok := rc.Change.Before.(map[string]interface{}); ok && rc.Type == "aws_security_group" {
+				if id, ok := before["id"].(string); ok && id != "" {
+					deletedGroups[id] = groupReference{stack: stack, address: address, groupID: id}
+				}
+			}
+			continue
+		}
+		after, ok := rc.Change.After.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if block, ok := allocatedBlock(rc.Type, after); ok {
+			block.stack, block.address = stack, address
+			blocks = append(blocks, block)
+		}
+		for _, id := range referencedGroups(rc.Type, after) {
+			references = append(references, groupReference{stack: stack, address: address, groupID: id})
+		}
+	}
+
+	var issues []networkIssue
+	for i, a := range blocks {
+		for _, b := range blocks[i+1:] {
+			if a.stack == b.stack || a.subnet != b.subnet || (a.subnet && (a.vpcID == "" || a.vpcID != b.vpcID)) {
+				continue
+			}
+			if !a.prefix.Overlaps(b.prefix) {
+				continue
+			}
+			issues = append(issues, networkIssue{
+				Kind:   networkIssueCIDROverlap,
+				Stacks: []string{a.stack, b.stack},
+				Detail: fmt.Sprintf("%s %s (%s) overlaps %s %s (%s)", a.stack, a.address, a.prefix, b.stack, b.address, b.prefix),
+			})
+		}
+	}
+	for _, ref := range references {
+		group, ok := deletedGroups[ref.groupID]
+		if !ok || group.stack == ref.stack {
+			continue
+		}
+		issues = append(issues, networkIssue{
+			Kind:   networkIssueDeletedGroup,
+			Stacks: []string{ref.stack, group.stack},
+			Detail: fmt.Sprintf("%s %s references security group %s, which %s %s deletes", ref.stack, ref.address, ref.groupID, group.stack, group.address),
+		})
+	}
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].Kind != issues[j].Kind {
+			return issues[i].Kind < issues[j].Kind
+		}
+		return issues[i].Detail < issues[j].Detail
+	})
+	return issues
+}
+
+// allocatedBlock returns the IPv4 range a VPC, secondary VPC CIDR
+// association or subnet allocates.
+func allocatedBlock(resourceType string, values map[string]interface{}) (cidrBlock, bool) {
+	var block cidrBlock
+	switch resourceType {
+	case "aws_vpc", "aws_vpc_ipv4_cidr_block_association":
+	case "aws_subnet":
+		block.subnet = true
+		block.vpcID, _ = values["vpc_id"].(string)
+	default:
+		return cidrBlock{}, false
+	}
+	cidr, _ := values["cidr_block"].(string)
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return cidrBlock{}, false
+	}
+	block.prefix = prefix.Masked()
+	return block, true
+}
+
+// referencedGroups returns the security group IDs values references, both
+// through rule resources and the inline ingress and egress blocks of
+// aws_security_group.
+func referencedGroups(resourceType string, values map[string]interface{}) []string {
+	var ids []string
+	for _, attr := range groupReferenceAttributes[resourceType] {
+		if id, ok := values[attr].(string); ok && id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if resourceType != "aws_security_group" {
+		return ids
+	}
+	for _, direction := range []string{"ingress", "egress"} {
+		rules, _ := values[direction].([]interface{})
+		for _, rule := range rules {
+			rule, _ := rule.(map[string]interface{})
+			groups, _ := rule["security_groups"].([]interface{})
+			for _, group := range groups {
+				if id, ok := group.(string); ok && id != "" {
+					ids = append(ids, id)
+				}
+			}
+		}
+	}
+	return ids
+}
+
+func printNetworkIssues(issues []networkIssue) {
+	for _, issue := range issues {
+		logging.Warnf("[network] %s", issue.Detail)
+	}
+}
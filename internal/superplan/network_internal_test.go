@@ -0,0 +1,61 @@
+package superplan
+
+import (
+	"reflect"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+func TestNetworkIssuesAcrossStacks(t *testing.T) {
+	managed := func(address, resourceType string, actions tfjson.Actions, before, after map[string]interface{}) *tfjson.ResourceChange {
+		rc := &tfjson.ResourceChange{Address: address, Type: resourceType, Mode: tfjson.ManagedResourceMode, Change: &tfjson.Change{Actions: actions}}
+		if before != nil {
+			rc.Change.Before = before
+		}
+		if after != nil {
+			rc.Change.After = after
+		}
+		return rc
+	}
+	noop := tfjson.Actions{tfjson.ActionNoop}
+	plan := &tfjson.Plan{ResourceChanges: []*tfjson.ResourceChange{
+		managed("aws_vpc.network_main", "aws_vpc", noop, nil, map[string]interface{}{"id": "vpc-1", "cidr_block": "10.0.0.0/16"}),
+		managed("aws_vpc.legacy_main", "aws_vpc", tfjson.Actions{tfjson.ActionCreate}, nil, map[string]interface{}{"cidr_block": "10.0.128.0/17"}),
+		// A VPC being deleted frees its range.
+		managed("aws_vpc.old_main", "aws_vpc", tfjson.Actions{tfjson.ActionDelete}, map[string]interface{}{"cidr_block": "10.0.0.0/8"}, nil),
+		managed("aws_subnet.network_a", "aws_subnet", noop, nil, map[string]interface{}{"vpc_id": "vpc-1", "cidr_block": "10.0.1.0/24"}),
+		managed("aws_subnet.app_a", "aws_subnet", tfjson.Actions{tfjson.ActionCreate}, nil, map[string]interface{}{"vpc_id": "vpc-1", "cidr_block": "10.0.1.128/25"}),
+		// Subnets of other VPCs, or of the same stack, never conflict.
+		managed("aws_subnet.legacy_a", "aws_subnet", noop, nil, map[string]interface{}{"vpc_id": "vpc-2", "cidr_block": "10.0.1.0/24"}),
+		managed("aws_subnet.network_b", "aws_subnet", noop, nil, map[string]interface{}{"vpc_id": "vpc-1", "cidr_block": "10.0.1.0/25"}),
+		managed("aws_security_group.network_bastion", "aws_security_group", tfjson.Actions{tfjson.ActionDelete}, map[string]interface{}{"id": "sg-1"}, nil),
+		managed("aws_security_group_rule.app_ssh", "aws_security_group_rule", noop, nil, map[string]interface{}{"security_group_id": "sg-2", "source_security_group_id": "sg-1"}),
+		managed("aws_security_group.app_web", "aws_security_group", noop, nil, map[string]interface{}{
+			"id":      "sg-2",
+			"ingress": []interface{}{map[string]interface{}{"security_groups": []interface{}{"sg-1"}}},
+		}),
+		managed("aws_vpc_security_group_ingress_rule.network_self", "aws_vpc_security_group_ingress_rule", noop, nil, map[string]interface{}{"referenced_security_group_id": "sg-1"}),
+	}}
+	prefixes := map[string]string{"network": "core/network", "app": "apps/web", "legacy": "core/legacy", "old": "core/old"}
+	summaries := map[string]stackChangeSummary{
+		"core/network": {Prefix: "network"},
+		"apps/web":     {Prefix: "app"},
+		"core/legacy":  {Prefix: "legacy"},
+		"core/old":     {Prefix: "old"},
+	}
+
+	var got []string
+	for _, issue := range networkIssues(plan, prefixes, summaries) {
+		got = append(got, issue.Kind+": "+issue.Detail)
+	}
+	want := []string{
+		"cidr-overlap: core/network aws_subnet.a (10.0.1.0/24) overlaps apps/web aws_subnet.a (10.0.1.128/25)",
+		"cidr-overlap: core/network aws_vpc.main (10.0.0.0/16) overlaps core/legacy aws_vpc.main (10.0.128.0/17)",
+		"deleted-group-reference: apps/web aws_security_group.web references security group sg-1, which core/network aws_security_group.bastion deletes",
+		"deleted-group-reference: apps/web aws_security_group_rule.ssh references security group sg-1, which core/network aws_security_group.bastion deletes",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("issues %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,78 @@
+package superplan
+
+import (
+	"context"
+	"sync"
+)
+
+// StateFetcher initialises a stack against its backend and returns its raw
+// state.
+type StateFetcher func(ctx context.Context, stackDir string) (string, error)
+
+// StackError attributes a superplan failure to the stack that caused it.
+type StackError struct {
+	// StackDir is the absolute path of the failed stack.
+	StackDir string
+	Err      error
+}
+
+func (e *StackError) Error() string { return e.Err.Error() }
+
+func (e *StackError) Unwrap() error { return e.Err }
+
+// PullStates fetches the state of every stack with at most parallelism
+// fetches in flight. The per-stack init and state pull are independent, so
+// only what the caller does with the states has to run serially; states are
+// returned in the order of stackDirs to keep the superplan merge
+// deterministic. The first failure
+// cancels the remaining fetches and is returned as a *StackError.
+func PullStates(ctx context.Context, stackDirs []string, parallelism int, fetch StateFetcher) ([]string, error) {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	states := make([]string, len(stackDirs))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+
+	for i, stackDir := range stackDirs {
+		wg.Add(1)
+		go func(i int, stackDir string) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+			if ctx.Err() != nil {
+				return
+			}
+
+			state, err := fetch(ctx, stackDir)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = &StackError{StackDir: stackDir, Err: err}
+					cancel()
+				}
+				return
+			}
+			states[i] = state
+		}(i, stackDir)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return states, nil
+}
@@ -0,0 +1,56 @@
+package superplan
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPullStatesRunsConcurrentlyAndKeepsOrder(t *testing.T) {
+	var inFlight, peak int32
+	fetch := func(ctx context.Context, stackDir string) (string, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		return "state-" + stackDir, nil
+	}
+
+	states, err := PullStates(context.Background(), []string{"a", "b", "c", "d", "e"}, 2, fetch)
+	if err != nil {
+		t.Fatalf("PullStates: %v", err)
+	}
+	want := []string{"state-a", "state-b", "state-c", "state-d", "state-e"}
+	if !reflect.DeepEqual(states, want) {
+		t.Fatalf("states = %v, want %v", states, want)
+	}
+	if peak != 2 {
+		t.Fatalf("expected at most 2 concurrent fetches and some overlap, got peak %d", peak)
+	}
+}
+
+func TestPullStatesReturnsFirstError(t *testing.T) {
+	boom := errors.New("state pull failed for b")
+	fetch := func(ctx context.Context, stackDir string) (string, error) {
+		if stackDir == "b" {
+			return "", boom
+		}
+		return stackDir, nil
+	}
+
+	states, err := PullStates(context.Background(), []string{"a", "b", "c", "d"}, 2, fetch)
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected %v, got %v", boom, err)
+	}
+	if states != nil {
+		t.Fatalf("expected no states on failure, got %v", states)
+	}
+}
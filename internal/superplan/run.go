@@ -8,14 +8,23 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"time"
 	"unicode"
 
 	"terraform-wrapper/internal/awsaccount"
+	"terraform-wrapper/internal/cost"
+	"terraform-wrapper/internal/featureflags"
 	"terraform-wrapper/internal/graph"
+	"terraform-wrapper/internal/iampolicy"
+	"terraform-wrapper/internal/logging"
+	"terraform-wrapper/internal/plugincache"
+	"terraform-wrapper/internal/report"
+	"terraform-wrapper/internal/security"
 	"terraform-wrapper/internal/stacks"
+	"terraform-wrapper/internal/workdir"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
@@ -31,15 +40,74 @@ type Options struct {
 	TerraformPath     string
 	TerraformVersion  string
 	Environment       string
+	Profile           string
+	Workspace         string
+	StateKMSKeyID     string
 	AccountID         string
 	Region            string
 	KeepPlanArtifacts bool
+	SuggestIAMPolicy  bool
+	VerifyStable      bool
+	SecurityFocus     bool
+	DetailedExitCode  bool
+	// Parallelism bounds how many stacks are initialised and have their
+	// state pulled at once.
+	Parallelism int
+	// StateBackend selects the state backend for stacks without their own
+	// backend.tfwrapper.json. Nil means S3.
+	StateBackend *stacks.BackendSettings
+	// AssumeRoleARN pulls state with credentials for this role unless a
+	// stack's dependencies.json names its own.
+	AssumeRoleARN string
+	// TFLog captures terraform's log per stack at this level, trace or
+	// debug, in the run log directory TFLogDir.
+	TFLog    string
+	TFLogDir string
+	// SyncDependencies rewrites dependencies.json files to match the
+	// dependency changes the summary reports.
+	SyncDependencies bool
+	// StateConflicts is the strategy for stacks whose states were written
+	// with different state format or Terraform versions; StateConflictWarn
+	// when empty.
+	StateConflicts string
+	// CostEstimator, when set, prices the planned changes and records each
+	// stack's monthly cost delta in the summary.
+	CostEstimator cost.Estimator
+	// ExtraVarFiles are read after every stack's var files, so their values
+	// take precedence, and are listed in the summary.
+	ExtraVarFiles []string
+	// Guardrails stop plans that destroy too much; a plan violating them
+	// fails with a GuardrailError after its summary is written.
+	Guardrails Guardrails
+	// Stacks restricts the superplan to these stack paths; every stack when
+	// empty. Dependencies through stacks left out still order the rest.
+	Stacks []string
+	// Workdir holds the run's generated files; the merged configuration
+	// and plan get a temporary directory of their own when nil.
+	Workdir *workdir.Workdir
+	// LocalStateDir, when set, reads each stack's state from the files
+	// state export wrote there instead of its backend, and external states
+	// from its external directory, so the superplan is built without AWS
+	// access. The aws providers are configured not to call AWS.
+	LocalStateDir string
+	// TagAttributes overrides, per provider type, the attributes resources
+	// ignore changes to; see DefaultTagAttributes.
+	TagAttributes TagAttributes
+	// Actor and CallerARN identify who ran the plan, for the summary.
+	Actor     string
+	CallerARN string
+
+	// onPlan receives the unified plan before the temporary directory is
+	// removed; Apply uses it to decompose changes back to their stacks.
+	onPlan func(*planResult) error
 }
 
 type stackMetadata struct {
 	AbsolutePath string
 	RelativePath string
 	Prefix       string
+	// NoState is set for a stack that has never been applied.
+	NoState bool
 }
 
 type stackChangeSummary struct {
@@ -52,6 +120,11 @@ type stackChangeSummary struct {
 	Reason          string   `json:"reason,omitempty"`
 	Dependencies    []string `json:"dependencies"`
 	DependentStacks []string `json:"dependent_stacks"`
+	// MonthlyCostDelta is set when costs were estimated.
+	MonthlyCostDelta *float64 `json:"monthly_cost_delta,omitempty"`
+	// NoState marks a stack without existing state, whose resources all
+	// plan as creates.
+	NoState bool `json:"no_state,omitempty"`
 }
 
 type resourceTotals struct {
@@ -69,6 +142,41 @@ type superplanSummary struct {
 	StacksWithChanges int                           `json:"stacks_with_changes"`
 	ResourceTotals    resourceTotals                `json:"resource_totals"`
 	Stacks            map[string]stackChangeSummary `json:"stacks"`
+	SecurityChanges   []securityChange              `json:"security_changes,omitempty"`
+	DependencyChanges []dependencyChange            `json:"dependency_changes,omitempty"`
+	NetworkIssues     []networkIssue                `json:"network_issues,omitempty"`
+	// StateConflicts and StateVersions record how the stacks' states were
+	// merged, for auditing plans built from states of mixed versions.
+	StateConflicts string         `json:"state_conflict_strategy"`
+	StateVersions  []stateVersion `json:"state_versions"`
+	// GuardrailViolations lists the guardrails the plan violates.
+	GuardrailViolations []string     `json:"guardrail_violations,omitempty"`
+	Cost                *costSummary `json:"cost,omitempty"`
+	// ExtraVarFiles records the ad-hoc var files layered over the standard
+	// ones, so runs with non-standard inputs stand out.
+	ExtraVarFiles []string `json:"extra_var_files,omitempty"`
+	// LocalStateDir records that the plan was built from exported state
+	// files rather than the backends.
+	LocalStateDir string `json:"local_state_dir,omitempty"`
+	// Actor and CallerARN record who ran the plan: the CI actor or local
+	// user, and the ARN of their AWS credentials.
+	Actor     string `json:"actor,omitempty"`
+	CallerARN string `json:"caller_arn,omitempty"`
+}
+
+// dependencyChange is the edit to a stack's dependencies.json implied by its
+// terraform_remote_state data sources, with stacks as relative paths.
+type dependencyChange struct {
+	Stack  string   `json:"stack"`
+	Add    []string `json:"add,omitempty"`
+	Remove []string `json:"remove,omitempty"`
+}
+
+// securityChange is a security-relevant change attributed to its stack, with
+// the address in the stack's own address space.
+type securityChange struct {
+	Stack string `json:"stack"`
+	security.Change
 }
 
 const planFileName = "superplan.tfplan"
@@ -86,32 +194,35 @@ func (o *Options) applyDefaults() {
 	if o.Region == "" {
 		o.Region = "eu-west-2"
 	}
+	if o.StateConflicts == "" {
+		o.StateConflicts = StateConflictWarn
+	}
 }
 
 func Run(ctx context.Context, opts Options) error {
 	opts.applyDefaults()
+	if err := ValidateStateConflictStrategy(opts.StateConflicts); err != nil {
+		return err
+	}
 
-	tmpDir, err := os.MkdirTemp("", "terraform-superplan-*")
+	tmpDir, cleanup, err := opts.Workdir.Sub("superplan")
 	if err != nil {
-		return fmt.Errorf("create temporary superplan directory: %w", err)
+		return err
 	}
-	fmt.Printf("Superplan executed in temporary directory: %s\n", tmpDir)
-	defer func() {
-		if err := os.RemoveAll(tmpDir); err != nil {
-			fmt.Fprintf(os.Stderr, "[superplan] warning: failed to remove temporary directory %s: %v\n", tmpDir, err)
-		} else {
-			fmt.Println("Cleaned up successfully after completion")
-		}
-	}()
+	logging.Infof("Superplan executed in temporary directory: %s", tmpDir)
+	defer cleanup()
 
 	if opts.KeepPlanArtifacts {
-		fmt.Println("[superplan] note: keep-plan-artifacts flag is ignored; plan data is always cleaned up")
+		logging.Infof("[superplan] note: keep-plan-artifacts flag is ignored; pass --keep-workspace to keep the plan data")
 	}
 
 	rootAbs, err := filepath.Abs(opts.RootDir)
 	if err != nil {
 		return fmt.Errorf("failed to resolve root directory: %w", err)
 	}
+	if opts.AccountID == "" && opts.LocalStateDir != "" {
+		return fmt.Errorf("an account ID is required to plan from local state")
+	}
 	if opts.AccountID == "" {
 		account, err := awsaccount.CallerAccountID(ctx, opts.Region)
 		if err != nil {
@@ -124,6 +235,16 @@ func Run(ctx context.Context, opts Options) error {
 	if err != nil {
 		return fmt.Errorf("error building dependency graph: %w", err)
 	}
+	// Dependency changes are computed on the whole graph: selecting stacks
+	// adds the dependencies they had through stacks left out.
+	deltas := graph.DependencyDeltas(stackGraph)
+	if len(opts.Stacks) > 0 {
+		stackGraph = stackGraph.Select(opts.Stacks)
+		deltas = slices.DeleteFunc(deltas, func(d graph.DependencyDelta) bool {
+			_, ok := stackGraph[d.Stack]
+			return !ok
+		})
+	}
 
 	stackInfos := make(map[string]*stackMetadata, len(stackGraph))
 	stackInfosByRel := make(map[string]*stackMetadata, len(stackGraph))
@@ -167,19 +288,30 @@ func Run(ctx context.Context, opts Options) error {
 		}
 	}
 
-	fmt.Printf("Discovered %d stacks\n", len(order))
+	logging.Infof("Discovered %d stacks", len(order))
 
 	if opts.TerraformPath == "" {
 		return fmt.Errorf("terraform binary path is required")
 	}
 
-	stackRunner, err := stacks.NewRunner(ctx, stacks.RunnerOptions{
+	runnerOpts := stacks.RunnerOptions{
 		RootDir:       opts.RootDir,
 		Environment:   opts.Environment,
 		AccountID:     opts.AccountID,
 		Region:        opts.Region,
 		TerraformPath: opts.TerraformPath,
-	})
+		Profile:       opts.Profile,
+		Workspace:     opts.Workspace,
+		StateKMSKeyID: opts.StateKMSKeyID,
+		StateBackend:  opts.StateBackend,
+		AssumeRoleARN: opts.AssumeRoleARN,
+		TFLog:         opts.TFLog,
+		TFLogDir:      opts.TFLogDir,
+	}
+	if opts.LocalStateDir != "" {
+		runnerOpts.ExternalStates = &stacks.LocalExternalStates{Dir: LocalExternalDir(opts.LocalStateDir)}
+	}
+	stackRunner, err := stacks.NewRunner(ctx, runnerOpts)
 	if err != nil {
 		return fmt.Errorf("failed to prepare stack runner: %w", err)
 	}
@@ -189,11 +321,10 @@ func Run(ctx context.Context, opts Options) error {
 	providerSources := make(map[string]string)
 	stackPrefixes := make(map[string]string)
 	prefixToStack := make(map[string]string)
-	var baseVersion int
-	var baseTFVersion string
-	var serial int
+	var versions []stateVersion
 	var stacksProcessed int
 
+	displayNames := make(map[string]string, len(order))
 	for idx, stackDir := range order {
 		stackName := sanitizeIdentifier(filepath.Base(stackDir))
 		if stackName == "" {
@@ -210,28 +341,76 @@ func Run(ctx context.Context, opts Options) error {
 		if err != nil {
 			displayName = stackDir
 		}
+		displayNames[stackDir] = displayName
+	}
 
+	states, err := PullStates(ctx, order, opts.Parallelism, func(ctx context.Context, stackDir string) (string, error) {
+		displayName := displayNames[stackDir]
+		if opts.LocalStateDir != "" {
+			stateJSON, err := readLocalState(opts.LocalStateDir, filepath.ToSlash(displayName))
+			if err != nil {
+				return "", err
+			}
+			logging.Stack(displayName).Infof("[✓] Read local state for stack: %s", displayName)
+			return stateJSON, nil
+		}
 		tf, err := tfexec.NewTerraform(stackDir, opts.TerraformPath)
 		if err != nil {
-			return fmt.Errorf("error creating terraform executor for %s: %w", displayName, err)
+			return "", fmt.Errorf("error creating terraform executor for %s: %w", displayName, err)
+		}
+		env, err := stackRunner.Env(ctx, stackDir)
+		if err != nil {
+			return "", fmt.Errorf("credentials for %s: %w", displayName, err)
+		}
+		if env != nil {
+			if err := tf.SetEnv(env); err != nil {
+				return "", fmt.Errorf("credentials for %s: %w", displayName, err)
+			}
 		}
 
-		backendConfig := stackRunner.BackendConfig(stackDir)
-
-		var initOpts []tfexec.InitOption
-		for k, v := range backendConfig {
-			initOpts = append(initOpts, tfexec.BackendConfig(fmt.Sprintf("%s=%s", k, v)))
+		initOpts, err := stackRunner.BackendInitOptions(stackDir)
+		if err != nil {
+			return "", fmt.Errorf("backend configuration for %s: %w", displayName, err)
 		}
 
-		if err := tf.Init(ctx, initOpts...); err != nil {
-			return fmt.Errorf("terraform init failed for %s: %w", displayName, err)
+		release, err := plugincache.Lock(ctx)
+		if err != nil {
+			return "", err
+		}
+		err = tf.Init(ctx, initOpts...)
+		release()
+		if err != nil {
+			return "", fmt.Errorf("terraform init failed for %s: %w", displayName, err)
+		}
+		if err := stackRunner.SelectWorkspace(ctx, tf, stackDir); err != nil {
+			return "", fmt.Errorf("workspace for %s: %w", displayName, err)
 		}
 
 		stateJSON, err := tf.StatePull(ctx)
 		if err != nil {
-			return fmt.Errorf("terraform state pull failed for %s: %w", displayName, err)
+			return "", fmt.Errorf("terraform state pull failed for %s: %w", displayName, err)
+		}
+		logging.Stack(displayName).Infof("[✓] Downloaded state for stack: %s", displayName)
+		return stateJSON, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for idx, stackDir := range order {
+		stackName := stackPrefixes[stackDir]
+		displayName := displayNames[stackDir]
+		stateJSON := states[idx]
+
+		// A stack that has never been applied has no state: its
+		// configuration is still merged, so its resources plan as creates.
+		if strings.TrimSpace(stateJSON) == "" {
+			if info := stackInfos[stackDir]; info != nil {
+				info.NoState = true
+			}
+			logging.Stack(displayName).Infof("[i] No existing state for stack: %s; its resources will plan as creates", displayName)
+			continue
 		}
-		fmt.Printf("[✓] Downloaded state for stack: %s\n", displayName)
 
 		stateMap := make(map[string]interface{})
 		if err := json.Unmarshal([]byte(stateJSON), &stateMap); err != nil {
@@ -245,9 +424,9 @@ func Run(ctx context.Context, opts Options) error {
 
 		outCount := prefixOutputs(stateMap, stackName)
 
-		fmt.Printf("[✓] Prefixed %d resources with '%s_'\n", resCount, stackName)
+		logging.Stack(displayName).Infof("[✓] Prefixed %d resources with '%s_'", resCount, stackName)
 		if outCount > 0 {
-			fmt.Printf("[✓] Prefixed %d outputs with '%s_'\n", outCount, stackName)
+			logging.Stack(displayName).Infof("[✓] Prefixed %d outputs with '%s_'", outCount, stackName)
 		}
 
 		collectProviders(stateMap, providerSources)
@@ -258,29 +437,30 @@ func Run(ctx context.Context, opts Options) error {
 			return fmt.Errorf("failed to merge state for %s: %w", displayName, err)
 		}
 
-		if stacksProcessed == 0 {
-			baseVersion = extractInt(stateMap, "version")
-			baseTFVersion = extractString(stateMap, "terraform_version")
-			serial = extractInt(stateMap, "serial")
-		} else {
-			localVersion := extractInt(stateMap, "version")
-			localTFVersion := extractString(stateMap, "terraform_version")
-			if localVersion != baseVersion {
-				fmt.Printf("[!] Warning: %s state version %d differs from base %d\n", displayName, localVersion, baseVersion)
-				if localVersion > baseVersion {
-					baseVersion = localVersion
-				}
-			}
-			if localTFVersion != "" && baseTFVersion != "" && localTFVersion != baseTFVersion {
-				fmt.Printf("[!] Warning: %s Terraform version %s differs from base %s\n", displayName, localTFVersion, baseTFVersion)
-			}
-			if localSerial := extractInt(stateMap, "serial"); localSerial > serial {
-				serial = localSerial
-			}
-		}
+		versions = append(versions, stateVersion{
+			Stack:            filepath.ToSlash(displayName),
+			Version:          extractInt(stateMap, "version"),
+			TerraformVersion: extractString(stateMap, "terraform_version"),
+			Serial:           extractInt(stateMap, "serial"),
+		})
 		stacksProcessed++
 	}
 
+	header, warnings, err := resolveStateVersions(versions, opts.StateConflicts)
+	if err != nil {
+		return err
+	}
+	for _, warning := range warnings {
+		logging.Warnf("[!] Warning: %s", warning)
+	}
+	if header.Version == 0 {
+		// Every stack is new, so no state sets the format.
+		header.Version = 4
+	}
+	if header.TerraformVersion == "" {
+		header.TerraformVersion = opts.TerraformVersion
+	}
+	serial := header.Serial
 	if serial == 0 {
 		serial = int(time.Now().Unix())
 	}
@@ -288,8 +468,8 @@ func Run(ctx context.Context, opts Options) error {
 	lineage := fmt.Sprintf("superplan-%d", time.Now().UnixNano())
 
 	stateDocument := map[string]interface{}{
-		"version":           baseVersion,
-		"terraform_version": baseTFVersion,
+		"version":           header.Version,
+		"terraform_version": header.TerraformVersion,
 		"serial":            serial,
 		"lineage":           lineage,
 		"outputs":           mergedOutputs,
@@ -300,23 +480,39 @@ func Run(ctx context.Context, opts Options) error {
 	if err := writeJSON(statePath, stateDocument); err != nil {
 		return fmt.Errorf("failed to write combined state: %w", err)
 	}
-	fmt.Printf("[✓] Merged %d stack states into %s\n", stacksProcessed, statePath)
+	logging.Infof("[✓] Merged %d stack states into %s", stacksProcessed, statePath)
 
 	configProviderRequirements, err := writeCombinedConfiguration(order, stackPrefixes, rootAbs, tmpDir)
 	if err != nil {
 		return fmt.Errorf("failed to build combined configuration: %w", err)
 	}
+	if opts.LocalStateDir != "" {
+		if err := configureOfflineProviders(filepath.Join(tmpDir, "super.tf"), opts.Region, configProviderRequirements); err != nil {
+			return fmt.Errorf("failed to configure providers for local state: %w", err)
+		}
+		logging.Infof("[✓] Configured aws providers not to call AWS")
+	}
 
-	variableValues, sourcesUsed, err := collectVariableValues(rootAbs, opts.Environment, order)
+	variableValues, sourcesUsed, err := collectVariableValues(rootAbs, opts.Environment, opts.Profile, order, opts.ExtraVarFiles)
 	if err != nil {
 		return fmt.Errorf("failed to collect variable values: %w", err)
 	}
+	if err := addExternalValues(ctx, stackRunner, order, displayNames, variableValues); err != nil {
+		return err
+	}
+	if flags := stackRunner.FeatureFlags(); flags != nil {
+		tokens, err := tokensForExpression(flags.Value())
+		if err != nil {
+			return fmt.Errorf("feature flags: %w", err)
+		}
+		mergeVariableTokens(variableValues, map[string]hclwrite.Tokens{featureflags.Variable: tokens}, "flags/"+opts.Environment+".yaml")
+	}
 
 	varFilePath := filepath.Join(tmpDir, "variables.auto.tfvars")
 	if err := writeTFVarsFile(varFilePath, variableValues); err != nil {
 		return fmt.Errorf("failed to write variables file: %w", err)
 	}
-	fmt.Printf("[✓] Wrote %d variable values from %d sources to %s\n", len(variableValues), sourcesUsed, varFilePath)
+	logging.Infof("[✓] Wrote %d variable values from %d sources to %s", len(variableValues), sourcesUsed, varFilePath)
 
 	if err := ensureLocalBackend(tmpDir, providerSources, configProviderRequirements); err != nil {
 		return fmt.Errorf("failed to prepare superplan configuration: %w", err)
@@ -330,10 +526,14 @@ func Run(ctx context.Context, opts Options) error {
 	if err := superplanTF.Init(ctx); err != nil {
 		return fmt.Errorf("terraform init failed in superplan directory: %w", err)
 	}
-	fmt.Printf("[✓] Initialized local backend in %s\n", tmpDir)
+	logging.Infof("[✓] Initialized local backend in %s", tmpDir)
 
-	if err := patchModuleResourceLifecycle(tmpDir); err != nil {
-		return fmt.Errorf("failed to apply lifecycle ignore to modules: %w", err)
+	taggable, err := loadTaggableTypes(ctx, superplanTF, tmpDir, schemaCacheDir(rootAbs), tagAttributes(opts.TagAttributes))
+	if err != nil {
+		return fmt.Errorf("failed to discover taggable resource types: %w", err)
+	}
+	if err := patchResourceLifecycle(tmpDir, taggable); err != nil {
+		return fmt.Errorf("failed to apply lifecycle ignore to resources: %w", err)
 	}
 
 	planPath := filepath.Join(tmpDir, planFileName)
@@ -345,9 +545,9 @@ func Run(ctx context.Context, opts Options) error {
 		return fmt.Errorf("terraform plan failed: %w", err)
 	}
 
-	fmt.Printf("[✓] Generated unified plan (%s)\n", planFileName)
+	logging.Infof("[✓] Generated unified plan (%s)", planFileName)
 	if !planHasChanges {
-		fmt.Println("[i] Terraform reported no changes; summary will reflect zero-diff plan")
+		logging.Infof("[i] Terraform reported no changes; summary will reflect zero-diff plan")
 	}
 
 	plan, err := superplanTF.ShowPlanFile(ctx, planPath)
@@ -355,9 +555,17 @@ func Run(ctx context.Context, opts Options) error {
 		return fmt.Errorf("terraform show plan failed: %w", err)
 	}
 
+	var instability []planDifference
+	if opts.VerifyStable {
+		instability, err = verifyStablePlan(ctx, superplanTF, tmpDir, plan, prefixToStack)
+		if err != nil {
+			return err
+		}
+	}
+
 	planText, err := superplanTF.ShowPlanFileRaw(ctx, planPath)
 	if err == nil && strings.TrimSpace(planText) != "" {
-		fmt.Println(planText)
+		logging.Infof("%s", planText)
 	}
 
 	generatedAt := time.Now().UTC()
@@ -372,6 +580,34 @@ func Run(ctx context.Context, opts Options) error {
 		GeneratedAt:       generatedAt,
 	})
 
+	if opts.SecurityFocus {
+		summary.SecurityChanges = securityChanges(plan, prefixToStack, summary.Stacks)
+		printSecurityChanges(summary.SecurityChanges)
+	}
+
+	summary.StateConflicts = opts.StateConflicts
+	summary.ExtraVarFiles = opts.ExtraVarFiles
+	summary.LocalStateDir = opts.LocalStateDir
+	summary.Actor = opts.Actor
+	summary.CallerARN = opts.CallerARN
+	summary.StateVersions = sortedStateVersions(versions)
+
+	summary.DependencyChanges = dependencyChanges(deltas, stackInfos)
+	printDependencyChanges(summary.DependencyChanges, opts.SyncDependencies)
+
+	summary.NetworkIssues = networkIssues(plan, prefixToStack, summary.Stacks)
+	printNetworkIssues(summary.NetworkIssues)
+
+	if opts.CostEstimator != nil {
+		if err := estimateCosts(ctx, opts.CostEstimator, tmpDir, plan, prefixToStack, &summary); err != nil {
+			logging.Warnf("[cost] warning: cost estimation failed: %v", err)
+		}
+		printCosts(summary)
+	}
+
+	summary.GuardrailViolations = checkGuardrails(plan, opts.Guardrails, summary.ResourceTotals.Destroys, prefixToStack)
+	printGuardrailViolations(summary.GuardrailViolations)
+
 	summaryBase, err := filepath.Abs(opts.OutputDir)
 	if err != nil {
 		return fmt.Errorf("resolve summary output directory: %w", err)
@@ -386,6 +622,43 @@ func Run(ctx context.Context, opts Options) error {
 		return fmt.Errorf("write superplan summary: %w", err)
 	}
 
+	htmlPath := filepath.Join(summaryDir, fmt.Sprintf("%s-superplan-summary.html", generatedAt.Format("2006-01-02T15-04Z")))
+	if err := report.WriteHTML(htmlPath, buildHTMLReport(summary, plan, prefixToStack)); err != nil {
+		return fmt.Errorf("write superplan HTML report: %w", err)
+	}
+
+	if opts.SyncDependencies && len(deltas) > 0 {
+		if err := graph.SyncDependencies(rootAbs, deltas); err != nil {
+			return fmt.Errorf("sync dependencies.json: %w", err)
+		}
+		logging.Infof("[deps] updated dependencies.json of %d stacks", len(deltas))
+	}
+
+	if opts.SuggestIAMPolicy {
+		if err := writeIAMPolicySuggestion(summaryDir, generatedAt, plan); err != nil {
+			return err
+		}
+	}
+
+	if len(instability) > 0 {
+		return reportInstability(summaryDir, generatedAt, instability)
+	}
+	if len(summary.GuardrailViolations) > 0 {
+		return &GuardrailError{Violations: summary.GuardrailViolations}
+	}
+
+	if opts.onPlan != nil {
+		if err := opts.onPlan(&planResult{
+			Plan:          plan,
+			Graph:         stackGraph,
+			Order:         order,
+			RootAbs:       rootAbs,
+			PrefixToStack: prefixToStack,
+		}); err != nil {
+			return err
+		}
+	}
+
 	warnIfPlanNotIgnored()
 
 	summaryDisplay := summaryPath
@@ -394,9 +667,37 @@ func Run(ctx context.Context, opts Options) error {
 			summaryDisplay = rel
 		}
 	}
-	fmt.Printf("Summary written to: %s\n", summaryDisplay)
-	fmt.Printf("[✓] Superplan complete: %d stacks analyzed, %d with changes\n", summary.TotalStacks, summary.StacksWithChanges)
+	logging.Infof("Summary written to: %s", summaryDisplay)
+	logging.Infof("HTML report written to: %s", filepath.Join(filepath.Dir(summaryDisplay), filepath.Base(htmlPath)))
+	logging.Infof("[✓] Superplan complete: %d stacks analyzed, %d with changes", summary.TotalStacks, summary.StacksWithChanges)
 
+	if opts.DetailedExitCode && summary.StacksWithChanges > 0 {
+		return &ChangesPresentError{Stacks: changedStacks(summary.Stacks)}
+	}
+	return nil
+}
+
+func changedStacks(stacks map[string]stackChangeSummary) []string {
+	var changed []string
+	for rel, s := range stacks {
+		if s.HasChanges {
+			changed = append(changed, rel)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func writeIAMPolicySuggestion(summaryDir string, generatedAt time.Time, plan *tfjson.Plan) error {
+	suggestion := iampolicy.Suggest(plan)
+	policyPath := filepath.Join(summaryDir, fmt.Sprintf("%s-iam-policy.json", generatedAt.Format("2006-01-02T15-04Z")))
+	if err := writeJSON(policyPath, suggestion.Policy); err != nil {
+		return fmt.Errorf("write IAM policy suggestion: %w", err)
+	}
+	logging.Infof("Suggested IAM policy written to: %s", policyPath)
+	if len(suggestion.Unmapped) > 0 {
+		logging.Warnf("[!] No IAM mapping for resource types: %s", strings.Join(suggestion.Unmapped, ", "))
+	}
 	return nil
 }
 
@@ -558,6 +859,12 @@ func rewriteModuleAddress(stackName, address string) string {
 	return strings.Join(parts, ".")
 }
 
+// OutputName returns the name the superplan gives the output name of the
+// stack at stackDir.
+func OutputName(stackDir, name string) string {
+	return prefixSegment(sanitizeIdentifier(filepath.Base(stackDir)), name)
+}
+
 func prefixSegment(prefix, segment string) string {
 	if prefix == "" {
 		return segment
@@ -668,7 +975,7 @@ func collectProviders(state map[string]interface{}, providers map[string]string)
 				continue
 			}
 			if existing, exists := providers[name]; exists && existing != source {
-				fmt.Printf("[!] Warning: provider name %q seen with multiple sources (%s vs %s)\n", name, existing, source)
+				logging.Warnf("[!] Warning: provider name %q seen with multiple sources (%s vs %s)", name, existing, source)
 				continue
 			}
 			providers[name] = source
@@ -879,798 +1186,6 @@ type providerRequirement struct {
 
 type providerRequirements map[string]*providerRequirement
 
-// Update this by using terraform providers schema -json and then extracting all of the resources without tags attribute
-var tagLifecycleSkipTypes = map[string]struct{}{
-	"aws_accessanalyzer_archive_rule":                                  {},
-	"aws_account_alternate_contact":                                    {},
-	"aws_account_primary_contact":                                      {},
-	"aws_account_region":                                               {},
-	"aws_acm_certificate_validation":                                   {},
-	"aws_acmpca_certificate":                                           {},
-	"aws_acmpca_certificate_authority_certificate":                     {},
-	"aws_acmpca_permission":                                            {},
-	"aws_acmpca_policy":                                                {},
-	"aws_alb_listener_certificate":                                     {},
-	"aws_alb_target_group_attachment":                                  {},
-	"aws_ami_launch_permission":                                        {},
-	"aws_amplify_backend_environment":                                  {},
-	"aws_amplify_domain_association":                                   {},
-	"aws_amplify_webhook":                                              {},
-	"aws_api_gateway_account":                                          {},
-	"aws_api_gateway_authorizer":                                       {},
-	"aws_api_gateway_base_path_mapping":                                {},
-	"aws_api_gateway_deployment":                                       {},
-	"aws_api_gateway_documentation_part":                               {},
-	"aws_api_gateway_documentation_version":                            {},
-	"aws_api_gateway_gateway_response":                                 {},
-	"aws_api_gateway_integration":                                      {},
-	"aws_api_gateway_integration_response":                             {},
-	"aws_api_gateway_method":                                           {},
-	"aws_api_gateway_method_response":                                  {},
-	"aws_api_gateway_method_settings":                                  {},
-	"aws_api_gateway_model":                                            {},
-	"aws_api_gateway_request_validator":                                {},
-	"aws_api_gateway_resource":                                         {},
-	"aws_api_gateway_rest_api_policy":                                  {},
-	"aws_api_gateway_rest_api_put":                                     {},
-	"aws_api_gateway_usage_plan_key":                                   {},
-	"aws_apigatewayv2_api_mapping":                                     {},
-	"aws_apigatewayv2_authorizer":                                      {},
-	"aws_apigatewayv2_deployment":                                      {},
-	"aws_apigatewayv2_integration":                                     {},
-	"aws_apigatewayv2_integration_response":                            {},
-	"aws_apigatewayv2_model":                                           {},
-	"aws_apigatewayv2_route":                                           {},
-	"aws_apigatewayv2_route_response":                                  {},
-	"aws_app_cookie_stickiness_policy":                                 {},
-	"aws_appautoscaling_policy":                                        {},
-	"aws_appautoscaling_scheduled_action":                              {},
-	"aws_appconfig_extension_association":                              {},
-	"aws_appconfig_hosted_configuration_version":                       {},
-	"aws_appfabric_app_authorization_connection":                       {},
-	"aws_appflow_connector_profile":                                    {},
-	"aws_apprunner_custom_domain_association":                          {},
-	"aws_apprunner_default_auto_scaling_configuration_version":         {},
-	"aws_apprunner_deployment":                                         {},
-	"aws_appstream_directory_config":                                   {},
-	"aws_appstream_fleet_stack_association":                            {},
-	"aws_appstream_user":                                               {},
-	"aws_appstream_user_stack_association":                             {},
-	"aws_appsync_api_cache":                                            {},
-	"aws_appsync_api_key":                                              {},
-	"aws_appsync_datasource":                                           {},
-	"aws_appsync_domain_name":                                          {},
-	"aws_appsync_domain_name_api_association":                          {},
-	"aws_appsync_function":                                             {},
-	"aws_appsync_resolver":                                             {},
-	"aws_appsync_source_api_association":                               {},
-	"aws_appsync_type":                                                 {},
-	"aws_athena_database":                                              {},
-	"aws_athena_named_query":                                           {},
-	"aws_athena_prepared_statement":                                    {},
-	"aws_auditmanager_account_registration":                            {},
-	"aws_auditmanager_assessment_delegation":                           {},
-	"aws_auditmanager_assessment_report":                               {},
-	"aws_auditmanager_framework_share":                                 {},
-	"aws_auditmanager_organization_admin_account_registration":         {},
-	"aws_autoscaling_attachment":                                       {},
-	"aws_autoscaling_group":                                            {},
-	"aws_autoscaling_group_tag":                                        {},
-	"aws_autoscaling_lifecycle_hook":                                   {},
-	"aws_autoscaling_notification":                                     {},
-	"aws_autoscaling_policy":                                           {},
-	"aws_autoscaling_schedule":                                         {},
-	"aws_autoscaling_traffic_source_attachment":                        {},
-	"aws_autoscalingplans_scaling_plan":                                {},
-	"aws_backup_global_settings":                                       {},
-	"aws_backup_region_settings":                                       {},
-	"aws_backup_restore_testing_selection":                             {},
-	"aws_backup_selection":                                             {},
-	"aws_backup_vault_lock_configuration":                              {},
-	"aws_backup_vault_notifications":                                   {},
-	"aws_backup_vault_policy":                                          {},
-	"aws_bedrock_guardrail_version":                                    {},
-	"aws_bedrock_model_invocation_logging_configuration":               {},
-	"aws_bedrockagent_agent_action_group":                              {},
-	"aws_bedrockagent_agent_collaborator":                              {},
-	"aws_bedrockagent_agent_knowledge_base_association":                {},
-	"aws_bedrockagent_data_source":                                     {},
-	"aws_ce_cost_allocation_tag":                                       {},
-	"aws_chime_voice_connector_group":                                  {},
-	"aws_chime_voice_connector_logging":                                {},
-	"aws_chime_voice_connector_origination":                            {},
-	"aws_chime_voice_connector_streaming":                              {},
-	"aws_chime_voice_connector_termination":                            {},
-	"aws_chime_voice_connector_termination_credentials":                {},
-	"aws_chimesdkvoice_global_settings":                                {},
-	"aws_chimesdkvoice_sip_rule":                                       {},
-	"aws_cloud9_environment_membership":                                {},
-	"aws_cloudcontrolapi_resource":                                     {},
-	"aws_cloudformation_stack_instances":                               {},
-	"aws_cloudformation_stack_set_instance":                            {},
-	"aws_cloudformation_type":                                          {},
-	"aws_cloudfront_cache_policy":                                      {},
-	"aws_cloudfront_continuous_deployment_policy":                      {},
-	"aws_cloudfront_field_level_encryption_config":                     {},
-	"aws_cloudfront_field_level_encryption_profile":                    {},
-	"aws_cloudfront_function":                                          {},
-	"aws_cloudfront_key_group":                                         {},
-	"aws_cloudfront_key_value_store":                                   {},
-	"aws_cloudfront_monitoring_subscription":                           {},
-	"aws_cloudfront_origin_access_control":                             {},
-	"aws_cloudfront_origin_access_identity":                            {},
-	"aws_cloudfront_origin_request_policy":                             {},
-	"aws_cloudfront_public_key":                                        {},
-	"aws_cloudfront_realtime_log_config":                               {},
-	"aws_cloudfront_response_headers_policy":                           {},
-	"aws_cloudfrontkeyvaluestore_key":                                  {},
-	"aws_cloudfrontkeyvaluestore_keys_exclusive":                       {},
-	"aws_cloudhsm_v2_hsm":                                              {},
-	"aws_cloudsearch_domain":                                           {},
-	"aws_cloudsearch_domain_service_access_policy":                     {},
-	"aws_cloudtrail_organization_delegated_admin_account":              {},
-	"aws_cloudwatch_dashboard":                                         {},
-	"aws_cloudwatch_event_api_destination":                             {},
-	"aws_cloudwatch_event_archive":                                     {},
-	"aws_cloudwatch_event_bus_policy":                                  {},
-	"aws_cloudwatch_event_connection":                                  {},
-	"aws_cloudwatch_event_endpoint":                                    {},
-	"aws_cloudwatch_event_permission":                                  {},
-	"aws_cloudwatch_event_target":                                      {},
-	"aws_cloudwatch_log_account_policy":                                {},
-	"aws_cloudwatch_log_data_protection_policy":                        {},
-	"aws_cloudwatch_log_delivery_destination_policy":                   {},
-	"aws_cloudwatch_log_destination_policy":                            {},
-	"aws_cloudwatch_log_index_policy":                                  {},
-	"aws_cloudwatch_log_metric_filter":                                 {},
-	"aws_cloudwatch_log_resource_policy":                               {},
-	"aws_cloudwatch_log_stream":                                        {},
-	"aws_cloudwatch_log_subscription_filter":                           {},
-	"aws_cloudwatch_query_definition":                                  {},
-	"aws_codeartifact_domain_permissions_policy":                       {},
-	"aws_codeartifact_repository_permissions_policy":                   {},
-	"aws_codebuild_resource_policy":                                    {},
-	"aws_codebuild_source_credential":                                  {},
-	"aws_codebuild_webhook":                                            {},
-	"aws_codecatalyst_dev_environment":                                 {},
-	"aws_codecatalyst_project":                                         {},
-	"aws_codecatalyst_source_repository":                               {},
-	"aws_codecommit_approval_rule_template":                            {},
-	"aws_codecommit_approval_rule_template_association":                {},
-	"aws_codecommit_trigger":                                           {},
-	"aws_codedeploy_deployment_config":                                 {},
-	"aws_codestarconnections_host":                                     {},
-	"aws_cognito_identity_pool_provider_principal_tag":                 {},
-	"aws_cognito_identity_pool_roles_attachment":                       {},
-	"aws_cognito_identity_provider":                                    {},
-	"aws_cognito_log_delivery_configuration":                           {},
-	"aws_cognito_managed_login_branding":                               {},
-	"aws_cognito_managed_user_pool_client":                             {},
-	"aws_cognito_resource_server":                                      {},
-	"aws_cognito_risk_configuration":                                   {},
-	"aws_cognito_user":                                                 {},
-	"aws_cognito_user_group":                                           {},
-	"aws_cognito_user_in_group":                                        {},
-	"aws_cognito_user_pool_client":                                     {},
-	"aws_cognito_user_pool_domain":                                     {},
-	"aws_cognito_user_pool_ui_customization":                           {},
-	"aws_computeoptimizer_enrollment_status":                           {},
-	"aws_computeoptimizer_recommendation_preferences":                  {},
-	"aws_config_configuration_recorder":                                {},
-	"aws_config_configuration_recorder_status":                         {},
-	"aws_config_conformance_pack":                                      {},
-	"aws_config_delivery_channel":                                      {},
-	"aws_config_organization_conformance_pack":                         {},
-	"aws_config_organization_custom_policy_rule":                       {},
-	"aws_config_organization_custom_rule":                              {},
-	"aws_config_organization_managed_rule":                             {},
-	"aws_config_remediation_configuration":                             {},
-	"aws_config_retention_configuration":                               {},
-	"aws_connect_bot_association":                                      {},
-	"aws_connect_instance_storage_config":                              {},
-	"aws_connect_lambda_function_association":                          {},
-	"aws_connect_phone_number_contact_flow_association":                {},
-	"aws_connect_user_hierarchy_structure":                             {},
-	"aws_controltower_control":                                         {},
-	"aws_costoptimizationhub_enrollment_status":                        {},
-	"aws_costoptimizationhub_preferences":                              {},
-	"aws_customerprofiles_profile":                                     {},
-	"aws_dataexchange_event_action":                                    {},
-	"aws_datapipeline_pipeline_definition":                             {},
-	"aws_datazone_asset_type":                                          {},
-	"aws_datazone_environment":                                         {},
-	"aws_datazone_environment_blueprint_configuration":                 {},
-	"aws_datazone_environment_profile":                                 {},
-	"aws_datazone_form_type":                                           {},
-	"aws_datazone_glossary":                                            {},
-	"aws_datazone_glossary_term":                                       {},
-	"aws_datazone_project":                                             {},
-	"aws_datazone_user_profile":                                        {},
-	"aws_dax_parameter_group":                                          {},
-	"aws_dax_subnet_group":                                             {},
-	"aws_db_instance_automated_backups_replication":                    {},
-	"aws_db_instance_role_association":                                 {},
-	"aws_db_proxy_default_target_group":                                {},
-	"aws_db_proxy_target":                                              {},
-	"aws_detective_invitation_accepter":                                {},
-	"aws_detective_member":                                             {},
-	"aws_detective_organization_admin_account":                         {},
-	"aws_detective_organization_configuration":                         {},
-	"aws_devicefarm_upload":                                            {},
-	"aws_devopsguru_event_sources_config":                              {},
-	"aws_devopsguru_notification_channel":                              {},
-	"aws_devopsguru_resource_collection":                               {},
-	"aws_devopsguru_service_integration":                               {},
-	"aws_directory_service_conditional_forwarder":                      {},
-	"aws_directory_service_log_subscription":                           {},
-	"aws_directory_service_radius_settings":                            {},
-	"aws_directory_service_shared_directory":                           {},
-	"aws_directory_service_shared_directory_accepter":                  {},
-	"aws_directory_service_trust":                                      {},
-	"aws_docdb_cluster_snapshot":                                       {},
-	"aws_docdb_global_cluster":                                         {},
-	"aws_dsql_cluster_peering":                                         {},
-	"aws_dx_bgp_peer":                                                  {},
-	"aws_dx_connection_association":                                    {},
-	"aws_dx_connection_confirmation":                                   {},
-	"aws_dx_gateway":                                                   {},
-	"aws_dx_gateway_association":                                       {},
-	"aws_dx_gateway_association_proposal":                              {},
-	"aws_dx_hosted_connection":                                         {},
-	"aws_dx_hosted_private_virtual_interface":                          {},
-	"aws_dx_hosted_public_virtual_interface":                           {},
-	"aws_dx_hosted_transit_virtual_interface":                          {},
-	"aws_dx_macsec_key_association":                                    {},
-	"aws_dynamodb_contributor_insights":                                {},
-	"aws_dynamodb_global_table":                                        {},
-	"aws_dynamodb_kinesis_streaming_destination":                       {},
-	"aws_dynamodb_resource_policy":                                     {},
-	"aws_dynamodb_table_export":                                        {},
-	"aws_dynamodb_table_item":                                          {},
-	"aws_dynamodb_tag":                                                 {},
-	"aws_ebs_default_kms_key":                                          {},
-	"aws_ebs_encryption_by_default":                                    {},
-	"aws_ebs_fast_snapshot_restore":                                    {},
-	"aws_ebs_snapshot_block_public_access":                             {},
-	"aws_ec2_availability_zone_group":                                  {},
-	"aws_ec2_client_vpn_authorization_rule":                            {},
-	"aws_ec2_client_vpn_network_association":                           {},
-	"aws_ec2_client_vpn_route":                                         {},
-	"aws_ec2_default_credit_specification":                             {},
-	"aws_ec2_image_block_public_access":                                {},
-	"aws_ec2_instance_metadata_defaults":                               {},
-	"aws_ec2_instance_state":                                           {},
-	"aws_ec2_local_gateway_route":                                      {},
-	"aws_ec2_managed_prefix_list_entry":                                {},
-	"aws_ec2_serial_console_access":                                    {},
-	"aws_ec2_subnet_cidr_reservation":                                  {},
-	"aws_ec2_tag":                                                      {},
-	"aws_ec2_traffic_mirror_filter_rule":                               {},
-	"aws_ec2_transit_gateway_default_route_table_association":          {},
-	"aws_ec2_transit_gateway_default_route_table_propagation":          {},
-	"aws_ec2_transit_gateway_multicast_domain_association":             {},
-	"aws_ec2_transit_gateway_multicast_group_member":                   {},
-	"aws_ec2_transit_gateway_multicast_group_source":                   {},
-	"aws_ec2_transit_gateway_policy_table_association":                 {},
-	"aws_ec2_transit_gateway_prefix_list_reference":                    {},
-	"aws_ec2_transit_gateway_route":                                    {},
-	"aws_ec2_transit_gateway_route_table_association":                  {},
-	"aws_ec2_transit_gateway_route_table_propagation":                  {},
-	"aws_ecr_account_setting":                                          {},
-	"aws_ecr_lifecycle_policy":                                         {},
-	"aws_ecr_pull_through_cache_rule":                                  {},
-	"aws_ecr_registry_policy":                                          {},
-	"aws_ecr_registry_scanning_configuration":                          {},
-	"aws_ecr_replication_configuration":                                {},
-	"aws_ecr_repository_creation_template":                             {},
-	"aws_ecr_repository_policy":                                        {},
-	"aws_ecrpublic_repository_policy":                                  {},
-	"aws_ecs_account_setting_default":                                  {},
-	"aws_ecs_cluster_capacity_providers":                               {},
-	"aws_ecs_tag":                                                      {},
-	"aws_efs_backup_policy":                                            {},
-	"aws_efs_file_system_policy":                                       {},
-	"aws_efs_mount_target":                                             {},
-	"aws_efs_replication_configuration":                                {},
-	"aws_eip_association":                                              {},
-	"aws_eip_domain_name":                                              {},
-	"aws_eks_access_policy_association":                                {},
-	"aws_elastic_beanstalk_configuration_template":                     {},
-	"aws_elasticache_global_replication_group":                         {},
-	"aws_elasticache_user_group_association":                           {},
-	"aws_elasticsearch_domain_policy":                                  {},
-	"aws_elasticsearch_domain_saml_options":                            {},
-	"aws_elasticsearch_vpc_endpoint":                                   {},
-	"aws_elastictranscoder_pipeline":                                   {},
-	"aws_elastictranscoder_preset":                                     {},
-	"aws_elb_attachment":                                               {},
-	"aws_emr_block_public_access_configuration":                        {},
-	"aws_emr_instance_fleet":                                           {},
-	"aws_emr_instance_group":                                           {},
-	"aws_emr_managed_scaling_policy":                                   {},
-	"aws_emr_security_configuration":                                   {},
-	"aws_emr_studio_session_mapping":                                   {},
-	"aws_fms_admin_account":                                            {},
-	"aws_fsx_s3_access_point_attachment":                               {},
-	"aws_glacier_vault_lock":                                           {},
-	"aws_globalaccelerator_custom_routing_endpoint_group":              {},
-	"aws_globalaccelerator_custom_routing_listener":                    {},
-	"aws_globalaccelerator_endpoint_group":                             {},
-	"aws_globalaccelerator_listener":                                   {},
-	"aws_glue_catalog_table":                                           {},
-	"aws_glue_catalog_table_optimizer":                                 {},
-	"aws_glue_classifier":                                              {},
-	"aws_glue_data_catalog_encryption_settings":                        {},
-	"aws_glue_partition":                                               {},
-	"aws_glue_partition_index":                                         {},
-	"aws_glue_resource_policy":                                         {},
-	"aws_glue_security_configuration":                                  {},
-	"aws_glue_user_defined_function":                                   {},
-	"aws_grafana_license_association":                                  {},
-	"aws_grafana_role_association":                                     {},
-	"aws_grafana_workspace_api_key":                                    {},
-	"aws_grafana_workspace_saml_configuration":                         {},
-	"aws_grafana_workspace_service_account":                            {},
-	"aws_grafana_workspace_service_account_token":                      {},
-	"aws_guardduty_detector_feature":                                   {},
-	"aws_guardduty_invite_accepter":                                    {},
-	"aws_guardduty_member":                                             {},
-	"aws_guardduty_member_detector_feature":                            {},
-	"aws_guardduty_organization_admin_account":                         {},
-	"aws_guardduty_organization_configuration":                         {},
-	"aws_guardduty_organization_configuration_feature":                 {},
-	"aws_guardduty_publishing_destination":                             {},
-	"aws_iam_access_key":                                               {},
-	"aws_iam_account_alias":                                            {},
-	"aws_iam_account_password_policy":                                  {},
-	"aws_iam_group":                                                    {},
-	"aws_iam_group_membership":                                         {},
-	"aws_iam_group_policies_exclusive":                                 {},
-	"aws_iam_group_policy":                                             {},
-	"aws_iam_group_policy_attachment":                                  {},
-	"aws_iam_group_policy_attachments_exclusive":                       {},
-	"aws_iam_organizations_features":                                   {},
-	"aws_iam_policy_attachment":                                        {},
-	"aws_iam_role_policies_exclusive":                                  {},
-	"aws_iam_role_policy":                                              {},
-	"aws_iam_role_policy_attachment":                                   {},
-	"aws_iam_role_policy_attachments_exclusive":                        {},
-	"aws_iam_security_token_service_preferences":                       {},
-	"aws_iam_service_specific_credential":                              {},
-	"aws_iam_signing_certificate":                                      {},
-	"aws_iam_user_group_membership":                                    {},
-	"aws_iam_user_login_profile":                                       {},
-	"aws_iam_user_policies_exclusive":                                  {},
-	"aws_iam_user_policy":                                              {},
-	"aws_iam_user_policy_attachment":                                   {},
-	"aws_iam_user_policy_attachments_exclusive":                        {},
-	"aws_iam_user_ssh_key":                                             {},
-	"aws_identitystore_group":                                          {},
-	"aws_identitystore_group_membership":                               {},
-	"aws_identitystore_user":                                           {},
-	"aws_inspector2_delegated_admin_account":                           {},
-	"aws_inspector2_enabler":                                           {},
-	"aws_inspector2_member_association":                                {},
-	"aws_inspector2_organization_configuration":                        {},
-	"aws_inspector_assessment_target":                                  {},
-	"aws_internet_gateway_attachment":                                  {},
-	"aws_iot_certificate":                                              {},
-	"aws_iot_event_configurations":                                     {},
-	"aws_iot_indexing_configuration":                                   {},
-	"aws_iot_logging_options":                                          {},
-	"aws_iot_policy_attachment":                                        {},
-	"aws_iot_thing":                                                    {},
-	"aws_iot_thing_group_membership":                                   {},
-	"aws_iot_thing_principal_attachment":                               {},
-	"aws_iot_topic_rule_destination":                                   {},
-	"aws_kendra_experience":                                            {},
-	"aws_kinesis_resource_policy":                                      {},
-	"aws_kinesisanalyticsv2_application_snapshot":                      {},
-	"aws_kms_alias":                                                    {},
-	"aws_kms_ciphertext":                                               {},
-	"aws_kms_custom_key_store":                                         {},
-	"aws_kms_grant":                                                    {},
-	"aws_kms_key_policy":                                               {},
-	"aws_lakeformation_data_cells_filter":                              {},
-	"aws_lakeformation_data_lake_settings":                             {},
-	"aws_lakeformation_lf_tag":                                         {},
-	"aws_lakeformation_lf_tag_expression":                              {},
-	"aws_lakeformation_opt_in":                                         {},
-	"aws_lakeformation_permissions":                                    {},
-	"aws_lakeformation_resource":                                       {},
-	"aws_lakeformation_resource_lf_tag":                                {},
-	"aws_lakeformation_resource_lf_tags":                               {},
-	"aws_lambda_alias":                                                 {},
-	"aws_lambda_function_event_invoke_config":                          {},
-	"aws_lambda_function_recursion_config":                             {},
-	"aws_lambda_function_url":                                          {},
-	"aws_lambda_invocation":                                            {},
-	"aws_lambda_layer_version":                                         {},
-	"aws_lambda_layer_version_permission":                              {},
-	"aws_lambda_permission":                                            {},
-	"aws_lambda_provisioned_concurrency_config":                        {},
-	"aws_lambda_runtime_management_config":                             {},
-	"aws_launch_configuration":                                         {},
-	"aws_lb_cookie_stickiness_policy":                                  {},
-	"aws_lb_listener_certificate":                                      {},
-	"aws_lb_ssl_negotiation_policy":                                    {},
-	"aws_lb_target_group_attachment":                                   {},
-	"aws_lb_trust_store_revocation":                                    {},
-	"aws_lex_bot":                                                      {},
-	"aws_lex_bot_alias":                                                {},
-	"aws_lex_intent":                                                   {},
-	"aws_lex_slot_type":                                                {},
-	"aws_lexv2models_bot_locale":                                       {},
-	"aws_lexv2models_bot_version":                                      {},
-	"aws_lexv2models_intent":                                           {},
-	"aws_lexv2models_slot":                                             {},
-	"aws_lexv2models_slot_type":                                        {},
-	"aws_licensemanager_association":                                   {},
-	"aws_licensemanager_grant":                                         {},
-	"aws_licensemanager_grant_accepter":                                {},
-	"aws_lightsail_bucket_access_key":                                  {},
-	"aws_lightsail_bucket_resource_access":                             {},
-	"aws_lightsail_container_service_deployment_version":               {},
-	"aws_lightsail_disk_attachment":                                    {},
-	"aws_lightsail_domain":                                             {},
-	"aws_lightsail_domain_entry":                                       {},
-	"aws_lightsail_instance_public_ports":                              {},
-	"aws_lightsail_lb_attachment":                                      {},
-	"aws_lightsail_lb_certificate":                                     {},
-	"aws_lightsail_lb_certificate_attachment":                          {},
-	"aws_lightsail_lb_https_redirection_policy":                        {},
-	"aws_lightsail_lb_stickiness_policy":                               {},
-	"aws_lightsail_static_ip":                                          {},
-	"aws_lightsail_static_ip_attachment":                               {},
-	"aws_load_balancer_backend_server_policy":                          {},
-	"aws_load_balancer_listener_policy":                                {},
-	"aws_load_balancer_policy":                                         {},
-	"aws_location_tracker_association":                                 {},
-	"aws_m2_deployment":                                                {},
-	"aws_macie2_account":                                               {},
-	"aws_macie2_classification_export_configuration":                   {},
-	"aws_macie2_invitation_accepter":                                   {},
-	"aws_macie2_organization_admin_account":                            {},
-	"aws_macie2_organization_configuration":                            {},
-	"aws_main_route_table_association":                                 {},
-	"aws_media_store_container_policy":                                 {},
-	"aws_medialive_multiplex_program":                                  {},
-	"aws_msk_cluster_policy":                                           {},
-	"aws_msk_configuration":                                            {},
-	"aws_msk_scram_secret_association":                                 {},
-	"aws_msk_single_scram_secret_association":                          {},
-	"aws_nat_gateway_eip_association":                                  {},
-	"aws_neptune_cluster_snapshot":                                     {},
-	"aws_neptune_global_cluster":                                       {},
-	"aws_network_acl_association":                                      {},
-	"aws_network_acl_rule":                                             {},
-	"aws_network_interface_attachment":                                 {},
-	"aws_network_interface_permission":                                 {},
-	"aws_network_interface_sg_attachment":                              {},
-	"aws_networkfirewall_firewall_transit_gateway_attachment_accepter": {},
-	"aws_networkfirewall_logging_configuration":                        {},
-	"aws_networkfirewall_resource_policy":                              {},
-	"aws_networkmanager_attachment_accepter":                           {},
-	"aws_networkmanager_core_network_policy_attachment":                {},
-	"aws_networkmanager_customer_gateway_association":                  {},
-	"aws_networkmanager_link_association":                              {},
-	"aws_networkmanager_transit_gateway_connect_peer_association":      {},
-	"aws_networkmanager_transit_gateway_registration":                  {},
-	"aws_notifications_channel_association":                            {},
-	"aws_notifications_event_rule":                                     {},
-	"aws_notifications_notification_hub":                               {},
-	"aws_oam_sink_policy":                                              {},
-	"aws_opensearch_authorize_vpc_endpoint_access":                     {},
-	"aws_opensearch_domain_policy":                                     {},
-	"aws_opensearch_domain_saml_options":                               {},
-	"aws_opensearch_inbound_connection_accepter":                       {},
-	"aws_opensearch_outbound_connection":                               {},
-	"aws_opensearch_package":                                           {},
-	"aws_opensearch_package_association":                               {},
-	"aws_opensearch_vpc_endpoint":                                      {},
-	"aws_opensearchserverless_access_policy":                           {},
-	"aws_opensearchserverless_lifecycle_policy":                        {},
-	"aws_opensearchserverless_security_config":                         {},
-	"aws_opensearchserverless_security_policy":                         {},
-	"aws_opensearchserverless_vpc_endpoint":                            {},
-	"aws_organizations_delegated_administrator":                        {},
-	"aws_organizations_organization":                                   {},
-	"aws_organizations_policy_attachment":                              {},
-	"aws_paymentcryptography_key_alias":                                {},
-	"aws_pinpoint_adm_channel":                                         {},
-	"aws_pinpoint_apns_channel":                                        {},
-	"aws_pinpoint_apns_sandbox_channel":                                {},
-	"aws_pinpoint_apns_voip_channel":                                   {},
-	"aws_pinpoint_apns_voip_sandbox_channel":                           {},
-	"aws_pinpoint_baidu_channel":                                       {},
-	"aws_pinpoint_email_channel":                                       {},
-	"aws_pinpoint_event_stream":                                        {},
-	"aws_pinpoint_gcm_channel":                                         {},
-	"aws_pinpoint_sms_channel":                                         {},
-	"aws_prometheus_alert_manager_definition":                          {},
-	"aws_prometheus_query_logging_configuration":                       {},
-	"aws_prometheus_resource_policy":                                   {},
-	"aws_prometheus_workspace_configuration":                           {},
-	"aws_proxy_protocol_policy":                                        {},
-	"aws_quicksight_account_settings":                                  {},
-	"aws_quicksight_account_subscription":                              {},
-	"aws_quicksight_folder_membership":                                 {},
-	"aws_quicksight_group":                                             {},
-	"aws_quicksight_group_membership":                                  {},
-	"aws_quicksight_iam_policy_assignment":                             {},
-	"aws_quicksight_ingestion":                                         {},
-	"aws_quicksight_ip_restriction":                                    {},
-	"aws_quicksight_key_registration":                                  {},
-	"aws_quicksight_refresh_schedule":                                  {},
-	"aws_quicksight_role_custom_permission":                            {},
-	"aws_quicksight_role_membership":                                   {},
-	"aws_quicksight_template_alias":                                    {},
-	"aws_quicksight_user":                                              {},
-	"aws_quicksight_user_custom_permission":                            {},
-	"aws_ram_principal_association":                                    {},
-	"aws_ram_resource_association":                                     {},
-	"aws_ram_resource_share_accepter":                                  {},
-	"aws_ram_sharing_with_organization":                                {},
-	"aws_rds_certificate":                                              {},
-	"aws_rds_cluster_activity_stream":                                  {},
-	"aws_rds_cluster_role_association":                                 {},
-	"aws_rds_export_task":                                              {},
-	"aws_rds_instance_state":                                           {},
-	"aws_redshift_authentication_profile":                              {},
-	"aws_redshift_cluster_iam_roles":                                   {},
-	"aws_redshift_data_share_authorization":                            {},
-	"aws_redshift_data_share_consumer_association":                     {},
-	"aws_redshift_endpoint_access":                                     {},
-	"aws_redshift_endpoint_authorization":                              {},
-	"aws_redshift_logging":                                             {},
-	"aws_redshift_partner":                                             {},
-	"aws_redshift_resource_policy":                                     {},
-	"aws_redshift_scheduled_action":                                    {},
-	"aws_redshift_snapshot_copy":                                       {},
-	"aws_redshift_snapshot_schedule_association":                       {},
-	"aws_redshiftdata_statement":                                       {},
-	"aws_redshiftserverless_custom_domain_association":                 {},
-	"aws_redshiftserverless_endpoint_access":                           {},
-	"aws_redshiftserverless_resource_policy":                           {},
-	"aws_redshiftserverless_snapshot":                                  {},
-	"aws_redshiftserverless_usage_limit":                               {},
-	"aws_resourcegroups_resource":                                      {},
-	"aws_route":                                                        {},
-	"aws_route53_cidr_collection":                                      {},
-	"aws_route53_cidr_location":                                        {},
-	"aws_route53_delegation_set":                                       {},
-	"aws_route53_hosted_zone_dnssec":                                   {},
-	"aws_route53_key_signing_key":                                      {},
-	"aws_route53_query_log":                                            {},
-	"aws_route53_record":                                               {},
-	"aws_route53_records_exclusive":                                    {},
-	"aws_route53_resolver_config":                                      {},
-	"aws_route53_resolver_dnssec_config":                               {},
-	"aws_route53_resolver_firewall_config":                             {},
-	"aws_route53_resolver_firewall_rule":                               {},
-	"aws_route53_resolver_query_log_config_association":                {},
-	"aws_route53_resolver_rule_association":                            {},
-	"aws_route53_traffic_policy":                                       {},
-	"aws_route53_traffic_policy_instance":                              {},
-	"aws_route53_vpc_association_authorization":                        {},
-	"aws_route53_zone_association":                                     {},
-	"aws_route53domains_delegation_signer_record":                      {},
-	"aws_route53profiles_resource_association":                         {},
-	"aws_route53recoverycontrolconfig_routing_control":                 {},
-	"aws_route_table_association":                                      {},
-	"aws_rum_metrics_destination":                                      {},
-	"aws_s3_account_public_access_block":                               {},
-	"aws_s3_bucket_accelerate_configuration":                           {},
-	"aws_s3_bucket_acl":                                                {},
-	"aws_s3_bucket_analytics_configuration":                            {},
-	"aws_s3_bucket_cors_configuration":                                 {},
-	"aws_s3_bucket_intelligent_tiering_configuration":                  {},
-	"aws_s3_bucket_inventory":                                          {},
-	"aws_s3_bucket_lifecycle_configuration":                            {},
-	"aws_s3_bucket_logging":                                            {},
-	"aws_s3_bucket_metadata_configuration":                             {},
-	"aws_s3_bucket_metric":                                             {},
-	"aws_s3_bucket_notification":                                       {},
-	"aws_s3_bucket_object_lock_configuration":                          {},
-	"aws_s3_bucket_ownership_controls":                                 {},
-	"aws_s3_bucket_policy":                                             {},
-	"aws_s3_bucket_public_access_block":                                {},
-	"aws_s3_bucket_replication_configuration":                          {},
-	"aws_s3_bucket_request_payment_configuration":                      {},
-	"aws_s3_bucket_server_side_encryption_configuration":               {},
-	"aws_s3_bucket_versioning":                                         {},
-	"aws_s3_bucket_website_configuration":                              {},
-	"aws_s3control_access_grants_instance_resource_policy":             {},
-	"aws_s3control_access_point_policy":                                {},
-	"aws_s3control_bucket_lifecycle_configuration":                     {},
-	"aws_s3control_bucket_policy":                                      {},
-	"aws_s3control_directory_bucket_access_point_scope":                {},
-	"aws_s3control_multi_region_access_point":                          {},
-	"aws_s3control_multi_region_access_point_policy":                   {},
-	"aws_s3control_object_lambda_access_point":                         {},
-	"aws_s3control_object_lambda_access_point_policy":                  {},
-	"aws_s3outposts_endpoint":                                          {},
-	"aws_s3tables_namespace":                                           {},
-	"aws_s3tables_table":                                               {},
-	"aws_s3tables_table_bucket":                                        {},
-	"aws_s3tables_table_bucket_policy":                                 {},
-	"aws_s3tables_table_policy":                                        {},
-	"aws_sagemaker_device":                                             {},
-	"aws_sagemaker_image_version":                                      {},
-	"aws_sagemaker_model_package_group_policy":                         {},
-	"aws_sagemaker_servicecatalog_portfolio_status":                    {},
-	"aws_sagemaker_workforce":                                          {},
-	"aws_scheduler_schedule":                                           {},
-	"aws_schemas_registry_policy":                                      {},
-	"aws_secretsmanager_secret_policy":                                 {},
-	"aws_secretsmanager_secret_rotation":                               {},
-	"aws_secretsmanager_secret_version":                                {},
-	"aws_security_group_rule":                                          {},
-	"aws_securityhub_account":                                          {},
-	"aws_securityhub_action_target":                                    {},
-	"aws_securityhub_configuration_policy":                             {},
-	"aws_securityhub_configuration_policy_association":                 {},
-	"aws_securityhub_finding_aggregator":                               {},
-	"aws_securityhub_insight":                                          {},
-	"aws_securityhub_invite_accepter":                                  {},
-	"aws_securityhub_member":                                           {},
-	"aws_securityhub_organization_admin_account":                       {},
-	"aws_securityhub_organization_configuration":                       {},
-	"aws_securityhub_product_subscription":                             {},
-	"aws_securityhub_standards_control":                                {},
-	"aws_securityhub_standards_control_association":                    {},
-	"aws_securityhub_standards_subscription":                           {},
-	"aws_securitylake_aws_log_source":                                  {},
-	"aws_securitylake_custom_log_source":                               {},
-	"aws_securitylake_subscriber_notification":                         {},
-	"aws_service_discovery_instance":                                   {},
-	"aws_servicecatalog_budget_resource_association":                   {},
-	"aws_servicecatalog_constraint":                                    {},
-	"aws_servicecatalog_organizations_access":                          {},
-	"aws_servicecatalog_portfolio_share":                               {},
-	"aws_servicecatalog_principal_portfolio_association":               {},
-	"aws_servicecatalog_product_portfolio_association":                 {},
-	"aws_servicecatalog_provisioning_artifact":                         {},
-	"aws_servicecatalog_service_action":                                {},
-	"aws_servicecatalog_tag_option":                                    {},
-	"aws_servicecatalog_tag_option_resource_association":               {},
-	"aws_servicecatalogappregistry_attribute_group_association":        {},
-	"aws_servicequotas_service_quota":                                  {},
-	"aws_servicequotas_template":                                       {},
-	"aws_servicequotas_template_association":                           {},
-	"aws_ses_active_receipt_rule_set":                                  {},
-	"aws_ses_configuration_set":                                        {},
-	"aws_ses_domain_dkim":                                              {},
-	"aws_ses_domain_identity":                                          {},
-	"aws_ses_domain_identity_verification":                             {},
-	"aws_ses_domain_mail_from":                                         {},
-	"aws_ses_email_identity":                                           {},
-	"aws_ses_event_destination":                                        {},
-	"aws_ses_identity_notification_topic":                              {},
-	"aws_ses_identity_policy":                                          {},
-	"aws_ses_receipt_filter":                                           {},
-	"aws_ses_receipt_rule":                                             {},
-	"aws_ses_receipt_rule_set":                                         {},
-	"aws_ses_template":                                                 {},
-	"aws_sesv2_account_suppression_attributes":                         {},
-	"aws_sesv2_account_vdm_attributes":                                 {},
-	"aws_sesv2_configuration_set_event_destination":                    {},
-	"aws_sesv2_dedicated_ip_assignment":                                {},
-	"aws_sesv2_email_identity_feedback_attributes":                     {},
-	"aws_sesv2_email_identity_mail_from_attributes":                    {},
-	"aws_sesv2_email_identity_policy":                                  {},
-	"aws_sfn_alias":                                                    {},
-	"aws_shield_application_layer_automatic_response":                  {},
-	"aws_shield_drt_access_log_bucket_association":                     {},
-	"aws_shield_drt_access_role_arn_association":                       {},
-	"aws_shield_proactive_engagement":                                  {},
-	"aws_shield_protection_health_check_association":                   {},
-	"aws_shield_subscription":                                          {},
-	"aws_signer_signing_job":                                           {},
-	"aws_signer_signing_profile_permission":                            {},
-	"aws_snapshot_create_volume_permission":                            {},
-	"aws_sns_platform_application":                                     {},
-	"aws_sns_sms_preferences":                                          {},
-	"aws_sns_topic_data_protection_policy":                             {},
-	"aws_sns_topic_policy":                                             {},
-	"aws_sns_topic_subscription":                                       {},
-	"aws_spot_datafeed_subscription":                                   {},
-	"aws_sqs_queue_policy":                                             {},
-	"aws_sqs_queue_redrive_allow_policy":                               {},
-	"aws_sqs_queue_redrive_policy":                                     {},
-	"aws_ssm_default_patch_baseline":                                   {},
-	"aws_ssm_maintenance_window_target":                                {},
-	"aws_ssm_maintenance_window_task":                                  {},
-	"aws_ssm_patch_group":                                              {},
-	"aws_ssm_resource_data_sync":                                       {},
-	"aws_ssm_service_setting":                                          {},
-	"aws_ssmcontacts_contact_channel":                                  {},
-	"aws_ssmcontacts_plan":                                             {},
-	"aws_ssoadmin_account_assignment":                                  {},
-	"aws_ssoadmin_application_access_scope":                            {},
-	"aws_ssoadmin_application_assignment":                              {},
-	"aws_ssoadmin_application_assignment_configuration":                {},
-	"aws_ssoadmin_customer_managed_policy_attachment":                  {},
-	"aws_ssoadmin_instance_access_control_attributes":                  {},
-	"aws_ssoadmin_managed_policy_attachment":                           {},
-	"aws_ssoadmin_permission_set_inline_policy":                        {},
-	"aws_ssoadmin_permissions_boundary_attachment":                     {},
-	"aws_storagegateway_cache":                                         {},
-	"aws_storagegateway_upload_buffer":                                 {},
-	"aws_storagegateway_working_storage":                               {},
-	"aws_synthetics_group_association":                                 {},
-	"aws_transfer_access":                                              {},
-	"aws_transfer_ssh_key":                                             {},
-	"aws_transfer_tag":                                                 {},
-	"aws_transfer_web_app_customization":                               {},
-	"aws_verifiedaccess_instance_logging_configuration":                {},
-	"aws_verifiedaccess_instance_trust_provider_attachment":            {},
-	"aws_verifiedpermissions_identity_source":                          {},
-	"aws_verifiedpermissions_policy":                                   {},
-	"aws_verifiedpermissions_policy_template":                          {},
-	"aws_verifiedpermissions_schema":                                   {},
-	"aws_volume_attachment":                                            {},
-	"aws_vpc_block_public_access_options":                              {},
-	"aws_vpc_dhcp_options_association":                                 {},
-	"aws_vpc_endpoint_connection_accepter":                             {},
-	"aws_vpc_endpoint_connection_notification":                         {},
-	"aws_vpc_endpoint_policy":                                          {},
-	"aws_vpc_endpoint_private_dns":                                     {},
-	"aws_vpc_endpoint_route_table_association":                         {},
-	"aws_vpc_endpoint_security_group_association":                      {},
-	"aws_vpc_endpoint_service_allowed_principal":                       {},
-	"aws_vpc_endpoint_service_private_dns_verification":                {},
-	"aws_vpc_endpoint_subnet_association":                              {},
-	"aws_vpc_ipam_organization_admin_account":                          {},
-	"aws_vpc_ipam_pool_cidr":                                           {},
-	"aws_vpc_ipam_pool_cidr_allocation":                                {},
-	"aws_vpc_ipam_preview_next_cidr":                                   {},
-	"aws_vpc_ipv4_cidr_block_association":                              {},
-	"aws_vpc_ipv6_cidr_block_association":                              {},
-	"aws_vpc_network_performance_metric_subscription":                  {},
-	"aws_vpc_peering_connection_options":                               {},
-	"aws_vpc_route_server_propagation":                                 {},
-	"aws_vpc_route_server_vpc_association":                             {},
-	"aws_vpc_security_group_vpc_association":                           {},
-	"aws_vpclattice_auth_policy":                                       {},
-	"aws_vpclattice_resource_policy":                                   {},
-	"aws_vpclattice_target_group_attachment":                           {},
-	"aws_vpn_connection_route":                                         {},
-	"aws_vpn_gateway_attachment":                                       {},
-	"aws_vpn_gateway_route_propagation":                                {},
-	"aws_waf_byte_match_set":                                           {},
-	"aws_waf_geo_match_set":                                            {},
-	"aws_waf_ipset":                                                    {},
-	"aws_waf_regex_match_set":                                          {},
-	"aws_waf_regex_pattern_set":                                        {},
-	"aws_waf_size_constraint_set":                                      {},
-	"aws_waf_sql_injection_match_set":                                  {},
-	"aws_waf_xss_match_set":                                            {},
-	"aws_wafregional_byte_match_set":                                   {},
-	"aws_wafregional_geo_match_set":                                    {},
-	"aws_wafregional_ipset":                                            {},
-	"aws_wafregional_regex_match_set":                                  {},
-	"aws_wafregional_regex_pattern_set":                                {},
-	"aws_wafregional_size_constraint_set":                              {},
-	"aws_wafregional_sql_injection_match_set":                          {},
-	"aws_wafregional_web_acl_association":                              {},
-	"aws_wafregional_xss_match_set":                                    {},
-	"aws_wafv2_api_key":                                                {},
-	"aws_wafv2_web_acl_association":                                    {},
-	"aws_wafv2_web_acl_logging_configuration":                          {},
-	"aws_wafv2_web_acl_rule_group_association":                         {},
-	"aws_workspacesweb_browser_settings_association":                   {},
-	"aws_workspacesweb_data_protection_settings_association":           {},
-	"aws_workspacesweb_ip_access_settings_association":                 {},
-	"aws_workspacesweb_network_settings_association":                   {},
-	"aws_workspacesweb_session_logger_association":                     {},
-	"aws_workspacesweb_trust_store_association":                        {},
-	"aws_workspacesweb_user_access_logging_settings_association":       {},
-	"aws_workspacesweb_user_settings_association":                      {},
-	"aws_xray_encryption_config":                                       {},
-	"aws_xray_resource_policy":                                         {},
-}
-
 func newProviderRequirement() *providerRequirement {
 	return &providerRequirement{
 		Constraints: make(map[string]struct{}),
@@ -1718,7 +1233,7 @@ func (pr *providerRequirement) merge(name string, incoming *providerRequirement)
 	for key, expr := range incoming.OtherAttrs {
 		if existing, ok := pr.OtherAttrs[key]; ok {
 			if existing != strings.TrimSpace(expr) {
-				fmt.Printf("[!] Warning: conflicting %s for provider %q; keeping first definition\n", key, name)
+				logging.Warnf("[!] Warning: conflicting %s for provider %q; keeping first definition", key, name)
 			}
 			continue
 		}
@@ -1738,13 +1253,13 @@ func (pr *providerRequirement) mergeSource(name, incoming string) {
 
 	incomingPreferred := isHashicorpSource(incoming) && !isHashicorpSource(pr.Source)
 	if incomingPreferred {
-		fmt.Printf("[!] Warning: conflicting source for provider %q; preferring %q over %q\n", name, incoming, pr.Source)
+		logging.Warnf("[!] Warning: conflicting source for provider %q; preferring %q over %q", name, incoming, pr.Source)
 		pr.Source = incoming
 		return
 	}
 
 	if pr.Source != incoming {
-		fmt.Printf("[!] Warning: conflicting source for provider %q (%q vs %q); keeping %q\n", name, pr.Source, incoming, pr.Source)
+		logging.Warnf("[!] Warning: conflicting source for provider %q (%q vs %q); keeping %q", name, pr.Source, incoming, pr.Source)
 	}
 }
 
@@ -2075,7 +1590,7 @@ func writeCombinedConfiguration(stacks []string, prefixes map[string]string, roo
 		return requiredProviders, err
 	}
 
-	fmt.Printf("[✓] Wrote combined configuration to %s\n", configPath)
+	logging.Infof("[✓] Wrote combined configuration to %s", configPath)
 	return requiredProviders, nil
 }
 
@@ -2136,37 +1651,49 @@ type variableValue struct {
 	source string
 }
 
-func collectVariableValues(root, environment string, stacks []string) (map[string]variableValue, int, error) {
+func collectVariableValues(root, environment, profile string, stackDirs []string, extraVarFiles []string) (map[string]variableValue, int, error) {
 	result := make(map[string]variableValue)
 	var sourcesUsed int
 
-	sources := []struct {
+	type source struct {
 		path        string
 		description string
-	}{
+	}
+	sources := []source{
 		{
 			path:        filepath.Join(root, "globals.tfvars"),
 			description: "globals.tfvars",
 		},
-		{
-			path:        filepath.Join(root, "environment", fmt.Sprintf("%s.tfvars", environment)),
-			description: fmt.Sprintf("environment/%s.tfvars", environment),
-		},
+	}
+	for _, name := range stacks.VarFileNames(environment, profile) {
+		sources = append(sources, source{
+			path:        filepath.Join(root, "environment", name),
+			description: "environment/" + name,
+		})
 	}
 
-	for _, stackDir := range stacks {
+	for _, stackDir := range stackDirs {
 		rel, err := filepath.Rel(root, stackDir)
 		if err != nil {
 			rel = stackDir
 		}
-		tfvarsPath := filepath.Join(root, rel, "tfvars", fmt.Sprintf("%s.tfvars", environment))
-		sources = append(sources, struct {
-			path        string
-			description string
-		}{
-			path:        tfvarsPath,
-			description: fmt.Sprintf("%s/tfvars/%s.tfvars", rel, environment),
+		propagated := stacks.PropagatedVarFile(filepath.Join(root, rel), environment)
+		sources = append(sources, source{
+			path:        propagated,
+			description: fmt.Sprintf("%s/tfvars/%s", rel, filepath.Base(propagated)),
 		})
+		for _, name := range stacks.VarFileNames(environment, profile) {
+			sources = append(sources, source{
+				path:        filepath.Join(root, rel, "tfvars", name),
+				description: fmt.Sprintf("%s/tfvars/%s", rel, name),
+			})
+		}
+	}
+	for _, path := range extraVarFiles {
+		if _, err := os.Stat(path); err != nil {
+			return nil, sourcesUsed, fmt.Errorf("extra var file: %w", err)
+		}
+		sources = append(sources, source{path: path, description: path})
 	}
 
 	for _, src := range sources {
@@ -2184,6 +1711,35 @@ func collectVariableValues(root, environment string, stacks []string) (map[strin
 	return result, sourcesUsed, nil
 }
 
+// addExternalValues sets the variable named by each stack's external
+// dependencies to the outputs of the external state. The merged
+// configuration shares variables between stacks, so one name must refer to
+// the same external state everywhere.
+func addExternalValues(ctx context.Context, runner *stacks.Runner, stackDirs []string, displayNames map[string]string, dest map[string]variableValue) error {
+	external := make(map[string]variableValue)
+	for _, stackDir := range stackDirs {
+		values, err := runner.ExternalValues(ctx, stackDir)
+		if err != nil {
+			return &StackError{StackDir: stackDir, Err: fmt.Errorf("%s: %w", displayNames[stackDir], err)}
+		}
+		for name, value := range values {
+			tokens, err := tokensForExpression(value)
+			if err != nil {
+				return fmt.Errorf("%s: external dependency %s: %w", displayNames[stackDir], name, err)
+			}
+			if current, ok := external[name]; ok {
+				if !tokensEqual(current.tokens, tokens) {
+					return fmt.Errorf("external dependency %q of %s reads a different state than the one of the same name in %s", name, displayNames[stackDir], current.source)
+				}
+				continue
+			}
+			external[name] = variableValue{tokens: tokens, source: displayNames[stackDir]}
+			mergeVariableTokens(dest, map[string]hclwrite.Tokens{name: tokens}, "external dependency of "+displayNames[stackDir])
+		}
+	}
+	return nil
+}
+
 func loadTFVarsFile(path string) (map[string]hclwrite.Tokens, error) {
 	stat, err := os.Stat(path)
 	if err != nil {
@@ -2219,7 +1775,7 @@ func mergeVariableTokens(dest map[string]variableValue, incoming map[string]hclw
 			if tokensEqual(current.tokens, tokens) {
 				continue
 			}
-			fmt.Printf("[!] Warning: variable %q from %s overrides value from %s\n", name, source, current.source)
+			logging.Warnf("[!] Warning: variable %q from %s overrides value from %s", name, source, current.source)
 		}
 		dest[name] = variableValue{
 			tokens: copyTokens(tokens),
@@ -2428,8 +1984,6 @@ func cleanupTerraformBlocks(body *hclwrite.Body, providers providerRequirements,
 			}
 			body.RemoveBlock(block)
 			continue
-		case "resource":
-			ensureLifecycleIgnoresTags(block)
 		case "provider":
 			keep := registerProviderBlock(block, seenProviders)
 			if !keep {
@@ -2509,7 +2063,7 @@ func registerProviderBlock(block *hclwrite.Block, seen map[string]struct{}) bool
 
 	key := fmt.Sprintf("%s|%s|%s", providerType, alias, region)
 	if _, exists := seen[key]; exists {
-		fmt.Printf("[i] Skipping duplicate provider %q (alias=%s, region=%s)\n", providerType, alias, region)
+		logging.Debugf("[i] Skipping duplicate provider %q (alias=%s, region=%s)", providerType, alias, region)
 		return false
 	}
 
@@ -2547,7 +2101,7 @@ func removeDuplicateVariables(body *hclwrite.Body, seen map[string]bool) {
 	}
 }
 
-func ensureLifecycleIgnoresTags(block *hclwrite.Block) {
+func ensureLifecycleIgnoresTags(block *hclwrite.Block, taggable taggableTypes) {
 	if block == nil || block.Type() != "resource" {
 		return
 	}
@@ -2556,8 +2110,8 @@ func ensureLifecycleIgnoresTags(block *hclwrite.Block) {
 	if len(labels) == 0 {
 		return
 	}
-	resourceType := labels[0]
-	if !strings.HasPrefix(resourceType, "aws_") || shouldSkipTagLifecycle(resourceType) {
+	targetAttrs := taggable.attributes(labels[0])
+	if len(targetAttrs) == 0 {
 		return
 	}
 
@@ -2580,7 +2134,6 @@ func ensureLifecycleIgnoresTags(block *hclwrite.Block) {
 
 	lifecycleBody := lifecycle.Body()
 	attr := lifecycleBody.GetAttribute("ignore_changes")
-	targetAttrs := []string{"tags", "tags_all"}
 	if attr == nil {
 		addIgnoreChangesAttribute(lifecycleBody, targetAttrs)
 		return
@@ -2603,7 +2156,7 @@ func ensureLifecycleIgnoresTags(block *hclwrite.Block) {
 
 	tokens, err := tokensForExpression(updated)
 	if err != nil {
-		fmt.Printf("[!] Warning: failed to parse ignore_changes expression, overriding: %v\n", err)
+		logging.Warnf("[!] Warning: failed to parse ignore_changes expression, overriding: %v", err)
 		tokens, err = tokensForExpression("[" + strings.Join(targetAttrs, ", ") + "]")
 		if err != nil {
 			return
@@ -2623,7 +2176,7 @@ func addIgnoreChangesAttribute(body *hclwrite.Body, attrs []string) {
 	expr := "[" + strings.Join(attrs, ", ") + "]"
 	tokens, err := tokensForExpression(expr)
 	if err != nil {
-		fmt.Printf("[!] Warning: unable to build ignore_changes expression: %v\n", err)
+		logging.Warnf("[!] Warning: unable to build ignore_changes expression: %v", err)
 		return
 	}
 	body.SetAttributeRaw("ignore_changes", tokens)
@@ -2668,11 +2221,6 @@ func extendIgnoreChangesExpression(current, attr string) string {
 	return fmt.Sprintf("concat(%s, [%s])", current, attr)
 }
 
-func shouldSkipTagLifecycle(resourceType string) bool {
-	_, skip := tagLifecycleSkipTypes[resourceType]
-	return skip
-}
-
 func containsIgnoreAttr(expr, attr string) bool {
 	fields := strings.FieldsFunc(expr, func(r rune) bool {
 		switch r {
@@ -2690,19 +2238,32 @@ func containsIgnoreAttr(expr, attr string) bool {
 	return false
 }
 
-func ensureLifecycleIgnoresTagsInBody(body *hclwrite.Body) {
+func ensureLifecycleIgnoresTagsInBody(body *hclwrite.Body, taggable taggableTypes) {
 	if body == nil {
 		return
 	}
 	for _, block := range body.Blocks() {
 		if block.Type() == "resource" {
-			ensureLifecycleIgnoresTags(block)
+			ensureLifecycleIgnoresTags(block, taggable)
 		}
-		ensureLifecycleIgnoresTagsInBody(block.Body())
+		ensureLifecycleIgnoresTagsInBody(block.Body(), taggable)
 	}
 }
 
-func patchModuleResourceLifecycle(superplanDir string) error {
+// patchResourceLifecycle makes the taggable resources of the merged
+// configuration in superplanDir, and of the modules terraform init installed
+// there, ignore tag changes.
+func patchResourceLifecycle(superplanDir string, taggable taggableTypes) error {
+	rootFiles, err := filepath.Glob(filepath.Join(superplanDir, "*.tf"))
+	if err != nil {
+		return err
+	}
+	for _, path := range rootFiles {
+		if _, err := patchConfigLifecycle(path, taggable); err != nil {
+			return err
+		}
+	}
+
 	modulesDir := filepath.Join(superplanDir, ".terraform", "modules")
 	info, err := os.Stat(modulesDir)
 	if err != nil {
@@ -2726,40 +2287,48 @@ func patchModuleResourceLifecycle(superplanDir string) error {
 		if filepath.Ext(path) != ".tf" {
 			return nil
 		}
-
-		src, err := os.ReadFile(path)
-		if err != nil {
-			return err
+		changed, err := patchConfigLifecycle(path, taggable)
+		if changed {
+			updated++
 		}
-
-		file, diags := hclwrite.ParseConfig(src, path, hcl.InitialPos)
-		if diags.HasErrors() {
-			return fmt.Errorf("parse module config %s: %s", path, diags.Error())
-		}
-
-		ensureLifecycleIgnoresTagsInBody(file.Body())
-
-		newContent := file.Bytes()
-		if bytes.Equal(src, newContent) {
-			return nil
-		}
-
-		if err := os.WriteFile(path, newContent, 0o644); err != nil {
-			return fmt.Errorf("write module config %s: %w", path, err)
-		}
-		updated++
-		return nil
+		return err
 	})
 	if err != nil {
 		return err
 	}
 
 	if updated > 0 {
-		fmt.Printf("[i] Applied lifecycle tag ignore to %d module files\n", updated)
+		logging.Debugf("[i] Applied lifecycle tag ignore to %d module files", updated)
 	}
 	return nil
 }
 
+// patchConfigLifecycle rewrites the configuration file at path with the tag
+// lifecycle ignores, reporting whether it changed.
+func patchConfigLifecycle(path string, taggable taggableTypes) (bool, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	file, diags := hclwrite.ParseConfig(src, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return false, fmt.Errorf("parse config %s: %s", path, diags.Error())
+	}
+
+	ensureLifecycleIgnoresTagsInBody(file.Body(), taggable)
+
+	newContent := file.Bytes()
+	if bytes.Equal(src, newContent) {
+		return false, nil
+	}
+
+	if err := os.WriteFile(path, newContent, 0o644); err != nil {
+		return false, fmt.Errorf("write config %s: %w", path, err)
+	}
+	return true, nil
+}
+
 func ensureLocalBackend(dir string, stateProviders map[string]string, configProviders providerRequirements) error {
 	mainTFPath := filepath.Join(dir, "main.tf")
 
@@ -2829,6 +2398,7 @@ func buildSuperplanSummary(plan *tfjson.Plan, ctx summaryContext) superplanSumma
 		stackSummaries[rel] = stackChangeSummary{
 			Stack:           rel,
 			Prefix:          info.Prefix,
+			NoState:         info.NoState,
 			Dependencies:    deps,
 			DependentStacks: dependents,
 		}
@@ -2910,6 +2480,160 @@ func buildSuperplanSummary(plan *tfjson.Plan, ctx summaryContext) superplanSumma
 	}
 }
 
+// securityChanges returns the plan's security-relevant changes sorted by stack
+// and address.
+func securityChanges(plan *tfjson.Plan, prefixToStack map[string]string, stackSummaries map[string]stackChangeSummary) []securityChange {
+	out := []securityChange{}
+	for _, change := range security.Changes(plan) {
+		stackRel := identifyStackFromAddress(change.Address, prefixToStack)
+		if stackRel == "" {
+			continue
+		}
+		change.Address = stripStackPrefix(stackSummaries[stackRel].Prefix, change.Address)
+		out = append(out, securityChange{Stack: stackRel, Change: change})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Stack != out[j].Stack {
+			return out[i].Stack < out[j].Stack
+		}
+		return out[i].Address < out[j].Address
+	})
+	return out
+}
+
+func printSecurityChanges(changes []securityChange) {
+	if len(changes) == 0 {
+		logging.Infof("[security] no security-relevant changes")
+		return
+	}
+	logging.Infof("[security] %d security-relevant changes:", len(changes))
+	for _, c := range changes {
+		logging.Infof("  %-15s %s: %s %s", c.Category, c.Stack, strings.Join(c.Actions, ","), c.Address)
+	}
+}
+
+func dependencyChanges(deltas []graph.DependencyDelta, infos map[string]*stackMetadata) []dependencyChange {
+	relOf := func(abs string) string {
+		if info, ok := infos[abs]; ok {
+			return info.RelativePath
+		}
+		return abs
+	}
+	rels := func(paths []string) []string {
+		var out []string
+		for _, p := range paths {
+			out = append(out, relOf(p))
+		}
+		return out
+	}
+	var out []dependencyChange
+	for _, d := range deltas {
+		out = append(out, dependencyChange{Stack: relOf(d.Stack), Add: rels(d.Add), Remove: rels(d.Remove)})
+	}
+	return out
+}
+
+func printDependencyChanges(changes []dependencyChange, syncing bool) {
+	for _, c := range changes {
+		for _, dep := range c.Add {
+			logging.Infof("[deps] %s: add %s (read via terraform_remote_state)", c.Stack, dep)
+		}
+		for _, dep := range c.Remove {
+			logging.Infof("[deps] %s: remove %s (remote state no longer read)", c.Stack, dep)
+		}
+	}
+	if len(changes) > 0 && !syncing {
+		logging.Infof("[deps] run plan-all with --sync-deps to update dependencies.json")
+	}
+}
+
+// buildHTMLReport converts summary into the HTML report model, attaching the
+// resource-level changes of each stack with addresses in the stack's own
+// address space.
+func buildHTMLReport(summary superplanSummary, plan *tfjson.Plan, prefixToStack map[string]string) report.Summary {
+	resources := make(map[string][]report.Resource)
+	if plan != nil {
+		for _, rc := range plan.ResourceChanges {
+			if rc == nil || rc.Change == nil || rc.Change.Actions.NoOp() || rc.Change.Actions.Read() {
+				continue
+			}
+			stackRel := identifyStackFromAddress(rc.Address, prefixToStack)
+			if stackRel == "" {
+				continue
+			}
+			actions := make([]string, 0, len(rc.Change.Actions))
+			for _, a := range rc.Change.Actions {
+				actions = append(actions, string(a))
+			}
+			resources[stackRel] = append(resources[stackRel], report.Resource{
+				Address:    stripStackPrefix(summary.Stacks[stackRel].Prefix, rc.Address),
+				Actions:    actions,
+				Attributes: report.Diff(rc.Change),
+			})
+		}
+	}
+
+	out := report.Summary{
+		SecurityFocus:     summary.SecurityChanges != nil,
+		GeneratedAt:       summary.GeneratedAt,
+		Environment:       summary.Environment,
+		AccountID:         summary.AccountID,
+		TerraformVersion:  summary.TerraformVersion,
+		TotalStacks:       summary.TotalStacks,
+		StacksWithChanges: summary.StacksWithChanges,
+		Adds:              summary.ResourceTotals.Adds,
+		Changes:           summary.ResourceTotals.Changes,
+		Destroys:          summary.ResourceTotals.Destroys,
+	}
+	names := make([]string, 0, len(summary.Stacks))
+	for rel := range summary.Stacks {
+		names = append(names, rel)
+	}
+	sort.Strings(names)
+	for _, rel := range names {
+		s := summary.Stacks[rel]
+		rcs := resources[rel]
+		sort.Slice(rcs, func(i, j int) bool { return rcs[i].Address < rcs[j].Address })
+		reason := s.Reason
+		if s.NoState {
+			reason = strings.TrimPrefix(reason+", no existing state", ", ")
+		}
+		out.Stacks = append(out.Stacks, report.Stack{
+			Name:         rel,
+			Reason:       reason,
+			Adds:         s.Adds,
+			Changes:      s.Changes,
+			Destroys:     s.Destroys,
+			Dependencies: s.Dependencies,
+			Dependents:   s.DependentStacks,
+			Resources:    rcs,
+		})
+	}
+	for _, c := range summary.SecurityChanges {
+		out.SecurityChanges = append(out.SecurityChanges, report.SecurityChange{
+			Stack:    c.Stack,
+			Address:  c.Address,
+			Category: c.Category,
+			Actions:  c.Actions,
+		})
+	}
+	for _, c := range summary.DependencyChanges {
+		out.DependencyChanges = append(out.DependencyChanges, report.DependencyChange{
+			Stack:  c.Stack,
+			Add:    c.Add,
+			Remove: c.Remove,
+		})
+	}
+	for _, issue := range summary.NetworkIssues {
+		out.NetworkIssues = append(out.NetworkIssues, report.NetworkIssue{
+			Kind:   issue.Kind,
+			Stacks: issue.Stacks,
+			Detail: issue.Detail,
+		})
+	}
+	return out
+}
+
 func identifyStackFromAddress(address string, prefixToStack map[string]string) string {
 	if address == "" {
 		return ""
@@ -2974,11 +2698,11 @@ func uniqueSortedStrings(items []string) []string {
 func warnIfPlanNotIgnored() {
 	data, err := os.ReadFile(".gitignore")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "[superplan] warning: unable to read .gitignore: %v\n", err)
+		logging.Warnf("[superplan] warning: unable to read .gitignore: %v", err)
 		return
 	}
 	content := string(data)
 	if !strings.Contains(content, "*.tfplan") && !strings.Contains(content, ".tfplan") {
-		fmt.Fprintf(os.Stderr, "[superplan] warning: .tfplan files are not ignored by Git (.tfplan missing from .gitignore)\n")
+		logging.Warnf("[superplan] warning: .tfplan files are not ignored by Git (.tfplan missing from .gitignore)")
 	}
 }
@@ -301,6 +301,7 @@ func TestBuildSuperplanSummary(t *testing.T) {
 			"applications/frontend": {
 				RelativePath: "applications/frontend",
 				Prefix:       "app_frontend",
+				NoState:      true,
 			},
 		},
 		DependenciesByRel: map[string][]string{
@@ -357,6 +358,9 @@ func TestBuildSuperplanSummary(t *testing.T) {
 	if appSummary.Reason != "dependency" {
 		t.Fatalf("expected dependency reason for applications/frontend, got %+v", appSummary)
 	}
+	if !appSummary.NoState || coreSummary.NoState {
+		t.Fatalf("expected only applications/frontend to be marked as having no state, got %+v and %+v", appSummary, coreSummary)
+	}
 	if len(appSummary.DependentStacks) != 0 {
 		t.Fatalf("frontend should have no dependents, got %+v", appSummary.DependentStacks)
 	}
@@ -494,11 +498,7 @@ resource "aws_kms_key" "single" {}
 		t.Fatalf("parse config: %s", diags.Error())
 	}
 
-	providers := make(providerRequirements)
-	seen := make(map[string]struct{})
-	if err := cleanupTerraformBlocks(file.Body(), providers, seen); err != nil {
-		t.Fatalf("cleanupTerraformBlocks: %v", err)
-	}
+	ensureLifecycleIgnoresTagsInBody(file.Body(), testTaggable)
 
 	resources := file.Body().Blocks()
 	if len(resources) != 5 {
@@ -588,7 +588,42 @@ func ignoreExprContains(expr, attr string) bool {
 	return false
 }
 
-func TestPatchModuleResourceLifecycle(t *testing.T) {
+// testTaggable stands in for the taggable types read from the AWS provider's
+// schema.
+var testTaggable = taggableTypes{
+	"aws_s3_bucket": {"tags", "tags_all"},
+	"aws_kms_key":   {"tags", "tags_all"},
+	"aws_lb":        {"tags", "tags_all"},
+}
+
+func TestEnsureLifecycleIgnoresTagsOfOtherProviders(t *testing.T) {
+	src := `resource "google_storage_bucket" "assets" {
+  name = "assets"
+}
+
+resource "azurerm_resource_group" "main" {
+  name = "main"
+}
+`
+	file, diags := hclwrite.ParseConfig([]byte(src), "resource.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("parse config: %s", diags.Error())
+	}
+
+	ensureLifecycleIgnoresTagsInBody(file.Body(), taggableTypes{
+		"google_storage_bucket":  {"labels", "terraform_labels"},
+		"azurerm_resource_group": {"tags"},
+	})
+
+	patched := string(file.Bytes())
+	for _, want := range []string{"ignore_changes = [labels, terraform_labels]", "ignore_changes = [tags]"} {
+		if !strings.Contains(patched, want) {
+			t.Fatalf("expected %q in patched config:\n%s", want, patched)
+		}
+	}
+}
+
+func TestPatchResourceLifecycle(t *testing.T) {
 	dir := t.TempDir()
 	modDir := filepath.Join(dir, ".terraform", "modules", "example")
 	if err := os.MkdirAll(modDir, 0o755); err != nil {
@@ -610,8 +645,21 @@ resource "aws_iam_role_policy_attachment" "skip" {
 		t.Fatalf("write module tf: %v", err)
 	}
 
-	if err := patchModuleResourceLifecycle(dir); err != nil {
-		t.Fatalf("patchModuleResourceLifecycle: %v", err)
+	superTF := filepath.Join(dir, "super.tf")
+	if err := os.WriteFile(superTF, []byte("resource \"aws_s3_bucket\" \"logs\" {\n  bucket = \"logs\"\n}\n"), 0o644); err != nil {
+		t.Fatalf("write super.tf: %v", err)
+	}
+
+	if err := patchResourceLifecycle(dir, testTaggable); err != nil {
+		t.Fatalf("patchResourceLifecycle: %v", err)
+	}
+
+	merged, err := os.ReadFile(superTF)
+	if err != nil {
+		t.Fatalf("read super.tf: %v", err)
+	}
+	if !strings.Contains(string(merged), "ignore_changes = [tags, tags_all]") {
+		t.Fatalf("lifecycle ignore not added to merged resource:\n%s", merged)
 	}
 
 	content, err := os.ReadFile(path)
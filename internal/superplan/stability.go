@@ -0,0 +1,161 @@
+package superplan
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-exec/tfexec"
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"terraform-wrapper/internal/logging"
+)
+
+const stabilityPlanFileName = "superplan-verify.tfplan"
+
+// planDifference describes a resource whose planned change differed between
+// two consecutive plans of unchanged configuration and state.
+type planDifference struct {
+	Address    string   `json:"address"`
+	Stack      string   `json:"stack,omitempty"`
+	Reason     string   `json:"reason"`
+	Attributes []string `json:"attributes,omitempty"`
+}
+
+// UnstableError reports stacks whose plans are not reproducible.
+type UnstableError struct {
+	Stacks []string
+}
+
+func (e *UnstableError) Error() string {
+	return fmt.Sprintf("plan is not stable for %d stacks: %v", len(e.Stacks), e.Stacks)
+}
+
+// comparePlans returns the resource changes that differ between first and
+// second, sorted by address.
+func comparePlans(first, second *tfjson.Plan, prefixToStack map[string]string) []planDifference {
+	a := indexResourceChanges(first)
+	b := indexResourceChanges(second)
+
+	addresses := make(map[string]struct{}, len(a)+len(b))
+	for addr := range a {
+		addresses[addr] = struct{}{}
+	}
+	for addr := range b {
+		addresses[addr] = struct{}{}
+	}
+
+	var diffs []planDifference
+	for addr := range addresses {
+		diff := planDifference{Address: addr, Stack: identifyStackFromAddress(addr, prefixToStack)}
+		rcA, inA := a[addr]
+		rcB, inB := b[addr]
+		switch {
+		case !inB:
+			diff.Reason = "only in first plan"
+		case !inA:
+			diff.Reason = "only in second plan"
+		case !reflect.DeepEqual(rcA.Actions, rcB.Actions):
+			diff.Reason = fmt.Sprintf("actions changed from %v to %v", rcA.Actions, rcB.Actions)
+		default:
+			if reflect.DeepEqual(rcA.After, rcB.After) && reflect.DeepEqual(rcA.AfterUnknown, rcB.AfterUnknown) {
+				continue
+			}
+			attrs := differingAttributes(rcA.After, rcB.After)
+			attrs = append(attrs, differingAttributes(rcA.AfterUnknown, rcB.AfterUnknown)...)
+			diff.Reason = "planned values differ"
+			diff.Attributes = uniqueSortedStrings(attrs)
+		}
+		diffs = append(diffs, diff)
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Address < diffs[j].Address })
+	return diffs
+}
+
+func indexResourceChanges(plan *tfjson.Plan) map[string]*tfjson.Change {
+	out := make(map[string]*tfjson.Change)
+	if plan == nil {
+		return out
+	}
+	for _, rc := range plan.ResourceChanges {
+		if rc == nil || rc.Change == nil || rc.Change.Actions.NoOp() {
+			continue
+		}
+		out[rc.Address] = rc.Change
+	}
+	return out
+}
+
+// differingAttributes lists the top-level keys whose values differ when both
+// values are objects.
+func differingAttributes(a, b interface{}) []string {
+	mapA, okA := a.(map[string]interface{})
+	mapB, okB := b.(map[string]interface{})
+	if !okA || !okB {
+		return nil
+	}
+	var keys []string
+	for k, v := range mapA {
+		if !reflect.DeepEqual(v, mapB[k]) {
+			keys = append(keys, k)
+		}
+	}
+	for k := range mapB {
+		if _, ok := mapA[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func unstableStacks(diffs []planDifference) []string {
+	var stacks []string
+	for _, d := range diffs {
+		stack := d.Stack
+		if stack == "" {
+			stack = d.Address
+		}
+		stacks = append(stacks, stack)
+	}
+	return uniqueSortedStrings(stacks)
+}
+
+// verifyStablePlan plans the unified configuration a second time without any
+// changes in between and compares the result with first.
+func verifyStablePlan(ctx context.Context, tf *tfexec.Terraform, dir string, first *tfjson.Plan, prefixToStack map[string]string) ([]planDifference, error) {
+	if _, err := tf.Plan(ctx, tfexec.Out(stabilityPlanFileName), tfexec.Refresh(false)); err != nil {
+		return nil, fmt.Errorf("terraform plan failed during stability check: %w", err)
+	}
+	second, err := tf.ShowPlanFile(ctx, filepath.Join(dir, stabilityPlanFileName))
+	if err != nil {
+		return nil, fmt.Errorf("terraform show plan failed during stability check: %w", err)
+	}
+	diffs := comparePlans(first, second, prefixToStack)
+	if len(diffs) == 0 {
+		logging.Infof("[✓] Plan is stable across two consecutive runs")
+	}
+	return diffs, nil
+}
+
+// reportInstability prints and records the differing resources and returns an
+// *UnstableError naming the affected stacks.
+func reportInstability(summaryDir string, generatedAt time.Time, diffs []planDifference) error {
+	logging.Warnf("[!] Plan differs between two consecutive runs for %d resources:", len(diffs))
+	for _, d := range diffs {
+		line := fmt.Sprintf("  %s: %s", d.Address, d.Reason)
+		if len(d.Attributes) > 0 {
+			line += fmt.Sprintf(" (%s)", strings.Join(d.Attributes, ", "))
+		}
+		logging.Warnf("%s", line)
+	}
+	path := filepath.Join(summaryDir, fmt.Sprintf("%s-stability.json", generatedAt.Format("2006-01-02T15-04Z")))
+	if err := writeJSON(path, diffs); err != nil {
+		return fmt.Errorf("write stability report: %w", err)
+	}
+	logging.Infof("Stability report written to: %s", path)
+	return &UnstableError{Stacks: unstableStacks(diffs)}
+}
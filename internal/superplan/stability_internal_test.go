@@ -0,0 +1,44 @@
+package superplan
+
+import (
+	"reflect"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+func TestComparePlansReportsUnstableResources(t *testing.T) {
+	create := tfjson.Actions{tfjson.ActionCreate}
+	first := &tfjson.Plan{
+		ResourceChanges: []*tfjson.ResourceChange{
+			{Address: "aws_vpc.network_main", Change: &tfjson.Change{Actions: create, After: map[string]interface{}{"cidr_block": "10.0.0.0/16"}}},
+			{Address: "aws_ssm_parameter.ecs_deployed_at", Change: &tfjson.Change{Actions: create, After: map[string]interface{}{"name": "deployed", "value": "2024-01-01T00:00:00Z"}}},
+			{Address: "aws_s3_bucket.network_logs", Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionNoop}}},
+		},
+	}
+	second := &tfjson.Plan{
+		ResourceChanges: []*tfjson.ResourceChange{
+			{Address: "aws_vpc.network_main", Change: &tfjson.Change{Actions: create, After: map[string]interface{}{"cidr_block": "10.0.0.0/16"}}},
+			{Address: "aws_ssm_parameter.ecs_deployed_at", Change: &tfjson.Change{Actions: create, After: map[string]interface{}{"name": "deployed", "value": "2024-01-01T00:00:05Z"}}},
+			{Address: "aws_s3_bucket.network_logs", Change: &tfjson.Change{Actions: tfjson.Actions{tfjson.ActionNoop}}},
+			{Address: "random_id.ecs_suffix", Change: &tfjson.Change{Actions: create}},
+		},
+	}
+	prefixes := map[string]string{"network": "core/network", "ecs": "core/ecs"}
+
+	got := comparePlans(first, second, prefixes)
+	want := []planDifference{
+		{Address: "aws_ssm_parameter.ecs_deployed_at", Stack: "core/ecs", Reason: "planned values differ", Attributes: []string{"value"}},
+		{Address: "random_id.ecs_suffix", Stack: "core/ecs", Reason: "only in second plan"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected differences:\n got %#v\nwant %#v", got, want)
+	}
+	if stacks := unstableStacks(got); !reflect.DeepEqual(stacks, []string{"core/ecs"}) {
+		t.Fatalf("unexpected unstable stacks: %v", stacks)
+	}
+
+	if diffs := comparePlans(first, first, prefixes); len(diffs) != 0 {
+		t.Fatalf("expected identical plans to be stable, got %#v", diffs)
+	}
+}
@@ -0,0 +1,112 @@
+package superplan
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+)
+
+// State conflict strategies decide what Run does when stacks' states were
+// written with different state format or Terraform versions.
+const (
+	// StateConflictWarn prints a warning and merges with the highest format
+	// version and the first stack's Terraform version.
+	StateConflictWarn = "warn"
+	// StateConflictFail refuses to merge the states.
+	StateConflictFail = "fail"
+	// StateConflictNormalize merges with the highest format and Terraform
+	// versions without warning.
+	StateConflictNormalize = "normalize"
+)
+
+// ValidateStateConflictStrategy reports whether strategy is supported.
+func ValidateStateConflictStrategy(strategy string) error {
+	switch strategy {
+	case StateConflictWarn, StateConflictFail, StateConflictNormalize:
+		return nil
+	}
+	return fmt.Errorf("unknown state conflict strategy %q: expected %s, %s or %s", strategy, StateConflictWarn, StateConflictFail, StateConflictNormalize)
+}
+
+// stateVersion is a stack's row in the state version matrix recorded in the
+// summary.
+type stateVersion struct {
+	Stack            string `json:"stack"`
+	Version          int    `json:"version"`
+	TerraformVersion string `json:"terraform_version,omitempty"`
+	Serial           int    `json:"serial"`
+}
+
+// mergedStateVersion is the header of the merged state.
+type mergedStateVersion struct {
+	Version          int
+	TerraformVersion string
+	// Serial is the highest serial of any stack, so the merged state is
+	// never older than one of its parts.
+	Serial int
+}
+
+// resolveStateVersions picks the merged state's header from the stacks' rows,
+// in dependency order, and returns the warnings to print. With
+// StateConflictFail any difference is an error.
+func resolveStateVersions(rows []stateVersion, strategy string) (mergedStateVersion, []string, error) {
+	var merged mergedStateVersion
+	var formatDiffers, tfDiffers []string
+	for i, row := range rows {
+		if row.Serial > merged.Serial {
+			merged.Serial = row.Serial
+		}
+		if i == 0 {
+			merged.Version = row.Version
+			merged.TerraformVersion = row.TerraformVersion
+			continue
+		}
+		base := rows[0]
+		if row.Version != base.Version {
+			formatDiffers = append(formatDiffers, fmt.Sprintf("%s state version %d differs from base %d", row.Stack, row.Version, base.Version))
+			if row.Version > merged.Version {
+				merged.Version = row.Version
+			}
+		}
+		if row.TerraformVersion != "" && base.TerraformVersion != "" && row.TerraformVersion != base.TerraformVersion {
+			tfDiffers = append(tfDiffers, fmt.Sprintf("%s Terraform version %s differs from base %s", row.Stack, row.TerraformVersion, base.TerraformVersion))
+		}
+		if strategy == StateConflictNormalize && newerVersion(row.TerraformVersion, merged.TerraformVersion) {
+			merged.TerraformVersion = row.TerraformVersion
+		}
+	}
+
+	conflicts := append(formatDiffers, tfDiffers...)
+	switch strategy {
+	case StateConflictFail:
+		if len(conflicts) > 0 {
+			return merged, nil, fmt.Errorf("stack states disagree (state conflict strategy %q): %s", strategy, strings.Join(conflicts, "; "))
+		}
+	case StateConflictNormalize:
+		return merged, nil, nil
+	}
+	return merged, conflicts, nil
+}
+
+// newerVersion reports whether Terraform version a is newer than b. Versions
+// that do not parse are never newer.
+func newerVersion(a, b string) bool {
+	va, err := version.NewVersion(a)
+	if err != nil {
+		return false
+	}
+	vb, err := version.NewVersion(b)
+	if err != nil {
+		return true
+	}
+	return va.GreaterThan(vb)
+}
+
+// sortedStateVersions returns rows sorted by stack for the summary.
+func sortedStateVersions(rows []stateVersion) []stateVersion {
+	out := append([]stateVersion(nil), rows...)
+	sort.Slice(out, func(i, j int) bool { return out[i].Stack < out[j].Stack })
+	return out
+}
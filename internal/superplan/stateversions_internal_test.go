@@ -0,0 +1,55 @@
+package superplan
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveStateVersionsStrategies(t *testing.T) {
+	rows := []stateVersion{
+		{Stack: "network", Version: 4, TerraformVersion: "1.5.7", Serial: 12},
+		{Stack: "app", Version: 4, TerraformVersion: "1.9.8", Serial: 40},
+		{Stack: "db", Version: 4, TerraformVersion: "1.6.0", Serial: 3},
+	}
+
+	merged, warnings, err := resolveStateVersions(rows, StateConflictWarn)
+	if err != nil {
+		t.Fatalf("warn: %v", err)
+	}
+	if want := (mergedStateVersion{Version: 4, TerraformVersion: "1.5.7", Serial: 40}); merged != want {
+		t.Fatalf("warn: merged %+v, want %+v", merged, want)
+	}
+	wantWarnings := []string{
+		"app Terraform version 1.9.8 differs from base 1.5.7",
+		"db Terraform version 1.6.0 differs from base 1.5.7",
+	}
+	if !reflect.DeepEqual(warnings, wantWarnings) {
+		t.Fatalf("warn: warnings %q, want %q", warnings, wantWarnings)
+	}
+
+	merged, warnings, err = resolveStateVersions(rows, StateConflictNormalize)
+	if err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+	if merged.TerraformVersion != "1.9.8" || merged.Serial != 40 || len(warnings) != 0 {
+		t.Fatalf("normalize: merged %+v, warnings %q", merged, warnings)
+	}
+
+	_, _, err = resolveStateVersions(rows, StateConflictFail)
+	if err == nil || !strings.Contains(err.Error(), "app Terraform version 1.9.8 differs from base 1.5.7") {
+		t.Fatalf("fail: expected conflict error, got %v", err)
+	}
+
+	consistent := []stateVersion{
+		{Stack: "network", Version: 4, TerraformVersion: "1.9.8", Serial: 1},
+		{Stack: "app", Version: 4, TerraformVersion: "1.9.8", Serial: 2},
+	}
+	if _, _, err := resolveStateVersions(consistent, StateConflictFail); err != nil {
+		t.Fatalf("fail with consistent states: %v", err)
+	}
+
+	if err := ValidateStateConflictStrategy("ignore"); err == nil {
+		t.Fatalf("expected unknown strategy to be rejected")
+	}
+}
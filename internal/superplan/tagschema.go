@@ -0,0 +1,204 @@
+package superplan
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"terraform-wrapper/internal/logging"
+	"terraform-wrapper/internal/manifest"
+)
+
+// TagAttributes names, per provider type such as aws or google, the
+// attributes holding tags or labels that the superplan ignores changes to.
+type TagAttributes map[string][]string
+
+// DefaultTagAttributes are ignored unless Options.TagAttributes names other
+// attributes for the provider.
+func DefaultTagAttributes() TagAttributes {
+	return TagAttributes{"aws": {"tags", "tags_all"}}
+}
+
+// tagAttributes returns the defaults with overrides applied. An empty list
+// stops changes to a provider's tags being ignored.
+func tagAttributes(overrides TagAttributes) TagAttributes {
+	attrs := DefaultTagAttributes()
+	for provider, names := range overrides {
+		attrs[provider] = names
+	}
+	return attrs
+}
+
+// taggableTypes maps each resource type whose provider schema has any of its
+// provider's tag attributes to those it has. Only they are made to ignore
+// changes: the lifecycle argument fails validation on a resource without the
+// attribute.
+type taggableTypes map[string][]string
+
+func (t taggableTypes) attributes(resourceType string) []string {
+	return t[resourceType]
+}
+
+// taggableCache is a cached taggableTypes of one provider version, valid for
+// the attributes it was read for.
+type taggableCache struct {
+	Attributes []string            `json:"attributes"`
+	Types      map[string][]string `json:"types"`
+}
+
+// schemaReader reads the schemas of an initialised configuration's
+// providers, as terraform providers schema -json does.
+type schemaReader interface {
+	ProvidersSchema(ctx context.Context) (*tfjson.ProviderSchemas, error)
+}
+
+// schemaCacheDir is where the taggable types of each provider version are
+// kept, so the schemas are only read once per version.
+func schemaCacheDir(root string) string {
+	return filepath.Join(root, ".terraform-wrapper", "provider-schemas")
+}
+
+// providerType returns the type of a provider source, such as google for
+// registry.terraform.io/hashicorp/google.
+func providerType(source string) string {
+	return path.Base(source)
+}
+
+// loadTaggableTypes returns the taggable resource types of the providers
+// terraform init locked in dir, for the tag attributes attrs names for each
+// provider. They are read from cacheDir when every locked provider version
+// with tag attributes is cached there for the same attributes, and otherwise
+// from the provider schemas, which are then cached.
+func loadTaggableTypes(ctx context.Context, tf schemaReader, dir, cacheDir string, attrs TagAttributes) (taggableTypes, error) {
+	locked, err := manifest.ForStack(dir, "")
+	if err != nil {
+		return nil, err
+	}
+
+	taggable := make(taggableTypes)
+	var tagged int
+	cached := true
+	for source, version := range locked.Providers {
+		wanted := attrs[providerType(source)]
+		if len(wanted) == 0 {
+			continue
+		}
+		tagged++
+		types, ok, err := readTaggableCache(cacheDir, source, version, wanted)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			cached = false
+			break
+		}
+		for name, names := range types {
+			taggable[name] = names
+		}
+	}
+	if tagged == 0 {
+		return taggable, nil
+	}
+	if cached {
+		logging.Debugf("[i] Using cached provider schemas for %d providers", tagged)
+		return taggable, nil
+	}
+
+	schemas, err := tf.ProvidersSchema(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read provider schemas: %w", err)
+	}
+	taggable = make(taggableTypes)
+	for source, schema := range schemas.Schemas {
+		wanted := attrs[providerType(source)]
+		if len(wanted) == 0 {
+			continue
+		}
+		types := typesWithAttributes(schema, wanted)
+		for name, names := range types {
+			taggable[name] = names
+		}
+		version, ok := locked.Providers[source]
+		if !ok {
+			continue
+		}
+		if err := writeTaggableCache(cacheDir, source, version, wanted, types); err != nil {
+			logging.Warnf("[!] Warning: unable to cache provider schema of %s %s: %v", source, version, err)
+		}
+	}
+	logging.Infof("[✓] Read provider schemas: %d resource types take tags", len(taggable))
+	return taggable, nil
+}
+
+// typesWithAttributes maps the resource types of schema that have any of
+// attrs to those they have, in the order of attrs.
+func typesWithAttributes(schema *tfjson.ProviderSchema, attrs []string) map[string][]string {
+	types := make(map[string][]string)
+	if schema == nil {
+		return types
+	}
+	for name, resource := range schema.ResourceSchemas {
+		if resource == nil || resource.Block == nil {
+			continue
+		}
+		for _, attr := range attrs {
+			if _, ok := resource.Block.Attributes[attr]; ok {
+				types[name] = append(types[name], attr)
+			}
+		}
+	}
+	return types
+}
+
+func taggableCachePath(cacheDir, source, version string) string {
+	return filepath.Join(cacheDir, filepath.FromSlash(source), version+".json")
+}
+
+func readTaggableCache(cacheDir, source, version string, attrs []string) (map[string][]string, bool, error) {
+	data, err := os.ReadFile(taggableCachePath(cacheDir, source, version))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("read cached provider schema: %w", err)
+	}
+	var entry taggableCache
+	if err := json.Unmarshal(data, &entry); err != nil {
+		// A damaged cache entry is rewritten from the schema.
+		return nil, false, nil
+	}
+	if !slices.Equal(entry.Attributes, sortedCopy(attrs)) {
+		return nil, false, nil
+	}
+	return entry.Types, true, nil
+}
+
+func writeTaggableCache(cacheDir, source, version string, attrs []string, types map[string][]string) error {
+	path := taggableCachePath(cacheDir, source, version)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(taggableCache{Attributes: sortedCopy(attrs), Types: types}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func sortedCopy(values []string) []string {
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	return sorted
+}
@@ -0,0 +1,145 @@
+package superplan
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+type fakeSchemaReader struct {
+	schemas *tfjson.ProviderSchemas
+	calls   int
+}
+
+func (f *fakeSchemaReader) ProvidersSchema(ctx context.Context) (*tfjson.ProviderSchemas, error) {
+	f.calls++
+	if f.schemas == nil {
+		return nil, errors.New("schema unavailable")
+	}
+	return f.schemas, nil
+}
+
+func TestLoadTaggableTypesCachesPerProviderVersion(t *testing.T) {
+	dir := t.TempDir()
+	lockFile := `provider "registry.terraform.io/hashicorp/aws" {
+  version = "5.31.0"
+}
+
+provider "registry.terraform.io/hashicorp/google" {
+  version = "6.10.0"
+}
+`
+	if err := os.WriteFile(filepath.Join(dir, ".terraform.lock.hcl"), []byte(lockFile), 0o644); err != nil {
+		t.Fatalf("write lock file: %v", err)
+	}
+	attrs := func(names ...string) *tfjson.Schema {
+		block := &tfjson.SchemaBlock{Attributes: make(map[string]*tfjson.SchemaAttribute)}
+		for _, name := range names {
+			block.Attributes[name] = &tfjson.SchemaAttribute{}
+		}
+		return &tfjson.Schema{Block: block}
+	}
+	reader := &fakeSchemaReader{schemas: &tfjson.ProviderSchemas{
+		Schemas: map[string]*tfjson.ProviderSchema{
+			"registry.terraform.io/hashicorp/aws": {
+				ResourceSchemas: map[string]*tfjson.Schema{
+					"aws_s3_bucket":                  attrs("bucket", "tags", "tags_all"),
+					"aws_vpc":                        attrs("cidr_block", "tags_all"),
+					"aws_iam_role_policy_attachment": attrs("role", "policy_arn"),
+				},
+			},
+			"registry.terraform.io/hashicorp/google": {
+				ResourceSchemas: map[string]*tfjson.Schema{
+					"google_storage_bucket": attrs("name", "labels", "terraform_labels"),
+					"google_project_iam":    attrs("project", "role"),
+				},
+			},
+		},
+	}}
+	cacheDir := filepath.Join(t.TempDir(), "provider-schemas")
+
+	taggable, err := loadTaggableTypes(context.Background(), reader, dir, cacheDir, tagAttributes(nil))
+	if err != nil {
+		t.Fatalf("loadTaggableTypes: %v", err)
+	}
+	want := taggableTypes{
+		"aws_s3_bucket": {"tags", "tags_all"},
+		"aws_vpc":       {"tags_all"},
+	}
+	if !reflect.DeepEqual(taggable, want) {
+		t.Fatalf("unexpected taggable types: %v", taggable)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "registry.terraform.io", "hashicorp", "aws", "5.31.0.json")); err != nil {
+		t.Fatalf("provider schema not cached: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "registry.terraform.io", "hashicorp", "google", "6.10.0.json")); err == nil {
+		t.Fatalf("a provider without tag attributes should not be cached")
+	}
+
+	// The cached version is used without reading the schemas again.
+	reader.schemas, reader.calls = nil, 0
+	cached, err := loadTaggableTypes(context.Background(), reader, dir, cacheDir, tagAttributes(nil))
+	if err != nil {
+		t.Fatalf("loadTaggableTypes from cache: %v", err)
+	}
+	if reader.calls != 0 {
+		t.Fatalf("expected the cached schemas to be used, got %d reads", reader.calls)
+	}
+	if !reflect.DeepEqual(cached, want) {
+		t.Fatalf("unexpected cached taggable types: %v", cached)
+	}
+
+	// Other attributes, or another provider's, need the schemas again.
+	labels := TagAttributes{"google": {"labels", "terraform_labels"}}
+	if _, err := loadTaggableTypes(context.Background(), reader, dir, cacheDir, tagAttributes(labels)); err == nil {
+		t.Fatalf("expected the schemas to be read for newly configured attributes")
+	}
+
+	// A new provider version is not in the cache.
+	if err := os.WriteFile(filepath.Join(dir, ".terraform.lock.hcl"), []byte(`provider "registry.terraform.io/hashicorp/aws" {
+  version = "5.32.0"
+}
+`), 0o644); err != nil {
+		t.Fatalf("write lock file: %v", err)
+	}
+	if _, err := loadTaggableTypes(context.Background(), reader, dir, cacheDir, tagAttributes(nil)); err == nil {
+		t.Fatalf("expected the schemas to be read for an uncached provider version")
+	}
+}
+
+func TestLoadTaggableTypesForConfiguredProviders(t *testing.T) {
+	dir := t.TempDir()
+	lockFile := `provider "registry.terraform.io/hashicorp/aws" {
+  version = "5.31.0"
+}
+
+provider "registry.terraform.io/hashicorp/azurerm" {
+  version = "4.8.0"
+}
+`
+	if err := os.WriteFile(filepath.Join(dir, ".terraform.lock.hcl"), []byte(lockFile), 0o644); err != nil {
+		t.Fatalf("write lock file: %v", err)
+	}
+	tagged := &tfjson.Schema{Block: &tfjson.SchemaBlock{Attributes: map[string]*tfjson.SchemaAttribute{"tags": {}}}}
+	reader := &fakeSchemaReader{schemas: &tfjson.ProviderSchemas{
+		Schemas: map[string]*tfjson.ProviderSchema{
+			"registry.terraform.io/hashicorp/aws":     {ResourceSchemas: map[string]*tfjson.Schema{"aws_s3_bucket": tagged}},
+			"registry.terraform.io/hashicorp/azurerm": {ResourceSchemas: map[string]*tfjson.Schema{"azurerm_resource_group": tagged}},
+		},
+	}}
+
+	// An empty list turns the aws default off.
+	attrs := tagAttributes(TagAttributes{"aws": {}, "azurerm": {"tags"}})
+	taggable, err := loadTaggableTypes(context.Background(), reader, dir, t.TempDir(), attrs)
+	if err != nil {
+		t.Fatalf("loadTaggableTypes: %v", err)
+	}
+	if want := (taggableTypes{"azurerm_resource_group": {"tags"}}); !reflect.DeepEqual(taggable, want) {
+		t.Fatalf("unexpected taggable types: %v", taggable)
+	}
+}
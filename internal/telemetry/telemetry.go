@@ -0,0 +1,139 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"terraform-wrapper/internal/lock"
+	"terraform-wrapper/internal/triage"
+)
+
+// EndpointEnv opts in to telemetry by naming the endpoint events are posted to.
+const EndpointEnv = "TFWRAPPER_TELEMETRY_ENDPOINT"
+
+const defaultTimeout = 2 * time.Second
+
+// Event is the anonymous usage record sent for each command. It deliberately
+// carries no environment, account, stack or flag values.
+type Event struct {
+	InstallationID  string   `json:"installation_id"`
+	Version         string   `json:"version"`
+	Command         string   `json:"command"`
+	Flags           []string `json:"flags,omitempty"`
+	OS              string   `json:"os"`
+	Arch            string   `json:"arch"`
+	DurationSeconds float64  `json:"duration_seconds"`
+	Stacks          int      `json:"stacks"`
+	FailedStacks    int      `json:"failed_stacks"`
+	ErrorClass      string   `json:"error_class,omitempty"`
+}
+
+// Client posts events to Endpoint.
+type Client struct {
+	Endpoint   string
+	HTTPClient *http.Client
+}
+
+// FromEnv returns a client when telemetry is enabled, or nil otherwise.
+func FromEnv() *Client {
+	endpoint := strings.TrimSpace(os.Getenv(EndpointEnv))
+	if endpoint == "" {
+		return nil
+	}
+	return &Client{Endpoint: endpoint}
+}
+
+// Send posts event as JSON.
+func (c *Client) Send(ctx context.Context, event Event) (err error) {
+	if c == nil {
+		return nil
+	}
+	if event.OS == "" {
+		event.OS = runtime.GOOS
+	}
+	if event.Arch == "" {
+		event.Arch = runtime.GOARCH
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("send telemetry: %w", err)
+	}
+	defer func() {
+		if cerr := resp.Body.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("close telemetry response: %w", cerr)
+		}
+	}()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("send telemetry: unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// ErrorClass buckets a command error without exposing its message.
+func ErrorClass(err error) string {
+	var locked *lock.LockedError
+	var frozen *lock.FrozenError
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &frozen):
+		return "frozen"
+	case errors.As(err, &locked):
+		return "locked"
+	default:
+		return triage.Classify(err)
+	}
+}
+
+// InstallationID returns a random identifier persisted under the user config
+// directory so events from one machine can be grouped without identifying it.
+func InstallationID() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	path := filepath.Join(dir, "terraform-wrapper", "telemetry-id")
+	if data, err := os.ReadFile(path); err == nil {
+		if id := strings.TrimSpace(string(data)); id != "" {
+			return id
+		}
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	id := hex.EncodeToString(buf)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err == nil {
+		_ = os.WriteFile(path, []byte(id+"\n"), 0o644)
+	}
+	return id
+}
@@ -0,0 +1,83 @@
+package telemetry_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/lock"
+	"terraform-wrapper/internal/telemetry"
+	"terraform-wrapper/internal/triage"
+)
+
+func TestSendPostsEvent(t *testing.T) {
+	var received telemetry.Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	client := &telemetry.Client{Endpoint: server.URL}
+	err := client.Send(context.Background(), telemetry.Event{
+		Command:      "apply-all",
+		Flags:        []string{"idempotency-key"},
+		Stacks:       4,
+		FailedStacks: 1,
+		ErrorClass:   triage.ClassError,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "apply-all", received.Command)
+	require.Equal(t, 4, received.Stacks)
+	require.NotEmpty(t, received.OS)
+	require.NotEmpty(t, received.Arch)
+}
+
+func TestSendReportsServerErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := &telemetry.Client{Endpoint: server.URL}
+	require.Error(t, client.Send(context.Background(), telemetry.Event{Command: "plan"}))
+
+	var disabled *telemetry.Client
+	require.NoError(t, disabled.Send(context.Background(), telemetry.Event{Command: "plan"}))
+}
+
+func TestFromEnvIsOptIn(t *testing.T) {
+	t.Setenv(telemetry.EndpointEnv, "")
+	require.Nil(t, telemetry.FromEnv())
+
+	t.Setenv(telemetry.EndpointEnv, "https://telemetry.example.com/events")
+	client := telemetry.FromEnv()
+	require.NotNil(t, client)
+	require.Equal(t, "https://telemetry.example.com/events", client.Endpoint)
+}
+
+func TestErrorClass(t *testing.T) {
+	require.Empty(t, telemetry.ErrorClass(nil))
+	require.Equal(t, "locked", telemetry.ErrorClass(fmt.Errorf("wrap: %w", &lock.LockedError{Env: "dev"})))
+	require.Equal(t, "frozen", telemetry.ErrorClass(&lock.FrozenError{Freeze: &lock.Freeze{Env: "prod", Until: time.Now()}}))
+	require.Equal(t, triage.ClassCancelled, telemetry.ErrorClass(context.Canceled))
+	require.Equal(t, triage.ClassError, telemetry.ErrorClass(errors.New("boom")))
+}
+
+func TestInstallationIDIsStable(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	first := telemetry.InstallationID()
+	require.Len(t, first, 32)
+	require.Equal(t, first, telemetry.InstallationID())
+}
@@ -0,0 +1,33 @@
+// Package tenant namespaces what the wrapper keeps for itself -- plan caches,
+// orchestration locks, run history, logs and artifacts -- by team, so teams
+// sharing one repository and one install do not collide on local or S3 paths.
+package tenant
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+)
+
+// Dir is the path segment under which tenant-scoped data is kept.
+const Dir = "tenants"
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Validate rejects tenant names that cannot form a path or S3 key segment.
+func Validate(name string) error {
+	if name != "" && !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid tenant %q: only letters, digits, '-' and '_' are allowed", name)
+	}
+	return nil
+}
+
+// Scope returns the environment segment of the wrapper's own paths and keys:
+// env itself without a tenant, and tenants/<tenant>/<env> with one. It is
+// slash-separated; filepath.Join converts it for local paths.
+func Scope(name, env string) string {
+	if name == "" {
+		return env
+	}
+	return path.Join(Dir, name, env)
+}
@@ -0,0 +1,25 @@
+package tenant_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/tenant"
+)
+
+func TestScope(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "prod", tenant.Scope("", "prod"))
+	require.Equal(t, "tenants/payments/prod", tenant.Scope("payments", "prod"))
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, tenant.Validate(""))
+	require.NoError(t, tenant.Validate("team-payments_2"))
+	require.Error(t, tenant.Validate("../other"))
+	require.Error(t, tenant.Validate("a/b"))
+}
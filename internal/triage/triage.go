@@ -0,0 +1,231 @@
+package triage
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Error classes reported for failed stacks.
+const (
+	ClassCrash     = "terraform_crash"
+	ClassCancelled = "cancelled"
+	ClassTimeout   = "timeout"
+	ClassError     = "terraform_error"
+)
+
+// CrashError marks a stack failure caused by a Terraform panic rather than a
+// configuration or provider error.
+type CrashError struct {
+	Err       error
+	CrashLogs []string
+}
+
+func (e *CrashError) Error() string {
+	return fmt.Sprintf("terraform crashed (see %s): %v", strings.Join(e.CrashLogs, ", "), e.Err)
+}
+
+func (e *CrashError) Unwrap() error {
+	return e.Err
+}
+
+// Classify returns the error class for a stack failure.
+func Classify(err error) string {
+	var crash *CrashError
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &crash):
+		return ClassCrash
+	case errors.Is(err, context.Canceled):
+		return ClassCancelled
+	case errors.Is(err, context.DeadlineExceeded):
+		return ClassTimeout
+	default:
+		return ClassError
+	}
+}
+
+// Inspect wraps err in a CrashError when Terraform left crash logs in stackDir
+// at or after since. Stale crash logs from earlier runs are ignored.
+func Inspect(stackDir string, since time.Time, err error) error {
+	if err == nil {
+		return nil
+	}
+	logs := CrashLogs(stackDir, since)
+	if len(logs) == 0 {
+		return err
+	}
+	return &CrashError{Err: err, CrashLogs: logs}
+}
+
+// CrashLogs lists crash.log files written by Terraform in stackDir since the given time.
+func CrashLogs(stackDir string, since time.Time) []string {
+	candidates, _ := filepath.Glob(filepath.Join(stackDir, "crash*.log"))
+	var logs []string
+	for _, path := range candidates {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if !since.IsZero() && info.ModTime().Before(since) {
+			continue
+		}
+		logs = append(logs, path)
+	}
+	sort.Strings(logs)
+	return logs
+}
+
+type bundleEntry struct {
+	Stack      string   `json:"stack"`
+	ErrorClass string   `json:"error_class"`
+	Error      string   `json:"error"`
+	CrashLogs  []string `json:"crash_logs,omitempty"`
+	// TerraformLog is the stack's gzipped --tf-log capture.
+	TerraformLog string `json:"terraform_log,omitempty"`
+}
+
+type bundleManifest struct {
+	GeneratedAt time.Time     `json:"generated_at"`
+	Environment string        `json:"environment"`
+	Operation   string        `json:"operation"`
+	Failures    []bundleEntry `json:"failures"`
+}
+
+// BundleDir returns the directory holding failure bundles for an environment.
+func BundleDir(root, env string) string {
+	return filepath.Join(root, ".terraform-wrapper", "failures", env)
+}
+
+// LogDir returns the directory holding the Terraform logs captured with
+// --tf-log and the stack logs written with --stack-logs for an environment,
+// one subdirectory per run.
+func LogDir(root, env string) string {
+	return filepath.Join(root, ".terraform-wrapper", "logs", env)
+}
+
+// NewRunLogDir returns a new directory for the logs of a run starting now,
+// so runs never overwrite or remove each other's logs.
+func NewRunLogDir(root, env string, now time.Time) string {
+	return filepath.Join(LogDir(root, env), fmt.Sprintf("%s-%d", now.UTC().Format("2006-01-02T15-04-05Z"), os.Getpid()))
+}
+
+// LogPath returns the Terraform log file of a stack in the run log directory
+// dir. It sits beside the stack's wrapper log, <stack>.log.
+func LogPath(dir, stack string) string {
+	return filepath.Join(dir, filepath.FromSlash(stack)+".terraform.log")
+}
+
+// WriteBundle records failed stacks, their error classes, and any crash logs
+// and the Terraform logs captured in the run log directory logDir in a new
+// bundle directory, returning its path.
+func WriteBundle(root, env, operation, logDir string, failures map[string]error) (string, error) {
+	if len(failures) == 0 {
+		return "", nil
+	}
+
+	now := time.Now().UTC()
+	dir := filepath.Join(BundleDir(root, env), fmt.Sprintf("%s-%s", now.Format("2006-01-02T15-04-05Z"), operation))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("create failure bundle: %w", err)
+	}
+
+	stacks := make([]string, 0, len(failures))
+	for stack := range failures {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+
+	manifest := bundleManifest{GeneratedAt: now, Environment: env, Operation: operation}
+	for _, stack := range stacks {
+		err := failures[stack]
+		entry := bundleEntry{Stack: stack, ErrorClass: Classify(err), Error: err.Error()}
+
+		var crash *CrashError
+		if errors.As(err, &crash) {
+			for _, src := range crash.CrashLogs {
+				dest := filepath.Join(dir, filepath.FromSlash(stack), filepath.Base(src))
+				if err := copyFile(src, dest); err != nil {
+					return dir, fmt.Errorf("collect crash log for %s: %w", stack, err)
+				}
+				rel, _ := filepath.Rel(dir, dest)
+				entry.CrashLogs = append(entry.CrashLogs, filepath.ToSlash(rel))
+			}
+		}
+		logPath := LogPath(logDir, stack)
+		if _, err := os.Stat(logPath); logDir != "" && err == nil {
+			dest := filepath.Join(dir, filepath.FromSlash(stack), "terraform.log.gz")
+			if err := gzipFile(logPath, dest); err != nil {
+				return dir, fmt.Errorf("collect terraform log for %s: %w", stack, err)
+			}
+			rel, _ := filepath.Rel(dir, dest)
+			entry.TerraformLog = filepath.ToSlash(rel)
+		}
+		manifest.Failures = append(manifest.Failures, entry)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return dir, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "failures.json"), data, 0o644); err != nil {
+		return dir, fmt.Errorf("write failure manifest: %w", err)
+	}
+	return dir, nil
+}
+
+func copyFile(src, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func gzipFile(src, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
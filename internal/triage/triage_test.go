@@ -0,0 +1,135 @@
+package triage_test
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/triage"
+)
+
+func TestInspectDetectsCrashLog(t *testing.T) {
+	t.Parallel()
+
+	stackDir := t.TempDir()
+	baseErr := errors.New("exit status 11")
+
+	require.Equal(t, baseErr, triage.Inspect(stackDir, time.Now(), baseErr))
+
+	crashLog := filepath.Join(stackDir, "crash.log")
+	require.NoError(t, os.WriteFile(crashLog, []byte("panic: runtime error"), 0o644))
+
+	err := triage.Inspect(stackDir, time.Now().Add(-time.Minute), baseErr)
+	var crash *triage.CrashError
+	require.ErrorAs(t, err, &crash)
+	require.Equal(t, []string{crashLog}, crash.CrashLogs)
+	require.ErrorIs(t, err, baseErr)
+	require.Equal(t, triage.ClassCrash, triage.Classify(err))
+}
+
+func TestInspectIgnoresStaleCrashLog(t *testing.T) {
+	t.Parallel()
+
+	stackDir := t.TempDir()
+	crashLog := filepath.Join(stackDir, "crash.log")
+	require.NoError(t, os.WriteFile(crashLog, []byte("old panic"), 0o644))
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(crashLog, old, old))
+
+	err := triage.Inspect(stackDir, time.Now().Add(-time.Minute), errors.New("boom"))
+	require.Equal(t, triage.ClassError, triage.Classify(err))
+}
+
+func TestClassify(t *testing.T) {
+	t.Parallel()
+
+	require.Empty(t, triage.Classify(nil))
+	require.Equal(t, triage.ClassCancelled, triage.Classify(context.Canceled))
+	require.Equal(t, triage.ClassTimeout, triage.Classify(fmt.Errorf("plan: %w", context.DeadlineExceeded)))
+	require.Equal(t, triage.ClassError, triage.Classify(errors.New("invalid reference")))
+}
+
+func TestWriteBundleCollectsCrashLogs(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	stackDir := filepath.Join(root, "core-services", "network")
+	require.NoError(t, os.MkdirAll(stackDir, 0o755))
+	crashLog := filepath.Join(stackDir, "crash.log")
+	require.NoError(t, os.WriteFile(crashLog, []byte("panic"), 0o644))
+
+	failures := map[string]error{
+		"core-services/network": &triage.CrashError{Err: errors.New("exit status 2"), CrashLogs: []string{crashLog}},
+		"applications/frontend": errors.New("invalid value"),
+	}
+
+	dir, err := triage.WriteBundle(root, "dev", "apply-all", "", failures)
+	require.NoError(t, err)
+	require.FileExists(t, filepath.Join(dir, "core-services", "network", "crash.log"))
+
+	data, err := os.ReadFile(filepath.Join(dir, "failures.json"))
+	require.NoError(t, err)
+
+	var manifest struct {
+		Operation string `json:"operation"`
+		Failures  []struct {
+			Stack      string   `json:"stack"`
+			ErrorClass string   `json:"error_class"`
+			CrashLogs  []string `json:"crash_logs"`
+		} `json:"failures"`
+	}
+	require.NoError(t, json.Unmarshal(data, &manifest))
+	require.Equal(t, "apply-all", manifest.Operation)
+	require.Len(t, manifest.Failures, 2)
+	require.Equal(t, "applications/frontend", manifest.Failures[0].Stack)
+	require.Equal(t, triage.ClassError, manifest.Failures[0].ErrorClass)
+	require.Equal(t, triage.ClassCrash, manifest.Failures[1].ErrorClass)
+	require.Equal(t, []string{"core-services/network/crash.log"}, manifest.Failures[1].CrashLogs)
+}
+
+func TestWriteBundleCompressesTerraformLogs(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	logDir := triage.NewRunLogDir(root, "dev", time.Now())
+	logPath := triage.LogPath(logDir, "core-services/network")
+	require.NoError(t, os.MkdirAll(filepath.Dir(logPath), 0o755))
+	require.NoError(t, os.WriteFile(logPath, []byte("[TRACE] provider: starting"), 0o644))
+
+	failures := map[string]error{
+		"core-services/network": errors.New("exit status 1"),
+		"applications/frontend": errors.New("invalid value"),
+	}
+	dir, err := triage.WriteBundle(root, "dev", "plan-all", logDir, failures)
+	require.NoError(t, err)
+
+	f, err := os.Open(filepath.Join(dir, "core-services", "network", "terraform.log.gz"))
+	require.NoError(t, err)
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	content, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	require.Equal(t, "[TRACE] provider: starting", string(content))
+
+	data, err := os.ReadFile(filepath.Join(dir, "failures.json"))
+	require.NoError(t, err)
+	var manifest struct {
+		Failures []struct {
+			Stack        string `json:"stack"`
+			TerraformLog string `json:"terraform_log"`
+		} `json:"failures"`
+	}
+	require.NoError(t, json.Unmarshal(data, &manifest))
+	require.Empty(t, manifest.Failures[0].TerraformLog)
+	require.Equal(t, "core-services/network/terraform.log.gz", manifest.Failures[1].TerraformLog)
+}
@@ -0,0 +1,152 @@
+package versioning
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-version"
+)
+
+// lastUsedFile is touched in a version's cache directory whenever the
+// version is resolved, so versions can be pruned by when they were last run
+// rather than when they were installed.
+const lastUsedFile = ".last-used"
+
+// CachedVersion is a version installed in the version cache.
+type CachedVersion struct {
+	Engine  Engine
+	Version *version.Version
+	// Dir is the version's cache directory and Size the bytes under it.
+	Dir  string
+	Size int64
+	// LastUsed is when the version was last resolved, or installed if it
+	// never was.
+	LastUsed time.Time
+}
+
+// ListCached lists the versions of every engine in the version cache, by
+// engine and then version.
+func ListCached() ([]CachedVersion, error) {
+	root, err := cacheRoot()
+	if err != nil {
+		return nil, err
+	}
+	var cached []CachedVersion
+	for _, engine := range []Engine{EngineTerraform, EngineTofu} {
+		dir := root
+		if engine == EngineTofu {
+			dir = filepath.Join(root, string(EngineTofu))
+		}
+		entries, err := os.ReadDir(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read version cache %s: %w", dir, err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			v, err := version.NewVersion(entry.Name())
+			if err != nil {
+				continue
+			}
+			versionDir := filepath.Join(dir, entry.Name())
+			binary, err := os.Stat(filepath.Join(versionDir, engine.BinaryName()))
+			if err != nil {
+				// An interrupted install left no binary behind.
+				continue
+			}
+			c := CachedVersion{Engine: engine, Version: v, Dir: versionDir, LastUsed: binary.ModTime()}
+			if marker, err := os.Stat(filepath.Join(versionDir, lastUsedFile)); err == nil {
+				c.LastUsed = marker.ModTime()
+			}
+			if c.Size, err = dirSize(versionDir); err != nil {
+				return nil, err
+			}
+			cached = append(cached, c)
+		}
+	}
+	sort.Slice(cached, func(i, j int) bool {
+		if cached[i].Engine != cached[j].Engine {
+			return cached[i].Engine < cached[j].Engine
+		}
+		return cached[i].Version.LessThan(cached[j].Version)
+	})
+	return cached, nil
+}
+
+// RemoveCached deletes c from the version cache.
+func RemoveCached(c CachedVersion) error {
+	if err := os.RemoveAll(c.Dir); err != nil {
+		return fmt.Errorf("remove %s %s: %w", c.Engine.Name(), c.Version, err)
+	}
+	return nil
+}
+
+// Install installs version v of engine into the version cache unless it is
+// already there, downloading it from mirror when one is set, and returns the
+// path of its binary.
+func Install(ctx context.Context, engine Engine, mirror string, v *version.Version) (string, error) {
+	path, err := ensureVersionInstalled(ctx, engine, mirror, v)
+	if err != nil {
+		return "", err
+	}
+	markUsed(path)
+	return path, nil
+}
+
+// Pins reports whether the lock file selects cached version c.
+func (l *LockFile) Pins(c CachedVersion) bool {
+	if l == nil || l.UsedSystemBinary || l.engine() != c.Engine.orDefault() {
+		return false
+	}
+	v, err := version.NewVersion(l.Version)
+	return err == nil && v.Equal(c.Version)
+}
+
+// markUsed records that the cached binary at binaryPath was resolved. Paths
+// outside the version cache, such as system binaries, are ignored, as are
+// failures: the marker only informs pruning.
+func markUsed(binaryPath string) {
+	root, err := cacheRoot()
+	if err != nil {
+		return
+	}
+	dir := filepath.Dir(binaryPath)
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return
+	}
+	_ = os.WriteFile(filepath.Join(dir, lastUsedFile), nil, 0o644)
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("measure %s: %w", dir, err)
+	}
+	return size, nil
+}
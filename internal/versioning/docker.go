@@ -0,0 +1,26 @@
+package versioning
+
+import (
+	"strings"
+
+	"github.com/hashicorp/go-version"
+)
+
+// DockerImage returns image tagged with the resolved Terraform version. Images
+// that already carry a tag or digest are returned unchanged.
+func DockerImage(image string, v *version.Version) string {
+	if image == "" || v == nil {
+		return image
+	}
+	if strings.Contains(image, "@") {
+		return image
+	}
+	name := image
+	if i := strings.LastIndex(image, "/"); i >= 0 {
+		name = image[i+1:]
+	}
+	if strings.Contains(name, ":") {
+		return image
+	}
+	return image + ":" + v.String()
+}
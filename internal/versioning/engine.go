@@ -0,0 +1,215 @@
+package versioning
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-version"
+	"github.com/hashicorp/hc-install/product"
+)
+
+// Engine is the product stacks are run with: HashiCorp Terraform or
+// OpenTofu. Both read the same required_version constraints.
+type Engine string
+
+const (
+	EngineTerraform Engine = "terraform"
+	EngineTofu      Engine = "tofu"
+)
+
+var (
+	tofuReleasesIndex = "https://get.opentofu.org/tofu/api.json"
+	tofuDownloadURL   = "https://github.com/opentofu/opentofu/releases/download"
+
+	// downloadClient fetches release archives, which take longer than the
+	// release indexes.
+	downloadClient = &http.Client{Timeout: 10 * time.Minute}
+
+	tofuVersionPattern = regexp.MustCompile(`^OpenTofu\s+v?([0-9A-Za-z\.\-\+]+)`)
+)
+
+// ParseEngine returns the engine called name: terraform, or tofu (also
+// opentofu). An empty name is terraform.
+func ParseEngine(name string) (Engine, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "terraform":
+		return EngineTerraform, nil
+	case "tofu", "opentofu":
+		return EngineTofu, nil
+	}
+	return "", fmt.Errorf("unknown engine %q: expected terraform or tofu", name)
+}
+
+func (e Engine) orDefault() Engine {
+	if e == "" {
+		return EngineTerraform
+	}
+	return e
+}
+
+// Name is the product name shown in messages.
+func (e Engine) Name() string {
+	if e.orDefault() == EngineTofu {
+		return "OpenTofu"
+	}
+	return "Terraform"
+}
+
+// BinaryName is the name of the engine's executable.
+func (e Engine) BinaryName() string {
+	if e.orDefault() == EngineTofu {
+		if runtime.GOOS == "windows" {
+			return "tofu.exe"
+		}
+		return "tofu"
+	}
+	return product.Terraform.BinaryName()
+}
+
+func (e Engine) versionPattern() *regexp.Regexp {
+	if e.orDefault() == EngineTofu {
+		return tofuVersionPattern
+	}
+	return tfVersionPattern
+}
+
+// tofuRelease is an entry of the OpenTofu release index.
+type tofuRelease struct {
+	ID string `json:"id"`
+}
+
+// fetchTofuVersions lists the OpenTofu releases.
+func fetchTofuVersions(ctx context.Context, indexURL string) (version.Collection, error) {
+	body, err := download(ctx, httpClient, indexURL)
+	if err != nil {
+		return nil, fmt.Errorf("fetch OpenTofu releases: %w", err)
+	}
+	var payload struct {
+		Versions []tofuRelease `json:"versions"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("parse OpenTofu releases index: %w", err)
+	}
+	var versions version.Collection
+	for _, release := range payload.Versions {
+		v, err := version.NewVersion(strings.TrimPrefix(strings.TrimSpace(release.ID), "v"))
+		if err != nil {
+			continue
+		}
+		versions = append(versions, v)
+	}
+	if len(versions) == 0 {
+		return nil, errors.New("no parseable OpenTofu versions in index")
+	}
+	return versions, nil
+}
+
+// installTofu downloads the OpenTofu release v for this platform, checks it
+// against the release's SHA256SUMS and extracts the binary into installDir.
+func installTofu(ctx context.Context, v *version.Version, installDir string) (string, error) {
+	base := fmt.Sprintf("%s/v%s", tofuDownloadURL, v)
+	archive := fmt.Sprintf("tofu_%s_%s_%s.zip", v, runtime.GOOS, runtime.GOARCH)
+
+	sums, err := download(ctx, httpClient, fmt.Sprintf("%s/tofu_%s_SHA256SUMS", base, v))
+	if err != nil {
+		return "", fmt.Errorf("fetch OpenTofu %s checksums: %w", v, err)
+	}
+	want, err := checksumOf(sums, archive)
+	if err != nil {
+		return "", fmt.Errorf("OpenTofu %s: %w", v, err)
+	}
+	data, err := download(ctx, downloadClient, base+"/"+archive)
+	if err != nil {
+		return "", fmt.Errorf("download OpenTofu %s: %w", v, err)
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return "", fmt.Errorf("OpenTofu %s: %s has checksum %s, expected %s", v, archive, got, want)
+	}
+
+	binary := EngineTofu.BinaryName()
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("open %s: %w", archive, err)
+	}
+	for _, file := range reader.File {
+		if file.Name != binary {
+			continue
+		}
+		src, err := file.Open()
+		if err != nil {
+			return "", fmt.Errorf("extract %s: %w", binary, err)
+		}
+		path := filepath.Join(installDir, binary)
+		tmp := path + ".tmp"
+		dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o755)
+		if err != nil {
+			_ = src.Close()
+			return "", fmt.Errorf("extract %s: %w", binary, err)
+		}
+		_, err = io.Copy(dst, src)
+		if cerr := src.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		if err != nil {
+			_ = dst.Close()
+			return "", fmt.Errorf("extract %s: %w", binary, err)
+		}
+		if err := dst.Close(); err != nil {
+			return "", err
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			return "", fmt.Errorf("install %s: %w", binary, err)
+		}
+		return path, nil
+	}
+	return "", fmt.Errorf("%s does not contain %s", archive, binary)
+}
+
+// checksumOf returns the SHA-256 sum sums lists for file.
+func checksumOf(sums []byte, file string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == file {
+			return fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("no checksum listed for %s", file)
+}
+
+func download(ctx context.Context, client *http.Client, url string) (body []byte, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := resp.Body.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("close %s: %w", url, cerr)
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("GET %s: unexpected status %s: %s", url, resp.Status, strings.TrimSpace(string(snippet)))
+	}
+	return io.ReadAll(resp.Body)
+}
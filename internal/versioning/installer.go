@@ -30,7 +30,7 @@ type releasesIndex struct {
 	} `json:"versions"`
 }
 
-func resolveInstallVersion(ctx context.Context, constraintStrings []string, preferred *version.Version) (*version.Version, error) {
+func resolveInstallVersion(ctx context.Context, engine Engine, mirror string, constraintStrings []string, preferred *version.Version) (*version.Version, error) {
 	constraints, err := mergeConstraints(constraintStrings)
 	if err != nil {
 		return nil, err
@@ -42,7 +42,7 @@ func resolveInstallVersion(ctx context.Context, constraintStrings []string, pref
 		}
 	}
 
-	available, err := fetchAvailableVersions(ctx)
+	available, err := fetchAvailableVersions(ctx, engine, mirror)
 	if err != nil {
 		return nil, err
 	}
@@ -58,11 +58,18 @@ func resolveInstallVersion(ctx context.Context, constraintStrings []string, pref
 		}
 	}
 
-	return nil, fmt.Errorf("no Terraform versions satisfy constraints %v", constraintStrings)
+	return nil, fmt.Errorf("no %s versions satisfy constraints %v", engine.Name(), constraintStrings)
 }
 
-func fetchAvailableVersions(ctx context.Context) (versions version.Collection, err error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, terraformReleasesIndex, nil)
+func fetchAvailableVersions(ctx context.Context, engine Engine, mirror string) (versions version.Collection, err error) {
+	indexURL, err := releasesIndexURL(engine, mirror)
+	if err != nil {
+		return nil, err
+	}
+	if engine.orDefault() == EngineTofu {
+		return fetchTofuVersions(ctx, indexURL)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, indexURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("build releases request: %w", err)
 	}
@@ -113,7 +120,7 @@ func fetchAvailableVersions(ctx context.Context) (versions version.Collection, e
 	return versions, nil
 }
 
-func ensureVersionInstalled(ctx context.Context, v *version.Version) (string, error) {
+func ensureVersionInstalled(ctx context.Context, engine Engine, mirror string, v *version.Version) (string, error) {
 	if v == nil {
 		return "", errors.New("version to install is nil")
 	}
@@ -122,8 +129,8 @@ func ensureVersionInstalled(ctx context.Context, v *version.Version) (string, er
 		return "", err
 	}
 
-	installDir := filepath.Join(cacheDir, v.String())
-	binaryPath := filepath.Join(installDir, product.Terraform.BinaryName())
+	installDir := versionDirectory(cacheDir, engine, v)
+	binaryPath := filepath.Join(installDir, engine.BinaryName())
 
 	if info, err := os.Stat(binaryPath); err == nil && !info.IsDir() {
 		return binaryPath, nil
@@ -133,10 +140,18 @@ func ensureVersionInstalled(ctx context.Context, v *version.Version) (string, er
 		return "", fmt.Errorf("create install directory %s: %w", installDir, err)
 	}
 
+	if engine.orDefault() == EngineTofu {
+		if mirror != "" {
+			return "", errTofuMirror
+		}
+		return installTofu(ctx, v, installDir)
+	}
+
 	installer := &releases.ExactVersion{
 		Product:    product.Terraform,
 		Version:    v,
 		InstallDir: installDir,
+		ApiBaseURL: mirror,
 	}
 
 	path, err := installer.Install(ctx)
@@ -166,7 +181,16 @@ func cacheRoot() (string, error) {
 	return filepath.Join(home, ".terraform-wrapper", "versions"), nil
 }
 
-func cachedBinaryPath(v *version.Version) (string, error) {
+// versionDirectory is where version v of engine is cached. Terraform keeps
+// the layout that predates OpenTofu support so existing caches stay valid.
+func versionDirectory(root string, engine Engine, v *version.Version) string {
+	if engine.orDefault() == EngineTofu {
+		return filepath.Join(root, string(EngineTofu), v.String())
+	}
+	return filepath.Join(root, v.String())
+}
+
+func cachedBinaryPath(engine Engine, v *version.Version) (string, error) {
 	if v == nil {
 		return "", errors.New("version is nil")
 	}
@@ -174,5 +198,5 @@ func cachedBinaryPath(v *version.Version) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(root, v.String(), product.Terraform.BinaryName()), nil
+	return filepath.Join(versionDirectory(root, engine, v), engine.BinaryName()), nil
 }
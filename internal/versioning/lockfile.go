@@ -11,6 +11,9 @@ import (
 )
 
 type LockFile struct {
+	// Engine is empty for Terraform, which lock files predating OpenTofu
+	// support were all written for.
+	Engine           Engine   `json:"engine,omitempty"`
 	Version          string   `json:"version"`
 	UsedSystemBinary bool     `json:"used_system_binary"`
 	BinaryPath       string   `json:"binary_path,omitempty"`
@@ -67,6 +70,18 @@ func WriteLockFile(path string, lock LockFile) error {
 	return nil
 }
 
+func (l *LockFile) engine() Engine {
+	return l.Engine.orDefault()
+}
+
+// lockEngine is the Engine recorded in a lock file for engine.
+func lockEngine(engine Engine) Engine {
+	if engine.orDefault() == EngineTerraform {
+		return ""
+	}
+	return engine
+}
+
 func (l *LockFile) normalize() {
 	if l == nil {
 		return
@@ -0,0 +1,49 @@
+package versioning
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// NormalizeMirror validates raw as the base URL of a mirror of
+// releases.hashicorp.com, such as an Artifactory remote repository, and
+// returns it without a trailing slash. The mirror must serve the same layout:
+// <mirror>/terraform/index.json and
+// <mirror>/terraform/<version>/terraform_<version>_<os>_<arch>.zip alongside
+// the release's SHA256SUMS and its signature.
+func NormalizeMirror(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid releases mirror %q: %w", raw, err)
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return "", fmt.Errorf("invalid releases mirror %q: expected an http or https URL", raw)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("invalid releases mirror %q: the URL cannot have a query or fragment", raw)
+	}
+	return strings.TrimRight(raw, "/"), nil
+}
+
+// releasesIndexURL is the release index of engine, read from mirror when one
+// is set.
+func releasesIndexURL(engine Engine, mirror string) (string, error) {
+	if engine.orDefault() == EngineTofu {
+		if mirror != "" {
+			return "", errTofuMirror
+		}
+		return tofuReleasesIndex, nil
+	}
+	if mirror != "" {
+		return mirror + "/terraform/index.json", nil
+	}
+	return terraformReleasesIndex, nil
+}
+
+var errTofuMirror = errors.New("a releases mirror serves HashiCorp releases only and cannot install OpenTofu; put a compatible tofu on PATH or in the version cache")
@@ -23,6 +23,10 @@ type ResolveOptions struct {
 	UseSystemOnly  bool
 	DisableInstall bool
 	PinnedVersion  *version.Version
+	Engine         Engine
+	// ReleasesMirror, when set, replaces releases.hashicorp.com for
+	// listing and downloading Terraform releases; see NormalizeMirror.
+	ReleasesMirror string
 }
 
 type ResolveResult struct {
@@ -32,6 +36,7 @@ type ResolveResult struct {
 	SystemBinaryPath string
 	Constraints      map[string]string
 	LockFilePath     string
+	Engine           Engine
 }
 
 func ResolveTerraformBinary(ctx context.Context, opts ResolveOptions) (*ResolveResult, error) {
@@ -46,6 +51,13 @@ func ResolveTerraformBinary(ctx context.Context, opts ResolveOptions) (*ResolveR
 	}
 	// disable install does not conflict with use system, so allow.
 
+	engine := opts.Engine.orDefault()
+	name := engine.Name()
+	mirror, err := NormalizeMirror(opts.ReleasesMirror)
+	if err != nil {
+		return nil, err
+	}
+
 	stdout := opts.Stdout
 	if stdout == nil {
 		stdout = os.Stdout
@@ -66,7 +78,7 @@ func ResolveTerraformBinary(ctx context.Context, opts ResolveOptions) (*ResolveR
 	}
 
 	stackNames := sortedKeys(constraintsByStack)
-	if _, err := fmt.Fprintln(stdout, "Detected Terraform version requirements:"); err != nil {
+	if _, err := fmt.Fprintf(stdout, "Detected %s version requirements:\n", name); err != nil {
 		return nil, fmt.Errorf("write constraint header: %w", err)
 	}
 	for _, stack := range stackNames {
@@ -87,6 +99,12 @@ func ResolveTerraformBinary(ctx context.Context, opts ResolveOptions) (*ResolveR
 		}
 		lock = nil
 	}
+	if lock != nil && lock.engine() != engine {
+		if _, logErr := fmt.Fprintf(stderr, "warning: ignoring lock file for %s; resolving %s\n", lock.engine().Name(), name); logErr != nil {
+			return nil, fmt.Errorf("write lock engine warning: %w", logErr)
+		}
+		lock = nil
+	}
 
 	var lockVersion *version.Version
 	if lock != nil && lock.Version != "" {
@@ -103,36 +121,36 @@ func ResolveTerraformBinary(ctx context.Context, opts ResolveOptions) (*ResolveR
 		if ok, cerr := IsVersionCompatible(opts.PinnedVersion, constraintStrings); cerr != nil {
 			return nil, cerr
 		} else if !ok {
-			return nil, fmt.Errorf("pinned Terraform version %s does not satisfy stack constraints", opts.PinnedVersion)
+			return nil, fmt.Errorf("pinned %s version %s does not satisfy stack constraints", name, opts.PinnedVersion)
 		}
 		lockVersion = opts.PinnedVersion
 	}
 
-	systemVersion, systemPath, systemErr := DetectSystemTerraformVersion(ctx)
-	if systemErr != nil && !errors.Is(systemErr, ErrTerraformNotFound) {
-		if _, logErr := fmt.Fprintf(stderr, "warning: failed to detect system Terraform version: %v\n", systemErr); logErr != nil {
+	systemVersion, systemPath, systemErr := DetectSystemVersion(ctx, engine)
+	if systemErr != nil && !errors.Is(systemErr, ErrBinaryNotFound) {
+		if _, logErr := fmt.Fprintf(stderr, "warning: failed to detect system %s version: %v\n", name, systemErr); logErr != nil {
 			return nil, fmt.Errorf("write system detection warning: %w", logErr)
 		}
-		systemErr = ErrTerraformNotFound
+		systemErr = fmt.Errorf("%s %w", engine.BinaryName(), ErrBinaryNotFound)
 	}
 
 	if opts.UseSystemOnly {
 		if systemErr != nil {
-			return nil, fmt.Errorf("system terraform binary required but not found: %w", systemErr)
+			return nil, fmt.Errorf("system %s binary required but not found: %w", name, systemErr)
 		}
 		if opts.PinnedVersion != nil && !systemVersion.Equal(opts.PinnedVersion) {
-			if _, logErr := fmt.Fprintf(stderr, "warning: system terraform version %s differs from pinned %s\n", systemVersion, opts.PinnedVersion); logErr != nil {
+			if _, logErr := fmt.Fprintf(stderr, "warning: system %s version %s differs from pinned %s\n", name, systemVersion, opts.PinnedVersion); logErr != nil {
 				return nil, fmt.Errorf("write system mismatch warning: %w", logErr)
 			}
 		}
 		if ok, err := IsVersionCompatible(systemVersion, constraintStrings); err != nil {
 			return nil, err
 		} else if !ok {
-			if _, logErr := fmt.Fprintf(stderr, "warning: system terraform %s does not satisfy all constraints\n", systemVersion); logErr != nil {
+			if _, logErr := fmt.Fprintf(stderr, "warning: system %s %s does not satisfy all constraints\n", name, systemVersion); logErr != nil {
 				return nil, fmt.Errorf("write system constraint warning: %w", logErr)
 			}
 		} else {
-			if _, logErr := fmt.Fprintf(stdout, "System Terraform v%s detected — satisfies all constraints.\n", systemVersion); logErr != nil {
+			if _, logErr := fmt.Fprintf(stdout, "System %s v%s detected — satisfies all constraints.\n", name, systemVersion); logErr != nil {
 				return nil, fmt.Errorf("write system success message: %w", logErr)
 			}
 		}
@@ -143,8 +161,10 @@ func ResolveTerraformBinary(ctx context.Context, opts ResolveOptions) (*ResolveR
 			SystemBinaryPath: systemPath,
 			Constraints:      constraintsByStack,
 			LockFilePath:     lockPath,
+			Engine:           engine,
 		}
 		if err := WriteLockFile(lockPath, LockFile{
+			Engine:           lockEngine(engine),
 			Version:          systemVersion.String(),
 			UsedSystemBinary: true,
 			BinaryPath:       systemPath,
@@ -170,54 +190,54 @@ func ResolveTerraformBinary(ctx context.Context, opts ResolveOptions) (*ResolveR
 		} else if ok {
 			if lock.UsedSystemBinary {
 				if systemErr == nil && systemVersion.Equal(lockVersion) {
-					if _, logErr := fmt.Fprintf(stdout, "Reusing system Terraform v%s from previous lock.\n", lockVersion); logErr != nil {
+					if _, logErr := fmt.Fprintf(stdout, "Reusing system %s v%s from previous lock.\n", name, lockVersion); logErr != nil {
 						return nil, fmt.Errorf("write reuse system message: %w", logErr)
 					}
-					return finalizeResolution(stdout, stderr, lockPath, stackNames, constraintsByStack, lockVersion, systemPath, true)
+					return finalizeResolution(engine, stdout, stderr, lockPath, stackNames, constraintsByStack, lockVersion, systemPath, true)
 				}
-				cachedPath, cErr := cachedBinaryPath(lockVersion)
+				cachedPath, cErr := cachedBinaryPath(engine, lockVersion)
 				if cErr == nil {
 					if info, err := os.Stat(cachedPath); err == nil && !info.IsDir() {
-						if _, logErr := fmt.Fprintf(stdout, "System Terraform no longer matches lock; using cached install for v%s.\n", lockVersion); logErr != nil {
+						if _, logErr := fmt.Fprintf(stdout, "System %s no longer matches lock; using cached install for v%s.\n", name, lockVersion); logErr != nil {
 							return nil, fmt.Errorf("write reuse cached message: %w", logErr)
 						}
-						return finalizeResolution(stdout, stderr, lockPath, stackNames, constraintsByStack, lockVersion, cachedPath, false)
+						return finalizeResolution(engine, stdout, stderr, lockPath, stackNames, constraintsByStack, lockVersion, cachedPath, false)
 					}
 				}
 				if opts.DisableInstall {
-					return nil, fmt.Errorf("locked Terraform %s not available locally and installation disabled", lockVersion)
+					return nil, fmt.Errorf("locked %s %s not available locally and installation disabled", name, lockVersion)
 				}
-				path, err := ensureVersionInstalled(ctx, lockVersion)
+				path, err := ensureVersionInstalled(ctx, engine, mirror, lockVersion)
 				if err == nil {
-					if _, logErr := fmt.Fprintf(stdout, "System Terraform no longer matches lock; using cached install for v%s.\n", lockVersion); logErr != nil {
+					if _, logErr := fmt.Fprintf(stdout, "System %s no longer matches lock; using cached install for v%s.\n", name, lockVersion); logErr != nil {
 						return nil, fmt.Errorf("write reuse installed message: %w", logErr)
 					}
-					return finalizeResolution(stdout, stderr, lockPath, stackNames, constraintsByStack, lockVersion, path, false)
+					return finalizeResolution(engine, stdout, stderr, lockPath, stackNames, constraintsByStack, lockVersion, path, false)
 				}
 				if _, logErr := fmt.Fprintf(stderr, "warning: failed to reuse locked install %s: %v\n", lockVersion, err); logErr != nil {
 					return nil, fmt.Errorf("write reuse-locked warning: %w", logErr)
 				}
 			} else {
-				cachedPath, cErr := cachedBinaryPath(lockVersion)
+				cachedPath, cErr := cachedBinaryPath(engine, lockVersion)
 				if cErr == nil {
 					if info, err := os.Stat(cachedPath); err == nil && !info.IsDir() {
-						if _, logErr := fmt.Fprintf(stdout, "Reusing cached Terraform installation v%s.\n", lockVersion); logErr != nil {
+						if _, logErr := fmt.Fprintf(stdout, "Reusing cached %s installation v%s.\n", name, lockVersion); logErr != nil {
 							return nil, fmt.Errorf("write reuse cached install message: %w", logErr)
 						}
-						return finalizeResolution(stdout, stderr, lockPath, stackNames, constraintsByStack, lockVersion, cachedPath, false)
+						return finalizeResolution(engine, stdout, stderr, lockPath, stackNames, constraintsByStack, lockVersion, cachedPath, false)
 					}
 				}
 				if opts.DisableInstall {
-					return nil, fmt.Errorf("cached Terraform %s not available locally and installation disabled", lockVersion)
+					return nil, fmt.Errorf("cached %s %s not available locally and installation disabled", name, lockVersion)
 				}
-				path, err := ensureVersionInstalled(ctx, lockVersion)
+				path, err := ensureVersionInstalled(ctx, engine, mirror, lockVersion)
 				if err == nil {
-					if _, logErr := fmt.Fprintf(stdout, "Reusing cached Terraform installation v%s.\n", lockVersion); logErr != nil {
+					if _, logErr := fmt.Fprintf(stdout, "Reusing cached %s installation v%s.\n", name, lockVersion); logErr != nil {
 						return nil, fmt.Errorf("write reuse installed cache message: %w", logErr)
 					}
-					return finalizeResolution(stdout, stderr, lockPath, stackNames, constraintsByStack, lockVersion, path, false)
+					return finalizeResolution(engine, stdout, stderr, lockPath, stackNames, constraintsByStack, lockVersion, path, false)
 				}
-				if _, logErr := fmt.Fprintf(stderr, "warning: failed to reuse cached Terraform %s: %v\n", lockVersion, err); logErr != nil {
+				if _, logErr := fmt.Fprintf(stderr, "warning: failed to reuse cached %s %s: %v\n", name, lockVersion, err); logErr != nil {
 					return nil, fmt.Errorf("write reuse cached warning: %w", logErr)
 				}
 			}
@@ -225,18 +245,18 @@ func ResolveTerraformBinary(ctx context.Context, opts ResolveOptions) (*ResolveR
 	}
 
 	if opts.ForceInstall {
-		versionToInstall, err := resolveInstallVersion(ctx, constraintStrings, lockVersion)
+		versionToInstall, err := resolveInstallVersion(ctx, engine, mirror, constraintStrings, lockVersion)
 		if err != nil {
 			return nil, err
 		}
-		if _, logErr := fmt.Fprintf(stdout, "Installing Terraform v%s (forced install).\n", versionToInstall); logErr != nil {
+		if _, logErr := fmt.Fprintf(stdout, "Installing %s v%s (forced install).\n", name, versionToInstall); logErr != nil {
 			return nil, fmt.Errorf("write forced install message: %w", logErr)
 		}
-		path, err := ensureVersionInstalled(ctx, versionToInstall)
+		path, err := ensureVersionInstalled(ctx, engine, mirror, versionToInstall)
 		if err != nil {
 			return nil, err
 		}
-		return finalizeResolution(stdout, stderr, lockPath, stackNames, constraintsByStack, versionToInstall, path, false)
+		return finalizeResolution(engine, stdout, stderr, lockPath, stackNames, constraintsByStack, versionToInstall, path, false)
 	}
 
 	if systemErr == nil {
@@ -245,27 +265,27 @@ func ResolveTerraformBinary(ctx context.Context, opts ResolveOptions) (*ResolveR
 			return nil, err
 		}
 		if ok {
-			if _, logErr := fmt.Fprintf(stdout, "System Terraform v%s detected — satisfies all constraints.\n", systemVersion); logErr != nil {
+			if _, logErr := fmt.Fprintf(stdout, "System %s v%s detected — satisfies all constraints.\n", name, systemVersion); logErr != nil {
 				return nil, fmt.Errorf("write system compatibility message: %w", logErr)
 			}
-			return finalizeResolution(stdout, stderr, lockPath, stackNames, constraintsByStack, systemVersion, systemPath, true)
+			return finalizeResolution(engine, stdout, stderr, lockPath, stackNames, constraintsByStack, systemVersion, systemPath, true)
 		}
-		if _, logErr := fmt.Fprintf(stdout, "System Terraform v%s does not satisfy all constraints.\n", systemVersion); logErr != nil {
+		if _, logErr := fmt.Fprintf(stdout, "System %s v%s does not satisfy all constraints.\n", name, systemVersion); logErr != nil {
 			return nil, fmt.Errorf("write system incompatibility message: %w", logErr)
 		}
 		if opts.DisableInstall {
-			return nil, fmt.Errorf("system terraform %s incompatible and installation is disabled", systemVersion)
+			return nil, fmt.Errorf("system %s %s incompatible and installation is disabled", name, systemVersion)
 		}
-	} else if errors.Is(systemErr, ErrTerraformNotFound) {
-		if _, logErr := fmt.Fprintln(stdout, "System Terraform binary not found."); logErr != nil {
+	} else if errors.Is(systemErr, ErrBinaryNotFound) {
+		if _, logErr := fmt.Fprintf(stdout, "System %s binary not found.\n", name); logErr != nil {
 			return nil, fmt.Errorf("write system not found message: %w", logErr)
 		}
 		if opts.DisableInstall {
-			return nil, fmt.Errorf("terraform binary not found and installation disabled")
+			return nil, fmt.Errorf("%s binary not found and installation disabled", name)
 		}
 	} else {
 		if opts.DisableInstall {
-			return nil, fmt.Errorf("failed to detect Terraform version and installation disabled: %w", systemErr)
+			return nil, fmt.Errorf("failed to detect %s version and installation disabled: %w", name, systemErr)
 		}
 	}
 
@@ -273,27 +293,27 @@ func ResolveTerraformBinary(ctx context.Context, opts ResolveOptions) (*ResolveR
 	if opts.PinnedVersion != nil {
 		versionPref = opts.PinnedVersion
 	}
-	versionToInstall, err := resolveInstallVersion(ctx, constraintStrings, versionPref)
+	versionToInstall, err := resolveInstallVersion(ctx, engine, mirror, constraintStrings, versionPref)
 	if err != nil {
 		return nil, err
 	}
 	if systemErr == nil {
-		if _, logErr := fmt.Fprintf(stdout, "Installing Terraform v%s (latest compatible).\n", versionToInstall); logErr != nil {
+		if _, logErr := fmt.Fprintf(stdout, "Installing %s v%s (latest compatible).\n", name, versionToInstall); logErr != nil {
 			return nil, fmt.Errorf("write latest install message: %w", logErr)
 		}
 	} else {
-		if _, logErr := fmt.Fprintf(stdout, "Installing Terraform v%s...\n", versionToInstall); logErr != nil {
+		if _, logErr := fmt.Fprintf(stdout, "Installing %s v%s...\n", name, versionToInstall); logErr != nil {
 			return nil, fmt.Errorf("write install message: %w", logErr)
 		}
 	}
-	path, err := ensureVersionInstalled(ctx, versionToInstall)
+	path, err := ensureVersionInstalled(ctx, engine, mirror, versionToInstall)
 	if err != nil {
 		return nil, err
 	}
-	return finalizeResolution(stdout, stderr, lockPath, stackNames, constraintsByStack, versionToInstall, path, false)
+	return finalizeResolution(engine, stdout, stderr, lockPath, stackNames, constraintsByStack, versionToInstall, path, false)
 }
 
-func finalizeResolution(stdout, stderr io.Writer, lockPath string, stacks []string, constraints map[string]string, version *version.Version, binaryPath string, usedSystem bool) (*ResolveResult, error) {
+func finalizeResolution(engine Engine, stdout, stderr io.Writer, lockPath string, stacks []string, constraints map[string]string, version *version.Version, binaryPath string, usedSystem bool) (*ResolveResult, error) {
 	if binaryPath == "" {
 		return nil, errors.New("binary path cannot be empty")
 	}
@@ -305,6 +325,7 @@ func finalizeResolution(stdout, stderr io.Writer, lockPath string, stacks []stri
 	}
 
 	if err := WriteLockFile(lockPath, LockFile{
+		Engine:           lockEngine(engine),
 		Version:          version.String(),
 		UsedSystemBinary: usedSystem,
 		BinaryPath:       binaryPath,
@@ -315,6 +336,10 @@ func finalizeResolution(stdout, stderr io.Writer, lockPath string, stacks []stri
 		}
 	}
 
+	if !usedSystem {
+		markUsed(binaryPath)
+	}
+
 	if usedSystem {
 		if _, logErr := fmt.Fprintf(stdout, "Using system binary: %s\n", binaryPath); logErr != nil {
 			return nil, fmt.Errorf("write system binary info: %w", logErr)
@@ -335,6 +360,7 @@ func finalizeResolution(stdout, stderr io.Writer, lockPath string, stacks []stri
 		SystemBinaryPath: binaryPath,
 		Constraints:      constraints,
 		LockFilePath:     lockPath,
+		Engine:           engine,
 	}, nil
 }
 
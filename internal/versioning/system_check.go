@@ -15,8 +15,11 @@ import (
 )
 
 var (
+	// ErrBinaryNotFound indicates that the engine's binary could not be located in PATH.
+	ErrBinaryNotFound = errors.New("binary not found in PATH")
+
 	// ErrTerraformNotFound indicates that terraform binary could not be located in PATH.
-	ErrTerraformNotFound = errors.New("terraform binary not found in PATH")
+	ErrTerraformNotFound = fmt.Errorf("terraform %w", ErrBinaryNotFound)
 
 	tfVersionPattern = regexp.MustCompile(`^Terraform\s+v?([0-9A-Za-z\.\-\+]+)`)
 )
@@ -24,13 +27,23 @@ var (
 // DetectSystemTerraformVersion resolves the terraform binary from PATH, executes `terraform -version`,
 // and returns the parsed semantic version along with the binary path.
 func DetectSystemTerraformVersion(ctx context.Context) (*version.Version, string, error) {
-	binaryPath, err := exec.LookPath("terraform")
+	return DetectSystemVersion(ctx, EngineTerraform)
+}
+
+// DetectSystemVersion resolves the binary of engine from PATH, executes it with `-version`,
+// and returns the parsed semantic version along with the binary path.
+func DetectSystemVersion(ctx context.Context, engine Engine) (*version.Version, string, error) {
+	name := engine.BinaryName()
+	binaryPath, err := exec.LookPath(name)
 	if err != nil {
 		var execErr *exec.Error
 		if errors.As(err, &execErr) && execErr.Err == exec.ErrNotFound {
-			return nil, "", ErrTerraformNotFound
+			if engine.orDefault() == EngineTerraform {
+				return nil, "", ErrTerraformNotFound
+			}
+			return nil, "", fmt.Errorf("%s %w", name, ErrBinaryNotFound)
 		}
-		return nil, "", fmt.Errorf("locate terraform binary: %w", err)
+		return nil, "", fmt.Errorf("locate %s binary: %w", name, err)
 	}
 
 	cmd := exec.CommandContext(ctx, binaryPath, "-version")
@@ -39,10 +52,10 @@ func DetectSystemTerraformVersion(ctx context.Context) (*version.Version, string
 		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 			return nil, "", err
 		}
-		return nil, "", fmt.Errorf("terraform -version failed: %w (output: %s)", err, bytes.TrimSpace(output))
+		return nil, "", fmt.Errorf("%s -version failed: %w (output: %s)", name, err, bytes.TrimSpace(output))
 	}
 
-	v, err := parseTerraformVersion(output)
+	v, err := parseVersionOutput(engine, output)
 	if err != nil {
 		return nil, "", err
 	}
@@ -50,23 +63,24 @@ func DetectSystemTerraformVersion(ctx context.Context) (*version.Version, string
 	return v, binaryPath, nil
 }
 
-func parseTerraformVersion(output []byte) (*version.Version, error) {
+func parseVersionOutput(engine Engine, output []byte) (*version.Version, error) {
+	pattern := engine.versionPattern()
 	scanner := bufio.NewScanner(bytes.NewReader(output))
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 		if line == "" {
 			continue
 		}
-		m := tfVersionPattern.FindStringSubmatch(line)
+		m := pattern.FindStringSubmatch(line)
 		if len(m) != 2 {
 			continue
 		}
 		return version.NewVersion(strings.TrimPrefix(m[1], "v"))
 	}
 	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("scan terraform version output: %w", err)
+		return nil, fmt.Errorf("scan %s version output: %w", engine.BinaryName(), err)
 	}
-	return nil, fmt.Errorf("failed to detect terraform version from output: %q", string(output))
+	return nil, fmt.Errorf("failed to detect %s version from output: %q", engine.BinaryName(), string(output))
 }
 
 // IsVersionCompatible verifies whether the provided version satisfies all specified constraints.
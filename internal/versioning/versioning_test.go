@@ -1,12 +1,18 @@
 package versioning
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 	"time"
 
@@ -50,7 +56,7 @@ func TestParseTerraformVersion(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			v, err := parseTerraformVersion([]byte(tc.output))
+			v, err := parseVersionOutput(EngineTerraform, []byte(tc.output))
 			if tc.wantErr {
 				require.Error(t, err)
 				return
@@ -84,7 +90,7 @@ func TestResolveInstallVersionPrefersPreferred(t *testing.T) {
 	preferred, err := version.NewVersion("1.7.5")
 	require.NoError(t, err)
 
-	got, err := resolveInstallVersion(context.Background(), []string{">= 1.6.0"}, preferred)
+	got, err := resolveInstallVersion(context.Background(), EngineTerraform, "", []string{">= 1.6.0"}, preferred)
 	require.NoError(t, err)
 	require.Equal(t, preferred.String(), got.String())
 }
@@ -114,13 +120,227 @@ func TestResolveInstallVersionSelectsLatest(t *testing.T) {
 	}
 	t.Cleanup(func() { httpClient = prevClient })
 
-	got, err := resolveInstallVersion(context.Background(), []string{">= 1.5.0"}, nil)
+	got, err := resolveInstallVersion(context.Background(), EngineTerraform, "", []string{">= 1.5.0"}, nil)
 	require.NoError(t, err)
 	require.Equal(t, "1.6.0", got.String())
 }
 
+func TestParseOpenTofuVersion(t *testing.T) {
+	v, err := parseVersionOutput(EngineTofu, []byte("OpenTofu v1.8.3\non linux_amd64\n"))
+	require.NoError(t, err)
+	require.Equal(t, "1.8.3", v.String())
+
+	_, err = parseVersionOutput(EngineTofu, []byte("Terraform v1.8.3\n"))
+	require.Error(t, err)
+}
+
+func TestParseEngine(t *testing.T) {
+	for name, want := range map[string]Engine{"": EngineTerraform, "terraform": EngineTerraform, "tofu": EngineTofu, "OpenTofu": EngineTofu} {
+		got, err := ParseEngine(name)
+		require.NoError(t, err, name)
+		require.Equal(t, want, got, name)
+	}
+	_, err := ParseEngine("pulumi")
+	require.Error(t, err)
+}
+
+func TestCachedBinaryPathSeparatesEngines(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	v := version.Must(version.NewVersion("1.8.0"))
+	root, err := cacheRoot()
+	require.NoError(t, err)
+
+	terraform, err := cachedBinaryPath(EngineTerraform, v)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(root, "1.8.0", EngineTerraform.BinaryName()), terraform)
+
+	tofu, err := cachedBinaryPath(EngineTofu, v)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(root, "tofu", "1.8.0", EngineTofu.BinaryName()), tofu)
+}
+
+// serveReleases points the release clients at handler for the test.
+func serveReleases(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	redirect := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			req.URL.Scheme = "http"
+			req.URL.Host = server.Listener.Addr().String()
+			return http.DefaultTransport.RoundTrip(req)
+		}),
+	}
+	prevClient, prevDownload := httpClient, downloadClient
+	httpClient, downloadClient = redirect, redirect
+	t.Cleanup(func() { httpClient, downloadClient = prevClient, prevDownload })
+}
+
+func TestResolveInstallVersionReadsOpenTofuIndex(t *testing.T) {
+	serveReleases(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/tofu/api.json", r.URL.Path)
+		fmt.Fprint(w, `{"versions":[{"id":"1.7.2"},{"id":"1.8.1"},{"id":"1.9.0-rc1"}]}`)
+	})
+
+	got, err := resolveInstallVersion(context.Background(), EngineTofu, "", []string{">= 1.6.0"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "1.8.1", got.String())
+
+	_, err = resolveInstallVersion(context.Background(), EngineTofu, "", []string{">= 2.0.0"}, nil)
+	require.ErrorContains(t, err, "no OpenTofu versions satisfy")
+}
+
+func TestEnsureVersionInstalledVerifiesOpenTofuChecksum(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	v := version.Must(version.NewVersion("1.8.1"))
+	archiveName := fmt.Sprintf("tofu_1.8.1_%s_%s.zip", runtime.GOOS, runtime.GOARCH)
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for _, name := range []string{"LICENSE", EngineTofu.BinaryName()} {
+		f, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte("#!/bin/sh\necho OpenTofu v1.8.1\n"))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	sum := sha256.Sum256(archive.Bytes())
+	checksum := hex.EncodeToString(sum[:])
+
+	serveReleases(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/opentofu/opentofu/releases/download/v1.8.1/tofu_1.8.1_SHA256SUMS":
+			fmt.Fprintf(w, "%s  tofu_1.8.1_other.zip\n%s  %s\n", checksum, checksum, archiveName)
+		case "/opentofu/opentofu/releases/download/v1.8.1/" + archiveName:
+			_, _ = w.Write(archive.Bytes())
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	path, err := ensureVersionInstalled(context.Background(), EngineTofu, "", v)
+	require.NoError(t, err)
+	cached, err := cachedBinaryPath(EngineTofu, v)
+	require.NoError(t, err)
+	require.Equal(t, cached, path)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NotZero(t, info.Mode()&0o100)
+
+	checksum = "0000"
+	_, err = installTofu(context.Background(), v, t.TempDir())
+	require.ErrorContains(t, err, "has checksum")
+}
+
+func TestResolveIgnoresLockFileOfOtherEngine(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "main.tf"), []byte("terraform {\n  required_version = \">= 1.0.0\"\n}\n"), 0o644))
+	lockPath := filepath.Join(root, ".terraform-version.lock.json")
+	require.NoError(t, WriteLockFile(lockPath, LockFile{Version: "1.7.0", BinaryPath: "/usr/bin/terraform", UsedSystemBinary: true}))
+	t.Setenv("PATH", t.TempDir())
+
+	var stderr bytes.Buffer
+	_, err := ResolveTerraformBinary(context.Background(), ResolveOptions{
+		RootDir:        root,
+		StackPaths:     []string{root},
+		Stdout:         &bytes.Buffer{},
+		Stderr:         &stderr,
+		DisableInstall: true,
+		Engine:         EngineTofu,
+	})
+	require.EqualError(t, err, "OpenTofu binary not found and installation disabled")
+	require.Contains(t, stderr.String(), "ignoring lock file for Terraform")
+}
+
 type roundTripFunc func(*http.Request) (*http.Response, error)
 
 func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
 	return f(req)
 }
+
+func TestDockerImageTagsResolvedVersion(t *testing.T) {
+	v := version.Must(version.NewVersion("1.6.6"))
+
+	require.Equal(t, "hashicorp/terraform:1.6.6", DockerImage("hashicorp/terraform", v))
+	require.Equal(t, "registry:5000/tools/terraform:1.6.6", DockerImage("registry:5000/tools/terraform", v))
+	require.Equal(t, "hashicorp/terraform:1.5.7", DockerImage("hashicorp/terraform:1.5.7", v))
+	require.Equal(t, "hashicorp/terraform@sha256:abc", DockerImage("hashicorp/terraform@sha256:abc", v))
+	require.Equal(t, "hashicorp/terraform", DockerImage("hashicorp/terraform", nil))
+}
+
+func TestListCachedVersionsAndLastUse(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	install := func(engine Engine, raw string) string {
+		path, err := cachedBinaryPath(engine, version.Must(version.NewVersion(raw)))
+		require.NoError(t, err)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte("binary"), 0o755))
+		old := time.Now().Add(-60 * 24 * time.Hour)
+		require.NoError(t, os.Chtimes(path, old, old))
+		return path
+	}
+	install(EngineTerraform, "1.9.8")
+	used := install(EngineTerraform, "1.10.0")
+	install(EngineTofu, "1.8.1")
+	// A directory without a binary is an interrupted install.
+	root, err := cacheRoot()
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "1.5.0"), 0o755))
+
+	markUsed(used)
+	markUsed("/usr/local/bin/terraform")
+
+	cached, err := ListCached()
+	require.NoError(t, err)
+	var got []string
+	for _, c := range cached {
+		got = append(got, fmt.Sprintf("%s %s %d", c.Engine, c.Version, c.Size))
+	}
+	require.Equal(t, []string{"terraform 1.9.8 6", "terraform 1.10.0 6", "tofu 1.8.1 6"}, got)
+	require.True(t, cached[0].LastUsed.Before(time.Now().Add(-59*24*time.Hour)))
+	require.WithinDuration(t, time.Now(), cached[1].LastUsed, time.Minute)
+
+	lock := &LockFile{Version: "1.9.8"}
+	require.True(t, lock.Pins(cached[0]))
+	require.False(t, lock.Pins(cached[1]))
+	require.False(t, (&LockFile{Version: "1.8.1"}).Pins(cached[2]))
+	require.True(t, (&LockFile{Engine: EngineTofu, Version: "1.8.1"}).Pins(cached[2]))
+
+	require.NoError(t, RemoveCached(cached[0]))
+	cached, err = ListCached()
+	require.NoError(t, err)
+	require.Len(t, cached, 2)
+}
+
+func TestReleasesMirror(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	for raw, want := range map[string]string{
+		"": "",
+		"https://artifactory.example.com/hashicorp/": "https://artifactory.example.com/hashicorp",
+		" http://mirror.internal ":                   "http://mirror.internal",
+	} {
+		got, err := NormalizeMirror(raw)
+		require.NoError(t, err, raw)
+		require.Equal(t, want, got, raw)
+	}
+	for _, raw := range []string{"artifactory.example.com", "ftp://mirror.internal", "https://mirror.internal/?repo=x"} {
+		_, err := NormalizeMirror(raw)
+		require.Error(t, err, raw)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/hashicorp/terraform/index.json", r.URL.Path)
+		fmt.Fprint(w, `{"versions":{"1.9.8":{"version":"1.9.8"},"1.10.0":{"version":"1.10.0"}}}`)
+	}))
+	t.Cleanup(server.Close)
+
+	got, err := resolveInstallVersion(context.Background(), EngineTerraform, server.URL+"/hashicorp", []string{"< 1.10.0"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "1.9.8", got.String())
+
+	_, err = resolveInstallVersion(context.Background(), EngineTofu, server.URL+"/hashicorp", []string{">= 1.6.0"}, nil)
+	require.ErrorIs(t, err, errTofuMirror)
+	_, err = ensureVersionInstalled(context.Background(), EngineTofu, server.URL, version.Must(version.NewVersion("1.8.1")))
+	require.ErrorIs(t, err, errTofuMirror)
+}
@@ -0,0 +1,111 @@
+// Package workdir manages the per-run directory that features write generated
+// files to, such as the superplan's merged configuration and the plans
+// checked by policy gates. Every run gets its own temporary root and every
+// caller its own directory under it, so generated files never collide or
+// leak between runs, even concurrent runs of the same commit.
+package workdir
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sync"
+
+	"terraform-wrapper/internal/logging"
+)
+
+// Workdir is a run's directory for generated files. It is created on first
+// use and removed by Close unless kept. A nil Workdir is valid: each caller
+// then gets a standalone temporary directory removed by its cleanup.
+type Workdir struct {
+	keep bool
+
+	mu    sync.Mutex
+	runID string
+	dir   string
+}
+
+// New returns a Workdir; with keep, Close leaves the generated files for
+// inspection.
+func New(keep bool) *Workdir {
+	return &Workdir{keep: keep}
+}
+
+// SetRunID names the directory after the run, when it is not created yet.
+func (w *Workdir) SetRunID(id string) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.runID = id
+}
+
+// Dir returns the run's root directory, or "" before it is created.
+func (w *Workdir) Dir() string {
+	if w == nil {
+		return ""
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.dir
+}
+
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Sub creates a new directory for the named use, such as "superplan" or
+// "apply-network". The cleanup function removes it when the Workdir is nil
+// and does nothing otherwise, since Close removes the whole run's directory.
+func (w *Workdir) Sub(name string) (string, func(), error) {
+	prefix := unsafeName.ReplaceAllString(name, "_") + "-"
+	if w == nil {
+		dir, err := os.MkdirTemp("", "terraform-wrapper-"+prefix)
+		if err != nil {
+			return "", nil, fmt.Errorf("create %s directory: %w", name, err)
+		}
+		return dir, func() { remove(dir) }, nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.dir == "" {
+		id := w.runID
+		if id == "" {
+			id = "run"
+		}
+		dir, err := os.MkdirTemp("", "terraform-wrapper-"+unsafeName.ReplaceAllString(id, "_")+"-")
+		if err != nil {
+			return "", nil, fmt.Errorf("create run directory: %w", err)
+		}
+		w.dir = dir
+	}
+	dir, err := os.MkdirTemp(w.dir, prefix)
+	if err != nil {
+		return "", nil, fmt.Errorf("create %s directory: %w", name, err)
+	}
+	return dir, func() {}, nil
+}
+
+// Close removes the run's directory, or reports where it was kept.
+func (w *Workdir) Close() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.dir == "" {
+		return
+	}
+	if w.keep {
+		logging.Infof("[workdir] kept generated files in %s", w.dir)
+		return
+	}
+	remove(w.dir)
+	w.dir = ""
+}
+
+func remove(dir string) {
+	if err := os.RemoveAll(dir); err != nil {
+		logging.Warnf("[workdir] warning: failed to remove %s: %v", dir, err)
+	}
+}
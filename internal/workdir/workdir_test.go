@@ -0,0 +1,72 @@
+package workdir_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/workdir"
+)
+
+func TestSubSharesOneRunDirectory(t *testing.T) {
+	w := workdir.New(false)
+	w.SetRunID("0123abcd")
+	require.Empty(t, w.Dir())
+
+	first, cleanup, err := w.Sub("superplan")
+	require.NoError(t, err)
+	cleanup()
+	second, _, err := w.Sub("superplan")
+	require.NoError(t, err)
+	policy, _, err := w.Sub("policy-core/network")
+	require.NoError(t, err)
+
+	root := w.Dir()
+	require.True(t, strings.HasPrefix(filepath.Base(root), "terraform-wrapper-0123abcd-"))
+	require.NotEqual(t, first, second)
+	for _, dir := range []string{first, second, policy} {
+		require.Equal(t, root, filepath.Dir(dir))
+		require.DirExists(t, dir)
+	}
+	require.True(t, strings.HasPrefix(filepath.Base(policy), "policy-core_network-"))
+
+	w.Close()
+	require.NoDirExists(t, root)
+}
+
+func TestConcurrentRunsDoNotCollide(t *testing.T) {
+	a, b := workdir.New(false), workdir.New(false)
+	a.SetRunID("same")
+	b.SetRunID("same")
+	t.Cleanup(a.Close)
+	t.Cleanup(b.Close)
+
+	dirA, _, err := a.Sub("superplan")
+	require.NoError(t, err)
+	dirB, _, err := b.Sub("superplan")
+	require.NoError(t, err)
+	require.NotEqual(t, a.Dir(), b.Dir())
+	require.NotEqual(t, dirA, dirB)
+}
+
+func TestCloseKeepsDirectory(t *testing.T) {
+	w := workdir.New(true)
+	dir, _, err := w.Sub("superplan")
+	require.NoError(t, err)
+	w.Close()
+	require.DirExists(t, dir)
+	require.NoError(t, os.RemoveAll(w.Dir()))
+}
+
+func TestNilWorkdirUsesStandaloneDirectories(t *testing.T) {
+	var w *workdir.Workdir
+	dir, cleanup, err := w.Sub("apply-network")
+	require.NoError(t, err)
+	require.DirExists(t, dir)
+	cleanup()
+	require.NoDirExists(t, dir)
+	w.Close()
+}
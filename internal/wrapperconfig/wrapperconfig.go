@@ -0,0 +1,226 @@
+package wrapperconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
+
+	"terraform-wrapper/internal/stacks"
+)
+
+// FileName is the settings file looked up in the stack root.
+const FileName = "terraform-wrapper.hcl"
+
+// Settings are the values a file may set. Nil fields are left to flag defaults.
+type Settings struct {
+	AccountID        *string  `hcl:"account_id,optional"`
+	Region           *string  `hcl:"region,optional"`
+	Parallelism      *int     `hcl:"parallelism,optional"`
+	Cache            *bool    `hcl:"cache,optional"`
+	Refresh          *bool    `hcl:"refresh,optional"`
+	ForcePlan        []string `hcl:"force_plan,optional"`
+	TerraformVersion *string  `hcl:"terraform_version,optional"`
+	// Engine runs stacks with terraform or tofu (OpenTofu).
+	Engine *string `hcl:"engine,optional"`
+	// ReleasesMirror replaces releases.hashicorp.com when Terraform
+	// versions are listed and installed; CLIConfig is a terraform CLI
+	// configuration file, typically pointing providers at a mirror.
+	ReleasesMirror *string `hcl:"releases_mirror,optional"`
+	CLIConfig      *string `hcl:"cli_config,optional"`
+	// PluginCache shares one provider plugin cache between the stacks;
+	// PluginCacheLock serialises inits so they never write it at once.
+	PluginCache     *bool   `hcl:"plugin_cache,optional"`
+	PluginCacheLock *bool   `hcl:"plugin_cache_lock,optional"`
+	Profile         *string `hcl:"profile,optional"`
+	// Backend selects the state backend; stacks may override it with
+	// backend.tfwrapper.json.
+	Backend *stacks.BackendSettings `hcl:"backend,block"`
+	// AssumeRoleARN runs terraform as this role, typically in the
+	// environment's own account.
+	AssumeRoleARN *string `hcl:"assume_role_arn,optional"`
+	// AllowedRegions lists the regions stacks' aws providers may target;
+	// others are reported as warnings.
+	AllowedRegions []string `hcl:"allowed_regions,optional"`
+	// RetryAttempts, RetryDelay and RetryPatterns configure retries of
+	// transient terraform failures. RetryPatterns are regular expressions
+	// recognising failures beyond the built-in ones.
+	RetryAttempts *int     `hcl:"retry_attempts,optional"`
+	RetryDelay    *string  `hcl:"retry_delay,optional"`
+	RetryPatterns []string `hcl:"retry_patterns,optional"`
+	// LockWait is how long a command that cannot acquire the state lock is
+	// retried before the stack fails.
+	LockWait *string `hcl:"lock_wait,optional"`
+	// AdaptiveParallelism lowers parallelism while terraform is throttled.
+	AdaptiveParallelism *bool `hcl:"adaptive_parallelism,optional"`
+	// StateBackups copies each stack's state to the state bucket's backups/
+	// prefix before it is applied or destroyed.
+	StateBackups *bool `hcl:"state_backups,optional"`
+	// Tenant namespaces the plan cache, locks, run history and artifacts of
+	// the team that owns this root.
+	Tenant *string `hcl:"tenant,optional"`
+	// KeepRuns and MaxArtifactAge bound the run history, failure bundles,
+	// logs and cached plans kept under .terraform-wrapper after each run.
+	KeepRuns       *int    `hcl:"keep_runs,optional"`
+	MaxArtifactAge *string `hcl:"max_artifact_age,optional"`
+	// TagAttributes name the attributes of each provider's resources whose
+	// changes the superplan ignores, replacing the provider's defaults.
+	TagAttributes []TagAttributes `hcl:"tag_attributes,block"`
+	// ApplyIdentities, when set, lists the AWS identities allowed to apply
+	// or destroy, typically CI roles. Entries are ARNs, where * matches any
+	// characters; a role ARN admits every session of the role.
+	ApplyIdentities []string `hcl:"apply_identities,optional"`
+}
+
+// TagAttributes is a tag_attributes block, labelled with a provider type
+// such as google or azurerm.
+type TagAttributes struct {
+	Provider   string   `hcl:"provider,label"`
+	Attributes []string `hcl:"attributes"`
+}
+
+// Environment overrides the top-level settings for one environment.
+type Environment struct {
+	Name     string `hcl:"name,label"`
+	Settings `hcl:",remain"`
+}
+
+// File is a parsed terraform-wrapper.hcl.
+type File struct {
+	DefaultEnvironment *string `hcl:"default_environment,optional"`
+	Settings           `hcl:",remain"`
+	Environments       []Environment `hcl:"environment,block"`
+}
+
+// Load parses root/terraform-wrapper.hcl, returning nil when it does not exist.
+func Load(root string) (*File, error) {
+	path := filepath.Join(root, FileName)
+	src, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", FileName, err)
+	}
+
+	parser := hclparse.NewParser()
+	hclFile, diags := parser.ParseHCL(src, path)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("parse %s: %s", path, diags.Error())
+	}
+	var file File
+	if diags := gohcl.DecodeBody(hclFile.Body, nil, &file); diags.HasErrors() {
+		return nil, fmt.Errorf("decode %s: %s", path, diags.Error())
+	}
+
+	seen := make(map[string]struct{}, len(file.Environments))
+	for _, env := range file.Environments {
+		if _, ok := seen[env.Name]; ok {
+			return nil, fmt.Errorf("%s: duplicate environment block %q", path, env.Name)
+		}
+		seen[env.Name] = struct{}{}
+	}
+	return &file, nil
+}
+
+// For returns the top-level settings with the matching environment block
+// applied on top.
+func (f *File) For(env string) Settings {
+	if f == nil {
+		return Settings{}
+	}
+	merged := f.Settings
+	for _, block := range f.Environments {
+		if block.Name != env {
+			continue
+		}
+		o := block.Settings
+		if o.AccountID != nil {
+			merged.AccountID = o.AccountID
+		}
+		if o.Region != nil {
+			merged.Region = o.Region
+		}
+		if o.Parallelism != nil {
+			merged.Parallelism = o.Parallelism
+		}
+		if o.AdaptiveParallelism != nil {
+			merged.AdaptiveParallelism = o.AdaptiveParallelism
+		}
+		if o.Cache != nil {
+			merged.Cache = o.Cache
+		}
+		if o.StateBackups != nil {
+			merged.StateBackups = o.StateBackups
+		}
+		if o.Refresh != nil {
+			merged.Refresh = o.Refresh
+		}
+		if o.ForcePlan != nil {
+			merged.ForcePlan = o.ForcePlan
+		}
+		if o.TerraformVersion != nil {
+			merged.TerraformVersion = o.TerraformVersion
+		}
+		if o.Engine != nil {
+			merged.Engine = o.Engine
+		}
+		if o.ReleasesMirror != nil {
+			merged.ReleasesMirror = o.ReleasesMirror
+		}
+		if o.CLIConfig != nil {
+			merged.CLIConfig = o.CLIConfig
+		}
+		if o.PluginCache != nil {
+			merged.PluginCache = o.PluginCache
+		}
+		if o.PluginCacheLock != nil {
+			merged.PluginCacheLock = o.PluginCacheLock
+		}
+		if o.Profile != nil {
+			merged.Profile = o.Profile
+		}
+		if o.Backend != nil {
+			merged.Backend = o.Backend
+		}
+		if o.AssumeRoleARN != nil {
+			merged.AssumeRoleARN = o.AssumeRoleARN
+		}
+		if o.AllowedRegions != nil {
+			merged.AllowedRegions = o.AllowedRegions
+		}
+		if o.RetryAttempts != nil {
+			merged.RetryAttempts = o.RetryAttempts
+		}
+		if o.RetryDelay != nil {
+			merged.RetryDelay = o.RetryDelay
+		}
+		if o.RetryPatterns != nil {
+			merged.RetryPatterns = o.RetryPatterns
+		}
+		if o.LockWait != nil {
+			merged.LockWait = o.LockWait
+		}
+		if o.Tenant != nil {
+			merged.Tenant = o.Tenant
+		}
+		if o.KeepRuns != nil {
+			merged.KeepRuns = o.KeepRuns
+		}
+		if o.MaxArtifactAge != nil {
+			merged.MaxArtifactAge = o.MaxArtifactAge
+		}
+		if o.ApplyIdentities != nil {
+			merged.ApplyIdentities = o.ApplyIdentities
+		}
+		if o.TagAttributes != nil {
+			// Later blocks win, so the environment's replace the top-level
+			// ones for the same provider.
+			merged.TagAttributes = append(append([]TagAttributes(nil), merged.TagAttributes...), o.TagAttributes...)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,134 @@
+package wrapperconfig_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-wrapper/internal/wrapperconfig"
+)
+
+func TestLoadMergesEnvironmentBlock(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, wrapperconfig.FileName), []byte(`
+default_environment = "dev"
+region              = "eu-west-2"
+parallelism         = 8
+force_plan          = ["core-services/network"]
+allowed_regions     = ["eu-west-2"]
+tenant              = "payments"
+keep_runs           = 20
+engine              = "terraform"
+releases_mirror     = "https://artifactory.example.com/hashicorp"
+cli_config          = "terraform.rc"
+plugin_cache        = false
+
+tag_attributes "google" {
+  attributes = ["labels"]
+}
+
+environment "prod" {
+  region          = "eu-west-1"
+  parallelism     = 2
+  cache           = false
+  allowed_regions = ["eu-west-1", "us-east-1"]
+  retry_attempts  = 5
+  retry_patterns  = ["InternalError"]
+  lock_wait       = "15m"
+  engine          = "tofu"
+  cli_config      = "prod.tfrc"
+  plugin_cache    = true
+
+  plugin_cache_lock = true
+
+  apply_identities = ["arn:aws:iam::123456789012:role/ci-deploy"]
+
+  adaptive_parallelism = true
+  state_backups        = true
+  max_artifact_age     = "90d"
+
+  tag_attributes "google" {
+    attributes = ["labels", "terraform_labels"]
+  }
+
+  backend {
+    type   = "gcs"
+    bucket = "prod-tf-state"
+  }
+}
+`), 0o644))
+
+	file, err := wrapperconfig.Load(root)
+	require.NoError(t, err)
+	require.Equal(t, "dev", *file.DefaultEnvironment)
+
+	dev := file.For("dev")
+	require.Equal(t, "eu-west-2", *dev.Region)
+	require.Equal(t, 8, *dev.Parallelism)
+	require.Nil(t, dev.Cache)
+	require.Equal(t, []string{"core-services/network"}, dev.ForcePlan)
+	require.Nil(t, dev.Backend)
+	require.Equal(t, []string{"eu-west-2"}, dev.AllowedRegions)
+	require.Nil(t, dev.RetryAttempts)
+	require.Nil(t, dev.LockWait)
+	require.Nil(t, dev.AdaptiveParallelism)
+	require.Nil(t, dev.StateBackups)
+	require.Equal(t, "payments", *dev.Tenant)
+	require.Equal(t, 20, *dev.KeepRuns)
+	require.Nil(t, dev.MaxArtifactAge)
+	require.Nil(t, dev.ApplyIdentities)
+	require.Equal(t, "terraform", *dev.Engine)
+	require.Equal(t, "terraform.rc", *dev.CLIConfig)
+	require.False(t, *dev.PluginCache)
+	require.Nil(t, dev.PluginCacheLock)
+	require.Equal(t, []wrapperconfig.TagAttributes{{Provider: "google", Attributes: []string{"labels"}}}, dev.TagAttributes)
+
+	prod := file.For("prod")
+	require.Equal(t, "eu-west-1", *prod.Region)
+	require.Equal(t, 2, *prod.Parallelism)
+	require.False(t, *prod.Cache)
+	require.Equal(t, []string{"core-services/network"}, prod.ForcePlan)
+	require.Equal(t, "gcs", prod.Backend.Type)
+	require.Equal(t, "prod-tf-state", prod.Backend.Bucket)
+	require.Equal(t, []string{"eu-west-1", "us-east-1"}, prod.AllowedRegions)
+	require.Equal(t, 5, *prod.RetryAttempts)
+	require.Equal(t, []string{"InternalError"}, prod.RetryPatterns)
+	require.Equal(t, "15m", *prod.LockWait)
+	require.True(t, *prod.AdaptiveParallelism)
+	require.True(t, *prod.StateBackups)
+	require.Equal(t, "payments", *prod.Tenant)
+	require.Equal(t, 20, *prod.KeepRuns)
+	require.Equal(t, "90d", *prod.MaxArtifactAge)
+	require.Equal(t, []string{"arn:aws:iam::123456789012:role/ci-deploy"}, prod.ApplyIdentities)
+	require.Equal(t, "tofu", *prod.Engine)
+	require.Equal(t, "https://artifactory.example.com/hashicorp", *prod.ReleasesMirror)
+	require.Equal(t, "prod.tfrc", *prod.CLIConfig)
+	require.True(t, *prod.PluginCache)
+	require.True(t, *prod.PluginCacheLock)
+	require.Equal(t, []wrapperconfig.TagAttributes{
+		{Provider: "google", Attributes: []string{"labels"}},
+		{Provider: "google", Attributes: []string{"labels", "terraform_labels"}},
+	}, prod.TagAttributes)
+}
+
+func TestLoadMissingAndInvalidFiles(t *testing.T) {
+	t.Parallel()
+
+	file, err := wrapperconfig.Load(t.TempDir())
+	require.NoError(t, err)
+	require.Nil(t, file)
+	require.Nil(t, file.For("dev").Region)
+
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, wrapperconfig.FileName), []byte(`paralelism = 4`), 0o644))
+	_, err = wrapperconfig.Load(root)
+	require.ErrorContains(t, err, "paralelism")
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, wrapperconfig.FileName), []byte("environment \"dev\" {}\nenvironment \"dev\" {}\n"), 0o644))
+	_, err = wrapperconfig.Load(root)
+	require.ErrorContains(t, err, "duplicate environment")
+}